@@ -0,0 +1,291 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.27.1
+// 	protoc        v3.17.3
+// source: gunk/access.proto
+
+package access
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	descriptorpb "google.golang.org/protobuf/types/descriptorpb"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// MethodAccess declares who may call a method. Gunk sets it from the Roles and
+// Permissions annotations of a method.
+type MethodAccess struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// The roles allowed to call the method; any of them is enough.
+	Roles []string `protobuf:"bytes,1,rep,name=roles,proto3" json:"roles,omitempty"`
+	// The permissions required to call the method; all of them are needed.
+	Permissions []string `protobuf:"bytes,2,rep,name=permissions,proto3" json:"permissions,omitempty"`
+}
+
+func (x *MethodAccess) Reset() {
+	*x = MethodAccess{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_gunk_access_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *MethodAccess) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MethodAccess) ProtoMessage() {}
+
+func (x *MethodAccess) ProtoReflect() protoreflect.Message {
+	mi := &file_gunk_access_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MethodAccess.ProtoReflect.Descriptor instead.
+func (*MethodAccess) Descriptor() ([]byte, []int) {
+	return file_gunk_access_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *MethodAccess) GetRoles() []string {
+	if x != nil {
+		return x.Roles
+	}
+	return nil
+}
+
+func (x *MethodAccess) GetPermissions() []string {
+	if x != nil {
+		return x.Permissions
+	}
+	return nil
+}
+
+// FieldAccess restricts who may read or write a field. Gunk sets it from the
+// Read-Roles and Write-Roles annotations of a field.
+type FieldAccess struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// The roles allowed to read the field.
+	ReadRoles []string `protobuf:"bytes,1,rep,name=read_roles,json=readRoles,proto3" json:"read_roles,omitempty"`
+	// The roles allowed to write the field.
+	WriteRoles []string `protobuf:"bytes,2,rep,name=write_roles,json=writeRoles,proto3" json:"write_roles,omitempty"`
+}
+
+func (x *FieldAccess) Reset() {
+	*x = FieldAccess{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_gunk_access_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *FieldAccess) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FieldAccess) ProtoMessage() {}
+
+func (x *FieldAccess) ProtoReflect() protoreflect.Message {
+	mi := &file_gunk_access_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FieldAccess.ProtoReflect.Descriptor instead.
+func (*FieldAccess) Descriptor() ([]byte, []int) {
+	return file_gunk_access_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *FieldAccess) GetReadRoles() []string {
+	if x != nil {
+		return x.ReadRoles
+	}
+	return nil
+}
+
+func (x *FieldAccess) GetWriteRoles() []string {
+	if x != nil {
+		return x.WriteRoles
+	}
+	return nil
+}
+
+var file_gunk_access_proto_extTypes = []protoimpl.ExtensionInfo{
+	{
+		ExtendedType:  (*descriptorpb.MethodOptions)(nil),
+		ExtensionType: (*MethodAccess)(nil),
+		Field:         5732,
+		Name:          "gunk.access.method",
+		Tag:           "bytes,5732,opt,name=method",
+		Filename:      "gunk/access.proto",
+	},
+	{
+		ExtendedType:  (*descriptorpb.FieldOptions)(nil),
+		ExtensionType: (*FieldAccess)(nil),
+		Field:         5733,
+		Name:          "gunk.access.field",
+		Tag:           "bytes,5733,opt,name=field",
+		Filename:      "gunk/access.proto",
+	},
+}
+
+// Extension fields to descriptorpb.MethodOptions.
+var (
+	// See `MethodAccess`.
+	//
+	// optional gunk.access.MethodAccess method = 5732;
+	E_Method = &file_gunk_access_proto_extTypes[0]
+)
+
+// Extension fields to descriptorpb.FieldOptions.
+var (
+	// See `FieldAccess`.
+	//
+	// optional gunk.access.FieldAccess field = 5733;
+	E_Field = &file_gunk_access_proto_extTypes[1]
+)
+
+var File_gunk_access_proto protoreflect.FileDescriptor
+
+var file_gunk_access_proto_rawDesc = []byte{
+	0x0a, 0x11, 0x67, 0x75, 0x6e, 0x6b, 0x2f, 0x61, 0x63, 0x63, 0x65, 0x73, 0x73, 0x2e, 0x70, 0x72,
+	0x6f, 0x74, 0x6f, 0x12, 0x0b, 0x67, 0x75, 0x6e, 0x6b, 0x2e, 0x61, 0x63, 0x63, 0x65, 0x73, 0x73,
+	0x1a, 0x20, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75,
+	0x66, 0x2f, 0x64, 0x65, 0x73, 0x63, 0x72, 0x69, 0x70, 0x74, 0x6f, 0x72, 0x2e, 0x70, 0x72, 0x6f,
+	0x74, 0x6f, 0x22, 0x46, 0x0a, 0x0c, 0x4d, 0x65, 0x74, 0x68, 0x6f, 0x64, 0x41, 0x63, 0x63, 0x65,
+	0x73, 0x73, 0x12, 0x14, 0x0a, 0x05, 0x72, 0x6f, 0x6c, 0x65, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28,
+	0x09, 0x52, 0x05, 0x72, 0x6f, 0x6c, 0x65, 0x73, 0x12, 0x20, 0x0a, 0x0b, 0x70, 0x65, 0x72, 0x6d,
+	0x69, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x09, 0x52, 0x0b, 0x70,
+	0x65, 0x72, 0x6d, 0x69, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x73, 0x22, 0x4d, 0x0a, 0x0b, 0x46, 0x69,
+	0x65, 0x6c, 0x64, 0x41, 0x63, 0x63, 0x65, 0x73, 0x73, 0x12, 0x1d, 0x0a, 0x0a, 0x72, 0x65, 0x61,
+	0x64, 0x5f, 0x72, 0x6f, 0x6c, 0x65, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x09, 0x52, 0x09, 0x72,
+	0x65, 0x61, 0x64, 0x52, 0x6f, 0x6c, 0x65, 0x73, 0x12, 0x1f, 0x0a, 0x0b, 0x77, 0x72, 0x69, 0x74,
+	0x65, 0x5f, 0x72, 0x6f, 0x6c, 0x65, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x09, 0x52, 0x0a, 0x77,
+	0x72, 0x69, 0x74, 0x65, 0x52, 0x6f, 0x6c, 0x65, 0x73, 0x3a, 0x52, 0x0a, 0x06, 0x6d, 0x65, 0x74,
+	0x68, 0x6f, 0x64, 0x12, 0x1e, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f,
+	0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x4d, 0x65, 0x74, 0x68, 0x6f, 0x64, 0x4f, 0x70, 0x74, 0x69,
+	0x6f, 0x6e, 0x73, 0x18, 0xe4, 0x2c, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x19, 0x2e, 0x67, 0x75, 0x6e,
+	0x6b, 0x2e, 0x61, 0x63, 0x63, 0x65, 0x73, 0x73, 0x2e, 0x4d, 0x65, 0x74, 0x68, 0x6f, 0x64, 0x41,
+	0x63, 0x63, 0x65, 0x73, 0x73, 0x52, 0x06, 0x6d, 0x65, 0x74, 0x68, 0x6f, 0x64, 0x3a, 0x4e, 0x0a,
+	0x05, 0x66, 0x69, 0x65, 0x6c, 0x64, 0x12, 0x1d, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e,
+	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x46, 0x69, 0x65, 0x6c, 0x64, 0x4f, 0x70,
+	0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0xe5, 0x2c, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x18, 0x2e, 0x67,
+	0x75, 0x6e, 0x6b, 0x2e, 0x61, 0x63, 0x63, 0x65, 0x73, 0x73, 0x2e, 0x46, 0x69, 0x65, 0x6c, 0x64,
+	0x41, 0x63, 0x63, 0x65, 0x73, 0x73, 0x52, 0x05, 0x66, 0x69, 0x65, 0x6c, 0x64, 0x42, 0x2b, 0x5a,
+	0x29, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x67, 0x75, 0x6e, 0x6b,
+	0x2f, 0x67, 0x75, 0x6e, 0x6b, 0x2f, 0x61, 0x73, 0x73, 0x65, 0x74, 0x73, 0x2f, 0x61, 0x63, 0x63,
+	0x65, 0x73, 0x73, 0x3b, 0x61, 0x63, 0x63, 0x65, 0x73, 0x73, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74,
+	0x6f, 0x33,
+}
+
+var (
+	file_gunk_access_proto_rawDescOnce sync.Once
+	file_gunk_access_proto_rawDescData = file_gunk_access_proto_rawDesc
+)
+
+func file_gunk_access_proto_rawDescGZIP() []byte {
+	file_gunk_access_proto_rawDescOnce.Do(func() {
+		file_gunk_access_proto_rawDescData = protoimpl.X.CompressGZIP(file_gunk_access_proto_rawDescData)
+	})
+	return file_gunk_access_proto_rawDescData
+}
+
+var file_gunk_access_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_gunk_access_proto_goTypes = []interface{}{
+	(*MethodAccess)(nil),               // 0: gunk.access.MethodAccess
+	(*FieldAccess)(nil),                // 1: gunk.access.FieldAccess
+	(*descriptorpb.MethodOptions)(nil), // 2: google.protobuf.MethodOptions
+	(*descriptorpb.FieldOptions)(nil),  // 3: google.protobuf.FieldOptions
+}
+var file_gunk_access_proto_depIdxs = []int32{
+	2, // 0: gunk.access.method:extendee -> google.protobuf.MethodOptions
+	3, // 1: gunk.access.field:extendee -> google.protobuf.FieldOptions
+	0, // 2: gunk.access.method:type_name -> gunk.access.MethodAccess
+	1, // 3: gunk.access.field:type_name -> gunk.access.FieldAccess
+	4, // [4:4] is the sub-list for method output_type
+	4, // [4:4] is the sub-list for method input_type
+	2, // [2:4] is the sub-list for extension type_name
+	0, // [0:2] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_gunk_access_proto_init() }
+func file_gunk_access_proto_init() {
+	if File_gunk_access_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_gunk_access_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*MethodAccess); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_gunk_access_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*FieldAccess); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_gunk_access_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   2,
+			NumExtensions: 2,
+			NumServices:   0,
+		},
+		GoTypes:           file_gunk_access_proto_goTypes,
+		DependencyIndexes: file_gunk_access_proto_depIdxs,
+		MessageInfos:      file_gunk_access_proto_msgTypes,
+		ExtensionInfos:    file_gunk_access_proto_extTypes,
+	}.Build()
+	File_gunk_access_proto = out.File
+	file_gunk_access_proto_rawDesc = nil
+	file_gunk_access_proto_goTypes = nil
+	file_gunk_access_proto_depIdxs = nil
+}
@@ -3,20 +3,45 @@ package assets
 import (
 	"embed"
 	"path"
+	"strings"
 )
 
 //go:generate bundled/gen.sh
-//go:generate protoc -Ibundled/ --include_imports -ogen/google_api_annotations.fdp bundled/google/api/annotations.proto
+//go:generate go run gen_googleapis.go
 //go:generate protoc -Ibundled/ --include_imports -ogen/google_protobuf_empty.fdp bundled/google/protobuf/empty.proto
 //go:generate protoc -Ibundled/ --include_imports -ogen/google_protobuf_timestamp.fdp bundled/google/protobuf/timestamp.proto
 //go:generate protoc -Ibundled/ --include_imports -ogen/google_protobuf_duration.fdp bundled/google/protobuf/duration.proto
+//go:generate protoc -Ibundled/ --include_imports -ogen/google_protobuf_descriptor.fdp bundled/google/protobuf/descriptor.proto
+//go:generate protoc -Ibundled/ --include_imports -ogen/google_protobuf_any.fdp bundled/google/protobuf/any.proto
+//go:generate protoc -Ibundled/ --include_imports -ogen/google_protobuf_struct.fdp bundled/google/protobuf/struct.proto
+//go:generate protoc -Ibundled/ --include_imports -ogen/google_protobuf_field_mask.fdp bundled/google/protobuf/field_mask.proto
+//go:generate protoc -Ibundled/ --include_imports -ogen/google_protobuf_wrappers.fdp bundled/google/protobuf/wrappers.proto
 //go:generate protoc -Ibundled/ --include_imports -ogen/protoc-gen-openapiv2_options_annotations.fdp bundled/protoc-gen-openapiv2/options/annotations.proto
+//go:generate protoc -Ibundled/ --include_imports -ogen/gunk_cache.fdp bundled/gunk/cache.proto
+//go:generate protoc -Ibundled/ --go_out=. --go_opt=module=github.com/gunk/gunk/assets bundled/gunk/cache.proto
+//go:generate protoc -Ibundled/ --include_imports -ogen/gunk_access.fdp bundled/gunk/access.proto
+//go:generate protoc -Ibundled/ --go_out=. --go_opt=module=github.com/gunk/gunk/assets bundled/gunk/access.proto
+//go:generate protoc -Ibundled/ --include_imports -ogen/gunk_serviceconfig.fdp bundled/gunk/serviceconfig.proto
+//go:generate protoc -Ibundled/ --go_out=. --go_opt=module=github.com/gunk/gunk/assets bundled/gunk/serviceconfig.proto
 // Assets contains gen project assets.
 //
 //go:embed gen/*
 var Assets embed.FS
 
+// GoogleapisVersion is the version of the google.golang.org/genproto module
+// which the bundled googleapis common protos, such as google/api/resource.proto
+// and google/rpc/status.proto, were taken from.
+var GoogleapisVersion = strings.TrimSpace(string(mustReadFile("googleapis.version")))
+
 // ReadFile returns a file from the assets.
 func ReadFile(name string) ([]byte, error) {
 	return Assets.ReadFile(path.Join("gen", name))
 }
+
+func mustReadFile(name string) []byte {
+	buf, err := ReadFile(name)
+	if err != nil {
+		panic(err)
+	}
+	return buf
+}
@@ -4,15 +4,12 @@ SRC=$(realpath $(cd -P "$(dirname "${BASH_SOURCE[0]}")" && pwd))
 
 # grab google protobuf definitions
 mkdir -p $SRC/google/protobuf
-for i in descriptor duration empty timestamp; do
+for i in any descriptor duration empty field_mask struct timestamp wrappers; do
   wget -O $SRC/google/protobuf/$i.proto https://raw.githubusercontent.com/protocolbuffers/protobuf/master/src/google/protobuf/$i.proto
 done
 
-# grab google api definitions
-mkdir -p $SRC/google/api
-for i in annotations http; do
-  wget -O $SRC/google/api/$i.proto https://raw.githubusercontent.com/googleapis/googleapis/master/google/api/$i.proto
-done
+# the googleapis common protos, such as google/api and google/type, are
+# bundled from the pinned genproto module by gen_googleapis.go
 
 # grab grpc-gateway (protoc-gen-openapiv2) definitions
 mkdir -p $SRC/protoc-gen-openapiv2/options
@@ -0,0 +1,103 @@
+//go:build ignore
+
+// gen_googleapis writes gen/googleapis.fdp, the bundle of googleapis common
+// protos, from the descriptors registered by the google.golang.org/genproto
+// module. The version of the bundle is thus pinned by go.mod; update it with:
+//
+//	go get google.golang.org/genproto@<version> && go generate ./assets
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	_ "google.golang.org/genproto/googleapis/api"
+	_ "google.golang.org/genproto/googleapis/api/annotations"
+	_ "google.golang.org/genproto/googleapis/api/httpbody"
+	_ "google.golang.org/genproto/googleapis/longrunning"
+	_ "google.golang.org/genproto/googleapis/rpc/code"
+	_ "google.golang.org/genproto/googleapis/rpc/errdetails"
+	_ "google.golang.org/genproto/googleapis/rpc/status"
+	_ "google.golang.org/genproto/googleapis/type/calendarperiod"
+	_ "google.golang.org/genproto/googleapis/type/color"
+	_ "google.golang.org/genproto/googleapis/type/date"
+	_ "google.golang.org/genproto/googleapis/type/datetime"
+	_ "google.golang.org/genproto/googleapis/type/dayofweek"
+	_ "google.golang.org/genproto/googleapis/type/decimal"
+	_ "google.golang.org/genproto/googleapis/type/expr"
+	_ "google.golang.org/genproto/googleapis/type/fraction"
+	_ "google.golang.org/genproto/googleapis/type/interval"
+	_ "google.golang.org/genproto/googleapis/type/latlng"
+	_ "google.golang.org/genproto/googleapis/type/localized_text"
+	_ "google.golang.org/genproto/googleapis/type/money"
+	_ "google.golang.org/genproto/googleapis/type/month"
+	_ "google.golang.org/genproto/googleapis/type/phone_number"
+	_ "google.golang.org/genproto/googleapis/type/postaladdress"
+	_ "google.golang.org/genproto/googleapis/type/quaternion"
+	_ "google.golang.org/genproto/googleapis/type/timeofday"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// bundledPrefixes are the prefixes of the paths of the bundled protos.
+var bundledPrefixes = []string{"google/api/", "google/longrunning/", "google/rpc/", "google/type/"}
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	var fset descriptorpb.FileDescriptorSet
+	seen := make(map[string]bool)
+	// Files are added after their imports, like protoc --include_imports
+	// does.
+	var add func(fd protoreflect.FileDescriptor)
+	add = func(fd protoreflect.FileDescriptor) {
+		if seen[fd.Path()] {
+			return
+		}
+		seen[fd.Path()] = true
+		imports := fd.Imports()
+		for i := 0; i < imports.Len(); i++ {
+			add(imports.Get(i).FileDescriptor)
+		}
+		fset.File = append(fset.File, protodesc.ToFileDescriptorProto(fd))
+	}
+	// Sort the files, as the registry doesn't keep them in order, so that
+	// the bundle only changes along with the protos.
+	var files []protoreflect.FileDescriptor
+	protoregistry.GlobalFiles.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		for _, prefix := range bundledPrefixes {
+			if strings.HasPrefix(fd.Path(), prefix) {
+				files = append(files, fd)
+				break
+			}
+		}
+		return true
+	})
+	sort.Slice(files, func(i, j int) bool { return files[i].Path() < files[j].Path() })
+	for _, fd := range files {
+		add(fd)
+	}
+	buf, err := proto.MarshalOptions{Deterministic: true}.Marshal(&fset)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile("gen/googleapis.fdp", buf, 0o644); err != nil {
+		return err
+	}
+	out, err := exec.Command("go", "list", "-m", "-f", "{{.Version}}", "google.golang.org/genproto").Output()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile("gen/googleapis.version", out, 0o644)
+}
@@ -0,0 +1,218 @@
+// Package changelog summarizes the changes to Gunk packages as a
+// conventional commit message, to streamline the review of schema changes.
+package changelog
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gunk/gunk/generate"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// emptyTree is the hash of the empty git tree, which is what the changes are
+// compared against before the first commit.
+const emptyTree = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
+// Run writes to w a commit message summarizing the changes to the Gunk
+// packages in dir since the last commit. If staged is set, only the changes
+// staged in the git index are considered; otherwise, those in the working
+// tree are.
+func Run(w io.Writer, dir string, staged bool) error {
+	if dir == "" {
+		dir = "."
+	}
+	base := "HEAD"
+	if _, err := git(dir, nil, "rev-parse", "--verify", "--quiet", "HEAD"); err != nil {
+		base = emptyTree
+	}
+	args := []string{"diff", "--name-only", "--relative"}
+	if staged {
+		args = append(args, "--cached")
+	}
+	out, err := git(dir, nil, append(args, base, "--", "*.gunk")...)
+	if err != nil {
+		return err
+	}
+	pkgDirs := make(map[string]bool)
+	for _, name := range strings.Fields(out) {
+		pkgDirs[path.Dir(name)] = true
+	}
+	if len(pkgDirs) == 0 {
+		return fmt.Errorf("no changes to Gunk files")
+	}
+	tmp, err := ioutil.TempDir("", "gunk-changelog")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	prefix, err := git(dir, nil, "rev-parse", "--show-prefix")
+	if err != nil {
+		return err
+	}
+	prefix = strings.TrimSpace(prefix)
+	// Export the old and new trees, so that they can be loaded like the
+	// working tree.
+	oldDir := filepath.Join(tmp, "old")
+	index := []string{"GIT_INDEX_FILE=" + filepath.Join(tmp, "index")}
+	if _, err := git(dir, index, "read-tree", base); err != nil {
+		return err
+	}
+	if _, err := git(dir, index, "checkout-index", "--all", "--prefix="+oldDir+string(filepath.Separator)); err != nil {
+		return err
+	}
+	oldDir = filepath.Join(oldDir, filepath.FromSlash(prefix))
+	newDir := dir
+	if staged {
+		newDir = filepath.Join(tmp, "new")
+		if _, err := git(dir, nil, "checkout-index", "--all", "--prefix="+newDir+string(filepath.Separator)); err != nil {
+			return err
+		}
+		newDir = filepath.Join(newDir, filepath.FromSlash(prefix))
+	}
+	var sorted []string
+	for pkgDir := range pkgDirs {
+		sorted = append(sorted, pkgDir)
+	}
+	sort.Strings(sorted)
+	var pkgs []pkgChanges
+	for _, pkgDir := range sorted {
+		old, err := loadPackage(oldDir, pkgDir)
+		if err != nil {
+			return fmt.Errorf("unable to load %s before the changes: %w", pkgDir, err)
+		}
+		new, err := loadPackage(newDir, pkgDir)
+		if err != nil {
+			return fmt.Errorf("unable to load %s: %w", pkgDir, err)
+		}
+		name := new.GetPackage()
+		if new == nil {
+			name = old.GetPackage()
+		}
+		pkgs = append(pkgs, pkgChanges{name, Diff(old, new)})
+	}
+	_, err = io.WriteString(w, message(pkgs))
+	return err
+}
+
+// loadPackage returns the descriptor of the Gunk package in pkgDir, relative
+// to dir, or nil if there is no such package.
+func loadPackage(dir, pkgDir string) (*descriptorpb.FileDescriptorProto, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, filepath.FromSlash(pkgDir), "*.gunk"))
+	if err != nil || len(matches) == 0 {
+		return nil, err
+	}
+	fds, err := generate.FileDescriptorSet(dir, "./"+pkgDir)
+	if err != nil {
+		return nil, err
+	}
+	// The package is the one file which no other file depends on, as the
+	// set also holds the package's dependencies.
+	deps := make(map[string]bool)
+	for _, f := range fds.File {
+		for _, dep := range f.Dependency {
+			deps[dep] = true
+		}
+	}
+	for _, f := range fds.File {
+		if !deps[f.GetName()] && strings.HasSuffix(f.GetName(), "/all.proto") {
+			return f, nil
+		}
+	}
+	return nil, fmt.Errorf("no descriptor found for %s", pkgDir)
+}
+
+func git(dir string, env []string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), env...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %v: %s", args[0], err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return string(out), nil
+}
+
+type pkgChanges struct {
+	name    string
+	changes []Change
+}
+
+// message returns the conventional commit message summarizing the changes to
+// the packages. Breaking changes are marked with "!" and listed in
+// BREAKING CHANGE footers.
+func message(pkgs []pkgChanges) string {
+	var scopes []string
+	var all []Change
+	for _, pkg := range pkgs {
+		scopes = append(scopes, pkg.name)
+		for _, c := range pkg.changes {
+			if len(pkgs) > 1 && c.What != "package" {
+				c.Name = pkg.name + "." + c.Name
+			}
+			all = append(all, c)
+		}
+	}
+	// List the most significant changes first.
+	sort.SliceStable(all, func(i, j int) bool { return all[i].Kind > all[j].Kind })
+	var sb strings.Builder
+	sb.WriteString(commitType(all))
+	fmt.Fprintf(&sb, "(%s)", strings.Join(scopes, ","))
+	if len(all) > 0 && all[0].Kind == Breaking {
+		sb.WriteString("!")
+	}
+	switch len(all) {
+	case 0:
+		sb.WriteString(": format Gunk files\n")
+		return sb.String()
+	case 1:
+		fmt.Fprintf(&sb, ": %s\n", all[0])
+	case 2:
+		fmt.Fprintf(&sb, ": %s and 1 more change\n", all[0])
+	default:
+		fmt.Fprintf(&sb, ": %s and %d more changes\n", all[0], len(all)-1)
+	}
+	if len(all) > 1 {
+		sb.WriteString("\n")
+		for _, c := range all {
+			fmt.Fprintf(&sb, "- %s\n", c)
+		}
+	}
+	for i, c := range all {
+		if c.Kind != Breaking {
+			break
+		}
+		if i == 0 {
+			sb.WriteString("\n")
+		}
+		fmt.Fprintf(&sb, "BREAKING CHANGE: %s\n", c)
+	}
+	return sb.String()
+}
+
+// commitType returns the conventional commit type of the changes.
+func commitType(changes []Change) string {
+	kinds := make(map[Kind]bool)
+	for _, c := range changes {
+		kinds[c.Kind] = true
+	}
+	switch {
+	case kinds[Breaking], kinds[Additive]:
+		return "feat"
+	case kinds[Changed]:
+		return "fix"
+	case kinds[Docs]:
+		return "docs"
+	}
+	return "style"
+}
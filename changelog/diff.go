@@ -0,0 +1,291 @@
+package changelog
+
+import (
+	"fmt"
+	"reflect"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Kind classifies a change to a Gunk package.
+type Kind int
+
+const (
+	// Docs changes only touch the documentation.
+	Docs Kind = iota
+	// Changed changes modify options, which may or may not affect clients.
+	Changed
+	// Additive changes add declarations, and are backwards compatible.
+	Additive
+	// Breaking changes remove or alter declarations, so that existing
+	// clients or stored data may no longer be compatible.
+	Breaking
+)
+
+// Change is a change to a declaration of a Gunk package, such as "remove
+// field Message.name".
+type Change struct {
+	Kind Kind
+	// Verb is what happened to the declaration, such as "add" or
+	// "change type of".
+	Verb string
+	// What is the kind of declaration, such as "message" or "field".
+	What string
+	// Name is the name of the declaration, relative to its package.
+	Name string
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s %s %s", c.Verb, c.What, c.Name)
+}
+
+// Diff returns the changes from the old to the new descriptor of a Gunk
+// package. Either may be nil, if the package was added or removed.
+func Diff(old, new *descriptorpb.FileDescriptorProto) []Change {
+	d := &differ{}
+	switch {
+	case old == nil && new == nil:
+		return nil
+	case old == nil:
+		d.add(Additive, "add", "package", new.GetPackage())
+		return d.changes
+	case new == nil:
+		d.add(Breaking, "remove", "package", old.GetPackage())
+		return d.changes
+	}
+	if old.GetPackage() != new.GetPackage() {
+		d.add(Breaking, "rename", "package", old.GetPackage()+" to "+new.GetPackage())
+	}
+	if !proto.Equal(old.GetOptions(), new.GetOptions()) {
+		d.add(Changed, "change options of", "package", new.GetPackage())
+	}
+	d.messages("", old.MessageType, new.MessageType)
+	d.enums("", old.EnumType, new.EnumType)
+	d.services(old.Service, new.Service)
+	if len(d.changes) == 0 && !sameComments(old.GetSourceCodeInfo(), new.GetSourceCodeInfo()) {
+		d.add(Docs, "update documentation of", "package", new.GetPackage())
+	}
+	return d.changes
+}
+
+// sameComments reports whether the source code infos hold the same comments,
+// ignoring the spans, which change whenever declarations move.
+func sameComments(old, new *descriptorpb.SourceCodeInfo) bool {
+	comments := func(info *descriptorpb.SourceCodeInfo) map[string][2]string {
+		m := make(map[string][2]string)
+		for _, loc := range info.GetLocation() {
+			m[fmt.Sprint(loc.Path)] = [2]string{loc.GetLeadingComments(), loc.GetTrailingComments()}
+		}
+		return m
+	}
+	return reflect.DeepEqual(comments(old), comments(new))
+}
+
+type differ struct {
+	changes []Change
+}
+
+func (d *differ) add(kind Kind, verb, what, name string) {
+	d.changes = append(d.changes, Change{Kind: kind, Verb: verb, What: what, Name: name})
+}
+
+func (d *differ) messages(prefix string, old, new []*descriptorpb.DescriptorProto) {
+	oldByName := make(map[string]*descriptorpb.DescriptorProto)
+	for _, m := range old {
+		oldByName[m.GetName()] = m
+	}
+	newByName := make(map[string]*descriptorpb.DescriptorProto)
+	for _, m := range new {
+		newByName[m.GetName()] = m
+	}
+	for _, o := range old {
+		// Map entries are compared as the type of their field.
+		if _, ok := newByName[o.GetName()]; !ok && !o.GetOptions().GetMapEntry() {
+			d.add(Breaking, "remove", "message", prefix+o.GetName())
+		}
+	}
+	for _, n := range new {
+		name := prefix + n.GetName()
+		o, ok := oldByName[n.GetName()]
+		if n.GetOptions().GetMapEntry() {
+			continue
+		}
+		if !ok {
+			d.add(Additive, "add", "message", name)
+			continue
+		}
+		if !proto.Equal(o.GetOptions(), n.GetOptions()) {
+			d.add(Changed, "change options of", "message", name)
+		}
+		d.fields(name, o, n)
+		d.messages(name+".", o.NestedType, n.NestedType)
+		d.enums(name+".", o.EnumType, n.EnumType)
+	}
+}
+
+// fields compares the fields of a message by number, as that is what
+// identifies them on the wire.
+func (d *differ) fields(msgName string, old, new *descriptorpb.DescriptorProto) {
+	oldByNum := make(map[int32]*descriptorpb.FieldDescriptorProto)
+	for _, f := range old.Field {
+		oldByNum[f.GetNumber()] = f
+	}
+	newByNum := make(map[int32]*descriptorpb.FieldDescriptorProto)
+	for _, f := range new.Field {
+		newByNum[f.GetNumber()] = f
+	}
+	for _, o := range old.Field {
+		if _, ok := newByNum[o.GetNumber()]; !ok {
+			d.add(Breaking, "remove", "field", msgName+"."+o.GetName())
+		}
+	}
+	for _, n := range new.Field {
+		name := msgName + "." + n.GetName()
+		o, ok := oldByNum[n.GetNumber()]
+		switch {
+		case !ok:
+			d.add(Additive, "add", "field", name)
+			continue
+		case o.GetName() != n.GetName():
+			d.add(Breaking, "rename", "field", msgName+"."+o.GetName()+" to "+n.GetName())
+		}
+		if fieldType(old, o) != fieldType(new, n) {
+			d.add(Breaking, "change type of", "field", name)
+		} else if o.GetLabel() != n.GetLabel() {
+			d.add(Breaking, "change label of", "field", name)
+		}
+		if !proto.Equal(o.GetOptions(), n.GetOptions()) {
+			d.add(Changed, "change options of", "field", name)
+		}
+	}
+}
+
+// fieldType returns a description of the type of the field f of msg, which
+// includes the key and value types of maps.
+func fieldType(msg *descriptorpb.DescriptorProto, f *descriptorpb.FieldDescriptorProto) string {
+	typ := f.GetType().String() + f.GetTypeName()
+	for _, nested := range msg.NestedType {
+		if nested.GetOptions().GetMapEntry() && typ == "TYPE_MESSAGE"+nestedTypeName(f.GetTypeName(), nested.GetName()) {
+			typ = "map"
+			for _, entryField := range nested.Field {
+				typ += " " + entryField.GetType().String() + entryField.GetTypeName()
+			}
+		}
+	}
+	return typ
+}
+
+// nestedTypeName returns the full name of the nested type called name, when
+// a field refers to it by typeName.
+func nestedTypeName(typeName, name string) string {
+	for i := len(typeName) - 1; i >= 0; i-- {
+		if typeName[i] == '.' {
+			return typeName[:i+1] + name
+		}
+	}
+	return name
+}
+
+func (d *differ) enums(prefix string, old, new []*descriptorpb.EnumDescriptorProto) {
+	oldByName := make(map[string]*descriptorpb.EnumDescriptorProto)
+	for _, e := range old {
+		oldByName[e.GetName()] = e
+	}
+	newByName := make(map[string]*descriptorpb.EnumDescriptorProto)
+	for _, e := range new {
+		newByName[e.GetName()] = e
+	}
+	for _, o := range old {
+		if _, ok := newByName[o.GetName()]; !ok {
+			d.add(Breaking, "remove", "enum", prefix+o.GetName())
+		}
+	}
+	for _, n := range new {
+		name := prefix + n.GetName()
+		o, ok := oldByName[n.GetName()]
+		if !ok {
+			d.add(Additive, "add", "enum", name)
+			continue
+		}
+		if !proto.Equal(o.GetOptions(), n.GetOptions()) {
+			d.add(Changed, "change options of", "enum", name)
+		}
+		oldByNum := make(map[int32]*descriptorpb.EnumValueDescriptorProto)
+		for _, v := range o.Value {
+			oldByNum[v.GetNumber()] = v
+		}
+		newByNum := make(map[int32]*descriptorpb.EnumValueDescriptorProto)
+		for _, v := range n.Value {
+			newByNum[v.GetNumber()] = v
+		}
+		for _, ov := range o.Value {
+			if _, ok := newByNum[ov.GetNumber()]; !ok {
+				d.add(Breaking, "remove", "enum value", name+"."+ov.GetName())
+			}
+		}
+		for _, nv := range n.Value {
+			ov, ok := oldByNum[nv.GetNumber()]
+			switch {
+			case !ok:
+				d.add(Additive, "add", "enum value", name+"."+nv.GetName())
+			case ov.GetName() != nv.GetName():
+				d.add(Breaking, "rename", "enum value", name+"."+ov.GetName()+" to "+nv.GetName())
+			}
+		}
+	}
+}
+
+func (d *differ) services(old, new []*descriptorpb.ServiceDescriptorProto) {
+	oldByName := make(map[string]*descriptorpb.ServiceDescriptorProto)
+	for _, s := range old {
+		oldByName[s.GetName()] = s
+	}
+	newByName := make(map[string]*descriptorpb.ServiceDescriptorProto)
+	for _, s := range new {
+		newByName[s.GetName()] = s
+	}
+	for _, o := range old {
+		if _, ok := newByName[o.GetName()]; !ok {
+			d.add(Breaking, "remove", "service", o.GetName())
+		}
+	}
+	for _, n := range new {
+		o, ok := oldByName[n.GetName()]
+		if !ok {
+			d.add(Additive, "add", "service", n.GetName())
+			continue
+		}
+		if !proto.Equal(o.GetOptions(), n.GetOptions()) {
+			d.add(Changed, "change options of", "service", n.GetName())
+		}
+		oldMethods := make(map[string]*descriptorpb.MethodDescriptorProto)
+		for _, m := range o.Method {
+			oldMethods[m.GetName()] = m
+		}
+		newMethods := make(map[string]*descriptorpb.MethodDescriptorProto)
+		for _, m := range n.Method {
+			newMethods[m.GetName()] = m
+		}
+		for _, om := range o.Method {
+			if _, ok := newMethods[om.GetName()]; !ok {
+				d.add(Breaking, "remove", "method", o.GetName()+"."+om.GetName())
+			}
+		}
+		for _, nm := range n.Method {
+			name := n.GetName() + "." + nm.GetName()
+			om, ok := oldMethods[nm.GetName()]
+			if !ok {
+				d.add(Additive, "add", "method", name)
+				continue
+			}
+			if om.GetInputType() != nm.GetInputType() || om.GetOutputType() != nm.GetOutputType() ||
+				om.GetClientStreaming() != nm.GetClientStreaming() || om.GetServerStreaming() != nm.GetServerStreaming() {
+				d.add(Breaking, "change signature of", "method", name)
+			}
+			if !proto.Equal(om.GetOptions(), nm.GetOptions()) {
+				d.add(Changed, "change options of", "method", name)
+			}
+		}
+	}
+}
@@ -1,13 +1,18 @@
 package config
 
 import (
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"text/template"
+	"time"
 
 	"github.com/kenshaw/ini"
 	"github.com/kenshaw/ini/parser"
@@ -34,13 +39,177 @@ type Generator struct {
 	Out           string
 	JSONPostProc  bool
 	FixPaths      bool
-	Shortened     bool // only for `gunk vet`
+	// Param is the raw value of the param keys of the generator, passed
+	// as it is after Params.
+	Param string
+	// RegisterHelpers is whether to write functions registering the
+	// handlers of all of a package's services, for grpc-gateway.
+	RegisterHelpers bool
+	// InProcess is whether to run the go or grpc-go generator within
+	// gunk, instead of executing its plugin binary.
+	InProcess bool
+	// Remote is the remote plugin of the Buf Schema Registry run by the
+	// generator, if any, instead of a local plugin binary.
+	Remote *RemotePlugin
+	// Wasm is the path of the plugin compiled to WASI run by the
+	// generator, if any, relative to ConfigDir.
+	Wasm string
+	// PluginTimeout is how long the plugin binary may run before it's
+	// killed, or zero for the default.
+	PluginTimeout time.Duration
+	// PluginMaxOutput is the maximum size in bytes of the response of the
+	// plugin binary, or zero for the default.
+	PluginMaxOutput int64
+	// PluginEnv are the names of the environment variables passed to the
+	// plugin binary. If nil, it inherits gunk's whole environment.
+	PluginEnv []string
+	// ModuleMappings are the Swift modules or Rust paths of the imported
+	// Gunk packages, by their import paths.
+	ModuleMappings []KeyValue
+	// Packages are the patterns of the packages the generator is run for,
+	// or nil for all of them. See MatchesPackage.
+	Packages []string
+	// ConfigFile is the configuration file the generator was set in, such
+	// as a file included by the .gunkconfig in ConfigDir.
+	ConfigFile string
+	Shortened  bool // only for `gunk vet`
+}
+
+// RemotePlugin is a reference to a remote plugin of the Buf Schema Registry,
+// such as "buf.build/grpc/python:v1.50.0". An empty version is the latest one.
+type RemotePlugin struct {
+	Remote  string // such as "buf.build"
+	Owner   string
+	Name    string
+	Version string
+}
+
+// ParseRemotePlugin parses a reference to a remote plugin, of the form
+// "remote/owner/name[:version]".
+func ParseRemotePlugin(ref string) (*RemotePlugin, error) {
+	p := &RemotePlugin{}
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		ref, p.Version = ref[:i], ref[i+1:]
+		if p.Version == "" {
+			return nil, fmt.Errorf("empty version in remote plugin %q", ref)
+		}
+	}
+	parts := strings.Split(ref, "/")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return nil, fmt.Errorf("remote plugin %q should be of the form remote/owner/name[:version]", ref)
+	}
+	p.Remote, p.Owner, p.Name = parts[0], parts[1], parts[2]
+	return p, nil
+}
+
+func (p RemotePlugin) String() string {
+	s := p.Remote + "/" + p.Owner + "/" + p.Name
+	if p.Version != "" {
+		s += ":" + p.Version
+	}
+	return s
 }
 
 func (g Generator) IsDoc() bool {
 	return g.Command == "doc"
 }
 
+// IsFdset reports whether the generator writes the FileDescriptorSet of each
+// package, instead of running a protoc generator.
+func (g Generator) IsFdset() bool {
+	return g.Command == "fdset"
+}
+
+// IsBufImage reports whether the generator writes a buf image of each
+// package, instead of running a protoc generator.
+func (g Generator) IsBufImage() bool {
+	return g.Command == "bufimage"
+}
+
+// IsAccess reports whether the generator writes the access control
+// annotations of each package for policy engines, instead of running a protoc
+// generator.
+func (g Generator) IsAccess() bool {
+	return g.Command == "access"
+}
+
+// IsOpenAPI reports whether the generator writes the OpenAPI 3 document of
+// each package.
+func (g Generator) IsOpenAPI() bool {
+	return g.Command == "openapi"
+}
+
+// IsGraphQL reports whether the generator writes the GraphQL schema of each
+// package.
+func (g Generator) IsGraphQL() bool {
+	return g.Command == "graphql"
+}
+
+// IsMock reports whether the generator writes mocks of the gRPC servers and
+// clients of each package.
+func (g Generator) IsMock() bool {
+	return g.Command == "mock"
+}
+
+// IsScaffold reports whether the generator writes skeleton implementations
+// of the services of each package.
+func (g Generator) IsScaffold() bool {
+	return g.Command == "scaffold"
+}
+
+// IsServiceConfig reports whether the generator writes a gRPC service config
+// of each package.
+func (g Generator) IsServiceConfig() bool {
+	return g.Command == "serviceconfig"
+}
+
+// IsMain reports whether the generator writes a main package serving the
+// services of each package.
+func (g Generator) IsMain() bool {
+	return g.Command == "main"
+}
+
+// IsGo reports whether the generator generates Go code, which is formatted
+// with gofumpt.
+func (g Generator) IsGo() bool {
+	switch g.Code() {
+	case "go", "grpc-gateway", "grpc-go", "connect-go", "twirp":
+		return true
+	}
+	return false
+}
+
+// IsTS reports whether the generator generates TypeScript code, using any of
+// the plugins supported by the ts generator.
+func (g Generator) IsTS() bool {
+	switch g.Code() {
+	case "ts", "ts_proto", "es":
+		return true
+	}
+	return false
+}
+
+// IsPython reports whether the generator generates Python code, either the
+// messages or the gRPC services.
+func (g Generator) IsPython() bool {
+	code := g.Code()
+	return code == "python" || code == "grpc-python"
+}
+
+// IsSwift reports whether the generator generates Swift code, either the
+// messages or the gRPC services.
+func (g Generator) IsSwift() bool {
+	code := g.Code()
+	return code == "swift" || code == "grpc-swift"
+}
+
+// IsRust reports whether the generator generates Rust code, either the
+// messages with prost or the gRPC services with tonic.
+func (g Generator) IsRust() bool {
+	code := g.Code()
+	return code == "prost" || code == "tonic"
+}
+
 func (g Generator) IsProtoc() bool {
 	return g.ProtocGen != ""
 }
@@ -52,8 +221,61 @@ func (g Generator) Code() string {
 	return strings.TrimPrefix(g.Command, "protoc-gen-")
 }
 
+// MatchesPackage reports whether the generator is run for the package in dir
+// with the given import path. Each of its Packages patterns is either a path
+// relative to ConfigDir, starting with "." like "./api/public", or an import
+// path. Their elements may be globs, such as "./api/*/v1", and a final "..."
+// also matches the packages below, such as "./api/public/...".
+func (g Generator) MatchesPackage(dir, pkgPath string) bool {
+	if g.Packages == nil {
+		return true
+	}
+	for _, pattern := range g.Packages {
+		name := pkgPath
+		if strings.HasPrefix(pattern, ".") {
+			rel, err := filepath.Rel(g.ConfigDir, dir)
+			if dir == "" || err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+				continue
+			}
+			name, pattern = filepath.ToSlash(rel), path.Clean(pattern)
+		}
+		if matchPackage(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPackage reports whether a package path matches a pattern, matching
+// each element of the path with the glob of the pattern's element.
+func matchPackage(pattern, name string) bool {
+	patterns, names := strings.Split(pattern, "/"), strings.Split(name, "/")
+	if name == "." {
+		names = nil
+	}
+	if patterns[len(patterns)-1] == "..." {
+		patterns = patterns[:len(patterns)-1]
+		if len(names) < len(patterns) {
+			return false
+		}
+		names = names[:len(patterns)]
+	}
+	if pattern == "." {
+		patterns = nil
+	}
+	if len(patterns) != len(names) {
+		return false
+	}
+	for i, p := range patterns {
+		if ok, _ := path.Match(p, names[i]); !ok {
+			return false
+		}
+	}
+	return true
+}
+
 func (g Generator) HasPostproc() bool {
-	if g.Code() == "go" || g.Code() == "grpc-gateway" || g.Code() == "grpc-go" {
+	if g.IsGo() {
 		// for gofumpt
 		return true
 	}
@@ -78,18 +300,158 @@ func (g Generator) ParamString() string {
 			params[i] = p.Key
 		}
 	}
+	if g.Param != "" {
+		params = append(params, g.Param)
+	}
 	return strings.Join(params, ",")
 }
 
 type Config struct {
-	Dir           string
+	Dir string
+	// Files are the configuration files which were loaded, including the
+	// included ones.
+	Files         []string
 	Out           string
 	ImportPath    string
 	ProtocPath    string
 	ProtocVersion string
-	Generators    []Generator
-	Format        FormatConfig
-	DocsConfig    map[string]*DocConfig
+	// ProtocSHA256 are the accepted SHA-256 checksums of the protoc
+	// binary, such as one per platform, or nil to accept any.
+	ProtocSHA256 []string
+	// ProtocMirror is the base URL of the protoc releases, or a directory
+	// holding them, to download protoc from instead of GitHub. After Load,
+	// a directory is an absolute path.
+	ProtocMirror string
+	// IncludePaths are additional directories passed to protoc with -I when
+	// loading proto dependencies. After Load, they are absolute paths.
+	IncludePaths []string
+	// WrapperTypes maps pointers to scalar types to the
+	// google.protobuf wrapper messages, such as google.protobuf.Int32Value.
+	WrapperTypes bool
+	// SplitProtoFiles generates one proto file per Gunk file, instead of a
+	// single all.proto file per package.
+	SplitProtoFiles bool
+	// PluginVersions are the versions of the protoc-gen-* plugins pinned
+	// in the [plugins] section, by command, such as "v1.27.1" for
+	// "protoc-gen-go". They apply to the generators without a
+	// plugin_version of their own.
+	PluginVersions map[string]string
+	Generators     []Generator
+	// FileOptions are the templates of the file options set on every
+	// package, from the [file_options] section.
+	FileOptions []FileOption
+	Format      FormatConfig
+	Lint        LintConfig
+	DocsConfig  map[string]*DocConfig
+}
+
+// FileOption is a file option, such as go_package or java_package, whose value
+// is a template executed with the FileOptionData of each package.
+type FileOption struct {
+	Name string
+	// ConfigDir is the directory of the .gunkconfig the option was set in.
+	ConfigDir string
+	tmpl      *template.Template
+}
+
+// Template returns the text of the template of the option.
+func (o FileOption) Template() string {
+	return o.tmpl.Root.String()
+}
+
+// FileOptionData holds the values available to the file option templates.
+type FileOptionData struct {
+	// PkgPath is the import path of the package, such as
+	// "example.com/api/v1".
+	PkgPath string
+	// Name is the Go package name, such as "api".
+	Name string
+	// ProtoName is the proto package name, such as "example.api.v1".
+	ProtoName string
+	// Dir is the directory of the package relative to the .gunkconfig
+	// the option was set in, with forward slashes, such as "api/v1".
+	Dir string
+}
+
+// Value returns the value of the file option for a package.
+func (o FileOption) Value(data FileOptionData) (string, error) {
+	var sb strings.Builder
+	if err := o.tmpl.Execute(&sb, data); err != nil {
+		return "", fmt.Errorf("unable to execute %s template: %w", o.Name, err)
+	}
+	return sb.String(), nil
+}
+
+// fileOptionNames are the file options which may be set in the
+// [file_options] section; the ones holding strings.
+var fileOptionNames = map[string]bool{
+	"go_package":             true,
+	"java_package":           true,
+	"java_outer_classname":   true,
+	"csharp_namespace":       true,
+	"objc_class_prefix":      true,
+	"php_namespace":          true,
+	"php_class_prefix":       true,
+	"php_metadata_namespace": true,
+	"ruby_package":           true,
+	"swift_prefix":           true,
+}
+
+// fileOptionFuncs are the functions available to the file option templates.
+var fileOptionFuncs = template.FuncMap{
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	// title upper-cases the first letter of each part of a name, such as
+	// "Example.Api.V1" for "example.api.v1".
+	"title": func(s string) string {
+		b := []byte(s)
+		for i := range b {
+			if i == 0 || !isAlnum(b[i-1]) {
+				b[i] = byte(strings.ToUpper(string(b[i]))[0])
+			}
+		}
+		return string(b)
+	},
+	// pascal is like title, but also drops the underscores and hyphens
+	// between words, as is the convention for C# namespaces, such as
+	// "Example.MyApi.V1" for "example.my_api.v1".
+	"pascal": func(s string) string {
+		var b strings.Builder
+		upper := true
+		for i := 0; i < len(s); i++ {
+			c := s[i]
+			switch {
+			case c == '_' || c == '-':
+				upper = true
+				continue
+			case upper:
+				c = byte(strings.ToUpper(string(c))[0])
+			}
+			upper = !isAlnum(c)
+			b.WriteByte(c)
+		}
+		return b.String()
+	},
+	// javapkg converts an import path to a Java package name, with its
+	// domain reversed as is the convention, such as "com.example.api.v1"
+	// for "example.com/api/v1".
+	"javapkg": func(s string) string {
+		parts := strings.Split(s, "/")
+		if domain := strings.Split(parts[0], "."); len(domain) > 1 {
+			for i, j := 0, len(domain)-1; i < j; i, j = i+1, j-1 {
+				domain[i], domain[j] = domain[j], domain[i]
+			}
+			parts = append(domain, parts[1:]...)
+		}
+		return strings.ReplaceAll(strings.Join(parts, "."), "-", "_")
+	},
+	"replace": func(old, new, s string) string {
+		return strings.ReplaceAll(s, old, new)
+	},
+}
+
+func isAlnum(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
 }
 
 // FormatConfig is configuration for the format command.
@@ -100,6 +462,35 @@ type FormatConfig struct {
 	PB bool
 	// List of initialisms to use when formatting JSON.
 	Initialisms []string
+	// Whether to align the pb and json tags of the fields of each message.
+	AlignTags bool
+	// The column to reflow doc comments to, or 0 to leave them as they
+	// are.
+	CommentWidth int
+}
+
+// LintConfig is configuration for the lint command.
+type LintConfig struct {
+	// Packages whose doc comments may contain TODO, FIXME and XXX markers.
+	// A path ending in "/..." also allows the packages below it.
+	TodoAllowPackages []string
+	// Whether to fail generation if doc comments contain such markers.
+	TodoFailGenerate bool
+}
+
+// TodoAllowed reports whether the doc comments of the package with the given
+// import path may contain TODO, FIXME and XXX markers.
+func (c LintConfig) TodoAllowed(pkgPath string) bool {
+	for _, p := range c.TodoAllowPackages {
+		if p == pkgPath {
+			return true
+		}
+		if prefix := strings.TrimSuffix(p, "/..."); prefix != p &&
+			(pkgPath == prefix || strings.HasPrefix(pkgPath, prefix+"/")) {
+			return true
+		}
+	}
+	return false
 }
 
 // DocConfig is configuration for the docs generation output
@@ -115,6 +506,9 @@ type DocConfig struct {
 	Packages []string
 }
 
+// ErrNoConfig is returned by Load and LoadLocal when no .gunkconfig is found.
+var ErrNoConfig = errors.New("no .gunkconfig found")
+
 // Load will attempt to find the .gunkconfig in the 'dir', working
 // its way up to each parent looking for a .gunkconfig. Currently,
 // Load will only stop when it is unable to go any further up the
@@ -133,24 +527,11 @@ func Load(dir string) (*Config, error) {
 	}
 	cfgs := []*Config{}
 	for {
-		configPath := filepath.Join(dir, ".gunkconfig")
-		reader, err := os.Open(configPath)
-		if err == nil {
-			defer reader.Close()
-			cfg, err := LoadSingle(reader)
-			if err != nil {
-				return nil, fmt.Errorf("error loading %q: %v", configPath, err)
-			}
-			cfg.Dir = dir
-			// Patch in the directory of where to output the generated
-			// files. And patch in the 'out' path if it has been set globally,
-			// and not in the generate section.
-			for i, gen := range cfg.Generators {
-				cfg.Generators[i].ConfigDir = dir
-				if cfg.Out != "" && gen.Out == "" {
-					cfg.Generators[i].Out = cfg.Out
-				}
-			}
+		cfg, err := loadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		if cfg != nil {
 			cfgs = append(cfgs, cfg)
 		}
 		// Check to see if this directory contains a 'go.mod' file or '.git'
@@ -181,7 +562,7 @@ func Load(dir string) (*Config, error) {
 	}
 	// If no configs were found, return an error.
 	if len(cfgs) == 0 {
-		return nil, fmt.Errorf("no .gunkconfig found for %q", dir)
+		return nil, fmt.Errorf("%w for %q", ErrNoConfig, dir)
 	}
 	// Merge the found configs.
 	// TODO(hhhapz): merge DocConfig and Format config.
@@ -197,11 +578,110 @@ func Load(dir string) (*Config, error) {
 		if protocPath := c.ProtocPath; config.ProtocPath == "" {
 			config.ProtocPath = protocPath
 		}
+		if config.ProtocSHA256 == nil {
+			config.ProtocSHA256 = c.ProtocSHA256
+		}
+		if config.ProtocMirror == "" {
+			config.ProtocMirror = c.ProtocMirror
+		}
+		// Plugin versions pinned in child directories override those
+		// of their parents.
+		for cmd, v := range c.PluginVersions {
+			if _, ok := config.PluginVersions[cmd]; !ok {
+				if config.PluginVersions == nil {
+					config.PluginVersions = make(map[string]string)
+				}
+				config.PluginVersions[cmd] = v
+			}
+		}
+		config.Files = append(config.Files, c.Files...)
+		// Include paths from child directories are searched first.
+		config.IncludePaths = append(config.IncludePaths, c.IncludePaths...)
 		config.Generators = append(config.Generators, c.Generators...)
+		// File options from child directories override those of their
+		// parents.
+	_options:
+		for _, o := range c.FileOptions {
+			for _, set := range config.FileOptions {
+				if set.Name == o.Name {
+					continue _options
+				}
+			}
+			config.FileOptions = append(config.FileOptions, o)
+		}
 	}
+	config.pinPluginVersions()
 	return config, nil
 }
 
+// LoadLocal loads the .gunkconfig in 'dir' only, ignoring those in its
+// parents, such as for a single package generated via go:generate.
+//
+// Passing in an empty 'dir' will tell LoadLocal to look in the current
+// working directory.
+func LoadLocal(dir string) (*Config, error) {
+	var err error
+	if dir == "" {
+		dir, err = os.Getwd()
+		if err != nil {
+			return nil, fmt.Errorf("error getting working directory: %v", err)
+		}
+	}
+	cfg, err := loadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	if cfg == nil {
+		return nil, fmt.Errorf("%w in %q", ErrNoConfig, dir)
+	}
+	cfg.pinPluginVersions()
+	return cfg, nil
+}
+
+// loadDir loads the .gunkconfig or gunk.yaml in 'dir', if any, resolving its
+// paths relative to 'dir'. It returns nil if there is neither.
+func loadDir(dir string) (*Config, error) {
+	configPath := filepath.Join(dir, ".gunkconfig")
+	yamlPath := filepath.Join(dir, yamlFilename)
+	if _, err := os.Stat(yamlPath); err == nil {
+		if _, err := os.Stat(configPath); err == nil {
+			return nil, fmt.Errorf("both .gunkconfig and %s found in %q, only one may be used", yamlFilename, dir)
+		}
+		configPath = yamlPath
+	}
+	if _, err := os.Stat(configPath); err != nil {
+		return nil, nil
+	}
+	cfg := newConfig()
+	if err := cfg.loadPath(configPath, nil); err != nil {
+		return nil, err
+	}
+	cfg.Dir = dir
+	// Include paths are relative to the .gunkconfig they were
+	// declared in.
+	for i, p := range cfg.IncludePaths {
+		if !filepath.IsAbs(p) {
+			cfg.IncludePaths[i] = filepath.Join(dir, p)
+		}
+	}
+	if isLocalMirror(cfg.ProtocMirror) && !filepath.IsAbs(cfg.ProtocMirror) {
+		cfg.ProtocMirror = filepath.Join(dir, cfg.ProtocMirror)
+	}
+	// Patch in the directory of where to output the generated
+	// files. And patch in the 'out' path if it has been set globally,
+	// and not in the generate section.
+	for i, gen := range cfg.Generators {
+		cfg.Generators[i].ConfigDir = dir
+		if cfg.Out != "" && gen.Out == "" {
+			cfg.Generators[i].Out = cfg.Out
+		}
+	}
+	for i := range cfg.FileOptions {
+		cfg.FileOptions[i].ConfigDir = dir
+	}
+	return cfg, nil
+}
+
 // from https://github.com/protocolbuffers/protobuf/blob/master/src/google/protobuf/compiler/main.cc
 // hardcode what languages are built-in in protoc, rest must have their own generator binary
 var ProtocBuiltinLanguages = map[string]bool{
@@ -213,6 +693,28 @@ var ProtocBuiltinLanguages = map[string]bool{
 	"csharp": true,
 	"objc":   true,
 	"js":     true,
+	"kotlin": true,
+}
+
+// tsPlugins are the commands of the plugins which may be used by the ts
+// generator, by the name given to its plugin option.
+var tsPlugins = map[string]string{
+	"ts-protoc-gen": "protoc-gen-ts",
+	"ts-proto":      "protoc-gen-ts_proto",
+	"protobuf-es":   "protoc-gen-es",
+}
+
+// tsPluginParams are the default parameters of the plugins which may be used
+// by the ts generator. 64-bit integers are strings, as in the JSON encoding of
+// protobuf, to not lose precision.
+var tsPluginParams = map[string][]KeyValue{
+	"ts-proto": {
+		{"esModuleInterop", "true"},
+		{"forceLong", "string"},
+	},
+	"protobuf-es": {
+		{"target", "ts"},
+	},
 }
 
 func LoadSingle(reader io.Reader) (*Config, error) {
@@ -220,11 +722,157 @@ func LoadSingle(reader io.Reader) (*Config, error) {
 	if err != nil {
 		return nil, fmt.Errorf("unable to parse ini file: %v", err)
 	}
+	return loadFile(f)
+}
+
+// loadFile loads the configuration from the sections of an ini file, either
+// read from a .gunkconfig, or built from a gunk.yaml.
+func loadFile(f *ini.File) (*Config, error) {
+	config := newConfig()
+	if err := config.loadSections(f); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func newConfig() *Config {
 	config := &Config{
-		Generators: make([]Generator, 0, len(f.AllSections())),
 		DocsConfig: make(map[string]*DocConfig),
 	}
 	config.DocsConfig[DefaultTag] = &DocConfig{}
+	return config
+}
+
+// loadPath loads the configuration file at path on top of the configuration,
+// after the files listed in its include key. The generators of the file
+// replace those of the same type from its includes, and the paths of the
+// included files are relative to their own directories. stack holds the files
+// including it, to detect cycles.
+func (config *Config) loadPath(path string, stack []string) error {
+	for _, p := range stack {
+		if p == path {
+			return fmt.Errorf("include cycle: %s", strings.Join(append(stack, path), " -> "))
+		}
+	}
+	f, err := readFile(path)
+	if err != nil {
+		return fmt.Errorf("error loading %q: %v", path, err)
+	}
+	includes, err := includedFiles(f)
+	if err != nil {
+		return fmt.Errorf("error loading %q: %v", path, err)
+	}
+	dir := filepath.Dir(path)
+	for _, inc := range includes {
+		if !filepath.IsAbs(inc) {
+			inc = filepath.Join(dir, inc)
+		}
+		if _, err := os.Stat(inc); err != nil {
+			return fmt.Errorf("error loading %q: included file %s not found", path, inc)
+		}
+		nGen, nInc := len(config.Generators), len(config.IncludePaths)
+		mirror := config.ProtocMirror
+		if err := config.loadPath(inc, append(stack, path)); err != nil {
+			return err
+		}
+		incDir := filepath.Dir(inc)
+		if m := config.ProtocMirror; m != mirror && isLocalMirror(m) && !filepath.IsAbs(m) {
+			config.ProtocMirror = filepath.Join(incDir, m)
+		}
+		for i := nInc; i < len(config.IncludePaths); i++ {
+			if !filepath.IsAbs(config.IncludePaths[i]) {
+				config.IncludePaths[i] = filepath.Join(incDir, config.IncludePaths[i])
+			}
+		}
+		for i := nGen; i < len(config.Generators); i++ {
+			if wasm := config.Generators[i].Wasm; wasm != "" && !filepath.IsAbs(wasm) {
+				config.Generators[i].Wasm = filepath.Join(incDir, wasm)
+			}
+		}
+	}
+	nBase := len(config.Generators)
+	if err := config.loadSections(f); err != nil {
+		return fmt.Errorf("error loading %q: %v", path, err)
+	}
+	config.Files = append(config.Files, path)
+	for i := nBase; i < len(config.Generators); i++ {
+		config.Generators[i].ConfigFile = path
+	}
+	if nBase == 0 {
+		return nil
+	}
+	// Override the included generators by those of the file.
+	replaced := make(map[string]bool)
+	for _, gen := range config.Generators[nBase:] {
+		replaced[gen.Code()] = true
+	}
+	gens := config.Generators[:0]
+	for i, gen := range config.Generators {
+		if i >= nBase || !replaced[gen.Code()] {
+			gens = append(gens, gen)
+		}
+	}
+	config.Generators = gens
+	return nil
+}
+
+// isLocalMirror reports whether a protoc mirror is a directory, rather than a
+// URL.
+func isLocalMirror(mirror string) bool {
+	return mirror != "" && !strings.Contains(mirror, "://")
+}
+
+// readFile reads a .gunkconfig, or a gunk.yaml if its name ends in .yaml or
+// .yml.
+func readFile(path string) (*ini.File, error) {
+	reader, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	if ext := filepath.Ext(path); ext == ".yaml" || ext == ".yml" {
+		return yamlFile(reader)
+	}
+	f, err := ini.Load(reader)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse ini file: %v", err)
+	}
+	return f, nil
+}
+
+// includedFiles returns the paths of the files listed in the include key of the
+// global section of a configuration file.
+func includedFiles(f *ini.File) ([]string, error) {
+	v, err := expandEnv(strings.TrimSpace(f.GetSection("").GetRaw("include")))
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse include: %w", err)
+	}
+	var paths []string
+	for _, p := range strings.Split(v, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			paths = append(paths, p)
+		}
+	}
+	return paths, nil
+}
+
+// loadSections loads the sections of an ini file on top of the configuration,
+// such as on top of the files it includes.
+func (config *Config) loadSections(f *ini.File) error {
+	f, err := withPresets(f)
+	if err != nil {
+		return err
+	}
+	// Unknown keys of the generate sections looking like typos of gunk's
+	// keys are errors, unless strict is disabled in the file.
+	strict := true
+	if v := strings.TrimSpace(f.GetSection("").GetRaw("strict")); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("cannot parse strict: %w", err)
+		}
+		strict = b
+	}
 	for _, s := range f.AllSections() {
 		var err error
 		var gen *Generator
@@ -236,34 +884,40 @@ func LoadSingle(reader io.Reader) (*Config, error) {
 		case name == "protoc":
 			err = handleProtoc(config, s)
 		case name == "generate":
-			gen, err = handleGenerate(config, s, nil)
+			gen, err = handleGenerate(config, s, nil, strict)
 		case name == "format":
 			err = handleFormat(config, s)
+		case name == "lint":
+			err = handleLint(config, s)
+		case name == "file_options":
+			err = handleFileOptions(config, s)
+		case name == "plugins":
+			err = handlePlugins(config, s)
 		case strings.HasPrefix(name, "generate "):
 			// Check to see if we have the shorten version of a generate config:
 			// [generate js].
 			sParts := strings.Split(name, " ")
 			if len(sParts) != 2 {
-				return nil, fmt.Errorf("generate section name should have 2 values, not %d", len(sParts))
+				return fmt.Errorf("generate section name should have 2 values, not %d", len(sParts))
 			}
-			gen, err = handleGenerate(config, s, &sParts[1])
+			gen, err = handleGenerate(config, s, &sParts[1], strict)
 		case strings.HasPrefix(name, "doc "):
 			sParts := strings.Split(name, " ")
 			if len(sParts) != 2 {
-				return nil, fmt.Errorf("doc section name should have 2 values, not %d", len(sParts))
+				return fmt.Errorf("doc section name should have 2 values, not %d", len(sParts))
 			}
 			err = handleDoc(config, s, sParts[1])
 		default:
-			return nil, fmt.Errorf("unknown section %q", s.Name())
+			return fmt.Errorf("unknown section %q%s", s.Name(), sectionSuggestion(s.Name()))
 		}
 		if err != nil {
-			return nil, err
+			return err
 		}
 		if gen != nil {
 			config.Generators = append(config.Generators, *gen)
 		}
 	}
-	return config, nil
+	return nil
 }
 
 func handleProtoc(config *Config, section *parser.Section) error {
@@ -274,15 +928,40 @@ func handleProtoc(config *Config, section *parser.Section) error {
 			config.ProtocPath = v
 		case "version":
 			config.ProtocVersion = v
+		case "sha256":
+			config.ProtocSHA256 = []string{}
+			for _, sum := range strings.Split(v, ",") {
+				sum = strings.TrimSpace(sum)
+				if _, err := hex.DecodeString(sum); err != nil || len(sum) != 64 {
+					return fmt.Errorf("sha256 %q should be a hex-encoded SHA-256 checksum", sum)
+				}
+				config.ProtocSHA256 = append(config.ProtocSHA256, sum)
+			}
+		case "mirror":
+			mirror, err := expandEnv(v)
+			if err != nil {
+				return fmt.Errorf("cannot parse mirror: %w", err)
+			}
+			config.ProtocMirror = mirror
+		case "include_paths":
+			for _, p := range strings.Split(v, ",") {
+				p = strings.TrimSpace(p)
+				if p == "" {
+					return fmt.Errorf("empty path in include_paths")
+				}
+				config.IncludePaths = append(config.IncludePaths, p)
+			}
 		default:
-			return fmt.Errorf("unexpected key %q in protoc section", k)
+			return fmt.Errorf("unexpected key %q in protoc section%s", k, didYouMean(k, protocKeys))
 		}
 	}
 	return nil
 }
 
-func handleGenerate(config *Config, section *parser.Section, shorthand *string) (*Generator, error) {
-	keys := section.RawKeys()
+func handleGenerate(config *Config, section *parser.Section, shorthand *string, strict bool) (*Generator, error) {
+	// The keys are copied, as repeated param keys are removed from the
+	// section while reading them.
+	keys := append([]string(nil), section.RawKeys()...)
 	gen := &Generator{
 		Params: make([]KeyValue, 0, len(keys)),
 	}
@@ -295,7 +974,9 @@ func handleGenerate(config *Config, section *parser.Section, shorthand *string)
 		// normal generate section. If we start using the binary path here
 		// we should also use it for the normal generate section.
 		switch {
-		case generator == "doc":
+		case generator == "doc", generator == "fdset", generator == "bufimage", generator == "access",
+			generator == "openapi", generator == "graphql", generator == "mock", generator == "scaffold",
+			generator == "main", generator == "serviceconfig":
 			gen.Command = generator
 		case ProtocBuiltinLanguages[generator]:
 			gen.ProtocGen = generator
@@ -305,9 +986,45 @@ func handleGenerate(config *Config, section *parser.Section, shorthand *string)
 		gen.Shortened = true // for vetting
 	}
 
+	var tsPlugin string
+	fixPathsSet := false
 	for _, k := range keys {
-		v := strings.TrimSpace(section.GetRaw(k))
+		v, err := unquote(strings.TrimSpace(section.GetRaw(k)))
+		if err == nil {
+			v, err = expandEnv(v)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse %s: %w", k, err)
+		}
 		switch k {
+		case "param":
+			// Parameters written like on the command line of
+			// protoc, such as "a=b,c=d", are passed as they are.
+			// Repeated param keys are joined with commas.
+			section.RemoveKey(k)
+			if gen.Param != "" && v != "" {
+				gen.Param += ","
+			}
+			gen.Param += v
+		case "plugin":
+			if strings.Contains(v, "/") {
+				if shorthand != nil {
+					return nil, fmt.Errorf("remote plugins may not be used in generate shorthand")
+				}
+				p, err := ParseRemotePlugin(v)
+				if err != nil {
+					return nil, err
+				}
+				gen.Remote = p
+				continue
+			}
+			if shorthand == nil || strings.Trim(*shorthand, "\"") != "ts" {
+				return nil, fmt.Errorf("'plugin' can only be set in the generate ts shorthand")
+			}
+			if _, ok := tsPlugins[v]; !ok {
+				return nil, fmt.Errorf("unknown ts plugin %q, must be ts-protoc-gen, ts-proto or protobuf-es", v)
+			}
+			tsPlugin = v
 		case "command":
 			if shorthand != nil {
 				return nil, fmt.Errorf("'command' or 'protoc' may not be specified in generate shorthand")
@@ -324,36 +1041,160 @@ func handleGenerate(config *Config, section *parser.Section, shorthand *string)
 				return nil, fmt.Errorf("only one 'command' or 'protoc' allowed")
 			}
 			gen.ProtocGen = v
+		case "wasm":
+			if shorthand != nil {
+				return nil, fmt.Errorf("'wasm' may not be specified in generate shorthand")
+			}
+			if !strings.HasSuffix(v, ".wasm") {
+				return nil, fmt.Errorf("wasm plugin %q should be a .wasm file", v)
+			}
+			gen.Wasm = v
 		case "plugin_version":
 			gen.PluginVersion = v
+		case "plugin_timeout":
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("plugin_timeout %q should be a positive duration, such as 30s", v)
+			}
+			gen.PluginTimeout = d
+		case "plugin_max_output":
+			n, err := parseSize(v)
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse plugin_max_output: %w", err)
+			}
+			gen.PluginMaxOutput = n
+		case "plugin_env":
+			gen.PluginEnv = []string{}
+			for _, name := range strings.Split(v, ",") {
+				if name = strings.TrimSpace(name); name != "" {
+					gen.PluginEnv = append(gen.PluginEnv, name)
+				}
+			}
 		case "out":
 			gen.Out = v
+		case "packages":
+			gen.Packages = []string{}
+			for _, p := range strings.Split(v, ",") {
+				if p = strings.TrimSpace(p); p == "" {
+					continue
+				}
+				if _, err := path.Match(p, ""); err != nil {
+					return nil, fmt.Errorf("invalid packages pattern %q: %w", p, err)
+				}
+				gen.Packages = append(gen.Packages, p)
+			}
 		case "fix_paths_postproc":
 			p, err := strconv.ParseBool(v)
 			if err != nil {
 				return nil, fmt.Errorf("cannot parse fix_paths: %w", err)
 			}
 			gen.FixPaths = p
+			fixPathsSet = true
 		case "json_tag_postproc":
 			p, err := strconv.ParseBool(v)
 			if err != nil {
 				return nil, fmt.Errorf("cannot parse json_tag_postproc: %w", err)
 			}
 			gen.JSONPostProc = p
+		case "register_helpers":
+			p, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse register_helpers: %w", err)
+			}
+			gen.RegisterHelpers = p
+		case "in_process":
+			p, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse in_process: %w", err)
+			}
+			gen.InProcess = p
+		case "module_mappings":
+			for _, m := range strings.Split(v, ",") {
+				m = strings.TrimSpace(m)
+				i := strings.Index(m, "=")
+				if i <= 0 || i == len(m)-1 {
+					return nil, fmt.Errorf("module mapping %q should be of the form path=Module", m)
+				}
+				gen.ModuleMappings = append(gen.ModuleMappings, KeyValue{m[:i], m[i+1:]})
+			}
 		default:
+			if strict {
+				if err := strictKeyError(k); err != nil {
+					return nil, err
+				}
+			}
 			gen.Params = append(gen.Params, KeyValue{k, v})
 		}
 	}
 
+	if gen.Wasm != "" {
+		if gen.Command != "" || gen.ProtocGen != "" || gen.Remote != nil {
+			return nil, fmt.Errorf("'command', 'protoc' or 'plugin' may not be specified with 'wasm'")
+		}
+		if gen.PluginVersion != "" {
+			return nil, fmt.Errorf("plugin_version cannot be set for wasm plugin %q", gen.Wasm)
+		}
+		// Name the generator after the module, such as
+		// protoc-gen-foo for protoc-gen-foo.wasm.
+		gen.Command = strings.TrimSuffix(filepath.Base(gen.Wasm), ".wasm")
+	}
+	if gen.Remote != nil {
+		if gen.Command != "" || gen.ProtocGen != "" {
+			return nil, fmt.Errorf("'command' or 'protoc' may not be specified with a remote plugin")
+		}
+		if gen.PluginVersion != "" {
+			return nil, fmt.Errorf("plugin_version cannot be set for remote plugin %s; set its version in the reference instead", gen.Remote)
+		}
+		gen.Command = gen.Remote.String()
+	}
 	if gen.Command == "" && gen.ProtocGen == "" {
 		return nil, fmt.Errorf("either 'command' or 'protoc' must be specified")
 	}
+	if tsPlugin != "" {
+		gen.Command = tsPlugins[tsPlugin]
+		for _, p := range tsPluginParams[tsPlugin] {
+			if _, ok := gen.GetParam(p.Key); !ok {
+				gen.Params = append(gen.Params, p)
+			}
+		}
+		// Unlike ts-protoc-gen, the imports of ts-proto and protobuf-es
+		// can always be fixed, so it's done by default.
+		if tsPlugin != "ts-protoc-gen" && !fixPathsSet {
+			gen.FixPaths = true
+		}
+	}
 
 	// Validate language-specific options now that we are done as we should
 	// have figured out language by now.
 	lang := gen.Code()
-	if gen.FixPaths && lang != "js" && lang != "ts" {
-		return nil, fmt.Errorf("fix_paths_postproc can only be set for js and ts. Enabled on %q", lang)
+	if lang == "dart" && !fixPathsSet {
+		// As with ts-proto, the imports of protoc-gen-dart can always
+		// be fixed.
+		gen.FixPaths = true
+	}
+	if gen.FixPaths && lang != "js" && lang != "dart" && !gen.IsTS() && !gen.IsPython() {
+		return nil, fmt.Errorf("fix_paths_postproc can only be set for js, ts, python and dart. Enabled on %q", lang)
+	}
+	if gen.RegisterHelpers && lang != "grpc-gateway" {
+		return nil, fmt.Errorf("register_helpers can only be set for grpc-gateway. Enabled on %q", lang)
+	}
+	if gen.InProcess && lang != "go" && lang != "grpc-go" {
+		return nil, fmt.Errorf("in_process can only be set for go and grpc-go. Enabled on %q", lang)
+	}
+	if gen.InProcess && gen.PluginVersion != "" {
+		return nil, fmt.Errorf("in_process cannot be set with plugin_version, as the version is the one gunk is built with")
+	}
+	if gen.InProcess && (gen.PluginTimeout != 0 || gen.PluginMaxOutput != 0 || gen.PluginEnv != nil) {
+		return nil, fmt.Errorf("plugin_timeout, plugin_max_output and plugin_env can only be set for plugins run as commands")
+	}
+	if gen.Remote != nil && gen.PluginEnv != nil {
+		return nil, fmt.Errorf("plugin_env can only be set for plugins run as commands, not for remote plugin %s", gen.Remote)
+	}
+	if gen.Wasm != "" && gen.PluginEnv != nil {
+		return nil, fmt.Errorf("plugin_env can only be set for plugins run as commands, not for wasm plugin %q", gen.Wasm)
+	}
+	if len(gen.ModuleMappings) > 0 && !gen.IsSwift() && !gen.IsRust() {
+		return nil, fmt.Errorf("module_mappings can only be set for swift, grpc-swift, prost and tonic. Enabled on %q", lang)
 	}
 	if gen.JSONPostProc && lang != "go" {
 		return nil, fmt.Errorf("json_tag_postproc can only be set for go. Enabled on %q", lang)
@@ -362,6 +1203,84 @@ func handleGenerate(config *Config, section *parser.Section, shorthand *string)
 	return gen, nil
 }
 
+// unquote returns a value written in double quotes, such as
+// "example.com/foo;foo", without its quotes and with its escape sequences
+// interpreted as in Go. Quoting keeps characters such as ';' and '#', which
+// would otherwise start a comment. Other values are returned as they are.
+func unquote(v string) (string, error) {
+	if len(v) < 2 || v[0] != '"' || v[len(v)-1] != '"' {
+		return v, nil
+	}
+	s, err := strconv.Unquote(v)
+	if err != nil {
+		return "", fmt.Errorf("invalid quoted value %s", v)
+	}
+	return s, nil
+}
+
+// expandEnv expands the references to environment variables in a value, written
+// like ${NAME}, or like ${NAME:-default} to use a default value if the variable
+// is unset or empty. "$$" is a literal "$".
+func expandEnv(v string) (string, error) {
+	if !strings.Contains(v, "$") {
+		return v, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(v); i++ {
+		switch {
+		case v[i] != '$' || i+1 == len(v):
+			b.WriteByte(v[i])
+		case v[i+1] == '$':
+			b.WriteByte('$')
+			i++
+		case v[i+1] == '{':
+			end := strings.IndexByte(v[i:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated ${ in %q", v)
+			}
+			name, def, hasDef := v[i+2:i+end], "", false
+			if j := strings.Index(name, ":-"); j >= 0 {
+				name, def, hasDef = name[:j], name[j+2:], true
+			}
+			if name == "" {
+				return "", fmt.Errorf("empty variable name in %q", v)
+			}
+			value, ok := os.LookupEnv(name)
+			switch {
+			case hasDef && value == "":
+				value = def
+			case !ok:
+				return "", fmt.Errorf("environment variable %s is not set; use $${%s} for a literal ${%s}", name, name, name)
+			}
+			b.WriteString(value)
+			i += end
+		default:
+			b.WriteByte(v[i])
+		}
+	}
+	return b.String(), nil
+}
+
+// parseSize parses a positive size in bytes, optionally followed by a KiB, MiB
+// or GiB unit, such as "64MiB".
+func parseSize(v string) (int64, error) {
+	s, mult := v, int64(1)
+	for _, u := range []struct {
+		suffix string
+		mult   int64
+	}{{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30}} {
+		if strings.HasSuffix(s, u.suffix) {
+			s, mult = strings.TrimSpace(strings.TrimSuffix(s, u.suffix)), u.mult
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("size %q should be a positive number of bytes, KiB, MiB or GiB", v)
+	}
+	return n * mult, nil
+}
+
 func handleDoc(config *Config, section *parser.Section, tag string) error {
 	docConfig := &DocConfig{}
 	for _, k := range section.RawKeys() {
@@ -386,7 +1305,7 @@ func handleDoc(config *Config, section *parser.Section, tag string) error {
 			}
 			docConfig.Weight = int(w)
 		default:
-			return fmt.Errorf("unknown key %q in doc section", k)
+			return fmt.Errorf("unknown key %q in doc section%s", k, didYouMean(k, docKeys))
 		}
 	}
 	// add to docs config
@@ -399,11 +1318,121 @@ func handleGlobal(config *Config, section *parser.Section) error {
 		v := strings.TrimSpace(section.GetRaw(k))
 		switch k {
 		case "out":
-			config.Out = v
+			out, err := expandEnv(v)
+			if err != nil {
+				return fmt.Errorf("cannot parse out: %w", err)
+			}
+			config.Out = out
+		case "include", "strict", "preset":
+			// The included files are loaded before the sections,
+			// by loadPath, and strict and the presets are read by
+			// loadSections.
 		case "import_path":
 			config.ImportPath = v
+		case "wrapper_types":
+			wrapperTypes, err := strconv.ParseBool(v)
+			if err != nil {
+				return err
+			}
+			config.WrapperTypes = wrapperTypes
+		case "split_proto_files":
+			splitProtoFiles, err := strconv.ParseBool(v)
+			if err != nil {
+				return err
+			}
+			config.SplitProtoFiles = splitProtoFiles
 		default:
-			return fmt.Errorf("unexpected key %q in global section", k)
+			return fmt.Errorf("unexpected key %q in global section%s", k, didYouMean(k, globalKeys))
+		}
+	}
+	return nil
+}
+
+func handlePlugins(config *Config, section *parser.Section) error {
+	if config.PluginVersions == nil {
+		config.PluginVersions = make(map[string]string)
+	}
+	for _, k := range section.RawKeys() {
+		v := strings.TrimSpace(section.GetRaw(k))
+		if !strings.HasPrefix(k, "protoc-gen-") {
+			return fmt.Errorf("unexpected key %q in plugins section, should be a protoc-gen-* command", k)
+		}
+		if v == "" {
+			return fmt.Errorf("no version pinned for %s in plugins section", k)
+		}
+		config.PluginVersions[k] = v
+	}
+	return nil
+}
+
+// pinPluginVersions sets the versions pinned in the [plugins] section on the
+// generators running the plugins, unless they set their own plugin_version or
+// don't run a local plugin binary.
+func (c *Config) pinPluginVersions() {
+	for i, gen := range c.Generators {
+		if gen.PluginVersion != "" || gen.ProtocGen != "" || gen.InProcess || gen.Remote != nil || gen.Wasm != "" {
+			continue
+		}
+		if v, ok := c.PluginVersions[gen.Command]; ok {
+			c.Generators[i].PluginVersion = v
+		}
+	}
+}
+
+func handleFileOptions(config *Config, section *parser.Section) error {
+	for _, k := range section.RawKeys() {
+		v := strings.TrimSpace(section.GetRaw(k))
+		if !fileOptionNames[k] {
+			return fmt.Errorf("unexpected key %q in file_options section%s", k, didYouMean(k, fileOptionKeys()))
+		}
+		// Values holding ";" or "#", like go_package, must be quoted,
+		// as they would otherwise start a comment.
+		if strings.HasPrefix(v, `"`) {
+			unquoted, err := strconv.Unquote(v)
+			if err != nil {
+				return fmt.Errorf("invalid quoted %s template: %w", k, err)
+			}
+			v = unquoted
+		}
+		tmpl, err := template.New(k).Funcs(fileOptionFuncs).Option("missingkey=error").Parse(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s template: %w", k, err)
+		}
+		// Options of included files are overridden.
+		option := FileOption{Name: k, tmpl: tmpl}
+		replaced := false
+		for i, o := range config.FileOptions {
+			if o.Name == k {
+				config.FileOptions[i], replaced = option, true
+			}
+		}
+		if !replaced {
+			config.FileOptions = append(config.FileOptions, option)
+		}
+	}
+	return nil
+}
+
+func handleLint(config *Config, section *parser.Section) error {
+	for _, k := range section.RawKeys() {
+		v := strings.TrimSpace(section.GetRaw(k))
+		switch k {
+		case "todo_allow_packages":
+			for _, p := range strings.Split(v, ",") {
+				p = strings.TrimSpace(p)
+				if p == "" {
+					return fmt.Errorf("empty package in todo_allow_packages")
+				}
+				config.Lint.TodoAllowPackages = append(config.Lint.TodoAllowPackages, p)
+			}
+		case "todo_fail_generate":
+			fail, err := strconv.ParseBool(v)
+			if err != nil {
+				return err
+			}
+			config.Lint.TodoFailGenerate = fail
+		default:
+			return fmt.Errorf("unexpected key %q in lint section%s", k, didYouMean(k, lintKeys))
 		}
 	}
 	return nil
@@ -430,8 +1459,23 @@ func handleFormat(config *Config, section *parser.Section) error {
 				return err
 			}
 			config.Format.PB = reorder
+		case "align_tags":
+			align, err := strconv.ParseBool(v)
+			if err != nil {
+				return err
+			}
+			config.Format.AlignTags = align
+		case "comment_width":
+			width, err := strconv.Atoi(v)
+			if err != nil {
+				return fmt.Errorf("cannot parse comment_width: %w", err)
+			}
+			if width < 0 {
+				return fmt.Errorf("comment_width must not be negative")
+			}
+			config.Format.CommentWidth = width
 		default:
-			return fmt.Errorf("unexpected key %q in format section", k)
+			return fmt.Errorf("unexpected key %q in format section%s", k, didYouMean(k, formatKeys))
 		}
 	}
 	return nil
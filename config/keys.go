@@ -0,0 +1,118 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// The keys of each section, to suggest the intended key when a key is
+// unknown.
+var (
+	sectionNames = []string{"protoc", "generate", "format", "lint", "file_options", "plugins", "doc"}
+	globalKeys   = []string{"out", "include", "import_path", "wrapper_types", "split_proto_files", "strict", "preset"}
+	protocKeys   = []string{"path", "version", "include_paths", "sha256", "mirror"}
+	generateKeys = []string{
+		"param", "plugin", "command", "protoc", "wasm", "plugin_version",
+		"plugin_timeout", "plugin_max_output", "plugin_env", "out", "packages",
+		"fix_paths_postproc", "json_tag_postproc", "register_helpers",
+		"in_process", "module_mappings",
+	}
+	docKeys    = []string{"name", "preamble", "packages", "weight"}
+	lintKeys   = []string{"todo_allow_packages", "todo_fail_generate"}
+	formatKeys = []string{"snake_case_json", "initialisms", "reorder_pb", "align_tags", "comment_width"}
+)
+
+// didYouMean returns a suggestion of the known key closest to an unknown key,
+// such as `; did you mean "plugin_version"?`, or "" if none is close.
+func didYouMean(key string, known []string) string {
+	if k := closestKey(key, known); k != "" {
+		return fmt.Sprintf("; did you mean %q?", k)
+	}
+	return ""
+}
+
+// closestKey returns the known key closest to an unknown key, if it differs by
+// at most two characters, or "" otherwise.
+func closestKey(key string, known []string) string {
+	best, bestDist := "", 3
+	for _, k := range known {
+		if d := editDistance(key, k); d < bestDist && d < len(k) {
+			best, bestDist = k, d
+		}
+	}
+	return best
+}
+
+// strictKeyError returns the error of an unknown key of a generate section
+// which looks like a typo of one of gunk's keys, or nil if it doesn't, and is
+// passed to the plugin. Only the keys with underscores, such as
+// plugin_version, are checked, as the others, such as plugin or packages, are
+// too close to common plugin parameters, such as plugins or package.
+func strictKeyError(key string) error {
+	var checked []string
+	for _, k := range generateKeys {
+		if strings.Contains(k, "_") {
+			checked = append(checked, k)
+		}
+	}
+	k := closestKey(key, checked)
+	if k == "" {
+		return nil
+	}
+	return fmt.Errorf("unexpected key %q in generate section; did you mean %q? Use param to pass it to the plugin, or set strict=false", key, k)
+}
+
+// fileOptionKeys returns the names of the file options, in order.
+func fileOptionKeys() []string {
+	keys := make([]string, 0, len(fileOptionNames))
+	for k := range fileOptionNames {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// sectionSuggestion returns a suggestion of the section intended by an unknown
+// section name, such as `; did you mean "generate go"?` for "generat go".
+func sectionSuggestion(name string) string {
+	word, rest := name, ""
+	if i := strings.Index(name, " "); i >= 0 {
+		word, rest = name[:i], name[i:]
+	}
+	if k := closestKey(word, sectionNames); k != "" {
+		return fmt.Sprintf("; did you mean %q?", k+rest)
+	}
+	return ""
+}
+
+// editDistance returns the Levenshtein distance between two strings.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/kenshaw/ini"
+	"github.com/kenshaw/ini/parser"
+)
+
+// presetSection is a section of a preset, with its keys.
+type presetSection struct {
+	name string
+	keys []KeyValue
+}
+
+var (
+	goPreset = []presetSection{
+		{"generate go", []KeyValue{{"plugin_version", "v1.28.1"}}},
+	}
+	goGRPCPreset = append(goPreset, presetSection{
+		"generate grpc-go", []KeyValue{{"plugin_version", "v1.2.0"}},
+	})
+)
+
+// presets are the sets of generators which may be used with the preset key, by
+// name. Several presets are combined with "+", such as "gateway+openapi".
+var presets = map[string][]presetSection{
+	"go":      goPreset,
+	"go-grpc": goGRPCPreset,
+	"gateway": append(goGRPCPreset, presetSection{
+		"generate grpc-gateway", []KeyValue{{"plugin_version", "v2.15.2"}, {"register_helpers", "true"}},
+	}),
+	"connect": append(goPreset, presetSection{
+		"generate connect-go", []KeyValue{{"plugin_version", "v1.11.1"}},
+	}),
+	"openapi": {
+		{"generate openapi", []KeyValue{{"out", "openapi"}}},
+	},
+	"docs": {
+		{"generate doc", []KeyValue{{"out", "docs"}}},
+	},
+}
+
+// presetNames returns the names of the presets, in order.
+func presetNames() []string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// withPresets returns the ini file with the sections of the presets named by
+// its preset key, if any, followed by its own sections. The keys of its
+// sections named like those of the presets, such as [generate go], override
+// the keys of the presets' sections.
+func withPresets(f *ini.File) (*ini.File, error) {
+	global := f.GetSection("")
+	value := strings.TrimSpace(global.GetRaw("preset"))
+	if value == "" {
+		return f, nil
+	}
+	expanded := ini.NewFile()
+	copyKeys(expanded.GetSection(""), global)
+	fromPreset := make(map[string]*parser.Section)
+	for _, name := range strings.Split(value, "+") {
+		name = strings.TrimSpace(name)
+		sections, ok := presets[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown preset %q%s; presets are %s", name,
+				didYouMean(name, presetNames()), strings.Join(presetNames(), ", "))
+		}
+		for _, ps := range sections {
+			s := fromPreset[ps.name]
+			if s == nil {
+				// Presets may share sections, such as
+				// [generate go].
+				s = expanded.AddSectionRaw(ps.name)
+				fromPreset[ps.name] = s
+			}
+			for _, kv := range ps.keys {
+				s.SetKeyValueRaw(kv.Key, kv.Value)
+			}
+		}
+	}
+	for _, s := range f.AllSections() {
+		if s.Name() == "" {
+			continue
+		}
+		dst := fromPreset[s.Name()]
+		if dst == nil {
+			dst = expanded.AddSectionRaw(s.Name())
+		}
+		// Only the first section of a name overrides the preset's,
+		// and the others are separate generators.
+		delete(fromPreset, s.Name())
+		copyKeys(dst, s)
+	}
+	return expanded, nil
+}
+
+// copyKeys sets the keys of a section on another.
+func copyKeys(dst, src *parser.Section) {
+	for _, k := range src.RawKeys() {
+		dst.SetKeyValueRaw(k, src.GetRaw(k))
+	}
+}
@@ -0,0 +1,191 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/kenshaw/ini"
+	"github.com/kenshaw/ini/parser"
+	"gopkg.in/yaml.v2"
+)
+
+// yamlFilename is the name of the YAML configuration files, which may be used
+// instead of .gunkconfig files.
+const yamlFilename = "gunk.yaml"
+
+// yamlSections are the top-level keys of a gunk.yaml holding the keys of the
+// sections of the same name of a .gunkconfig.
+var yamlSections = map[string]bool{
+	"protoc":       true,
+	"plugins":      true,
+	"file_options": true,
+	"format":       true,
+	"lint":         true,
+}
+
+// LoadYAML loads a configuration written in YAML, such as:
+//
+//	out: v1
+//	protoc:
+//	  version: v3.9.1
+//	generate:
+//	  - type: go
+//	    plugin_version: v1.27.1
+//	    options:
+//	      paths: source_relative
+//	  - command: protoc-gen-internal
+//	    out: internal
+//
+// Its keys are those of the sections of a .gunkconfig, with the generators
+// listed under generate, and the doc sections under doc by tag. The type of
+// a generator is that of the short form of its section, such as go for
+// [generate go]. Its options are the parameters passed to its plugin. Lists
+// are written like comma-separated values.
+func LoadYAML(reader io.Reader) (*Config, error) {
+	f, err := yamlFile(reader)
+	if err != nil {
+		return nil, err
+	}
+	return loadFile(f)
+}
+
+// yamlFile reads a gunk.yaml as the ini file of the equivalent .gunkconfig.
+func yamlFile(reader io.Reader) (*ini.File, error) {
+	buf, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	var doc yaml.MapSlice
+	if err := yaml.Unmarshal(buf, &doc); err != nil {
+		return nil, fmt.Errorf("unable to parse yaml file: %v", err)
+	}
+	f := ini.NewFile()
+	global := f.GetSection("")
+	for _, item := range doc {
+		key := fmt.Sprint(item.Key)
+		switch {
+		case yamlSections[key]:
+			if err := setYAMLKeys(f.AddSectionRaw(key), key, item.Value); err != nil {
+				return nil, err
+			}
+		case key == "generate":
+			gens, ok := item.Value.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("generate should be a list of generators")
+			}
+			for i, gen := range gens {
+				if err := addYAMLGenerator(f, gen); err != nil {
+					return nil, fmt.Errorf("generator %d: %w", i+1, err)
+				}
+			}
+		case key == "doc":
+			docs, ok := item.Value.(yaml.MapSlice)
+			if !ok {
+				return nil, fmt.Errorf("doc should map tags to doc sections")
+			}
+			for _, d := range docs {
+				name := "doc " + fmt.Sprint(d.Key)
+				if err := setYAMLKeys(f.AddSectionRaw(name), name, d.Value); err != nil {
+					return nil, err
+				}
+			}
+		default:
+			value, err := yamlValue(key, item.Value)
+			if err != nil {
+				return nil, err
+			}
+			global.SetKeyValueRaw(key, value)
+		}
+	}
+	return f, nil
+}
+
+// addYAMLGenerator adds the generate section of a generator of a gunk.yaml.
+func addYAMLGenerator(f *ini.File, gen interface{}) error {
+	keys, ok := gen.(yaml.MapSlice)
+	if !ok {
+		return fmt.Errorf("should be a map of keys")
+	}
+	name := "generate"
+	var rest yaml.MapSlice
+	for _, item := range keys {
+		if item.Key == "type" {
+			name += " " + fmt.Sprint(item.Value)
+			continue
+		}
+		rest = append(rest, item)
+	}
+	s := f.AddSectionRaw(name)
+	for _, item := range rest {
+		key := fmt.Sprint(item.Key)
+		if key != "options" {
+			value, err := yamlValue(key, item.Value)
+			if err != nil {
+				return err
+			}
+			s.SetKeyValueRaw(key, value)
+			continue
+		}
+		// The options are passed like the param key of a
+		// .gunkconfig, so that they can't clash with gunk's keys.
+		options, ok := item.Value.(yaml.MapSlice)
+		if !ok {
+			return fmt.Errorf("options should map the parameters of the plugin to their values")
+		}
+		var params []string
+		for _, o := range options {
+			if o.Value == nil {
+				params = append(params, fmt.Sprint(o.Key))
+				continue
+			}
+			value, err := yamlValue(fmt.Sprint(o.Key), o.Value)
+			if err != nil {
+				return err
+			}
+			params = append(params, fmt.Sprintf("%v=%s", o.Key, value))
+		}
+		s.SetKeyValueRaw("param", strings.Join(params, ","))
+	}
+	return nil
+}
+
+// setYAMLKeys sets the keys of a section from a map of a gunk.yaml.
+func setYAMLKeys(s *parser.Section, name string, v interface{}) error {
+	keys, ok := v.(yaml.MapSlice)
+	if !ok && v != nil {
+		return fmt.Errorf("%s should be a map of keys", name)
+	}
+	for _, item := range keys {
+		key := fmt.Sprint(item.Key)
+		value, err := yamlValue(key, item.Value)
+		if err != nil {
+			return err
+		}
+		s.SetKeyValueRaw(key, value)
+	}
+	return nil
+}
+
+// yamlValue returns the value of a key of a gunk.yaml as written in a
+// .gunkconfig, with lists written as comma-separated values.
+func yamlValue(key string, v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case []interface{}:
+		values := make([]string, len(v))
+		for i, e := range v {
+			s, err := yamlValue(key, e)
+			if err != nil {
+				return "", err
+			}
+			values[i] = s
+		}
+		return strings.Join(values, ","), nil
+	case yaml.MapSlice:
+		return "", fmt.Errorf("%s should not be a map", key)
+	}
+	return fmt.Sprint(v), nil
+}
@@ -0,0 +1,137 @@
+package conformance
+
+// Case is a conformance case, checking how a Gunk type round-trips through
+// the canonical protobuf JSON encoding.
+type Case struct {
+	// Name describes the Gunk type under test, such as "time.Time".
+	Name string
+	// Imports are the packages the declarations use.
+	Imports []string
+	// Decls are the Gunk declarations of the case, which include the
+	// message named Message.
+	Decls   string
+	Message string
+	// JSON is decoded into the message, which must then encode to Want, or
+	// to JSON itself if Want is empty.
+	JSON string
+	Want string
+}
+
+// Cases are the documented mappings of Gunk types, as they are encoded in
+// JSON.
+var Cases = []Case{
+	{
+		Name:    "time.Time",
+		Imports: []string{"time"},
+		Decls: `type Timestamp struct {
+	At time.Time ` + "`pb:\"1\" json:\"at\"`" + `
+}`,
+		Message: "Timestamp",
+		JSON:    `{"at":"2021-02-03T04:05:06.007Z"}`,
+	},
+	{
+		Name:    "time.Duration",
+		Imports: []string{"time"},
+		Decls: `type Duration struct {
+	Timeout time.Duration ` + "`pb:\"1\" json:\"timeout\"`" + `
+}`,
+		Message: "Duration",
+		JSON:    `{"timeout":"1.5s"}`,
+		Want:    `{"timeout":"1.500s"}`,
+	},
+	{
+		Name:    "[]time.Time",
+		Imports: []string{"time"},
+		Decls: `type Timestamps struct {
+	Times []time.Time ` + "`pb:\"1\" json:\"times\"`" + `
+}`,
+		Message: "Timestamps",
+		JSON:    `{"times":["1970-01-01T00:00:00Z","2021-02-03T04:05:06Z"]}`,
+	},
+	{
+		Name:    "map[string]time.Duration",
+		Imports: []string{"time"},
+		Decls: `type Durations struct {
+	Timeouts map[string]time.Duration ` + "`pb:\"1\" json:\"timeouts\"`" + `
+}`,
+		Message: "Durations",
+		JSON:    `{"timeouts":{"read":"2s","write":"0.000000001s"}}`,
+	},
+	{
+		Name: "map[string]int",
+		Decls: `type StringMap struct {
+	Counts map[string]int ` + "`pb:\"1\" json:\"counts\"`" + `
+}`,
+		Message: "StringMap",
+		JSON:    `{"counts":{"a":1,"b":-2}}`,
+	},
+	{
+		Name: "map[int64]bool",
+		Decls: `type IntMap struct {
+	Flags map[int64]bool ` + "`pb:\"1\" json:\"flags\"`" + `
+}`,
+		Message: "IntMap",
+		JSON:    `{"flags":{"-1":false,"9007199254740993":true}}`,
+	},
+	{
+		Name: "enum",
+		Decls: `type Status int
+
+const (
+	StatusUnknown Status = iota
+	StatusActive
+)
+
+type Enum struct {
+	Status Status ` + "`pb:\"1\" json:\"status\"`" + `
+}`,
+		Message: "Enum",
+		JSON:    `{"status":1}`,
+		Want:    `{"status":"StatusActive"}`,
+	},
+	{
+		Name: "*string",
+		Decls: `type Optional struct {
+	Nickname *string ` + "`pb:\"1\" json:\"nickname\"`" + `
+	Age      *int64  ` + "`pb:\"2\" json:\"age\"`" + `
+}`,
+		Message: "Optional",
+		// Unlike a plain string, an empty wrapper is encoded.
+		JSON: `{"nickname":"","age":"42"}`,
+	},
+	{
+		Name:    "*string (null)",
+		Message: "Optional",
+		JSON:    `{"nickname":null}`,
+		Want:    `{}`,
+	},
+	{
+		Name: "int64",
+		Decls: `type Int64 struct {
+	Big   int64  ` + "`pb:\"1\" json:\"big\"`" + `
+	Small uint32 ` + "`pb:\"2\" json:\"small\"`" + `
+}`,
+		Message: "Int64",
+		JSON:    `{"big":9007199254740993,"small":"7"}`,
+		Want:    `{"big":"9007199254740993","small":7}`,
+	},
+	{
+		Name: "[]byte",
+		Decls: `type Bytes struct {
+	Data []byte ` + "`pb:\"1\" json:\"data\"`" + `
+}`,
+		Message: "Bytes",
+		JSON:    `{"data":"aGVsbG8="}`,
+	},
+	{
+		Name: "json tag",
+		Decls: `type JSONName struct {
+	CreatedBy string ` + "`pb:\"1\" json:\"created_by\"`" + `
+}`,
+		Message: "JSONName",
+		// The field name is accepted when decoding, but the json tag
+		// is used when encoding.
+		JSON: `{"CreatedBy":"gopher"}`,
+		Want: `{"created_by":"gopher"}`,
+	},
+}
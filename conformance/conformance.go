@@ -0,0 +1,183 @@
+// Package conformance checks that the mappings of Gunk types round-trip
+// through the canonical protobuf JSON encoding as documented.
+package conformance
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gunk/gunk/generate"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Run runs the conformance cases whose names match the regular expression
+// run, or all of them if it's empty, writing the results to w.
+func Run(w io.Writer, run string) error {
+	re, err := regexp.Compile(run)
+	if err != nil {
+		return err
+	}
+	var cases []Case
+	for _, c := range Cases {
+		if re.MatchString(c.Name) {
+			cases = append(cases, c)
+		}
+	}
+	if len(cases) == 0 {
+		return fmt.Errorf("no conformance cases match %q", run)
+	}
+	return runCases(w, cases)
+}
+
+func runCases(w io.Writer, cases []Case) error {
+	dir, err := ioutil.TempDir("", "gunk-conformance")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"go.mod":           "module gunk.test/conformance\n",
+		".gunkconfig":      "wrapper_types=true\n",
+		"conformance.gunk": gunkFile(cases),
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			return err
+		}
+	}
+	fds, err := generate.FileDescriptorSet(dir, ".")
+	if err != nil {
+		return err
+	}
+	reg, err := protodesc.NewFiles(fds)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, c := range cases {
+		if err := check(reg, c); err != nil {
+			fmt.Fprintf(w, "FAIL %s: %v\n", c.Name, err)
+			failed++
+			continue
+		}
+		fmt.Fprintf(w, "ok   %s\n", c.Name)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d conformance cases failed", failed, len(cases))
+	}
+	return nil
+}
+
+// gunkFile returns the Gunk package declaring the messages of the cases.
+func gunkFile(cases []Case) string {
+	imports := make(map[string]bool)
+	declared := make(map[string]bool)
+	var decls []string
+	for _, c := range cases {
+		if c.Decls == "" {
+			// The message is declared by another case.
+			c = declaringCase(c.Message)
+		}
+		if declared[c.Message] {
+			continue
+		}
+		declared[c.Message] = true
+		for _, imp := range c.Imports {
+			imports[imp] = true
+		}
+		decls = append(decls, c.Decls)
+	}
+	var sb strings.Builder
+	sb.WriteString("package conformance\n\n")
+	if len(imports) > 0 {
+		var paths []string
+		for imp := range imports {
+			paths = append(paths, fmt.Sprintf("\t%q\n", imp))
+		}
+		sort.Strings(paths)
+		fmt.Fprintf(&sb, "import (\n%s)\n\n", strings.Join(paths, ""))
+	}
+	sb.WriteString(strings.Join(decls, "\n\n"))
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+// declaringCase returns the case in Cases declaring the message.
+func declaringCase(message string) Case {
+	for _, c := range Cases {
+		if c.Message == message && c.Decls != "" {
+			return c
+		}
+	}
+	return Case{Message: message}
+}
+
+// check decodes the JSON of the case into its message, and checks that it
+// encodes back to the wanted JSON, both directly and after a round-trip
+// through the binary encoding.
+func check(reg *protoregistry.Files, c Case) error {
+	desc, err := reg.FindDescriptorByName(protoreflect.FullName("conformance." + c.Message))
+	if err != nil {
+		return err
+	}
+	md, ok := desc.(protoreflect.MessageDescriptor)
+	if !ok {
+		return fmt.Errorf("%s is not a message", c.Message)
+	}
+	msg := dynamicpb.NewMessage(md)
+	if err := protojson.Unmarshal([]byte(c.JSON), msg); err != nil {
+		return fmt.Errorf("unable to decode %s: %v", c.JSON, err)
+	}
+	want := c.Want
+	if want == "" {
+		want = c.JSON
+	}
+	if err := equalJSON(msg, want); err != nil {
+		return err
+	}
+	b, err := proto.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	decoded := dynamicpb.NewMessage(md)
+	if err := proto.Unmarshal(b, decoded); err != nil {
+		return err
+	}
+	if !proto.Equal(msg, decoded) {
+		return fmt.Errorf("binary round-trip changed the message")
+	}
+	return equalJSON(decoded, want)
+}
+
+// equalJSON checks that msg encodes to the wanted JSON, ignoring the
+// whitespace which protojson randomizes.
+func equalJSON(msg proto.Message, want string) error {
+	got, err := protojson.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	var gotBuf, wantBuf bytes.Buffer
+	if err := json.Compact(&gotBuf, got); err != nil {
+		return err
+	}
+	if err := json.Compact(&wantBuf, []byte(want)); err != nil {
+		return err
+	}
+	if gotBuf.String() != wantBuf.String() {
+		return fmt.Errorf("got %s, want %s", gotBuf.String(), wantBuf.String())
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package conformance
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCases(t *testing.T) {
+	// The cases importing standard library packages are left to
+	// "gunk conformance", as they require loading them with go/packages.
+	var cases []Case
+	for _, c := range Cases {
+		if len(c.Imports) == 0 {
+			cases = append(cases, c)
+		}
+	}
+	var out strings.Builder
+	if err := runCases(&out, cases); err != nil {
+		t.Fatalf("%v\n%s", err, out.String())
+	}
+	bad := Case{
+		Name:    "bad",
+		Decls:   "type Bad struct {\n\tN int64 `pb:\"1\" json:\"n\"`\n}",
+		Message: "Bad",
+		JSON:    `{"n":1}`,
+	}
+	out.Reset()
+	if err := runCases(&out, []Case{bad}); err == nil {
+		t.Fatalf("want an error for int64 encoded as a number")
+	}
+	if want := `FAIL bad: got {"n":"1"}, want {"n":1}`; !strings.Contains(out.String(), want) {
+		t.Errorf("got %q, want it to contain %q", out.String(), want)
+	}
+}
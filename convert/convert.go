@@ -3,8 +3,10 @@ package convert
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 
@@ -15,40 +17,48 @@ import (
 )
 
 // Run converts proto files or folders to gunk files, saving the files in
-// the same folder as the proto file.
-func Run(paths []string, overwrite bool) error {
+// the same folder as the proto file. Compiled descriptor sets, such as
+// image.binpb, are converted to Gunk packages in out instead.
+func Run(paths []string, out string, overwrite bool) error {
+	rules, err := loadHTTPRules(HTTPConfig)
+	if err != nil {
+		return err
+	}
 	for _, path := range paths {
-		if err := run(path, overwrite); err != nil {
+		if descriptorSetExts[filepath.Ext(path)] {
+			if err := runImage(path, out, overwrite, rules); err != nil {
+				return err
+			}
+			continue
+		}
+		if out != "" {
+			return fmt.Errorf("--out requires -r or a descriptor set, not %s", path)
+		}
+		if err := run(path, overwrite, rules); err != nil {
 			return err
 		}
 	}
+	warnUnusedHTTPRules(rules)
 	return nil
 }
 
 // run converts the proto file or all proto files in a folder to gunk files,
 // saving the file in the same directory as the proto file.
-func run(path string, overwrite bool) error {
+func run(path string, overwrite bool, rules *loader.HTTPRules) error {
 	fi, err := os.Stat(path)
 	if err != nil {
 		return err
 	}
-	// Look for a .gunkconfig
 	absPath, _ := filepath.Abs(path)
-	cfg, err := config.Load(filepath.Dir(absPath))
-	var cfgProtocPath, cfgProtocVer, importPath string
-	if err == nil {
-		importPath = filepath.Join(cfg.Dir, cfg.ImportPath)
-		cfgProtocPath = cfg.ProtocPath
-		cfgProtocVer = cfg.ProtocVersion
-	}
-	protocPath, err := downloader.CheckOrDownloadProtoc(cfgProtocPath, cfgProtocVer)
+	protoLoader, err := newProtoLoader(filepath.Dir(absPath), "")
 	if err != nil {
 		return err
 	}
+	protoLoader = withHTTPRules(protoLoader, rules)
 	// Determine whether the path is a file or a directory.
 	// If it is a file convert the file.
 	if !fi.IsDir() {
-		return convertFile(path, overwrite, importPath, protocPath)
+		return convertFile(path, overwrite, protoLoader)
 	}
 	// If the path is a directory and has a .proto extension then error.
 	if filepath.Ext(path) == ".proto" {
@@ -66,16 +76,51 @@ func run(path string, overwrite bool) error {
 		if f.IsDir() || filepath.Ext(f.Name()) != ".proto" {
 			continue
 		}
-		if err := convertFile(filepath.Join(path, f.Name()), overwrite, importPath, protocPath); err != nil {
+		if err := convertFile(filepath.Join(path, f.Name()), overwrite, protoLoader); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// newProtoLoader returns the loader of the proto files imported by the files
+// converted in dir, as configured by the .gunkconfig found from dir. If there
+// is none, the files are imported from importPath, or the loader is nil if it
+// is empty.
+func newProtoLoader(dir, importPath string) (*loader.ProtoLoader, error) {
+	// Look for a .gunkconfig
+	cfg, err := config.Load(dir)
+	var cfgProtocPath, cfgProtocVer string
+	var includePaths []string
+	var protocOpts downloader.ProtocOptions
+	if err == nil {
+		importPath = filepath.Join(cfg.Dir, cfg.ImportPath)
+		cfgProtocPath = cfg.ProtocPath
+		cfgProtocVer = cfg.ProtocVersion
+		protocOpts = downloader.ProtocOptions{SHA256: cfg.ProtocSHA256, Mirror: cfg.ProtocMirror}
+		includePaths = cfg.IncludePaths
+	}
+	protocPath, err := downloader.CheckOrDownloadProtoc(cfgProtocPath, cfgProtocVer, protocOpts)
+	if err != nil {
+		return nil, err
+	}
+	if importPath == "" {
+		return nil, nil
+	}
+	protoLoader := &loader.ProtoLoader{
+		Dir:          importPath,
+		ProtocPath:   protocPath,
+		IncludePaths: includePaths,
+	}
+	if dir := downloader.ProtocIncludeDir(protocPath); dir != "" {
+		protoLoader.IncludePaths = append(protoLoader.IncludePaths, dir)
+	}
+	return protoLoader, nil
+}
+
 // convertFile reads the provided .proto file and writes a corresponding .gunk
 // file in the same directory.
-func convertFile(path string, overwrite bool, importPath string, protocPath string) error {
+func convertFile(path string, overwrite bool, protoLoader *loader.ProtoLoader) error {
 	if filepath.Ext(path) != ".proto" {
 		return fmt.Errorf("convert requires a .proto file")
 	}
@@ -84,14 +129,19 @@ func convertFile(path string, overwrite bool, importPath string, protocPath stri
 		return fmt.Errorf("unable to read file %q: %v", path, err)
 	}
 	defer file.Close()
-	filename := filepath.Base(path)
-	fileToWrite := strings.Replace(filename, ".proto", ".gunk", 1)
-	fullpath := filepath.Join(filepath.Dir(path), fileToWrite)
+	return convertTo(file, filepath.Base(path), filepath.Dir(path), overwrite, protoLoader)
+}
+
+// convertTo converts the proto file read from r, imported by other files as
+// name, writing the corresponding .gunk file in dir.
+func convertTo(r io.Reader, name, dir string, overwrite bool, protoLoader *loader.ProtoLoader) error {
+	fileToWrite := strings.TrimSuffix(path.Base(name), ".proto") + ".gunk"
+	fullpath := filepath.Join(dir, fileToWrite)
 	if _, err := os.Stat(fullpath); !os.IsNotExist(err) && !overwrite {
 		return fmt.Errorf("path already exists %q, use --overwrite", fullpath)
 	}
 	var b bytes.Buffer
-	if err := loader.ConvertFromProto(&b, file, filename, importPath, protocPath); err != nil {
+	if err := loader.ConvertFromProtoWithLoader(&b, r, name, protoLoader); err != nil {
 		return err
 	}
 	result, err := format.Source(b.Bytes())
@@ -0,0 +1,93 @@
+package convert
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/gunk/gunk/loader"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/encoding/protojson"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// HTTPConfig is the path of a gRPC API configuration file, such as the one
+// given to grpc-gateway with grpc_api_configuration, whose HTTP rules are
+// converted to http.Match tags of the methods they select.
+var HTTPConfig string
+
+// loadHTTPRules returns the HTTP rules of the gRPC API configuration file at
+// path, or nil if path is empty.
+func loadHTTPRules(path string) (*loader.HTTPRules, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg struct {
+		HTTP interface{} `yaml:"http"`
+	}
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if cfg.HTTP == nil {
+		return nil, fmt.Errorf("%s has no http rules", path)
+	}
+	// The YAML is decoded like its JSON equivalent, which is the canonical
+	// encoding of google.api.Http.
+	js, err := json.Marshal(jsonValue(cfg.HTTP))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	var http annotations.Http
+	if err := protojson.Unmarshal(js, &http); err != nil {
+		return nil, fmt.Errorf("%s: invalid http rules: %v", path, err)
+	}
+	return loader.NewHTTPRules(http.Rules), nil
+}
+
+// jsonValue returns the YAML value v with its maps keyed by strings, so that
+// it can be encoded as JSON.
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[fmt.Sprint(key)] = jsonValue(value)
+		}
+		return m
+	case []interface{}:
+		for i, value := range v {
+			v[i] = jsonValue(value)
+		}
+	}
+	return v
+}
+
+// withHTTPRules returns protoLoader, or a loader of the bundled files if it is
+// nil, converting the HTTP rules. It returns protoLoader as is if there are
+// none.
+func withHTTPRules(protoLoader *loader.ProtoLoader, rules *loader.HTTPRules) *loader.ProtoLoader {
+	if rules == nil {
+		return protoLoader
+	}
+	if protoLoader == nil {
+		protoLoader = &loader.ProtoLoader{}
+	}
+	protoLoader.HTTPRules = rules
+	return protoLoader
+}
+
+// warnUnusedHTTPRules prints a warning for each HTTP rule which didn't select
+// any of the converted methods, which often is a typo in its selector.
+func warnUnusedHTTPRules(rules *loader.HTTPRules) {
+	if rules == nil {
+		return
+	}
+	for _, method := range rules.Unused() {
+		fmt.Fprintf(os.Stderr, "%s: HTTP rule of unknown method %s\n", HTTPConfig, method)
+	}
+}
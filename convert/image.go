@@ -0,0 +1,151 @@
+package convert
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/gunk/gunk/loader"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// descriptorSetExts are the extensions of the files converted as compiled
+// FileDescriptorSets, such as those written by protoc --descriptor_set_out
+// or buf build.
+var descriptorSetExts = map[string]bool{
+	".binpb":    true,
+	".bin":      true,
+	".pb":       true,
+	".desc":     true,
+	".protoset": true,
+}
+
+// runImage converts the files of a FileDescriptorSet, or of a buf image which
+// shares its encoding, to Gunk packages in the matching directories of out,
+// as if they were a proto tree. The files bundled with Gunk, such as the well
+// known types, are imported instead of converted.
+func runImage(path, out string, overwrite bool, rules *loader.HTTPRules) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(data, &set); err != nil {
+		return fmt.Errorf("%s is not a FileDescriptorSet: %v", path, err)
+	}
+	resolver, err := extensionTypes(set.File)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	var files []*treeFile
+	for _, f := range set.File {
+		if loader.IsBundledProto(f.GetName()) {
+			continue
+		}
+		src, err := protoSource(f, resolver)
+		if err != nil {
+			return err
+		}
+		files = append(files, &treeFile{name: f.GetName(), src: src})
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("%s has no files to convert", path)
+	}
+	if out == "" {
+		out = "."
+	}
+	if out, err = filepath.Abs(out); err != nil {
+		return err
+	}
+	// All the files imported by the converted ones are either bundled or
+	// converted too, so protoc is never needed.
+	return convertTree(files, out, &loader.ProtoLoader{HTTPRules: rules}, overwrite)
+}
+
+// extensionTypes returns the resolver of the extensions declared by the files
+// of a descriptor set, so that the custom options set with them can be
+// printed. The globally registered extensions, such as google.api.http, are
+// resolved too.
+func extensionTypes(files []*descriptorpb.FileDescriptorProto) (extensionResolver, error) {
+	var local protoregistry.Files
+	resolver := &fileResolver{local: &local}
+	types := new(protoregistry.Types)
+	for _, f := range files {
+		if _, err := protoregistry.GlobalFiles.FindFileByPath(f.GetName()); err == nil {
+			continue
+		}
+		fd, err := protodesc.FileOptions{AllowUnresolvable: true}.New(f, resolver)
+		if err != nil {
+			return nil, err
+		}
+		if err := local.RegisterFile(fd); err != nil {
+			return nil, err
+		}
+		if err := registerExtensions(types, fd.Extensions(), fd.Messages()); err != nil {
+			return nil, err
+		}
+	}
+	return &typeResolver{local: types}, nil
+}
+
+// registerExtensions registers the extensions, and those declared in the
+// messages, recursively.
+func registerExtensions(types *protoregistry.Types, exts protoreflect.ExtensionDescriptors, msgs protoreflect.MessageDescriptors) error {
+	for i := 0; i < exts.Len(); i++ {
+		if err := types.RegisterExtension(dynamicpb.NewExtensionType(exts.Get(i))); err != nil {
+			return err
+		}
+	}
+	for i := 0; i < msgs.Len(); i++ {
+		m := msgs.Get(i)
+		if err := registerExtensions(types, m.Extensions(), m.Messages()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fileResolver resolves the files of a descriptor set, falling back to the
+// globally registered ones.
+type fileResolver struct {
+	local *protoregistry.Files
+}
+
+func (r *fileResolver) FindFileByPath(path string) (protoreflect.FileDescriptor, error) {
+	if fd, err := r.local.FindFileByPath(path); err == nil {
+		return fd, nil
+	}
+	return protoregistry.GlobalFiles.FindFileByPath(path)
+}
+
+func (r *fileResolver) FindDescriptorByName(name protoreflect.FullName) (protoreflect.Descriptor, error) {
+	if d, err := r.local.FindDescriptorByName(name); err == nil {
+		return d, nil
+	}
+	return protoregistry.GlobalFiles.FindDescriptorByName(name)
+}
+
+// typeResolver resolves the extensions of a descriptor set, falling back to
+// the globally registered ones.
+type typeResolver struct {
+	local *protoregistry.Types
+}
+
+func (r *typeResolver) FindExtensionByName(field protoreflect.FullName) (protoreflect.ExtensionType, error) {
+	if xt, err := r.local.FindExtensionByName(field); err == nil {
+		return xt, nil
+	}
+	return protoregistry.GlobalTypes.FindExtensionByName(field)
+}
+
+func (r *typeResolver) FindExtensionByNumber(message protoreflect.FullName, field protoreflect.FieldNumber) (protoreflect.ExtensionType, error) {
+	if xt, err := r.local.FindExtensionByNumber(message, field); err == nil {
+		return xt, nil
+	}
+	return protoregistry.GlobalTypes.FindExtensionByNumber(message, field)
+}
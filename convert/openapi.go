@@ -0,0 +1,915 @@
+package convert
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gunk/gunk/loader"
+	"github.com/kenshaw/snaker"
+	"gopkg.in/yaml.v2"
+)
+
+// RunOpenAPI converts OpenAPI 3 or Swagger 2 specs, written in YAML or JSON,
+// to Gunk files holding their schemas as messages and their operations as the
+// methods of a service with http.Match annotations. The Gunk files are
+// written in out, or next to the specs if it is empty. What can't be mapped
+// exactly is reported on stderr.
+func RunOpenAPI(paths []string, out string, overwrite bool) error {
+	for _, path := range paths {
+		if err := runOpenAPI(path, out, overwrite); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runOpenAPI(path, out string, overwrite bool) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var spec openAPISpec
+	if err := yaml.Unmarshal(data, &spec); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	if spec.OpenAPI == "" && spec.Swagger == "" {
+		return fmt.Errorf("%s is not an OpenAPI or Swagger spec", path)
+	}
+	if out == "" {
+		out = filepath.Dir(path)
+	}
+	if out, err = filepath.Abs(out); err != nil {
+		return err
+	}
+	pkg := packageName(filepath.Base(out))
+	c := newOpenAPIConverter(&spec)
+	src := c.protoSource(pkg)
+	for _, r := range c.report {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", path, r)
+	}
+	if err := os.MkdirAll(out, 0o755); err != nil {
+		return err
+	}
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)) + ".proto"
+	// The generated proto file only imports files bundled with Gunk, so
+	// protoc is never needed.
+	if err := convertTo(bytes.NewReader(src), name, out, overwrite, &loader.ProtoLoader{}); err != nil {
+		return err
+	}
+	return writeConfigStub(out, c.methods > 0)
+}
+
+// openAPISpec holds the parts of an OpenAPI 3 or Swagger 2 spec which are
+// converted.
+type openAPISpec struct {
+	OpenAPI string `yaml:"openapi"`
+	Swagger string `yaml:"swagger"`
+	Info    struct {
+		Title       string `yaml:"title"`
+		Description string `yaml:"description"`
+	} `yaml:"info"`
+	// Servers and BasePath hold the prefix of the paths, in OpenAPI 3
+	// and Swagger 2 respectively.
+	Servers []struct {
+		URL string `yaml:"url"`
+	} `yaml:"servers"`
+	BasePath   string           `yaml:"basePath"`
+	Paths      openAPIPathItems `yaml:"paths"`
+	Components struct {
+		Schemas       openAPISchemas                 `yaml:"schemas"`
+		Parameters    map[string]*openAPIParameter   `yaml:"parameters"`
+		RequestBodies map[string]*openAPIRequestBody `yaml:"requestBodies"`
+		Responses     map[string]*openAPIResponse    `yaml:"responses"`
+	} `yaml:"components"`
+	Definitions openAPISchemas               `yaml:"definitions"`
+	Parameters  map[string]*openAPIParameter `yaml:"parameters"`
+	Responses   map[string]*openAPIResponse  `yaml:"responses"`
+}
+
+type openAPIPathItem struct {
+	Get        *openAPIOperation   `yaml:"get"`
+	Put        *openAPIOperation   `yaml:"put"`
+	Post       *openAPIOperation   `yaml:"post"`
+	Delete     *openAPIOperation   `yaml:"delete"`
+	Patch      *openAPIOperation   `yaml:"patch"`
+	Head       *openAPIOperation   `yaml:"head"`
+	Options    *openAPIOperation   `yaml:"options"`
+	Trace      *openAPIOperation   `yaml:"trace"`
+	Parameters []*openAPIParameter `yaml:"parameters"`
+}
+
+type openAPIOperation struct {
+	OperationID string              `yaml:"operationId"`
+	Summary     string              `yaml:"summary"`
+	Description string              `yaml:"description"`
+	Parameters  []*openAPIParameter `yaml:"parameters"`
+	RequestBody *openAPIRequestBody `yaml:"requestBody"`
+	Responses   openAPIResponses    `yaml:"responses"`
+}
+
+type openAPIParameter struct {
+	Ref         string `yaml:"$ref"`
+	Name        string `yaml:"name"`
+	In          string `yaml:"in"`
+	Description string `yaml:"description"`
+	Required    bool   `yaml:"required"`
+	// Schema holds the type of OpenAPI 3 parameters, and of Swagger 2 body
+	// parameters. The other Swagger 2 parameters are typed inline.
+	Schema *openAPISchema `yaml:"schema"`
+	Type   openAPIType    `yaml:"type"`
+	Format string         `yaml:"format"`
+	Items  *openAPISchema `yaml:"items"`
+	Enum   []interface{}  `yaml:"enum"`
+}
+
+type openAPIRequestBody struct {
+	Ref         string                       `yaml:"$ref"`
+	Description string                       `yaml:"description"`
+	Content     map[string]*openAPIMediaType `yaml:"content"`
+}
+
+type openAPIResponse struct {
+	Ref         string                       `yaml:"$ref"`
+	Description string                       `yaml:"description"`
+	Content     map[string]*openAPIMediaType `yaml:"content"`
+	// Schema holds the body of Swagger 2 responses.
+	Schema *openAPISchema `yaml:"schema"`
+}
+
+type openAPIMediaType struct {
+	Schema *openAPISchema `yaml:"schema"`
+}
+
+type openAPISchema struct {
+	Ref                  string                       `yaml:"$ref"`
+	Type                 openAPIType                  `yaml:"type"`
+	Format               string                       `yaml:"format"`
+	Description          string                       `yaml:"description"`
+	Properties           openAPISchemas               `yaml:"properties"`
+	Required             []string                     `yaml:"required"`
+	Items                *openAPISchema               `yaml:"items"`
+	Enum                 []interface{}                `yaml:"enum"`
+	AdditionalProperties *openAPIAdditionalProperties `yaml:"additionalProperties"`
+	AllOf                []*openAPISchema             `yaml:"allOf"`
+	OneOf                []*openAPISchema             `yaml:"oneOf"`
+	AnyOf                []*openAPISchema             `yaml:"anyOf"`
+	Nullable             bool                         `yaml:"nullable"`
+	Deprecated           bool                         `yaml:"deprecated"`
+}
+
+// openAPIType is the type of a schema, which OpenAPI 3.1 also allows to be a
+// list of types, such as [string, "null"].
+type openAPIType struct {
+	Name     string
+	Nullable bool
+}
+
+func (t *openAPIType) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&t.Name); err == nil {
+		return nil
+	}
+	var names []string
+	if err := unmarshal(&names); err != nil {
+		return err
+	}
+	for _, name := range names {
+		if name == "null" {
+			t.Nullable = true
+		} else if t.Name == "" {
+			t.Name = name
+		}
+	}
+	return nil
+}
+
+// openAPIAdditionalProperties is either a boolean or the schema of the values
+// of a map.
+type openAPIAdditionalProperties struct {
+	Allowed bool
+	Schema  *openAPISchema
+}
+
+func (p *openAPIAdditionalProperties) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&p.Allowed); err == nil {
+		return nil
+	}
+	p.Allowed = true
+	return unmarshal(&p.Schema)
+}
+
+// openAPISchemas are the named schemas of the components or of the properties
+// of a schema, in the order of the spec, which the fields are numbered in.
+type openAPISchemas []*namedOpenAPISchema
+
+type namedOpenAPISchema struct {
+	Name   string
+	Schema *openAPISchema
+}
+
+func (s *openAPISchemas) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	return unmarshalOrdered(unmarshal, func(key string, value []byte) error {
+		named := &namedOpenAPISchema{Name: key}
+		*s = append(*s, named)
+		return yaml.Unmarshal(value, &named.Schema)
+	})
+}
+
+func (s openAPISchemas) get(name string) *openAPISchema {
+	for _, named := range s {
+		if named.Name == name {
+			return named.Schema
+		}
+	}
+	return nil
+}
+
+// openAPIPathItems are the paths of a spec, in its order.
+type openAPIPathItems []*namedOpenAPIPathItem
+
+type namedOpenAPIPathItem struct {
+	Path string
+	Item *openAPIPathItem
+}
+
+func (p *openAPIPathItems) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	return unmarshalOrdered(unmarshal, func(key string, value []byte) error {
+		named := &namedOpenAPIPathItem{Path: key}
+		*p = append(*p, named)
+		return yaml.Unmarshal(value, &named.Item)
+	})
+}
+
+// openAPIResponses are the responses of an operation by status code, which
+// YAML may hold as integers.
+type openAPIResponses []*namedOpenAPIResponse
+
+type namedOpenAPIResponse struct {
+	Code     string
+	Response *openAPIResponse
+}
+
+func (r *openAPIResponses) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	return unmarshalOrdered(unmarshal, func(key string, value []byte) error {
+		named := &namedOpenAPIResponse{Code: key}
+		*r = append(*r, named)
+		return yaml.Unmarshal(value, &named.Response)
+	})
+}
+
+// unmarshalOrdered unmarshals a mapping, calling add with each of its keys
+// and the YAML of its value, in order.
+func unmarshalOrdered(unmarshal func(interface{}) error, add func(key string, value []byte) error) error {
+	var items yaml.MapSlice
+	if err := unmarshal(&items); err != nil {
+		return err
+	}
+	for _, item := range items {
+		value, err := yaml.Marshal(item.Value)
+		if err != nil {
+			return err
+		}
+		if err := add(fmt.Sprint(item.Key), value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openAPIMethods are the HTTP methods which operations are converted for, in
+// the order they are converted in.
+var openAPIMethods = []string{"get", "put", "post", "delete", "patch"}
+
+// openAPIConverter prints the proto source of an OpenAPI spec.
+type openAPIConverter struct {
+	spec *openAPISpec
+	// decls are the printed messages and enums.
+	decls bytes.Buffer
+	// types are the names of the messages and enums of the components by
+	// schema name, and names are all the declared type names.
+	types   map[string]string
+	names   map[string]bool
+	imports map[string]bool
+	// report lists the parts of the spec which couldn't be mapped
+	// exactly.
+	report  []string
+	methods int
+}
+
+func newOpenAPIConverter(spec *openAPISpec) *openAPIConverter {
+	return &openAPIConverter{
+		spec:    spec,
+		types:   make(map[string]string),
+		names:   make(map[string]bool),
+		imports: make(map[string]bool),
+	}
+}
+
+func (c *openAPIConverter) reportf(format string, args ...interface{}) {
+	c.report = append(c.report, fmt.Sprintf(format, args...))
+}
+
+// schemas returns the schemas of the components, or the definitions of a
+// Swagger 2 spec.
+func (c *openAPIConverter) schemas() openAPISchemas {
+	if c.spec.Swagger != "" {
+		return c.spec.Definitions
+	}
+	return c.spec.Components.Schemas
+}
+
+// protoSource returns the proto source of the spec, declaring the proto
+// package pkg.
+func (c *openAPIConverter) protoSource(pkg string) []byte {
+	// The schemas of the components may refer to each other in any
+	// order, so their names are reserved first.
+	for _, named := range c.schemas() {
+		if isMessageSchema(named.Schema) || isEnumSchema(named.Schema) {
+			c.types[named.Name] = c.newName(typeName(named.Name))
+		}
+	}
+	for _, named := range c.schemas() {
+		name, ok := c.types[named.Name]
+		if !ok {
+			continue
+		}
+		if isEnumSchema(named.Schema) {
+			c.enum(name, named.Schema)
+			continue
+		}
+		c.message(name, named.Schema)
+	}
+	var service bytes.Buffer
+	c.service(&service)
+
+	var buf bytes.Buffer
+	buf.WriteString("syntax = \"proto3\";\n\n")
+	writeComment(&buf, 0, c.spec.Info.Description)
+	fmt.Fprintf(&buf, "package %s;\n", pkg)
+	var imports []string
+	for imp := range c.imports {
+		imports = append(imports, imp)
+	}
+	sort.Strings(imports)
+	if len(imports) > 0 {
+		buf.WriteString("\n")
+	}
+	for _, imp := range imports {
+		fmt.Fprintf(&buf, "import %q;\n", imp)
+	}
+	buf.Write(c.decls.Bytes())
+	buf.Write(service.Bytes())
+	return buf.Bytes()
+}
+
+// service prints the service holding the operations of the spec.
+func (c *openAPIConverter) service(w *bytes.Buffer) {
+	prefix := c.pathPrefix()
+	methodNames := make(map[string]bool)
+	var methods bytes.Buffer
+	for _, p := range c.spec.Paths {
+		ops := map[string]*openAPIOperation{
+			"get":     p.Item.Get,
+			"put":     p.Item.Put,
+			"post":    p.Item.Post,
+			"delete":  p.Item.Delete,
+			"patch":   p.Item.Patch,
+			"head":    p.Item.Head,
+			"options": p.Item.Options,
+			"trace":   p.Item.Trace,
+		}
+		for _, method := range []string{"head", "options", "trace"} {
+			if ops[method] != nil {
+				c.reportf("%s %s: %s operations can't be mapped to google.api.http, skipped", strings.ToUpper(method), p.Path, strings.ToUpper(method))
+			}
+		}
+		for _, method := range openAPIMethods {
+			op := ops[method]
+			if op == nil {
+				continue
+			}
+			name := op.OperationID
+			if name == "" {
+				name = method + "_" + p.Path
+			}
+			name = typeName(name)
+			for base, i := name, 2; methodNames[name]; i++ {
+				name = base + strconv.Itoa(i)
+			}
+			methodNames[name] = true
+			c.method(&methods, name, method, prefix, p.Path, p.Item, op)
+			c.methods++
+		}
+	}
+	if c.methods == 0 {
+		return
+	}
+	c.imports["google/api/annotations.proto"] = true
+	w.WriteString("\n")
+	serviceName := "Service"
+	if c.spec.Info.Title != "" {
+		serviceName = strings.TrimSuffix(typeName(c.spec.Info.Title), "Service") + "Service"
+	}
+	fmt.Fprintf(w, "service %s {\n", serviceName)
+	w.Write(methods.Bytes())
+	w.WriteString("}\n")
+}
+
+// pathPrefix returns the path the paths of the spec are relative to, such as
+// "/v1".
+func (c *openAPIConverter) pathPrefix() string {
+	prefix := c.spec.BasePath
+	if len(c.spec.Servers) > 0 {
+		if u, err := url.Parse(c.spec.Servers[0].URL); err == nil {
+			prefix = u.Path
+		}
+	}
+	return strings.TrimSuffix(prefix, "/")
+}
+
+// method prints the rpc of an operation, along with its request and response
+// messages. Its path is relative to prefix.
+func (c *openAPIConverter) method(w *bytes.Buffer, name, method, prefix, path string, item *openAPIPathItem, op *openAPIOperation) {
+	where := strings.ToUpper(method) + " " + path
+	path = prefix + path
+	// The parameters of the operation override those of its path with
+	// the same name and location.
+	var params []*openAPIParameter
+	seen := make(map[string]bool)
+	for _, list := range [][]*openAPIParameter{op.Parameters, item.Parameters} {
+		for _, p := range list {
+			p = c.parameter(p)
+			if p == nil || seen[p.In+" "+p.Name] {
+				continue
+			}
+			seen[p.In+" "+p.Name] = true
+			params = append(params, p)
+		}
+	}
+	var fields []*openAPIField
+	var bodySchema *openAPISchema
+	var bodyDesc string
+	for _, p := range params {
+		switch p.In {
+		case "path", "query":
+			schema := p.Schema
+			if schema == nil {
+				schema = &openAPISchema{Type: p.Type, Format: p.Format, Items: p.Items, Enum: p.Enum}
+			}
+			fields = append(fields, &openAPIField{name: p.Name, schema: schema, desc: p.Description, path: p.In == "path"})
+		case "body":
+			bodySchema, bodyDesc = p.Schema, p.Description
+		default:
+			c.reportf("%s: %s parameter %s can't be mapped to a field, skipped", where, p.In, p.Name)
+		}
+	}
+	if body := c.requestBody(op.RequestBody); body != nil {
+		bodySchema = c.mediaSchema(where+": request body", body.Content)
+		bodyDesc = body.Description
+	}
+
+	var request, httpBody string
+	switch {
+	case len(fields) == 0 && bodySchema == nil:
+		request = "google.protobuf.Empty"
+		c.imports["google/protobuf/empty.proto"] = true
+	case len(fields) == 0 && bodySchema.Ref != "" && isMessageSchema(c.resolve(bodySchema)):
+		// The referenced message is the request, and its fields
+		// the body.
+		request, httpBody = c.schemaType(where, bodySchema, "", ""), "*"
+	default:
+		request = c.newName(name + "Request")
+		if bodySchema != nil {
+			bodyName := "body"
+			if bodySchema.Ref != "" {
+				bodyName = refName(bodySchema.Ref)
+			}
+			fields = append(fields, &openAPIField{name: protoFieldName(bodyName), schema: bodySchema, desc: bodyDesc})
+		}
+		c.printMessage(request, "", fields)
+		if bodySchema != nil {
+			httpBody = fields[len(fields)-1].protoName
+		}
+	}
+	response := c.response(where, name, op.Responses)
+
+	// The path parameters are referred to by the names of their fields.
+	for _, f := range fields {
+		if f.path {
+			path = strings.Replace(path, "{"+f.name+"}", "{"+f.protoName+"}", -1)
+		}
+	}
+	desc := op.Description
+	if desc == "" {
+		desc = op.Summary
+	}
+	writeComment(w, 1, desc)
+	fmt.Fprintf(w, "\trpc %s(%s) returns (%s) {\n", name, request, response)
+	rule := fmt.Sprintf("%s: %q", method, path)
+	if httpBody != "" {
+		rule += fmt.Sprintf(" body: %q", httpBody)
+	}
+	fmt.Fprintf(w, "\t\toption (google.api.http) = {%s};\n", rule)
+	w.WriteString("\t}\n")
+}
+
+// response returns the type of the response of an operation, which is its
+// first successful response.
+func (c *openAPIConverter) response(where, method string, responses openAPIResponses) string {
+	var resp *openAPIResponse
+	var others []string
+	for _, named := range responses {
+		if !strings.HasPrefix(named.Code, "2") {
+			continue
+		}
+		if resp == nil {
+			resp = c.resolveResponse(named.Response)
+			continue
+		}
+		others = append(others, named.Code)
+	}
+	if len(others) > 0 {
+		c.reportf("%s: only the first successful response is converted, %s skipped", where, strings.Join(others, ", "))
+	}
+	var schema *openAPISchema
+	if resp != nil {
+		schema = resp.Schema
+		if len(resp.Content) > 0 {
+			schema = c.mediaSchema(where+": response", resp.Content)
+		}
+	}
+	if schema == nil {
+		c.imports["google/protobuf/empty.proto"] = true
+		return "google.protobuf.Empty"
+	}
+	if schema.Ref != "" && isMessageSchema(c.resolve(schema)) {
+		return c.schemaType(where, schema, "", "")
+	}
+	if isMessageSchema(schema) {
+		name := c.newName(method + "Response")
+		c.message(name, schema)
+		return name
+	}
+	// Responses must be messages, so other bodies are wrapped.
+	name := c.newName(method + "Response")
+	field := "value"
+	if c.resolve(schema).Type.Name == "array" {
+		field = "items"
+	}
+	c.reportf("%s: the response body is not an object, so it is wrapped in the %s field of %s", where, field, name)
+	c.printMessage(name, "", []*openAPIField{{name: field, schema: schema, desc: resp.Description}})
+	return name
+}
+
+// mediaSchema returns the schema of a request or response body, preferring
+// JSON.
+func (c *openAPIConverter) mediaSchema(where string, content map[string]*openAPIMediaType) *openAPISchema {
+	if m := content["application/json"]; m != nil {
+		return m.Schema
+	}
+	var types []string
+	for t := range content {
+		types = append(types, t)
+	}
+	if len(types) == 0 {
+		return nil
+	}
+	sort.Strings(types)
+	for _, t := range types {
+		if strings.HasSuffix(t, "+json") {
+			return content[t].Schema
+		}
+	}
+	c.reportf("%s: %s is not JSON, so it is converted as if it was", where, types[0])
+	return content[types[0]].Schema
+}
+
+// openAPIField is a field of a printed message.
+type openAPIField struct {
+	// name is the name of the property or parameter, which is its JSON
+	// name, and protoName the name of the field.
+	name      string
+	protoName string
+	schema    *openAPISchema
+	desc      string
+	required  bool
+	// path is whether the field is a path parameter.
+	path bool
+}
+
+// message prints the message of an object schema.
+func (c *openAPIConverter) message(name string, schema *openAPISchema) {
+	var fields []*openAPIField
+	required := make(map[string]bool)
+	var properties openAPISchemas
+	for _, s := range append([]*openAPISchema{schema}, schema.AllOf...) {
+		s = c.resolve(s)
+		if s == nil {
+			continue
+		}
+		if s != schema && len(s.AllOf) > 0 {
+			c.reportf("%s: nested allOf schemas are not merged", name)
+		}
+		properties = append(properties, s.Properties...)
+		for _, r := range s.Required {
+			required[r] = true
+		}
+	}
+	for _, p := range properties {
+		fields = append(fields, &openAPIField{name: p.Name, schema: p.Schema, required: required[p.Name]})
+	}
+	c.printMessage(name, schema.Description, fields)
+}
+
+// printMessage prints a message with the fields, numbered in order.
+func (c *openAPIConverter) printMessage(name, desc string, fields []*openAPIField) {
+	// The types of the inline schemas of the fields are printed after
+	// the message.
+	start := c.decls.Len()
+	var w bytes.Buffer
+	w.WriteString("\n")
+	writeComment(&w, 0, desc)
+	fmt.Fprintf(&w, "message %s {\n", name)
+	names := make(map[string]bool)
+	for i, f := range fields {
+		f.protoName = protoFieldName(f.name)
+		for base, j := f.protoName, 2; names[f.protoName]; j++ {
+			f.protoName = base + "_" + strconv.Itoa(j)
+		}
+		names[f.protoName] = true
+		desc := f.desc
+		if desc == "" && f.schema != nil {
+			desc = f.schema.Description
+		}
+		typ := c.schemaType(name+"."+f.name, f.schema, name, f.protoName)
+		writeComment(&w, 1, desc)
+		var opts []string
+		if f.required {
+			c.imports["google/api/field_behavior.proto"] = true
+			opts = append(opts, "(google.api.field_behavior) = REQUIRED")
+		}
+		if f.schema != nil && f.schema.Deprecated {
+			opts = append(opts, "deprecated = true")
+		}
+		if f.schema != nil && c.resolve(f.schema).Format == "uuid" && (typ == "string" || typ == "repeated string") {
+			c.imports["protoc-gen-openapiv2/options/annotations.proto"] = true
+			opts = append(opts, `(grpc.gateway.protoc_gen_openapiv2.options.openapiv2_field) = {format: "uuid"}`)
+		}
+		if f.name != f.protoName {
+			opts = append(opts, fmt.Sprintf("json_name = %q", f.name))
+		}
+		fmt.Fprintf(&w, "\t%s %s = %d%s;\n", typ, f.protoName, i+1, optionList(opts))
+	}
+	w.WriteString("}\n")
+	nested := append([]byte(nil), c.decls.Bytes()[start:]...)
+	c.decls.Truncate(start)
+	c.decls.Write(w.Bytes())
+	c.decls.Write(nested)
+}
+
+// enum prints the enum of a schema with string values. Proto enums need a
+// zero value, and their values are scoped to the package, so they are
+// prefixed with the name of the enum.
+func (c *openAPIConverter) enum(name string, schema *openAPISchema) {
+	prefix := strings.ToUpper(snaker.CamelToSnake(name))
+	var w bytes.Buffer
+	w.WriteString("\n")
+	writeComment(&w, 0, schema.Description)
+	fmt.Fprintf(&w, "enum %s {\n", name)
+	fmt.Fprintf(&w, "\t%s_UNSPECIFIED = 0;\n", prefix)
+	values := map[string]bool{prefix + "_UNSPECIFIED": true}
+	n := 1
+	for _, v := range schema.Enum {
+		value := prefix + "_" + strings.ToUpper(protoFieldName(fmt.Sprint(v)))
+		if values[value] {
+			continue
+		}
+		values[value] = true
+		fmt.Fprintf(&w, "\t%s = %d;\n", value, n)
+		n++
+	}
+	w.WriteString("}\n")
+	c.decls.Write(w.Bytes())
+	if len(schema.Enum) > 0 {
+		c.reportf("%s: enum values are named like %s_%s instead of %q in JSON", name, prefix, strings.ToUpper(protoFieldName(fmt.Sprint(schema.Enum[0]))), fmt.Sprint(schema.Enum[0]))
+	}
+}
+
+// schemaType returns the proto type of a schema, declaring the messages and
+// enums of the inline schemas, named after the field of the message they are
+// declared in.
+func (c *openAPIConverter) schemaType(where string, schema *openAPISchema, message, field string) string {
+	if schema == nil {
+		return c.valueType(where, "has no schema")
+	}
+	if schema.Ref != "" {
+		ref := refName(schema.Ref)
+		if name, ok := c.types[ref]; ok {
+			return name
+		}
+		target := c.resolve(schema)
+		if target == nil {
+			return c.valueType(where, "refers to "+schema.Ref+", which can't be resolved")
+		}
+		return c.schemaType(where, target, message, field)
+	}
+	if schema.Nullable || schema.Type.Nullable {
+		c.reportf("%s: null values can't be told apart from zero values", where)
+	}
+	switch {
+	case len(schema.OneOf) > 0, len(schema.AnyOf) > 0:
+		return c.valueType(where, "combines schemas with oneOf or anyOf")
+	case isEnumSchema(schema):
+		name := c.newName(typeName(message + "_" + field))
+		c.enum(name, schema)
+		return name
+	case isMessageSchema(schema):
+		name := c.newName(typeName(message + "_" + field))
+		c.message(name, schema)
+		return name
+	}
+	switch schema.Type.Name {
+	case "string":
+		switch schema.Format {
+		case "date-time":
+			c.imports["google/protobuf/timestamp.proto"] = true
+			return "google.protobuf.Timestamp"
+		case "byte", "binary":
+			return "bytes"
+		}
+		return "string"
+	case "integer":
+		switch schema.Format {
+		case "int32":
+			return "int32"
+		case "uint32":
+			return "uint32"
+		case "uint64":
+			return "uint64"
+		}
+		return "int64"
+	case "number":
+		if schema.Format == "float" {
+			return "float"
+		}
+		return "double"
+	case "boolean":
+		return "bool"
+	case "array":
+		if schema.Items == nil {
+			c.imports["google/protobuf/struct.proto"] = true
+			return "repeated google.protobuf.Value"
+		}
+		elem := c.schemaType(where, schema.Items, message, field)
+		if strings.HasPrefix(elem, "repeated ") || strings.HasPrefix(elem, "map<") {
+			c.imports["google/protobuf/struct.proto"] = true
+			c.reportf("%s: arrays of arrays or maps can't be repeated fields, so they are converted to google.protobuf.ListValue", where)
+			return "google.protobuf.ListValue"
+		}
+		return "repeated " + elem
+	case "object", "":
+		if ap := schema.AdditionalProperties; ap != nil && ap.Schema != nil {
+			elem := c.schemaType(where, ap.Schema, message, field)
+			if strings.HasPrefix(elem, "repeated ") || strings.HasPrefix(elem, "map<") {
+				return c.valueType(where, "is a map of arrays or maps")
+			}
+			return "map<string, " + elem + ">"
+		}
+		if schema.Type.Name == "object" {
+			c.imports["google/protobuf/struct.proto"] = true
+			return "google.protobuf.Struct"
+		}
+		return c.valueType(where, "has no type")
+	}
+	return c.valueType(where, "has the unknown type "+schema.Type.Name)
+}
+
+// valueType reports that a schema couldn't be mapped, and returns the type
+// holding any JSON value.
+func (c *openAPIConverter) valueType(where, reason string) string {
+	c.imports["google/protobuf/struct.proto"] = true
+	c.reportf("%s: the schema %s, so it is converted to google.protobuf.Value", where, reason)
+	return "google.protobuf.Value"
+}
+
+// resolve returns the schema a schema refers to, if it does.
+func (c *openAPIConverter) resolve(schema *openAPISchema) *openAPISchema {
+	for i := 0; schema != nil && schema.Ref != "" && i < 32; i++ {
+		schema = c.schemas().get(refName(schema.Ref))
+	}
+	return schema
+}
+
+func (c *openAPIConverter) parameter(p *openAPIParameter) *openAPIParameter {
+	if p.Ref == "" {
+		return p
+	}
+	name := refName(p.Ref)
+	if resolved := c.spec.Components.Parameters[name]; resolved != nil {
+		return resolved
+	}
+	if resolved := c.spec.Parameters[name]; resolved != nil {
+		return resolved
+	}
+	c.reportf("parameter %s can't be resolved, skipped", p.Ref)
+	return nil
+}
+
+func (c *openAPIConverter) requestBody(body *openAPIRequestBody) *openAPIRequestBody {
+	if body == nil || body.Ref == "" {
+		return body
+	}
+	if resolved := c.spec.Components.RequestBodies[refName(body.Ref)]; resolved != nil {
+		return resolved
+	}
+	c.reportf("request body %s can't be resolved, skipped", body.Ref)
+	return nil
+}
+
+func (c *openAPIConverter) resolveResponse(resp *openAPIResponse) *openAPIResponse {
+	if resp == nil || resp.Ref == "" {
+		return resp
+	}
+	name := refName(resp.Ref)
+	if resolved := c.spec.Components.Responses[name]; resolved != nil {
+		return resolved
+	}
+	if resolved := c.spec.Responses[name]; resolved != nil {
+		return resolved
+	}
+	c.reportf("response %s can't be resolved, skipped", resp.Ref)
+	return nil
+}
+
+// newName returns a type name which isn't declared yet, based on name.
+func (c *openAPIConverter) newName(name string) string {
+	for base, i := name, 2; c.names[name]; i++ {
+		name = base + strconv.Itoa(i)
+	}
+	c.names[name] = true
+	return name
+}
+
+// isMessageSchema reports whether a schema is converted to a message.
+func isMessageSchema(schema *openAPISchema) bool {
+	if schema == nil || schema.Ref != "" {
+		return false
+	}
+	return len(schema.Properties) > 0 || len(schema.AllOf) > 0
+}
+
+// isEnumSchema reports whether a schema is converted to an enum, which only
+// string enums are.
+func isEnumSchema(schema *openAPISchema) bool {
+	return schema != nil && schema.Ref == "" && len(schema.Enum) > 0 && schema.Type.Name == "string"
+}
+
+// refName returns the name of the component a reference such as
+// "#/components/schemas/Item" refers to.
+func refName(ref string) string {
+	return ref[strings.LastIndex(ref, "/")+1:]
+}
+
+// typeName returns the name of a message or enum, such as "PetStore" for
+// "pet-store".
+func typeName(name string) string {
+	return snaker.ForceCamelIdentifier(protoFieldName(name))
+}
+
+// protoFieldName returns the proto name of a property or parameter, such as
+// "created_at" for "createdAt".
+func protoFieldName(name string) string {
+	var sb strings.Builder
+	for _, r := range snaker.CamelToSnake(name) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			sb.WriteRune(r)
+		case r >= 'A' && r <= 'Z':
+			sb.WriteRune(r - 'A' + 'a')
+		case sb.Len() > 0 && !strings.HasSuffix(sb.String(), "_"):
+			sb.WriteRune('_')
+		}
+	}
+	s := strings.TrimSuffix(sb.String(), "_")
+	if s == "" || s[0] >= '0' && s[0] <= '9' {
+		s = "x_" + s
+	}
+	return s
+}
+
+// writeComment writes the lines of text as a comment.
+func writeComment(w *bytes.Buffer, indent int, text string) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return
+	}
+	for _, line := range strings.Split(text, "\n") {
+		fmt.Fprintf(w, "%s// %s\n", strings.Repeat("\t", indent), strings.TrimRight(line, " \t"))
+	}
+}
@@ -0,0 +1,263 @@
+package convert
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/emicklei/proto"
+	"github.com/gunk/gunk/loader"
+	"golang.org/x/mod/modfile"
+)
+
+// skippedDirs are the directories of a proto tree which are never converted.
+var skippedDirs = map[string]bool{
+	".git":         true,
+	"node_modules": true,
+	"vendor":       true,
+}
+
+// treeFile is a proto file of a tree.
+type treeFile struct {
+	// name is the name of the file as imported, relative to the root of
+	// the tree.
+	name string
+	src  []byte
+}
+
+// treePackage is a directory of a proto tree, converted to a Gunk package.
+type treePackage struct {
+	// dir is the directory relative to the root of the tree.
+	dir   string
+	files []*treeFile
+	// services is whether any of the files declares a service.
+	services bool
+	pkg      *loader.ConvertedPackage
+}
+
+// RunRecursive converts the trees of proto files rooted at the given
+// directories, which may end with "/..." like Go package patterns. Each
+// directory holding proto files is converted to a Gunk package, in the
+// matching directory of out, or of the tree itself if out is empty, along
+// with a .gunkconfig stub if it has none. The proto files import each other
+// by their paths relative to the root of their tree, and these imports are
+// converted to imports of the Gunk packages.
+func RunRecursive(paths []string, out string, overwrite bool) error {
+	rules, err := loadHTTPRules(HTTPConfig)
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		root := strings.TrimSuffix(strings.TrimSuffix(path, "..."), "/")
+		if root == "" {
+			root = "."
+		}
+		if err := runRecursive(root, out, overwrite, rules); err != nil {
+			return err
+		}
+	}
+	warnUnusedHTTPRules(rules)
+	return nil
+}
+
+func runRecursive(root, out string, overwrite bool, rules *loader.HTTPRules) error {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+	if fi, err := os.Stat(root); err != nil {
+		return err
+	} else if !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory", root)
+	}
+	if out == "" {
+		out = root
+	}
+	if out, err = filepath.Abs(out); err != nil {
+		return err
+	}
+	files, err := scanTree(root)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no .proto files found in %s", root)
+	}
+	protoLoader, err := newProtoLoader(root, root)
+	if err != nil {
+		return err
+	}
+	return convertTree(files, out, withHTTPRules(protoLoader, rules), overwrite)
+}
+
+// convertTree converts the files of a proto tree to Gunk packages in the
+// matching directories of out, loading the files they import which aren't
+// part of the tree with protoLoader.
+func convertTree(files []*treeFile, out string, protoLoader *loader.ProtoLoader, overwrite bool) error {
+	pkgs, err := treePackages(files)
+	if err != nil {
+		return err
+	}
+	modRoot, modPath, err := findModule(out)
+	if err != nil {
+		return err
+	}
+	protoLoader.Converted = make(map[string]*loader.ConvertedPackage)
+	for _, p := range pkgs {
+		dir := filepath.Join(out, filepath.FromSlash(p.dir))
+		rel, err := filepath.Rel(modRoot, dir)
+		if err != nil {
+			return err
+		}
+		p.pkg.Path = path.Join(modPath, filepath.ToSlash(rel))
+		p.pkg.Name = packageName(filepath.Base(dir))
+		for _, f := range p.files {
+			protoLoader.Converted[f.name] = p.pkg
+		}
+	}
+	for _, p := range pkgs {
+		dir := filepath.Join(out, filepath.FromSlash(p.dir))
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+		for _, f := range p.files {
+			if err := convertTo(bytes.NewReader(f.src), f.name, dir, overwrite, protoLoader); err != nil {
+				return err
+			}
+		}
+		if err := writeConfigStub(dir, p.services); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanTree returns the proto files of the tree at root.
+func scanTree(root string) ([]*treeFile, error) {
+	var files []*treeFile
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != root && skippedDirs[info.Name()] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(path) != ".proto" {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		src, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		files = append(files, &treeFile{name: filepath.ToSlash(rel), src: src})
+		return nil
+	})
+	return files, err
+}
+
+// treePackages groups the files of a proto tree by directory, sorted by
+// directory.
+func treePackages(files []*treeFile) ([]*treePackage, error) {
+	pkgs := make(map[string]*treePackage)
+	for _, f := range files {
+		protoPkg, services, err := parseTreeFile(f.src)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", f.name, err)
+		}
+		dir := path.Dir(f.name)
+		p := pkgs[dir]
+		if p == nil {
+			p = &treePackage{dir: dir, pkg: &loader.ConvertedPackage{ProtoPackage: protoPkg}}
+			pkgs[dir] = p
+		}
+		if p.pkg.ProtoPackage != protoPkg {
+			return nil, fmt.Errorf("%s: the files of a directory must declare the same package, found %s and %s", dir, p.pkg.ProtoPackage, protoPkg)
+		}
+		p.files = append(p.files, f)
+		p.services = p.services || services
+	}
+	var list []*treePackage
+	for _, p := range pkgs {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].dir < list[j].dir })
+	return list, nil
+}
+
+// parseTreeFile returns the package declared by the proto file, and whether
+// it declares any service.
+func parseTreeFile(src []byte) (pkg string, services bool, err error) {
+	def, err := proto.NewParser(bytes.NewReader(src)).Parse()
+	if err != nil {
+		return "", false, err
+	}
+	proto.Walk(def,
+		proto.WithPackage(func(p *proto.Package) { pkg = p.Name }),
+		proto.WithService(func(*proto.Service) { services = true }),
+	)
+	if pkg == "" {
+		return "", false, fmt.Errorf("a package must be declared")
+	}
+	return pkg, services, nil
+}
+
+// findModule returns the root directory and the path of the module which
+// contains dir, which doesn't need to exist yet.
+func findModule(dir string) (root, modPath string, err error) {
+	for root = dir; ; {
+		data, err := ioutil.ReadFile(filepath.Join(root, "go.mod"))
+		if err == nil {
+			return root, modfile.ModulePath(data), nil
+		}
+		parent := filepath.Dir(root)
+		if parent == root {
+			return "", "", fmt.Errorf("no go.mod found in %s or its parents, which the import paths of the converted packages are derived from", dir)
+		}
+		root = parent
+	}
+}
+
+// packageName turns a directory name into a valid package name.
+func packageName(dir string) string {
+	var sb strings.Builder
+	for _, r := range strings.ToLower(dir) {
+		switch {
+		case r >= 'a' && r <= 'z', r == '_', r >= '0' && r <= '9' && sb.Len() > 0:
+			sb.WriteRune(r)
+		case r >= '0' && r <= '9':
+			sb.WriteString("_")
+			sb.WriteRune(r)
+		}
+	}
+	if sb.Len() == 0 {
+		return "api"
+	}
+	return sb.String()
+}
+
+// writeConfigStub writes a .gunkconfig generating the Go code of the Gunk
+// package in dir, along with its gRPC code if it has services, unless the
+// package already has one.
+func writeConfigStub(dir string, services bool) error {
+	file := filepath.Join(dir, ".gunkconfig")
+	if _, err := os.Stat(file); err == nil {
+		return nil
+	}
+	cfg := "[generate go]\n"
+	if services {
+		cfg += "\n[generate grpc-go]\n"
+	}
+	return ioutil.WriteFile(file, []byte(cfg), 0o644)
+}
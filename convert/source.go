@@ -0,0 +1,506 @@
+package convert
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// The numbers of the descriptor fields making up source code info paths.
+const (
+	fileSyntaxPath    = 12
+	filePackagePath   = 2
+	fileMessagePath   = 4
+	fileEnumPath      = 5
+	fileServicePath   = 6
+	fileExtensionPath = 7
+
+	messageFieldPath     = 2
+	messageNestedPath    = 3
+	messageEnumPath      = 4
+	messageExtensionPath = 6
+	messageOneofPath     = 8
+
+	enumValuePath     = 2
+	serviceMethodPath = 2
+)
+
+// extensionResolver resolves the extensions which custom options are set
+// with.
+type extensionResolver interface {
+	FindExtensionByName(field protoreflect.FullName) (protoreflect.ExtensionType, error)
+	FindExtensionByNumber(message protoreflect.FullName, field protoreflect.FieldNumber) (protoreflect.ExtensionType, error)
+}
+
+// sourcePrinter prints the proto source of a file descriptor.
+type sourcePrinter struct {
+	buf  bytes.Buffer
+	file *descriptorpb.FileDescriptorProto
+	// resolver resolves the custom options, which are unknown fields of
+	// the options until then.
+	resolver extensionResolver
+	// comments are the source code info locations holding comments, by
+	// path.
+	comments map[string]*descriptorpb.SourceCodeInfo_Location
+}
+
+// protoSource returns the proto source of a file descriptor, such as one of a
+// FileDescriptorSet, so that it can be converted like a proto file. Comments
+// are kept if the descriptor has source code info.
+func protoSource(f *descriptorpb.FileDescriptorProto, resolver extensionResolver) ([]byte, error) {
+	p := &sourcePrinter{
+		file:     f,
+		resolver: resolver,
+		comments: make(map[string]*descriptorpb.SourceCodeInfo_Location),
+	}
+	for _, loc := range f.GetSourceCodeInfo().GetLocation() {
+		key := pathKey(loc.Path)
+		if _, ok := p.comments[key]; !ok {
+			p.comments[key] = loc
+		}
+	}
+	syntax := f.GetSyntax()
+	switch syntax {
+	case "":
+		syntax = "proto2"
+	case "proto2", "proto3":
+	default:
+		return nil, fmt.Errorf("%s: syntax %q isn't supported", f.GetName(), syntax)
+	}
+	p.comment(0, fileSyntaxPath)
+	p.printf(0, "syntax = %q;\n", syntax)
+	if f.Package != nil {
+		p.printf(0, "\n")
+		p.comment(0, filePackagePath)
+		p.printf(0, "package %s;\n", f.GetPackage())
+	}
+	if len(f.Dependency) > 0 {
+		p.printf(0, "\n")
+	}
+	for i, dep := range f.Dependency {
+		switch {
+		case containsIndex(f.PublicDependency, i):
+			p.printf(0, "import public %q;\n", dep)
+		case containsIndex(f.WeakDependency, i):
+			p.printf(0, "import weak %q;\n", dep)
+		default:
+			p.printf(0, "import %q;\n", dep)
+		}
+	}
+	if opts := p.options(f.Options); len(opts) > 0 {
+		p.printf(0, "\n")
+		for _, o := range opts {
+			p.printf(0, "option %s;\n", o)
+		}
+	}
+	for i, m := range f.MessageType {
+		p.printf(0, "\n")
+		if err := p.message(0, m, "", []int32{fileMessagePath, int32(i)}); err != nil {
+			return nil, fmt.Errorf("%s: %v", f.GetName(), err)
+		}
+	}
+	for i, e := range f.EnumType {
+		p.printf(0, "\n")
+		p.enum(0, e, []int32{fileEnumPath, int32(i)})
+	}
+	for i, s := range f.Service {
+		p.printf(0, "\n")
+		p.service(s, []int32{fileServicePath, int32(i)})
+	}
+	if err := p.extensions(0, f.Extension, "", []int32{fileExtensionPath}); err != nil {
+		return nil, fmt.Errorf("%s: %v", f.GetName(), err)
+	}
+	return p.buf.Bytes(), nil
+}
+
+func (p *sourcePrinter) printf(indent int, format string, args ...interface{}) {
+	p.buf.WriteString(strings.Repeat("\t", indent))
+	fmt.Fprintf(&p.buf, format, args...)
+}
+
+// comment prints the leading and trailing comments of the declaration at the
+// source code info path, as Gunk only has doc comments.
+func (p *sourcePrinter) comment(indent int, path ...int32) {
+	loc := p.comments[pathKey(path)]
+	for _, c := range []string{loc.GetLeadingComments(), loc.GetTrailingComments()} {
+		if c == "" {
+			continue
+		}
+		for _, line := range strings.Split(strings.TrimSuffix(c, "\n"), "\n") {
+			p.printf(indent, "//%s\n", strings.TrimRight(line, " \t"))
+		}
+	}
+}
+
+// message prints a message and the types nested in it. scope is the fully
+// qualified name of the message it is nested in, if any.
+func (p *sourcePrinter) message(indent int, m *descriptorpb.DescriptorProto, scope string, path []int32) error {
+	p.comment(indent, path...)
+	p.printf(indent, "message %s {\n", m.GetName())
+	scope = p.fullName(scope, m.GetName())
+	for _, o := range p.options(m.Options) {
+		p.printf(indent+1, "option %s;\n", o)
+	}
+	// Map fields are repeated fields of nested map entry messages.
+	entries := make(map[string]*descriptorpb.DescriptorProto)
+	for _, n := range m.NestedType {
+		if n.GetOptions().GetMapEntry() {
+			entries[p.fullName(scope, n.GetName())] = n
+		}
+	}
+	printedOneofs := make(map[int32]bool)
+	for i, f := range m.Field {
+		if f.OneofIndex == nil || f.GetProto3Optional() {
+			if err := p.field(indent+1, f, scope, entries, false, appendPath(path, messageFieldPath, int32(i))); err != nil {
+				return err
+			}
+			continue
+		}
+		// The fields of a oneof are printed together, where its
+		// first field is.
+		index := f.GetOneofIndex()
+		if printedOneofs[index] {
+			continue
+		}
+		printedOneofs[index] = true
+		p.comment(indent+1, appendPath(path, messageOneofPath, index)...)
+		p.printf(indent+1, "oneof %s {\n", m.OneofDecl[index].GetName())
+		for j, f := range m.Field {
+			if f.OneofIndex == nil || f.GetOneofIndex() != index || f.GetProto3Optional() {
+				continue
+			}
+			if err := p.field(indent+2, f, scope, entries, true, appendPath(path, messageFieldPath, int32(j))); err != nil {
+				return err
+			}
+		}
+		p.printf(indent+1, "}\n")
+	}
+	for i, n := range m.NestedType {
+		if n.GetOptions().GetMapEntry() {
+			continue
+		}
+		if err := p.message(indent+1, n, scope, appendPath(path, messageNestedPath, int32(i))); err != nil {
+			return err
+		}
+	}
+	for i, e := range m.EnumType {
+		p.enum(indent+1, e, appendPath(path, messageEnumPath, int32(i)))
+	}
+	if len(m.ExtensionRange) > 0 {
+		var ranges []string
+		for _, r := range m.ExtensionRange {
+			// The ends of message ranges are exclusive.
+			ranges = append(ranges, rangeSource(r.GetStart(), r.GetEnd()-1, maxFieldNumber))
+		}
+		p.printf(indent+1, "extensions %s;\n", strings.Join(ranges, ", "))
+	}
+	if len(m.ReservedRange) > 0 {
+		var ranges []string
+		for _, r := range m.ReservedRange {
+			ranges = append(ranges, rangeSource(r.GetStart(), r.GetEnd()-1, maxFieldNumber))
+		}
+		p.printf(indent+1, "reserved %s;\n", strings.Join(ranges, ", "))
+	}
+	if len(m.ReservedName) > 0 {
+		p.printf(indent+1, "reserved %s;\n", quoteAll(m.ReservedName))
+	}
+	if err := p.extensions(indent+1, m.Extension, scope, appendPath(path, messageExtensionPath)); err != nil {
+		return err
+	}
+	p.printf(indent, "}\n")
+	return nil
+}
+
+// maxFieldNumber is the largest field number, which "max" stands for in the
+// ranges of messages.
+const maxFieldNumber = 536870911
+
+// field prints a field of a message declared in scope, or an extension
+// declared in it. entries are the map entry messages of the message.
+func (p *sourcePrinter) field(indent int, f *descriptorpb.FieldDescriptorProto, scope string, entries map[string]*descriptorpb.DescriptorProto, inOneof bool, path []int32) error {
+	if f.GetType() == descriptorpb.FieldDescriptorProto_TYPE_GROUP {
+		return fmt.Errorf("group %s can't be represented in Gunk", f.GetName())
+	}
+	p.comment(indent, path...)
+	var typ string
+	if entry := entries[f.GetTypeName()]; entry != nil && len(entry.Field) == 2 {
+		typ = fmt.Sprintf("map<%s, %s>", p.fieldType(entry.Field[0], scope), p.fieldType(entry.Field[1], scope))
+	} else {
+		typ = p.fieldType(f, scope)
+		switch {
+		case inOneof:
+		case f.GetLabel() == descriptorpb.FieldDescriptorProto_LABEL_REPEATED:
+			typ = "repeated " + typ
+		case f.GetLabel() == descriptorpb.FieldDescriptorProto_LABEL_REQUIRED:
+			typ = "required " + typ
+		case f.GetProto3Optional(), p.file.GetSyntax() != "proto3":
+			typ = "optional " + typ
+		}
+	}
+	opts := p.options(f.Options)
+	if f.DefaultValue != nil {
+		opts = append([]string{"default = " + defaultValue(f)}, opts...)
+	}
+	p.printf(indent, "%s %s = %d%s;\n", typ, f.GetName(), f.GetNumber(), optionList(opts))
+	return nil
+}
+
+// fieldType returns the proto type of a field declared in scope.
+func (p *sourcePrinter) fieldType(f *descriptorpb.FieldDescriptorProto, scope string) string {
+	if f.TypeName != nil {
+		return p.typeName(f.GetTypeName(), scope)
+	}
+	return strings.ToLower(strings.TrimPrefix(f.GetType().String(), "TYPE_"))
+}
+
+// typeName returns the name of a type, as referred to from scope. The types
+// nested in scope are referred to by their names, and the other types of the
+// package relative to it, like the converted types are named. The types of
+// other packages are referred to by their full names.
+func (p *sourcePrinter) typeName(name, scope string) string {
+	if rest := strings.TrimPrefix(name, scope+"."); scope != "" && rest != name && !strings.Contains(rest, ".") {
+		return rest
+	}
+	if pkg := p.file.GetPackage(); pkg != "" {
+		if rest := strings.TrimPrefix(name, "."+pkg+"."); rest != name {
+			return rest
+		}
+	}
+	return strings.TrimPrefix(name, ".")
+}
+
+// fullName returns the fully qualified name, such as ".foo.Bar", of a type
+// nested in scope, or declared in the package if scope is empty.
+func (p *sourcePrinter) fullName(scope, name string) string {
+	if scope == "" && p.file.GetPackage() != "" {
+		scope = "." + p.file.GetPackage()
+	}
+	return scope + "." + name
+}
+
+// enum prints an enum, with its values.
+func (p *sourcePrinter) enum(indent int, e *descriptorpb.EnumDescriptorProto, path []int32) {
+	p.comment(indent, path...)
+	p.printf(indent, "enum %s {\n", e.GetName())
+	for _, o := range p.options(e.Options) {
+		p.printf(indent+1, "option %s;\n", o)
+	}
+	for i, v := range e.Value {
+		p.comment(indent+1, appendPath(path, enumValuePath, int32(i))...)
+		p.printf(indent+1, "%s = %d%s;\n", v.GetName(), v.GetNumber(), optionList(p.options(v.Options)))
+	}
+	if len(e.ReservedRange) > 0 {
+		var ranges []string
+		for _, r := range e.ReservedRange {
+			// Unlike those of messages, the ends of enum ranges
+			// are inclusive.
+			ranges = append(ranges, rangeSource(r.GetStart(), r.GetEnd(), math.MaxInt32))
+		}
+		p.printf(indent+1, "reserved %s;\n", strings.Join(ranges, ", "))
+	}
+	if len(e.ReservedName) > 0 {
+		p.printf(indent+1, "reserved %s;\n", quoteAll(e.ReservedName))
+	}
+	p.printf(indent, "}\n")
+}
+
+// service prints a service, with its methods.
+func (p *sourcePrinter) service(s *descriptorpb.ServiceDescriptorProto, path []int32) {
+	p.comment(0, path...)
+	p.printf(0, "service %s {\n", s.GetName())
+	for _, o := range p.options(s.Options) {
+		p.printf(1, "option %s;\n", o)
+	}
+	for i, m := range s.Method {
+		p.comment(1, appendPath(path, serviceMethodPath, int32(i))...)
+		in, out := p.typeName(m.GetInputType(), ""), p.typeName(m.GetOutputType(), "")
+		if m.GetClientStreaming() {
+			in = "stream " + in
+		}
+		if m.GetServerStreaming() {
+			out = "stream " + out
+		}
+		opts := p.options(m.Options)
+		if len(opts) == 0 {
+			p.printf(1, "rpc %s(%s) returns (%s);\n", m.GetName(), in, out)
+			continue
+		}
+		p.printf(1, "rpc %s(%s) returns (%s) {\n", m.GetName(), in, out)
+		for _, o := range opts {
+			p.printf(2, "option %s;\n", o)
+		}
+		p.printf(1, "}\n")
+	}
+	p.printf(0, "}\n")
+}
+
+// extensions prints the extensions declared in scope, grouped by the message
+// they extend.
+func (p *sourcePrinter) extensions(indent int, exts []*descriptorpb.FieldDescriptorProto, scope string, path []int32) error {
+	var extendees []string
+	byExtendee := make(map[string][]int)
+	for i, x := range exts {
+		if _, ok := byExtendee[x.GetExtendee()]; !ok {
+			extendees = append(extendees, x.GetExtendee())
+		}
+		byExtendee[x.GetExtendee()] = append(byExtendee[x.GetExtendee()], i)
+	}
+	for _, extendee := range extendees {
+		p.printf(0, "\n")
+		p.printf(indent, "extend %s {\n", p.typeName(extendee, scope))
+		for _, i := range byExtendee[extendee] {
+			if err := p.field(indent+1, exts[i], scope, nil, false, appendPath(path, int32(i))); err != nil {
+				return err
+			}
+		}
+		p.printf(indent, "}\n")
+	}
+	return nil
+}
+
+// options returns the options set in an options message, such as
+// "deprecated = true" or "(google.api.http) = {get: "/v1/foo"}", sorted by
+// number. Repeated options are returned once per value.
+func (p *sourcePrinter) options(opts proto.Message) []string {
+	m := opts.ProtoReflect()
+	if !m.IsValid() {
+		return nil
+	}
+	if p.resolver != nil && len(m.GetUnknown()) > 0 {
+		// Custom options are unknown fields until their extensions
+		// are resolved.
+		if buf, err := proto.Marshal(opts); err == nil {
+			resolved := m.New()
+			if err := (proto.UnmarshalOptions{Resolver: p.resolver}).Unmarshal(buf, resolved.Interface()); err == nil {
+				m = resolved
+			}
+		}
+	}
+	var fields []protoreflect.FieldDescriptor
+	m.Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+		fields = append(fields, fd)
+		return true
+	})
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Number() < fields[j].Number() })
+	var list []string
+	for _, fd := range fields {
+		if fd.FullName() == "google.protobuf.MessageOptions.map_entry" {
+			// Printed as a map field instead.
+			continue
+		}
+		name := string(fd.Name())
+		if fd.IsExtension() {
+			name = "(" + string(fd.FullName()) + ")"
+		}
+		v := m.Get(fd)
+		if !fd.IsList() {
+			value := optionValue(fd, v)
+			if fd.Message() == nil && value == optionValue(fd, fd.Default()) {
+				// Options set to their default values, such as
+				// those of descriptors dumped by Gunk, change
+				// nothing.
+				continue
+			}
+			list = append(list, name+" = "+value)
+			continue
+		}
+		for i := 0; i < v.List().Len(); i++ {
+			list = append(list, name+" = "+optionValue(fd, v.List().Get(i)))
+		}
+	}
+	return list
+}
+
+// optionValue returns the source of the value of an option.
+func optionValue(fd protoreflect.FieldDescriptor, v protoreflect.Value) string {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return strconv.FormatBool(v.Bool())
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByNumber(v.Enum()); ev != nil {
+			return string(ev.Name())
+		}
+		return strconv.Itoa(int(v.Enum()))
+	case protoreflect.StringKind:
+		return strconv.Quote(v.String())
+	case protoreflect.BytesKind:
+		return strconv.Quote(string(v.Bytes()))
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 64)
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		b, _ := prototext.MarshalOptions{}.Marshal(v.Message().Interface())
+		return "{" + strings.TrimSpace(string(b)) + "}"
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind, protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return strconv.FormatUint(v.Uint(), 10)
+	default:
+		return strconv.FormatInt(v.Int(), 10)
+	}
+}
+
+// optionList returns the source of the options of a field or enum value, such
+// as " [deprecated = true]", or an empty string if there are none.
+func optionList(opts []string) string {
+	if len(opts) == 0 {
+		return ""
+	}
+	return " [" + strings.Join(opts, ", ") + "]"
+}
+
+// defaultValue returns the source of the default value of a field.
+func defaultValue(f *descriptorpb.FieldDescriptorProto) string {
+	switch f.GetType() {
+	case descriptorpb.FieldDescriptorProto_TYPE_STRING:
+		return strconv.Quote(f.GetDefaultValue())
+	case descriptorpb.FieldDescriptorProto_TYPE_BYTES:
+		// The default values of bytes fields are already escaped.
+		return `"` + f.GetDefaultValue() + `"`
+	}
+	return f.GetDefaultValue()
+}
+
+// rangeSource returns the source of a range of numbers with inclusive ends,
+// such as "5", "5 to 10" or "5 to max".
+func rangeSource(start, end, max int32) string {
+	switch end {
+	case start:
+		return strconv.Itoa(int(start))
+	case max:
+		return fmt.Sprintf("%d to max", start)
+	}
+	return fmt.Sprintf("%d to %d", start, end)
+}
+
+func quoteAll(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = strconv.Quote(name)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+func containsIndex(indexes []int32, i int) bool {
+	for _, index := range indexes {
+		if int(index) == i {
+			return true
+		}
+	}
+	return false
+}
+
+func pathKey(path []int32) string {
+	return fmt.Sprint(path)
+}
+
+// appendPath returns a copy of the source code info path with elems
+// appended, so that the paths of sibling declarations don't share memory.
+func appendPath(path []int32, elems ...int32) []int32 {
+	return append(append([]int32(nil), path...), elems...)
+}
@@ -0,0 +1,198 @@
+package create
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/gunk/gunk/format"
+	"golang.org/x/mod/modfile"
+)
+
+// versionRegexp matches the major version elements of an import path, such as
+// "v1" or "v2beta1".
+var versionRegexp = regexp.MustCompile(`^v[0-9]+((alpha|beta)[0-9]*)?$`)
+
+// Package scaffolds a new Gunk package with the given import path, writing a
+// Gunk file and the matching .gunkconfig. If service is not empty, a service
+// with a sample method is declared too. If dir is empty, the directory of the
+// package is derived from the go.mod file of the current module.
+func Package(importPath, service, dir string) error {
+	importPath = strings.Trim(importPath, "/")
+	if importPath == "" {
+		return fmt.Errorf("an import path is required")
+	}
+	if service != "" && !isExported(service) {
+		return fmt.Errorf("service name %q must be an exported Go identifier", service)
+	}
+	if dir == "" {
+		var err error
+		dir, err = packageDir(importPath)
+		if err != nil {
+			return err
+		}
+	}
+	pkgName, protoName := packageNames(importPath)
+	name := protoName
+	if i := strings.Index(protoName, "."); i >= 0 {
+		name = protoName[:i]
+	}
+	gunkFile := filepath.Join(dir, pkgName+".gunk")
+	configFile := filepath.Join(dir, ".gunkconfig")
+	for _, file := range []string{gunkFile, configFile} {
+		if _, err := os.Stat(file); err == nil {
+			return fmt.Errorf("%s already exists", file)
+		}
+	}
+	src, err := executeTemplate(gunkTmpl, templateData{
+		Package:   pkgName,
+		ProtoName: protoName,
+		Name:      name,
+		Service:   service,
+	})
+	if err != nil {
+		return err
+	}
+	if src, err = format.Source(src); err != nil {
+		return fmt.Errorf("error formatting %s: %v", gunkFile, err)
+	}
+	cfg, err := executeTemplate(configTmpl, templateData{Service: service})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(gunkFile, src, 0o644); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(configFile, cfg, 0o644)
+}
+
+// packageDir returns the directory of the package with the given import path
+// within the module containing the current directory.
+func packageDir(importPath string) (string, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	for dir := wd; ; {
+		data, err := ioutil.ReadFile(filepath.Join(dir, "go.mod"))
+		if err == nil {
+			modPath := modfile.ModulePath(data)
+			switch {
+			case importPath == modPath:
+				return dir, nil
+			case strings.HasPrefix(importPath, modPath+"/"):
+				rel := strings.TrimPrefix(importPath, modPath+"/")
+				return filepath.Join(dir, filepath.FromSlash(rel)), nil
+			}
+			return "", fmt.Errorf("%s is not in module %s; use --dir to choose its directory", importPath, modPath)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("no go.mod found in %s or its parents; use --dir to choose the directory of %s", wd, importPath)
+		}
+		dir = parent
+	}
+}
+
+// packageNames returns the Go package name and the proto package name for an
+// import path. Versioned import paths such as "example.com/foo/v1" result in
+// the package v1 with the proto package "foo.v1".
+func packageNames(importPath string) (pkgName, protoName string) {
+	elems := strings.Split(importPath, "/")
+	pkgName = sanitize(elems[len(elems)-1])
+	protoName = pkgName
+	if len(elems) > 1 && versionRegexp.MatchString(pkgName) {
+		protoName = sanitize(elems[len(elems)-2]) + "." + pkgName
+	}
+	return pkgName, protoName
+}
+
+// sanitize turns an import path element into a valid package name.
+func sanitize(elem string) string {
+	var sb strings.Builder
+	for _, r := range strings.ToLower(elem) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9' && sb.Len() > 0:
+			sb.WriteRune(r)
+		case r >= '0' && r <= '9':
+			sb.WriteString("_")
+			sb.WriteRune(r)
+		}
+	}
+	if sb.Len() == 0 {
+		return "api"
+	}
+	return sb.String()
+}
+
+func isExported(name string) bool {
+	for i, r := range name {
+		switch {
+		case i == 0 && (r < 'A' || r > 'Z'):
+			return false
+		case !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_'):
+			return false
+		}
+	}
+	return name != ""
+}
+
+type templateData struct {
+	Package   string
+	ProtoName string
+	Name      string
+	Service   string
+}
+
+func executeTemplate(tmpl *template.Template, data templateData) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+var gunkTmpl = template.Must(template.New("gunk").Parse(`// Package {{.Package}} contains the {{.Name}} API.
+package {{.Package}} // proto "{{.ProtoName}}"
+{{if .Service}}
+// {{.Service}} is the {{.Service}} service.
+type {{.Service}} interface {
+	// Get{{.Service}} returns a {{.Service}}.
+	Get{{.Service}}(Get{{.Service}}Request) Get{{.Service}}Response
+}
+
+// Get{{.Service}}Request is the request of Get{{.Service}}.
+type Get{{.Service}}Request struct {
+	// ID is the identifier of the {{.Service}} to return.
+	ID string ` + "`" + `pb:"1" json:"id"` + "`" + `
+}
+
+// Get{{.Service}}Response is the response of Get{{.Service}}.
+type Get{{.Service}}Response struct {
+	// ID is the identifier of the {{.Service}}.
+	ID string ` + "`" + `pb:"1" json:"id"` + "`" + `
+	// Name is the name of the {{.Service}}.
+	Name string ` + "`" + `pb:"2" json:"name"` + "`" + `
+}
+{{else}}
+// Message is a sample message.
+type Message struct {
+	// ID is the identifier of the message.
+	ID string ` + "`" + `pb:"1" json:"id"` + "`" + `
+	// Text is the content of the message.
+	Text string ` + "`" + `pb:"2" json:"text"` + "`" + `
+}
+{{end}}`))
+
+var configTmpl = template.Must(template.New("gunkconfig").Parse(`[generate go]
+{{if .Service}}
+[generate grpc-go]
+{{end}}`))
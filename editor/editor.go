@@ -0,0 +1,274 @@
+package editor
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gunk/gunk/loader"
+)
+
+// Run writes the editor support artifacts for Gunk files to dir: a TextMate
+// grammar packaged as a VS Code extension, and Tree-sitter highlight queries
+// for use with the Go grammar. The version is used as the extension version.
+func Run(dir, version string) error {
+	grammar, err := marshal(textMateGrammar())
+	if err != nil {
+		return err
+	}
+	manifest, err := marshal(extensionManifest(version))
+	if err != nil {
+		return err
+	}
+	langConfig, err := marshal(languageConfiguration())
+	if err != nil {
+		return err
+	}
+	files := map[string][]byte{
+		"package.json":                  manifest,
+		"language-configuration.json":   langConfig,
+		"syntaxes/gunk.tmLanguage.json": grammar,
+		"queries/highlights.scm":        []byte(treeSitterHighlights()),
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(path, data, 0o644); err != nil {
+			return fmt.Errorf("unable to write %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+func marshal(v interface{}) ([]byte, error) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// keywords returns the keywords of the Go syntax Gunk files are parsed with.
+func keywords() []string {
+	var kws []string
+	for tok := token.BREAK; tok <= token.VAR; tok++ {
+		if tok.IsKeyword() {
+			kws = append(kws, tok.String())
+		}
+	}
+	return kws
+}
+
+// predeclared returns the names of the predeclared types and constants the
+// Gunk files are type-checked with.
+func predeclared() (typeNames, constNames []string) {
+	for _, name := range types.Universe.Names() {
+		switch types.Universe.Lookup(name).(type) {
+		case *types.TypeName:
+			if name != "error" && name != "any" && name != "comparable" {
+				typeNames = append(typeNames, name)
+			}
+		case *types.Const, *types.Nil:
+			constNames = append(constNames, name)
+		}
+	}
+	sort.Strings(typeNames)
+	sort.Strings(constNames)
+	return typeNames, constNames
+}
+
+// words returns a regular expression matching any of the given words.
+func words(ws []string) string {
+	quoted := make([]string, len(ws))
+	for i, w := range ws {
+		quoted[i] = regexp.QuoteMeta(w)
+	}
+	return `\b(` + strings.Join(quoted, "|") + `)\b`
+}
+
+type object = map[string]interface{}
+
+type list = []interface{}
+
+func include(name string) object {
+	return object{"include": "#" + name}
+}
+
+func textMateGrammar() object {
+	typeNames, constNames := predeclared()
+	tagKeys := loader.StructTagKeys()
+	return object{
+		"name":      "Gunk",
+		"scopeName": "source.gunk",
+		"fileTypes": list{"gunk"},
+		"patterns": list{
+			include("comments"),
+			include("struct-tags"),
+			include("expressions"),
+		},
+		"repository": object{
+			"comments": object{
+				"patterns": list{
+					object{
+						"name":  "meta.annotation.gunk",
+						"begin": `(//)\s*(\+gunk)\b`,
+						"beginCaptures": object{
+							"1": object{"name": "punctuation.definition.comment.gunk"},
+							"2": object{"name": "keyword.other.annotation.gunk"},
+						},
+						"end":      `$`,
+						"patterns": list{include("expressions")},
+					},
+					object{
+						"match": `(//)\s*(proto)\s+("[^"]*")`,
+						"captures": object{
+							"1": object{"name": "punctuation.definition.comment.gunk"},
+							"2": object{"name": "keyword.other.proto.gunk"},
+							"3": object{"name": "string.quoted.double.gunk"},
+						},
+					},
+					object{
+						"name":  "comment.line.double-slash.gunk",
+						"begin": `//`,
+						"end":   `$`,
+					},
+					object{
+						"name":  "comment.block.gunk",
+						"begin": `/\*`,
+						"end":   `\*/`,
+					},
+				},
+			},
+			"struct-tags": object{
+				"name":  "string.quoted.raw.gunk",
+				"begin": "`",
+				"end":   "`",
+				"patterns": list{
+					object{
+						"match": words(tagKeys) + `(:)("(?:[^"\\]|\\.)*")`,
+						"captures": object{
+							"1": object{"name": "entity.name.tag.gunk"},
+							"2": object{"name": "punctuation.separator.key-value.gunk"},
+							"3": object{"name": "string.quoted.double.gunk"},
+						},
+					},
+					object{
+						"match": `[^\s:"]+(?=:")`,
+						"name":  "invalid.illegal.tag.gunk",
+					},
+				},
+			},
+			"expressions": object{
+				"patterns": list{
+					object{
+						"name":  "keyword.control.gunk",
+						"match": words(keywords()),
+					},
+					object{
+						"name":  "storage.type.gunk",
+						"match": words(typeNames),
+					},
+					object{
+						"name":  "constant.language.gunk",
+						"match": words(constNames),
+					},
+					object{
+						"name":     "string.quoted.double.gunk",
+						"begin":    `"`,
+						"end":      `"`,
+						"patterns": list{object{"name": "constant.character.escape.gunk", "match": `\\.`}},
+					},
+					object{
+						"name":  "constant.numeric.gunk",
+						"match": `\b(0[xX][0-9a-fA-F_]+|[0-9][0-9_]*(\.[0-9_]*)?([eE][+-]?[0-9]+)?)\b`,
+					},
+					object{
+						"match": `\b([A-Za-z_][A-Za-z0-9_]*)(\.)([A-Za-z_][A-Za-z0-9_]*)\b`,
+						"captures": object{
+							"1": object{"name": "entity.name.namespace.gunk"},
+							"3": object{"name": "entity.name.type.gunk"},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func extensionManifest(version string) object {
+	return object{
+		"name":        "gunk",
+		"displayName": "Gunk",
+		"description": "Syntax highlighting for Gunk files",
+		"version":     strings.TrimPrefix(version, "v"),
+		"publisher":   "gunk",
+		"license":     "MIT",
+		"repository":  object{"type": "git", "url": "https://github.com/gunk/gunk"},
+		"engines":     object{"vscode": "^1.50.0"},
+		"categories":  list{"Programming Languages"},
+		"contributes": object{
+			"languages": list{object{
+				"id":            "gunk",
+				"aliases":       list{"Gunk", "gunk"},
+				"extensions":    list{".gunk"},
+				"configuration": "./language-configuration.json",
+			}},
+			"grammars": list{object{
+				"language":  "gunk",
+				"scopeName": "source.gunk",
+				"path":      "./syntaxes/gunk.tmLanguage.json",
+			}},
+		},
+	}
+}
+
+func languageConfiguration() object {
+	pairs := list{list{"{", "}"}, list{"[", "]"}, list{"(", ")"}}
+	return object{
+		"comments": object{
+			"lineComment":  "//",
+			"blockComment": list{"/*", "*/"},
+		},
+		"brackets": pairs,
+		"autoClosingPairs": list{
+			object{"open": "{", "close": "}"},
+			object{"open": "[", "close": "]"},
+			object{"open": "(", "close": ")"},
+			object{"open": `"`, "close": `"`, "notIn": list{"string", "comment"}},
+			object{"open": "`", "close": "`", "notIn": list{"string", "comment"}},
+		},
+		"surroundingPairs": pairs,
+	}
+}
+
+// treeSitterHighlights returns highlight queries for parsing Gunk files with
+// the tree-sitter-go grammar, which accepts all of the Gunk syntax.
+func treeSitterHighlights() string {
+	var sb strings.Builder
+	sb.WriteString("; Highlights for Gunk files parsed with tree-sitter-go.\n")
+	sb.WriteString("; Generated by \"gunk editor\"; do not edit.\n\n")
+	sb.WriteString("((comment) @attribute\n (#match? @attribute \"^//\\\\s*\\\\+gunk\\\\b\"))\n\n")
+	sb.WriteString("((comment) @keyword.directive\n (#match? @keyword.directive \"^//\\\\s*proto\\\\s+\\\"\"))\n\n")
+	fmt.Fprintf(&sb, "(field_declaration\n tag: (raw_string_literal) @attribute\n (#match? @attribute \"^`(%s):\"))\n\n", strings.Join(loader.StructTagKeys(), "|"))
+	typeNames, constNames := predeclared()
+	fmt.Fprintf(&sb, "((type_identifier) @type.builtin\n (#any-of? @type.builtin %s))\n\n", quoteAll(typeNames))
+	fmt.Fprintf(&sb, "((identifier) @constant.builtin\n (#any-of? @constant.builtin %s))\n", quoteAll(constNames))
+	return sb.String()
+}
+
+func quoteAll(ws []string) string {
+	quoted := make([]string, len(ws))
+	for i, w := range ws {
+		quoted[i] = fmt.Sprintf("%q", w)
+	}
+	return strings.Join(quoted, " ")
+}
@@ -8,10 +8,13 @@ import (
 	"go/parser"
 	"go/printer"
 	"go/token"
+	"go/types"
 	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"reflect"
+	"runtime"
 	"sort"
 	"strconv"
 	"strings"
@@ -19,14 +22,29 @@ import (
 	"github.com/gunk/gunk/config"
 	"github.com/gunk/gunk/loader"
 	"github.com/kenshaw/snaker"
+	"github.com/pkg/diff"
+	"golang.org/x/sync/errgroup"
 )
 
 // Formatter is a struct that holds the state of the formatter.
 // A new formatter should be initialized when using different config.
 type Formatter struct {
 	Config *config.Config
+	// AssignTags makes the formatter assign the numbers following the
+	// highest of a message's numbers to its fields without a pb tag,
+	// instead of the lowest free ones, so that the numbers of removed
+	// fields aren't reused.
+	AssignTags bool
 
 	snaker *snaker.Initialisms
+	// modPath is the path of the module of the files, whose imports are
+	// grouped after the others.
+	modPath string
+	// pkgNames are the names of the imported packages, by path.
+	pkgNames map[string]string
+	// pkgTypes are the types of the package of the files, used to
+	// normalize their +gunk tags. It is nil when formatting a single file.
+	pkgTypes *types.Package
 }
 
 // New creates a new instance of Formatter.
@@ -42,28 +60,53 @@ func New(cfg *config.Config) (*Formatter, error) {
 	}, nil
 }
 
+// Diff makes Run print unified diffs of the changes formatting would make to
+// standard output, instead of writing them. Run then fails if any file isn't
+// formatted.
+var Diff bool
+
+// List makes Run print the paths of the files which aren't formatted to
+// standard output, in order, instead of writing them. Run then fails if there
+// are any.
+var List bool
+
+// AssignTags makes Run assign new numbers to the fields without a pb tag, never
+// reusing the numbers below the highest one of their message. See
+// Formatter.AssignTags.
+var AssignTags bool
+
+// StdinFilename is the path of the file read from standard input, such as the
+// file of an editor's buffer. Its .gunkconfig is used to format it, and errors
+// and diffs are reported with its name. If set, Run reads standard input when
+// there are no arguments.
+var StdinFilename string
+
 // Run formats Gunk files to be canonically formatted.
 func Run(dir string, args ...string) error {
-	if len(args) == 1 && args[0] == "-" {
-		buf, err := io.ReadAll(os.Stdin)
+	if len(args) == 1 && args[0] == "-" || len(args) == 0 && StdinFilename != "" {
+		return formatStdin(os.Stdin, os.Stdout)
+	}
+	fset := token.NewFileSet()
+	// Packages in other modules are loaded from the root of their module.
+	roots, err := loader.SplitRoots(dir, args...)
+	if err != nil {
+		return err
+	}
+	var pkgs []*loader.GunkPackage
+	importers := make(map[*loader.GunkPackage]types.Importer)
+	for _, root := range roots {
+		l := loader.Loader{Dir: root.Dir, Fset: fset}
+		rootPkgs, err := l.Load(root.Patterns...)
 		if err != nil {
 			return fmt.Errorf("error on loading: %w", err)
 		}
-		src, err := Source(buf)
-		if err != nil {
-			return fmt.Errorf("error on formatting: %w", err)
+		pkgs = append(pkgs, rootPkgs...)
+		// The packages are type-checked separately, since they don't
+		// need to type-check to be formatted.
+		importer := &loader.Loader{Dir: root.Dir, Fset: fset, Types: true}
+		for _, pkg := range rootPkgs {
+			importers[pkg] = importer
 		}
-		_, err = os.Stdout.Write(src)
-		if err != nil {
-			return fmt.Errorf("error on writing: %w", err)
-		}
-		return nil
-	}
-	fset := token.NewFileSet()
-	l := loader.Loader{Dir: dir, Fset: fset}
-	pkgs, err := l.Load(args...)
-	if err != nil {
-		return fmt.Errorf("error on loading: %w", err)
 	}
 	if len(pkgs) == 0 {
 		return fmt.Errorf("no Gunk packages to format")
@@ -71,6 +114,11 @@ func Run(dir string, args ...string) error {
 	if loader.PrintErrors(pkgs) > 0 {
 		return fmt.Errorf("encountered package loading errors")
 	}
+	// Format the files in parallel, keeping the results in order so that
+	// the diffs are printed in a stable order.
+	var results []*fileResult
+	var wg errgroup.Group
+	sem := make(chan struct{}, maxConcurrentFiles)
 	for _, pkg := range pkgs {
 		cfg, err := config.Load(pkg.Dir)
 		if err != nil {
@@ -80,26 +128,163 @@ func Run(dir string, args ...string) error {
 		if err != nil {
 			return fmt.Errorf("unable to initialize formatter: %w", err)
 		}
-		for i, file := range pkg.GunkSyntax {
-			path := pkg.GunkFiles[i]
-			orig, err := ioutil.ReadFile(path)
-			if err != nil {
-				return fmt.Errorf("error on reading: %w", err)
+		f.AssignTags = AssignTags
+		f.modPath = loader.ModulePath(pkg.Dir)
+		f.pkgNames = make(map[string]string)
+		f.pkgTypes = checkTypes(fset, pkg, importers[pkg])
+		if f.pkgTypes != nil {
+			for _, imp := range f.pkgTypes.Imports() {
+				f.pkgNames[imp.Path()] = imp.Name()
 			}
-			got, err := f.formatFile(fset, file)
-			if err != nil {
-				return fmt.Errorf("error on formating: %w", err)
+		}
+		for i, file := range pkg.GunkSyntax {
+			r := &fileResult{path: pkg.GunkFiles[i]}
+			results = append(results, r)
+			file := file
+			wg.Go(func() error {
+				sem <- struct{}{}
+				defer func() { <-sem }()
+				return f.formatPath(fset, file, r)
+			})
+		}
+	}
+	if err := wg.Wait(); err != nil {
+		return err
+	}
+	var unformatted []*fileResult
+	for _, r := range results {
+		if (Diff || List) && !bytes.Equal(r.orig, r.got) {
+			unformatted = append(unformatted, r)
+		}
+	}
+	if List {
+		paths := make([]string, len(unformatted))
+		for i, r := range unformatted {
+			paths[i] = relPath(r.path)
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			fmt.Println(path)
+		}
+	}
+	if Diff {
+		for _, r := range unformatted {
+			if err := printDiff(os.Stdout, relPath(r.path), r.orig, r.got); err != nil {
+				return err
 			}
-			if !bytes.Equal(orig, got) {
-				if err := ioutil.WriteFile(path, got, 0o666); err != nil {
-					return fmt.Errorf("error on writing: %w", err)
-				}
+		}
+	}
+	if len(unformatted) > 0 {
+		return fmt.Errorf("%d Gunk files are not formatted", len(unformatted))
+	}
+	return nil
+}
+
+// maxConcurrentFiles is the number of files formatted at once.
+var maxConcurrentFiles = runtime.GOMAXPROCS(0)
+
+// fileResult is the result of formatting a file.
+type fileResult struct {
+	path string
+	orig []byte
+	got  []byte
+}
+
+// formatPath formats the syntax tree of the file at r.path, storing the
+// original and formatted contents in r. Unless Diff or List is set, the file
+// is written if its contents changed.
+func (f *Formatter) formatPath(fset *token.FileSet, file *ast.File, r *fileResult) error {
+	orig, err := ioutil.ReadFile(r.path)
+	if err != nil {
+		return fmt.Errorf("error on reading: %w", err)
+	}
+	got, err := f.formatFile(fset, file)
+	if err != nil {
+		return fmt.Errorf("error on formating: %w", err)
+	}
+	r.orig, r.got = orig, got
+	if Diff || List || bytes.Equal(orig, got) {
+		return nil
+	}
+	if err := ioutil.WriteFile(r.path, got, 0o666); err != nil {
+		return fmt.Errorf("error on writing: %w", err)
+	}
+	return nil
+}
+
+// formatStdin formats the Gunk file read from r, and writes it or its diff to
+// w.
+func formatStdin(r io.Reader, w io.Writer) error {
+	buf, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("error on loading: %w", err)
+	}
+	name, desc := "<standard input>", "standard input"
+	cfg, dir := &config.Config{}, ""
+	if StdinFilename != "" {
+		name, desc = StdinFilename, StdinFilename
+		abs, err := filepath.Abs(StdinFilename)
+		if err != nil {
+			return err
+		}
+		dir = filepath.Dir(abs)
+		if cfg, err = config.Load(dir); err != nil {
+			return fmt.Errorf("unable to load gunkconfig: %w", err)
+		}
+	}
+	f, err := New(cfg)
+	if err != nil {
+		return fmt.Errorf("unable to initialize formatter: %w", err)
+	}
+	f.AssignTags = AssignTags
+	if dir != "" {
+		f.modPath = loader.ModulePath(dir)
+	}
+	src, err := f.source(StdinFilename, buf)
+	if err != nil {
+		return fmt.Errorf("error on formatting: %w", err)
+	}
+	if Diff || List {
+		if bytes.Equal(buf, src) {
+			return nil
+		}
+		if List {
+			fmt.Fprintln(w, name)
+		}
+		if Diff {
+			if err := printDiff(w, name, buf, src); err != nil {
+				return err
 			}
 		}
+		return fmt.Errorf("%s is not formatted", desc)
+	}
+	if _, err := w.Write(src); err != nil {
+		return fmt.Errorf("error on writing: %w", err)
+	}
+	return nil
+}
+
+// printDiff writes the unified diff between the original and formatted
+// contents of a file to w, like git does.
+func printDiff(w io.Writer, path string, orig, formatted []byte) error {
+	path = filepath.ToSlash(path)
+	if err := diff.Text("a/"+path, "b/"+path, orig, formatted, w); err != nil {
+		return fmt.Errorf("error on writing diff: %w", err)
 	}
 	return nil
 }
 
+// relPath returns path relative to the current directory if it is within it,
+// as it is easier to read, and path otherwise.
+func relPath(path string) string {
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, path); err == nil && !strings.HasPrefix(rel, "..") {
+			return rel
+		}
+	}
+	return path
+}
+
 // Source canonically formats a single Gunk file, returning the result and any
 // error encountered.
 func Source(src []byte) ([]byte, error) {
@@ -113,8 +298,14 @@ func Source(src []byte) ([]byte, error) {
 // Source canonically formats a single Gunk file using the formatter's config,
 // returning the result and any error encountered.
 func (f *Formatter) Source(src []byte) ([]byte, error) {
+	return f.source("", src)
+}
+
+// source formats a single Gunk file, with the file name used in the positions
+// of errors.
+func (f *Formatter) source(filename string, src []byte) ([]byte, error) {
 	fset := token.NewFileSet()
-	file, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	file, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
 	if err != nil {
 		return nil, err
 	}
@@ -135,33 +326,142 @@ func (f *Formatter) formatFile(fset *token.FileSet, file *ast.File) (_ []byte, f
 			}
 		}
 	}()
+	// The numbers reserved by each message, parsed from their docs before
+	// the docs are formatted.
+	reserved := make(map[*ast.StructType]*loader.Reserved)
+	tags := newTagNormalizer(fset, f.pkgTypes, file, f.pkgNames)
 	ast.Inspect(file, func(node ast.Node) bool {
 		switch node := node.(type) {
 		case *ast.CommentGroup:
-			if err := f.formatComment(fset, node); err != nil {
+			if err := f.formatComment(fset, node, tags); err != nil {
 				panic(inspectError{err})
 			}
 		case *ast.StructType:
-			if err := f.formatStruct(fset, node); err != nil {
+			if err := f.formatStruct(fset, node, reserved[node]); err != nil {
 				panic(inspectError{err})
 			}
+		case *ast.GenDecl:
+			switch node.Tok {
+			case token.CONST:
+				formatConsts(node)
+			case token.TYPE:
+				if err := parseReserved(fset, node, reserved); err != nil {
+					panic(inspectError{err})
+				}
+			}
 		}
 		return true
 	})
+	src, err := printFile(fset, file)
+	if err != nil {
+		return nil, err
+	}
+	if src, err = sortImports(src, f.modPath, f.pkgNames); err != nil {
+		return nil, err
+	}
+	if width := f.Config.Format.CommentWidth; width > 0 {
+		return wrapComments(src, width)
+	}
+	return src, nil
+}
+
+// printFile prints a formatted Gunk file, keeping the +gunk tags of the doc
+// comments of the package and top-level declarations as they are. The printer
+// reformats those doc comments, and would indent a multi-line tag as a code
+// block, as its first line ends in a brace and the others are indented:
+//
+//	// +gunk http.Match{
+//	//         Method: "GET",
+//	// }
+func printFile(fset *token.FileSet, file *ast.File) ([]byte, error) {
+	tagDocs := make(map[int]string)
+	for i, doc := range topLevelDocs(file) {
+		if doc == nil || !strings.Contains(doc.Text(), "\n+gunk ") && !strings.HasPrefix(doc.Text(), "+gunk ") {
+			continue
+		}
+		lines := make([]string, len(doc.List))
+		for j, c := range doc.List {
+			lines[j] = strings.TrimRight(c.Text, " \t")
+		}
+		tagDocs[i] = strings.Join(lines, "\n")
+	}
 	var buf bytes.Buffer
 	if err := format.Node(&buf, fset, file); err != nil {
 		return nil, err
 	}
-	return buf.Bytes(), nil
+	if len(tagDocs) == 0 {
+		return buf.Bytes(), nil
+	}
+	// Replace the reformatted doc comments with the original ones, which
+	// are found in the same order in the printed file.
+	src := buf.Bytes()
+	printedFset := token.NewFileSet()
+	printed, err := parser.ParseFile(printedFset, "", src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	last := 0
+	for i, doc := range topLevelDocs(printed) {
+		text, ok := tagDocs[i]
+		if !ok || doc == nil {
+			continue
+		}
+		start, end := offset(printedFset, doc.Pos()), offset(printedFset, doc.End())
+		out.Write(src[last:start])
+		out.WriteString(text)
+		last = end
+	}
+	out.Write(src[last:])
+	return out.Bytes(), nil
 }
 
-func (f *Formatter) formatComment(fset *token.FileSet, group *ast.CommentGroup) error {
+// topLevelDocs returns the doc comments of the package clause and of each of
+// the file's declarations, which may be nil, in order.
+func topLevelDocs(file *ast.File) []*ast.CommentGroup {
+	docs := []*ast.CommentGroup{file.Doc}
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.GenDecl:
+			docs = append(docs, decl.Doc)
+		case *ast.FuncDecl:
+			docs = append(docs, decl.Doc)
+		}
+	}
+	return docs
+}
+
+// parseReserved adds the numbers reserved by the messages of a type
+// declaration to the reserved map.
+func parseReserved(fset *token.FileSet, gd *ast.GenDecl, reserved map[*ast.StructType]*loader.Reserved) error {
+	for _, spec := range gd.Specs {
+		ts := spec.(*ast.TypeSpec)
+		st, ok := ts.Type.(*ast.StructType)
+		if !ok {
+			continue
+		}
+		doc := ts.Doc
+		if doc == nil && len(gd.Specs) == 1 && !gd.Lparen.IsValid() {
+			doc = gd.Doc
+		}
+		r, err := loader.ParseReserved(doc.Text())
+		if err != nil {
+			return fmt.Errorf("%s: %v", fset.Position(doc.Pos()), err)
+		}
+		reserved[st] = r
+	}
+	return nil
+}
+
+// formatComment prints the +gunk tags of a comment group on their own lines
+// after its text, normalizing them if tags isn't nil.
+func (f *Formatter) formatComment(fset *token.FileSet, group *ast.CommentGroup, tags *tagNormalizer) error {
 	// Split the gunk tag ourselves, so we can support Source.
-	doc, tags, err := loader.SplitGunkTag(nil, fset, group)
+	doc, exprs, err := loader.SplitGunkTag(nil, fset, group)
 	if err != nil {
 		return err
 	}
-	if len(tags) == 0 {
+	if len(exprs) == 0 {
 		// no gunk tags
 		return nil
 	}
@@ -170,7 +470,7 @@ func (f *Formatter) formatComment(fset *token.FileSet, group *ast.CommentGroup)
 	if doc != "" {
 		doc += "\n\n"
 	}
-	for i, tag := range tags {
+	for i, tag := range exprs {
 		var buf bytes.Buffer
 		// Print with space indentation, since all comment lines begin
 		// with "// " and we don't want to mix spaces and tabs.
@@ -178,8 +478,14 @@ func (f *Formatter) formatComment(fset *token.FileSet, group *ast.CommentGroup)
 		if err := config.Fprint(&buf, fset, tag.Expr); err != nil {
 			return err
 		}
-		doc += "+gunk " + buf.String()
-		if i < len(tags)-1 {
+		text := buf.String()
+		if tags != nil {
+			if text, err = tags.normalize(text, &config); err != nil {
+				return err
+			}
+		}
+		doc += "+gunk " + text
+		if i < len(exprs)-1 {
 			doc += "\n"
 		}
 	}
@@ -187,44 +493,110 @@ func (f *Formatter) formatComment(fset *token.FileSet, group *ast.CommentGroup)
 	return nil
 }
 
-func (f *Formatter) formatStruct(fset *token.FileSet, st *ast.StructType) error {
+// formatConsts simplifies the enum values of a const block which repeat the
+// type and iota expression of the previous value, as Go repeats those
+// implicitly:
+//
+//	const (
+//		A Kind = iota
+//		B Kind = iota
+//	)
+//
+// becomes
+//
+//	const (
+//		A Kind = iota
+//		B
+//	)
+func formatConsts(gd *ast.GenDecl) {
+	var prevType, prevValues string
+	for _, spec := range gd.Specs {
+		vs := spec.(*ast.ValueSpec)
+		if len(vs.Values) == 0 {
+			// Already implicit.
+			continue
+		}
+		var typ string
+		if vs.Type != nil {
+			typ = types.ExprString(vs.Type)
+		}
+		values := make([]string, len(vs.Values))
+		for i, v := range vs.Values {
+			values[i] = types.ExprString(v)
+		}
+		joined := strings.Join(values, ", ")
+		if typ == prevType && joined == prevValues && usesIota(vs.Values) {
+			vs.Type = nil
+			vs.Values = nil
+			continue
+		}
+		prevType, prevValues = typ, joined
+	}
+}
+
+func usesIota(exprs []ast.Expr) bool {
+	found := false
+	for _, expr := range exprs {
+		ast.Inspect(expr, func(node ast.Node) bool {
+			if id, ok := node.(*ast.Ident); ok && id.Name == "iota" {
+				found = true
+			}
+			return !found
+		})
+	}
+	return found
+}
+
+func (f *Formatter) formatStruct(fset *token.FileSet, st *ast.StructType, reserved *loader.Reserved) error {
 	if st.Fields == nil {
 		return nil
 	}
-	// Figure out list of missing protobuf numbers.
-	missingNum := make([]int, 0, len(st.Fields.List))
-	if !f.Config.Format.PB { // Skip this if we are not going to use it anyways.
-		// Find all unusedFields.
-		unusedFields := make(map[int]bool, len(st.Fields.List))
-		for i := 1; i <= len(st.Fields.List); i++ {
-			unusedFields[i] = true
+	// Figure out the protobuf numbers to assign to the fields missing one,
+	// or to all fields if they are reordered, skipping the reserved ones.
+	usedNum := make(map[int]bool, len(st.Fields.List))
+	maxNum, missing := 0, 0
+	for _, field := range st.Fields.List {
+		if f.Config.Format.PB || field.Tag == nil {
+			missing++
+			continue
 		}
-		for _, field := range st.Fields.List {
-			if field.Tag == nil {
-				continue
-			}
-			tag, err := strconv.Unquote(field.Tag.Value)
-			if err != nil {
-				return err
-			}
-			pb, ok := reflect.StructTag(tag).Lookup("pb")
-			if !ok {
-				continue
-			}
-			pbNum, err := strconv.Atoi(pb)
-			if err != nil {
-				errorPos := fset.Position(field.Tag.Pos())
-				// TODO: Add the same error checking in generate. Or, look at factoring
-				// this code with the code in generate, they do very similar things?
-				return fmt.Errorf("%s: struct field tag for pb contains a non-number %q", errorPos, pb)
-			}
-			delete(unusedFields, pbNum)
+		tag, err := strconv.Unquote(field.Tag.Value)
+		if err != nil {
+			return err
+		}
+		pb, ok := reflect.StructTag(tag).Lookup("pb")
+		if !ok {
+			missing++
+			continue
+		}
+		pbNum, err := strconv.Atoi(pb)
+		if err != nil {
+			errorPos := fset.Position(field.Tag.Pos())
+			// TODO: Add the same error checking in generate. Or, look at factoring
+			// this code with the code in generate, they do very similar things?
+			return fmt.Errorf("%s: struct field tag for pb contains a non-number %q", errorPos, pb)
 		}
-		for k := range unusedFields {
-			missingNum = append(missingNum, k)
+		usedNum[pbNum] = true
+		if pbNum > maxNum {
+			maxNum = pbNum
 		}
-		sort.Ints(missingNum)
 	}
+	missingNum := make([]int, 0, missing)
+	n := 1
+	if f.AssignTags {
+		n = maxNum + 1
+	}
+	for ; len(missingNum) < missing && n <= loader.MaxFieldNumber; n++ {
+		if !usedNum[n] && !reserved.HasNumber(int32(n)) {
+			missingNum = append(missingNum, n)
+		}
+	}
+	if len(missingNum) < missing {
+		return fmt.Errorf("%s: no free field numbers left to assign", fset.Position(st.Pos()))
+	}
+	// The fields with tags and their tags' entries, to align them.
+	var tagged []*ast.Field
+	var tags [][]string
 	for i, field := range st.Fields.List {
 		var key []string
 		var value map[string]string
@@ -246,7 +618,7 @@ func (f *Formatter) formatStruct(fset *token.FileSet, st *ast.StructType) error
 		// Insert JSON and protobuf key.
 		entries := make([]string, 0, len(key))
 		if f.Config.Format.PB {
-			entries = append(entries, fmt.Sprintf("pb:%q", strconv.Itoa(i+1)))
+			entries = append(entries, fmt.Sprintf("pb:%q", strconv.Itoa(missingNum[i])))
 		} else if _, ok := value["pb"]; ok {
 			entries = append(entries, fmt.Sprintf("pb:%q", value["pb"]))
 		} else {
@@ -268,16 +640,45 @@ func (f *Formatter) formatStruct(fset *token.FileSet, st *ast.StructType) error
 			entries = append(entries, fmt.Sprintf("%s:%q", k, value[k]))
 		}
 		if len(entries) > 0 {
-			field.Tag = &ast.BasicLit{
-				ValuePos: field.Type.End() + 1,
-				Kind:     token.STRING,
-				Value:    "`" + strings.Join(entries, " ") + "`",
-			}
+			tagged = append(tagged, field)
+			tags = append(tags, entries)
+		}
+	}
+	if f.Config.Format.AlignTags {
+		alignTags(tags)
+	}
+	for i, field := range tagged {
+		field.Tag = &ast.BasicLit{
+			ValuePos: field.Type.End() + 1,
+			Kind:     token.STRING,
+			Value:    "`" + strings.Join(tags[i], " ") + "`",
 		}
 	}
 	return nil
 }
 
+// alignTags pads the first two entries of the tags of a message's fields,
+// which are their pb and json entries, so that the entries following them
+// start in the same column:
+//
+//	Text  string `pb:"1"  json:"text"`
+//	Count int    `pb:"10" json:"count"`
+func alignTags(tags [][]string) {
+	for col := 0; col < 2; col++ {
+		width := 0
+		for _, entries := range tags {
+			if len(entries) > col+1 && len(entries[col]) > width {
+				width = len(entries[col])
+			}
+		}
+		for _, entries := range tags {
+			if len(entries) > col+1 {
+				entries[col] += strings.Repeat(" ", width-len(entries[col]))
+			}
+		}
+	}
+}
+
 func parseTag(tag string) ([]string, map[string]string, error) {
 	keys := make([]string, 0)
 	values := make(map[string]string)
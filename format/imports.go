@@ -0,0 +1,216 @@
+package format
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gunk/gunk/loader"
+)
+
+// The groups of imports, in the order they are written in.
+const (
+	stdlibImports = iota
+	thirdPartyImports
+	moduleImports
+)
+
+// sortImports sorts the imports of a formatted Gunk file into groups separated
+// by blank lines, like goimports does: the standard library, then third-party
+// packages, then the packages of the module with the path modPath. Imports
+// which aren't used by the file's declarations or +gunk tags are removed.
+//
+// The names of the imported packages are looked up in pkgNames by path, and
+// guessed from the last element of the path for the imports not in it. The
+// imports with a name which can't be guessed are kept. Import declarations
+// with comments which aren't attached to an import are left as they are.
+func sortImports(src []byte, modPath string, pkgNames map[string]string) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	used, err := usedNames(fset, file)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	last := 0
+	for _, decl := range file.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.IMPORT {
+			continue
+		}
+		if hasFloatingComments(file, gd) {
+			continue
+		}
+		var groups [3][]*ast.ImportSpec
+		for _, spec := range gd.Specs {
+			is := spec.(*ast.ImportSpec)
+			ipath, err := strconv.Unquote(is.Path.Value)
+			if err != nil {
+				return nil, err
+			}
+			if !importUsed(is, ipath, used, pkgNames) {
+				continue
+			}
+			group := thirdPartyImports
+			switch {
+			case modPath != "" && (ipath == modPath || strings.HasPrefix(ipath, modPath+"/")):
+				group = moduleImports
+			case !strings.Contains(strings.SplitN(ipath, "/", 2)[0], "."):
+				group = stdlibImports
+			}
+			groups[group] = append(groups[group], is)
+		}
+		start, end := offset(fset, gd.Pos()), offset(fset, gd.End())
+		if gd.Doc != nil {
+			start = offset(fset, gd.Doc.Pos())
+		}
+		for _, spec := range gd.Specs {
+			// The line comment of an import without parentheses
+			// is after the end of its declaration.
+			if c := spec.(*ast.ImportSpec).Comment; c != nil && offset(fset, c.End()) > end {
+				end = offset(fset, c.End())
+			}
+		}
+		buf.Write(src[last:start])
+		last = end
+		n := len(groups[stdlibImports]) + len(groups[thirdPartyImports]) + len(groups[moduleImports])
+		if n == 0 {
+			// All of the imports are unused.
+			continue
+		}
+		if gd.Doc != nil {
+			buf.Write(src[start:offset(fset, gd.Pos())])
+		}
+		if n == 1 && !gd.Lparen.IsValid() {
+			buf.WriteString("import ")
+			buf.Write(src[offset(fset, gd.Specs[0].Pos()):end])
+			continue
+		}
+		buf.WriteString("import (\n")
+		sep := false
+		for _, group := range groups {
+			if len(group) == 0 {
+				continue
+			}
+			if sep {
+				buf.WriteString("\n")
+			}
+			sep = true
+			sort.SliceStable(group, func(i, j int) bool {
+				return importPath(group[i]) < importPath(group[j])
+			})
+			for _, is := range group {
+				specStart, specEnd := is.Pos(), is.End()
+				if is.Doc != nil {
+					specStart = is.Doc.Pos()
+				}
+				if is.Comment != nil {
+					specEnd = is.Comment.End()
+				}
+				buf.WriteString("\t")
+				buf.Write(src[offset(fset, specStart):offset(fset, specEnd)])
+				buf.WriteString("\n")
+			}
+		}
+		buf.WriteString(")")
+	}
+	buf.Write(src[last:])
+	sorted, err := parser.ParseFile(fset, "", buf.Bytes(), parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	return printFile(fset, sorted)
+}
+
+// usedNames returns the names of the packages used by the file's declarations
+// and +gunk tags.
+func usedNames(fset *token.FileSet, file *ast.File) (map[string]bool, error) {
+	used := make(map[string]bool)
+	addUses := func(node ast.Node) {
+		ast.Inspect(node, func(node ast.Node) bool {
+			if sel, ok := node.(*ast.SelectorExpr); ok {
+				if id, ok := sel.X.(*ast.Ident); ok {
+					used[id.Name] = true
+				}
+			}
+			return true
+		})
+	}
+	for _, decl := range file.Decls {
+		addUses(decl)
+	}
+	for _, group := range file.Comments {
+		_, tags, err := loader.SplitGunkTag(nil, fset, group)
+		if err != nil {
+			return nil, err
+		}
+		for _, tag := range tags {
+			addUses(tag.Expr)
+		}
+	}
+	return used, nil
+}
+
+// importUsed reports whether an import is used, or its name is unknown.
+// Blank and dot imports are always kept.
+func importUsed(is *ast.ImportSpec, ipath string, used map[string]bool, pkgNames map[string]string) bool {
+	name := ""
+	if is.Name != nil {
+		name = is.Name.Name
+	} else if n, ok := pkgNames[ipath]; ok {
+		name = n
+	} else {
+		name = guessName(ipath)
+	}
+	if name == "" || name == "_" || name == "." {
+		return true
+	}
+	return used[name]
+}
+
+// guessName guesses the name of a package from its import path, skipping
+// major version suffixes such as "/v2", or returns "" if it can't be guessed.
+func guessName(ipath string) string {
+	name := path.Base(ipath)
+	if len(name) > 1 && name[0] == 'v' && strings.Trim(name[1:], "0123456789") == "" {
+		name = path.Base(path.Dir(ipath))
+	}
+	if !token.IsIdentifier(name) {
+		return ""
+	}
+	return name
+}
+
+// hasFloatingComments reports whether an import declaration contains comments
+// which aren't attached to any of its imports.
+func hasFloatingComments(file *ast.File, gd *ast.GenDecl) bool {
+	attached := make(map[*ast.CommentGroup]bool)
+	for _, spec := range gd.Specs {
+		is := spec.(*ast.ImportSpec)
+		attached[is.Doc] = true
+		attached[is.Comment] = true
+	}
+	for _, group := range file.Comments {
+		if group.Pos() > gd.Pos() && group.End() < gd.End() && !attached[group] {
+			return true
+		}
+	}
+	return false
+}
+
+func importPath(is *ast.ImportSpec) string {
+	p, _ := strconv.Unquote(is.Path.Value)
+	return p
+}
+
+func offset(fset *token.FileSet, pos token.Pos) int {
+	return fset.Position(pos).Offset
+}
@@ -0,0 +1,226 @@
+package format
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"go/types"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gunk/gunk/loader"
+)
+
+// tagNormalizer rewrites the equivalent spellings of +gunk tags into a
+// canonical one, using the types of the package of a file:
+//
+//   - the types of composite literals elided in slices, arrays and maps are
+//     written out with their package selectors, such as
+//     []http.Match{http.Match{...}} instead of []http.Match{{...}};
+//   - the fields of struct literals are ordered like in their struct type,
+//     which follows the order of the fields of the option message.
+type tagNormalizer struct {
+	fset *token.FileSet
+	pkg  *types.Package
+	// pos is a position within the file, for the scope of its imports.
+	pos token.Pos
+	// names are the names of the file's imports, by path.
+	names map[string]string
+}
+
+// checkTypes type-checks a package to normalize the +gunk tags of its files,
+// importing its dependencies with importer. It returns nil if the package
+// doesn't type-check, as formatting doesn't require it to, or if it has no
+// tags, as loading its dependencies would be wasted.
+func checkTypes(fset *token.FileSet, pkg *loader.GunkPackage, importer types.Importer) *types.Package {
+	if !hasGunkTags(pkg) {
+		return nil
+	}
+	conf := types.Config{
+		DisableUnusedImportCheck: true,
+		Importer:                 importer,
+		Error:                    func(error) {},
+	}
+	tpkg, err := conf.Check(pkg.PkgPath, fset, pkg.GunkSyntax, nil)
+	if err != nil {
+		return nil
+	}
+	return tpkg
+}
+
+func hasGunkTags(pkg *loader.GunkPackage) bool {
+	for _, file := range pkg.GunkSyntax {
+		for _, group := range file.Comments {
+			for _, c := range group.List {
+				if strings.Contains(c.Text, "+gunk ") {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// typesMu serializes the type-checking of tags, as the files of a package
+// are formatted in parallel and share its types.
+var typesMu sync.Mutex
+
+// newTagNormalizer returns the normalizer of the tags of a file of the
+// package, or nil if the package wasn't type-checked, such as for a file read
+// from standard input.
+func newTagNormalizer(fset *token.FileSet, pkg *types.Package, file *ast.File, pkgNames map[string]string) *tagNormalizer {
+	if pkg == nil {
+		return nil
+	}
+	n := &tagNormalizer{fset: fset, pkg: pkg, pos: file.Package, names: make(map[string]string)}
+	for _, is := range file.Imports {
+		path, err := strconv.Unquote(is.Path.Value)
+		if err != nil {
+			continue
+		}
+		switch {
+		case is.Name == nil:
+			if name, ok := pkgNames[path]; ok {
+				n.names[path] = name
+			}
+		case is.Name.Name != "_" && is.Name.Name != ".":
+			n.names[path] = is.Name.Name
+		}
+	}
+	return n
+}
+
+// normalize returns the canonical form of the printed tag expression src,
+// printed with config. Tags which can't be type-checked are kept as they are.
+func (n *tagNormalizer) normalize(src string, config *printer.Config) (string, error) {
+	orig := src
+	// Each pass rewrites a single composite literal, since the positions
+	// of the others change.
+	for {
+		expr, err := parser.ParseExprFrom(n.fset, "", src, 0)
+		if err != nil {
+			return orig, nil
+		}
+		info := &types.Info{Types: make(map[ast.Expr]types.TypeAndValue)}
+		typesMu.Lock()
+		err = types.CheckExpr(n.fset, n.pkg, n.pos, expr, info)
+		typesMu.Unlock()
+		if err != nil {
+			return orig, nil
+		}
+		start, end, repl, ok := n.nextEdit(src, expr, info)
+		if !ok {
+			if src == orig {
+				return src, nil
+			}
+			// Print the rewritten expression again, to indent it.
+			var buf bytes.Buffer
+			if err := config.Fprint(&buf, n.fset, expr); err != nil {
+				return "", err
+			}
+			return buf.String(), nil
+		}
+		file := n.fset.File(expr.Pos())
+		src = src[:file.Offset(start)] + repl + src[file.Offset(end):]
+	}
+}
+
+// nextEdit returns the next rewrite of the tag expression parsed from src,
+// replacing the source between start and end with repl, if any.
+func (n *tagNormalizer) nextEdit(src string, expr ast.Expr, info *types.Info) (start, end token.Pos, repl string, ok bool) {
+	ast.Inspect(expr, func(node ast.Node) bool {
+		lit, isLit := node.(*ast.CompositeLit)
+		if ok || !isLit {
+			return !ok
+		}
+		typ := info.Types[lit].Type
+		if typ == nil {
+			return true
+		}
+		switch u := typ.Underlying().(type) {
+		case *types.Struct:
+			start, end, repl, ok = n.orderFields(src, lit, u)
+		case *types.Slice:
+			start, end, repl, ok = n.elidedType(lit, u.Elem())
+		case *types.Array:
+			start, end, repl, ok = n.elidedType(lit, u.Elem())
+		case *types.Map:
+			start, end, repl, ok = n.elidedType(lit, u.Elem())
+		}
+		return !ok
+	})
+	return start, end, repl, ok
+}
+
+// orderFields orders the fields of a struct literal like in its type,
+// keeping it on a single line or one field per line.
+func (n *tagNormalizer) orderFields(src string, lit *ast.CompositeLit, st *types.Struct) (start, end token.Pos, repl string, ok bool) {
+	index := make(map[string]int, st.NumFields())
+	for i := 0; i < st.NumFields(); i++ {
+		index[st.Field(i).Name()] = i
+	}
+	elts := make([]ast.Expr, len(lit.Elts))
+	copy(elts, lit.Elts)
+	for _, elt := range elts {
+		kv, isKV := elt.(*ast.KeyValueExpr)
+		if !isKV {
+			return 0, 0, "", false
+		}
+		if _, isIdent := kv.Key.(*ast.Ident); !isIdent {
+			return 0, 0, "", false
+		}
+	}
+	fieldIndex := func(e ast.Expr) int {
+		return index[e.(*ast.KeyValueExpr).Key.(*ast.Ident).Name]
+	}
+	if sort.SliceIsSorted(elts, func(i, j int) bool { return fieldIndex(elts[i]) < fieldIndex(elts[j]) }) {
+		return 0, 0, "", false
+	}
+	sort.SliceStable(elts, func(i, j int) bool { return fieldIndex(elts[i]) < fieldIndex(elts[j]) })
+	file := n.fset.File(lit.Pos())
+	fields := make([]string, len(elts))
+	for i, elt := range elts {
+		fields[i] = src[file.Offset(elt.Pos()):file.Offset(elt.End())]
+	}
+	if file.Line(lit.Lbrace) == file.Line(lit.Rbrace) {
+		repl = "{" + strings.Join(fields, ", ") + "}"
+	} else {
+		repl = "{\n" + strings.Join(fields, ",\n") + ",\n}"
+	}
+	return lit.Lbrace, lit.Rbrace + 1, repl, true
+}
+
+// elidedType writes out the elided type of the first element or value of a
+// slice, array or map literal which has one, if its type can be written with
+// the file's imports.
+func (n *tagNormalizer) elidedType(lit *ast.CompositeLit, elem types.Type) (start, end token.Pos, repl string, ok bool) {
+	prefix := ""
+	if ptr, isPtr := elem.(*types.Pointer); isPtr {
+		prefix, elem = "&", ptr.Elem()
+	}
+	named, isNamed := elem.(*types.Named)
+	if !isNamed {
+		return 0, 0, "", false
+	}
+	name := named.Obj().Name()
+	if pkg := named.Obj().Pkg(); pkg != nil && pkg != n.pkg {
+		local, imported := n.names[pkg.Path()]
+		if !imported {
+			return 0, 0, "", false
+		}
+		name = local + "." + name
+	}
+	for _, elt := range lit.Elts {
+		if kv, isKV := elt.(*ast.KeyValueExpr); isKV {
+			elt = kv.Value
+		}
+		if elided, isLit := elt.(*ast.CompositeLit); isLit && elided.Type == nil {
+			return elided.Lbrace, elided.Lbrace, prefix + name, true
+		}
+	}
+	return 0, 0, "", false
+}
@@ -0,0 +1,151 @@
+package format
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"regexp"
+	"strings"
+)
+
+var (
+	// listItem matches the first line of an item of an unindented list,
+	// such as "- item" or "1. item".
+	listItem = regexp.MustCompile(`^([-*+•]|[0-9]+[.)])( |$)`)
+	// annotation matches the lines of annotations, such as
+	// "Stability: beta" or "Cache-Control: no-store", which must stay on
+	// their own lines.
+	annotation = regexp.MustCompile(`^[A-Z][A-Za-z0-9-]*:( |$)`)
+	// lineStart matches the words which may not begin a wrapped line, as
+	// the line would then be read as a list item, heading or annotation.
+	lineStart = regexp.MustCompile(`^([-*+•#]|[0-9]+[.)]|[A-Z][A-Za-z0-9-]*:)$`)
+)
+
+// wrapComments reflows the doc comments of a formatted Gunk file to the
+// column width, counting tabs as 8 columns like in +gunk tags. Line comments
+// and comments which aren't attached to a declaration are kept as they are.
+func wrapComments(src []byte, width int) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	docs := make(map[*ast.CommentGroup]bool)
+	ast.Inspect(file, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.File:
+			docs[node.Doc] = true
+		case *ast.GenDecl:
+			docs[node.Doc] = true
+		case *ast.FuncDecl:
+			docs[node.Doc] = true
+		case *ast.TypeSpec:
+			docs[node.Doc] = true
+		case *ast.ValueSpec:
+			docs[node.Doc] = true
+		case *ast.ImportSpec:
+			docs[node.Doc] = true
+		case *ast.Field:
+			docs[node.Doc] = true
+		}
+		return true
+	})
+	var buf bytes.Buffer
+	last := 0
+	for _, group := range file.Comments {
+		if !docs[group] || !strings.HasPrefix(group.List[0].Text, "//") {
+			continue
+		}
+		start, end := offset(fset, group.Pos()), offset(fset, group.End())
+		indent := string(src[bytes.LastIndexByte(src[:start], '\n')+1 : start])
+		if strings.Trim(indent, "\t") != "" {
+			// Not at the start of its line.
+			continue
+		}
+		text := strings.TrimRight(group.Text(), "\n")
+		wrapped := wrapDoc(text, width-len(indent)*8-len("// "))
+		if wrapped == text {
+			continue
+		}
+		lines := strings.Split(wrapped, "\n")
+		for i, line := range lines {
+			switch {
+			case line == "" || line[0] == '\t':
+				// Like gofmt, don't add a space before code
+				// blocks, nor after blank lines.
+				lines[i] = "//" + line
+			default:
+				lines[i] = "// " + line
+			}
+		}
+		buf.Write(src[last:start])
+		buf.WriteString(strings.Join(lines, "\n"+indent))
+		last = end
+	}
+	buf.Write(src[last:])
+	return buf.Bytes(), nil
+}
+
+// wrapDoc reflows the paragraphs of the text of a doc comment so that its
+// lines are at most width long, unless they have a longer word. Indented
+// lines, such as code blocks, lists, headings, annotations and +gunk tags are
+// kept as they are.
+func wrapDoc(text string, width int) string {
+	lines := strings.Split(text, "\n")
+	var out, para []string
+	flush := func() {
+		if len(para) > 0 {
+			out = append(out, wrapWords(strings.Fields(strings.Join(para, " ")), width)...)
+			para = nil
+		}
+	}
+	inList := false
+	for i, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "+gunk "):
+			// The tags are at the end of the comment.
+			flush()
+			return strings.Join(append(out, lines[i:]...), "\n")
+		case strings.TrimSpace(line) == "":
+			flush()
+			inList = false
+			out = append(out, line)
+		case inList || listItem.MatchString(line):
+			// The lines of a list are kept, up to the next blank
+			// line.
+			flush()
+			inList = true
+			out = append(out, line)
+		case line[0] == ' ' || line[0] == '\t' || line[0] == '#' || annotation.MatchString(line):
+			flush()
+			out = append(out, line)
+		default:
+			para = append(para, line)
+		}
+	}
+	flush()
+	return strings.Join(out, "\n")
+}
+
+// wrapWords joins the words into lines at most width long, unless a word is
+// longer.
+func wrapWords(words []string, width int) []string {
+	var lines []string
+	line := ""
+	for _, w := range words {
+		switch {
+		case line == "":
+			line = w
+		case len(line)+1+len(w) <= width || lineStart.MatchString(w):
+			line += " " + w
+		default:
+			lines = append(lines, line)
+			line = w
+		}
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
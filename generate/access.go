@@ -0,0 +1,302 @@
+package generate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/gunk/gunk/assets/access"
+	"github.com/gunk/gunk/config"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+// docList returns the comma-separated values of the lines of a declaration's
+// documentation which start with key, such as:
+//
+//	Roles: admin, support
+//
+// The annotations are kept in the documentation, like the stability ones.
+func docList(text, key string) ([]string, error) {
+	var values []string
+	for _, line := range strings.Split(text, "\n") {
+		if !strings.HasPrefix(line, key+":") {
+			continue
+		}
+		before := len(values)
+		for _, v := range strings.Split(strings.TrimPrefix(line, key+":"), ",") {
+			v = strings.TrimSpace(v)
+			if v == "" {
+				continue
+			}
+			if strings.ContainsAny(v, " \t") {
+				return nil, fmt.Errorf("invalid %s annotation %q, values must be separated by commas", key, v)
+			}
+			values = append(values, v)
+		}
+		if len(values) == before {
+			return nil, fmt.Errorf("empty %s annotation", key)
+		}
+	}
+	return values, nil
+}
+
+// setMethodAccess sets the access option of a method from its Roles and
+// Permissions annotations, if it has any.
+func (g *Generator) setMethodAccess(o *descriptorpb.MethodOptions, text string) error {
+	roles, err := docList(text, "Roles")
+	if err != nil {
+		return err
+	}
+	permissions, err := docList(text, "Permissions")
+	if err != nil {
+		return err
+	}
+	if len(roles) == 0 && len(permissions) == 0 {
+		return nil
+	}
+	proto.SetExtension(o, access.E_Method, &access.MethodAccess{
+		Roles:       roles,
+		Permissions: permissions,
+	})
+	g.addProtoDep("gunk/access.proto")
+	return nil
+}
+
+// setFieldAccess sets the access option of a field from its Read-Roles and
+// Write-Roles annotations, if it has any.
+func (g *Generator) setFieldAccess(o *descriptorpb.FieldOptions, text string) error {
+	readRoles, err := docList(text, "Read-Roles")
+	if err != nil {
+		return err
+	}
+	writeRoles, err := docList(text, "Write-Roles")
+	if err != nil {
+		return err
+	}
+	if len(readRoles) == 0 && len(writeRoles) == 0 {
+		return nil
+	}
+	proto.SetExtension(o, access.E_Field, &access.FieldAccess{
+		ReadRoles:  readRoles,
+		WriteRoles: writeRoles,
+	})
+	g.addProtoDep("gunk/access.proto")
+	return nil
+}
+
+// accessData is the OPA data document written by the access generator.
+type accessData struct {
+	// Methods are keyed by their full gRPC method names, such as
+	// "/util.Util/Echo".
+	Methods map[string]*access.MethodAccess `json:"methods"`
+	// Fields are keyed by the full name of their message, and then by
+	// their name.
+	Fields map[string]map[string]*access.FieldAccess `json:"fields"`
+}
+
+// generateAccess writes the access control annotations of the package
+// requested in the CodeGeneratorRequest, for use by policy engines. The
+// "format" parameter selects an OPA data document, named like "foo.access.json"
+// (the default), or a Cedar schema and policies, named like
+// "foo.cedarschema.json" and "foo.cedar".
+func (g *Generator) generateAccess(req *pluginpb.CodeGeneratorRequest, gen config.Generator) error {
+	format, _ := gen.GetParam("format")
+	switch format {
+	case "", "opa", "cedar":
+	default:
+		return fmt.Errorf("unknown access format %q; must be opa or cedar", format)
+	}
+	ftgs := req.GetFileToGenerate()
+	if len(ftgs) == 0 {
+		return fmt.Errorf("no files to generate")
+	}
+	mainPkgPath := filepath.Clean(filepath.Dir(ftgs[0]))
+	mainPkg, ok := g.gunkPkgs[mainPkgPath]
+	if !ok {
+		return fmt.Errorf("failed to get main package: %s", mainPkgPath)
+	}
+	isTarget := make(map[string]bool, len(ftgs))
+	for _, name := range ftgs {
+		isTarget[name] = true
+	}
+	var files []*descriptorpb.FileDescriptorProto
+	for _, pfile := range req.ProtoFile {
+		if isTarget[pfile.GetName()] {
+			files = append(files, pfile)
+		}
+	}
+	dir, err := outPath(gen, mainPkg.Dir, mainPkg.Name)
+	if err != nil {
+		return fmt.Errorf("unable to build output path for %q: %w", mainPkg.Dir, err)
+	}
+	if err := mkdirAll(dir); err != nil {
+		return fmt.Errorf("unable to create directory %q: %w", dir, err)
+	}
+	name := filepath.Join(dir, mainPkg.Name)
+	if format == "cedar" {
+		schema, policies, err := cedarAccess(files)
+		if err != nil {
+			return err
+		}
+		if err := g.writePkgFile(mainPkgPath, name+".cedarschema.json", schema); err != nil {
+			return err
+		}
+		return g.writePkgFile(mainPkgPath, name+".cedar", policies)
+	}
+	data := accessData{
+		Methods: make(map[string]*access.MethodAccess),
+		Fields:  make(map[string]map[string]*access.FieldAccess),
+	}
+	for _, pfile := range files {
+		for _, srv := range pfile.GetService() {
+			for _, method := range srv.GetMethod() {
+				if a := methodAccess(method); a != nil {
+					data.Methods[fmt.Sprintf("/%s.%s/%s", pfile.GetPackage(), srv.GetName(), method.GetName())] = a
+				}
+			}
+		}
+		forEachMessage(pfile.GetPackage(), pfile.GetMessageType(), func(msgName string, field *descriptorpb.FieldDescriptorProto) {
+			a := fieldAccess(field)
+			if a == nil {
+				return
+			}
+			if data.Fields[msgName] == nil {
+				data.Fields[msgName] = make(map[string]*access.FieldAccess)
+			}
+			data.Fields[msgName][field.GetName()] = a
+		})
+	}
+	buf, err := json.MarshalIndent(data, "", "\t")
+	if err != nil {
+		return err
+	}
+	return g.writePkgFile(mainPkgPath, name+".access.json", append(buf, '\n'))
+}
+
+// cedarAccess returns a Cedar schema, in its JSON format, and the Cedar
+// policies for the access control annotations of the files. Methods are
+// actions named like "Util/Echo" on a Service, and field restrictions are
+// actions named like "Message.Text/read" on a Message. Users are principals
+// which are members of roles and permissions.
+func cedarAccess(files []*descriptorpb.FileDescriptorProto) (schema, policies []byte, err error) {
+	type appliesTo struct {
+		PrincipalTypes []string `json:"principalTypes"`
+		ResourceTypes  []string `json:"resourceTypes"`
+	}
+	type action struct {
+		AppliesTo appliesTo `json:"appliesTo"`
+	}
+	type entityType struct {
+		MemberOfTypes []string `json:"memberOfTypes,omitempty"`
+	}
+	type namespace struct {
+		EntityTypes map[string]entityType `json:"entityTypes"`
+		Actions     map[string]action     `json:"actions"`
+	}
+	namespaces := make(map[string]*namespace)
+	var buf bytes.Buffer
+	permit := func(ns, name string, roles, permissions []string) {
+		var conds []string
+		if len(roles) > 0 {
+			var alts []string
+			for _, role := range roles {
+				alts = append(alts, fmt.Sprintf("principal in %s::Role::%q", ns, role))
+			}
+			cond := strings.Join(alts, " || ")
+			if len(alts) > 1 && len(permissions) > 0 {
+				cond = "(" + cond + ")"
+			}
+			conds = append(conds, cond)
+		}
+		for _, perm := range permissions {
+			conds = append(conds, fmt.Sprintf("principal in %s::Permission::%q", ns, perm))
+		}
+		fmt.Fprintf(&buf, "permit (\n    principal,\n    action == %s::Action::%q,\n    resource\n)\nwhen { %s };\n\n",
+			ns, name, strings.Join(conds, " && "))
+	}
+	for _, pfile := range files {
+		ns := strings.ReplaceAll(pfile.GetPackage(), ".", "::")
+		n := namespaces[ns]
+		if n == nil {
+			n = &namespace{
+				EntityTypes: map[string]entityType{
+					"User":       {MemberOfTypes: []string{"Role", "Permission"}},
+					"Role":       {},
+					"Permission": {},
+					"Service":    {},
+					"Message":    {},
+				},
+				Actions: make(map[string]action),
+			}
+			namespaces[ns] = n
+		}
+		for _, srv := range pfile.GetService() {
+			for _, method := range srv.GetMethod() {
+				a := methodAccess(method)
+				if a == nil {
+					continue
+				}
+				name := srv.GetName() + "/" + method.GetName()
+				n.Actions[name] = action{appliesTo{[]string{"User"}, []string{"Service"}}}
+				permit(ns, name, a.GetRoles(), a.GetPermissions())
+			}
+		}
+		forEachMessage("", pfile.GetMessageType(), func(msgName string, field *descriptorpb.FieldDescriptorProto) {
+			a := fieldAccess(field)
+			if a == nil {
+				return
+			}
+			for _, op := range []struct {
+				name  string
+				roles []string
+			}{{"read", a.GetReadRoles()}, {"write", a.GetWriteRoles()}} {
+				if len(op.roles) == 0 {
+					continue
+				}
+				name := msgName + "." + field.GetName() + "/" + op.name
+				n.Actions[name] = action{appliesTo{[]string{"User"}, []string{"Message"}}}
+				permit(ns, name, op.roles, nil)
+			}
+		})
+	}
+	schema, err = json.MarshalIndent(namespaces, "", "\t")
+	if err != nil {
+		return nil, nil, err
+	}
+	return append(schema, '\n'), buf.Bytes(), nil
+}
+
+// forEachMessage calls fn for each field of the messages, including nested
+// ones, with the full name of the field's message relative to prefix.
+func forEachMessage(prefix string, msgs []*descriptorpb.DescriptorProto, fn func(msgName string, field *descriptorpb.FieldDescriptorProto)) {
+	for _, msg := range msgs {
+		name := msg.GetName()
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		for _, field := range msg.GetField() {
+			fn(name, field)
+		}
+		forEachMessage(name, msg.GetNestedType(), fn)
+	}
+}
+
+func methodAccess(method *descriptorpb.MethodDescriptorProto) *access.MethodAccess {
+	if method.GetOptions() == nil {
+		return nil
+	}
+	a, _ := proto.GetExtension(method.GetOptions(), access.E_Method).(*access.MethodAccess)
+	return a
+}
+
+func fieldAccess(field *descriptorpb.FieldDescriptorProto) *access.FieldAccess {
+	if field.GetOptions() == nil {
+		return nil
+	}
+	a, _ := proto.GetExtension(field.GetOptions(), access.E_Field).(*access.FieldAccess)
+	return a
+}
@@ -0,0 +1,79 @@
+package generate
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/gunk/gunk/config"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+// Field numbers of buf's image format, from buf/alpha/image/v1/image.proto.
+// An image is wire-compatible with a FileDescriptorSet, where each file has an
+// extra ImageFileExtension field.
+const (
+	bufImageFileExtension  = 8042 // ImageFile.buf_extension
+	bufIsImport            = 1    // ImageFileExtension.is_import
+	bufIsSyntaxUnspecified = 3    // ImageFileExtension.is_syntax_unspecified
+)
+
+// generateBufImage writes the package requested in the CodeGeneratorRequest,
+// including all of its imports, as a buf image named after the package, such
+// as "foo.image.bin". It can be used as an input of buf commands such as
+// "buf breaking" and "buf lint".
+func (g *Generator) generateBufImage(req *pluginpb.CodeGeneratorRequest, gen config.Generator) error {
+	ftgs := req.GetFileToGenerate()
+	if len(ftgs) == 0 {
+		return fmt.Errorf("no files to generate")
+	}
+	mainPkgPath := filepath.Clean(filepath.Dir(ftgs[0]))
+	mainPkg, ok := g.gunkPkgs[mainPkgPath]
+	if !ok {
+		return fmt.Errorf("failed to get main package: %s", mainPkgPath)
+	}
+	buf, err := bufImage(includeImports(req), ftgs)
+	if err != nil {
+		return err
+	}
+	dir, err := outPath(gen, mainPkg.Dir, mainPkg.Name)
+	if err != nil {
+		return fmt.Errorf("unable to build output path for %q: %w", mainPkg.Dir, err)
+	}
+	if err := mkdirAll(dir); err != nil {
+		return fmt.Errorf("unable to create directory %q: %w", dir, err)
+	}
+	return g.writePkgFile(mainPkgPath, filepath.Join(dir, mainPkg.Name+".image.bin"), buf)
+}
+
+// bufImage encodes the files as a buf image, marking the files which aren't
+// targets as imports.
+func bufImage(files []*descriptorpb.FileDescriptorProto, targets []string) ([]byte, error) {
+	isTarget := make(map[string]bool, len(targets))
+	for _, name := range targets {
+		isTarget[name] = true
+	}
+	var b []byte
+	for _, pfile := range files {
+		fb, err := proto.MarshalOptions{Deterministic: true}.Marshal(pfile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot marshal %s: %w", pfile.GetName(), err)
+		}
+		var ext []byte
+		if !isTarget[pfile.GetName()] {
+			ext = protowire.AppendTag(ext, bufIsImport, protowire.VarintType)
+			ext = protowire.AppendVarint(ext, 1)
+		}
+		if pfile.Syntax == nil {
+			ext = protowire.AppendTag(ext, bufIsSyntaxUnspecified, protowire.VarintType)
+			ext = protowire.AppendVarint(ext, 1)
+		}
+		fb = protowire.AppendTag(fb, bufImageFileExtension, protowire.BytesType)
+		fb = protowire.AppendBytes(fb, ext)
+		b = protowire.AppendTag(b, 1, protowire.BytesType) // Image.file
+		b = protowire.AppendBytes(b, fb)
+	}
+	return b, nil
+}
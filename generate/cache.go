@@ -0,0 +1,145 @@
+package generate
+
+import (
+	"fmt"
+	"net/textproto"
+	"strconv"
+	"strings"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/protoc-gen-openapiv2/options"
+	"github.com/gunk/gunk/assets/cache"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// splitCache parses the caching annotations of a method from its
+// documentation, such as:
+//
+//	Cache-Control: public, max-age=300
+//	Vary: Accept-Language
+//
+// It returns nil if the method has no Cache-Control annotation. The
+// annotations are kept in the documentation, like the stability ones.
+func splitCache(text string) (*cache.Cache, error) {
+	var c *cache.Cache
+	var vary []string
+	for _, line := range strings.Split(text, "\n") {
+		switch {
+		case strings.HasPrefix(line, "Cache-Control:"):
+			if c != nil {
+				return nil, fmt.Errorf("multiple Cache-Control annotations")
+			}
+			var err error
+			if c, err = parseCacheControl(strings.TrimPrefix(line, "Cache-Control:")); err != nil {
+				return nil, err
+			}
+		case strings.HasPrefix(line, "Vary:"):
+			for _, h := range strings.Split(strings.TrimPrefix(line, "Vary:"), ",") {
+				if h = strings.TrimSpace(h); h != "" {
+					vary = append(vary, textproto.CanonicalMIMEHeaderKey(h))
+				}
+			}
+		}
+	}
+	if c == nil {
+		if len(vary) > 0 {
+			return nil, fmt.Errorf("Vary annotation without a Cache-Control annotation")
+		}
+		return nil, nil
+	}
+	c.Vary = vary
+	return c, nil
+}
+
+// parseCacheControl parses the directives of a Cache-Control annotation,
+// normalizing them.
+func parseCacheControl(value string) (*cache.Cache, error) {
+	c := &cache.Cache{}
+	var directives []string
+	for _, d := range strings.Split(value, ",") {
+		d = strings.ToLower(strings.TrimSpace(d))
+		if d == "" {
+			continue
+		}
+		name, arg := d, ""
+		hasArg := false
+		if i := strings.Index(d, "="); i >= 0 {
+			name, arg, hasArg = d[:i], d[i+1:], true
+		}
+		switch name {
+		case "public", "private", "no-cache", "no-store", "must-revalidate", "proxy-revalidate", "no-transform", "immutable":
+			if hasArg {
+				return nil, fmt.Errorf("Cache-Control directive %s takes no value", name)
+			}
+		case "max-age", "s-maxage", "stale-while-revalidate", "stale-if-error":
+			secs, err := strconv.ParseUint(arg, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("Cache-Control directive %s must be a number of seconds", name)
+			}
+			if name == "max-age" {
+				c.MaxAge = uint32(secs)
+			}
+		default:
+			return nil, fmt.Errorf("unknown Cache-Control directive %q", name)
+		}
+		switch name {
+		case "public":
+			c.Public = true
+		case "private":
+			c.Private = true
+		case "no-store":
+			c.NoStore = true
+		}
+		directives = append(directives, d)
+	}
+	if len(directives) == 0 {
+		return nil, fmt.Errorf("empty Cache-Control annotation")
+	}
+	if c.Public && c.Private {
+		return nil, fmt.Errorf("Cache-Control cannot be both public and private")
+	}
+	c.CacheControl = strings.Join(directives, ", ")
+	return c, nil
+}
+
+// setCacheOptions sets the cache option of a method, and documents the
+// caching headers in the successful response of its OpenAPI operation. Only
+// methods bound to GET requests can be cached.
+func (g *Generator) setCacheOptions(o *descriptorpb.MethodOptions, httpRule *annotations.HttpRule, c *cache.Cache) error {
+	isGet := false
+	for _, rule := range append([]*annotations.HttpRule{httpRule}, httpRule.GetAdditionalBindings()...) {
+		if rule.GetGet() != "" {
+			isGet = true
+		}
+	}
+	if !isGet {
+		return fmt.Errorf("Cache-Control annotation requires an http.Match with the GET method")
+	}
+	proto.SetExtension(o, cache.E_Cache, c)
+	g.addProtoDep("gunk/cache.proto")
+	op, _ := proto.GetExtension(o, options.E_Openapiv2Operation).(*options.Operation)
+	if op == nil {
+		op = &options.Operation{}
+	}
+	if op.Responses == nil {
+		op.Responses = make(map[string]*options.Response)
+	}
+	resp := op.Responses["200"]
+	if resp == nil {
+		// The description is required, so use the one
+		// protoc-gen-openapiv2 uses by default.
+		resp = &options.Response{Description: "A successful response."}
+		op.Responses["200"] = resp
+	}
+	if resp.Headers == nil {
+		resp.Headers = make(map[string]*options.Header)
+	}
+	resp.Headers["Cache-Control"] = &options.Header{Type: "string", Description: c.CacheControl}
+	if len(c.Vary) > 0 {
+		resp.Headers["Vary"] = &options.Header{Type: "string", Description: strings.Join(c.Vary, ", ")}
+	}
+	proto.SetExtension(o, options.E_Openapiv2Operation, op)
+	g.addProtoDep("protoc-gen-openapiv2/options/annotations.proto")
+	return nil
+}
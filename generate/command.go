@@ -0,0 +1,134 @@
+package generate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/gunk/gunk/config"
+	"github.com/gunk/gunk/log"
+)
+
+const (
+	// defaultPluginTimeout is how long plugin binaries may run, unless set
+	// otherwise with plugin_timeout.
+	defaultPluginTimeout = 5 * time.Minute
+	// defaultPluginMaxOutput is the maximum size of the responses of
+	// plugin binaries, unless set otherwise with plugin_max_output.
+	defaultPluginMaxOutput = 256 << 20
+	// pluginWaitDelay is how long to wait for the output of a plugin
+	// binary to be closed after it's killed, since the processes it
+	// started may keep it open.
+	pluginWaitDelay = time.Second
+)
+
+// errOutputLimit is returned when writing more than the maximum output of a
+// plugin.
+var errOutputLimit = errors.New("output limit exceeded")
+
+// runPluginCommand runs the binary of a plugin with its request on the
+// standard input, and returns its response. The plugin is killed if it runs
+// longer than its timeout, or writes more than its maximum output, so that a
+// misbehaving plugin can't hang gunk. If set, only the variables of PluginEnv
+// are kept in its environment.
+func runPluginCommand(gen config.Generator, stdin io.Reader, name string, args ...string) ([]byte, error) {
+	timeout, max := pluginLimits(gen)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := log.ExecCommandContext(ctx, name, args...)
+	cmd.Stdin = stdin
+	// Killing the plugin doesn't kill the processes it started, such as
+	// those of a script, so its output isn't waited for long after that.
+	cmd.WaitDelay = pluginWaitDelay
+	if gen.PluginEnv != nil {
+		cmd.Env = filterEnv(os.Environ(), gen.PluginEnv)
+	}
+	stdout := &limitedBuffer{max: max, exceeded: cancel}
+	cmd.Stdout = stdout
+	var stderr bytes.Buffer
+	if cmd.Stderr == nil {
+		cmd.Stderr = &stderr
+	}
+	err := cmd.Run()
+	if err := pluginLimitError(gen, errors.Is(ctx.Err(), context.DeadlineExceeded), stdout.overflow); err != nil {
+		return nil, err
+	}
+	if err != nil {
+		if xerr, ok := err.(*exec.ExitError); ok {
+			xerr.Stderr = stderr.Bytes()
+		}
+		return nil, log.ExecError(name, err)
+	}
+	return stdout.buf.Bytes(), nil
+}
+
+// pluginLimits returns how long the plugin of a generator may run, and the
+// maximum size of its response.
+func pluginLimits(gen config.Generator) (time.Duration, int64) {
+	timeout := gen.PluginTimeout
+	if timeout == 0 {
+		timeout = defaultPluginTimeout
+	}
+	max := gen.PluginMaxOutput
+	if max == 0 {
+		max = defaultPluginMaxOutput
+	}
+	return timeout, max
+}
+
+// pluginLimitError returns the error of a plugin which was stopped for writing
+// more than its maximum output, or for running longer than its timeout, or nil
+// if it wasn't.
+func pluginLimitError(gen config.Generator, timedOut, overflow bool) error {
+	timeout, max := pluginLimits(gen)
+	name := gen.Command
+	if gen.IsProtoc() {
+		name = fmt.Sprintf("protoc --%s_out", gen.ProtocGen)
+	}
+	switch {
+	case overflow:
+		return fmt.Errorf("generator %s was stopped after writing more than %d bytes; raise plugin_max_output if its output is that large", name, max)
+	case timedOut:
+		return fmt.Errorf("generator %s was stopped after running for %v; raise plugin_timeout if it needs longer", name, timeout)
+	}
+	return nil
+}
+
+// filterEnv returns the variables of an environment with the given names.
+func filterEnv(env, names []string) []string {
+	keep := make(map[string]bool, len(names))
+	for _, name := range names {
+		keep[name] = true
+	}
+	filtered := []string{}
+	for _, kv := range env {
+		if i := strings.Index(kv, "="); i > 0 && keep[kv[:i]] {
+			filtered = append(filtered, kv)
+		}
+	}
+	return filtered
+}
+
+// limitedBuffer is a buffer calling exceeded and failing when more than max
+// bytes are written to it.
+type limitedBuffer struct {
+	buf      bytes.Buffer
+	max      int64
+	exceeded func()
+	overflow bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if int64(b.buf.Len()+len(p)) > b.max {
+		b.overflow = true
+		b.exceeded()
+		return 0, errOutputLimit
+	}
+	return b.buf.Write(p)
+}
@@ -0,0 +1,456 @@
+package doc
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gunk/gunk/loader"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Field numbers of the declarations in descriptor.proto, used in the paths of
+// the source code info locations.
+const (
+	packagePath       = 2 // FileDescriptorProto.package
+	messagePath       = 4 // FileDescriptorProto.message_type
+	enumPath          = 5 // FileDescriptorProto.enum_type
+	servicePath       = 6 // FileDescriptorProto.service
+	messageFieldPath  = 2 // DescriptorProto.field
+	enumValuePath     = 2 // EnumDescriptorProto.value
+	serviceMethodPath = 2 // ServiceDescriptorProto.method
+)
+
+// wellKnownTypes maps the proto types which are documented as basic types to
+// their names, like convertType does for their Go types.
+var wellKnownTypes = map[string]string{
+	".google.protobuf.Timestamp":   "Timestamp",
+	".google.protobuf.Duration":    "Duration",
+	".google.protobuf.Any":         "Any",
+	".google.protobuf.Struct":      "Struct",
+	".google.protobuf.Value":       "Value",
+	".google.protobuf.ListValue":   "List Value",
+	".google.protobuf.FieldMask":   "Field Mask",
+	".google.protobuf.StringValue": "String",
+	".google.protobuf.BytesValue":  "Bytes",
+	".google.protobuf.BoolValue":   "Boolean",
+	".google.protobuf.Int32Value":  "Integer",
+	".google.protobuf.UInt32Value": "Unsigned Integer",
+	".google.protobuf.Int64Value":  "Integer(64)",
+	".google.protobuf.UInt64Value": "Unsigned Integer(64)",
+	".google.protobuf.FloatValue":  "Float(32)",
+	".google.protobuf.DoubleValue": "Float(64)",
+}
+
+// scalarTypes maps the proto scalar types to their documented names.
+var scalarTypes = map[descriptorpb.FieldDescriptorProto_Type]string{
+	descriptorpb.FieldDescriptorProto_TYPE_STRING:   "String",
+	descriptorpb.FieldDescriptorProto_TYPE_BYTES:    "Bytes",
+	descriptorpb.FieldDescriptorProto_TYPE_BOOL:     "Boolean",
+	descriptorpb.FieldDescriptorProto_TYPE_INT32:    "Integer",
+	descriptorpb.FieldDescriptorProto_TYPE_SINT32:   "Integer",
+	descriptorpb.FieldDescriptorProto_TYPE_SFIXED32: "Integer",
+	descriptorpb.FieldDescriptorProto_TYPE_UINT32:   "Unsigned Integer",
+	descriptorpb.FieldDescriptorProto_TYPE_FIXED32:  "Unsigned Integer",
+	descriptorpb.FieldDescriptorProto_TYPE_INT64:    "Integer(64)",
+	descriptorpb.FieldDescriptorProto_TYPE_SINT64:   "Integer(64)",
+	descriptorpb.FieldDescriptorProto_TYPE_SFIXED64: "Integer(64)",
+	descriptorpb.FieldDescriptorProto_TYPE_UINT64:   "Unsigned Integer(64)",
+	descriptorpb.FieldDescriptorProto_TYPE_FIXED64:  "Unsigned Integer(64)",
+	descriptorpb.FieldDescriptorProto_TYPE_FLOAT:    "Float(32)",
+	descriptorpb.FieldDescriptorProto_TYPE_DOUBLE:   "Float(64)",
+}
+
+// FromDescriptor generates the documentation of a Gunk package from its
+// translated proto file, such as one archived in a schema snapshot, instead of
+// from its Gunk source. The descriptions are taken from the file's source code
+// info. files must hold the file's dependencies, so that the types it
+// references can be resolved to their Gunk packages.
+func FromDescriptor(file *descriptorpb.FileDescriptorProto, files []*descriptorpb.FileDescriptorProto) (*Package, error) {
+	d := &descDoc{
+		file:      file,
+		pkgPaths:  make(map[string]string),
+		comments:  make(map[string]string),
+		types:     make(map[string]Type),
+		inService: make(map[string][]*Endpoint),
+		inField:   make(map[string]bool),
+		valueOpts: make(map[protowire.Number]*descriptorpb.FieldDescriptorProto),
+	}
+	for _, f := range append(files, file) {
+		for _, ext := range f.Extension {
+			if ext.GetExtendee() == ".google.protobuf.EnumValueOptions" {
+				d.valueOpts[protowire.Number(ext.GetNumber())] = ext
+			}
+		}
+	}
+	// Each Gunk package is translated into a single file in its import
+	// path, so the proto package of a type tells its Gunk package.
+	for _, f := range files {
+		d.pkgPaths[f.GetPackage()] = path.Dir(f.GetName())
+	}
+	d.pkgPaths[file.GetPackage()] = path.Dir(file.GetName())
+	for _, loc := range file.GetSourceCodeInfo().GetLocation() {
+		d.comments[fmt.Sprint(loc.Path)] = loc.GetLeadingComments()
+	}
+	pkgPath := path.Dir(file.GetName())
+	name := path.Base(pkgPath)
+	if goPkg := file.GetOptions().GetGoPackage(); strings.Contains(goPkg, ";") {
+		name = goPkg[strings.LastIndex(goPkg, ";")+1:]
+	}
+	desc, stability := splitStability(d.comment(packagePath))
+	for i, msg := range file.MessageType {
+		if err := d.addMessage(msg, messagePath, int32(i)); err != nil {
+			return nil, err
+		}
+	}
+	for i, enum := range file.EnumType {
+		d.addEnum(enum, enumPath, int32(i))
+	}
+	var services []*Service
+	for i, s := range file.Service {
+		service, err := d.addService(s, int32(i))
+		if err != nil {
+			return nil, err
+		}
+		services = append(services, service)
+	}
+	sort.Slice(services, func(i, j int) bool {
+		return services[i].Name < services[j].Name
+	})
+	// As with Generate, messages which are only used by endpoints are
+	// documented with them.
+	for k, v := range d.types {
+		m, ok := v.(*Message)
+		if !ok {
+			continue
+		}
+		if d.inService[k] != nil && !d.inField[k] {
+			delete(d.types, k)
+		}
+		for _, e := range d.inService[k] {
+			if req, ok := e.Request.(*Ref); ok && req.Name == k {
+				e.Request = m
+				for _, f := range m.Fields {
+					if f.GunkName == e.BodyField {
+						e.BodyField = f.Name
+						break
+					}
+				}
+				e.Path = processPath(m, e.Path)
+			}
+			if res, ok := e.Response.(*Ref); ok && res.Name == k {
+				e.Response = m
+			}
+		}
+	}
+	return &Package{
+		Name:        name,
+		ID:          pkgPath,
+		Description: desc,
+		Stability:   stability.Level,
+		Since:       stability.Since,
+		Services:    services,
+		Types:       d.types,
+	}, nil
+}
+
+// descDoc holds the state of the documentation generated from a descriptor,
+// like Doc does for a Gunk package.
+type descDoc struct {
+	file     *descriptorpb.FileDescriptorProto
+	pkgPaths map[string]string // proto package to Gunk package path
+	comments map[string]string // source code info path to leading comments
+	// valueOpts are the custom enum value options, by field number.
+	valueOpts map[protowire.Number]*descriptorpb.FieldDescriptorProto
+
+	types     map[string]Type
+	inService map[string][]*Endpoint
+	inField   map[string]bool
+}
+
+// comment returns the leading comments of the declaration at the path,
+// without the space which is added to each line in proto comments.
+func (d *descDoc) comment(path ...int32) string {
+	text := d.comments[fmt.Sprint(path)]
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimPrefix(line, " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (d *descDoc) addMessage(msg *descriptorpb.DescriptorProto, path ...int32) error {
+	desc, stability := describe(msg.GetName(), d.comment(path...))
+	m := &Message{
+		Name:        msg.GetName(),
+		Description: desc,
+		Stability:   stability.Level,
+		Since:       stability.Since,
+	}
+	for i, field := range msg.Field {
+		typ, err := d.fieldType(msg, field)
+		if err != nil {
+			return fmt.Errorf("%s.%s: %w", msg.GetName(), field.GetName(), err)
+		}
+		name := field.GetJsonName()
+		if name == "" {
+			name = field.GetName()
+		}
+		desc, stability := describe(field.GetName(), d.comment(append(path, messageFieldPath, int32(i))...))
+		m.Fields = append(m.Fields, &Field{
+			Name:         name,
+			GunkName:     field.GetName(),
+			Description:  desc,
+			Stability:    stability.Level,
+			Since:        stability.Since,
+			Type:         typ,
+			JSONEncoding: jsonEncoding(field),
+		})
+	}
+	d.types[d.qualifiedTypeName(msg.GetName())] = m
+	return nil
+}
+
+func (d *descDoc) addEnum(enum *descriptorpb.EnumDescriptorProto, path ...int32) {
+	desc, stability := describe(enum.GetName(), d.comment(path...))
+	e := &Enum{
+		Name:        enum.GetName(),
+		Description: desc,
+		Stability:   stability.Level,
+		Since:       stability.Since,
+	}
+	for i, v := range enum.Value {
+		// Value docs starting with the value's name are prefixed
+		// with the enum's name, as that is the name of the
+		// generated Go constant.
+		text := strings.TrimPrefix(d.comment(append(path, enumValuePath, int32(i))...), enum.GetName()+"_")
+		desc, stability := describe(v.GetName(), text)
+		e.Values = append(e.Values, &EnumVal{
+			Value:       v.GetName(),
+			Description: desc,
+			Stability:   stability.Level,
+			Since:       stability.Since,
+			Deprecated:  v.GetOptions().GetDeprecated(),
+			Options:     d.valueOptions(v.GetOptions()),
+		})
+	}
+	d.types[d.qualifiedTypeName(enum.GetName())] = e
+}
+
+// valueOptions returns the custom options set on an enum value, by their
+// names, as in the Gunk source. They are stored as unknown fields, as their
+// extensions aren't linked into the binary.
+func (d *descDoc) valueOptions(o *descriptorpb.EnumValueOptions) map[string]string {
+	if o == nil {
+		return nil
+	}
+	var options map[string]string
+	b := o.ProtoReflect().GetUnknown()
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return options
+		}
+		b = b[n:]
+		var value string
+		ext := d.valueOpts[num]
+		switch typ {
+		case protowire.VarintType:
+			v, m := protowire.ConsumeVarint(b)
+			n = m
+			switch ext.GetType() {
+			case descriptorpb.FieldDescriptorProto_TYPE_BOOL:
+				value = strconv.FormatBool(v != 0)
+			case descriptorpb.FieldDescriptorProto_TYPE_SINT32, descriptorpb.FieldDescriptorProto_TYPE_SINT64:
+				value = strconv.FormatInt(protowire.DecodeZigZag(v), 10)
+			case descriptorpb.FieldDescriptorProto_TYPE_UINT32, descriptorpb.FieldDescriptorProto_TYPE_UINT64:
+				value = strconv.FormatUint(v, 10)
+			default:
+				value = strconv.FormatInt(int64(v), 10)
+			}
+		case protowire.BytesType:
+			v, m := protowire.ConsumeBytes(b)
+			n = m
+			value = string(v)
+			if ext.GetType() != descriptorpb.FieldDescriptorProto_TYPE_STRING {
+				ext = nil
+			}
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			ext = nil
+		}
+		if n < 0 {
+			return options
+		}
+		b = b[n:]
+		if ext == nil {
+			continue
+		}
+		if options == nil {
+			options = make(map[string]string)
+		}
+		options[ext.GetName()] = value
+	}
+	return options
+}
+
+func (d *descDoc) addService(s *descriptorpb.ServiceDescriptorProto, index int32) (*Service, error) {
+	desc, stability := describe(s.GetName(), d.comment(servicePath, index))
+	service := &Service{
+		Name:        s.GetName(),
+		Description: desc,
+		Stability:   stability.Level,
+		Since:       stability.Since,
+	}
+	for i, m := range s.Method {
+		desc, stability := describe(m.GetName(), d.comment(servicePath, index, serviceMethodPath, int32(i)))
+		endpoint := &Endpoint{
+			Name:              m.GetName(),
+			Description:       desc,
+			Stability:         stability.Level,
+			Since:             stability.Since,
+			StreamingRequest:  m.GetClientStreaming(),
+			StreamingResponse: m.GetServerStreaming(),
+		}
+		if rule, ok := proto.GetExtension(m.GetOptions(), annotations.E_Http).(*annotations.HttpRule); ok && rule != nil {
+			endpoint.Method, endpoint.Path = httpPattern(rule)
+			endpoint.BodyField = rule.GetBody()
+		}
+		var err error
+		if endpoint.Request, err = d.paramType(endpoint, m.GetInputType()); err != nil {
+			return nil, fmt.Errorf("%s: %w", m.GetName(), err)
+		}
+		if endpoint.Response, err = d.paramType(endpoint, m.GetOutputType()); err != nil {
+			return nil, fmt.Errorf("%s: %w", m.GetName(), err)
+		}
+		service.Endpoints = append(service.Endpoints, endpoint)
+	}
+	return service, nil
+}
+
+// httpPattern returns the method and path of an HTTP rule.
+func httpPattern(rule *annotations.HttpRule) (string, string) {
+	switch p := rule.GetPattern().(type) {
+	case *annotations.HttpRule_Get:
+		return "GET", p.Get
+	case *annotations.HttpRule_Put:
+		return "PUT", p.Put
+	case *annotations.HttpRule_Post:
+		return "POST", p.Post
+	case *annotations.HttpRule_Delete:
+		return "DELETE", p.Delete
+	case *annotations.HttpRule_Patch:
+		return "PATCH", p.Patch
+	case *annotations.HttpRule_Custom:
+		return p.Custom.GetKind(), p.Custom.GetPath()
+	}
+	return "", ""
+}
+
+// paramType returns the type of a method's parameter or result. Methods
+// without one use google.protobuf.Empty, which is documented as no type.
+func (d *descDoc) paramType(e *Endpoint, typeName string) (Type, error) {
+	if typeName == ".google.protobuf.Empty" {
+		return nil, nil
+	}
+	typ, err := d.namedType(typeName, true)
+	if err != nil {
+		return nil, err
+	}
+	ref, ok := typ.(*Ref)
+	if !ok {
+		return nil, fmt.Errorf("unsupported parameter type: %v", typ)
+	}
+	d.inService[ref.Name] = append(d.inService[ref.Name], e)
+	return ref, nil
+}
+
+func (d *descDoc) fieldType(msg *descriptorpb.DescriptorProto, field *descriptorpb.FieldDescriptorProto) (Type, error) {
+	var elem Type
+	switch field.GetType() {
+	case descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, descriptorpb.FieldDescriptorProto_TYPE_ENUM:
+		// Maps are repeated fields of nested map entry messages.
+		for _, nested := range msg.NestedType {
+			if !nested.GetOptions().GetMapEntry() || !strings.HasSuffix(field.GetTypeName(), "."+nested.GetName()) {
+				continue
+			}
+			key, err := d.fieldType(nested, nested.Field[0])
+			if err != nil {
+				return nil, err
+			}
+			value, err := d.fieldType(nested, nested.Field[1])
+			if err != nil {
+				return nil, err
+			}
+			return &Map{key, value}, nil
+		}
+		var err error
+		if elem, err = d.namedType(field.GetTypeName(), false); err != nil {
+			return nil, err
+		}
+	default:
+		name, ok := scalarTypes[field.GetType()]
+		if !ok {
+			return nil, fmt.Errorf("unknown type to convert: %v", field.GetType())
+		}
+		elem = &Basic{name, ""}
+	}
+	if field.GetLabel() == descriptorpb.FieldDescriptorProto_LABEL_REPEATED {
+		return &Array{elem}, nil
+	}
+	return elem, nil
+}
+
+// namedType returns the type of a fully qualified proto type name, such as
+// ".util.Message".
+func (d *descDoc) namedType(typeName string, inService bool) (Type, error) {
+	if name, ok := wellKnownTypes[typeName]; ok {
+		return &Basic{name, ""}, nil
+	}
+	// The types of the googleapis common protos are documented by name,
+	// like convertType does for their Go types.
+	if _, name, ok := loader.GoogleapisGoType(strings.TrimPrefix(typeName, ".")); ok {
+		return &Basic{typeWords(name), ""}, nil
+	}
+	i := strings.LastIndex(typeName, ".")
+	if i < 0 {
+		return nil, fmt.Errorf("invalid type name %q", typeName)
+	}
+	pkgPath, ok := d.pkgPaths[strings.TrimPrefix(typeName[:i], ".")]
+	if !ok {
+		return nil, fmt.Errorf("unknown type to convert: %s", typeName)
+	}
+	fullName := pkgPath + "." + typeName[i+1:]
+	if !inService {
+		d.inField[fullName] = true
+	}
+	return &Ref{fullName}, nil
+}
+
+func (d *descDoc) qualifiedTypeName(typeName string) string {
+	return path.Dir(d.file.GetName()) + "." + typeName
+}
+
+// jsonEncoding returns the JSON encoding of a 64-bit integer field from its
+// jstype option, like Doc does from its Gunk field.
+func jsonEncoding(field *descriptorpb.FieldDescriptorProto) string {
+	switch field.GetType() {
+	case descriptorpb.FieldDescriptorProto_TYPE_INT64, descriptorpb.FieldDescriptorProto_TYPE_SINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED64, descriptorpb.FieldDescriptorProto_TYPE_UINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_FIXED64:
+	default:
+		return ""
+	}
+	switch field.GetOptions().GetJstype() {
+	case descriptorpb.FieldOptions_JS_STRING:
+		return loader.Int64String
+	case descriptorpb.FieldOptions_JS_NUMBER:
+		return loader.Int64Number
+	}
+	return ""
+}
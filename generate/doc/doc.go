@@ -3,11 +3,14 @@ package doc
 import (
 	"fmt"
 	"go/ast"
+	"go/constant"
+	"go/token"
 	"go/types"
 	"reflect"
 	"sort"
 	"strconv"
 	"strings"
+	"unicode"
 
 	"github.com/gunk/gunk/config"
 	"github.com/gunk/gunk/loader"
@@ -44,17 +47,22 @@ func Generate(pkg *loader.GunkPackage, genCfg config.Generator) (p *Package, err
 		}
 	}()
 	var pkgDesc string
+	var pkgStability loader.Stability
 	// collect types and services
 	for _, v := range pkg.GunkSyntax {
 		if v.Doc.Text() != "" {
-			pkgDesc = v.Doc.Text()
+			pkgDesc, pkgStability = splitStability(v.Doc.Text())
 		}
 		for _, w := range v.Decls {
 			ast.Inspect(w, func(n ast.Node) bool {
 				switch n := n.(type) {
 				default:
 					return false
-				case *ast.GenDecl, *ast.StructType, *ast.FieldList:
+				case *ast.GenDecl:
+					// Variables are option presets, which aren't
+					// documented.
+					return n.Tok != token.VAR
+				case *ast.StructType, *ast.FieldList:
 					return true
 				// Type definitions such as enum, struct and interface.
 				case *ast.TypeSpec:
@@ -72,6 +80,13 @@ func Generate(pkg *loader.GunkPackage, genCfg config.Generator) (p *Package, err
 	}
 	// cleanup
 	for k, v := range doc.types {
+		if e, ok := v.(*Enum); ok && e.nestedPrefix != "" {
+			// The values of nested enums are named like in their
+			// protobuf enum.
+			for _, val := range e.Values {
+				val.Value = strings.TrimPrefix(val.Value, e.nestedPrefix)
+			}
+		}
 		m, ok := v.(*Message)
 		if !ok {
 			continue
@@ -116,12 +131,18 @@ func Generate(pkg *loader.GunkPackage, genCfg config.Generator) (p *Package, err
 		Name:        pkg.Name,
 		ID:          pkg.Types.Path(),
 		Description: pkgDesc,
+		Stability:   pkgStability.Level,
+		Since:       pkgStability.Since,
 		Services:    services,
 		Types:       doc.types,
 	}, nil
 }
 
 func (doc *Doc) addType(n *ast.TypeSpec) error {
+	if n.Assign.IsValid() {
+		// Type aliases are documented as the type they denote.
+		return nil
+	}
 	switch nn := n.Type.(type) {
 	case *ast.StructType:
 		return doc.addMessage(n, nn)
@@ -138,16 +159,24 @@ func (doc *Doc) addType(n *ast.TypeSpec) error {
 			}
 			enum := doc.types[qName].(*Enum)
 			enum.Name = n.Name.Name
-			enum.Description = cleanDescription(n.Name.Name, n.Doc.Text())
+			if loader.NestedParent(n.Doc.Text()) != "" {
+				enum.nestedPrefix = n.Name.Name + "_"
+			}
+			desc, stability := describe(n.Name.Name, n.Doc.Text())
+			enum.Description = desc
+			enum.Stability, enum.Since = stability.Level, stability.Since
 		}
 	}
 	return nil
 }
 
 func (doc *Doc) addMessage(n *ast.TypeSpec, st *ast.StructType) error {
+	desc, stability := describe(n.Name.Name, n.Doc.Text())
 	msg := &Message{
 		Name:        n.Name.Name,
-		Description: cleanDescription(n.Name.Name, n.Doc.Text()),
+		Description: desc,
+		Stability:   stability.Level,
+		Since:       stability.Since,
 	}
 	for _, field := range st.Fields.List {
 		if len(field.Names) == 0 {
@@ -172,11 +201,19 @@ func (doc *Doc) addMessage(n *ast.TypeSpec, st *ast.StructType) error {
 		if json == "" {
 			json = snaker.DefaultInitialisms.CamelToSnake(name)
 		}
+		enc, err := doc.pkg.FieldInt64Encoding(field)
+		if err != nil {
+			return err
+		}
+		desc, stability := describe(name, field.Doc.Text())
 		msg.Fields = append(msg.Fields, &Field{
-			Name:        json,
-			GunkName:    name,
-			Description: cleanDescription(name, field.Doc.Text()),
-			Type:        typ,
+			Name:         json,
+			GunkName:     name,
+			Description:  desc,
+			Stability:    stability.Level,
+			Since:        stability.Since,
+			Type:         typ,
+			JSONEncoding: enc,
 		})
 	}
 	qName := doc.qualifiedTypeName(n.Name.Name, doc.pkg.Types)
@@ -185,33 +222,34 @@ func (doc *Doc) addMessage(n *ast.TypeSpec, st *ast.StructType) error {
 }
 
 func (doc *Doc) addService(n *ast.TypeSpec, ifc *ast.InterfaceType) error {
+	desc, stability := describe(n.Name.Name, n.Doc.Text())
 	service := &Service{
 		Name:        n.Name.Name,
-		Description: cleanDescription(n.Name.Name, n.Doc.Text()),
+		Description: desc,
+		Stability:   stability.Level,
+		Since:       stability.Since,
 	}
 	for _, v := range ifc.Methods.List {
 		if len(v.Names) != 1 {
 			return fmt.Errorf("methods must have exactly one name")
 		}
+		desc, stability := describe(v.Names[0].Name, v.Doc.Text())
 		endpoint := &Endpoint{
 			Name:        v.Names[0].Name,
-			Description: cleanDescription(v.Names[0].Name, v.Doc.Text()),
+			Description: desc,
+			Stability:   stability.Level,
+			Since:       stability.Since,
 		}
 		for _, tag := range doc.pkg.GunkTags[v] {
-			switch tag.Type.String() {
+			switch tag.Option() {
 			case "github.com/gunk/opt/http.Match":
-				for _, elt := range tag.Expr.(*ast.CompositeLit).Elts {
-					kv := elt.(*ast.KeyValueExpr)
-					val, _ := strconv.Unquote(kv.Value.(*ast.BasicLit).Value)
-					switch name := kv.Key.(*ast.Ident).Name; name {
-					case "Method":
-						endpoint.Method = val
-					case "Path":
-						endpoint.Path = val
-					case "Body":
-						endpoint.BodyField = val
-					}
+				var match struct{ Method, Path, Body string }
+				if err := tag.Decode(&match); err != nil {
+					return err
 				}
+				endpoint.Method = match.Method
+				endpoint.Path = match.Path
+				endpoint.BodyField = match.Body
 			case "github.com/gunk/opt/doc.Embed":
 			}
 		}
@@ -272,7 +310,7 @@ func (doc *Doc) convertParam(e *Endpoint, params *types.Tuple) (Type, bool, erro
 	default:
 		return nil, false, fmt.Errorf("multiple parameters are not supported")
 	}
-	param := params.At(0).Type()
+	param := loader.Unalias(params.At(0).Type())
 	var streaming bool
 	var typ Type
 	var err error
@@ -298,6 +336,9 @@ func (doc *Doc) addEnum(n *ast.ValueSpec) error {
 		return nil
 	}
 	for _, ident := range n.Names {
+		if ident.Name == "_" {
+			continue
+		}
 		qName := doc.pkg.TypesInfo.TypeOf(ident).String()
 		if _, ok := doc.types[qName]; !ok {
 			// Create an enum if it has not been declared yet.
@@ -308,16 +349,58 @@ func (doc *Doc) addEnum(n *ast.ValueSpec) error {
 			// Enforce that the type is an enum.
 			return fmt.Errorf("cannot declare value %s for non-enum type %s", ident.Name, qName)
 		}
+		desc, stability := describe(ident.Name, n.Doc.Text())
+		deprecated, options := doc.enumValueOptions(n)
 		enum.Values = append(enum.Values, &EnumVal{
 			Value:       ident.Name,
-			Description: cleanDescription(ident.Name, n.Doc.Text()),
+			Description: desc,
+			Stability:   stability.Level,
+			Since:       stability.Since,
+			Deprecated:  deprecated,
+			Options:     options,
 		})
 	}
 	return nil
 }
 
+// enumValueOptions returns whether an enum value is deprecated, and the
+// custom options set on it, by their field names.
+func (doc *Doc) enumValueOptions(n *ast.ValueSpec) (bool, map[string]string) {
+	deprecated := false
+	var options map[string]string
+	for _, tag := range doc.pkg.GunkTags[n] {
+		if tag.Option() == "github.com/gunk/opt/enumvalues.Deprecated" {
+			deprecated = tag.Value != nil && constant.BoolVal(tag.Value)
+			continue
+		}
+		lit, ok := tag.Expr.(*ast.CompositeLit)
+		if !ok || tag.Name() != "EnumValueOptions" {
+			continue
+		}
+		for _, elt := range lit.Elts {
+			kv, ok := elt.(*ast.KeyValueExpr)
+			if !ok {
+				continue
+			}
+			key, ok := kv.Key.(*ast.Ident)
+			if !ok {
+				continue
+			}
+			value := types.ExprString(kv.Value)
+			if lit, ok := kv.Value.(*ast.BasicLit); ok && lit.Kind == token.STRING {
+				value, _ = strconv.Unquote(lit.Value)
+			}
+			if options == nil {
+				options = make(map[string]string)
+			}
+			options[key.Name] = value
+		}
+	}
+	return deprecated, options
+}
+
 func (doc *Doc) convertType(typ types.Type, inService bool) (Type, error) {
-	switch typ := typ.(type) {
+	switch typ := loader.Unalias(typ).(type) {
 	case *types.Basic:
 		switch typ.Kind() {
 		case types.String:
@@ -337,6 +420,14 @@ func (doc *Doc) convertType(typ types.Type, inService bool) (Type, error) {
 		case types.Bool:
 			return &Basic{"Boolean", ""}, nil
 		}
+	case *types.Pointer:
+		// Pointers to scalars are translated to wrapper types, which are
+		// documented as their nullable scalar.
+		return doc.convertType(typ.Elem(), inService)
+	case *types.Array:
+		if eTyp, ok := typ.Elem().(*types.Basic); ok && eTyp.Kind() == types.Byte {
+			return &Basic{fmt.Sprintf("Bytes(%d)", typ.Len()), ""}, nil
+		}
 	case *types.Slice:
 		if eTyp, ok := typ.Elem().(*types.Basic); ok {
 			if eTyp.Kind() == types.Byte {
@@ -364,8 +455,29 @@ func (doc *Doc) convertType(typ types.Type, inService bool) (Type, error) {
 			return &Basic{"Timestamp", ""}, nil
 		case "time.Duration":
 			return &Basic{"Duration", ""}, nil
+		case loader.UUIDPath + ".UUID":
+			return &Basic{"UUID", ""}, nil
+		case "google.golang.org/protobuf/types/known/anypb.Any":
+			return &Basic{"Any", ""}, nil
+		case "google.golang.org/protobuf/types/known/structpb.Struct":
+			return &Basic{"Struct", ""}, nil
+		case "google.golang.org/protobuf/types/known/structpb.Value":
+			return &Basic{"Value", ""}, nil
+		case "google.golang.org/protobuf/types/known/structpb.ListValue":
+			return &Basic{"List Value", ""}, nil
+		case "google.golang.org/protobuf/types/known/fieldmaskpb.FieldMask":
+			return &Basic{"Field Mask", ""}, nil
+		case "google.golang.org/protobuf/types/known/emptypb.Empty":
+			return &Basic{"Empty", ""}, nil
 		}
 		obj := typ.Obj()
+		if pkg := obj.Pkg(); pkg != nil {
+			// The types of the googleapis common protos, such as
+			// google.type.Money, aren't documented by Gunk.
+			if _, _, _, ok := loader.GoogleapisType(pkg.Path(), obj.Name()); ok {
+				return &Basic{typeWords(obj.Name()), ""}, nil
+			}
+		}
 		fullName := doc.qualifiedTypeName(obj.Name(), obj.Pkg())
 		if !inService {
 			doc.inField[fullName] = true
@@ -383,6 +495,40 @@ func (doc *Doc) qualifiedTypeName(typeName string, pkg *types.Package) string {
 	return pkg.Path() + "." + typeName
 }
 
+// typeWords splits the words of a type name, such as "Lat Lng" for LatLng.
+func typeWords(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		if i > 0 && unicode.IsUpper(r) && !unicode.IsUpper(rune(name[i-1])) {
+			b.WriteByte(' ')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// splitStability splits the stability annotations from the documentation.
+// They were already validated by the loader. The JSON-Int64 annotations are
+// removed too, since they are documented as the JSON encoding of the fields.
+func splitStability(text string) (string, loader.Stability) {
+	text, stability, _ := loader.SplitStability(text)
+	lines := strings.Split(text, "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "JSON-Int64:") {
+			kept = append(kept, line)
+		}
+	}
+	return strings.TrimSpace(strings.Join(kept, "\n")), stability
+}
+
+// describe returns the description of the named declaration from its
+// documentation, along with its stability annotations.
+func describe(name, text string) (string, loader.Stability) {
+	text, stability := splitStability(text)
+	return cleanDescription(name, text), stability
+}
+
 // cleanDescription removes the leading "XYZ is" and the trailing dot from the
 // description.
 func cleanDescription(name string, desc string) string {
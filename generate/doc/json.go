@@ -24,6 +24,10 @@ type Package struct {
 	ID string `json:"id"`
 	// Description is the description of the comment.
 	Description string `json:"description"`
+	// Stability is the stability level, if annotated.
+	Stability string `json:"stability,omitempty"`
+	// Since is the version the package was introduced in, if annotated.
+	Since string `json:"since,omitempty"`
 	// Services is a list of services in the package.
 	Services []*Service `json:"services"`
 	// Types is a list of data types in the package.
@@ -36,6 +40,10 @@ type Service struct {
 	Name string `json:"name"`
 	// Description is the description of the service.
 	Description string `json:"description"`
+	// Stability is the stability level, if annotated.
+	Stability string `json:"stability,omitempty"`
+	// Since is the version the service was introduced in, if annotated.
+	Since string `json:"since,omitempty"`
 	// Methods is a list of methods in the service.
 	Endpoints []*Endpoint `json:"endpoints"`
 }
@@ -46,6 +54,10 @@ type Endpoint struct {
 	Name string `json:"name"`
 	// Description is the description of the endpoint.
 	Description string `json:"description"`
+	// Stability is the stability level, if annotated.
+	Stability string `json:"stability,omitempty"`
+	// Since is the version the endpoint was introduced in, if annotated.
+	Since string `json:"since,omitempty"`
 	// Method is the HTTP method to trigger the endpoint.
 	Method string `json:"method"`
 	// Path is the HTTP path to trigger the endpoint.
@@ -73,6 +85,10 @@ type Message struct {
 	Name string `json:"name"`
 	// Description is the description of the data type.
 	Description string `json:"description"`
+	// Stability is the stability level, if annotated.
+	Stability string `json:"stability,omitempty"`
+	// Since is the version the data type was introduced in, if annotated.
+	Since string `json:"since,omitempty"`
 	// Fields is a list of fields in the data type.
 	Fields []*Field `json:"fields"`
 }
@@ -85,8 +101,15 @@ type Field struct {
 	GunkName string `json:"-"`
 	// Description is the description of the field.
 	Description string `json:"description"`
+	// Stability is the stability level, if annotated.
+	Stability string `json:"stability,omitempty"`
+	// Since is the version the field was introduced in, if annotated.
+	Since string `json:"since,omitempty"`
 	// Type is the type of the field.
 	Type Type `json:"type"`
+	// JSONEncoding is the JSON encoding of a 64-bit integer field, either
+	// "string" or "number", if set.
+	JSONEncoding string `json:"json_encoding,omitempty"`
 }
 
 // Enum is the documentation for an enum.
@@ -95,8 +118,16 @@ type Enum struct {
 	Name string `json:"name"`
 	// Description is the description of the data type.
 	Description string `json:"description"`
+	// Stability is the stability level, if annotated.
+	Stability string `json:"stability,omitempty"`
+	// Since is the version the data type was introduced in, if annotated.
+	Since string `json:"since,omitempty"`
 	// Values are the list of values for enum.
 	Values []*EnumVal `json:"values"`
+
+	// nestedPrefix is the prefix of the values of a nested enum which
+	// isn't part of their name, such as Bar_Available_.
+	nestedPrefix string
 }
 
 type EnumVal struct {
@@ -104,6 +135,15 @@ type EnumVal struct {
 	Value string `json:"value"`
 	// Description is the description of the enum value.
 	Description string `json:"description"`
+	// Stability is the stability level, if annotated.
+	Stability string `json:"stability,omitempty"`
+	// Since is the version the enum value was introduced in, if annotated.
+	Since string `json:"since,omitempty"`
+	// Deprecated is true if the enum value is deprecated.
+	Deprecated bool `json:"deprecated,omitempty"`
+	// Options are the custom options set on the enum value, by their
+	// names, such as a display name.
+	Options map[string]string `json:"options,omitempty"`
 }
 
 // Ref is a reference to a Message or Enum type.
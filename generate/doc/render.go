@@ -0,0 +1,332 @@
+package doc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Formats maps the names of the formats the documentation can be written in to
+// their file extensions.
+var Formats = map[string]string{
+	"json":     ".json",
+	"asciidoc": ".adoc",
+	"rst":      ".rst",
+}
+
+// Render writes the documentation of the tag to w in one of the formats in
+// Formats.
+func Render(w io.Writer, tag *Tag, format string) error {
+	var m markup
+	switch format {
+	case "json":
+		return json.NewEncoder(w).Encode(tag)
+	case "asciidoc":
+		m = &asciidoc{}
+	case "rst":
+		m = &rst{}
+	default:
+		return fmt.Errorf("unknown doc format %q; must be json, asciidoc or rst", format)
+	}
+	renderTag(m, tag)
+	_, err := io.WriteString(w, m.String())
+	return err
+}
+
+// markup is a text format the documentation is rendered in, such as AsciiDoc.
+// Each method appends a block, followed by an empty line.
+type markup interface {
+	// heading starts a section, with level 1 being the document title.
+	heading(level int, title string)
+	paragraph(text string)
+	// literal is a block of preformatted text.
+	literal(text string)
+	table(header []string, rows [][]string)
+	String() string
+}
+
+func renderTag(m markup, tag *Tag) {
+	m.heading(1, tag.Name)
+	if preamble := strings.TrimSpace(tag.Preamble); preamble != "" {
+		m.paragraph(preamble)
+	}
+	for _, pkg := range tag.Packages {
+		r := renderer{markup: m, pkg: pkg}
+		r.renderPackage()
+	}
+}
+
+// renderer renders the documentation of a package.
+type renderer struct {
+	markup
+	pkg *Package
+}
+
+func (r renderer) renderPackage() {
+	r.heading(2, r.pkg.Name)
+	r.renderDescription(r.pkg.Description, r.pkg.Stability, r.pkg.Since)
+	for _, s := range r.pkg.Services {
+		r.heading(3, s.Name)
+		r.renderDescription(s.Description, s.Stability, s.Since)
+		for _, e := range s.Endpoints {
+			r.renderEndpoint(e)
+		}
+	}
+	types := r.types()
+	names := make([]string, 0, len(types))
+	for name := range types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		switch t := types[name].(type) {
+		case *Message:
+			r.heading(3, t.Name)
+			r.renderDescription(t.Description, t.Stability, t.Since)
+			r.renderFields(t)
+		case *Enum:
+			r.heading(3, t.Name)
+			r.renderDescription(t.Description, t.Stability, t.Since)
+			r.renderValues(t)
+		}
+	}
+}
+
+func (r renderer) renderEndpoint(e *Endpoint) {
+	r.heading(4, e.Name)
+	r.renderDescription(e.Description, e.Stability, e.Since)
+	if e.Path != "" {
+		r.literal(e.Method + " " + e.Path)
+	}
+	param := func(t Type, streaming bool) string {
+		name := r.typeName(t)
+		if name == "" {
+			return "none"
+		}
+		if streaming {
+			return "stream " + name
+		}
+		return name
+	}
+	r.table([]string{"Request", "Response"}, [][]string{{
+		param(e.Request, e.StreamingRequest),
+		param(e.Response, e.StreamingResponse),
+	}})
+}
+
+func (r renderer) renderFields(msg *Message) {
+	if len(msg.Fields) == 0 {
+		return
+	}
+	rows := make([][]string, 0, len(msg.Fields))
+	for _, f := range msg.Fields {
+		typ := r.typeName(f.Type)
+		if f.JSONEncoding != "" {
+			typ += " (JSON " + f.JSONEncoding + ")"
+		}
+		rows = append(rows, []string{f.Name, typ, annotate(f.Description, f.Stability, f.Since)})
+	}
+	r.table([]string{"Field", "Type", "Description"}, rows)
+}
+
+func (r renderer) renderValues(enum *Enum) {
+	header := []string{"Value", "Description"}
+	for _, v := range enum.Values {
+		if v.Deprecated || len(v.Options) > 0 {
+			header = append(header, "Options")
+			break
+		}
+	}
+	rows := make([][]string, 0, len(enum.Values))
+	for _, v := range enum.Values {
+		row := []string{v.Value, annotate(v.Description, v.Stability, v.Since)}
+		if len(header) > 2 {
+			row = append(row, valueOptions(v))
+		}
+		rows = append(rows, row)
+	}
+	r.table(header, rows)
+}
+
+// valueOptions returns the options of an enum value as shown in the
+// documentation, such as "Deprecated, Label: Active".
+func valueOptions(v *EnumVal) string {
+	var parts []string
+	if v.Deprecated {
+		parts = append(parts, "Deprecated")
+	}
+	keys := make([]string, 0, len(v.Options))
+	for k := range v.Options {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		parts = append(parts, k+": "+v.Options[k])
+	}
+	return strings.Join(parts, ", ")
+}
+
+// renderDescription appends the description and stability annotations of a
+// declaration, if any.
+func (r renderer) renderDescription(description, stability, since string) {
+	if description != "" {
+		r.paragraph(description)
+	}
+	if s := annotate("", stability, since); s != "" {
+		r.paragraph(s)
+	}
+}
+
+// types returns the types documented with the package. Besides the package's
+// types, it includes the messages which are only used by its endpoints.
+func (r renderer) types() map[string]Type {
+	types := make(map[string]Type, len(r.pkg.Types))
+	for name, t := range r.pkg.Types {
+		types[name] = t
+	}
+	for _, s := range r.pkg.Services {
+		for _, e := range s.Endpoints {
+			for _, t := range []Type{e.Request, e.Response} {
+				if msg, ok := t.(*Message); ok && len(msg.Fields) > 0 {
+					name := r.pkg.ID + "." + msg.Name
+					if _, ok := types[name]; !ok {
+						types[name] = msg
+					}
+				}
+			}
+		}
+	}
+	return types
+}
+
+// typeName returns the name of a type as shown in the documentation. Types of
+// the package being documented aren't qualified.
+func (r renderer) typeName(t Type) string {
+	switch t := t.(type) {
+	case *Message:
+		return t.Name
+	case *Enum:
+		return t.Name
+	case *Ref:
+		return strings.TrimPrefix(t.Name, r.pkg.ID+".")
+	case *Basic:
+		return t.Name
+	case *Array:
+		return "[]" + r.typeName(t.Value)
+	case *Map:
+		return "map<" + r.typeName(t.Key) + ", " + r.typeName(t.Value) + ">"
+	}
+	return ""
+}
+
+// annotate appends the stability annotations to a description, such as
+// "the text (Stability: beta, Since: v1.0.0)".
+func annotate(description, stability, since string) string {
+	var parts []string
+	if stability != "" {
+		parts = append(parts, "Stability: "+stability)
+	}
+	if since != "" {
+		parts = append(parts, "Since: "+since)
+	}
+	switch {
+	case len(parts) == 0:
+		return description
+	case description == "":
+		return strings.Join(parts, ", ")
+	}
+	return description + " (" + strings.Join(parts, ", ") + ")"
+}
+
+// asciidoc renders the documentation as AsciiDoc.
+type asciidoc struct {
+	strings.Builder
+}
+
+func (a *asciidoc) heading(level int, title string) {
+	a.WriteString(strings.Repeat("=", level) + " " + title + "\n\n")
+}
+
+func (a *asciidoc) paragraph(text string) {
+	a.WriteString(text + "\n\n")
+}
+
+func (a *asciidoc) literal(text string) {
+	a.WriteString("....\n" + text + "\n....\n\n")
+}
+
+func (a *asciidoc) table(header []string, rows [][]string) {
+	cols := make([]string, len(header))
+	for i, h := range header {
+		cols[i] = "1"
+		// Give the most room to the descriptions.
+		if h == "Description" {
+			cols[i] = "3"
+		}
+	}
+	fmt.Fprintf(a, "[cols=\"%s\",options=\"header\"]\n|===\n", strings.Join(cols, ","))
+	for _, row := range append([][]string{header}, rows...) {
+		for i, cell := range row {
+			if i > 0 {
+				a.WriteString(" ")
+			}
+			a.WriteString("|" + strings.ReplaceAll(cell, "|", "\\|"))
+		}
+		a.WriteString("\n")
+	}
+	a.WriteString("|===\n\n")
+}
+
+// rst renders the documentation as reStructuredText.
+type rst struct {
+	strings.Builder
+}
+
+// rstAdornments are the characters underlining the headings of each level.
+const rstAdornments = "#=-~^\""
+
+func (r *rst) heading(level int, title string) {
+	line := strings.Repeat(rstAdornments[level-1:level], len([]rune(title)))
+	if level == 1 {
+		// The document title is also overlined.
+		r.WriteString(line + "\n")
+	}
+	r.WriteString(title + "\n" + line + "\n\n")
+}
+
+func (r *rst) paragraph(text string) {
+	r.WriteString(text + "\n\n")
+}
+
+func (r *rst) literal(text string) {
+	r.WriteString("::\n\n" + indent(text, "    ") + "\n\n")
+}
+
+func (r *rst) table(header []string, rows [][]string) {
+	r.WriteString(".. list-table::\n   :header-rows: 1\n\n")
+	for _, row := range append([][]string{header}, rows...) {
+		for i, cell := range row {
+			prefix := "     - "
+			if i == 0 {
+				prefix = "   * - "
+			}
+			// Continuation lines are aligned with the cell's
+			// first line.
+			r.WriteString(strings.TrimRight(prefix+strings.ReplaceAll(cell, "\n", "\n       "), " ") + "\n")
+		}
+	}
+	r.WriteString("\n")
+}
+
+// indent prefixes each line of text, except the empty ones.
+func indent(text, prefix string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = prefix + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
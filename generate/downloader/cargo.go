@@ -0,0 +1,33 @@
+package downloader
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/gunk/gunk/log"
+)
+
+// Cargo installs a Rust protoc plugin with cargo, such as protoc-gen-prost.
+type Cargo struct {
+	Type string
+}
+
+func (g Cargo) Name() string {
+	return g.Type
+}
+
+func (g Cargo) Download(version string, p Paths) (string, error) {
+	version = strings.TrimPrefix(version, "v")
+	if _, err := exec.LookPath("cargo"); err != nil {
+		return "", fmt.Errorf("cargo is not installed. See https://rustup.rs/")
+	}
+	crate := "protoc-gen-" + g.Type
+	args := []string{"install", "--locked", "--root", p.buildDir, "--version", version, crate}
+	cargoCmd := log.ExecCommand("cargo", args...)
+	if err := cargoCmd.Run(); err != nil {
+		return "", log.ExecError("cargo "+strings.Join(args, " "), err)
+	}
+	return filepath.Join(p.buildDir, "bin", crate), nil
+}
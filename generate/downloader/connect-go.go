@@ -0,0 +1,39 @@
+package downloader
+
+import (
+	"strconv"
+	"strings"
+)
+
+type ConnectGo struct{}
+
+func (pd ConnectGo) Name() string {
+	return "connect-go"
+}
+
+func (pd ConnectGo) Download(version string, p Paths) (string, error) {
+	return goInstall(pd.pkgPath(version), version, p)
+}
+
+// pkgPath returns the package of protoc-gen-connect-go, which moved to
+// connectrpc.com in v1.11.0.
+func (ConnectGo) pkgPath(version string) string {
+	const (
+		oldPath = "github.com/bufbuild/connect-go/cmd/protoc-gen-connect-go"
+		newPath = "connectrpc.com/connect/cmd/protoc-gen-connect-go"
+	)
+	parts := strings.Split(strings.TrimPrefix(version, "v"), ".")
+	if len(parts) < 2 {
+		return newPath
+	}
+	major, err1 := strconv.Atoi(parts[0])
+	minor, err2 := strconv.Atoi(parts[1])
+	if err1 != nil || err2 != nil {
+		// Not a semantic version, such as a commit.
+		return newPath
+	}
+	if major < 1 || major == 1 && minor < 11 {
+		return oldPath
+	}
+	return newPath
+}
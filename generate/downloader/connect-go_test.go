@@ -0,0 +1,27 @@
+package downloader
+
+import "testing"
+
+func TestConnectGoPkgPath(t *testing.T) {
+	const (
+		oldPath = "github.com/bufbuild/connect-go/cmd/protoc-gen-connect-go"
+		newPath = "connectrpc.com/connect/cmd/protoc-gen-connect-go"
+	)
+	for _, tc := range []struct {
+		version, want string
+	}{
+		{"v0.5.0", oldPath},
+		{"v1.10.0", oldPath},
+		{"v1.10.9", oldPath},
+		// protoc-gen-connect-go moved to connectrpc.com in v1.11.0.
+		{"v1.11.0", newPath},
+		{"v1.16.2", newPath},
+		{"v2.0.0", newPath},
+		{"latest", newPath},
+		{"4d3f2a1", newPath},
+	} {
+		if got := (ConnectGo{}).pkgPath(tc.version); got != tc.want {
+			t.Errorf("%s: got %s, want %s", tc.version, got, tc.want)
+		}
+	}
+}
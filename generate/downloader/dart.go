@@ -0,0 +1,38 @@
+package downloader
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/gunk/gunk/log"
+)
+
+// Dart installs protoc-gen-dart, from the protoc_plugin package, in a pub
+// cache of its own. The plugin is a script running it from that cache.
+type Dart struct{}
+
+func (g Dart) Name() string {
+	return "dart"
+}
+
+func (g Dart) Download(version string, p Paths) (string, error) {
+	version = strings.TrimPrefix(version, "v")
+	if _, err := exec.LookPath("dart"); err != nil {
+		return "", fmt.Errorf("dart is not installed. See https://dart.dev/get-dart")
+	}
+	if err := os.MkdirAll(p.buildDir, 0o755); err != nil {
+		return "", err
+	}
+	args := []string{"pub", "global", "activate", "protoc_plugin", version}
+	dartCmd := log.ExecCommand("dart", args...)
+	dartCmd.Env = append(os.Environ(), "PUB_CACHE="+p.buildDir)
+	if err := dartCmd.Run(); err != nil {
+		return "", log.ExecError("dart "+strings.Join(args, " "), err)
+	}
+	if err := writeScript(p.binary, []string{"PUB_CACHE=" + p.buildDir}, "dart", "pub", "global", "run", "protoc_plugin"); err != nil {
+		return "", err
+	}
+	return p.binary, nil
+}
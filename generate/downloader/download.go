@@ -1,11 +1,20 @@
 package downloader
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
 
 	"github.com/gunk/gunk/log"
+	"github.com/gunk/gunk/stats"
 	"github.com/rogpeppe/go-internal/lockedfile"
 )
 
@@ -20,24 +29,17 @@ func getPaths(name, version string) (*Paths, func(error), error) {
 		return nil, nil, fmt.Errorf("must provide protoc-gen-go version")
 	}
 
-	// Get the OS-specific cache directory.
-	cachePath, err := os.UserCacheDir()
+	cacheDir, err := cacheDir()
 	if err != nil {
 		return nil, nil, err
 	}
-	if dir := os.Getenv("GUNK_CACHE_DIR"); dir != "" {
-		// Allow overriding the cache dir entirely. Mainly for
-		// the tests.
-		cachePath = dir
-	}
-	cacheDir := filepath.Join(cachePath, "gunk")
 	if err := os.MkdirAll(cacheDir, 0o755); err != nil {
 		return nil, nil, err
 	}
 	pname := fmt.Sprintf("protoc-gen-%s-%s", name, version)
 	var p Paths
 	p.buildDir = filepath.Join(cacheDir, fmt.Sprintf("git-%s", pname))
-	p.binary = filepath.Join(cacheDir, pname)
+	p.binary = filepath.Join(cacheDir, binaryName(name, version))
 	lockPath := p.binary + ".lock"
 	// Grab a lock separate from the destination file. The
 	// destination file is a binary we'll want to execute, so using it
@@ -57,6 +59,82 @@ func getPaths(name, version string) (*Paths, func(error), error) {
 	return &p, cleanup, nil
 }
 
+// cacheDir returns the directory of gunk's cache, without creating it.
+func cacheDir() (string, error) {
+	// Get the OS-specific cache directory.
+	cachePath, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	if dir := os.Getenv("GUNK_CACHE_DIR"); dir != "" {
+		// Allow overriding the cache dir entirely. Mainly for
+		// the tests.
+		cachePath = dir
+	}
+	return filepath.Join(cachePath, "gunk"), nil
+}
+
+// CachedPath returns the path of the binary of a version of a plugin in the
+// cache, where Download puts it, whether it was downloaded yet or not.
+func CachedPath(name, version string) (string, error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, binaryName(name, version)), nil
+}
+
+// scriptPlugins are the plugins whose binary is a script written by
+// writeScript, running them with an interpreter.
+var scriptPlugins = map[string]bool{
+	"dart":        true,
+	"grpc-kotlin": true,
+}
+
+// binaryName returns the file name of the binary of a version of a plugin in
+// the cache. Windows only runs scripts as batch files, with a .cmd extension.
+func binaryName(name, version string) string {
+	bin := fmt.Sprintf("protoc-gen-%s-%s", name, version)
+	if scriptPlugins[name] && runtime.GOOS == "windows" {
+		bin += ".cmd"
+	}
+	return bin
+}
+
+// writeScript writes the script at path running a command with the given
+// environment variables, such as "PUB_CACHE=dir", and the arguments the script
+// is run with. It's a shell script, or a batch file on Windows.
+func writeScript(path string, env []string, command ...string) error {
+	var b strings.Builder
+	if runtime.GOOS == "windows" {
+		b.WriteString("@echo off\r\n")
+		for _, e := range env {
+			fmt.Fprintf(&b, "set \"%s\"\r\n", e)
+		}
+		for _, arg := range command {
+			fmt.Fprintf(&b, "\"%s\" ", arg)
+		}
+		b.WriteString("%*\r\n")
+	} else {
+		b.WriteString("#!/bin/sh\n")
+		for _, e := range env {
+			kv := strings.SplitN(e, "=", 2)
+			fmt.Fprintf(&b, "%s=%s ", kv[0], shellQuote(kv[1]))
+		}
+		b.WriteString("exec")
+		for _, arg := range command {
+			b.WriteString(" " + shellQuote(arg))
+		}
+		b.WriteString(" \"$@\"\n")
+	}
+	return ioutil.WriteFile(path, []byte(b.String()), 0o775)
+}
+
+// shellQuote quotes s for sh, in single quotes.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
 type Downloader interface {
 	Name() string
 	Download(version string, p Paths) (string, error)
@@ -65,6 +143,8 @@ type Downloader interface {
 var ds = []Downloader{
 	Go{},
 	GrpcJava{},
+	GrpcKotlin{},
+	GrpcCsharp{},
 	GrpcEcosystem{Type: "grpc-gateway"},
 	GrpcEcosystem{Type: "swagger"}, // deprecated
 	GrpcEcosystem{Type: "openapiv2"},
@@ -72,7 +152,14 @@ var ds = []Downloader{
 	GrpcSwift{},
 	GrpcPython{},
 	Ts{},
+	Dart{},
+	Cargo{Type: "prost"},
+	Cargo{Type: "tonic"},
+	TsProto{},
+	ProtobufEs{},
 	GrpcGo{},
+	ConnectGo{},
+	Twirp{},
 }
 
 func Has(name string) bool {
@@ -112,8 +199,21 @@ func download(d Downloader, version string) (s string, err error) {
 		if fErr != nil {
 			return "", fErr
 		}
-		return p.binary, nil
+		switch err := verifyBinary(p.binary); {
+		case err == nil:
+			stats.CacheHit(d.Name())
+			return p.binary, nil
+		case !errors.Is(err, errNoChecksum):
+			return "", err
+		}
+		// The binary can't be verified, such as one cached by older
+		// versions of gunk, so it's downloaded again.
+		log.Verbosef("%s has no recorded checksum; downloading it again", p.binary)
+		if err := os.Remove(p.binary); err != nil {
+			return "", err
+		}
 	}
+	stats.CacheMiss(d.Name())
 	// remove git clone dir here and not in cleanup,
 	// so we can more easily debug
 	// (ignore error)
@@ -133,5 +233,74 @@ func download(d Downloader, version string) (s string, err error) {
 			return "", err
 		}
 	}
+	sum, err := fileSHA256(p.binary)
+	if err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(p.binary+".sha256", []byte(sum+"\n"), 0o644); err != nil {
+		return "", err
+	}
 	return p.binary, nil
 }
+
+// errNoChecksum is returned by verifyBinary for a cached binary without a
+// recorded checksum.
+var errNoChecksum = errors.New("no checksum recorded")
+
+// verifyBinary checks that a cached binary wasn't modified since it was
+// downloaded, comparing it with the checksum recorded then. If there is none,
+// such as for the binaries cached by older versions of gunk, it returns
+// errNoChecksum, as the binary can't be trusted.
+func verifyBinary(path string) error {
+	want, err := ioutil.ReadFile(path + ".sha256")
+	if os.IsNotExist(err) {
+		return errNoChecksum
+	}
+	if err != nil {
+		return err
+	}
+	sum, err := fileSHA256(path)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(string(want)) != sum {
+		return fmt.Errorf("%s does not match the checksum recorded when it was downloaded; remove it to download it again", path)
+	}
+	return nil
+}
+
+// fileSHA256 returns the hex-encoded SHA-256 checksum of a file.
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// downloadFile downloads the file at url to a new file at path, with the given
+// permissions.
+func downloadFile(url, path string, perm os.FileMode) error {
+	res, err := http.Get(url)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return fmt.Errorf("could not retrieve %q (%d)", url, res.StatusCode)
+	}
+	dstFile, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	defer dstFile.Close()
+	if _, err := io.Copy(dstFile, res.Body); err != nil {
+		return err
+	}
+	return dstFile.Close()
+}
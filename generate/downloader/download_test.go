@@ -0,0 +1,90 @@
+package downloader
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// fakeDownloader is a Downloader writing a fixed binary, counting its
+// downloads.
+type fakeDownloader struct {
+	downloads int
+}
+
+func (d *fakeDownloader) Name() string { return "fake" }
+
+func (d *fakeDownloader) Download(version string, p Paths) (string, error) {
+	d.downloads++
+	return p.binary, ioutil.WriteFile(p.binary, []byte("downloaded"), 0o755)
+}
+
+func TestDownloadChecksum(t *testing.T) {
+	t.Setenv("GUNK_CACHE_DIR", t.TempDir())
+	path, err := CachedPath("fake", "v1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte("cached without a checksum"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	d := &fakeDownloader{}
+
+	// A cached binary without a recorded checksum is downloaded again,
+	// instead of recording the checksum of whatever it is.
+	got, err := download(d, "v1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadFile(got); string(b) != "downloaded" || d.downloads != 1 {
+		t.Fatalf("got %q after %d downloads, want it downloaded again", b, d.downloads)
+	}
+	sum, err := fileSHA256(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadFile(path + ".sha256"); strings.TrimSpace(string(b)) != sum {
+		t.Fatalf("got recorded checksum %q, want %q", b, sum)
+	}
+
+	// It's then a cache hit.
+	if _, err := download(d, "v1.0.0"); err != nil {
+		t.Fatal(err)
+	}
+	if d.downloads != 1 {
+		t.Fatalf("got %d downloads, want the binary to be cached", d.downloads)
+	}
+
+	// Unless it's modified.
+	if err := ioutil.WriteFile(path, []byte("modified"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	_, err = download(d, "v1.0.0")
+	if err == nil || !strings.Contains(err.Error(), "does not match the checksum recorded") {
+		t.Fatalf("got error %v, want a checksum mismatch", err)
+	}
+}
+
+func TestWriteScript(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the batch files written on Windows are run by cmd")
+	}
+	path := filepath.Join(t.TempDir(), "script")
+	if err := writeScript(path, []string{"GREETING=hello world"}, "sh", "-c", `echo "$GREETING" "$@" \'`, "sh"); err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command(path, "a b", "c").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(out), "hello world a b c '\n"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
@@ -2,6 +2,7 @@ package downloader
 
 import (
 	"os"
+	"path"
 	"path/filepath"
 
 	"github.com/gunk/gunk/log"
@@ -40,3 +41,28 @@ func (pd Go) Download(version string, p Paths) (string, error) {
 
 	return filepath.Join(p.buildDir, "protoc-gen-go"), nil
 }
+
+// goInstall installs the given version of a Go command in the build
+// directory, returning the path of its binary.
+func goInstall(pkg, version string, p Paths) (string, error) {
+	if err := os.MkdirAll(p.buildDir, 0o755); err != nil {
+		return "", err
+	}
+
+	buildCmd := log.ExecCommand("go", "install", pkg+"@"+version)
+	buildCmd.Dir = p.buildDir
+	buildCmd.Env = append(buildCmd.Env,
+		"GOBIN="+p.buildDir,
+		"GOPATH="+os.Getenv("GOPATH"),
+		"HOME="+os.Getenv("HOME"),
+		"PATH="+os.Getenv("PATH"),
+		"GOPROXY=https://proxy.golang.org,direct",
+	)
+	err := buildCmd.Run()
+	if err != nil {
+		all := "GOBIN=" + p.buildDir + " go install " + pkg + "@" + version
+		return "", log.ExecError(all, err)
+	}
+
+	return filepath.Join(p.buildDir, path.Base(pkg)), nil
+}
@@ -0,0 +1,91 @@
+package downloader
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// GrpcCsharp downloads grpc_csharp_plugin, which is released in the Grpc.Tools
+// NuGet package, along with protoc, for each platform.
+type GrpcCsharp struct{}
+
+func (pd GrpcCsharp) Name() string {
+	return "grpc-csharp"
+}
+
+func (pd GrpcCsharp) Download(version string, p Paths) (string, error) {
+	if !strings.HasPrefix(version, "v") {
+		return "", fmt.Errorf("invalid version: %s", version)
+	}
+	version = version[1:]
+	platform, err := pd.platform(runtime.GOOS, runtime.GOARCH)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(p.buildDir, 0o755); err != nil {
+		return "", err
+	}
+	url := "https://www.nuget.org/api/v2/package/Grpc.Tools/" + version
+	pkgPath := filepath.Join(p.buildDir, "Grpc.Tools.nupkg")
+	if err := downloadFile(url, pkgPath, 0o644); err != nil {
+		return "", err
+	}
+	rdr, err := zip.OpenReader(pkgPath)
+	if err != nil {
+		return "", err
+	}
+	defer rdr.Close()
+	name := "tools/" + platform + "/grpc_csharp_plugin"
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	for _, f := range rdr.File {
+		if f.Name != name {
+			continue
+		}
+		fc, err := f.Open()
+		if err != nil {
+			return "", err
+		}
+		defer fc.Close()
+		dstFile, err := os.OpenFile(p.binary, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o775)
+		if err != nil {
+			return "", err
+		}
+		defer dstFile.Close()
+		if _, err := io.Copy(dstFile, fc); err != nil {
+			return "", err
+		}
+		if err := dstFile.Close(); err != nil {
+			return "", err
+		}
+		return p.binary, nil
+	}
+	return "", fmt.Errorf("%s not found in Grpc.Tools %s", name, version)
+}
+
+// platform returns the directory of the Grpc.Tools package holding the
+// plugin for the platform.
+func (GrpcCsharp) platform(os, arch string) (string, error) {
+	switch {
+	case os == "darwin" && (arch == "amd64" || arch == "arm64"):
+		// use rosetta on arm64
+		return "macosx_x64", nil
+	case os == "linux" && arch == "386":
+		return "linux_x86", nil
+	case os == "linux" && arch == "amd64":
+		return "linux_x64", nil
+	case os == "linux" && arch == "arm64":
+		return "linux_arm64", nil
+	case os == "windows" && arch == "386":
+		return "windows_x86", nil
+	case os == "windows" && arch == "amd64":
+		return "windows_x64", nil
+	}
+	return "", fmt.Errorf("unknown os %q and arch %q", os, arch)
+}
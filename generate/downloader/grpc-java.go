@@ -2,9 +2,6 @@ package downloader
 
 import (
 	"fmt"
-	"io"
-	"net/http"
-	"os"
 	"runtime"
 	"strings"
 )
@@ -16,34 +13,12 @@ func (pd GrpcJava) Name() string {
 }
 
 func (pd GrpcJava) Download(version string, p Paths) (string, error) {
-	// The file does not exist. Download it, using dstFile.
+	// The file does not exist. Download it.
 	url, err := pd.downloadURL(runtime.GOOS, runtime.GOARCH, version)
 	if err != nil {
 		return "", err
 	}
-	cl := &http.Client{}
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return "", err
-	}
-	res, err := cl.Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer res.Body.Close()
-	if res.StatusCode != 200 {
-		return "", fmt.Errorf("could not retrieve %q (%d)", url, res.StatusCode)
-	}
-	dstFile, err := os.OpenFile(p.binary, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o775)
-	if err != nil {
-		return "", err
-	}
-	defer dstFile.Close()
-	// Write command to cache.
-	if _, err := io.Copy(dstFile, res.Body); err != nil {
-		return "", err
-	}
-	if err := dstFile.Close(); err != nil {
+	if err := downloadFile(url, p.binary, 0o775); err != nil {
 		return "", err
 	}
 	return p.binary, nil
@@ -0,0 +1,40 @@
+package downloader
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// GrpcKotlin downloads protoc-gen-grpc-kotlin, which is only released as a
+// jar, so the plugin is a script running it with java.
+type GrpcKotlin struct{}
+
+func (pd GrpcKotlin) Name() string {
+	return "grpc-kotlin"
+}
+
+func (pd GrpcKotlin) Download(version string, p Paths) (string, error) {
+	if !strings.HasPrefix(version, "v") {
+		return "", fmt.Errorf("invalid version: %s", version)
+	}
+	version = version[1:]
+	if _, err := exec.LookPath("java"); err != nil {
+		return "", fmt.Errorf("java is not installed")
+	}
+	if err := os.MkdirAll(p.buildDir, 0o755); err != nil {
+		return "", err
+	}
+	const mavenRepo = `https://repo1.maven.org/maven2/io/grpc/protoc-gen-grpc-kotlin`
+	url := fmt.Sprintf("%s/%s/protoc-gen-grpc-kotlin-%s-jdk8.jar", mavenRepo, version, version)
+	jar := filepath.Join(p.buildDir, "protoc-gen-grpc-kotlin.jar")
+	if err := downloadFile(url, jar, 0o644); err != nil {
+		return "", err
+	}
+	if err := writeScript(p.binary, nil, "java", "-jar", jar); err != nil {
+		return "", err
+	}
+	return p.binary, nil
+}
@@ -3,31 +3,54 @@ package downloader
 import (
 	"archive/zip"
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"runtime"
 	"strings"
 
 	"github.com/gunk/gunk/log"
+	"github.com/gunk/gunk/stats"
 	"github.com/rogpeppe/go-internal/lockedfile"
 	"golang.org/x/sys/unix"
 )
 
-const defaultProtocVersion = "v3.9.1"
+const (
+	defaultProtocVersion = "v3.9.1"
+	// protocReleasesURL is the base URL of the protoc releases, unless
+	// set otherwise with a mirror.
+	protocReleasesURL = "https://github.com/protocolbuffers/protobuf/releases/download"
+)
+
+// ProtocOptions are the optional settings of the protoc used by
+// CheckOrDownloadProtoc.
+type ProtocOptions struct {
+	// SHA256 are the accepted hex-encoded SHA-256 checksums of the protoc
+	// binary, such as one per platform. If empty, any binary is accepted.
+	SHA256 []string
+	// Mirror is the base URL of the protoc releases, or a directory
+	// holding the release archives in the same layout, to download protoc
+	// from instead of GitHub.
+	Mirror string
+}
 
 // CheckOrDownloadProtoc downloads protoc to the specified path, unless it's already
 // been downloaded. If no path is provided, it uses an OS-appropriate user cache.
 // If the version is not specified, the latest version is fetched from GitHub.
 // If both version and path are specified and a file already exists at the path,
 // it checks whether the output of `protoc --version` is an exact match.
+// If checksums are set in the options, the binary must match one of them,
+// whether it was downloaded, cached or installed on the system, before it's
+// run or anything is extracted from its release archive.
 //
 // Note that this code is safe for concurrent use between multiple goroutines or
 // processes, since it uses a lock file on disk.
-func CheckOrDownloadProtoc(path, version string) (string, error) {
+func CheckOrDownloadProtoc(path, version string, opts ProtocOptions) (_ string, err error) {
 	if version == "" {
 		version = defaultProtocVersion
 	}
@@ -36,17 +59,10 @@ func CheckOrDownloadProtoc(path, version string) (string, error) {
 	// let's keep it separate
 	dstPath := path
 	if dstPath == "" {
-		// Get the OS-specific cache directory.
-		cachePath, err := os.UserCacheDir()
+		cacheDir, err := cacheDir()
 		if err != nil {
 			return "", err
 		}
-		if dir := os.Getenv("GUNK_CACHE_DIR"); dir != "" {
-			// Allow overriding the cache dir entirely. Mainly for
-			// the tests.
-			cachePath = dir
-		}
-		cacheDir := filepath.Join(cachePath, "gunk")
 		if err := os.MkdirAll(cacheDir, 0o755); err != nil {
 			return "", err
 		}
@@ -56,7 +72,11 @@ func CheckOrDownloadProtoc(path, version string) (string, error) {
 	dstDir, _ := filepath.Split(dstPath)
 	if unix.Access(dstDir, unix.W_OK) != nil {
 		// we use unwritable dstPath (system protoc),
-		// let's not do any of the locking/downloading and just test it
+		// let's not do any of the locking/downloading and just test it,
+		// checking its checksum before running it
+		if err := verifyProtocChecksum(dstPath, opts.SHA256); err != nil {
+			return "", err
+		}
 		if err := verifyProtocBinary(dstPath, version); err != nil {
 			return "", err
 		}
@@ -77,70 +97,196 @@ func CheckOrDownloadProtoc(path, version string) (string, error) {
 	dstFile, err := lockedfile.OpenFile(dstPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o775)
 	if os.IsExist(err) {
 		// It exists. Because of O_EXCL, we haven't actually opened the
-		// file. Just verify that protoc works and return.
+		// file. Just verify that protoc is the pinned one and works, and
+		// return.
+		if err := verifyProtocChecksum(dstPath, opts.SHA256); err != nil {
+			if path == "" {
+				return "", fmt.Errorf("%w; remove it to download it again", err)
+			}
+			return "", err
+		}
 		if err := verifyProtocBinary(dstPath, version); err != nil {
 			return "", err
 		}
+		stats.CacheHit("protoc")
 		return dstPath, nil
 	}
 	if err != nil {
 		return "", err
 	}
-	defer dstFile.Close()
+	defer func() {
+		dstFile.Close()
+		if err != nil {
+			// Don't keep the binary, so that the download is
+			// retried, such as after fixing the mirror.
+			os.Remove(dstPath)
+		}
+	}()
+	stats.CacheMiss("protoc")
 	// The file does not exist. Download it, using dstFile.
-	url, err := protocDownloadURL(runtime.GOOS, runtime.GOARCH, version)
+	url, err := protocDownloadURL(runtime.GOOS, runtime.GOARCH, version, opts.Mirror)
 	if err != nil {
 		return "", fmt.Errorf("downloading protoc: %w", err)
 	}
 	// Download protoc since we were unable to find a usable
 	// protoc installation.
-	cl := &http.Client{}
-	req, err := http.NewRequest("GET", url, nil)
+	b, err := fetchProtocArchive(url)
 	if err != nil {
 		return "", err
 	}
-	res, err := cl.Do(req)
+	rdr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
 	if err != nil {
 		return "", err
 	}
-	defer res.Body.Close()
-	if res.StatusCode != 200 {
-		return "", fmt.Errorf("could not retrieve %q (%d)", url, res.StatusCode)
-	}
-	// Check the contents of the zipped folder for the protoc binary.
-	b, err := ioutil.ReadAll(res.Body)
+	// Search in the zip download for the 'protoc' command, and check it
+	// against the pinned checksums before extracting anything.
+	bin, err := readProtocBinary(rdr)
 	if err != nil {
 		return "", err
 	}
-	buf := bytes.NewReader(b)
-	rdr, err := zip.NewReader(buf, res.ContentLength)
-	if err != nil {
+	sum := sha256.Sum256(bin)
+	if err := matchProtocChecksum(url, hex.EncodeToString(sum[:]), opts.SHA256); err != nil {
+		return "", fmt.Errorf("downloaded %w", err)
+	}
+	// Extract the well-known types bundled with protoc, so that they can
+	// be found by ProtocIncludeDir.
+	if err := extractProtocInclude(rdr, dstPath+"-include"); err != nil {
+		return "", err
+	}
+	// Write protoc command to cache.
+	if _, err := dstFile.Write(bin); err != nil {
+		return "", err
+	}
+	if err := dstFile.Close(); err != nil {
+		return "", err
+	}
+	log.Verbosef("downloaded protoc to %s", dstPath)
+	if err := verifyProtocBinary(dstPath, version); err != nil {
 		return "", err
 	}
-	// Search in the zip download for the 'protoc' command.
+	return dstPath, nil
+}
+
+// readProtocBinary returns the contents of the protoc command in a protoc
+// release archive.
+func readProtocBinary(rdr *zip.Reader) ([]byte, error) {
 	for _, f := range rdr.File {
 		if f.Name != "bin/protoc" {
 			continue
 		}
 		fc, err := f.Open()
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 		defer fc.Close()
-		// Write protoc command to cache.
-		if _, err := io.Copy(dstFile, fc); err != nil {
-			return "", err
+		return ioutil.ReadAll(fc)
+	}
+	return nil, fmt.Errorf("unable to download and extract protoc")
+}
+
+// fetchProtocArchive returns the contents of the protoc release archive at
+// url, which may also be a path on disk when downloading from a directory.
+func fetchProtocArchive(url string) ([]byte, error) {
+	if !strings.Contains(url, "://") {
+		b, err := ioutil.ReadFile(url)
+		if err != nil {
+			return nil, fmt.Errorf("could not read protoc release from mirror: %w", err)
 		}
-		if err := dstFile.Close(); err != nil {
-			return "", err
+		return b, nil
+	}
+	res, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return nil, fmt.Errorf("could not retrieve %q (%d)", url, res.StatusCode)
+	}
+	return ioutil.ReadAll(res.Body)
+}
+
+// verifyProtocChecksum checks that the protoc binary at path has one of the
+// checksums, if any.
+func verifyProtocChecksum(path string, checksums []string) error {
+	if len(checksums) == 0 {
+		return nil
+	}
+	sum, err := fileSHA256(path)
+	if err != nil {
+		return err
+	}
+	return matchProtocChecksum(path, sum, checksums)
+}
+
+// matchProtocChecksum checks that sum, the checksum of the protoc binary at
+// path, is one of the checksums, if any.
+func matchProtocChecksum(path, sum string, checksums []string) error {
+	if len(checksums) == 0 {
+		return nil
+	}
+	for _, want := range checksums {
+		if strings.EqualFold(want, sum) {
+			return nil
 		}
-		log.Verbosef("downloaded protoc to %s", dstPath)
-		if err := verifyProtocBinary(dstPath, version); err != nil {
-			return "", err
+	}
+	return fmt.Errorf("protoc %s has sha256 checksum %s, which is not one of the pinned checksums", path, sum)
+}
+
+// extractProtocInclude extracts the include directory of a protoc release
+// archive to dir. Entries which would be extracted outside of dir, such as
+// "include/../../bin/sh", are refused.
+func extractProtocInclude(rdr *zip.Reader, dir string) error {
+	for _, f := range rdr.File {
+		if !strings.HasPrefix(f.Name, "include/") || f.FileInfo().IsDir() {
+			continue
+		}
+		dst := filepath.Join(dir, filepath.FromSlash(strings.TrimPrefix(f.Name, "include/")))
+		if rel, err := filepath.Rel(dir, dst); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("invalid protoc release: %q is outside of the include directory", f.Name)
+		}
+		if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+			return err
+		}
+		fc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		b, err := ioutil.ReadAll(fc)
+		fc.Close()
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(dst, b, 0o644); err != nil {
+			return err
 		}
-		return dstPath, nil
 	}
-	return "", fmt.Errorf("unable to download and extract protoc")
+	return nil
+}
+
+// ProtocIncludeDir returns the directory containing the well-known proto types
+// shipped alongside the protoc binary at protocPath, or an empty string if it
+// cannot be found.
+//
+// Both the layout used by the gunk cache, where the include directory is
+// extracted next to the binary, and the layout of a protoc release, where the
+// binary lives in bin/ and the types in include/, are checked.
+func ProtocIncludeDir(protocPath string) string {
+	if protocPath == "" {
+		var err error
+		if protocPath, err = exec.LookPath("protoc"); err != nil {
+			return ""
+		}
+	}
+	candidates := []string{
+		protocPath + "-include",
+		filepath.Join(filepath.Dir(protocPath), "..", "include"),
+	}
+	for _, dir := range candidates {
+		if _, err := os.Stat(filepath.Join(dir, "google", "protobuf", "descriptor.proto")); err == nil {
+			return filepath.Clean(dir)
+		}
+	}
+	return ""
 }
 
 func verifyProtocBinary(path, version string) error {
@@ -167,6 +313,8 @@ func verifyProtocBinary(path, version string) error {
 
 // protocDownloadURL builds a URL for retrieving for the protoc tool artifact
 // from GitHub for use with current Go runtime's GOOS and GOARCH combination.
+// If set, the mirror replaces the base URL of the GitHub releases, and may also
+// be a directory, in which case the path of the archive is returned.
 //
 // Supported os + arch variants:
 //
@@ -179,9 +327,8 @@ func verifyProtocBinary(path, version string) error {
 // 	win64
 //
 // Example: https://github.com/protocolbuffers/protobuf/releases/download/v3.9.1/protoc-3.9.1-linux-x86_64.zip
-func protocDownloadURL(os, arch, version string) (string, error) {
+func protocDownloadURL(os, arch, version, mirror string) (string, error) {
 	// retrieve the specified version's release assets
-	const protocGitHubRepo = "protocolbuffers/protobuf"
 	if !strings.HasPrefix(version, "v") {
 		return "", fmt.Errorf("invalid version: %s", version)
 	}
@@ -211,10 +358,12 @@ func protocDownloadURL(os, arch, version string) (string, error) {
 	// the version string is guaranteed to starts with "v", removing it
 	short := version[1:]
 	short = strings.ReplaceAll(short, "rc", "rc-")
-	return fmt.Sprintf("https://github.com/%s/releases/download/%s/protoc-%s-%s.zip",
-		protocGitHubRepo,
-		version,
-		short,
-		platform,
-	), nil
+	name := fmt.Sprintf("protoc-%s-%s.zip", short, platform)
+	switch {
+	case mirror == "":
+		mirror = protocReleasesURL
+	case !strings.Contains(mirror, "://"):
+		return filepath.Join(mirror, version, name), nil
+	}
+	return fmt.Sprintf("%s/%s/%s", strings.TrimSuffix(mirror, "/"), version, name), nil
 }
@@ -0,0 +1,130 @@
+package downloader
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+const fakeProtoc = "#!/bin/sh\necho libprotoc 3.9.1\n"
+
+func TestCheckOrDownloadProtocMirror(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake protoc is a shell script")
+	}
+	mirror := t.TempDir()
+	url, err := protocDownloadURL(runtime.GOOS, runtime.GOARCH, "v3.9.1", mirror)
+	if err != nil {
+		t.Skip(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(url), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	w, err := zw.Create("bin/protoc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte(fakeProtoc))
+	w, err = zw.Create("include/google/protobuf/empty.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("syntax = \"proto3\";\n"))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	// A mismatched binary is refused, and not kept in the cache.
+	cache := t.TempDir()
+	t.Setenv("GUNK_CACHE_DIR", cache)
+	wrong := strings.Repeat("0", 64)
+	_, err = CheckOrDownloadProtoc("", "v3.9.1", ProtocOptions{SHA256: []string{wrong}, Mirror: mirror})
+	if err == nil || !strings.Contains(err.Error(), "not one of the pinned checksums") {
+		t.Fatalf("got error %v, want a checksum mismatch", err)
+	}
+	path := filepath.Join(cache, "gunk", "protoc-v3.9.1")
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("mismatched protoc was kept in the cache: %v", err)
+	}
+	// Nothing is extracted from the archive before it's checked.
+	if _, err := os.Stat(path + "-include"); !os.IsNotExist(err) {
+		t.Fatalf("include directory of mismatched protoc was extracted: %v", err)
+	}
+
+	// Another of the checksums may match, such as for another platform.
+	tmp := filepath.Join(t.TempDir(), "protoc")
+	if err := ioutil.WriteFile(tmp, []byte(fakeProtoc), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	sum, err := fileSHA256(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := CheckOrDownloadProtoc("", "v3.9.1", ProtocOptions{SHA256: []string{wrong, strings.ToUpper(sum)}, Mirror: mirror})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != path {
+		t.Fatalf("got protoc %s, want %s", got, path)
+	}
+
+	// The cached binary is checked too.
+	_, err = CheckOrDownloadProtoc("", "v3.9.1", ProtocOptions{SHA256: []string{wrong}})
+	if err == nil || !strings.Contains(err.Error(), "remove it to download it again") {
+		t.Fatalf("got error %v, want a checksum mismatch of the cached protoc", err)
+	}
+
+	// A mismatched binary is never run.
+	ran := filepath.Join(t.TempDir(), "ran")
+	if err := ioutil.WriteFile(path, []byte("#!/bin/sh\ntouch "+ran+"\n"+fakeProtoc[len("#!/bin/sh\n"):]), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CheckOrDownloadProtoc("", "v3.9.1", ProtocOptions{SHA256: []string{sum}}); err == nil {
+		t.Fatal("modified protoc was accepted")
+	}
+	if _, err := os.Stat(ran); !os.IsNotExist(err) {
+		t.Fatalf("mismatched protoc was run: %v", err)
+	}
+}
+
+func TestExtractProtocIncludeOutside(t *testing.T) {
+	for _, name := range []string{
+		"include/../../escaped.proto",
+		"include/google/../../../escaped.proto",
+	} {
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte("escaped"))
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		rdr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		root := t.TempDir()
+		dir := filepath.Join(root, "cache", "protoc-include")
+		err = extractProtocInclude(rdr, dir)
+		if err == nil || !strings.Contains(err.Error(), "outside of the include directory") {
+			t.Errorf("%s: got error %v, want it refused", name, err)
+		}
+		if _, err := os.Stat(filepath.Join(root, "escaped.proto")); !os.IsNotExist(err) {
+			t.Errorf("%s: extracted outside of the include directory", name)
+		}
+	}
+}
@@ -69,3 +69,56 @@ func (g Ts) Download(version string, p Paths) (string, error) {
 	binaryPath := filepath.Join(p.buildDir, "node_modules", ".bin", "protoc-gen-ts")
 	return binaryPath, nil
 }
+
+// TsProto downloads ts-proto, the plugin used by the ts generator with
+// plugin=ts-proto.
+type TsProto struct{}
+
+func (g TsProto) Name() string {
+	return "ts_proto"
+}
+
+func (g TsProto) Download(version string, p Paths) (string, error) {
+	if err := npmInstall(p, "ts-proto", version); err != nil {
+		return "", err
+	}
+	return filepath.Join(p.buildDir, "node_modules", ".bin", "protoc-gen-ts_proto"), nil
+}
+
+// ProtobufEs downloads protobuf-es, the plugin used by the ts generator with
+// plugin=protobuf-es.
+type ProtobufEs struct{}
+
+func (g ProtobufEs) Name() string {
+	return "es"
+}
+
+func (g ProtobufEs) Download(version string, p Paths) (string, error) {
+	if err := npmInstall(p, "@bufbuild/protoc-gen-es", version); err != nil {
+		return "", err
+	}
+	return filepath.Join(p.buildDir, "node_modules", ".bin", "protoc-gen-es"), nil
+}
+
+// npmInstall installs the given version of an npm package, with its
+// dependencies, in the build directory.
+func npmInstall(p Paths, pkg, version string) error {
+	version = strings.TrimPrefix(version, "v")
+	if _, err := exec.LookPath("npm"); err != nil {
+		return fmt.Errorf("node is not installed. See https://nodejs.org/en/download/")
+	}
+	if err := os.MkdirAll(p.buildDir, 0o755); err != nil {
+		return err
+	}
+	for _, args := range [][]string{
+		{"init", "-y"},
+		{"install", pkg + "@" + version},
+	} {
+		npmCmd := log.ExecCommand("npm", args...)
+		npmCmd.Dir = p.buildDir
+		if err := npmCmd.Run(); err != nil {
+			return log.ExecError("npm "+strings.Join(args, " "), err)
+		}
+	}
+	return nil
+}
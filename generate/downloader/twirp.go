@@ -0,0 +1,11 @@
+package downloader
+
+type Twirp struct{}
+
+func (pd Twirp) Name() string {
+	return "twirp"
+}
+
+func (pd Twirp) Download(version string, p Paths) (string, error) {
+	return goInstall("github.com/twitchtv/twirp/protoc-gen-twirp", version, p)
+}
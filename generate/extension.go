@@ -0,0 +1,236 @@
+package generate
+
+import (
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/types"
+	"math"
+	"path/filepath"
+	"reflect"
+	"strconv"
+
+	"github.com/gunk/gunk/loader"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// extendableOptions maps the names of the struct types which declare custom
+// options to the descriptor option messages that they extend.
+//
+// For example, the fields of a struct named FieldOptions in a Gunk package
+// are translated as extensions of google.protobuf.FieldOptions, and the
+// struct can then be used as a "+gunk" tag on fields in any package that
+// imports it.
+var extendableOptions = map[string]string{
+	"FileOptions":      ".google.protobuf.FileOptions",
+	"MessageOptions":   ".google.protobuf.MessageOptions",
+	"FieldOptions":     ".google.protobuf.FieldOptions",
+	"ServiceOptions":   ".google.protobuf.ServiceOptions",
+	"MethodOptions":    ".google.protobuf.MethodOptions",
+	"EnumOptions":      ".google.protobuf.EnumOptions",
+	"EnumValueOptions": ".google.protobuf.EnumValueOptions",
+}
+
+// convertExtensions converts the fields of the provided struct type spec into
+// extensions of the given descriptor options message.
+func (g *Generator) convertExtensions(tspec *ast.TypeSpec, extendee string) ([]*descriptorpb.FieldDescriptorProto, error) {
+	g.addProtoDep("google/protobuf/descriptor.proto")
+	var exts []*descriptorpb.FieldDescriptorProto
+	stype := tspec.Type.(*ast.StructType)
+	for _, field := range stype.Fields.List {
+		if len(field.Names) != 1 {
+			return nil, fmt.Errorf("fields must have exactly one name")
+		}
+		fieldName := field.Names[0].Name
+		g.curPos = field.Pos()
+		g.addDoc(field, field.Doc.Text(), extensionPath, int32(len(g.pfile.Extension)+len(exts)))
+		ftype := loader.Unalias(g.curPkg.TypesInfo.TypeOf(field.Type))
+		if _, ok := ftype.(*types.Map); ok {
+			return nil, fmt.Errorf("custom option %s cannot be a map", fieldName)
+		}
+		ptype, plabel, tname, err := g.convertType(ftype)
+		if err != nil {
+			return nil, err
+		}
+		if ptype == 0 {
+			return nil, fmt.Errorf("unsupported field type: %v", ftype)
+		}
+		if field.Tag == nil {
+			return nil, fmt.Errorf("missing required tag on %s", fieldName)
+		}
+		str, _ := strconv.Unquote(field.Tag.Value)
+		tag := reflect.StructTag(str)
+		num, err := protoNumber(tag)
+		if err != nil {
+			return nil, fmt.Errorf("unable to convert tag to number on %s: %v", fieldName, err)
+		}
+		exts = append(exts, &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(fieldName),
+			Number:   num,
+			TypeName: protoStringOrNil(tname),
+			Type:     &ptype,
+			Label:    &plabel,
+			JsonName: jsonName(tag),
+			Extendee: proto.String(extendee),
+		})
+	}
+	return exts, nil
+}
+
+// customOption sets the custom options declared in a Gunk package on o, if
+// the tag refers to one of them. It reports whether the tag was a custom
+// option.
+func (g *Generator) customOption(o proto.Message, tag loader.GunkTag) (bool, error) {
+	named, ok := tag.Type.(*types.Named)
+	if !ok {
+		return false, nil
+	}
+	st, ok := named.Underlying().(*types.Struct)
+	if !ok {
+		return false, nil
+	}
+	name := named.Obj().Name()
+	extendee, ok := extendableOptions[name]
+	if !ok {
+		return false, nil
+	}
+	pkgPath := named.Obj().Pkg().Path()
+	if _, ok := g.gunkPkgs[pkgPath]; !ok {
+		return false, nil
+	}
+	if want := "." + string(o.ProtoReflect().Descriptor().FullName()); extendee != want {
+		return true, fmt.Errorf("custom option %s cannot be used as %s", tag.Type, want[1:])
+	}
+	lit, ok := tag.Expr.(*ast.CompositeLit)
+	if !ok {
+		return true, fmt.Errorf("custom option %s must be a composite literal", tag.Type)
+	}
+	b, err := g.appendStruct(nil, st, lit)
+	if err != nil {
+		return true, fmt.Errorf("invalid custom option %s: %v", tag.Type, err)
+	}
+	// Extensions which aren't linked into the binary are stored as
+	// unknown fields; their wire encoding is the same once marshaled.
+	m := o.ProtoReflect()
+	m.SetUnknown(append(m.GetUnknown(), b...))
+	g.usedImports[pkgPath] = true
+	if pkgPath == g.curPkg.PkgPath {
+		// Record the Gunk file declaring the option, in case the
+		// package is split into one proto file per Gunk file.
+		decl := pkgPath + "/" + filepath.Base(g.Fset.Position(named.Obj().Pos()).Filename)
+		deps := g.curOrigins.optionDeps
+		if deps[g.gname] == nil {
+			deps[g.gname] = make(map[string]bool)
+		}
+		deps[g.gname][decl] = true
+	}
+	return true, nil
+}
+
+// appendStruct appends the wire encoding of the keyed composite literal lit of
+// the struct type st to b.
+func (g *Generator) appendStruct(b []byte, st *types.Struct, lit *ast.CompositeLit) ([]byte, error) {
+	for _, elt := range lit.Elts {
+		kv, ok := elt.(*ast.KeyValueExpr)
+		if !ok {
+			return nil, fmt.Errorf("struct fields must be keyed")
+		}
+		key := kv.Key.(*ast.Ident).Name
+		var field *types.Var
+		var num *int32
+		for i := 0; i < st.NumFields(); i++ {
+			if st.Field(i).Name() != key {
+				continue
+			}
+			var err error
+			field = st.Field(i)
+			num, err = protoNumber(reflect.StructTag(st.Tag(i)))
+			if err != nil {
+				return nil, fmt.Errorf("unable to convert tag to number on %s: %v", key, err)
+			}
+			break
+		}
+		if field == nil {
+			return nil, fmt.Errorf("unknown field %q", key)
+		}
+		var err error
+		b, err = g.appendValue(b, protowire.Number(*num), field.Type(), kv.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", key, err)
+		}
+	}
+	return b, nil
+}
+
+// appendValue appends the wire encoding of the expression expr of type typ to
+// b, as the field with the given number.
+func (g *Generator) appendValue(b []byte, num protowire.Number, typ types.Type, expr ast.Expr) ([]byte, error) {
+	if slice, ok := typ.(*types.Slice); ok {
+		if basic, ok := slice.Elem().(*types.Basic); !ok || basic.Kind() != types.Byte {
+			lit, ok := expr.(*ast.CompositeLit)
+			if !ok {
+				return nil, fmt.Errorf("repeated values must be a composite literal")
+			}
+			for _, elt := range lit.Elts {
+				var err error
+				if b, err = g.appendValue(b, num, slice.Elem(), elt); err != nil {
+					return nil, err
+				}
+			}
+			return b, nil
+		}
+	}
+	if st, ok := typ.Underlying().(*types.Struct); ok {
+		if named, ok := typ.(*types.Named); ok {
+			switch named.String() {
+			case "time.Time", "time.Duration":
+				return nil, fmt.Errorf("%s is not supported in custom options", named)
+			}
+		}
+		lit, ok := expr.(*ast.CompositeLit)
+		if !ok {
+			return nil, fmt.Errorf("messages must be a composite literal")
+		}
+		msg, err := g.appendStruct(nil, st, lit)
+		if err != nil {
+			return nil, err
+		}
+		b = protowire.AppendTag(b, num, protowire.BytesType)
+		return protowire.AppendBytes(b, msg), nil
+	}
+	val := g.curPkg.TypesInfo.Types[expr].Value
+	if val == nil {
+		return nil, fmt.Errorf("value must be a constant")
+	}
+	basic, ok := typ.Underlying().(*types.Basic)
+	if !ok {
+		return nil, fmt.Errorf("unsupported type %v", typ)
+	}
+	switch basic.Kind() {
+	case types.Bool:
+		b = protowire.AppendTag(b, num, protowire.VarintType)
+		return protowire.AppendVarint(b, protowire.EncodeBool(constant.BoolVal(val))), nil
+	case types.String:
+		b = protowire.AppendTag(b, num, protowire.BytesType)
+		return protowire.AppendString(b, constant.StringVal(val)), nil
+	case types.Int, types.Int32, types.Int64:
+		v, _ := constant.Int64Val(val)
+		b = protowire.AppendTag(b, num, protowire.VarintType)
+		return protowire.AppendVarint(b, uint64(v)), nil
+	case types.Uint, types.Uint32, types.Uint64:
+		v, _ := constant.Uint64Val(val)
+		b = protowire.AppendTag(b, num, protowire.VarintType)
+		return protowire.AppendVarint(b, v), nil
+	case types.Float32:
+		v, _ := constant.Float32Val(val)
+		b = protowire.AppendTag(b, num, protowire.Fixed32Type)
+		return protowire.AppendFixed32(b, math.Float32bits(v)), nil
+	case types.Float64:
+		v, _ := constant.Float64Val(val)
+		b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+		return protowire.AppendFixed64(b, math.Float64bits(v)), nil
+	}
+	return nil, fmt.Errorf("unsupported type %v", typ)
+}
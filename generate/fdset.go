@@ -0,0 +1,101 @@
+package generate
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/gunk/gunk/config"
+	"github.com/gunk/gunk/protoutil"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+// generateFdset writes the FileDescriptorSet of the package requested in the
+// CodeGeneratorRequest, including all of its imports, as protoc does with
+// --include_imports. The files are named after the package, such as
+// "foo.fdset" and "foo.fdset.json", so that packages can share an output
+// directory. The "format" parameter selects whether to write the binary
+// encoding, JSON, or both.
+func (g *Generator) generateFdset(req *pluginpb.CodeGeneratorRequest, gen config.Generator) error {
+	format, _ := gen.GetParam("format")
+	var binary, json bool
+	switch format {
+	case "", "binary":
+		binary = true
+	case "json":
+		json = true
+	case "both":
+		binary, json = true, true
+	default:
+		return fmt.Errorf("unknown fdset format %q; must be binary, json or both", format)
+	}
+	ftgs := req.GetFileToGenerate()
+	if len(ftgs) == 0 {
+		return fmt.Errorf("no files to generate")
+	}
+	mainPkgPath := filepath.Clean(filepath.Dir(ftgs[0]))
+	mainPkg, ok := g.gunkPkgs[mainPkgPath]
+	if !ok {
+		return fmt.Errorf("failed to get main package: %s", mainPkgPath)
+	}
+	fds := &descriptorpb.FileDescriptorSet{File: includeImports(req)}
+	dir, err := outPath(gen, mainPkg.Dir, mainPkg.Name)
+	if err != nil {
+		return fmt.Errorf("unable to build output path for %q: %w", mainPkg.Dir, err)
+	}
+	if err := mkdirAll(dir); err != nil {
+		return fmt.Errorf("unable to create directory %q: %w", dir, err)
+	}
+	name := filepath.Join(dir, mainPkg.Name+".fdset")
+	if binary {
+		buf, err := protoutil.MarshalDeterministic(fds)
+		if err != nil {
+			return fmt.Errorf("cannot marshal deterministically: %w", err)
+		}
+		if err := g.writePkgFile(mainPkgPath, name, buf); err != nil {
+			return err
+		}
+	}
+	if json {
+		buf, err := protojson.MarshalOptions{Multiline: true}.Marshal(fds)
+		if err != nil {
+			return err
+		}
+		if err := g.writePkgFile(mainPkgPath, name+".json", append(buf, '\n')); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// includeImports returns the files to generate in the request and all the
+// files they import, directly or indirectly, in the request's topological
+// order.
+func includeImports(req *pluginpb.CodeGeneratorRequest) []*descriptorpb.FileDescriptorProto {
+	byName := make(map[string]*descriptorpb.FileDescriptorProto, len(req.ProtoFile))
+	for _, pfile := range req.ProtoFile {
+		byName[pfile.GetName()] = pfile
+	}
+	included := make(map[string]bool)
+	var include func(name string)
+	include = func(name string) {
+		if included[name] {
+			return
+		}
+		included[name] = true
+		for _, dep := range byName[name].GetDependency() {
+			include(dep)
+		}
+	}
+	for _, ftg := range req.FileToGenerate {
+		include(ftg)
+	}
+	var files []*descriptorpb.FileDescriptorProto
+	for _, pfile := range req.ProtoFile {
+		if included[pfile.GetName()] {
+			files = append(files, pfile)
+		}
+	}
+	return files
+}
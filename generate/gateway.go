@@ -0,0 +1,113 @@
+package generate
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"strings"
+	"text/template"
+
+	"github.com/gunk/gunk/config"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+// gatewayHelpersTmpl is the template of the file registering the handlers of
+// all of a package's services with grpc-gateway.
+var gatewayHelpersTmpl = template.Must(template.New("gateway").Parse(`// Code generated by gunk. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"context"
+
+	"{{.Runtime}}"
+	"google.golang.org/grpc"
+)
+
+// RegisterHandlers registers the HTTP handlers of all of the package's
+// services to mux. The requests are forwarded to the gRPC server over conn.
+func RegisterHandlers(ctx context.Context, mux *runtime.ServeMux, conn *grpc.ClientConn) error {
+{{- range .Services}}
+	if err := Register{{.}}Handler(ctx, mux, conn); err != nil {
+		return err
+	}
+{{- end}}
+	return nil
+}
+
+// RegisterHandlersFromEndpoint is like RegisterHandlers, but dials the gRPC
+// server at endpoint, closing the connection when ctx is done.
+func RegisterHandlersFromEndpoint(ctx context.Context, mux *runtime.ServeMux, endpoint string, opts []grpc.DialOption) error {
+{{- range .Services}}
+	if err := Register{{.}}HandlerFromEndpoint(ctx, mux, endpoint, opts); err != nil {
+		return err
+	}
+{{- end}}
+	return nil
+}
+`))
+
+// gatewayHelpers returns the file registering the handlers of all of the
+// services of the request with grpc-gateway, to be written next to the files
+// generated by it. It returns nil if no handlers are generated. Only the
+// services with HTTP rules have handlers, unless generate_unbound_methods is
+// set.
+func gatewayHelpers(req *pluginpb.CodeGeneratorRequest, gen config.Generator, files []*pluginpb.CodeGeneratorResponse_File) (*pluginpb.CodeGeneratorResponse_File, error) {
+	var dir string
+	for _, f := range files {
+		if strings.HasSuffix(f.GetName(), ".pb.gw.go") {
+			dir = path.Dir(f.GetName())
+			break
+		}
+	}
+	if dir == "" {
+		return nil, nil
+	}
+	unbound, _ := gen.GetParam("generate_unbound_methods")
+	generated := make(map[string]bool, len(req.FileToGenerate))
+	for _, name := range req.FileToGenerate {
+		generated[name] = true
+	}
+	var pkgName string
+	var services []string
+	for _, pf := range req.ProtoFile {
+		if !generated[pf.GetName()] {
+			continue
+		}
+		goPkg := pf.GetOptions().GetGoPackage()
+		if i := strings.LastIndex(goPkg, ";"); i >= 0 {
+			pkgName = goPkg[i+1:]
+		} else {
+			pkgName = path.Base(goPkg)
+		}
+		for _, s := range pf.Service {
+			for _, m := range s.Method {
+				if unbound == "true" || proto.HasExtension(m.GetOptions(), annotations.E_Http) {
+					services = append(services, s.GetName())
+					break
+				}
+			}
+		}
+	}
+	if len(services) == 0 {
+		return nil, nil
+	}
+	runtime := "github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	if strings.HasPrefix(gen.PluginVersion, "v1.") {
+		runtime = "github.com/grpc-ecosystem/grpc-gateway/runtime"
+	}
+	var buf bytes.Buffer
+	if err := gatewayHelpersTmpl.Execute(&buf, map[string]interface{}{
+		"Package":  pkgName,
+		"Runtime":  runtime,
+		"Services": services,
+	}); err != nil {
+		return nil, fmt.Errorf("unable to generate gateway helpers: %w", err)
+	}
+	return &pluginpb.CodeGeneratorResponse_File{
+		Name:    proto.String(path.Join(dir, "handlers.pb.gw.go")),
+		Content: proto.String(buf.String()),
+	}, nil
+}
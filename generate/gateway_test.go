@@ -0,0 +1,95 @@
+package generate
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gunk/gunk/config"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+func TestGatewayHelpers(t *testing.T) {
+	bound := &descriptorpb.MethodOptions{}
+	proto.SetExtension(bound, annotations.E_Http, &annotations.HttpRule{
+		Pattern: &annotations.HttpRule_Get{Get: "/v1/echo"},
+	})
+	req := &pluginpb.CodeGeneratorRequest{
+		FileToGenerate: []string{"example.com/api/all.proto"},
+		ProtoFile: []*descriptorpb.FileDescriptorProto{{
+			Name:    proto.String("example.com/api/all.proto"),
+			Options: &descriptorpb.FileOptions{GoPackage: proto.String("example.com/api;api")},
+			Service: []*descriptorpb.ServiceDescriptorProto{
+				{Name: proto.String("Echo"), Method: []*descriptorpb.MethodDescriptorProto{
+					{Name: proto.String("Echo"), Options: bound},
+				}},
+				{Name: proto.String("Internal"), Method: []*descriptorpb.MethodDescriptorProto{
+					{Name: proto.String("Ping")},
+				}},
+			},
+		}},
+	}
+	files := []*pluginpb.CodeGeneratorResponse_File{
+		{Name: proto.String("example.com/api/all.pb.gw.go")},
+	}
+	tests := []struct {
+		name      string
+		gen       config.Generator
+		want      []string
+		wantNotIn []string
+	}{
+		{
+			name: "bound",
+			gen:  config.Generator{Command: "protoc-gen-grpc-gateway"},
+			want: []string{
+				"package api\n",
+				`"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"`,
+				"RegisterEchoHandler(ctx, mux, conn)",
+				"RegisterEchoHandlerFromEndpoint(ctx, mux, endpoint, opts)",
+			},
+			wantNotIn: []string{"RegisterInternalHandler"},
+		},
+		{
+			name: "unbound",
+			gen: config.Generator{
+				Command:       "protoc-gen-grpc-gateway",
+				PluginVersion: "v1.16.0",
+				Params:        []config.KeyValue{{Key: "generate_unbound_methods", Value: "true"}},
+			},
+			want: []string{
+				`"github.com/grpc-ecosystem/grpc-gateway/runtime"`,
+				"RegisterEchoHandler(ctx, mux, conn)",
+				"RegisterInternalHandler(ctx, mux, conn)",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f, err := gatewayHelpers(req, test.gen, files)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if f == nil {
+				t.Fatal("no helpers generated")
+			}
+			if name := f.GetName(); name != "example.com/api/handlers.pb.gw.go" {
+				t.Errorf("wrong file name %q", name)
+			}
+			for _, s := range test.want {
+				if !strings.Contains(f.GetContent(), s) {
+					t.Errorf("%q not found in:\n%s", s, f.GetContent())
+				}
+			}
+			for _, s := range test.wantNotIn {
+				if strings.Contains(f.GetContent(), s) {
+					t.Errorf("%q found in:\n%s", s, f.GetContent())
+				}
+			}
+		})
+	}
+	if f, err := gatewayHelpers(req, config.Generator{}, nil); err != nil || f != nil {
+		t.Errorf("helpers generated without gateway files: %v, %v", f, err)
+	}
+}
@@ -2,16 +2,19 @@ package generate
 
 import (
 	"bytes"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"go/ast"
 	"go/constant"
 	"go/token"
 	"go/types"
+	"io"
 	"io/ioutil"
+	"math"
 	"os"
 	"path/filepath"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -21,22 +24,58 @@ import (
 	"github.com/gunk/gunk/config"
 	"github.com/gunk/gunk/generate/doc"
 	"github.com/gunk/gunk/generate/downloader"
+	"github.com/gunk/gunk/generate/inprocess"
+	"github.com/gunk/gunk/lint"
 	"github.com/gunk/gunk/loader"
 	"github.com/gunk/gunk/log"
+	"github.com/gunk/gunk/plugin"
 	"github.com/gunk/gunk/protoutil"
 	"github.com/gunk/gunk/reflectutil"
-	"github.com/karelbilek/dirchanges"
+	"github.com/pkg/diff"
 	"golang.org/x/sync/errgroup"
 	"google.golang.org/genproto/googleapis/api/annotations"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/types/descriptorpb"
 	"google.golang.org/protobuf/types/pluginpb"
 )
 
 // Run generates the specified Gunk packages via protobuf generators, writing
 // the output files in the same directories.
+//
+// Packages in other modules than dir's, such as a schemas module used by a
+// service module via a replace directive, are generated from the root of their
+// module, with a separate Generator.
 func Run(dir string, args ...string) error {
+	if Local {
+		if len(args) > 1 || len(args) == 1 && args[0] != "." {
+			return fmt.Errorf("only the package in the current directory can be generated in local mode")
+		}
+	}
+	roots, err := loader.SplitRoots(dir, args...)
+	if err != nil {
+		return err
+	}
+	for _, root := range roots {
+		if err := run(root.Dir, root.Patterns...); err != nil {
+			return err
+		}
+	}
+	if DryRun {
+		dryRunFiles.print(os.Stdout)
+	}
+	if Diff {
+		if n := dryRunFiles.printDiffs(os.Stdout); n > 0 {
+			return fmt.Errorf("%d generated files differ", n)
+		}
+	}
+	return nil
+}
+
+// run generates the specified Gunk packages of a single module.
+func run(dir string, args ...string) error {
 	g := NewGenerator(dir)
+	g.Loader.Local = Local
 	// Check that protoc exists, if not download it.
 	pkgs, err := g.Load(args...)
 	if err != nil {
@@ -54,37 +93,55 @@ func Run(dir string, args ...string) error {
 	pkgConfigs := map[string]*config.Config{}
 	// Translate the packages from Gunk to Proto.
 	for _, pkg := range pkgs {
-		cfg, err := config.Load(pkg.Dir)
+		cfg, err := g.loadConfig(pkg.Dir)
 		if err != nil {
 			return fmt.Errorf("unable to load gunkconfig: %w", err)
 		}
 		pkgConfigs[pkg.Dir] = cfg
-		if err := g.translatePkg(pkg.PkgPath); err != nil {
+		if cfg.Lint.TodoFailGenerate && !cfg.Lint.TodoAllowed(pkg.PkgPath) {
+			if errs := lint.TodoMarkers(g.Fset, pkg); len(errs) > 0 {
+				for _, err := range errs {
+					fmt.Fprintln(os.Stderr, err)
+				}
+				return fmt.Errorf("doc comments of %s contain TODO markers", pkg.PkgPath)
+			}
+		}
+		if err := g.translatePkg(pkg.PkgPath, cfg); err != nil {
 			return fmt.Errorf("unable to translate pkg: %w", err)
 		}
 	}
 	// hack: take protoc config from the first package
 	firstPkg := pkgs[0]
 	cfg := pkgConfigs[firstPkg.Dir]
-	protocPath, err := downloader.CheckOrDownloadProtoc(cfg.ProtocPath, cfg.ProtocVersion)
+	protocPath, err := downloader.CheckOrDownloadProtoc(cfg.ProtocPath, cfg.ProtocVersion, protocOptions(cfg))
 	if err != nil {
 		return fmt.Errorf("unable to check or download protoc: %w", err)
 	}
 	g.protoLoader.ProtocPath = protocPath
+	g.protoLoader.IncludePaths = cfg.IncludePaths
+	if dir := downloader.ProtocIncludeDir(protocPath); dir != "" {
+		g.protoLoader.IncludePaths = append(g.protoLoader.IncludePaths, dir)
+	}
 	// Load any non-Gunk proto dependencies.
 	if err := g.loadProtoDeps(); err != nil {
 		return fmt.Errorf("unable to load protodeps: %w", err)
 	}
+	// The packages are translated, so their syntax and types can be
+	// freed while the code is generated.
+	pkgs = g.endTranslation(pkgs, pkgConfigs)
 	// Run the code generators.
 	var wg errgroup.Group
+	sem := make(chan struct{}, maxConcurrentPkgs)
 	for _, pkg := range pkgs {
 		cfg := pkgConfigs[pkg.Dir]
-		protocPath, err := downloader.CheckOrDownloadProtoc(cfg.ProtocPath, cfg.ProtocVersion)
+		protocPath, err := downloader.CheckOrDownloadProtoc(cfg.ProtocPath, cfg.ProtocVersion, protocOptions(cfg))
 		if err != nil {
 			return fmt.Errorf("unable to check or download protoc: %w", err)
 		}
 		pkg := pkg
 		wg.Go(func() error {
+			sem <- struct{}{}
+			defer func() { <-sem }()
 			if err := g.GeneratePkg(pkg.PkgPath, cfg.Generators, protocPath); err != nil {
 				return fmt.Errorf("unable to generate pkg %s: %w", pkg.PkgPath, err)
 			}
@@ -106,42 +163,66 @@ func Run(dir string, args ...string) error {
 			return fmt.Errorf("unable to generate docs: %w", err)
 		}
 	}
+	for _, pkg := range pkgs {
+		if pkg.Dir == "" {
+			// Loaded from a list of files; there is no package
+			// directory for the manifest.
+			continue
+		}
+		if err := g.writeManifest(pkg.PkgPath, pkg.Dir); err != nil {
+			return fmt.Errorf("unable to write manifest of %s: %w", pkg.PkgPath, err)
+		}
+	}
 	return nil
 }
 
+// protocOptions returns the checksums and mirror of protoc set in the
+// [protoc] section of a configuration.
+func protocOptions(cfg *config.Config) downloader.ProtocOptions {
+	return downloader.ProtocOptions{SHA256: cfg.ProtocSHA256, Mirror: cfg.ProtocMirror}
+}
+
 // FileDescriptorSet will load a single Gunk package, and return the
 // proto FileDescriptor set of the Gunk package.
 //
 // Currently, we only generate a FileDescriptorSet for one Gunk package.
 func FileDescriptorSet(dir string, args ...string) (*descriptorpb.FileDescriptorSet, error) {
-	// TODO: share code with Run; much of this function is identical.
-	g := NewGenerator(dir)
-	pkgs, err := g.Load(args...)
+	pkgs, fds, err := LoadDescriptors(dir, args...)
 	if err != nil {
 		return nil, err
 	}
 	if len(pkgs) != 1 {
 		return nil, fmt.Errorf("can only get FileDescriptorSet for a single Gunk package")
 	}
+	return fds, nil
+}
+
+// LoadDescriptors will load the Gunk packages, and return them along with a
+// proto FileDescriptorSet holding the files of all of the packages and of
+// their dependencies, in topological order.
+func LoadDescriptors(dir string, args ...string) ([]*loader.GunkPackage, *descriptorpb.FileDescriptorSet, error) {
+	// TODO: share code with Run; much of this function is identical.
+	g := NewGenerator(dir)
+	pkgs, err := g.Load(args...)
+	if err != nil {
+		return nil, nil, err
+	}
 	if loader.PrintErrors(pkgs) > 0 {
-		return nil, fmt.Errorf("encountered package loading errors")
+		return nil, nil, fmt.Errorf("encountered package loading errors")
 	}
 	// Record the loaded packages in gunkPkgs.
 	g.recordPkgs(pkgs...)
 	// Translate the packages from Gunk to Proto.
 	for _, pkg := range pkgs {
-		if err := g.translatePkg(pkg.PkgPath); err != nil {
-			return nil, err
+		if err := g.translatePkg(pkg.PkgPath, nil); err != nil {
+			return nil, nil, err
 		}
 	}
 	// Load any non-Gunk proto dependencies.
 	if err := g.loadProtoDeps(); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	// Generate the filedescriptorset for the Gunk package.
-	req := g.newCodeGenRequest(pkgs[0].PkgPath)
-	fds := &descriptorpb.FileDescriptorSet{File: req.ProtoFile}
-	return fds, nil
+	return pkgs, &descriptorpb.FileDescriptorSet{File: g.sortedProtoFiles()}, nil
 }
 
 // NewGenerator returns an initialized Generator with the provided dir.
@@ -154,6 +235,8 @@ func NewGenerator(dir string) *Generator {
 		},
 		gunkPkgs:    make(map[string]*loader.GunkPackage),
 		allProto:    make(map[string]*descriptorpb.FileDescriptorProto),
+		origins:     make(map[string]*protoOrigins),
+		splitProto:  make(map[string]bool),
 		protoLoader: &loader.ProtoLoader{},
 		docMutex:    new(sync.Mutex),
 	}
@@ -164,9 +247,11 @@ type Generator struct {
 	curPkg *loader.GunkPackage               // current package being translated or generated
 	curPos token.Pos                         // current position of the token being evaluated
 	gfile  *ast.File                         // current Go file being translated
+	gname  string                            // name of gfile, as listed in GunkNames
 	pfile  *descriptorpb.FileDescriptorProto // current protobuf file being translated into
 
-	usedImports map[string]bool // imports being used for the current package
+	usedImports  map[string]bool // imports being used for the current package
+	wrapperTypes bool            // whether the current package maps pointers to wrapper types
 	// Maps from package import path to package information.
 	gunkPkgs map[string]*loader.GunkPackage
 	// imported proto files will be loaded using protoLoader
@@ -174,12 +259,28 @@ type Generator struct {
 	protoLoader *loader.ProtoLoader
 	// All protobuf that has been translated currently.
 	allProto map[string]*descriptorpb.FileDescriptorProto
+	// origins records where the declarations of each file in allProto were
+	// translated from, and curOrigins those of the current package.
+	origins    map[string]*protoOrigins
+	curOrigins *protoOrigins
+	// splitProto holds the files in allProto which are generated as one
+	// proto file per Gunk file.
+	splitProto map[string]bool
 	// docMutex is the mutex guarding doc generation as it is designed to be
 	// used in a single-threaded context.
 	docMutex *sync.Mutex
+	// outputs holds the files generated for each package, which are listed
+	// in their manifests.
+	outputs pkgOutputs
 	// docPkgs holds the packages by the doc generator.
 	// stored so that they can be tagged before generation
 	docPkgs []*doc.Package
+	// nestedNames holds the protobuf names of the nested types of each
+	// package, relative to it, by package path and type name.
+	nestedNames map[string]map[string]string
+	// nestedTypes holds the nested types of the current package, by the
+	// name of the message they are nested in.
+	nestedTypes map[string][]*ast.TypeSpec
 	// Next indexes to use for message, service and enum.
 	messageIndex int32
 	serviceIndex int32
@@ -247,8 +348,26 @@ func (g *Generator) GeneratePkg(path string, gens []config.Generator, protocPath
 	// generator unaltered; this is what protoc does when calling out to the
 	// generators and the generators should already handle the case where they
 	// have nothing to do.
-	req := g.newCodeGenRequest(path)
+	splitReq, err := g.splitCodeGenRequest(g.newCodeGenRequest(path))
+	if err != nil {
+		return err
+	}
+	req := &codeGenRequest{CodeGeneratorRequest: splitReq}
 	for _, gen := range gens {
+		if pkg := g.gunkPkgs[path]; pkg != nil && !gen.MatchesPackage(pkg.Dir, pkg.PkgPath) {
+			continue
+		}
+		if len(gen.ModuleMappings) > 0 && gen.IsSwift() {
+			var cleanup func()
+			gen, cleanup, err = withModuleMappings(req.CodeGeneratorRequest, gen)
+			if err != nil {
+				return fmt.Errorf("unable to write module mappings: %w", err)
+			}
+			defer cleanup()
+		}
+		if len(gen.ModuleMappings) > 0 && gen.IsRust() {
+			gen = withExternPaths(req.CodeGeneratorRequest, gen)
+		}
 		switch {
 		case gen.IsDoc():
 			// store the generator for output use
@@ -262,11 +381,47 @@ func (g *Generator) GeneratePkg(path string, gens []config.Generator, protocPath
 			g.docPkgs = append(g.docPkgs, docPkg)
 			// Unlock here instead of deferring because this is done in a loop.
 			g.docMutex.Unlock()
+		case gen.IsFdset():
+			if err := g.generateFdset(req.CodeGeneratorRequest, gen); err != nil {
+				return fmt.Errorf("unable to generate fdset: %w", err)
+			}
+		case gen.IsBufImage():
+			if err := g.generateBufImage(req.CodeGeneratorRequest, gen); err != nil {
+				return fmt.Errorf("unable to generate buf image: %w", err)
+			}
+		case gen.IsAccess():
+			if err := g.generateAccess(req.CodeGeneratorRequest, gen); err != nil {
+				return fmt.Errorf("unable to generate access control data: %w", err)
+			}
+		case gen.IsOpenAPI():
+			if err := g.generateOpenAPI(req.CodeGeneratorRequest, gen); err != nil {
+				return fmt.Errorf("unable to generate openapi: %w", err)
+			}
+		case gen.IsGraphQL():
+			if err := g.generateGraphQL(req.CodeGeneratorRequest, gen); err != nil {
+				return fmt.Errorf("unable to generate graphql: %w", err)
+			}
+		case gen.IsMock():
+			if err := g.generateMock(req.CodeGeneratorRequest, gen); err != nil {
+				return fmt.Errorf("unable to generate mocks: %w", err)
+			}
+		case gen.IsScaffold():
+			if err := g.generateScaffold(req.CodeGeneratorRequest, gen); err != nil {
+				return fmt.Errorf("unable to generate scaffold: %w", err)
+			}
+		case gen.IsServiceConfig():
+			if err := g.generateServiceConfig(req.CodeGeneratorRequest, gen); err != nil {
+				return fmt.Errorf("unable to generate service config: %w", err)
+			}
+		case gen.IsMain():
+			if err := g.generateMain(req.CodeGeneratorRequest, gen); err != nil {
+				return fmt.Errorf("unable to generate main: %w", err)
+			}
 		case gen.IsProtoc():
 			if gen.PluginVersion != "" {
 				return fmt.Errorf("cannot use pinned version with protoc option")
 			}
-			if err := g.generateProtoc(*req, gen, protocPath); err != nil {
+			if err := g.generateProtoc(req, gen, protocPath); err != nil {
 				return fmt.Errorf("unable to generate protoc: %w", err)
 			}
 		default:
@@ -282,7 +437,7 @@ func (g *Generator) GeneratePkg(path string, gens []config.Generator, protocPath
 				}
 				c.binary = &bin
 			}
-			if err := g.generatePlugin(*req, c); err != nil {
+			if err := g.generatePlugin(req, c); err != nil {
 				return fmt.Errorf("unable to generate plugin: %w", err)
 			}
 		}
@@ -292,50 +447,67 @@ func (g *Generator) GeneratePkg(path string, gens []config.Generator, protocPath
 
 // generateProtoc invokes protoc to generate the package specified in the
 // CodeGeneratorRequest and applies post processing if applicable. It expects
-// exactly one file to be requested in CodeGeneratorRequest.
-func (g *Generator) generateProtoc(req pluginpb.CodeGeneratorRequest, gen config.Generator, protocCommandPath string) error {
+// the files requested in CodeGeneratorRequest to belong to a single package.
+func (g *Generator) generateProtoc(req *codeGenRequest, gen config.Generator, protocCommandPath string) error {
 	// Default location to output protoc generated files.
 	ftgs := req.GetFileToGenerate()
-	if len(ftgs) != 1 {
-		return fmt.Errorf("unexpected length of fileToGenerate: %d (%+v)", len(ftgs), ftgs)
-	}
-	// req.GetFileToGenerate() is always just 1 field, as we create the request
-	// and it has just the one proto file
-	ftg := ftgs[0]
-	mainPkgPath, basename := filepath.Split(ftg)
-	mainPkgPath = filepath.Clean(mainPkgPath)
+	if len(ftgs) == 0 {
+		return fmt.Errorf("no files to generate")
+	}
+	// req.GetFileToGenerate() is either the package's single all.proto
+	// file, or one file per Gunk file if the package is split.
+	mainPkgPath := filepath.Clean(filepath.Dir(ftgs[0]))
 	mainPkg, ok := g.gunkPkgs[mainPkgPath]
 	if !ok {
 		return fmt.Errorf("failed to get main package: %s", mainPkgPath)
 	}
-	// Make a copy of the slice, as we may modify the elements within in the
-	// pf2 copying below.
-	fds := &descriptorpb.FileDescriptorSet{}
-	fds.File = make([]*descriptorpb.FileDescriptorProto, len(req.ProtoFile))
-	copy(fds.File, req.ProtoFile)
 	// protoc writes the output files directly, unlike the
 	// protoc-gen-* plugin generators.
 	// As such, we need to give it the right basenames and output
 	// directory, so that it writes the files in the right place.
-	for i, pf := range fds.File {
-		if pf.GetName() == ftg {
-			// Make a copy, to not modify the files for
-			// other generators too.
-			pf2 := *pf
-			pf2.Name = proto.String(basename)
-			fds.File[i] = &pf2
-		}
+	basenames := make(map[string]string, len(ftgs))
+	for _, ftg := range ftgs {
+		basenames[ftg] = filepath.Base(ftg)
 	}
-	// Because we merge all .gunk files into one 'all.proto' file,
+	// Because all the files to generate are from the same package,
 	// we can use that package path on disk as the default location
 	// to output generated files.
 	gpkg, ok := g.findPkg(mainPkgPath)
 	if !ok {
 		return fmt.Errorf("failed to get package %s to protoc generate", mainPkgPath)
 	}
-	buf, err := protoutil.MarshalDeterministic(fds)
-	if err != nil {
-		return fmt.Errorf("cannot marshal deterministically: %w", err)
+	// The descriptor set is the same for all of the package's protoc
+	// generators, so it's only encoded once.
+	if req.protocBuf == nil {
+		// Make a copy of the slice, as we may modify the elements within in the
+		// pf2 copying below.
+		fds := &descriptorpb.FileDescriptorSet{}
+		fds.File = make([]*descriptorpb.FileDescriptorProto, len(req.ProtoFile))
+		copy(fds.File, req.ProtoFile)
+		for i, pf := range fds.File {
+			basename, ok := basenames[pf.GetName()]
+			if !ok {
+				continue
+			}
+			// Make a copy, to not modify the files for
+			// other generators too.
+			pf2 := *pf
+			pf2.Name = proto.String(basename)
+			// Split files may depend on each other.
+			pf2.Dependency = make([]string, len(pf.Dependency))
+			for j, dep := range pf.Dependency {
+				if name, ok := basenames[dep]; ok {
+					dep = name
+				}
+				pf2.Dependency[j] = dep
+			}
+			fds.File[i] = &pf2
+		}
+		buf, err := protoutil.MarshalDeterministic(fds)
+		if err != nil {
+			return fmt.Errorf("cannot marshal deterministically: %w", err)
+		}
+		req.protocBuf = buf
 	}
 	// output dir
 	protocOutputPath := gpkg.Dir
@@ -348,89 +520,196 @@ func (g *Generator) generateProtoc(req pluginpb.CodeGeneratorRequest, gen config
 			return fmt.Errorf("unable to create directory %q: %w", outDir, err)
 		}
 	}
+	// protoc gives us no hint of what files it generated, so have it
+	// write them to a temporary directory first. They are then moved to
+	// the output directory, post processing them if applicable, which
+	// leaves the files which didn't change untouched.
+	tmpDir, err := ioutil.TempDir("", "gunk-protoc")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
 	// Build up the protoc command line arguments.
-	param := paramStringWithOut(gen, outDir)
+	param := paramStringWithOut(gen, tmpDir)
 	args := []string{
 		fmt.Sprintf("--%s_out=%s", gen.ProtocGen, param),
 		"--descriptor_set_in=/dev/stdin",
-		basename,
-	}
-	var d *dirchanges.Watcher
-	// if we have postproc - try to watch for new files (ignore otherwise)
-	// unfortunately, protoc gives us no hint of what files it generated
-	// so we look for FS changes
-	if gen.HasPostproc() {
-		d = dirchanges.New()
-		if err := d.AddRecursive(protocOutputPath); err != nil {
+	}
+	for _, ftg := range ftgs {
+		args = append(args, basenames[ftg])
+	}
+	// protoc is run like the plugins, with their timeout, maximum output
+	// and environment.
+	if _, err := runPluginCommand(gen, bytes.NewReader(req.protocBuf), protocCommandPath, args...); err != nil {
+		return err
+	}
+	return filepath.Walk(tmpDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
 			return err
 		}
-		d.FilterOps(dirchanges.Write, dirchanges.Move, dirchanges.Rename, dirchanges.Create)
-	}
-	cmd := log.ExecCommand(protocCommandPath, args...)
-	cmd.Stdin = bytes.NewReader(buf)
-	if _, err := cmd.Output(); err != nil {
-		// TODO: For now, output the command name directly as
-		// we actually use the /path/to/protoc when executing
-		// the command, but this gives slightly uglier error
-		// messages. Not sure what is best to do here, but
-		// it should be consistent with running protoc-gen-*
-		// errors (which currently don't use the /path/to/protoc-gen).
-		return log.ExecError("protoc", err)
-	}
-	if gen.HasPostproc() {
-		ev, err := d.Diff()
+		rel, err := filepath.Rel(tmpDir, path)
 		if err != nil {
-			return fmt.Errorf("file diff error: %w", err)
-		}
-		for _, ev := range ev {
-			if !ev.IsDir() {
-				bs, err := ioutil.ReadFile(ev.Path)
-				var nbs []byte
-				if nbs, err = postProcess(bs, gen, mainPkgPath, g.gunkPkgs); err != nil {
-					return fmt.Errorf("failed to execute post processing: %w", err)
-				}
-				if err := ioutil.WriteFile(ev.Path, nbs, ev.Mode()); err != nil {
-					return fmt.Errorf("failed to write to file: %w", err)
-				}
+			return err
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if gen.HasPostproc() {
+			if data, err = postProcess(data, gen, mainPkgPath, g.gunkPkgs); err != nil {
+				return fmt.Errorf("failed to execute post processing: %w", err)
 			}
 		}
+		outPath := filepath.Join(outDir, rel)
+		if err := mkdirAll(filepath.Dir(outPath)); err != nil {
+			return fmt.Errorf("unable to create directory %q: %w", filepath.Dir(outPath), err)
+		}
+		if err := g.writePkgFile(mainPkgPath, outPath, data); err != nil {
+			return fmt.Errorf("unable to write to file %q: %w", outPath, err)
+		}
+		return nil
+	})
+}
+
+// wasmPath returns the path of the wasm plugin of the generator, which is
+// relative to its .gunkconfig.
+func wasmPath(gen config.Generator) string {
+	if filepath.IsAbs(gen.Wasm) {
+		return gen.Wasm
+	}
+	return filepath.Join(gen.ConfigDir, gen.Wasm)
+}
+
+// pluginRequest returns the request for a generator running within gunk, with
+// the parameter if it's not empty.
+func pluginRequest(req *codeGenRequest, param string) *pluginpb.CodeGeneratorRequest {
+	r := &pluginpb.CodeGeneratorRequest{
+		FileToGenerate:  req.FileToGenerate,
+		ProtoFile:       req.ProtoFile,
+		CompilerVersion: req.CompilerVersion,
+	}
+	if param != "" {
+		r.Parameter = proto.String(param)
+	}
+	return r
+}
+
+// checkFeatures returns an error if the files to generate of the request use
+// features which the response doesn't declare as supported, since the
+// generator likely ignored them and wrote broken code.
+func checkFeatures(req *pluginpb.CodeGeneratorRequest, resp *pluginpb.CodeGeneratorResponse) error {
+	supported := plugin.Feature(resp.GetSupportedFeatures())
+	isTarget := make(map[string]bool, len(req.FileToGenerate))
+	for _, name := range req.FileToGenerate {
+		isTarget[name] = true
+	}
+	for _, pfile := range req.ProtoFile {
+		if !isTarget[pfile.GetName()] {
+			continue
+		}
+		if pfile.GetSyntax() == "editions" && supported&plugin.FeatureSupportsEditions == 0 {
+			return fmt.Errorf("does not support %s, used by %s", plugin.FeatureSupportsEditions, pfile.GetName())
+		}
+		if supported&plugin.FeatureProto3Optional != 0 {
+			continue
+		}
+		if field := proto3OptionalField(pfile.GetPackage(), pfile.GetMessageType()); field != "" {
+			return fmt.Errorf("does not support %s, used by %s", plugin.FeatureProto3Optional, field)
+		}
 	}
 	return nil
 }
 
-// generatePlugin invokes the specified binary in the config with the package
-// requested in CodeGeneratorRequest. It expects exactly one file to be
-// requested in CodeGeneratorRequest.
-func (g *Generator) generatePlugin(req pluginpb.CodeGeneratorRequest, gen configWithBinary) error {
-	// Due to problems with some generators (grpc-gateway),
-	// we need to ensure we either send a non-empty string or nil.
-	if ps := gen.ParamString(); ps != "" {
-		req.Parameter = proto.String(ps)
+// proto3OptionalField returns the full name of the first proto3 optional field
+// of the messages, including the nested ones, or "" if there are none.
+func proto3OptionalField(scope string, msgs []*descriptorpb.DescriptorProto) string {
+	for _, msg := range msgs {
+		name := msg.GetName()
+		if scope != "" {
+			name = scope + "." + name
+		}
+		for _, field := range msg.GetField() {
+			if field.GetProto3Optional() {
+				return name + "." + field.GetName()
+			}
+		}
+		if field := proto3OptionalField(name, msg.GetNestedType()); field != "" {
+			return field
+		}
 	}
-	bs, err := protoutil.MarshalDeterministic(&req)
+	return ""
+}
+
+// runPlugin runs a plugin generator on the request, within gunk if it's set
+// to run in process or registered with the plugin package, remotely if it's a
+// remote plugin, or with wazero within gunk if it's compiled to WASI.
+func (g *Generator) runPlugin(req *codeGenRequest, gen configWithBinary) (*pluginpb.CodeGeneratorResponse, error) {
+	if gen.Remote != nil {
+		return runRemotePlugin(req.CodeGeneratorRequest, gen.Generator, gen.ParamString())
+	}
+	if gen.InProcess {
+		log.Verbosef("running %s in process", gen.Code())
+		return inprocess.Generate(gen.Code(), pluginRequest(req, gen.ParamString()))
+	}
+	if fn, ok := plugin.Lookup(gen.Code()); ok && gen.Wasm == "" && gen.binary == nil {
+		log.Verbosef("running registered generator %s", gen.Code())
+		resp, err := fn(pluginRequest(req, gen.ParamString()))
+		if err != nil {
+			return nil, fmt.Errorf("error from generator %s: %w", gen.Command, err)
+		}
+		return resp, nil
+	}
+	// Due to problems with some generators (grpc-gateway),
+	// we need to ensure we either send a non-empty string or nil,
+	// which reader does.
+	stdin, err := req.reader(gen.ParamString())
 	if err != nil {
-		return fmt.Errorf("cannot marshal deterministically: %w", err)
+		return nil, fmt.Errorf("cannot marshal deterministically: %w", err)
+	}
+	var out []byte
+	if gen.Wasm != "" {
+		out, err = runWasmPlugin(gen.Generator, stdin)
+	} else {
+		out, err = runPluginCommand(gen.Generator, stdin, gen.actualCommand())
 	}
-	cmd := log.ExecCommand(gen.actualCommand())
-	cmd.Stdin = bytes.NewReader(bs)
-	out, err := cmd.Output()
 	if err != nil {
-		return log.ExecError(gen.actualCommand(), err)
+		return nil, err
 	}
 	var resp pluginpb.CodeGeneratorResponse
 	if err := proto.Unmarshal(out, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// generatePlugin invokes the specified binary in the config with the package
+// requested in CodeGeneratorRequest. It expects the files requested in
+// CodeGeneratorRequest to belong to a single package.
+func (g *Generator) generatePlugin(req *codeGenRequest, gen configWithBinary) error {
+	resp, err := g.runPlugin(req, gen)
+	if err != nil {
 		return err
 	}
 	if rerr := resp.GetError(); rerr != "" {
-		return fmt.Errorf("error from generator %s: %s", gen.Command, rerr)
+		return fmt.Errorf("error from generator %s: %s", gen.Command, g.gunkPositions(rerr))
+	}
+	if err := checkFeatures(req.CodeGeneratorRequest, resp); err != nil {
+		return fmt.Errorf("generator %s %w", gen.Command, err)
+	}
+	if gen.RegisterHelpers {
+		f, err := gatewayHelpers(req.CodeGeneratorRequest, gen.Generator, resp.File)
+		if err != nil {
+			return err
+		}
+		if f != nil {
+			resp.File = append(resp.File, f)
+		}
 	}
 	ftgs := req.GetFileToGenerate()
-	if len(ftgs) != 1 {
-		return fmt.Errorf("unexpected length of fileToGenerate: %d (%+v)", len(ftgs), ftgs)
+	if len(ftgs) == 0 {
+		return fmt.Errorf("no files to generate")
 	}
-	ftg := ftgs[0]
-	mainPkgPath, _ := filepath.Split(ftg)
-	mainPkgPath = filepath.Clean(mainPkgPath)
+	mainPkgPath := filepath.Clean(filepath.Dir(ftgs[0]))
 	mainPkg, ok := g.gunkPkgs[mainPkgPath]
 	if !ok {
 		return fmt.Errorf("failed to get main package: %s", mainPkgPath)
@@ -444,13 +723,16 @@ func (g *Generator) generatePlugin(req pluginpb.CodeGeneratorRequest, gen config
 		pkgPath = filepath.Clean(pkgPath) // to remove trailing slashes
 
 		var dir string
+		// name is the path of the file relative to dir.
+		name := basename
 
 		gpkg, isGunkPkg := g.gunkPkgs[pkgPath]
 		if !isGunkPkg {
-			// Use the longest prefix match if it's not found in gunkPkgs.
+			// Use the longest prefix match if it's not found in gunkPkgs,
+			// such as for the subpackages written by connect-go.
 			matching := ""
 			for path, pkg := range g.gunkPkgs {
-				if strings.HasPrefix(pkgPath, path) {
+				if strings.HasPrefix(pkgPath, path+"/") {
 					if len(path) > len(matching) {
 						ok = true
 						matching = path
@@ -472,6 +754,7 @@ func (g *Generator) generatePlugin(req pluginpb.CodeGeneratorRequest, gen config
 				if err != nil {
 					return fmt.Errorf("unable to build dir: %q: %w", gpkg.Dir, err)
 				}
+				name = *rf.Name
 			}
 		} else {
 			dir, err = outPath(gen.Generator, gpkg.Dir, mainPkg.Name)
@@ -486,15 +769,12 @@ func (g *Generator) generatePlugin(req pluginpb.CodeGeneratorRequest, gen config
 			}
 		}
 
-		outPath := filepath.Join(dir, basename)
-		if !isGunkPkg {
-			outPath = filepath.Join(dir, *rf.Name)
-		}
+		outPath := filepath.Join(dir, name)
 
 		// remove fake path
 		outPath = strings.TrimPrefix(outPath, "fake-path.com/command-line-arguments/")
 
-		outPath, err = pkgTpl(outPath, mainPkg.Name)
+		outPath, err = pkgTpl(outPath, newOutData(gen.Generator, gpkg.Dir, mainPkg.Name))
 		if err != nil {
 			return fmt.Errorf("unable to build output path for %q: %w", outPath, err)
 		}
@@ -506,7 +786,7 @@ func (g *Generator) generatePlugin(req pluginpb.CodeGeneratorRequest, gen config
 			}
 		}
 
-		if err := writeFile(outPath, data); err != nil {
+		if err := g.writePkgFile(mainPkgPath, outPath, data); err != nil {
 			return fmt.Errorf("unable to write to file %q: %w", outPath, err)
 		}
 	}
@@ -514,7 +794,19 @@ func (g *Generator) generatePlugin(req pluginpb.CodeGeneratorRequest, gen config
 }
 
 func (g *Generator) generateDoc(cfg *config.Config, gen config.Generator) error {
+	format, ok := gen.GetParam("format")
+	if !ok {
+		format = "json"
+	}
+	if _, ok := doc.Formats[format]; !ok {
+		return fmt.Errorf("unknown doc format %q; must be json, asciidoc or rst", format)
+	}
+	// The packages are generated concurrently, so sort them to keep the
+	// documentation the same across runs.
 	pkgs := g.docPkgs
+	sort.Slice(pkgs, func(i, j int) bool {
+		return pkgs[i].ID < pkgs[j].ID
+	})
 	used := make(map[string]string, len(pkgs))
 	tags := make(map[string]*doc.Tag)
 	// openPreamble opens the preamble file and returns its contents, otherwise
@@ -588,12 +880,11 @@ func (g *Generator) generateDoc(cfg *config.Config, gen config.Generator) error
 		if err != nil {
 			return fmt.Errorf("unable to build output path for %q: %w", out, err)
 		}
-		f, err := os.Create(filepath.Join(out, name+".json"))
-		if err != nil {
-			return fmt.Errorf("unable to create file %q: %w", out, err)
+		var buf bytes.Buffer
+		if err := doc.Render(&buf, tag, format); err != nil {
+			return err
 		}
-		defer f.Close()
-		if err := json.NewEncoder(f).Encode(tag); err != nil {
+		if err := writeFile(filepath.Join(out, name+doc.Formats[format]), buf.Bytes()); err != nil {
 			return fmt.Errorf("unable to write to file %q: %w", out, err)
 		}
 	}
@@ -606,16 +897,28 @@ func (g *Generator) generateDoc(cfg *config.Config, gen config.Generator) error
 func (g *Generator) newCodeGenRequest(pkgPath string) *pluginpb.CodeGeneratorRequest {
 	req := &pluginpb.CodeGeneratorRequest{}
 	req.FileToGenerate = append(req.FileToGenerate, unifiedProtoFile(pkgPath))
-	for _, pfile := range g.allProto {
-		req.ProtoFile = append(req.ProtoFile, pfile)
-	}
-	// ProtoFile must be sorted in topological order, so that each file's
-	// dependencies are satisfied by previous files. This is a requirement
-	// of some generators.
-	req.ProtoFile = topologicalSort(req.ProtoFile)
+	req.ProtoFile = g.sortedProtoFiles()
 	return req
 }
 
+// sortedProtoFiles returns the files in allProto in topological order, so
+// that each file's dependencies are satisfied by previous files, which is a
+// requirement of some generators. Files are otherwise sorted by name, so that
+// the order doesn't depend on map iteration and the output of generators is
+// the same across runs.
+func (g *Generator) sortedProtoFiles() []*descriptorpb.FileDescriptorProto {
+	names := make([]string, 0, len(g.allProto))
+	for name := range g.allProto {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	files := make([]*descriptorpb.FileDescriptorProto, 0, len(names))
+	for _, name := range names {
+		files = append(files, g.allProto[name])
+	}
+	return topologicalSort(files)
+}
+
 // topologicalSort sorts a number of protobuf descriptor files so that each
 // file's dependencies can be satisfied by previous files in the list. In other
 // words, it sorts the files incrementally by their dependencies.
@@ -656,8 +959,9 @@ _addLoop:
 
 // translatePkg translates all the gunk files in a gunk package to the
 // proto language. All the files within the package, including all the
-// files for its transitive dependencies, must already be loaded.
-func (g *Generator) translatePkg(pkgPath string) error {
+// files for its transitive dependencies, must already be loaded. cfg is the
+// gunkconfig of the package, which is loaded if it's nil.
+func (g *Generator) translatePkg(pkgPath string, cfg *config.Config) error {
 	gpkg, ok := g.gunkPkgs[pkgPath]
 	if !ok {
 		return fmt.Errorf("failed to get package %s to translate", pkgPath)
@@ -667,13 +971,36 @@ func (g *Generator) translatePkg(pkgPath string) error {
 		// Already translated, e.g. as a dependency.
 		return nil
 	}
+	g.curPkg = gpkg
+	g.usedImports = make(map[string]bool)
+	g.gname = ""
+	g.curOrigins = &protoOrigins{
+		files:      gpkg.GunkNames,
+		optionDeps: make(map[string]map[string]bool),
+	}
+	g.origins[pfilename] = g.curOrigins
+	// Packages outside of the project, such as dependencies, may not have
+	// a gunkconfig; they get the default one.
+	if cfg == nil {
+		var err error
+		cfg, err = g.loadConfig(gpkg.Dir)
+		if errors.Is(err, config.ErrNoConfig) {
+			cfg = &config.Config{}
+		} else if err != nil {
+			return fmt.Errorf("unable to load gunkconfig of %s: %w", pkgPath, err)
+		}
+	}
+	g.wrapperTypes = cfg.WrapperTypes
+	g.splitProto[pfilename] = cfg.SplitProtoFiles
+	fileOpts := cfg.FileOptions
 	// Get file options for package
-	fo, err := fileOptions(gpkg)
+	fo, err := g.fileOptions(gpkg)
 	if err != nil {
 		return fmt.Errorf("unable to get file options: %v", err)
 	}
-	g.curPkg = gpkg
-	g.usedImports = make(map[string]bool)
+	if err := setTemplatedOptions(fo, fileOpts, gpkg); err != nil {
+		return err
+	}
 
 	protoGoPkgPath := pkgPath
 	if pkgPath == "command-line-arguments" {
@@ -681,8 +1008,11 @@ func (g *Generator) translatePkg(pkgPath string) error {
 		protoGoPkgPath = "fake-path.com/command-line-arguments"
 	}
 
-	// Set the GoPackage file option to be the gunk package name.
-	fo.GoPackage = proto.String(protoGoPkgPath + ";" + gpkg.Name)
+	// Set the GoPackage file option to be the gunk package name, unless
+	// it's templated in the gunkconfig.
+	if fo.GoPackage == nil {
+		fo.GoPackage = proto.String(protoGoPkgPath + ";" + gpkg.Name)
+	}
 
 	// note - do not set above to gpkg.PkgPath or basename of that;
 	// gunk files can have different names than path
@@ -699,6 +1029,9 @@ func (g *Generator) translatePkg(pkgPath string) error {
 	g.messageIndex = 0
 	g.serviceIndex = 0
 	g.enumIndex = 0
+	if err := g.recordNestedTypes(gpkg); err != nil {
+		return err
+	}
 	for i, fpath := range gpkg.GunkNames {
 		if err := g.appendFile(fpath, gpkg.GunkSyntax[i]); err != nil {
 			return fmt.Errorf("%s: %v", g.Loader.Fset.Position(g.curPos), err)
@@ -732,7 +1065,7 @@ func (g *Generator) translatePkg(pkgPath string) error {
 	// Do the recursive translatePkg calls at the end, since the generator
 	// holds the state for the current package.
 	for _, pkgPath := range leftToTranslate {
-		if err := g.translatePkg(pkgPath); err != nil {
+		if err := g.translatePkg(pkgPath, nil); err != nil {
 			return err
 		}
 	}
@@ -741,7 +1074,7 @@ func (g *Generator) translatePkg(pkgPath string) error {
 
 // fileOptions will return the proto file options that have been set in the
 // gunk package. These include "JavaPackage", "Deprecated", "PhpNamespace", etc.
-func fileOptions(pkg *loader.GunkPackage) (*descriptorpb.FileOptions, error) {
+func (g *Generator) fileOptions(pkg *loader.GunkPackage) (*descriptorpb.FileOptions, error) {
 	fo := &descriptorpb.FileOptions{}
 	for _, f := range pkg.GunkSyntax {
 		for _, tag := range pkg.GunkTags[f] {
@@ -787,9 +1120,17 @@ func fileOptions(pkg *loader.GunkPackage) (*descriptorpb.FileOptions, error) {
 				fo.PhpGenericServices = proto.Bool(constant.BoolVal(tag.Value))
 			case "github.com/gunk/opt/openapiv2.Swagger":
 				o := &options.Swagger{}
-				reflectutil.UnmarshalAST(o, tag.Expr)
+				if err := tag.Decode(o); err != nil {
+					return nil, err
+				}
 				proto.SetExtension(fo, options.E_Openapiv2Swagger, o)
 			default:
+				if ok, err := g.customOption(fo, tag); ok {
+					if err != nil {
+						return nil, err
+					}
+					continue
+				}
 				return nil, fmt.Errorf("gunk package option %q not supported", s)
 			}
 		}
@@ -799,6 +1140,36 @@ func fileOptions(pkg *loader.GunkPackage) (*descriptorpb.FileOptions, error) {
 	return fo, nil
 }
 
+// setTemplatedOptions sets the file options templated in the [file_options]
+// section of the package's gunkconfig, unless they were set with gunk tags.
+func setTemplatedOptions(fo *descriptorpb.FileOptions, opts []config.FileOption, pkg *loader.GunkPackage) error {
+	m := fo.ProtoReflect()
+	for _, o := range opts {
+		fd := m.Descriptor().Fields().ByName(protoreflect.Name(o.Name))
+		if m.Has(fd) {
+			continue
+		}
+		data := config.FileOptionData{
+			PkgPath:   pkg.PkgPath,
+			Name:      pkg.Name,
+			ProtoName: pkg.ProtoName,
+		}
+		if pkg.Dir != "" {
+			dir, err := filepath.Rel(o.ConfigDir, pkg.Dir)
+			if err != nil {
+				return err
+			}
+			data.Dir = filepath.ToSlash(dir)
+		}
+		v, err := o.Value(data)
+		if err != nil {
+			return err
+		}
+		m.Set(fd, protoreflect.ValueOfString(v))
+	}
+	return nil
+}
+
 // appendFile translates a single gunk file to protobuf, appending its contents
 // to the package's proto file.
 func (g *Generator) appendFile(fpath string, file *ast.File) error {
@@ -807,12 +1178,13 @@ func (g *Generator) appendFile(fpath string, file *ast.File) error {
 		return nil
 	}
 	g.gfile = file
+	g.gname = fpath
 
 	if g.pfile.SourceCodeInfo == nil {
 		g.pfile.SourceCodeInfo = &descriptorpb.SourceCodeInfo{}
 	}
 
-	g.addDoc(file.Doc.Text(), packagePath)
+	g.addDoc(file, file.Doc.Text(), packagePath)
 	for _, decl := range file.Decls {
 		g.curPos = decl.Pos()
 		if err := g.translateDecl(decl); err != nil {
@@ -835,6 +1207,8 @@ func (g *Generator) translateDecl(decl ast.Decl) error {
 		// continue below
 	case token.CONST:
 		return nil // used for enums
+	case token.VAR:
+		return nil // option presets; expanded by the loader
 	case token.IMPORT:
 		return nil // imports; ignore
 	default:
@@ -842,28 +1216,53 @@ func (g *Generator) translateDecl(decl ast.Decl) error {
 	}
 	for _, spec := range gd.Specs {
 		ts := spec.(*ast.TypeSpec)
+		if ts.Assign.IsValid() {
+			// Type aliases declare nothing; their uses are resolved to
+			// the aliased type.
+			continue
+		}
+		if g.isNested(ts.Name.Name) {
+			// Converted along with the message they are nested in.
+			continue
+		}
 		g.curPos = ts.Pos()
 		switch ts.Type.(type) {
 		case *ast.StructType:
-			msg, err := g.convertMessage(ts)
+			if extendee, ok := extendableOptions[ts.Name.Name]; ok {
+				exts, err := g.convertExtensions(ts, extendee)
+				if err != nil {
+					return err
+				}
+				g.pfile.Extension = append(g.pfile.Extension, exts...)
+				for range exts {
+					g.curOrigins.extensions = append(g.curOrigins.extensions, g.gname)
+				}
+				continue
+			}
+			msg, err := g.convertMessage(ts, messagePath, g.messageIndex)
 			if err != nil {
 				return err
 			}
+			g.messageIndex++
 			g.pfile.MessageType = append(g.pfile.MessageType, msg)
+			g.curOrigins.messages = append(g.curOrigins.messages, g.gname)
 		case *ast.InterfaceType:
 			srv, err := g.convertService(ts)
 			if err != nil {
 				return err
 			}
 			g.pfile.Service = append(g.pfile.Service, srv)
+			g.curOrigins.services = append(g.curOrigins.services, g.gname)
 		case *ast.Ident:
-			enum, err := g.convertEnum(ts)
+			enum, err := g.convertEnum(ts, enumPath, g.enumIndex)
 			if err != nil {
 				return err
 			}
+			g.enumIndex++
 			// This can happen if the enum has no values.
 			if enum != nil {
 				g.pfile.EnumType = append(g.pfile.EnumType, enum)
+				g.curOrigins.enums = append(g.curOrigins.enums, g.gname)
 			}
 		default:
 			return fmt.Errorf("invalid declaration type %T", ts.Type)
@@ -873,27 +1272,59 @@ func (g *Generator) translateDecl(decl ast.Decl) error {
 }
 
 // addDoc inserts the provided documentation text into protobuf with its path
-// after formatting it into the format proto requires.
-func (g *Generator) addDoc(text string, path ...int32) {
-	if text == "" {
+// after formatting it into the format proto requires. The location spans the
+// node, and holds its trailing comment too, if it's a field or a value.
+func (g *Generator) addDoc(node ast.Node, text string, path ...int32) {
+	var trailing string
+	switch node := node.(type) {
+	case *ast.Field:
+		trailing = node.Comment.Text()
+	case *ast.ValueSpec:
+		trailing = node.Comment.Text()
+	}
+	if text == "" && trailing == "" {
 		return
 	}
+	loc := &descriptorpb.SourceCodeInfo_Location{
+		Path: path,
+		Span: g.span(node),
+	}
+	if text != "" {
+		loc.LeadingComments = proto.String(protoComment(text))
+	}
+	if trailing != "" {
+		loc.TrailingComments = proto.String(protoComment(trailing))
+	}
+	g.pfile.SourceCodeInfo.Location = append(g.pfile.SourceCodeInfo.Location, loc)
+	g.curOrigins.locations = append(g.curOrigins.locations, g.gname)
+}
+
+// protoComment formats comment text like protoc does for the comments of a
+// source code info location.
+func protoComment(text string) string {
 	// go's ast.TypeSpec.Doc.Text() trims left-trailing spaces on each line of multi-line comment,
 	// while proto's LeadingComments needs them
 	//
 	// block comments still look bad, but that's not a priority now
 	lines := strings.Split(text, "\n")
 	newText := " " + strings.Join(lines, "\n ")
-	newText = strings.TrimRight(newText, " \n")
-
-	g.pfile.SourceCodeInfo.Location = append(g.pfile.SourceCodeInfo.Location,
-		&descriptorpb.SourceCodeInfo_Location{
-			Path:            path,
-			LeadingComments: &newText,
-			// just add some nonsense to satisfy protoc-gen-go
-			Span: []int32{1, 2, 3},
-		},
-	)
+	return strings.TrimRight(newText, " \n")
+}
+
+// span returns the span of the node in its Gunk file, as the zero-based start
+// line and column, end line, and end column of a source code info location.
+// The end line is omitted when it's the start line. The span of a file is that
+// of its package clause.
+func (g *Generator) span(node ast.Node) []int32 {
+	end := node.End()
+	if file, ok := node.(*ast.File); ok {
+		end = file.Name.End()
+	}
+	start, stop := g.Loader.Fset.Position(node.Pos()), g.Loader.Fset.Position(end)
+	if start.Line == stop.Line {
+		return []int32{int32(start.Line - 1), int32(start.Column - 1), int32(stop.Column - 1)}
+	}
+	return []int32{int32(start.Line - 1), int32(start.Column - 1), int32(stop.Line - 1), int32(stop.Column - 1)}
 }
 
 // messageOptions returns the MessageOptions set using Gunk tags.
@@ -909,9 +1340,17 @@ func (g *Generator) messageOptions(tspec *ast.TypeSpec) (*descriptorpb.MessageOp
 			o.Deprecated = proto.Bool(constant.BoolVal(tag.Value))
 		case "github.com/gunk/opt/openapiv2.Schema":
 			schema := &options.Schema{}
-			reflectutil.UnmarshalAST(schema, tag.Expr)
+			if err := tag.Decode(schema); err != nil {
+				return nil, err
+			}
 			proto.SetExtension(o, options.E_Openapiv2Schema, schema)
 		default:
+			if ok, err := g.customOption(o, tag); ok {
+				if err != nil {
+					return nil, err
+				}
+				continue
+			}
 			return nil, fmt.Errorf("gunk message option %q not supported", s)
 		}
 	}
@@ -947,33 +1386,64 @@ func (g *Generator) fieldOptions(field *ast.Field) (*descriptorpb.FieldOptions,
 				}
 			}
 		default:
+			if ok, err := g.customOption(o, tag); ok {
+				if err != nil {
+					return nil, err
+				}
+				continue
+			}
 			return nil, fmt.Errorf("gunk field option %q not supported", s)
 		}
 	}
+	if err := g.setFieldAccess(o, field.Doc.Text()); err != nil {
+		return nil, err
+	}
 	reflectutil.SetDefaults(o)
 	return o, nil
 }
 
 // convertMessage converts the provided type spec of a struct into a descriptor
-// that describes a message.
-func (g *Generator) convertMessage(tspec *ast.TypeSpec) (*descriptorpb.DescriptorProto, error) {
-	g.addDoc(tspec.Doc.Text(), messagePath, g.messageIndex)
+// that describes a message, along with the types nested in it. path is the
+// source code info path of the message.
+func (g *Generator) convertMessage(tspec *ast.TypeSpec, path ...int32) (*descriptorpb.DescriptorProto, error) {
+	g.addDoc(tspec, tspec.Doc.Text(), path...)
 	msg := &descriptorpb.DescriptorProto{
-		Name: proto.String(tspec.Name.Name),
+		Name: proto.String(g.localName(tspec.Name.Name)),
 	}
 	messageOptions, err := g.messageOptions(tspec)
 	if err != nil {
 		return nil, fmt.Errorf("error getting message options: %v", err)
 	}
 	msg.Options = messageOptions
+	reserved, err := loader.ParseReserved(tspec.Doc.Text())
+	if err != nil {
+		return nil, err
+	}
+	if reserved != nil {
+		for _, rng := range reserved.Ranges {
+			// The ends of descriptor ranges are exclusive.
+			msg.ReservedRange = append(msg.ReservedRange, &descriptorpb.DescriptorProto_ReservedRange{
+				Start: proto.Int32(rng[0]),
+				End:   proto.Int32(rng[1] + 1),
+			})
+		}
+		msg.ReservedName = reserved.Names
+	}
 	stype := tspec.Type.(*ast.StructType)
 	for i, field := range stype.Fields.List {
 		if len(field.Names) != 1 {
 			return nil, fmt.Errorf("fields must have exactly one name")
 		}
 		fieldName := field.Names[0].Name
-		g.addDoc(field.Doc.Text(), messagePath, g.messageIndex, messageFieldPath, int32(i))
-		ftype := g.curPkg.TypesInfo.TypeOf(field.Type)
+		ftype := loader.Unalias(g.curPkg.TypesInfo.TypeOf(field.Type))
+		fieldDoc := field.Doc.Text()
+		if n, ok := fixedBytesLen(ftype); ok {
+			if fieldDoc != "" {
+				fieldDoc += "\n"
+			}
+			fieldDoc += fmt.Sprintf("Must be exactly %d bytes long.\n", n)
+		}
+		g.addDoc(field, fieldDoc, appendPath(path, messageFieldPath, int32(i))...)
 		g.curPos = field.Pos()
 		var ptype descriptorpb.FieldDescriptorProto_Type
 		var plabel descriptorpb.FieldDescriptorProto_Label
@@ -1017,11 +1487,37 @@ func (g *Generator) convertMessage(tspec *ast.TypeSpec) (*descriptorpb.Descripto
 		if err != nil {
 			return nil, fmt.Errorf("unable to convert tag to number on %s: %v", fieldName, err)
 		}
+		if reserved.HasNumber(*num) {
+			return nil, fmt.Errorf("field %s uses reserved number %d", fieldName, *num)
+		}
+		if reserved.HasName(fieldName) {
+			return nil, fmt.Errorf("field %s uses a reserved name", fieldName)
+		}
+		if enc, ok := tag.Lookup("encoding"); ok {
+			if msgNestedType != nil {
+				return nil, fmt.Errorf("encoding cannot be set on map field %s", fieldName)
+			}
+			if ptype, err = encodedType(ptype, enc); err != nil {
+				return nil, fmt.Errorf("invalid encoding on %s: %v", fieldName, err)
+			}
+		}
 		fieldOptions, err := g.fieldOptions(field)
 		if err != nil {
 			return nil, fmt.Errorf("error getting field options: %v", err)
 		}
-		msg.Field = append(msg.Field, &descriptorpb.FieldDescriptorProto{
+		if ftype.String() == uuidType {
+			setUUIDFormat(fieldOptions)
+			g.addProtoDep("protoc-gen-openapiv2/options/annotations.proto")
+		}
+		int64Enc, err := g.curPkg.FieldInt64Encoding(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JSON encoding on %s: %v", fieldName, err)
+		}
+		if int64Enc != "" {
+			setInt64Encoding(fieldOptions, int64Enc, ptype, plabel == descriptorpb.FieldDescriptorProto_LABEL_REPEATED)
+			g.addProtoDep("protoc-gen-openapiv2/options/annotations.proto")
+		}
+		fd := &descriptorpb.FieldDescriptorProto{
 			Name:     proto.String(fieldName),
 			Number:   num,
 			TypeName: protoStringOrNil(tname),
@@ -1029,9 +1525,33 @@ func (g *Generator) convertMessage(tspec *ast.TypeSpec) (*descriptorpb.Descripto
 			Label:    &plabel,
 			JsonName: jsonName(tag),
 			Options:  fieldOptions,
-		})
+		}
+		if err := g.tagOptions(fd, ftype, tag); err != nil {
+			return nil, fmt.Errorf("error getting field options on %s: %v", fieldName, err)
+		}
+		msg.Field = append(msg.Field, fd)
+	}
+	for _, nested := range g.nestedTypes[tspec.Name.Name] {
+		g.curPos = nested.Pos()
+		switch nested.Type.(type) {
+		case *ast.StructType:
+			// Map entries come first, as they are added with the
+			// fields.
+			nmsg, err := g.convertMessage(nested, appendPath(path, messageNestedPath, int32(len(msg.NestedType)))...)
+			if err != nil {
+				return nil, err
+			}
+			msg.NestedType = append(msg.NestedType, nmsg)
+		case *ast.Ident:
+			enum, err := g.convertEnum(nested, appendPath(path, messageEnumPath, int32(len(msg.EnumType)))...)
+			if err != nil {
+				return nil, err
+			}
+			if enum != nil {
+				msg.EnumType = append(msg.EnumType, enum)
+			}
+		}
 	}
-	g.messageIndex++
 	return msg, nil
 }
 
@@ -1043,15 +1563,25 @@ func (g *Generator) serviceOptions(tspec *ast.TypeSpec) (*descriptorpb.ServiceOp
 		case "github.com/gunk/opt/service.Deprecated":
 			o.Deprecated = proto.Bool(constant.BoolVal(tag.Value))
 		default:
+			if ok, err := g.customOption(o, tag); ok {
+				if err != nil {
+					return nil, err
+				}
+				continue
+			}
 			return nil, fmt.Errorf("gunk service option %q not supported", s)
 		}
 	}
+	if err := g.setServiceConfig(o, tspec.Doc.Text()); err != nil {
+		return nil, err
+	}
 	reflectutil.SetDefaults(o)
 	return o, nil
 }
 
-// methodOptions returns the MethodOptions set using Gunk tags.
-func (g *Generator) methodOptions(method *ast.Field) (*descriptorpb.MethodOptions, error) {
+// methodOptions returns the MethodOptions set using Gunk tags, given the
+// options of the method's service.
+func (g *Generator) methodOptions(method *ast.Field, srvOptions *descriptorpb.ServiceOptions) (*descriptorpb.MethodOptions, error) {
 	o := &descriptorpb.MethodOptions{}
 	var httpRule *annotations.HttpRule
 	for _, tag := range g.curPkg.GunkTags[method] {
@@ -1110,10 +1640,18 @@ func (g *Generator) methodOptions(method *ast.Field) (*descriptorpb.MethodOption
 			}
 		case "github.com/gunk/opt/openapiv2.Operation":
 			op := &options.Operation{}
-			reflectutil.UnmarshalAST(op, tag.Expr)
+			if err := tag.Decode(op); err != nil {
+				return nil, err
+			}
 			proto.SetExtension(o, options.E_Openapiv2Operation, op)
 			g.addProtoDep("protoc-gen-openapiv2/options/annotations.proto")
 		default:
+			if ok, err := g.customOption(o, tag); ok {
+				if err != nil {
+					return nil, err
+				}
+				continue
+			}
 			return nil, fmt.Errorf("gunk method option %q not supported", s)
 		}
 	}
@@ -1121,6 +1659,21 @@ func (g *Generator) methodOptions(method *ast.Field) (*descriptorpb.MethodOption
 		proto.SetExtension(o, annotations.E_Http, httpRule)
 		g.addProtoDep("google/api/annotations.proto")
 	}
+	c, err := splitCache(method.Doc.Text())
+	if err != nil {
+		return nil, err
+	}
+	if c != nil {
+		if err := g.setCacheOptions(o, httpRule, c); err != nil {
+			return nil, err
+		}
+	}
+	if err := g.setMethodAccess(o, method.Doc.Text()); err != nil {
+		return nil, err
+	}
+	if err := g.setMethodConfig(o, method.Doc.Text(), srvOptions); err != nil {
+		return nil, err
+	}
 	reflectutil.SetDefaults(o)
 	return o, nil
 }
@@ -1134,17 +1687,18 @@ func (g *Generator) convertService(tspec *ast.TypeSpec) (*descriptorpb.ServiceDe
 		return nil, fmt.Errorf("error getting service options: %v", err)
 	}
 	srv.Options = serviceOptions
+	g.addDoc(tspec, tspec.Doc.Text(), servicePath, g.serviceIndex)
 	itype := tspec.Type.(*ast.InterfaceType)
 	for i, method := range itype.Methods.List {
 		if len(method.Names) != 1 {
 			return nil, fmt.Errorf("methods must have exactly one name")
 		}
-		g.addDoc(method.Doc.Text(), servicePath, g.serviceIndex, serviceMethodPath, int32(i))
+		g.addDoc(method, method.Doc.Text(), servicePath, g.serviceIndex, serviceMethodPath, int32(i))
 		g.curPos = method.Pos()
 		pmethod := &descriptorpb.MethodDescriptorProto{
 			Name: proto.String(method.Names[0].Name),
 		}
-		methodOptions, err := g.methodOptions(method)
+		methodOptions, err := g.methodOptions(method, serviceOptions)
 		if err != nil {
 			return nil, fmt.Errorf("error getting method options: %v", err)
 		}
@@ -1174,10 +1728,11 @@ func (g *Generator) convertService(tspec *ast.TypeSpec) (*descriptorpb.ServiceDe
 // https://developers.google.com/protocol-buffers/docs/proto#maps
 func (g *Generator) convertMap(parentName, fieldName string, mapTyp *types.Map) (string, *descriptorpb.DescriptorProto, error) {
 	mapName := fieldName + "Entry"
-	typeName, err := g.qualifiedTypeName(parentName+"."+mapName, nil)
+	parentTypeName, err := g.qualifiedTypeName(parentName, nil)
 	if err != nil {
 		return "", nil, err
 	}
+	typeName := parentTypeName + "." + mapName
 	keyType, _, keyTypeName, err := g.convertType(mapTyp.Key())
 	if err != nil {
 		return "", nil, err
@@ -1230,7 +1785,7 @@ func (g *Generator) convertParameter(tuple *types.Tuple) (*string, *bool, error)
 	default:
 		return nil, nil, fmt.Errorf("multiple parameters are not supported")
 	}
-	param := tuple.At(0).Type()
+	param := loader.Unalias(tuple.At(0).Type())
 	_, label, tname, err := g.convertType(param)
 	if err != nil {
 		return nil, nil, err
@@ -1258,6 +1813,12 @@ func (g *Generator) enumOptions(tspec *ast.TypeSpec) (*descriptorpb.EnumOptions,
 		case "github.com/gunk/opt/enum.Deprecated":
 			o.Deprecated = proto.Bool(constant.BoolVal(tag.Value))
 		default:
+			if ok, err := g.customOption(o, tag); ok {
+				if err != nil {
+					return nil, err
+				}
+				continue
+			}
 			return nil, fmt.Errorf("gunk enum option %q not supported", s)
 		}
 	}
@@ -1273,6 +1834,12 @@ func (g *Generator) enumValueOptions(vspec *ast.ValueSpec) (*descriptorpb.EnumVa
 		case "github.com/gunk/opt/enumvalues.Deprecated":
 			o.Deprecated = proto.Bool(constant.BoolVal(tag.Value))
 		default:
+			if ok, err := g.customOption(o, tag); ok {
+				if err != nil {
+					return nil, err
+				}
+				continue
+			}
 			return nil, fmt.Errorf("gunk enumvalue option %q not supported", s)
 		}
 	}
@@ -1282,23 +1849,45 @@ func (g *Generator) enumValueOptions(vspec *ast.ValueSpec) (*descriptorpb.EnumVa
 
 // convertEnum converts the provided const TypeSpec to an EnumDescriptorProto.
 // It returns (nil, nil) if there are no values for the enum type.
-func (g *Generator) convertEnum(tspec *ast.TypeSpec) (*descriptorpb.EnumDescriptorProto, error) {
-	g.addDoc(tspec.Doc.Text(), enumPath, g.enumIndex)
+func (g *Generator) convertEnum(tspec *ast.TypeSpec, path ...int32) (*descriptorpb.EnumDescriptorProto, error) {
+	g.addDoc(tspec, tspec.Doc.Text(), path...)
 	enum := &descriptorpb.EnumDescriptorProto{
-		Name: proto.String(tspec.Name.Name),
+		Name: proto.String(g.localName(tspec.Name.Name)),
+	}
+	// The values of nested enums are exported with the name of the
+	// message they are nested in, like the enums themselves.
+	valuePrefix := tspec.Name.Name
+	parent := loader.NestedParent(tspec.Doc.Text())
+	if parent != "" {
+		valuePrefix = parent
 	}
 	enumOptions, err := g.enumOptions(tspec)
 	if err != nil {
 		return nil, fmt.Errorf("error getting enum options: %v", err)
 	}
 	enum.Options = enumOptions
+	reserved, err := loader.ParseEnumReserved(tspec.Doc.Text())
+	if err != nil {
+		return nil, err
+	}
+	if reserved != nil {
+		// Unlike those of messages, the ends of enum ranges are
+		// inclusive.
+		for _, rng := range reserved.Ranges {
+			enum.ReservedRange = append(enum.ReservedRange, &descriptorpb.EnumDescriptorProto_EnumReservedRange{
+				Start: proto.Int32(rng[0]),
+				End:   proto.Int32(rng[1]),
+			})
+		}
+		enum.ReservedName = reserved.Names
+	}
 	enumType := g.curPkg.TypesInfo.TypeOf(tspec.Name)
 	for _, decl := range g.gfile.Decls {
 		gd, ok := decl.(*ast.GenDecl)
 		if !ok || gd.Tok != token.CONST {
 			continue
 		}
-		for i, spec := range gd.Specs {
+		for _, spec := range gd.Specs {
 			vs := spec.(*ast.ValueSpec)
 			// .proto files have the same limitation, and it
 			// allows per-value godocs
@@ -1306,39 +1895,56 @@ func (g *Generator) convertEnum(tspec *ast.TypeSpec) (*descriptorpb.EnumDescript
 				return nil, fmt.Errorf("value specs must have exactly one name")
 			}
 			name := vs.Names[0]
+			if name.Name == "_" {
+				// Blank values only skip a number, as with iota.
+				continue
+			}
 			if g.curPkg.TypesInfo.TypeOf(name) != enumType {
 				continue
 			}
 			g.curPos = vs.Pos()
+			// The values of nested enums are scoped to their parent in
+			// protobuf, but not in Gunk, so they may be prefixed with the
+			// name of their enum to be unique, such as
+			// Bar_Available_UNKNOWN, as gunk convert does. The prefix
+			// isn't part of their protobuf name.
+			valueName := name.Name
+			if parent != "" {
+				valueName = strings.TrimPrefix(valueName, tspec.Name.Name+"_")
+			}
+			// If the original comment only had gunk tags, there is no
+			// actual documentation for us to keep.
 			docText := vs.Doc.Text()
-
-			switch {
-			case docText == "":
-				// The original comment only had gunk tags, and
-				// no actual documentation for us to keep.
-			case strings.HasPrefix(docText, name.Name):
+			if strings.HasPrefix(docText, name.Name) {
 				// SomeVal will be exported as SomeType_SomeVal
-				docText = tspec.Name.Name + "_" + vs.Doc.Text()
-				fallthrough
-			default:
-				g.addDoc(docText, enumPath, g.enumIndex,
-					enumValuePath, int32(i))
+				docText = valuePrefix + "_" + valueName + strings.TrimPrefix(docText, name.Name)
 			}
+			g.addDoc(vs, docText, appendPath(path, enumValuePath, int32(len(enum.Value)))...)
+			// Use the value computed by the type checker, which takes
+			// care of iota and implicitly repeated expressions.
 			val := g.curPkg.TypesInfo.Defs[name].(*types.Const).Val()
-			ival, _ := constant.Int64Val(val)
+			ival, ok := constant.Int64Val(val)
+			if !ok || ival < math.MinInt32 || ival > math.MaxInt32 {
+				return nil, fmt.Errorf("enum value %s (%s) does not fit in an int32", name.Name, val)
+			}
+			if reserved.HasNumber(int32(ival)) {
+				return nil, fmt.Errorf("enum value %s uses reserved number %d", name.Name, ival)
+			}
+			if reserved.HasName(valueName) {
+				return nil, fmt.Errorf("enum value %s uses a reserved name", name.Name)
+			}
 			enumValueOptions, err := g.enumValueOptions(vs)
 			if err != nil {
 				return nil, fmt.Errorf("error getting enum value options: %v", err)
 			}
 
 			enum.Value = append(enum.Value, &descriptorpb.EnumValueDescriptorProto{
-				Name:    proto.String(name.Name),
+				Name:    proto.String(valueName),
 				Number:  proto.Int32(int32(ival)),
 				Options: enumValueOptions,
 			})
 		}
 	}
-	g.enumIndex++
 	// If an enum doesn't have any values
 	if len(enum.Value) == 0 {
 		return nil, nil
@@ -1346,6 +1952,129 @@ func (g *Generator) convertEnum(tspec *ast.TypeSpec) (*descriptorpb.EnumDescript
 	return enum, nil
 }
 
+// wrapperType returns the name of the google.protobuf wrapper message for the
+// scalar type typ, or an empty string if it has none.
+func wrapperType(typ types.Type) string {
+	switch typ := loader.Unalias(typ).(type) {
+	case *types.Basic:
+		switch typ.Kind() {
+		case types.String:
+			return ".google.protobuf.StringValue"
+		case types.Int, types.Int32:
+			return ".google.protobuf.Int32Value"
+		case types.Uint, types.Uint32:
+			return ".google.protobuf.UInt32Value"
+		case types.Int64:
+			return ".google.protobuf.Int64Value"
+		case types.Uint64:
+			return ".google.protobuf.UInt64Value"
+		case types.Float32:
+			return ".google.protobuf.FloatValue"
+		case types.Float64:
+			return ".google.protobuf.DoubleValue"
+		case types.Bool:
+			return ".google.protobuf.BoolValue"
+		}
+	case *types.Slice:
+		if eTyp, ok := typ.Elem().(*types.Basic); ok && eTyp.Kind() == types.Byte {
+			return ".google.protobuf.BytesValue"
+		}
+	}
+	return ""
+}
+
+// fixedBytesLen returns the length of typ if it is a fixed-size byte array,
+// such as [16]byte.
+func fixedBytesLen(typ types.Type) (int64, bool) {
+	arr, ok := loader.Unalias(typ).(*types.Array)
+	if !ok {
+		return 0, false
+	}
+	if eTyp, ok := arr.Elem().(*types.Basic); !ok || eTyp.Kind() != types.Byte {
+		return 0, false
+	}
+	return arr.Len(), true
+}
+
+// uuidType is the Go type of UUID fields, which are strings.
+const uuidType = loader.UUIDPath + ".UUID"
+
+// setUUIDFormat sets the OpenAPI format of a UUID field to "uuid", unless a
+// format was set explicitly.
+func setUUIDFormat(o *descriptorpb.FieldOptions) {
+	schema := &options.JSONSchema{}
+	if proto.HasExtension(o, options.E_Openapiv2Field) {
+		schema = proto.GetExtension(o, options.E_Openapiv2Field).(*options.JSONSchema)
+	}
+	if schema.Format != "" {
+		return
+	}
+	schema.Format = "uuid"
+	proto.SetExtension(o, options.E_Openapiv2Field, schema)
+}
+
+// setInt64Encoding sets the JSON encoding of a 64-bit integer field, which is
+// one of loader.Int64String and loader.Int64Number, as its jstype option for
+// JavaScript and TypeScript code, and as its OpenAPI type and format unless
+// they were set explicitly. The OpenAPI schema of a repeated field is that of
+// the array, so only its jstype is set.
+func setInt64Encoding(o *descriptorpb.FieldOptions, enc string, typ descriptorpb.FieldDescriptorProto_Type, repeated bool) {
+	jsType := descriptorpb.FieldOptions_JS_STRING
+	schemaType := options.JSONSchema_STRING
+	if enc == loader.Int64Number {
+		jsType = descriptorpb.FieldOptions_JS_NUMBER
+		schemaType = options.JSONSchema_INTEGER
+	}
+	o.Jstype = &jsType
+	if repeated {
+		return
+	}
+	schema := &options.JSONSchema{}
+	if proto.HasExtension(o, options.E_Openapiv2Field) {
+		schema = proto.GetExtension(o, options.E_Openapiv2Field).(*options.JSONSchema)
+	}
+	if len(schema.Type) == 0 {
+		schema.Type = []options.JSONSchema_JSONSchemaSimpleTypes{schemaType}
+	}
+	if schema.Format == "" {
+		switch typ {
+		case descriptorpb.FieldDescriptorProto_TYPE_UINT64, descriptorpb.FieldDescriptorProto_TYPE_FIXED64:
+			schema.Format = "uint64"
+		default:
+			schema.Format = "int64"
+		}
+	}
+	proto.SetExtension(o, options.E_Openapiv2Field, schema)
+}
+
+// encodedType returns the integer type typ with the given wire encoding,
+// which is either "fixed" or "sint".
+func encodedType(typ descriptorpb.FieldDescriptorProto_Type, encoding string) (descriptorpb.FieldDescriptorProto_Type, error) {
+	switch encoding {
+	case "fixed":
+		switch typ {
+		case descriptorpb.FieldDescriptorProto_TYPE_INT32:
+			return descriptorpb.FieldDescriptorProto_TYPE_SFIXED32, nil
+		case descriptorpb.FieldDescriptorProto_TYPE_INT64:
+			return descriptorpb.FieldDescriptorProto_TYPE_SFIXED64, nil
+		case descriptorpb.FieldDescriptorProto_TYPE_UINT32:
+			return descriptorpb.FieldDescriptorProto_TYPE_FIXED32, nil
+		case descriptorpb.FieldDescriptorProto_TYPE_UINT64:
+			return descriptorpb.FieldDescriptorProto_TYPE_FIXED64, nil
+		}
+	case "sint":
+		switch typ {
+		case descriptorpb.FieldDescriptorProto_TYPE_INT32:
+			return descriptorpb.FieldDescriptorProto_TYPE_SINT32, nil
+		case descriptorpb.FieldDescriptorProto_TYPE_INT64:
+			return descriptorpb.FieldDescriptorProto_TYPE_SINT64, nil
+		}
+	default:
+		return 0, fmt.Errorf("unknown encoding %q", encoding)
+	}
+	return 0, fmt.Errorf("%s encoding cannot be used on %s fields", encoding, strings.ToLower(strings.TrimPrefix(typ.String(), "TYPE_")))
+}
+
 // qualifiedTypeName will format the type name for that package. If the
 // package is nil, it will format the type for the current package that is
 // being processed.
@@ -1353,21 +2082,99 @@ func (g *Generator) convertEnum(tspec *ast.TypeSpec) (*descriptorpb.EnumDescript
 // Currently we format the type as ".<pkg_name>.<type_name>"
 func (g *Generator) qualifiedTypeName(typeName string, pkg *types.Package) (string, error) {
 	// If pkg is nil, we should format the type for the current package.
-	if pkg == nil {
-		return "." + g.curPkg.ProtoName + "." + typeName, nil
+	gpkg := g.curPkg
+	if pkg != nil {
+		var ok bool
+		gpkg, ok = g.gunkPkgs[pkg.Path()]
+		if !ok {
+			return "", fmt.Errorf("failed to get package %s to get qualified type name", pkg.Path())
+		}
 	}
-	gpkg, ok := g.gunkPkgs[pkg.Path()]
-	if !ok {
-		return "", fmt.Errorf("failed to get package %s to get qualified type name", pkg.Path())
+	names, err := g.nestedNamesOf(gpkg)
+	if err != nil {
+		return "", err
+	}
+	if name, ok := names[typeName]; ok {
+		typeName = name
 	}
 	return "." + gpkg.ProtoName + "." + typeName, nil
 }
 
+// nestedNamesOf returns the protobuf names of the nested types of a package,
+// relative to it, by type name.
+func (g *Generator) nestedNamesOf(gpkg *loader.GunkPackage) (map[string]string, error) {
+	if names, ok := g.nestedNames[gpkg.PkgPath]; ok {
+		return names, nil
+	}
+	if len(gpkg.GunkSyntax) == 0 {
+		// No Gunk files were loaded, so there are no nested types.
+		return nil, nil
+	}
+	names, err := loader.NestedNames(g.Loader.Fset, gpkg.GunkSyntax)
+	if err != nil {
+		return nil, err
+	}
+	if g.nestedNames == nil {
+		g.nestedNames = make(map[string]map[string]string)
+	}
+	g.nestedNames[gpkg.PkgPath] = names
+	return names, nil
+}
+
+// recordNestedTypes records the nested types of a package being translated,
+// in the order they are declared in, to convert them with their messages.
+func (g *Generator) recordNestedTypes(gpkg *loader.GunkPackage) error {
+	if _, err := g.nestedNamesOf(gpkg); err != nil {
+		return err
+	}
+	g.nestedTypes = make(map[string][]*ast.TypeSpec)
+	for _, file := range gpkg.GunkSyntax {
+		for _, decl := range file.Decls {
+			gd, ok := decl.(*ast.GenDecl)
+			if !ok || gd.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gd.Specs {
+				ts := spec.(*ast.TypeSpec)
+				if !g.isNested(ts.Name.Name) {
+					continue
+				}
+				parent := loader.NestedParent(ts.Doc.Text())
+				g.nestedTypes[parent] = append(g.nestedTypes[parent], ts)
+			}
+		}
+	}
+	return nil
+}
+
+// isNested reports whether a type of the current package is nested in a
+// message.
+func (g *Generator) isNested(typeName string) bool {
+	_, ok := g.nestedNames[g.curPkg.PkgPath][typeName]
+	return ok
+}
+
+// localName returns the protobuf name of a type of the current package within
+// its parent message, or package if it isn't nested.
+func (g *Generator) localName(typeName string) string {
+	name, ok := g.nestedNames[g.curPkg.PkgPath][typeName]
+	if !ok {
+		return typeName
+	}
+	return name[strings.LastIndex(name, ".")+1:]
+}
+
+// appendPath returns a copy of a source code info path with elems appended,
+// so that the paths of sibling declarations don't share their arrays.
+func appendPath(path []int32, elems ...int32) []int32 {
+	return append(append([]int32(nil), path...), elems...)
+}
+
 // convertType converts a Go field or parameter type to Protobuf, returning its
 // type descriptor, a label such as "repeated", and a name, if the final type is
 // an enum or a message.
 func (g *Generator) convertType(typ types.Type) (descriptorpb.FieldDescriptorProto_Type, descriptorpb.FieldDescriptorProto_Label, string, error) {
-	switch typ := typ.(type) {
+	switch typ := loader.Unalias(typ).(type) {
 	case *types.Chan:
 		return g.convertType(typ.Elem())
 	case *types.Basic:
@@ -1399,6 +2206,37 @@ func (g *Generator) convertType(typ types.Type) (descriptorpb.FieldDescriptorPro
 		case "time.Duration":
 			g.addProtoDep("google/protobuf/duration.proto")
 			return descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL, ".google.protobuf.Duration", nil
+		case "google.golang.org/protobuf/types/known/anypb.Any":
+			g.addProtoDep("google/protobuf/any.proto")
+			return descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL, ".google.protobuf.Any", nil
+		case "google.golang.org/protobuf/types/known/structpb.Struct":
+			g.addProtoDep("google/protobuf/struct.proto")
+			return descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL, ".google.protobuf.Struct", nil
+		case "google.golang.org/protobuf/types/known/structpb.Value":
+			g.addProtoDep("google/protobuf/struct.proto")
+			return descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL, ".google.protobuf.Value", nil
+		case "google.golang.org/protobuf/types/known/structpb.ListValue":
+			g.addProtoDep("google/protobuf/struct.proto")
+			return descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL, ".google.protobuf.ListValue", nil
+		case "google.golang.org/protobuf/types/known/fieldmaskpb.FieldMask":
+			g.addProtoDep("google/protobuf/field_mask.proto")
+			return descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL, ".google.protobuf.FieldMask", nil
+		case "google.golang.org/protobuf/types/known/emptypb.Empty":
+			g.addProtoDep("google/protobuf/empty.proto")
+			return descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL, ".google.protobuf.Empty", nil
+		case uuidType:
+			return descriptorpb.FieldDescriptorProto_TYPE_STRING, descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL, "", nil
+		}
+		if pkg := typ.Obj().Pkg(); pkg != nil {
+			// Types of the googleapis common protos, such as
+			// google.type.Money and google.rpc.Status, are bundled.
+			if file, fullName, enum, ok := loader.GoogleapisType(pkg.Path(), typ.Obj().Name()); ok {
+				g.addProtoDep(file)
+				if enum {
+					return descriptorpb.FieldDescriptorProto_TYPE_ENUM, descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL, fullName, nil
+				}
+				return descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL, fullName, nil
+			}
 		}
 		fullName, err := g.qualifiedTypeName(typ.Obj().Name(), typ.Obj().Pkg())
 		if err != nil {
@@ -1414,6 +2252,20 @@ func (g *Generator) convertType(typ types.Type) (descriptorpb.FieldDescriptorPro
 		case *types.Struct:
 			return descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL, fullName, nil
 		}
+	case *types.Pointer:
+		if !g.wrapperTypes {
+			break
+		}
+		name := wrapperType(typ.Elem())
+		if name == "" {
+			break
+		}
+		g.addProtoDep("google/protobuf/wrappers.proto")
+		return descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL, name, nil
+	case *types.Array:
+		if _, ok := fixedBytesLen(typ); ok {
+			return descriptorpb.FieldDescriptorProto_TYPE_BYTES, descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL, "", nil
+		}
 	case *types.Slice:
 		if eTyp, ok := typ.Elem().(*types.Basic); ok {
 			if eTyp.Kind() == types.Byte {
@@ -1456,6 +2308,7 @@ func (g *Generator) loadProtoDeps() error {
 			}
 		}
 	}
+	sort.Strings(list)
 	files, err := g.protoLoader.LoadProto(list...)
 	if err != nil {
 		return err
@@ -1466,19 +2319,199 @@ func (g *Generator) loadProtoDeps() error {
 	return nil
 }
 
-// writeFile writes a file.
+// writeFile writes a file, unless it already has the same content. This keeps
+// the modification times of unchanged files, so that build caches and file
+// watchers aren't needlessly triggered.
+//
+// The file is written to a temporary file first, which is then renamed, so
+// that readers never see a partially written file.
+//
+// In a dry run or when diffing, the file is only recorded in dryRunFiles.
 func writeFile(path string, buf []byte) error {
-	return ioutil.WriteFile(path, buf, 0o644)
+	old, err := ioutil.ReadFile(path)
+	if err == nil && bytes.Equal(old, buf) {
+		return nil
+	}
+	if DryRun || Diff {
+		op := "modify"
+		if os.IsNotExist(err) {
+			op = "create"
+		}
+		dryRunFiles.add(fileChange{op: op, path: path, old: old, new: buf})
+		return nil
+	}
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	f, err := ioutil.TempFile(dir, "."+base+".tmp")
+	if err != nil {
+		return err
+	}
+	// Removing the file fails once it has been renamed, which is fine.
+	defer os.Remove(f.Name())
+	if _, err := f.Write(buf); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(0o644); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return err
+	}
+	log.Verbosef("wrote %s", path)
+	return nil
 }
 
-// mkdirAll creates a directory.
+// mkdirAll creates a directory, unless in a dry run or when diffing.
 func mkdirAll(path string) error {
+	if DryRun || Diff {
+		return nil
+	}
 	return os.MkdirAll(path, 0o755)
 }
 
-// pkgTpl processes the provided package path as a template, replacing Package
-// with the package name.
-func pkgTpl(tmpl string, pkg string) (string, error) {
+// Local makes Run only generate the package in the current directory, using
+// only the .gunkconfig in that directory. Only the Gunk packages it imports are
+// looked up, instead of all of those in the module and its dependencies, so
+// that generating a single package is fast, such as with:
+//
+//	//go:generate gunk generate --local
+var Local bool
+
+// loadConfig loads the gunkconfig for the package in dir, ignoring those in
+// parent directories in local mode.
+func (g *Generator) loadConfig(dir string) (*config.Config, error) {
+	if g.Loader.Local {
+		return config.LoadLocal(dir)
+	}
+	return config.Load(dir)
+}
+
+// DryRun makes Run print the files which would be created or modified to
+// standard output, instead of writing them.
+var DryRun bool
+
+// Diff makes Run print unified diffs between the files on disk and those
+// which would be generated to standard output, instead of writing them. Run
+// then fails if any file differs.
+var Diff bool
+
+// dryRunFiles holds the files which would be written in a dry run, or when
+// diffing.
+var dryRunFiles fileChanges
+
+// fileChanges is a list of files which are changed, such as "create
+// api/all.pb.go".
+type fileChanges struct {
+	mu      sync.Mutex
+	changes []fileChange
+}
+
+type fileChange struct {
+	op, path string
+	// old and new are the contents of the file on disk, if any, and the
+	// generated one.
+	old, new []byte
+}
+
+func (c *fileChanges) add(fc fileChange) {
+	fc.path = relPath(fc.path)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.changes = append(c.changes, fc)
+}
+
+// relPath returns path relative to the current directory if it is within it,
+// as it is easier to read, and path otherwise.
+func relPath(path string) string {
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, path); err == nil && !strings.HasPrefix(rel, "..") {
+			return rel
+		}
+	}
+	return path
+}
+
+// sorted returns the changes sorted by path, as the packages are generated
+// concurrently.
+func (c *fileChanges) sorted() []fileChange {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	sort.Slice(c.changes, func(i, j int) bool {
+		return c.changes[i].path < c.changes[j].path
+	})
+	return c.changes
+}
+
+// print writes the changes to w.
+func (c *fileChanges) print(w io.Writer) {
+	for _, fc := range c.sorted() {
+		fmt.Fprintln(w, fc.op, fc.path)
+	}
+}
+
+// printDiffs writes the unified diffs of the changes to w, like git does, and
+// returns the number of changes. Binary files, such as file descriptor sets,
+// are only reported as differing.
+func (c *fileChanges) printDiffs(w io.Writer) int {
+	changes := c.sorted()
+	for _, fc := range changes {
+		oldName := "a/" + filepath.ToSlash(fc.path)
+		if fc.op == "create" {
+			oldName = "/dev/null"
+		}
+		newName := "b/" + filepath.ToSlash(fc.path)
+		if fc.op == "remove" {
+			newName = "/dev/null"
+		}
+		if bytes.IndexByte(fc.old, 0) >= 0 || bytes.IndexByte(fc.new, 0) >= 0 {
+			fmt.Fprintf(w, "Binary files %s and %s differ\n", oldName, newName)
+			continue
+		}
+		if err := diff.Text(oldName, newName, fc.old, fc.new, w); err != nil {
+			// Writing the diff of in-memory contents only fails if
+			// w does.
+			fmt.Fprintf(w, "%s: %v\n", fc.path, err)
+		}
+	}
+	return len(changes)
+}
+
+// outData holds the values available to the templates of output paths, such
+// as "gen/{{.Lang}}/{{.PkgPathSuffix}}".
+type outData struct {
+	// Package is the name of the package, such as "v1".
+	Package string
+	// Lang is the type of the generator, such as "go" or "python".
+	Lang string
+	// PkgPathSuffix is the directory of the package relative to the
+	// .gunkconfig of the generator, with forward slashes, such as
+	// "api/v1". It's "." for the package next to the .gunkconfig.
+	PkgPathSuffix string
+}
+
+// newOutData returns the values of the templates of the output paths of a
+// generator for the package in packageDir, which may be empty if there is
+// none, such as for documentation.
+func newOutData(g config.Generator, packageDir string, pkg string) outData {
+	data := outData{Package: pkg, Lang: g.Code()}
+	if packageDir != "" {
+		if rel, err := filepath.Rel(g.ConfigDir, packageDir); err == nil {
+			data.PkgPathSuffix = filepath.ToSlash(rel)
+		}
+	}
+	return data
+}
+
+// pkgTpl processes the provided package path as a template, with the values of
+// outData, such as Package for the package name.
+func pkgTpl(tmpl string, data outData) (string, error) {
 	if !strings.Contains(tmpl, "{{") {
 		return tmpl, nil
 	}
@@ -1488,9 +2521,7 @@ func pkgTpl(tmpl string, pkg string) (string, error) {
 		return "", err
 	}
 	buf := new(bytes.Buffer)
-	if err := tpl.Execute(buf, map[string]interface{}{
-		"Package": pkg,
-	}); err != nil {
+	if err := tpl.Execute(buf, data); err != nil {
 		return "", err
 	}
 	return filepath.Clean(strings.TrimSpace(buf.String())), nil
@@ -1512,7 +2543,7 @@ func outPath(g config.Generator, packageDir string, pkg string) (string, error)
 	if g.Out == "" {
 		return packageDir, nil
 	}
-	out, err := pkgTpl(g.Out, pkg)
+	out, err := pkgTpl(g.Out, newOutData(g, packageDir, pkg))
 	if err != nil {
 		return "", err
 	}
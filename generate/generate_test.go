@@ -0,0 +1,358 @@
+package generate
+
+import (
+	"fmt"
+	"go/types"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/protoc-gen-openapiv2/options"
+	"github.com/gunk/gunk/config"
+	"github.com/gunk/gunk/loader"
+	"github.com/gunk/gunk/plugin"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+func TestConvertTypeNestedTime(t *testing.T) {
+	timePkg := types.NewPackage("time", "time")
+	timeType := types.NewNamed(types.NewTypeName(0, timePkg, "Time", nil), types.NewStruct(nil, nil), nil)
+	durationType := types.NewNamed(types.NewTypeName(0, timePkg, "Duration", nil), types.Typ[types.Int64], nil)
+	g := &Generator{
+		pfile:  &descriptorpb.FileDescriptorProto{},
+		curPkg: &loader.GunkPackage{ProtoName: "util"},
+	}
+	typ, label, name, err := g.convertType(types.NewSlice(durationType))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typ != descriptorpb.FieldDescriptorProto_TYPE_MESSAGE || label != descriptorpb.FieldDescriptorProto_LABEL_REPEATED || name != ".google.protobuf.Duration" {
+		t.Errorf("[]time.Duration: got %v %v %q", typ, label, name)
+	}
+	name, entry, err := g.convertMap("Message", "Times", types.NewMap(types.Typ[types.String], timeType))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != ".util.Message.TimesEntry" {
+		t.Errorf("map[string]time.Time: got entry %q", name)
+	}
+	if value := entry.GetField()[1]; value.GetType() != descriptorpb.FieldDescriptorProto_TYPE_MESSAGE || value.GetTypeName() != ".google.protobuf.Timestamp" {
+		t.Errorf("map[string]time.Time: got value %v %q", value.GetType(), value.GetTypeName())
+	}
+	wantDeps := []string{"google/protobuf/duration.proto", "google/protobuf/timestamp.proto"}
+	if !reflect.DeepEqual(g.pfile.Dependency, wantDeps) {
+		t.Errorf("dependencies: got %v, want %v", g.pfile.Dependency, wantDeps)
+	}
+}
+
+func TestConvertTypeUUID(t *testing.T) {
+	uuidPkg := types.NewPackage(loader.UUIDPath, "uuid")
+	uuidType := types.NewNamed(types.NewTypeName(0, uuidPkg, "UUID", nil), types.NewArray(types.Typ[types.Byte], 16), nil)
+	g := &Generator{
+		pfile:  &descriptorpb.FileDescriptorProto{},
+		curPkg: &loader.GunkPackage{ProtoName: "util"},
+	}
+	typ, label, name, err := g.convertType(types.NewSlice(uuidType))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typ != descriptorpb.FieldDescriptorProto_TYPE_STRING || label != descriptorpb.FieldDescriptorProto_LABEL_REPEATED || name != "" {
+		t.Errorf("[]uuid.UUID: got %v %v %q", typ, label, name)
+	}
+	o := &descriptorpb.FieldOptions{}
+	setUUIDFormat(o)
+	if got := proto.GetExtension(o, options.E_Openapiv2Field).(*options.JSONSchema).GetFormat(); got != "uuid" {
+		t.Errorf("format: got %q, want uuid", got)
+	}
+	proto.SetExtension(o, options.E_Openapiv2Field, &options.JSONSchema{Format: "uuid4"})
+	setUUIDFormat(o)
+	if got := proto.GetExtension(o, options.E_Openapiv2Field).(*options.JSONSchema).GetFormat(); got != "uuid4" {
+		t.Errorf("explicit format: got %q, want uuid4", got)
+	}
+}
+
+func TestConvertTypeGoogleTypes(t *testing.T) {
+	g := &Generator{
+		pfile:  &descriptorpb.FileDescriptorProto{},
+		curPkg: &loader.GunkPackage{ProtoName: "util"},
+	}
+	for _, tc := range []struct {
+		pkg, name string
+		want      string
+	}{
+		{"money", "Money", ".google.type.Money"},
+		{"date", "Date", ".google.type.Date"},
+		{"latlng", "LatLng", ".google.type.LatLng"},
+	} {
+		pkg := types.NewPackage(loader.GoogleapisPath+"type/"+tc.pkg, tc.pkg)
+		named := types.NewNamed(types.NewTypeName(0, pkg, tc.name, nil), types.NewStruct(nil, nil), nil)
+		typ, _, name, err := g.convertType(named)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if typ != descriptorpb.FieldDescriptorProto_TYPE_MESSAGE || name != tc.want {
+			t.Errorf("%s.%s: got %v %q, want %q", tc.pkg, tc.name, typ, name, tc.want)
+		}
+	}
+	wantDeps := []string{"google/type/money.proto", "google/type/date.proto", "google/type/latlng.proto"}
+	if !reflect.DeepEqual(g.pfile.Dependency, wantDeps) {
+		t.Errorf("dependencies: got %v, want %v", g.pfile.Dependency, wantDeps)
+	}
+	// The dependencies are bundled, so that protoc isn't needed to load them.
+	l := &loader.ProtoLoader{ProtocPath: filepath.Join(t.TempDir(), "protoc-not-installed")}
+	files, err := l.LoadProto(wantDeps...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != len(wantDeps) {
+		t.Errorf("got %d bundled files, want %d", len(files), len(wantDeps))
+	}
+}
+
+func TestConvertParameterEmptyStream(t *testing.T) {
+	emptyPkg := types.NewPackage("google.golang.org/protobuf/types/known/emptypb", "emptypb")
+	emptyType := types.NewNamed(types.NewTypeName(0, emptyPkg, "Empty", nil), types.NewStruct(nil, nil), nil)
+	g := &Generator{
+		pfile:  &descriptorpb.FileDescriptorProto{},
+		curPkg: &loader.GunkPackage{ProtoName: "util"},
+	}
+	params := types.NewTuple(types.NewVar(0, nil, "", types.NewChan(types.SendRecv, emptyType)))
+	name, stream, err := g.convertParameter(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name == nil || *name != ".google.protobuf.Empty" || stream == nil || !*stream {
+		t.Errorf("chan emptypb.Empty: got %v, stream %v", name, stream)
+	}
+	if want := []string{"google/protobuf/empty.proto"}; !reflect.DeepEqual(g.pfile.Dependency, want) {
+		t.Errorf("dependencies: got %v, want %v", g.pfile.Dependency, want)
+	}
+}
+
+func TestBufImage(t *testing.T) {
+	files := []*descriptorpb.FileDescriptorProto{
+		{Name: proto.String("google/protobuf/any.proto")},
+		{Name: proto.String("example.com/foo/all.proto"), Syntax: proto.String("proto3")},
+	}
+	b, err := bufImage(files, []string{"example.com/foo/all.proto"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// An image decodes as a FileDescriptorSet, keeping the buf
+	// extensions as unknown fields.
+	var fds descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(b, &fds); err != nil {
+		t.Fatal(err)
+	}
+	if len(fds.File) != 2 {
+		t.Fatalf("got %d files, want 2", len(fds.File))
+	}
+	for i, want := range [][]byte{
+		// is_import and is_syntax_unspecified
+		{0xd2, 0xf6, 0x03, 0x04, 0x08, 0x01, 0x18, 0x01},
+		// an empty extension for the target file
+		{0xd2, 0xf6, 0x03, 0x00},
+	} {
+		pfile := fds.File[i]
+		if got := []byte(pfile.ProtoReflect().GetUnknown()); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got extension %x, want %x", pfile.GetName(), got, want)
+		}
+	}
+}
+
+func TestCodeGenRequestDeterministic(t *testing.T) {
+	g := NewGenerator("")
+	for name, deps := range map[string][]string{
+		"example.com/api/all.proto":       {"example.com/types/all.proto", "google/protobuf/timestamp.proto"},
+		"example.com/types/all.proto":     {"google/protobuf/empty.proto"},
+		"example.com/admin/all.proto":     {"example.com/types/all.proto"},
+		"example.com/events/all.proto":    nil,
+		"google/protobuf/timestamp.proto": nil,
+		"google/protobuf/empty.proto":     nil,
+	} {
+		g.allProto[name] = &descriptorpb.FileDescriptorProto{Name: proto.String(name), Dependency: deps}
+	}
+	want := []string{
+		"example.com/events/all.proto",
+		"google/protobuf/empty.proto",
+		"example.com/types/all.proto",
+		"example.com/admin/all.proto",
+		"google/protobuf/timestamp.proto",
+		"example.com/api/all.proto",
+	}
+	// Map iteration order is random, so a few iterations are enough to
+	// catch any dependency on it.
+	for i := 0; i < 20; i++ {
+		var got []string
+		for _, pfile := range g.newCodeGenRequest("example.com/api").ProtoFile {
+			got = append(got, pfile.GetName())
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("got files %q, want %q", got, want)
+		}
+	}
+}
+
+func TestCodeGenRequestReader(t *testing.T) {
+	req := &codeGenRequest{CodeGeneratorRequest: &pluginpb.CodeGeneratorRequest{
+		FileToGenerate: []string{"util/all.proto"},
+		ProtoFile: []*descriptorpb.FileDescriptorProto{{
+			Name:    proto.String("util/all.proto"),
+			Package: proto.String("util"),
+		}},
+	}}
+	for _, param := range []string{"", "plugins=grpc", "paths=source_relative"} {
+		r, err := req.reader(param)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got pluginpb.CodeGeneratorRequest
+		if err := proto.Unmarshal(buf, &got); err != nil {
+			t.Fatal(err)
+		}
+		want := proto.Clone(req.CodeGeneratorRequest).(*pluginpb.CodeGeneratorRequest)
+		if param != "" {
+			want.Parameter = proto.String(param)
+		}
+		if !proto.Equal(&got, want) {
+			t.Errorf("reader(%q) decoded to %v, want %v", param, &got, want)
+		}
+	}
+}
+
+func TestCheckFeatures(t *testing.T) {
+	req := &pluginpb.CodeGeneratorRequest{
+		FileToGenerate: []string{"example.com/api/all.proto"},
+		ProtoFile: []*descriptorpb.FileDescriptorProto{{
+			Name:    proto.String("example.com/api/all.proto"),
+			Package: proto.String("api"),
+			Syntax:  proto.String("proto3"),
+			MessageType: []*descriptorpb.DescriptorProto{{
+				Name: proto.String("Event"),
+				NestedType: []*descriptorpb.DescriptorProto{{
+					Name: proto.String("Note"),
+					Field: []*descriptorpb.FieldDescriptorProto{
+						{Name: proto.String("text"), Proto3Optional: proto.Bool(true)},
+					},
+				}},
+			}},
+		}},
+	}
+	err := checkFeatures(req, &pluginpb.CodeGeneratorResponse{})
+	want := "does not support proto3 optional fields, used by api.Event.Note.text"
+	if err == nil || err.Error() != want {
+		t.Fatalf("got error %v, want %q", err, want)
+	}
+	resp := &pluginpb.CodeGeneratorResponse{
+		SupportedFeatures: proto.Uint64(uint64(pluginpb.CodeGeneratorResponse_FEATURE_PROTO3_OPTIONAL)),
+	}
+	if err := checkFeatures(req, resp); err != nil {
+		t.Fatal(err)
+	}
+	req.ProtoFile[0].Syntax = proto.String("editions")
+	if err := checkFeatures(req, resp); err == nil {
+		t.Fatal("editions are not declared as supported, but got no error")
+	}
+}
+
+func TestEndTranslation(t *testing.T) {
+	newPkg := func(path, dir string) *loader.GunkPackage {
+		pkg := &loader.GunkPackage{Dir: dir, GunkNames: []string{"a.gunk"}}
+		pkg.PkgPath = path
+		pkg.Types = types.NewPackage(path, "p")
+		pkg.TypesInfo = &types.Info{}
+		return pkg
+	}
+	gen, docs := newPkg("example.com/gen", "/gen"), newPkg("example.com/docs", "/docs")
+	g := &Generator{gunkPkgs: map[string]*loader.GunkPackage{
+		gen.PkgPath:  gen,
+		docs.PkgPath: docs,
+	}}
+	pkgConfigs := map[string]*config.Config{
+		"/gen":  {},
+		"/docs": {Generators: []config.Generator{{Command: "doc"}}},
+	}
+	pkgs := g.endTranslation([]*loader.GunkPackage{gen, docs}, pkgConfigs)
+	// The loaded packages are left untouched.
+	if gen.Types == nil || gen.TypesInfo == nil {
+		t.Fatal("the types of the loaded package were dropped")
+	}
+	if pkgs[0] == gen || pkgs[0].Types != nil || pkgs[0].TypesInfo != nil {
+		t.Fatal("got the loaded package, want a copy without its types")
+	}
+	if pkgs[0].PkgPath != gen.PkgPath || pkgs[0].Dir != gen.Dir || len(pkgs[0].GunkNames) != 1 {
+		t.Fatalf("got copy %+v, want it to keep the package's paths and names", pkgs[0])
+	}
+	if g.gunkPkgs[gen.PkgPath] != pkgs[0] {
+		t.Fatal("the generator kept the loaded package")
+	}
+	// The documented packages are kept whole.
+	if pkgs[1] != docs || g.gunkPkgs[docs.PkgPath] != docs {
+		t.Fatal("the documented package wasn't kept")
+	}
+}
+
+// liveHeap is the largest heap seen by the bench plugin.
+var liveHeap uint64
+
+func init() {
+	plugin.Register("bench", func(req *pluginpb.CodeGeneratorRequest) (*pluginpb.CodeGeneratorResponse, error) {
+		// Measure the memory still in use while the code is
+		// generated, which is what the Gunk syntax and types are
+		// released for.
+		runtime.GC()
+		var stats runtime.MemStats
+		runtime.ReadMemStats(&stats)
+		if stats.HeapAlloc > liveHeap {
+			liveHeap = stats.HeapAlloc
+		}
+		return &pluginpb.CodeGeneratorResponse{}, nil
+	})
+}
+
+// BenchmarkGenerateLargePackage generates a package of thousands of messages,
+// reporting the heap in use during the generation as live-B/op.
+func BenchmarkGenerateLargePackage(b *testing.B) {
+	if runtime.GOOS == "windows" {
+		b.Skip("the fake protoc is a shell script")
+	}
+	dir := b.TempDir()
+	var src strings.Builder
+	src.WriteString("package big\n")
+	for i := 0; i < 2000; i++ {
+		fmt.Fprintf(&src, "\n// Message%d is a message.\ntype Message%d struct {\n", i, i)
+		for j := 1; j <= 10; j++ {
+			fmt.Fprintf(&src, "\t// Field%d is a field.\n\tField%d string `pb:\"%d\" json:\"field%d\"`\n", j, j, j, j)
+		}
+		src.WriteString("}\n")
+	}
+	files := map[string]string{
+		"go.mod":      "module testdata.tld/big\n",
+		"protoc":      "#!/bin/sh\necho libprotoc 3.9.1\n",
+		".gunkconfig": "[protoc]\npath=" + filepath.Join(dir, "protoc") + "\n\n[generate]\ncommand=protoc-gen-bench\n",
+		"big.gunk":    src.String(),
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0o755); err != nil {
+			b.Fatal(err)
+		}
+	}
+	liveHeap = 0
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := run(dir, "."); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(liveHeap), "live-B/op")
+}
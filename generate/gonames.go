@@ -0,0 +1,159 @@
+package generate
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+// goImport is an imported Go package.
+type goImport struct {
+	Name, Path string
+}
+
+// parseGoPackage returns the import path and package name of a go_package
+// option.
+func parseGoPackage(goPackage string) goImport {
+	if i := strings.LastIndex(goPackage, ";"); i >= 0 {
+		return goImport{Name: goPackage[i+1:], Path: goPackage[:i]}
+	}
+	return goImport{Name: path.Base(goPackage), Path: goPackage}
+}
+
+// goNames names the Go types generated for the messages and services of a
+// request, in the Go code written by the built-in generators, collecting the
+// imports that the code needs.
+type goNames struct {
+	// genPkg is the Go package generated for the files to generate, and
+	// protoPkg and services are their package and services.
+	genPkg   goImport
+	protoPkg string
+	services []*descriptorpb.ServiceDescriptorProto
+	// inGenPkg is whether the code is written in the generated package.
+	inGenPkg bool
+
+	types   map[string]goType // by full message name
+	imports map[string]string // local names by import path
+	used    map[string]bool   // local names
+}
+
+// goType is a Go type generated for a message. Nested messages are named like
+// Outer_Inner.
+type goType struct {
+	imp  goImport
+	name string
+}
+
+func newGoNames(req *pluginpb.CodeGeneratorRequest) *goNames {
+	n := &goNames{
+		inGenPkg: true,
+		types:    make(map[string]goType),
+		imports:  make(map[string]string),
+		// The standard packages which the code may use.
+		used: map[string]bool{"context": true, "grpc": true, "sync": true, "codes": true, "status": true},
+	}
+	isTarget := make(map[string]bool, len(req.FileToGenerate))
+	for _, name := range req.FileToGenerate {
+		isTarget[name] = true
+	}
+	for _, pfile := range req.ProtoFile {
+		imp := parseGoPackage(pfile.GetOptions().GetGoPackage())
+		var add func(prefix, goPrefix string, msgs []*descriptorpb.DescriptorProto)
+		add = func(prefix, goPrefix string, msgs []*descriptorpb.DescriptorProto) {
+			for _, msg := range msgs {
+				name := goPrefix + msg.GetName()
+				n.types[prefix+"."+msg.GetName()] = goType{imp, name}
+				add(prefix+"."+msg.GetName(), name+"_", msg.GetNestedType())
+			}
+		}
+		add("."+pfile.GetPackage(), "", pfile.GetMessageType())
+		if isTarget[pfile.GetName()] {
+			n.genPkg = imp
+			n.protoPkg = pfile.GetPackage()
+			n.services = append(n.services, pfile.GetService()...)
+		}
+	}
+	return n
+}
+
+// use imports a standard package, returning its name.
+func (n *goNames) use(path string) string {
+	name := path[strings.LastIndex(path, "/")+1:]
+	n.imports[path] = name
+	n.used[name] = true
+	return name
+}
+
+// qualify returns the qualified name of a declaration of a package, importing
+// the package if needed.
+func (n *goNames) qualify(imp goImport, name string) string {
+	if imp.Path == n.genPkg.Path && n.inGenPkg {
+		return name
+	}
+	local, ok := n.imports[imp.Path]
+	if !ok {
+		local = imp.Name
+		for i := 2; n.used[local]; i++ {
+			local = fmt.Sprintf("%s%d", imp.Name, i)
+		}
+		n.used[local] = true
+		n.imports[imp.Path] = local
+	}
+	return local + "." + name
+}
+
+// gen returns the qualified name of a declaration of the generated package.
+func (n *goNames) gen(name string) string {
+	return n.qualify(n.genPkg, name)
+}
+
+// message returns the pointer type of a message.
+func (n *goNames) message(typeName string) string {
+	t := n.types[typeName]
+	return "*" + n.qualify(t.imp, t.name)
+}
+
+// importList returns the imports used by the code, sorted by path.
+func (n *goNames) importList() []goImport {
+	var list []goImport
+	for p, name := range n.imports {
+		list = append(list, goImport{Name: name, Path: p})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Path < list[j].Path })
+	return list
+}
+
+// importDecl returns the import declaration of a list of imports, with the
+// standard packages first.
+func importDecl(list []goImport) string {
+	var std, others []string
+	for _, imp := range list {
+		spec := strconv.Quote(imp.Path)
+		if imp.Name != path.Base(imp.Path) {
+			spec = imp.Name + " " + spec
+		}
+		if strings.Contains(strings.SplitN(imp.Path, "/", 2)[0], ".") {
+			others = append(others, spec)
+		} else {
+			std = append(std, spec)
+		}
+	}
+	var b strings.Builder
+	b.WriteString("import (\n")
+	for _, spec := range std {
+		b.WriteString("\t" + spec + "\n")
+	}
+	if len(std) > 0 && len(others) > 0 {
+		b.WriteString("\n")
+	}
+	for _, spec := range others {
+		b.WriteString("\t" + spec + "\n")
+	}
+	b.WriteString(")\n")
+	return b.String()
+}
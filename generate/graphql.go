@@ -0,0 +1,297 @@
+package generate
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gunk/gunk/config"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+// graphQLWellKnown are the GraphQL types of the well-known types. Those which
+// aren't built in are declared as custom scalars.
+var graphQLWellKnown = map[string]string{
+	".google.protobuf.Timestamp":   "Timestamp",
+	".google.protobuf.Duration":    "Duration",
+	".google.protobuf.FieldMask":   "String",
+	".google.protobuf.Struct":      "JSON",
+	".google.protobuf.Value":       "JSON",
+	".google.protobuf.ListValue":   "JSON",
+	".google.protobuf.Any":         "JSON",
+	".google.protobuf.DoubleValue": "Float",
+	".google.protobuf.FloatValue":  "Float",
+	".google.protobuf.Int64Value":  "String",
+	".google.protobuf.UInt64Value": "String",
+	".google.protobuf.Int32Value":  "Int",
+	".google.protobuf.UInt32Value": "Int",
+	".google.protobuf.BoolValue":   "Boolean",
+	".google.protobuf.StringValue": "String",
+	".google.protobuf.BytesValue":  "String",
+}
+
+// generateGraphQL writes a GraphQL schema of the package requested in the
+// CodeGeneratorRequest, named like "foo.graphql".
+func (g *Generator) generateGraphQL(req *pluginpb.CodeGeneratorRequest, gen config.Generator) error {
+	if len(gen.Params) > 0 {
+		return fmt.Errorf("unknown graphql parameter %q", gen.Params[0].Key)
+	}
+	ftgs := req.GetFileToGenerate()
+	if len(ftgs) == 0 {
+		return fmt.Errorf("no files to generate")
+	}
+	mainPkgPath := filepath.Clean(filepath.Dir(ftgs[0]))
+	mainPkg, ok := g.gunkPkgs[mainPkgPath]
+	if !ok {
+		return fmt.Errorf("failed to get main package: %s", mainPkgPath)
+	}
+	schema, err := graphQLSchema(req)
+	if err != nil {
+		return err
+	}
+	dir, err := outPath(gen, mainPkg.Dir, mainPkg.Name)
+	if err != nil {
+		return fmt.Errorf("unable to build output path for %q: %w", mainPkg.Dir, err)
+	}
+	if err := mkdirAll(dir); err != nil {
+		return fmt.Errorf("unable to create directory %q: %w", dir, err)
+	}
+	return g.writePkgFile(mainPkgPath, filepath.Join(dir, mainPkg.Name+".graphql"), schema)
+}
+
+// graphQLBuilder builds a GraphQL schema from the files of a request. Types
+// are declared in the order in which they are first used.
+type graphQLBuilder struct {
+	*protoIndex
+	scalars  map[string]bool
+	declared map[string]bool
+	queue    []func()
+	defs     bytes.Buffer
+}
+
+// graphQLSchema returns the GraphQL schema of the files to generate of the
+// request. The methods with GET HTTP rules are queries and the ones with
+// other HTTP rules are mutations, taking the fields of their input as
+// arguments. Streaming methods and methods without HTTP rules are left out.
+// The messages used by the operations are object types, or input types when
+// used as arguments, and messages without fields are booleans.
+func graphQLSchema(req *pluginpb.CodeGeneratorRequest) ([]byte, error) {
+	b := &graphQLBuilder{
+		protoIndex: newProtoIndex(req.ProtoFile),
+		scalars:    make(map[string]bool),
+		declared:   make(map[string]bool),
+	}
+	isTarget := make(map[string]bool, len(req.FileToGenerate))
+	for _, name := range req.FileToGenerate {
+		isTarget[name] = true
+	}
+	var queries, mutations bytes.Buffer
+	fields := make(map[string]string)
+	for _, pfile := range req.ProtoFile {
+		if !isTarget[pfile.GetName()] {
+			continue
+		}
+		for _, srv := range pfile.GetService() {
+			srvName := "." + pfile.GetPackage() + "." + srv.GetName()
+			for _, method := range srv.GetMethod() {
+				if method.GetClientStreaming() || method.GetServerStreaming() {
+					continue
+				}
+				if !proto.HasExtension(method.GetOptions(), annotations.E_Http) {
+					continue
+				}
+				rule := proto.GetExtension(method.GetOptions(), annotations.E_Http).(*annotations.HttpRule)
+				ops := &mutations
+				if rule.GetGet() != "" {
+					ops = &queries
+				}
+				name := lowerFirst(method.GetName())
+				if prev, ok := fields[name]; ok {
+					return nil, fmt.Errorf("%s.%s: operation %q already defined by %s", srv.GetName(), method.GetName(), name, prev)
+				}
+				fields[name] = srv.GetName() + "." + method.GetName()
+				b.writeDescription(ops, "  ", b.comments[srvName+"."+method.GetName()])
+				ops.WriteString("  " + name)
+				if input := b.messages[method.GetInputType()]; len(input.GetField()) > 0 {
+					ops.WriteString("(\n")
+					for _, field := range input.GetField() {
+						b.writeDescription(ops, "    ", b.comments[method.GetInputType()+"."+field.GetName()])
+						fmt.Fprintf(ops, "    %s: %s\n", fieldJSONName(field), b.fieldType(field, true))
+					}
+					ops.WriteString("  )")
+				}
+				fmt.Fprintf(ops, ": %s", b.typeRef(method.GetOutputType(), false))
+				if method.GetOptions().GetDeprecated() {
+					ops.WriteString(" @deprecated")
+				}
+				ops.WriteString("\n")
+			}
+		}
+	}
+	for len(b.queue) > 0 {
+		decl := b.queue[0]
+		b.queue = b.queue[1:]
+		decl()
+	}
+	var buf bytes.Buffer
+	buf.WriteString("# Code generated by gunk. DO NOT EDIT.\n")
+	scalars := make([]string, 0, len(b.scalars))
+	for name := range b.scalars {
+		scalars = append(scalars, name)
+	}
+	sort.Strings(scalars)
+	for _, name := range scalars {
+		fmt.Fprintf(&buf, "\nscalar %s\n", name)
+	}
+	if queries.Len() > 0 {
+		fmt.Fprintf(&buf, "\ntype Query {\n%s}\n", queries.Bytes())
+	}
+	if mutations.Len() > 0 {
+		fmt.Fprintf(&buf, "\ntype Mutation {\n%s}\n", mutations.Bytes())
+	}
+	buf.Write(b.defs.Bytes())
+	return buf.Bytes(), nil
+}
+
+// fieldType returns the GraphQL type of a field. Lists and the scalars of
+// object types are non-null, following the proto3 semantics, unless the
+// field is optional. The fields of input types may all be omitted.
+func (b *graphQLBuilder) fieldType(field *descriptorpb.FieldDescriptorProto, input bool) string {
+	if field.GetLabel() == descriptorpb.FieldDescriptorProto_LABEL_REPEATED {
+		typ := "[" + b.valueType(field, input) + "!]"
+		if !input {
+			typ += "!"
+		}
+		return typ
+	}
+	typ := b.valueType(field, input)
+	if input || field.GetProto3Optional() || field.GetType() == descriptorpb.FieldDescriptorProto_TYPE_MESSAGE {
+		return typ
+	}
+	return typ + "!"
+}
+
+// valueType returns the GraphQL type of a single value of a field.
+func (b *graphQLBuilder) valueType(field *descriptorpb.FieldDescriptorProto, input bool) string {
+	switch field.GetType() {
+	case descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, descriptorpb.FieldDescriptorProto_TYPE_ENUM:
+		return b.typeRef(field.GetTypeName(), input)
+	case descriptorpb.FieldDescriptorProto_TYPE_DOUBLE, descriptorpb.FieldDescriptorProto_TYPE_FLOAT:
+		return "Float"
+	case descriptorpb.FieldDescriptorProto_TYPE_INT32,
+		descriptorpb.FieldDescriptorProto_TYPE_SINT32,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED32,
+		descriptorpb.FieldDescriptorProto_TYPE_UINT32,
+		descriptorpb.FieldDescriptorProto_TYPE_FIXED32:
+		return "Int"
+	case descriptorpb.FieldDescriptorProto_TYPE_BOOL:
+		return "Boolean"
+	default:
+		// 64-bit integers are strings in the JSON mapping, as they
+		// don't fit in GraphQL's 32-bit Int.
+		return "String"
+	}
+}
+
+// typeRef returns the name of the GraphQL type of a message or an enum,
+// declaring it if needed.
+func (b *graphQLBuilder) typeRef(typeName string, input bool) string {
+	if name, ok := graphQLWellKnown[typeName]; ok {
+		switch name {
+		case "String", "Int", "Float", "Boolean":
+		default:
+			b.scalars[name] = true
+		}
+		return name
+	}
+	name := strings.ReplaceAll(strings.TrimPrefix(typeName, "."+b.packages[typeName]+"."), ".", "_")
+	if enum := b.enums[typeName]; enum != nil {
+		if !b.declared[name] {
+			b.declared[name] = true
+			b.queue = append(b.queue, func() { b.writeEnum(name, typeName, enum) })
+		}
+		return name
+	}
+	msg := b.messages[typeName]
+	if len(msg.GetField()) == 0 {
+		// Includes google.protobuf.Empty, and messages missing from
+		// the request.
+		return "Boolean"
+	}
+	if input {
+		name += "Input"
+	}
+	if !b.declared[name] {
+		b.declared[name] = true
+		b.queue = append(b.queue, func() { b.writeMessage(name, typeName, msg, input) })
+	}
+	return name
+}
+
+func (b *graphQLBuilder) writeEnum(name, typeName string, enum *descriptorpb.EnumDescriptorProto) {
+	b.defs.WriteString("\n")
+	b.writeDescription(&b.defs, "", b.comments[typeName])
+	fmt.Fprintf(&b.defs, "enum %s {\n", name)
+	for _, v := range enum.GetValue() {
+		b.writeDescription(&b.defs, "  ", b.comments[typeName+"."+v.GetName()])
+		b.defs.WriteString("  " + v.GetName())
+		if v.GetOptions().GetDeprecated() {
+			b.defs.WriteString(" @deprecated")
+		}
+		b.defs.WriteString("\n")
+	}
+	b.defs.WriteString("}\n")
+}
+
+func (b *graphQLBuilder) writeMessage(name, typeName string, msg *descriptorpb.DescriptorProto, input bool) {
+	kind := "type"
+	if input {
+		kind = "input"
+	}
+	b.defs.WriteString("\n")
+	b.writeDescription(&b.defs, "", b.comments[typeName])
+	fmt.Fprintf(&b.defs, "%s %s {\n", kind, name)
+	for _, field := range msg.GetField() {
+		b.writeDescription(&b.defs, "  ", b.comments[typeName+"."+field.GetName()])
+		fmt.Fprintf(&b.defs, "  %s: %s", fieldJSONName(field), b.fieldType(field, input))
+		// Input fields can't be deprecated before the 2021 edition
+		// of the specification.
+		if !input && field.GetOptions().GetDeprecated() {
+			b.defs.WriteString(" @deprecated")
+		}
+		b.defs.WriteString("\n")
+	}
+	b.defs.WriteString("}\n")
+}
+
+// writeDescription writes a block string describing the next definition, if
+// there's any documentation.
+func (b *graphQLBuilder) writeDescription(buf *bytes.Buffer, indent, text string) {
+	if text == "" {
+		return
+	}
+	text = strings.ReplaceAll(text, `"""`, `\"""`)
+	fmt.Fprintf(buf, "%s\"\"\"\n", indent)
+	for _, line := range strings.Split(text, "\n") {
+		if line == "" {
+			buf.WriteString("\n")
+			continue
+		}
+		fmt.Fprintf(buf, "%s%s\n", indent, line)
+	}
+	fmt.Fprintf(buf, "%s\"\"\"\n", indent)
+}
+
+// lowerFirst returns s with its first letter in lower case, such as "getUser"
+// for "GetUser".
+func lowerFirst(s string) string {
+	r, n := utf8.DecodeRuneInString(s)
+	return string(unicode.ToLower(r)) + s[n:]
+}
@@ -0,0 +1,67 @@
+package generate
+
+import (
+	"strings"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+func TestGraphQLSchema(t *testing.T) {
+	message := descriptorpb.FieldDescriptorProto_TYPE_MESSAGE
+	str := descriptorpb.FieldDescriptorProto_TYPE_STRING
+	get := &descriptorpb.MethodOptions{}
+	proto.SetExtension(get, annotations.E_Http, &annotations.HttpRule{
+		Pattern: &annotations.HttpRule_Get{Get: "/v1/events"},
+	})
+	newReq := func(services ...*descriptorpb.ServiceDescriptorProto) *pluginpb.CodeGeneratorRequest {
+		return &pluginpb.CodeGeneratorRequest{
+			FileToGenerate: []string{"example.com/api/all.proto"},
+			ProtoFile: []*descriptorpb.FileDescriptorProto{{
+				Name:    proto.String("example.com/api/all.proto"),
+				Package: proto.String("api"),
+				MessageType: []*descriptorpb.DescriptorProto{{
+					Name: proto.String("Event"),
+					Field: []*descriptorpb.FieldDescriptorProto{
+						{Name: proto.String("created_at"), Type: &message, TypeName: proto.String(".google.protobuf.Timestamp")},
+						{Name: proto.String("count"), Type: &message, TypeName: proto.String(".google.protobuf.Int32Value")},
+						{Name: proto.String("note"), Type: &str, Proto3Optional: proto.Bool(true)},
+					},
+				}},
+				Service: services,
+			}},
+		}
+	}
+	method := &descriptorpb.MethodDescriptorProto{
+		Name:       proto.String("Events"),
+		InputType:  proto.String(".google.protobuf.Empty"),
+		OutputType: proto.String(".api.Event"),
+		Options:    get,
+	}
+	schema, err := graphQLSchema(newReq(&descriptorpb.ServiceDescriptorProto{
+		Name:   proto.String("Events"),
+		Method: []*descriptorpb.MethodDescriptorProto{method},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"scalar Timestamp\n",
+		"type Query {\n  events: Event\n}\n",
+		"type Event {\n  createdAt: Timestamp\n  count: Int\n  note: String\n}\n",
+	} {
+		if !strings.Contains(string(schema), want) {
+			t.Errorf("%q not found in:\n%s", want, schema)
+		}
+	}
+	_, err = graphQLSchema(newReq(
+		&descriptorpb.ServiceDescriptorProto{Name: proto.String("First"), Method: []*descriptorpb.MethodDescriptorProto{method}},
+		&descriptorpb.ServiceDescriptorProto{Name: proto.String("Second"), Method: []*descriptorpb.MethodDescriptorProto{method}},
+	))
+	if want := `Second.Events: operation "events" already defined by First.Events`; err == nil || err.Error() != want {
+		t.Errorf("got error %v, expected %q", err, want)
+	}
+}
@@ -0,0 +1,80 @@
+// Package inprocess runs the Go code generators within the gunk process, as
+// they are Go libraries, instead of executing their plugin binaries. The
+// generated code is that of the versions gunk is built with.
+package inprocess
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	gengo "google.golang.org/protobuf/cmd/protoc-gen-go/internal_gengo"
+	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+type generator func(flags *flag.FlagSet) func(gen *protogen.Plugin) error
+
+var generators = map[string]generator{
+	"go":      generateGo,
+	"grpc-go": generateGRPC,
+}
+
+// Has reports whether the generator with the given name, such as "go", can be
+// run in process.
+func Has(name string) bool {
+	_, ok := generators[name]
+	return ok
+}
+
+// Generate runs the generator with the given name on the request, as its
+// plugin binary would. Errors in the request or its parameter are returned in
+// the response, like plugins do.
+func Generate(name string, req *pluginpb.CodeGeneratorRequest) (*pluginpb.CodeGeneratorResponse, error) {
+	g, ok := generators[name]
+	if !ok {
+		return nil, fmt.Errorf("generator %s cannot be run in process", name)
+	}
+	var flags flag.FlagSet
+	run := g(&flags)
+	plugin, err := protogen.Options{ParamFunc: flags.Set}.New(req)
+	if err != nil {
+		return &pluginpb.CodeGeneratorResponse{Error: proto.String(err.Error())}, nil
+	}
+	if err := run(plugin); err != nil {
+		plugin.Error(err)
+	}
+	return plugin.Response(), nil
+}
+
+// generateGo is the equivalent of protoc-gen-go.
+func generateGo(flags *flag.FlagSet) func(gen *protogen.Plugin) error {
+	plugins := flags.String("plugins", "", "deprecated option")
+	return func(gen *protogen.Plugin) error {
+		if *plugins != "" {
+			return errors.New("protoc-gen-go: plugins are not supported; use 'protoc --go-grpc_out=...' to generate gRPC")
+		}
+		for _, f := range gen.Files {
+			if f.Generate {
+				gengo.GenerateFile(gen, f)
+			}
+		}
+		gen.SupportedFeatures = gengo.SupportedFeatures
+		return nil
+	}
+}
+
+// generateGRPC is the equivalent of protoc-gen-go-grpc.
+func generateGRPC(flags *flag.FlagSet) func(gen *protogen.Plugin) error {
+	requireUnimplemented := flags.Bool("require_unimplemented_servers", true, "set to false to match legacy behavior")
+	return func(gen *protogen.Plugin) error {
+		gen.SupportedFeatures = uint64(pluginpb.CodeGeneratorResponse_FEATURE_PROTO3_OPTIONAL)
+		for _, f := range gen.Files {
+			if f.Generate {
+				generateGRPCFile(gen, f, *requireUnimplemented)
+			}
+		}
+		return nil
+	}
+}
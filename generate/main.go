@@ -0,0 +1,195 @@
+package generate
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/gunk/gunk/config"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/pluginpb"
+	"mvdan.cc/gofumpt/format"
+)
+
+// mainTmpl is the template of the main package serving the services of a
+// package.
+var mainTmpl = template.Must(template.New("main").Parse(`// Code generated by gunk. DO NOT EDIT.
+
+// Command {{.Name}} serves the services of {{.Path}}.
+package main
+
+{{.Imports}}
+var (
+	grpcAddr = flag.String("grpc-addr", ":8080", "the address to serve gRPC on")
+{{- if .Gateway}}
+	httpAddr = flag.String("http-addr", ":8081", "the address to serve the HTTP gateway on")
+{{- end}}
+)
+
+func main() {
+	flag.Parse()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	lis, err := net.Listen("tcp", *grpcAddr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	s := grpc.NewServer()
+	healthServer := health.NewServer()
+{{- range .Services}}
+	{{.Register}}(s, {{.New}}())
+	healthServer.SetServingStatus({{printf "%q" .FullName}}, healthpb.HealthCheckResponse_SERVING)
+{{- end}}
+	healthpb.RegisterHealthServer(s, healthServer)
+	reflection.Register(s)
+{{- if .Gateway}}
+
+	mux := runtime.NewServeMux()
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+{{- range .Services}}{{if .Gateway}}
+	if err := {{.Gateway}}(ctx, mux, *grpcAddr, opts); err != nil {
+		log.Fatal(err)
+	}
+{{- end}}{{end}}
+	httpServer := &http.Server{Addr: *httpAddr, Handler: mux}
+	go func() {
+		log.Printf("serving HTTP on %s", *httpAddr)
+		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+{{- end}}
+
+	go func() {
+		<-ctx.Done()
+		healthServer.Shutdown()
+{{- if .Gateway}}
+		httpServer.Shutdown(context.Background())
+{{- end}}
+		s.GracefulStop()
+	}()
+	log.Printf("serving gRPC on %s", lis.Addr())
+	if err := s.Serve(lis); err != nil {
+		log.Fatal(err)
+	}
+}
+`))
+
+type mainFile struct {
+	Name     string
+	Path     string
+	Imports  string
+	Gateway  bool
+	Services []mainService
+}
+
+type mainService struct {
+	FullName string // such as "api.Users"
+	Register string // such as "api.RegisterUsersServer"
+	New      string // such as "apiserver.NewUsersServer"
+	Gateway  string // such as "api.RegisterUsersHandlerFromEndpoint"
+}
+
+// generateMain writes a main package serving the services of the package
+// requested in the CodeGeneratorRequest with gRPC, to "cmd/foo/main.go" in the
+// output directory. The services are implemented by the package at the import
+// path set by the "server_import" parameter, which defaults to the package
+// written by the scaffold generator. The health checking and reflection
+// services are registered too, and the services are also served over HTTP by
+// grpc-gateway if "gateway" is set.
+func (g *Generator) generateMain(req *pluginpb.CodeGeneratorRequest, gen config.Generator) error {
+	ftgs := req.GetFileToGenerate()
+	if len(ftgs) == 0 {
+		return fmt.Errorf("no files to generate")
+	}
+	mainPkgPath := filepath.Clean(filepath.Dir(ftgs[0]))
+	mainPkg, ok := g.gunkPkgs[mainPkgPath]
+	if !ok {
+		return fmt.Errorf("failed to get main package: %s", mainPkgPath)
+	}
+	src, err := mainSource(req, gen, mainPkg.Name)
+	if err != nil {
+		return err
+	}
+	if src == nil {
+		return nil
+	}
+	dir, err := outPath(gen, mainPkg.Dir, mainPkg.Name)
+	if err != nil {
+		return fmt.Errorf("unable to build output path for %q: %w", mainPkg.Dir, err)
+	}
+	dir = filepath.Join(dir, "cmd", mainPkg.Name)
+	if err := mkdirAll(dir); err != nil {
+		return fmt.Errorf("unable to create directory %q: %w", dir, err)
+	}
+	return g.writePkgFile(mainPkgPath, filepath.Join(dir, "main.go"), src)
+}
+
+// mainSource returns the source of the main package serving the services of
+// the files to generate of the request, or nil if there are no services.
+func mainSource(req *pluginpb.CodeGeneratorRequest, gen config.Generator, pkgName string) ([]byte, error) {
+	names := newGoNames(req)
+	names.inGenPkg = false
+	if len(names.services) == 0 {
+		return nil, nil
+	}
+	f := &mainFile{Name: pkgName, Path: names.genPkg.Path}
+	serverImport := names.genPkg.Path + "/" + pkgName + "server"
+	for _, kv := range gen.Params {
+		switch kv.Key {
+		case "server_import":
+			serverImport = kv.Value
+		case "gateway":
+			v, err := strconv.ParseBool(kv.Value)
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse gateway: %w", err)
+			}
+			f.Gateway = v
+		default:
+			return nil, fmt.Errorf("unknown main parameter %q", kv.Key)
+		}
+	}
+	for _, p := range []string{
+		"context", "flag", "log", "net", "os", "os/signal",
+		"google.golang.org/grpc", "google.golang.org/grpc/health", "google.golang.org/grpc/reflection",
+	} {
+		names.use(p)
+	}
+	names.imports["google.golang.org/grpc/health/grpc_health_v1"] = "healthpb"
+	names.used["healthpb"] = true
+	if f.Gateway {
+		names.use("net/http")
+		names.use("github.com/grpc-ecosystem/grpc-gateway/v2/runtime")
+		names.use("google.golang.org/grpc/credentials/insecure")
+	}
+	serverPkg := goImport{Name: serverImport[strings.LastIndex(serverImport, "/")+1:], Path: serverImport}
+	for _, srv := range names.services {
+		s := mainService{
+			FullName: names.protoPkg + "." + srv.GetName(),
+			Register: names.gen("Register" + srv.GetName() + "Server"),
+			New:      names.qualify(serverPkg, "New"+srv.GetName()+"Server"),
+		}
+		for _, method := range srv.GetMethod() {
+			if f.Gateway && proto.HasExtension(method.GetOptions(), annotations.E_Http) {
+				s.Gateway = names.gen("Register" + srv.GetName() + "HandlerFromEndpoint")
+				break
+			}
+		}
+		f.Services = append(f.Services, s)
+	}
+	f.Imports = importDecl(names.importList())
+	var buf bytes.Buffer
+	if err := mainTmpl.Execute(&buf, f); err != nil {
+		return nil, fmt.Errorf("unable to generate main: %w", err)
+	}
+	src, err := format.Source(buf.Bytes(), format.Options{LangVersion: "1.14"})
+	if err != nil {
+		return nil, fmt.Errorf("unable to format main: %w", err)
+	}
+	return src, nil
+}
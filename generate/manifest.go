@@ -0,0 +1,147 @@
+package generate
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gunk/gunk/log"
+)
+
+// manifestName is the name of the manifest written in the directory of each
+// generated package, which lists the files generated for the package.
+const manifestName = ".gunkmanifest"
+
+const manifestHeader = "# Code generated by gunk. DO NOT EDIT.\n"
+
+// Cleaning makes Run remove the files listed in the manifests of the generated
+// packages which are no longer generated, such as after a service was deleted
+// or a generator was removed from a .gunkconfig.
+var Cleaning bool
+
+// pkgOutputs holds the files generated for each package, keyed by import path.
+type pkgOutputs struct {
+	mu    sync.Mutex
+	files map[string]map[string]bool
+}
+
+func (o *pkgOutputs) add(pkgPath, path string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.files == nil {
+		o.files = make(map[string]map[string]bool)
+	}
+	if o.files[pkgPath] == nil {
+		o.files[pkgPath] = make(map[string]bool)
+	}
+	o.files[pkgPath][path] = true
+}
+
+// writePkgFile writes a file generated for the package with the import path,
+// recording it for the package's manifest.
+func (g *Generator) writePkgFile(pkgPath, path string, buf []byte) error {
+	if err := writeFile(path, buf); err != nil {
+		return err
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	g.outputs.add(pkgPath, path)
+	return nil
+}
+
+// writeManifest writes the manifest of a generated package. Files from the
+// previous manifest which were not generated this time, but still exist, are
+// stale: they are removed when cleaning, and otherwise kept in the manifest so
+// that a later clean can still find them.
+func (g *Generator) writeManifest(pkgPath, dir string) error {
+	name := filepath.Join(dir, manifestName)
+	files := g.outputs.files[pkgPath]
+	old, err := readManifest(name)
+	if err != nil {
+		return err
+	}
+	var list []string
+	for path := range files {
+		list = append(list, path)
+	}
+	for _, path := range old {
+		if files[path] {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		if !Cleaning {
+			log.Printf("%s is no longer generated; remove it with gunk clean", relPath(path))
+			list = append(list, path)
+			continue
+		}
+		if err := removeFile(path); err != nil {
+			return err
+		}
+	}
+	if len(list) == 0 {
+		if len(old) == 0 {
+			return nil
+		}
+		return removeFile(name)
+	}
+	var buf bytes.Buffer
+	buf.WriteString(manifestHeader)
+	for i, path := range list {
+		if rel, err := filepath.Rel(dir, path); err == nil {
+			list[i] = filepath.ToSlash(rel)
+		}
+	}
+	sort.Strings(list)
+	for _, path := range list {
+		fmt.Fprintln(&buf, path)
+	}
+	return writeFile(name, buf.Bytes())
+}
+
+// readManifest returns the absolute paths of the files listed in the manifest
+// at name, which need not exist.
+func readManifest(name string) ([]string, error) {
+	f, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var files []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		files = append(files, filepath.Join(filepath.Dir(name), filepath.FromSlash(line)))
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read %s: %w", name, err)
+	}
+	return files, nil
+}
+
+// removeFile removes a stale generated file, unless in a dry run or when
+// diffing, in which case the removal is only recorded in dryRunFiles.
+func removeFile(path string) error {
+	if DryRun || Diff {
+		old, _ := os.ReadFile(path)
+		dryRunFiles.add(fileChange{op: "remove", path: path, old: old})
+		return nil
+	}
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	log.Verbosef("removed %s", relPath(path))
+	return nil
+}
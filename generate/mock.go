@@ -0,0 +1,252 @@
+package generate
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/gunk/gunk/config"
+	"google.golang.org/protobuf/types/pluginpb"
+	"mvdan.cc/gofumpt/format"
+)
+
+// mockTmpl is the template of the mocks of a package's services, in the style
+// of moq: each method calls a function field, and records its calls.
+var mockTmpl = template.Must(template.New("mock").Parse(`// Code generated by gunk. DO NOT EDIT.
+
+package {{.Package}}
+
+{{.Imports}}{{range $t := .Mocks}}
+// {{.Name}} is a mock implementation of {{.Iface}}.
+type {{.Name}} struct {
+{{- if .Embed}}
+	{{.Embed}}
+{{end}}
+{{- range .Methods}}
+	// {{.Name}}Func mocks the {{.Name}} method.
+	{{.Name}}Func func({{.Params}}) {{.Results}}
+{{end}}
+	mu    sync.Mutex
+	calls struct {
+{{- range .Methods}}
+		{{.Name}} []{{$t.Pkg}}{{.Name}}Call
+{{- end}}
+	}
+}
+{{range .Methods}}
+// {{$t.Pkg}}{{.Name}}Call holds the arguments of a call to {{.Name}}.
+type {{$t.Pkg}}{{.Name}}Call struct {
+{{- range .Args}}
+	{{.Field}} {{.Type}}
+{{- end}}
+}
+{{end}}
+{{- range .Methods}}
+// {{.Name}} calls {{.Name}}Func.
+func (m *{{$t.Name}}) {{.Name}}({{.Params}}) {{.Results}} {
+	if m.{{.Name}}Func == nil {
+		panic("{{$t.Name}}.{{.Name}}Func: method is nil but {{$t.Iface}}.{{.Name}} was just called")
+	}
+	m.mu.Lock()
+	m.calls.{{.Name}} = append(m.calls.{{.Name}}, {{$t.Pkg}}{{.Name}}Call{
+{{- range .Args}}{{.Field}}: {{.Name}}, {{end -}}
+	})
+	m.mu.Unlock()
+	return m.{{.Name}}Func({{.Call}})
+}
+
+// {{.Name}}Calls returns the calls made to {{.Name}}.
+func (m *{{$t.Name}}) {{.Name}}Calls() []{{$t.Pkg}}{{.Name}}Call {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.calls.{{.Name}}
+}
+{{end}}
+{{- end}}
+`))
+
+type mockFile struct {
+	Package string
+	Imports string
+	Mocks   []*mockType
+}
+
+type mockType struct {
+	Name    string // such as UsersServerMock
+	Pkg     string // the prefix of its call types, such as UsersServer
+	Iface   string
+	Embed   string
+	Methods []mockMethod
+}
+
+type mockMethod struct {
+	Name    string
+	Params  string
+	Results string
+	Call    string
+	Args    []mockArg
+}
+
+type mockArg struct {
+	Name, Field, Type string
+}
+
+// generateMock writes mocks of the gRPC servers and clients of the package
+// requested in the CodeGeneratorRequest, as generated by grpc-go, to a file
+// named like "foo_mock.pb.go". The "package" parameter writes them to a
+// package of that name in a subdirectory, instead of the generated package,
+// and setting "server" or "client" to false leaves out those mocks.
+func (g *Generator) generateMock(req *pluginpb.CodeGeneratorRequest, gen config.Generator) error {
+	ftgs := req.GetFileToGenerate()
+	if len(ftgs) == 0 {
+		return fmt.Errorf("no files to generate")
+	}
+	mainPkgPath := filepath.Clean(filepath.Dir(ftgs[0]))
+	mainPkg, ok := g.gunkPkgs[mainPkgPath]
+	if !ok {
+		return fmt.Errorf("failed to get main package: %s", mainPkgPath)
+	}
+	src, err := mockSource(req, gen)
+	if err != nil {
+		return err
+	}
+	if src == nil {
+		return nil
+	}
+	dir, err := outPath(gen, mainPkg.Dir, mainPkg.Name)
+	if err != nil {
+		return fmt.Errorf("unable to build output path for %q: %w", mainPkg.Dir, err)
+	}
+	if pkg, ok := gen.GetParam("package"); ok {
+		dir = filepath.Join(dir, pkg)
+	}
+	if err := mkdirAll(dir); err != nil {
+		return fmt.Errorf("unable to create directory %q: %w", dir, err)
+	}
+	return g.writePkgFile(mainPkgPath, filepath.Join(dir, mainPkg.Name+"_mock.pb.go"), src)
+}
+
+// mockSource returns the Go source of the mocks of the services of the files
+// to generate of the request, or nil if there are no services.
+func mockSource(req *pluginpb.CodeGeneratorRequest, gen config.Generator) ([]byte, error) {
+	server, client := true, true
+	var mockPkg string
+	for _, kv := range gen.Params {
+		switch kv.Key {
+		case "package":
+			mockPkg = kv.Value
+		case "server", "client":
+			v, err := strconv.ParseBool(kv.Value)
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse %s: %w", kv.Key, err)
+			}
+			if kv.Key == "server" {
+				server = v
+			} else {
+				client = v
+			}
+		default:
+			return nil, fmt.Errorf("unknown mock parameter %q", kv.Key)
+		}
+	}
+	names := newGoNames(req)
+	if len(names.services) == 0 || !server && !client {
+		return nil, nil
+	}
+	f := &mockFile{Package: names.genPkg.Name}
+	if mockPkg != "" {
+		f.Package = mockPkg
+		names.inGenPkg = false
+	}
+	names.use("sync")
+	// ctx and opts import the packages of their types when used.
+	ctx := func() mockArg {
+		return mockArg{"ctx", "Ctx", names.use("context") + ".Context"}
+	}
+	opts := func() mockArg {
+		return mockArg{"opts", "Opts", "[]" + names.use("google.golang.org/grpc") + ".CallOption"}
+	}
+	for _, srv := range names.services {
+		name := srv.GetName()
+		if server {
+			m := &mockType{
+				Name:  name + "ServerMock",
+				Pkg:   name + "Server",
+				Iface: name + "Server",
+				Embed: names.gen("Unimplemented" + name + "Server"),
+			}
+			for _, method := range srv.GetMethod() {
+				stream := names.gen(name + "_" + method.GetName() + "Server")
+				in := names.message(method.GetInputType())
+				mm := mockMethod{Name: method.GetName(), Results: "error"}
+				switch {
+				case method.GetClientStreaming():
+					mm.Args = []mockArg{{"stream", "Stream", stream}}
+				case method.GetServerStreaming():
+					mm.Args = []mockArg{{"in", "In", in}, {"stream", "Stream", stream}}
+				default:
+					mm.Args = []mockArg{ctx(), {"in", "In", in}}
+					mm.Results = "(" + names.message(method.GetOutputType()) + ", error)"
+				}
+				mm.setParams(false)
+				m.Methods = append(m.Methods, mm)
+			}
+			f.Mocks = append(f.Mocks, m)
+		}
+		if client {
+			m := &mockType{
+				Name:  name + "ClientMock",
+				Pkg:   name + "Client",
+				Iface: name + "Client",
+			}
+			for _, method := range srv.GetMethod() {
+				stream := names.gen(name + "_" + method.GetName() + "Client")
+				in := names.message(method.GetInputType())
+				mm := mockMethod{Name: method.GetName(), Results: "(" + stream + ", error)"}
+				switch {
+				case method.GetClientStreaming():
+					mm.Args = []mockArg{ctx(), opts()}
+				default:
+					mm.Args = []mockArg{ctx(), {"in", "In", in}, opts()}
+					if !method.GetServerStreaming() {
+						mm.Results = "(" + names.message(method.GetOutputType()) + ", error)"
+					}
+				}
+				mm.setParams(true)
+				m.Methods = append(m.Methods, mm)
+			}
+			f.Mocks = append(f.Mocks, m)
+		}
+	}
+	f.Imports = importDecl(names.importList())
+	var buf bytes.Buffer
+	if err := mockTmpl.Execute(&buf, f); err != nil {
+		return nil, fmt.Errorf("unable to generate mocks: %w", err)
+	}
+	src, err := format.Source(buf.Bytes(), format.Options{LangVersion: "1.14"})
+	if err != nil {
+		return nil, fmt.Errorf("unable to format mocks: %w", err)
+	}
+	return src, nil
+}
+
+// setParams sets the parameter list and the arguments of the call of the
+// method's function from its arguments, the last of which is variadic if
+// variadic is set.
+func (m *mockMethod) setParams(variadic bool) {
+	var params, call []string
+	for i, arg := range m.Args {
+		typ, name := arg.Type, arg.Name
+		if variadic && i == len(m.Args)-1 {
+			typ = "..." + strings.TrimPrefix(typ, "[]")
+			name += "..."
+		}
+		params = append(params, arg.Name+" "+typ)
+		call = append(call, name)
+	}
+	m.Params = strings.Join(params, ", ")
+	m.Call = strings.Join(call, ", ")
+}
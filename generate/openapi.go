@@ -0,0 +1,511 @@
+package generate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/gunk/gunk/config"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+// openAPI is the OpenAPI 3.0 document written by the openapi generator.
+type openAPI struct {
+	OpenAPI    string          `json:"openapi"`
+	Info       openAPIInfo     `json:"info"`
+	Servers    []openAPIServer `json:"servers,omitempty"`
+	Tags       []openAPITag    `json:"tags,omitempty"`
+	Paths      *orderedMap     `json:"paths"`
+	Components struct {
+		Schemas map[string]*openAPISchema `json:"schemas,omitempty"`
+	} `json:"components"`
+}
+
+type openAPIInfo struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+type openAPIServer struct {
+	URL string `json:"url"`
+}
+
+type openAPITag struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+type openAPIOperation struct {
+	Tags        []string                    `json:"tags,omitempty"`
+	Summary     string                      `json:"summary,omitempty"`
+	Description string                      `json:"description,omitempty"`
+	OperationID string                      `json:"operationId"`
+	Parameters  []openAPIParameter          `json:"parameters,omitempty"`
+	RequestBody *openAPIBody                `json:"requestBody,omitempty"`
+	Responses   map[string]*openAPIResponse `json:"responses"`
+	Deprecated  bool                        `json:"deprecated,omitempty"`
+}
+
+type openAPIParameter struct {
+	Name        string         `json:"name"`
+	In          string         `json:"in"`
+	Description string         `json:"description,omitempty"`
+	Required    bool           `json:"required,omitempty"`
+	Schema      *openAPISchema `json:"schema"`
+}
+
+type openAPIBody struct {
+	Required bool                     `json:"required,omitempty"`
+	Content  map[string]openAPIMedium `json:"content"`
+}
+
+type openAPIResponse struct {
+	Description string                   `json:"description"`
+	Content     map[string]openAPIMedium `json:"content,omitempty"`
+}
+
+type openAPIMedium struct {
+	Schema *openAPISchema `json:"schema"`
+}
+
+type openAPISchema struct {
+	Ref                  string           `json:"$ref,omitempty"`
+	AllOf                []*openAPISchema `json:"allOf,omitempty"`
+	Type                 string           `json:"type,omitempty"`
+	Format               string           `json:"format,omitempty"`
+	Description          string           `json:"description,omitempty"`
+	Enum                 []string         `json:"enum,omitempty"`
+	Items                *openAPISchema   `json:"items,omitempty"`
+	Properties           *orderedMap      `json:"properties,omitempty"`
+	AdditionalProperties *openAPISchema   `json:"additionalProperties,omitempty"`
+	Nullable             bool             `json:"nullable,omitempty"`
+	Deprecated           bool             `json:"deprecated,omitempty"`
+}
+
+// orderedMap is a JSON object which keeps the order in which its keys were
+// set, so that properties and paths follow their declaration order.
+type orderedMap struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func (m *orderedMap) get(key string) interface{} {
+	if m.values == nil {
+		return nil
+	}
+	return m.values[key]
+}
+
+func (m *orderedMap) set(key string, value interface{}) {
+	if m.values == nil {
+		m.values = make(map[string]interface{})
+	}
+	if _, ok := m.values[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+	m.values[key] = value
+}
+
+func (m *orderedMap) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range m.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(m.values[key])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// wellKnownSchemas are the schemas of the well-known types, following their
+// JSON mapping. They are inlined instead of being added to the components.
+var wellKnownSchemas = map[string]openAPISchema{
+	".google.protobuf.Timestamp":   {Type: "string", Format: "date-time"},
+	".google.protobuf.Duration":    {Type: "string"},
+	".google.protobuf.FieldMask":   {Type: "string"},
+	".google.protobuf.Empty":       {Type: "object"},
+	".google.protobuf.Struct":      {Type: "object", AdditionalProperties: &openAPISchema{}},
+	".google.protobuf.Value":       {},
+	".google.protobuf.ListValue":   {Type: "array", Items: &openAPISchema{}},
+	".google.protobuf.DoubleValue": {Type: "number", Format: "double", Nullable: true},
+	".google.protobuf.FloatValue":  {Type: "number", Format: "float", Nullable: true},
+	".google.protobuf.Int64Value":  {Type: "string", Format: "int64", Nullable: true},
+	".google.protobuf.UInt64Value": {Type: "string", Format: "uint64", Nullable: true},
+	".google.protobuf.Int32Value":  {Type: "integer", Format: "int32", Nullable: true},
+	".google.protobuf.UInt32Value": {Type: "integer", Format: "int64", Nullable: true},
+	".google.protobuf.BoolValue":   {Type: "boolean", Nullable: true},
+	".google.protobuf.StringValue": {Type: "string", Nullable: true},
+	".google.protobuf.BytesValue":  {Type: "string", Format: "byte", Nullable: true},
+	".google.protobuf.Any": {
+		Type:                 "object",
+		Properties:           &orderedMap{keys: []string{"@type"}, values: map[string]interface{}{"@type": &openAPISchema{Type: "string"}}},
+		AdditionalProperties: &openAPISchema{},
+	},
+}
+
+// pathParamRegexp matches the variables of an HTTP rule's path template, such
+// as "{name}" or "{name=users/*}".
+var pathParamRegexp = regexp.MustCompile(`\{([^}=]+)(=[^}]*)?\}`)
+
+// generateOpenAPI writes an OpenAPI 3.0 document of the package requested in
+// the CodeGeneratorRequest, named like "foo.openapi.json". The messages and
+// enums of the package, and the ones they use, are the schemas of the
+// components, and the methods with HTTP rules are its operations. The "title",
+// "version" and "description" parameters set the document's info, the last one
+// defaulting to the package's documentation, and the "servers" parameter lists
+// the comma-separated server URLs.
+func (g *Generator) generateOpenAPI(req *pluginpb.CodeGeneratorRequest, gen config.Generator) error {
+	ftgs := req.GetFileToGenerate()
+	if len(ftgs) == 0 {
+		return fmt.Errorf("no files to generate")
+	}
+	mainPkgPath := filepath.Clean(filepath.Dir(ftgs[0]))
+	mainPkg, ok := g.gunkPkgs[mainPkgPath]
+	if !ok {
+		return fmt.Errorf("failed to get main package: %s", mainPkgPath)
+	}
+	doc, err := openAPIDoc(req, gen, mainPkg.Name)
+	if err != nil {
+		return err
+	}
+	dir, err := outPath(gen, mainPkg.Dir, mainPkg.Name)
+	if err != nil {
+		return fmt.Errorf("unable to build output path for %q: %w", mainPkg.Dir, err)
+	}
+	if err := mkdirAll(dir); err != nil {
+		return fmt.Errorf("unable to create directory %q: %w", dir, err)
+	}
+	buf, err := json.MarshalIndent(doc, "", "\t")
+	if err != nil {
+		return err
+	}
+	return g.writePkgFile(mainPkgPath, filepath.Join(dir, mainPkg.Name+".openapi.json"), append(buf, '\n'))
+}
+
+// openAPIBuilder builds an OpenAPI document from the files of a request.
+type openAPIBuilder struct {
+	*protoIndex
+	doc *openAPI
+}
+
+// openAPIDoc returns the OpenAPI document of the files to generate of the
+// request.
+func openAPIDoc(req *pluginpb.CodeGeneratorRequest, gen config.Generator, pkgName string) (*openAPI, error) {
+	b := &openAPIBuilder{
+		protoIndex: newProtoIndex(req.ProtoFile),
+		doc:        &openAPI{OpenAPI: "3.0.3", Paths: &orderedMap{}},
+	}
+	b.doc.Components.Schemas = make(map[string]*openAPISchema)
+	b.doc.Info.Title = pkgName
+	b.doc.Info.Version = "version not set"
+	for _, kv := range gen.Params {
+		switch kv.Key {
+		case "title":
+			b.doc.Info.Title = kv.Value
+		case "version":
+			b.doc.Info.Version = kv.Value
+		case "description":
+			b.doc.Info.Description = kv.Value
+		case "servers":
+			for _, url := range strings.Split(kv.Value, ",") {
+				if url = strings.TrimSpace(url); url != "" {
+					b.doc.Servers = append(b.doc.Servers, openAPIServer{URL: url})
+				}
+			}
+		default:
+			return nil, fmt.Errorf("unknown openapi parameter %q", kv.Key)
+		}
+	}
+	isTarget := make(map[string]bool, len(req.FileToGenerate))
+	for _, name := range req.FileToGenerate {
+		isTarget[name] = true
+	}
+	for _, pfile := range req.ProtoFile {
+		if !isTarget[pfile.GetName()] {
+			continue
+		}
+		if b.doc.Info.Description == "" {
+			b.doc.Info.Description = b.comments[pfile.GetName()]
+		}
+		prefix := "." + pfile.GetPackage()
+		var addAll func(prefix string, msgs []*descriptorpb.DescriptorProto)
+		addAll = func(prefix string, msgs []*descriptorpb.DescriptorProto) {
+			for _, msg := range msgs {
+				if msg.GetOptions().GetMapEntry() {
+					continue
+				}
+				b.schemaRef(prefix + "." + msg.GetName())
+				addAll(prefix+"."+msg.GetName(), msg.GetNestedType())
+			}
+		}
+		addAll(prefix, pfile.GetMessageType())
+		for _, enum := range pfile.GetEnumType() {
+			b.schemaRef(prefix + "." + enum.GetName())
+		}
+		for _, srv := range pfile.GetService() {
+			if err := b.addService(prefix, srv); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return b.doc, nil
+}
+
+// schemaRef returns the schema referencing a message or an enum, adding it and
+// the types it uses to the components if needed. The well-known types are
+// inlined.
+func (b *openAPIBuilder) schemaRef(typeName string) *openAPISchema {
+	if s, ok := wellKnownSchemas[typeName]; ok {
+		return &s
+	}
+	name := strings.TrimPrefix(typeName, ".")
+	ref := &openAPISchema{Ref: "#/components/schemas/" + name}
+	if _, ok := b.doc.Components.Schemas[name]; ok {
+		return ref
+	}
+	if enum := b.enums[typeName]; enum != nil {
+		s := &openAPISchema{Type: "string", Description: b.comments[typeName]}
+		for _, v := range enum.GetValue() {
+			s.Enum = append(s.Enum, v.GetName())
+		}
+		b.doc.Components.Schemas[name] = s
+		return ref
+	}
+	msg := b.messages[typeName]
+	if msg == nil {
+		// Not in the request; describe it as any object.
+		return &openAPISchema{Type: "object"}
+	}
+	s := &openAPISchema{
+		Type:        "object",
+		Description: b.comments[typeName],
+		Properties:  &orderedMap{},
+		Deprecated:  msg.GetOptions().GetDeprecated(),
+	}
+	// Add the schema before its fields, as messages may be recursive.
+	b.doc.Components.Schemas[name] = s
+	for _, field := range msg.GetField() {
+		fs := b.fieldSchema(field)
+		desc := b.comments[typeName+"."+field.GetName()]
+		deprecated := field.GetOptions().GetDeprecated()
+		nullable := field.GetProto3Optional()
+		if fs.Ref != "" && (desc != "" || deprecated || nullable) {
+			// Siblings of $ref are ignored in OpenAPI 3.0.
+			fs = &openAPISchema{AllOf: []*openAPISchema{fs}}
+		}
+		fs.Description = desc
+		fs.Deprecated = deprecated
+		fs.Nullable = fs.Nullable || nullable
+		s.Properties.set(fieldJSONName(field), fs)
+	}
+	return ref
+}
+
+// fieldSchema returns the schema of a field's value, following the JSON
+// mapping of Protobuf.
+func (b *openAPIBuilder) fieldSchema(field *descriptorpb.FieldDescriptorProto) *openAPISchema {
+	if field.GetLabel() == descriptorpb.FieldDescriptorProto_LABEL_REPEATED {
+		if entry := b.messages[field.GetTypeName()]; entry.GetOptions().GetMapEntry() {
+			return &openAPISchema{
+				Type:                 "object",
+				AdditionalProperties: b.valueSchema(entry.GetField()[1]),
+			}
+		}
+		return &openAPISchema{Type: "array", Items: b.valueSchema(field)}
+	}
+	return b.valueSchema(field)
+}
+
+// valueSchema returns the schema of a single value of a field.
+func (b *openAPIBuilder) valueSchema(field *descriptorpb.FieldDescriptorProto) *openAPISchema {
+	switch field.GetType() {
+	case descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, descriptorpb.FieldDescriptorProto_TYPE_ENUM:
+		return b.schemaRef(field.GetTypeName())
+	case descriptorpb.FieldDescriptorProto_TYPE_DOUBLE:
+		return &openAPISchema{Type: "number", Format: "double"}
+	case descriptorpb.FieldDescriptorProto_TYPE_FLOAT:
+		return &openAPISchema{Type: "number", Format: "float"}
+	case descriptorpb.FieldDescriptorProto_TYPE_INT64,
+		descriptorpb.FieldDescriptorProto_TYPE_SINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED64:
+		return &openAPISchema{Type: "string", Format: "int64"}
+	case descriptorpb.FieldDescriptorProto_TYPE_UINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_FIXED64:
+		return &openAPISchema{Type: "string", Format: "uint64"}
+	case descriptorpb.FieldDescriptorProto_TYPE_INT32,
+		descriptorpb.FieldDescriptorProto_TYPE_SINT32,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED32:
+		return &openAPISchema{Type: "integer", Format: "int32"}
+	case descriptorpb.FieldDescriptorProto_TYPE_UINT32,
+		descriptorpb.FieldDescriptorProto_TYPE_FIXED32:
+		return &openAPISchema{Type: "integer", Format: "int64"}
+	case descriptorpb.FieldDescriptorProto_TYPE_BOOL:
+		return &openAPISchema{Type: "boolean"}
+	case descriptorpb.FieldDescriptorProto_TYPE_BYTES:
+		return &openAPISchema{Type: "string", Format: "byte"}
+	default:
+		return &openAPISchema{Type: "string"}
+	}
+}
+
+// addService adds the operations of the methods of a service with HTTP rules.
+func (b *openAPIBuilder) addService(prefix string, srv *descriptorpb.ServiceDescriptorProto) error {
+	srvName := prefix + "." + srv.GetName()
+	tagged := false
+	for _, method := range srv.GetMethod() {
+		if !proto.HasExtension(method.GetOptions(), annotations.E_Http) {
+			continue
+		}
+		rule := proto.GetExtension(method.GetOptions(), annotations.E_Http).(*annotations.HttpRule)
+		for i, rule := range append([]*annotations.HttpRule{rule}, rule.GetAdditionalBindings()...) {
+			id := srv.GetName() + "_" + method.GetName()
+			if i > 0 {
+				id += fmt.Sprint(i + 1)
+			}
+			if err := b.addOperation(srvName, srv.GetName(), id, method, rule); err != nil {
+				return fmt.Errorf("%s.%s: %w", srv.GetName(), method.GetName(), err)
+			}
+			tagged = true
+		}
+	}
+	if tagged {
+		b.doc.Tags = append(b.doc.Tags, openAPITag{
+			Name:        srv.GetName(),
+			Description: b.comments[srvName],
+		})
+	}
+	return nil
+}
+
+// addOperation adds the operation of an HTTP rule of a method. The variables
+// of the path are path parameters, the body is the request body, and the
+// other fields of the input are query parameters, if there's no body.
+func (b *openAPIBuilder) addOperation(srvName, tag, id string, method *descriptorpb.MethodDescriptorProto, rule *annotations.HttpRule) error {
+	var verb, path string
+	switch p := rule.GetPattern().(type) {
+	case *annotations.HttpRule_Get:
+		verb, path = "get", p.Get
+	case *annotations.HttpRule_Put:
+		verb, path = "put", p.Put
+	case *annotations.HttpRule_Post:
+		verb, path = "post", p.Post
+	case *annotations.HttpRule_Delete:
+		verb, path = "delete", p.Delete
+	case *annotations.HttpRule_Patch:
+		verb, path = "patch", p.Patch
+	case *annotations.HttpRule_Custom:
+		verb, path = strings.ToLower(p.Custom.GetKind()), p.Custom.GetPath()
+	default:
+		return fmt.Errorf("missing HTTP rule pattern")
+	}
+	desc := b.comments[srvName+"."+method.GetName()]
+	op := &openAPIOperation{
+		Tags:        []string{tag},
+		OperationID: id,
+		Responses:   map[string]*openAPIResponse{},
+		Deprecated:  method.GetOptions().GetDeprecated(),
+	}
+	if i := strings.Index(desc, "\n\n"); i >= 0 {
+		op.Summary, op.Description = desc[:i], strings.TrimSpace(desc[i+2:])
+	} else {
+		op.Summary = desc
+	}
+	input := b.messages[method.GetInputType()]
+	inPath := make(map[string]bool)
+	for _, m := range pathParamRegexp.FindAllStringSubmatch(path, -1) {
+		name := m[1]
+		inPath[name] = true
+		field := b.fieldByPath(method.GetInputType(), name)
+		if field == nil {
+			return fmt.Errorf("path parameter %q is not a field of %s", name, strings.TrimPrefix(method.GetInputType(), "."))
+		}
+		op.Parameters = append(op.Parameters, openAPIParameter{
+			Name:        name,
+			In:          "path",
+			Description: b.comments[method.GetInputType()+"."+name],
+			Required:    true,
+			Schema:      b.valueSchema(field),
+		})
+	}
+	path = pathParamRegexp.ReplaceAllString(path, "{$1}")
+	switch body := rule.GetBody(); body {
+	case "":
+		for _, field := range input.GetField() {
+			if inPath[field.GetName()] || !isQueryParam(field) {
+				continue
+			}
+			op.Parameters = append(op.Parameters, openAPIParameter{
+				Name:        fieldJSONName(field),
+				In:          "query",
+				Description: b.comments[method.GetInputType()+"."+field.GetName()],
+				Schema:      b.fieldSchema(field),
+			})
+		}
+	case "*":
+		op.RequestBody = &openAPIBody{
+			Required: true,
+			Content:  map[string]openAPIMedium{"application/json": {b.schemaRef(method.GetInputType())}},
+		}
+	default:
+		field := b.fieldByPath(method.GetInputType(), body)
+		if field == nil {
+			return fmt.Errorf("body %q is not a field of %s", body, strings.TrimPrefix(method.GetInputType(), "."))
+		}
+		op.RequestBody = &openAPIBody{
+			Required: true,
+			Content:  map[string]openAPIMedium{"application/json": {b.fieldSchema(field)}},
+		}
+	}
+	output := b.schemaRef(method.GetOutputType())
+	if rb := rule.GetResponseBody(); rb != "" {
+		if field := b.fieldByPath(method.GetOutputType(), rb); field != nil {
+			output = b.fieldSchema(field)
+		}
+	}
+	op.Responses["200"] = &openAPIResponse{
+		Description: "A successful response.",
+		Content:     map[string]openAPIMedium{"application/json": {output}},
+	}
+	item, _ := b.doc.Paths.get(path).(*orderedMap)
+	if item == nil {
+		item = &orderedMap{}
+		b.doc.Paths.set(path, item)
+	}
+	if item.get(verb) != nil {
+		return fmt.Errorf("duplicate operation %s %s", strings.ToUpper(verb), path)
+	}
+	item.set(verb, op)
+	return nil
+}
+
+// isQueryParam reports whether a field can be set by a query parameter, which
+// is the case of scalars, enums and the well-known types encoded as scalars.
+func isQueryParam(field *descriptorpb.FieldDescriptorProto) bool {
+	if field.GetType() != descriptorpb.FieldDescriptorProto_TYPE_MESSAGE {
+		return true
+	}
+	switch wellKnownSchemas[field.GetTypeName()].Type {
+	case "", "object", "array":
+		return false
+	}
+	return field.GetLabel() != descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+}
@@ -0,0 +1,54 @@
+package generate
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/gunk/gunk/config"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+func TestOpenAPISchemas(t *testing.T) {
+	message := descriptorpb.FieldDescriptorProto_TYPE_MESSAGE
+	str := descriptorpb.FieldDescriptorProto_TYPE_STRING
+	req := &pluginpb.CodeGeneratorRequest{
+		FileToGenerate: []string{"example.com/api/all.proto"},
+		ProtoFile: []*descriptorpb.FileDescriptorProto{{
+			Name:    proto.String("example.com/api/all.proto"),
+			Package: proto.String("api"),
+			MessageType: []*descriptorpb.DescriptorProto{{
+				Name: proto.String("Event"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					{Name: proto.String("created_at"), Type: &message, TypeName: proto.String(".google.protobuf.Timestamp")},
+					{Name: proto.String("count"), Type: &message, TypeName: proto.String(".google.protobuf.Int32Value")},
+					{Name: proto.String("note"), Type: &str, Proto3Optional: proto.Bool(true)},
+					{Name: proto.String("parent"), Type: &message, TypeName: proto.String(".api.Event"), Proto3Optional: proto.Bool(true)},
+				},
+			}},
+		}},
+	}
+	doc, err := openAPIDoc(req, config.Generator{}, "api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Info.Title != "api" || doc.Info.Version != "version not set" {
+		t.Errorf("wrong default info: %+v", doc.Info)
+	}
+	got, err := json.Marshal(doc.Components.Schemas["api.Event"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"type":"object","properties":{` +
+		`"createdAt":{"type":"string","format":"date-time"},` +
+		`"count":{"type":"integer","format":"int32","nullable":true},` +
+		`"note":{"type":"string","nullable":true},` +
+		`"parent":{"allOf":[{"$ref":"#/components/schemas/api.Event"}],"nullable":true}}}`
+	if string(got) != want {
+		t.Errorf("wrong schema:\ngot  %s\nwant %s", got, want)
+	}
+	if _, err := openAPIDoc(req, config.Generator{Params: []config.KeyValue{{Key: "server", Value: "x"}}}, "api"); err == nil {
+		t.Errorf("unknown parameter not rejected")
+	}
+}
@@ -0,0 +1,105 @@
+package generate
+
+import (
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// gunkPositions rewrites the positions in the proto files of the translated
+// packages found in a message, such as the error of a plugin, to the positions
+// in the Gunk files they were translated from. The proto files don't exist on
+// disk, but the spans of their locations are those of the Gunk files, so the
+// lines and columns reported by plugins are kept.
+func (g *Generator) gunkPositions(msg string) string {
+	for pfilename, origins := range g.origins {
+		// The proto files of the package, with the Gunk files they
+		// were translated from, or "" for the unified file.
+		names := map[string]string{pfilename: ""}
+		if g.splitProto[pfilename] {
+			names = make(map[string]string, len(origins.files))
+			for _, gname := range origins.files {
+				names[splitProtoFile(gname)] = gname
+			}
+		}
+		for name, gname := range names {
+			if !strings.Contains(msg, name) {
+				continue
+			}
+			re := regexp.MustCompile(`(^|[^\w./-])` + regexp.QuoteMeta(name) + `(?::(\d+)(?::(\d+))?)?`)
+			msg = re.ReplaceAllStringFunc(msg, func(m string) string {
+				sub := re.FindStringSubmatch(m)
+				line, _ := strconv.Atoi(sub[2])
+				col, _ := strconv.Atoi(sub[3])
+				return sub[1] + g.gunkPosition(pfilename, gname, line, col)
+			})
+		}
+	}
+	return msg
+}
+
+// gunkPosition returns the position in a Gunk file of a line and column of a
+// proto file, either those of the Gunk file gname, or of the unified proto
+// file of a package if gname is empty. Line and column are zero if unknown.
+// If the Gunk file can't be told, the package's directory is returned.
+func (g *Generator) gunkPosition(pfilename, gname string, line, col int) string {
+	origins := g.origins[pfilename]
+	if gname == "" && line > 0 {
+		gname = locationOrigin(g.allProto[pfilename], origins, line, col)
+	}
+	if gname == "" && len(origins.files) == 1 {
+		gname = origins.files[0]
+	}
+	pkg := g.gunkPkgs[path.Dir(pfilename)]
+	if pkg == nil {
+		return pfilename
+	}
+	if gname == "" {
+		return pkg.Dir
+	}
+	// The syntax is released by now, but the files are named like
+	// in the positions of the file set.
+	pos := ""
+	for i, name := range pkg.GunkNames {
+		if name == gname && i < len(pkg.GunkFiles) {
+			pos = pkg.GunkFiles[i]
+		}
+	}
+	if pos == "" {
+		return pkg.Dir
+	}
+	if line > 0 {
+		pos += ":" + strconv.Itoa(line)
+		if col > 0 {
+			pos += ":" + strconv.Itoa(col)
+		}
+	}
+	return pos
+}
+
+// locationOrigin returns the Gunk file of the location of the unified proto
+// file starting at a line and column, or else of the smallest one spanning the
+// line, or "" if there is none. Column is zero if unknown.
+func locationOrigin(pfile *descriptorpb.FileDescriptorProto, origins *protoOrigins, line, col int) string {
+	origin, size := "", -1
+	for i, loc := range pfile.GetSourceCodeInfo().GetLocation() {
+		span := loc.GetSpan()
+		if len(span) < 3 {
+			continue
+		}
+		start, startCol, end := int(span[0])+1, int(span[1])+1, int(span[0])+1
+		if len(span) == 4 {
+			end = int(span[2]) + 1
+		}
+		if start == line && (col == 0 || startCol == col) {
+			return origins.locations[i]
+		}
+		if start <= line && line <= end && (size < 0 || end-start < size) {
+			origin, size = origins.locations[i], end-start
+		}
+	}
+	return origin
+}
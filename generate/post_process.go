@@ -28,7 +28,22 @@ func postProcess(input []byte, gen config.Generator, mainPkgPath string, pkgs ma
 			return tsPathProcessor(input, mainPkgPath, pkgs)
 		}
 	}
-	if code == "go" || code == "grpc-gateway" || code == "grpc-go" {
+	if code == "ts_proto" || code == "es" {
+		if gen.FixPaths {
+			return relImportProcessor(input, tsRelImportRegexp, gen, mainPkgPath, pkgs)
+		}
+	}
+	if code == "dart" {
+		if gen.FixPaths {
+			return relImportProcessor(input, dartRelImportRegexp, gen, mainPkgPath, pkgs)
+		}
+	}
+	if gen.IsPython() {
+		if gen.FixPaths {
+			return pythonPathProcessor(input, gen, mainPkgPath, pkgs)
+		}
+	}
+	if gen.IsGo() {
 		return format.Source(input, format.Options{LangVersion: "1.14"})
 	}
 	return input, nil
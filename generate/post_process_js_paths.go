@@ -3,9 +3,12 @@ package generate
 import (
 	"bytes"
 	"fmt"
+	"path"
 	"path/filepath"
+	"regexp"
 	"strings"
 
+	"github.com/gunk/gunk/config"
 	"github.com/gunk/gunk/loader"
 )
 
@@ -107,3 +110,51 @@ LINES:
 	}
 	return bytes.Join(fLines, []byte{'\n'}), nil
 }
+
+// tsRelImportRegexp matches the relative imports of TypeScript code.
+var tsRelImportRegexp = regexp.MustCompile(` from "(\.\.?/[^"]*)"`)
+
+// dartRelImportRegexp matches the relative imports of Dart code, which are
+// the imports without a scheme such as "package:".
+var dartRelImportRegexp = regexp.MustCompile(`(?m)^import '([^':]*)'`)
+
+// relImportProcessor replaces the relative imports of the input string, which
+// are relative to the proto file paths, with the correct relative imports
+// between the output directories, for the TypeScript code of ts-proto and
+// protobuf-es, and for Dart code. The first submatch of re is the imported
+// path. Imports of other Gunk packages point to their output directory, and
+// imports of other files, such as the well-known types, point to where they
+// are written in the output directory of the main package.
+func relImportProcessor(input []byte, re *regexp.Regexp, gen config.Generator, mainPkgPath string, pkgs map[string]*loader.GunkPackage) ([]byte, error) {
+	mainPkg, ok := pkgs[mainPkgPath]
+	if !ok {
+		return nil, fmt.Errorf("failed to get main package: %s", mainPkgPath)
+	}
+	mainDir, err := outPath(gen, mainPkg.Dir, mainPkg.Name)
+	if err != nil {
+		return nil, err
+	}
+	toRoot := pathToRoot(mainPkgPath) + "/"
+	var rerr error
+	output := re.ReplaceAllFunc(input, func(m []byte) []byte {
+		loc := re.FindSubmatchIndex(m)
+		rel := string(m[loc[2]:loc[3]])
+		replace := func(s string) []byte {
+			return []byte(string(m[:loc[2]]) + s + string(m[loc[3]:]))
+		}
+		target := path.Join(mainPkgPath, rel)
+		if pkg, ok := pkgs[path.Dir(target)]; ok && pkg != mainPkg {
+			dir, err := outPath(gen, pkg.Dir, pkg.Name)
+			if err != nil {
+				rerr = err
+				return m
+			}
+			return replace(pathFromTo(mainDir, dir) + "/" + path.Base(target))
+		}
+		if strings.HasPrefix(rel, toRoot) {
+			return replace("./" + strings.TrimPrefix(rel, toRoot))
+		}
+		return m
+	})
+	return output, rerr
+}
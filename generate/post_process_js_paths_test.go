@@ -1,6 +1,12 @@
 package generate
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/gunk/gunk/config"
+	"github.com/gunk/gunk/loader"
+	"golang.org/x/tools/go/packages"
+)
 
 func TestPathToRoot(t *testing.T) {
 	tests := []struct {
@@ -72,3 +78,73 @@ func TestPathFromTo(t *testing.T) {
 		}
 	}
 }
+
+func TestRelImportProcessor(t *testing.T) {
+	pkgs := map[string]*loader.GunkPackage{
+		"example.com/api/v1": {
+			Package: packages.Package{Name: "v1"},
+			Dir:     "/src/api/v1",
+		},
+		"example.com/types": {
+			Package: packages.Package{Name: "types"},
+			Dir:     "/src/types",
+		},
+	}
+	tests := []struct {
+		out      string
+		dart     bool
+		input    string
+		expected string
+	}{
+		{
+			input:    `import { Money } from "../../types/all";`,
+			expected: `import { Money } from "./../../types/all";`,
+		},
+		{
+			input:    `import { Money } from "../../types/all_pb.js";`,
+			expected: `import { Money } from "./../../types/all_pb.js";`,
+		},
+		{
+			input:    `import { Timestamp } from "../../../google/protobuf/timestamp";`,
+			expected: `import { Timestamp } from "./google/protobuf/timestamp";`,
+		},
+		{
+			input:    `import { Other } from "./other";`,
+			expected: `import { Other } from "./other";`,
+		},
+		{
+			input:    `import _m0 from "protobufjs/minimal";`,
+			expected: `import _m0 from "protobufjs/minimal";`,
+		},
+		{
+			out:      "/web/src/{{.Package}}",
+			input:    `import { Money } from "../../types/all";`,
+			expected: `import { Money } from "./../types/all";`,
+		},
+		{
+			dart:     true,
+			input:    "import 'dart:core' as $core;\nimport '../../types/all.pb.dart' as $0;\nimport 'all.pbenum.dart';",
+			expected: "import 'dart:core' as $core;\nimport './../../types/all.pb.dart' as $0;\nimport 'all.pbenum.dart';",
+		},
+		{
+			dart:     true,
+			input:    "import 'package:protobuf/protobuf.dart' as $pb;",
+			expected: "import 'package:protobuf/protobuf.dart' as $pb;",
+		},
+	}
+	for _, tc := range tests {
+		gen := config.Generator{Command: "protoc-gen-ts_proto", Out: tc.out}
+		re := tsRelImportRegexp
+		if tc.dart {
+			gen.Command = "protoc-gen-dart"
+			re = dartRelImportRegexp
+		}
+		res, err := relImportProcessor([]byte(tc.input), re, gen, "example.com/api/v1", pkgs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(res) != tc.expected {
+			t.Errorf("wrong imports with out %q, got %q expected %q", tc.out, res, tc.expected)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package generate
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/gunk/gunk/config"
+	"github.com/gunk/gunk/loader"
+)
+
+// pyImportRegexp matches the imports of generated protobuf modules in Python
+// code, either "from pkg.path import all_pb2 as alias" or
+// "import all_pb2 as alias".
+var pyImportRegexp = regexp.MustCompile(`^(?:from (\S+) )?import (\w+_pb2)((?: as \w+)?)$`)
+
+// pythonPathProcessor replaces the imports of the protobuf modules of Gunk
+// packages with relative imports between their output directories. Python
+// generators import them by their proto file paths, such as
+// "from example.com.api import all_pb2", which isn't where gunk writes them.
+// Other imports, such as the well-known types from the protobuf package, are
+// left unchanged.
+func pythonPathProcessor(input []byte, gen config.Generator, mainPkgPath string, pkgs map[string]*loader.GunkPackage) ([]byte, error) {
+	mainPkg, ok := pkgs[mainPkgPath]
+	if !ok {
+		return nil, fmt.Errorf("failed to get main package: %s", mainPkgPath)
+	}
+	mainDir, err := outPath(gen, mainPkg.Dir, mainPkg.Name)
+	if err != nil {
+		return nil, err
+	}
+	// The Python modules are named after the proto packages' paths.
+	modules := make(map[string]*loader.GunkPackage, len(pkgs))
+	for pkgPath, pkg := range pkgs {
+		modules[strings.ReplaceAll(pkgPath, "/", ".")] = pkg
+	}
+	lines := bytes.Split(input, []byte{'\n'})
+	for i, l := range lines {
+		m := pyImportRegexp.FindSubmatch(l)
+		if m == nil {
+			continue
+		}
+		module, name, alias := string(m[1]), string(m[2]), string(m[3])
+		pkg := mainPkg
+		if module != "" {
+			if pkg, ok = modules[module]; !ok {
+				continue
+			}
+		}
+		dir, err := outPath(gen, pkg.Dir, pkg.Name)
+		if err != nil {
+			return nil, err
+		}
+		lines[i] = []byte(fmt.Sprintf("from %s import %s%s", pythonRelImport(pathFromTo(mainDir, dir)), name, alias))
+	}
+	return bytes.Join(lines, []byte{'\n'}), nil
+}
+
+// pythonRelImport converts a relative path, as returned by pathFromTo, to the
+// package of a Python relative import. For example, "./../types" is
+// "..types".
+func pythonRelImport(rel string) string {
+	rel = strings.TrimPrefix(rel, ".")
+	rel = strings.TrimPrefix(rel, "/")
+	pkg := "."
+	for _, elem := range strings.Split(rel, "/") {
+		switch elem {
+		case "":
+		case "..":
+			pkg += "."
+		default:
+			if !strings.HasSuffix(pkg, ".") {
+				pkg += "."
+			}
+			pkg += elem
+		}
+	}
+	return pkg
+}
@@ -0,0 +1,82 @@
+package generate
+
+import (
+	"testing"
+
+	"github.com/gunk/gunk/config"
+	"github.com/gunk/gunk/loader"
+	"golang.org/x/tools/go/packages"
+)
+
+func TestPythonRelImport(t *testing.T) {
+	tests := []struct {
+		rel      string
+		expected string
+	}{
+		{rel: ".", expected: "."},
+		{rel: "./baz", expected: ".baz"},
+		{rel: "./..", expected: ".."},
+		{rel: "./../baz", expected: "..baz"},
+		{rel: "./../../serious/business", expected: "...serious.business"},
+	}
+	for _, tc := range tests {
+		res := pythonRelImport(tc.rel)
+		if res != tc.expected {
+			t.Errorf("wrong import of %q, got %q expected %q", tc.rel, res, tc.expected)
+		}
+	}
+}
+
+func TestPythonPathProcessor(t *testing.T) {
+	pkgs := map[string]*loader.GunkPackage{
+		"example.com/api/v1": {
+			Package: packages.Package{Name: "v1"},
+			Dir:     "/src/api/v1",
+		},
+		"example.com/types": {
+			Package: packages.Package{Name: "types"},
+			Dir:     "/src/types",
+		},
+	}
+	tests := []struct {
+		out      string
+		input    string
+		expected string
+	}{
+		{
+			input:    "from example.com.types import all_pb2 as example_dot_com_dot_types_dot_all__pb2",
+			expected: "from ...types import all_pb2 as example_dot_com_dot_types_dot_all__pb2",
+		},
+		{
+			input:    "from example.com.api.v1 import all_pb2 as example_dot_com_dot_api_dot_v1_dot_all__pb2",
+			expected: "from . import all_pb2 as example_dot_com_dot_api_dot_v1_dot_all__pb2",
+		},
+		{
+			input:    "import all_pb2 as all__pb2",
+			expected: "from . import all_pb2 as all__pb2",
+		},
+		{
+			input:    "from google.protobuf import timestamp_pb2 as google_dot_protobuf_dot_timestamp__pb2",
+			expected: "from google.protobuf import timestamp_pb2 as google_dot_protobuf_dot_timestamp__pb2",
+		},
+		{
+			input:    "import grpc",
+			expected: "import grpc",
+		},
+		{
+			out:      "/py/{{.Package}}",
+			input:    "from example.com.types import all_pb2",
+			expected: "from ..types import all_pb2",
+		},
+	}
+	for _, tc := range tests {
+		gen := config.Generator{ProtocGen: "python", Out: tc.out}
+		res, err := pythonPathProcessor([]byte(tc.input), gen, "example.com/api/v1", pkgs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(res) != tc.expected {
+			t.Errorf("wrong imports with out %q, got %q expected %q", tc.out, res, tc.expected)
+		}
+	}
+}
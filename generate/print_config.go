@@ -0,0 +1,251 @@
+package generate
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"io"
+	"os"
+	"os/exec"
+
+	"github.com/gunk/gunk/config"
+	"github.com/gunk/gunk/generate/downloader"
+	"github.com/gunk/gunk/loader"
+	"github.com/gunk/gunk/plugin"
+)
+
+// resolvedConfig is the effective configuration of a package, as printed by
+// PrintConfig.
+type resolvedConfig struct {
+	Package         string               `json:"package"`
+	Dir             string               `json:"dir"`
+	ConfigFiles     []string             `json:"config_files"`
+	ImportPath      string               `json:"import_path,omitempty"`
+	WrapperTypes    bool                 `json:"wrapper_types,omitempty"`
+	SplitProtoFiles bool                 `json:"split_proto_files,omitempty"`
+	Protoc          resolvedProtoc       `json:"protoc"`
+	PluginVersions  map[string]string    `json:"plugin_versions,omitempty"`
+	Generators      []resolvedGenerator  `json:"generators"`
+	FileOptions     []resolvedFileOption `json:"file_options,omitempty"`
+	Format          resolvedFormat       `json:"format"`
+	Lint            resolvedLint         `json:"lint"`
+}
+
+type resolvedProtoc struct {
+	Path         string   `json:"path,omitempty"`
+	Version      string   `json:"version,omitempty"`
+	SHA256       []string `json:"sha256,omitempty"`
+	Mirror       string   `json:"mirror,omitempty"`
+	IncludePaths []string `json:"include_paths,omitempty"`
+}
+
+type resolvedGenerator struct {
+	Type       string `json:"type"`
+	ConfigFile string `json:"config_file"`
+	// Skipped is whether the generator isn't run for the package, as it
+	// doesn't match its packages patterns.
+	Skipped         bool           `json:"skipped,omitempty"`
+	Packages        []string       `json:"packages,omitempty"`
+	Out             string         `json:"out"`
+	Params          []string       `json:"params,omitempty"`
+	Plugin          resolvedPlugin `json:"plugin"`
+	PluginTimeout   string         `json:"plugin_timeout,omitempty"`
+	PluginMaxOutput int64          `json:"plugin_max_output,omitempty"`
+	PluginEnv       []string       `json:"plugin_env,omitempty"`
+	JSONPostProc    bool           `json:"json_tag_postproc,omitempty"`
+	FixPaths        bool           `json:"fix_paths_postproc,omitempty"`
+	RegisterHelpers bool           `json:"register_helpers,omitempty"`
+}
+
+// resolvedPlugin tells how a generator is run. Its kind is one of:
+//
+//	builtin     generated by gunk itself, such as fdset or openapi
+//	protoc      generated by protoc, such as java
+//	remote      a remote plugin of the Buf Schema Registry
+//	in_process  a plugin run within gunk
+//	registered  a generator registered with the plugin package
+//	wasm        a plugin compiled to WASI, run with wazero within gunk
+//	cached      a pinned version of a plugin, from gunk's cache
+//	command     a plugin binary found in PATH
+type resolvedPlugin struct {
+	Kind    string `json:"kind"`
+	Command string `json:"command,omitempty"`
+	Version string `json:"version,omitempty"`
+	Path    string `json:"path,omitempty"`
+	// Downloaded is whether the pinned version is in the cache yet.
+	Downloaded bool `json:"downloaded,omitempty"`
+	// Error is why the plugin can't be run, such as a missing command.
+	Error string `json:"error,omitempty"`
+}
+
+type resolvedFileOption struct {
+	Name     string `json:"name"`
+	Template string `json:"template"`
+}
+
+type resolvedFormat struct {
+	JSON         bool     `json:"json,omitempty"`
+	PB           bool     `json:"pb,omitempty"`
+	Initialisms  []string `json:"initialisms,omitempty"`
+	AlignTags    bool     `json:"align_tags,omitempty"`
+	CommentWidth int      `json:"comment_width,omitempty"`
+}
+
+type resolvedLint struct {
+	TodoAllowPackages []string `json:"todo_allow_packages,omitempty"`
+	TodoFailGenerate  bool     `json:"todo_fail_generate,omitempty"`
+}
+
+// PrintConfig writes the effective configuration of each of the Gunk packages
+// as a JSON object, merged from the .gunkconfig files of their directories and
+// their parents, with the output directories of the generators and how their
+// plugins are run.
+func PrintConfig(w io.Writer, dir string, args ...string) error {
+	l := &loader.Loader{
+		Dir:  dir,
+		Fset: token.NewFileSet(),
+	}
+	pkgs, err := l.Load(args...)
+	if err != nil {
+		return err
+	}
+	if len(pkgs) == 0 {
+		return fmt.Errorf("no Gunk packages to print the configuration of")
+	}
+	if loader.PrintErrors(pkgs) > 0 {
+		return fmt.Errorf("encountered package loading errors")
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	for _, pkg := range pkgs {
+		cfg, err := config.Load(pkg.Dir)
+		if err != nil {
+			return fmt.Errorf("unable to load gunkconfig: %w", err)
+		}
+		rc, err := resolveConfig(cfg, pkg)
+		if err != nil {
+			return err
+		}
+		if err := enc.Encode(rc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func resolveConfig(cfg *config.Config, pkg *loader.GunkPackage) (*resolvedConfig, error) {
+	rc := &resolvedConfig{
+		Package:         pkg.PkgPath,
+		Dir:             pkg.Dir,
+		ConfigFiles:     cfg.Files,
+		ImportPath:      cfg.ImportPath,
+		WrapperTypes:    cfg.WrapperTypes,
+		SplitProtoFiles: cfg.SplitProtoFiles,
+		Protoc: resolvedProtoc{
+			Path:         cfg.ProtocPath,
+			Version:      cfg.ProtocVersion,
+			SHA256:       cfg.ProtocSHA256,
+			Mirror:       cfg.ProtocMirror,
+			IncludePaths: cfg.IncludePaths,
+		},
+		PluginVersions: cfg.PluginVersions,
+		Generators:     []resolvedGenerator{},
+		Format: resolvedFormat{
+			JSON:         cfg.Format.JSON,
+			PB:           cfg.Format.PB,
+			Initialisms:  cfg.Format.Initialisms,
+			AlignTags:    cfg.Format.AlignTags,
+			CommentWidth: cfg.Format.CommentWidth,
+		},
+		Lint: resolvedLint{
+			TodoAllowPackages: cfg.Lint.TodoAllowPackages,
+			TodoFailGenerate:  cfg.Lint.TodoFailGenerate,
+		},
+	}
+	for _, o := range cfg.FileOptions {
+		rc.FileOptions = append(rc.FileOptions, resolvedFileOption{Name: o.Name, Template: o.Template()})
+	}
+	for _, gen := range cfg.Generators {
+		out, err := outPath(gen, pkg.Dir, pkg.Name)
+		if err != nil {
+			return nil, fmt.Errorf("unable to build output path for %q: %w", pkg.Dir, err)
+		}
+		rg := resolvedGenerator{
+			Type:            gen.Code(),
+			ConfigFile:      gen.ConfigFile,
+			Skipped:         !gen.MatchesPackage(pkg.Dir, pkg.PkgPath),
+			Packages:        gen.Packages,
+			Out:             out,
+			Plugin:          resolvePlugin(gen),
+			PluginEnv:       gen.PluginEnv,
+			JSONPostProc:    gen.JSONPostProc,
+			FixPaths:        gen.FixPaths,
+			RegisterHelpers: gen.RegisterHelpers,
+		}
+		for _, p := range gen.Params {
+			if p.Value != "" {
+				rg.Params = append(rg.Params, p.Key+"="+p.Value)
+			} else {
+				rg.Params = append(rg.Params, p.Key)
+			}
+		}
+		if gen.Param != "" {
+			rg.Params = append(rg.Params, gen.Param)
+		}
+		switch rg.Plugin.Kind {
+		case "wasm", "cached", "command", "protoc", "remote":
+			// The limits of plugins run as commands, by protoc
+			// or remotely.
+			timeout, max := pluginLimits(gen)
+			rg.PluginTimeout, rg.PluginMaxOutput = timeout.String(), max
+		}
+		rc.Generators = append(rc.Generators, rg)
+	}
+	return rc, nil
+}
+
+// resolvePlugin tells how a generator is run, in the same order as by
+// GeneratePkg and runPlugin.
+func resolvePlugin(gen config.Generator) resolvedPlugin {
+	switch {
+	case gen.IsDoc(), gen.IsFdset(), gen.IsBufImage(), gen.IsAccess(), gen.IsOpenAPI(),
+		gen.IsGraphQL(), gen.IsMock(), gen.IsScaffold(), gen.IsServiceConfig(), gen.IsMain():
+		return resolvedPlugin{Kind: "builtin"}
+	case gen.IsProtoc():
+		return resolvedPlugin{Kind: "protoc"}
+	case gen.Remote != nil:
+		return resolvedPlugin{Kind: "remote", Command: gen.Remote.String()}
+	case gen.InProcess:
+		return resolvedPlugin{Kind: "in_process", Command: gen.Command}
+	case gen.PluginVersion != "":
+		p := resolvedPlugin{Kind: "cached", Command: gen.Command, Version: gen.PluginVersion}
+		if !downloader.Has(gen.Code()) {
+			p.Error = fmt.Sprintf("plugin %s does not support pinned versions", gen.Code())
+			return p
+		}
+		path, err := downloader.CachedPath(gen.Code(), gen.PluginVersion)
+		if err != nil {
+			p.Error = err.Error()
+			return p
+		}
+		_, err = os.Stat(path)
+		p.Path, p.Downloaded = path, err == nil
+		return p
+	case gen.Wasm != "":
+		p := resolvedPlugin{Kind: "wasm", Command: gen.Command, Path: wasmPath(gen)}
+		if _, err := os.Stat(p.Path); err != nil {
+			p.Error = err.Error()
+		}
+		return p
+	}
+	if _, ok := plugin.Lookup(gen.Code()); ok {
+		return resolvedPlugin{Kind: "registered", Command: gen.Command}
+	}
+	p := resolvedPlugin{Kind: "command", Command: gen.Command}
+	path, err := exec.LookPath(gen.Command)
+	if err != nil {
+		p.Error = err.Error()
+	}
+	p.Path = path
+	return p
+}
@@ -14,7 +14,10 @@ const (
 	messagePath       = 4 // FileDescriptorProto.MessageType
 	enumPath          = 5 // FileDescriptorProto.EnumType
 	servicePath       = 6 // FileDescriptorProto.Service
+	extensionPath     = 7 // FileDescriptorProto.Extension
 	messageFieldPath  = 2 // DescriptorProto.Field
+	messageNestedPath = 3 // DescriptorProto.NestedType
+	messageEnumPath   = 4 // DescriptorProto.EnumType
 	enumValuePath     = 2 // EnumDescriptorProto.Value
 	serviceMethodPath = 2 // ServiceDescriptorProto.Method
 )
@@ -0,0 +1,134 @@
+package generate
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// protoIndex indexes the declarations of the files of a request, for the
+// built-in generators describing them in other schema languages.
+type protoIndex struct {
+	messages map[string]*descriptorpb.DescriptorProto
+	enums    map[string]*descriptorpb.EnumDescriptorProto
+	comments map[string]string // by the full name of the declaration
+	packages map[string]string // of the messages and enums
+}
+
+func newProtoIndex(files []*descriptorpb.FileDescriptorProto) *protoIndex {
+	x := &protoIndex{
+		messages: make(map[string]*descriptorpb.DescriptorProto),
+		enums:    make(map[string]*descriptorpb.EnumDescriptorProto),
+		comments: make(map[string]string),
+		packages: make(map[string]string),
+	}
+	for _, pfile := range files {
+		x.addFile(pfile)
+	}
+	return x
+}
+
+// addFile indexes the messages, enums and comments of a file by their full
+// names.
+func (x *protoIndex) addFile(pfile *descriptorpb.FileDescriptorProto) {
+	byPath := make(map[string]string)
+	for _, loc := range pfile.GetSourceCodeInfo().GetLocation() {
+		if text := loc.GetLeadingComments(); text != "" {
+			// Undo the indentation added by protoComment.
+			lines := strings.Split(text, "\n")
+			for i, line := range lines {
+				lines[i] = strings.TrimPrefix(line, " ")
+			}
+			byPath[fmt.Sprint(loc.GetPath())] = strings.TrimSpace(strings.Join(lines, "\n"))
+		}
+	}
+	comment := func(name string, path ...int32) {
+		if text := byPath[fmt.Sprint(path)]; text != "" {
+			x.comments[name] = text
+		}
+	}
+	// The package's documentation is keyed by the file's name.
+	comment(pfile.GetName(), packagePath)
+	prefix := "." + pfile.GetPackage()
+	var addEnums func(prefix string, enums []*descriptorpb.EnumDescriptorProto, path ...int32)
+	addEnums = func(prefix string, enums []*descriptorpb.EnumDescriptorProto, path ...int32) {
+		for i, enum := range enums {
+			name := prefix + "." + enum.GetName()
+			declPath := append(append([]int32(nil), path...), int32(i))
+			x.enums[name] = enum
+			x.packages[name] = pfile.GetPackage()
+			comment(name, declPath...)
+			for j, v := range enum.GetValue() {
+				comment(name+"."+v.GetName(), append(append([]int32(nil), declPath...), enumValuePath, int32(j))...)
+			}
+		}
+	}
+	var addMessages func(prefix string, msgs []*descriptorpb.DescriptorProto, path ...int32)
+	addMessages = func(prefix string, msgs []*descriptorpb.DescriptorProto, path ...int32) {
+		for i, msg := range msgs {
+			name := prefix + "." + msg.GetName()
+			msgPath := append(append([]int32(nil), path...), int32(i))
+			x.messages[name] = msg
+			x.packages[name] = pfile.GetPackage()
+			comment(name, msgPath...)
+			for j, field := range msg.GetField() {
+				comment(name+"."+field.GetName(), append(append([]int32(nil), msgPath...), messageFieldPath, int32(j))...)
+			}
+			addMessages(name, msg.GetNestedType(), append(msgPath, messageNestedPath)...)
+			addEnums(name, msg.GetEnumType(), append(msgPath, messageEnumPath)...)
+		}
+	}
+	addMessages(prefix, pfile.GetMessageType(), messagePath)
+	addEnums(prefix, pfile.GetEnumType(), enumPath)
+	for i, srv := range pfile.GetService() {
+		name := prefix + "." + srv.GetName()
+		comment(name, servicePath, int32(i))
+		for j, method := range srv.GetMethod() {
+			comment(name+"."+method.GetName(), servicePath, int32(i), serviceMethodPath, int32(j))
+		}
+	}
+}
+
+// fieldByPath returns the field of a message at a dot-separated path, such as
+// "user.id", or nil if there is no such field.
+func (x *protoIndex) fieldByPath(typeName, path string) *descriptorpb.FieldDescriptorProto {
+	var field *descriptorpb.FieldDescriptorProto
+	for _, name := range strings.Split(path, ".") {
+		msg := x.messages[typeName]
+		field = nil
+		for _, f := range msg.GetField() {
+			if f.GetName() == name {
+				field = f
+				break
+			}
+		}
+		if field == nil {
+			return nil
+		}
+		typeName = field.GetTypeName()
+	}
+	return field
+}
+
+// fieldJSONName returns the JSON name of a field, which defaults to its name
+// in lower camel case, as done by protoc.
+func fieldJSONName(field *descriptorpb.FieldDescriptorProto) string {
+	if name := field.GetJsonName(); name != "" {
+		return name
+	}
+	var b strings.Builder
+	upper := false
+	for _, r := range field.GetName() {
+		switch {
+		case r == '_':
+			upper = true
+		case upper:
+			b.WriteString(strings.ToUpper(string(r)))
+			upper = false
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,175 @@
+package generate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gunk/gunk/config"
+	"github.com/gunk/gunk/log"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+// generateCodeProcedure is the Connect procedure generating code with remote
+// plugins, from buf/alpha/registry/v1alpha1/generate.proto.
+const generateCodeProcedure = "/buf.alpha.registry.v1alpha1.CodeGenerationService/GenerateCode"
+
+// remoteBaseURL returns the base URL of the API of a Buf Schema Registry
+// remote, such as "https://api.buf.build" for "buf.build".
+var remoteBaseURL = func(remote string) string {
+	if remote == "buf.build" {
+		return "https://api.buf.build"
+	}
+	return "https://" + remote
+}
+
+// runRemotePlugin runs the remote plugin of the Buf Schema Registry of a
+// generator on the request, sending the files as a buf image. The BUF_TOKEN
+// environment variable authenticates the requests, as with the buf CLI. Like
+// plugins run as commands, the request is stopped if it takes longer than the
+// generator's timeout, or if the response is larger than its maximum output.
+func runRemotePlugin(req *pluginpb.CodeGeneratorRequest, gen config.Generator, param string) (*pluginpb.CodeGeneratorResponse, error) {
+	p := gen.Remote
+	image, err := bufImage(includeImports(req), req.FileToGenerate)
+	if err != nil {
+		return nil, err
+	}
+	body := generateCodeRequest(image, p, param)
+	timeout, max := pluginLimits(gen)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, remoteBaseURL(p.Remote)+generateCodeProcedure, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/proto")
+	httpReq.Header.Set("Connect-Protocol-Version", "1")
+	if token := bufToken(os.Getenv("BUF_TOKEN"), p.Remote); token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+token)
+	}
+	log.Verbosef("running remote plugin %s", p)
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		if err := pluginLimitError(gen, errors.Is(ctx.Err(), context.DeadlineExceeded), false); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("unable to run remote plugin %s: %w", p, err)
+	}
+	defer resp.Body.Close()
+	// Read one more byte than the maximum output, to tell whether the
+	// response is larger.
+	out, err := io.ReadAll(io.LimitReader(resp.Body, max+1))
+	if err := pluginLimitError(gen, errors.Is(ctx.Err(), context.DeadlineExceeded), int64(len(out)) > max); err != nil {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to run remote plugin %s: %w", p, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		// Connect errors are JSON objects with a code and a message.
+		var connectErr struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		}
+		if err := json.Unmarshal(out, &connectErr); err != nil || connectErr.Code == "" {
+			return nil, fmt.Errorf("unable to run remote plugin %s: %s", p, resp.Status)
+		}
+		return nil, fmt.Errorf("unable to run remote plugin %s: %s: %s", p, connectErr.Code, connectErr.Message)
+	}
+	return generateCodeResponse(out)
+}
+
+// generateCodeRequest encodes a GenerateCodeRequest running the plugin on the
+// target files of the image.
+func generateCodeRequest(image []byte, p *config.RemotePlugin, param string) []byte {
+	var ref []byte // CuratedPluginReference
+	ref = protowire.AppendTag(ref, 1, protowire.BytesType)
+	ref = protowire.AppendString(ref, p.Owner)
+	ref = protowire.AppendTag(ref, 2, protowire.BytesType)
+	ref = protowire.AppendString(ref, p.Name)
+	if p.Version != "" {
+		ref = protowire.AppendTag(ref, 3, protowire.BytesType)
+		ref = protowire.AppendString(ref, p.Version)
+	}
+	var pluginReq []byte // PluginGenerationRequest
+	pluginReq = protowire.AppendTag(pluginReq, 1, protowire.BytesType)
+	pluginReq = protowire.AppendBytes(pluginReq, ref)
+	if param != "" {
+		pluginReq = protowire.AppendTag(pluginReq, 2, protowire.BytesType)
+		pluginReq = protowire.AppendString(pluginReq, param)
+	}
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType) // image
+	b = protowire.AppendBytes(b, image)
+	b = protowire.AppendTag(b, 2, protowire.BytesType) // requests
+	b = protowire.AppendBytes(b, pluginReq)
+	return b
+}
+
+// generateCodeResponse decodes the CodeGeneratorResponse of the only plugin of
+// a GenerateCodeResponse.
+func generateCodeResponse(b []byte) (*pluginpb.CodeGeneratorResponse, error) {
+	var resp *pluginpb.CodeGeneratorResponse
+	// GenerateCodeResponse.responses
+	err := bytesFields(b, 1, func(pluginResp []byte) error {
+		resp = &pluginpb.CodeGeneratorResponse{}
+		// PluginGenerationResponse.response
+		return bytesFields(pluginResp, 1, func(v []byte) error {
+			return proto.Unmarshal(v, resp)
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid remote plugin response: %w", err)
+	}
+	if resp == nil {
+		return nil, fmt.Errorf("remote plugin returned no response")
+	}
+	return resp, nil
+}
+
+// bytesFields calls fn with the value of each length-delimited field of an
+// encoded message with the given number.
+func bytesFields(b []byte, num protowire.Number, fn func([]byte) error) error {
+	for len(b) > 0 {
+		n, typ, tagLen := protowire.ConsumeTag(b)
+		if tagLen < 0 {
+			return protowire.ParseError(tagLen)
+		}
+		b = b[tagLen:]
+		valueLen := protowire.ConsumeFieldValue(n, typ, b)
+		if valueLen < 0 {
+			return protowire.ParseError(valueLen)
+		}
+		if n == num && typ == protowire.BytesType {
+			v, _ := protowire.ConsumeBytes(b)
+			if err := fn(v); err != nil {
+				return err
+			}
+		}
+		b = b[valueLen:]
+	}
+	return nil
+}
+
+// bufToken returns the token of a remote from the value of BUF_TOKEN, which is
+// either a token for all remotes, or comma-separated tokens for each remote,
+// such as "token1@buf.build,token2@example.buf.dev".
+func bufToken(env, remote string) string {
+	if !strings.Contains(env, "@") {
+		return env
+	}
+	for _, t := range strings.Split(env, ",") {
+		if i := strings.LastIndex(t, "@"); i >= 0 && t[i+1:] == remote {
+			return t[:i]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,146 @@
+package generate
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gunk/gunk/config"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+func TestRunRemotePlugin(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != generateCodeProcedure {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			io.WriteString(w, `{"code":"unauthenticated","message":"you are not authenticated"}`)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		var image, ref []byte
+		var param string
+		bytesFields(body, 1, func(v []byte) error { image = v; return nil })
+		bytesFields(body, 2, func(pluginReq []byte) error {
+			bytesFields(pluginReq, 1, func(v []byte) error { ref = v; return nil })
+			bytesFields(pluginReq, 2, func(v []byte) error { param = string(v); return nil })
+			return nil
+		})
+		var owner, name, version string
+		bytesFields(ref, 1, func(v []byte) error { owner = string(v); return nil })
+		bytesFields(ref, 2, func(v []byte) error { name = string(v); return nil })
+		bytesFields(ref, 3, func(v []byte) error { version = string(v); return nil })
+		var files descriptorpb.FileDescriptorSet
+		if err := proto.Unmarshal(image, &files); err != nil {
+			t.Error(err)
+		}
+		content := owner + "/" + name + ":" + version + " " + param
+		for _, f := range files.File {
+			content += " " + f.GetName()
+		}
+		resp, _ := proto.Marshal(&pluginpb.CodeGeneratorResponse{
+			File: []*pluginpb.CodeGeneratorResponse_File{{
+				Name:    proto.String("out.txt"),
+				Content: proto.String(content),
+			}},
+		})
+		var pluginResp, b []byte
+		pluginResp = protowire.AppendTag(pluginResp, 1, protowire.BytesType)
+		pluginResp = protowire.AppendBytes(pluginResp, resp)
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, pluginResp)
+		w.Header().Set("Content-Type", "application/proto")
+		w.Write(b)
+	}))
+	defer srv.Close()
+	defer func(f func(string) string) { remoteBaseURL = f }(remoteBaseURL)
+	remoteBaseURL = func(remote string) string {
+		if remote != "buf.build" {
+			t.Errorf("unexpected remote %q", remote)
+		}
+		return srv.URL
+	}
+
+	req := &pluginpb.CodeGeneratorRequest{
+		FileToGenerate: []string{"example.com/api/all.proto"},
+		ProtoFile: []*descriptorpb.FileDescriptorProto{
+			{Name: proto.String("google/protobuf/empty.proto")},
+			{Name: proto.String("unused.proto")},
+			{
+				Name:       proto.String("example.com/api/all.proto"),
+				Dependency: []string{"google/protobuf/empty.proto"},
+			},
+		},
+	}
+	gen := config.Generator{Remote: &config.RemotePlugin{Remote: "buf.build", Owner: "grpc", Name: "python", Version: "v1.50.0"}}
+
+	t.Setenv("BUF_TOKEN", "wrong@example.buf.dev,secret@buf.build")
+	resp, err := runRemotePlugin(req, gen, "a=b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "grpc/python:v1.50.0 a=b google/protobuf/empty.proto example.com/api/all.proto"
+	if len(resp.File) != 1 || resp.File[0].GetContent() != want {
+		t.Fatalf("got response %v, want a file with %q", resp, want)
+	}
+
+	t.Setenv("BUF_TOKEN", "")
+	_, err = runRemotePlugin(req, gen, "")
+	if err == nil || !strings.Contains(err.Error(), "unauthenticated: you are not authenticated") {
+		t.Fatalf("got error %v, want an unauthenticated error", err)
+	}
+}
+
+func TestRunRemotePluginLimits(t *testing.T) {
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("sleep") != "" {
+			<-done
+			return
+		}
+		w.Write(make([]byte, 2048))
+	}))
+	defer srv.Close()
+	defer close(done)
+	defer func(f func(string) string) { remoteBaseURL = f }(remoteBaseURL)
+	remoteBaseURL = func(remote string) string {
+		if remote == "sleep.example.com" {
+			return srv.URL + "/?sleep=1#"
+		}
+		return srv.URL
+	}
+	req := &pluginpb.CodeGeneratorRequest{}
+
+	// A remote plugin taking longer than its timeout is stopped.
+	gen := config.Generator{
+		Command:       "sleep.example.com/owner/sleep",
+		Remote:        &config.RemotePlugin{Remote: "sleep.example.com", Owner: "owner", Name: "sleep"},
+		PluginTimeout: 50 * time.Millisecond,
+	}
+	_, err := runRemotePlugin(req, gen, "")
+	want := "generator sleep.example.com/owner/sleep was stopped after running for 50ms"
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Fatalf("got error %v, want %q", err, want)
+	}
+
+	// So is a remote plugin responding with more than its maximum output.
+	gen = config.Generator{
+		Command:         "buf.build/owner/flood",
+		Remote:          &config.RemotePlugin{Remote: "buf.build", Owner: "owner", Name: "flood"},
+		PluginMaxOutput: 1024,
+	}
+	_, err = runRemotePlugin(req, gen, "")
+	want = "generator buf.build/owner/flood was stopped after writing more than 1024 bytes"
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Fatalf("got error %v, want %q", err, want)
+	}
+}
@@ -0,0 +1,93 @@
+package generate
+
+import (
+	"bytes"
+	"io"
+	"runtime"
+
+	"github.com/gunk/gunk/config"
+	"github.com/gunk/gunk/loader"
+	"github.com/gunk/gunk/protoutil"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+// maxConcurrentPkgs is the number of packages generated at once. Each package
+// holds the encoding of its request, which includes all of its dependencies,
+// so generating every package at once makes the memory usage grow with the
+// number of packages.
+var maxConcurrentPkgs = runtime.GOMAXPROCS(0)
+
+// codeGenRequest is the request for the generators of a package. The files of
+// the request are shared with the requests of the other packages, and the
+// request is encoded at most once, the encoding being shared by all of the
+// package's plugin generators. Likewise, the descriptor set given to protoc is
+// encoded once for all of the package's protoc generators.
+type codeGenRequest struct {
+	*pluginpb.CodeGeneratorRequest
+	buf       []byte // the encoded request, without a parameter
+	protocBuf []byte // the encoded descriptor set given to protoc
+}
+
+// reader returns a reader of the request encoded with the parameter, if it's
+// not empty. The parameter is appended to the shared encoding, which is valid
+// as protobuf fields may be encoded in any order.
+func (r *codeGenRequest) reader(param string) (io.Reader, error) {
+	if r.buf == nil {
+		buf, err := protoutil.MarshalDeterministic(r.CodeGeneratorRequest)
+		if err != nil {
+			return nil, err
+		}
+		r.buf = buf
+	}
+	if param == "" {
+		return bytes.NewReader(r.buf), nil
+	}
+	// Field 2 of CodeGeneratorRequest is the parameter.
+	b := protowire.AppendTag(nil, 2, protowire.BytesType)
+	b = protowire.AppendString(b, param)
+	return io.MultiReader(bytes.NewReader(r.buf), bytes.NewReader(b)), nil
+}
+
+// endTranslation ends the translation of the packages, after which the code
+// generators only use their descriptors. The generator gives up the syntax
+// trees and type information of the packages, which are usually much bigger
+// than the descriptors: the packages it holds are replaced by copies without
+// them, and its loader forgets the packages it loaded. The loaded packages
+// aren't modified, so the caller must drop pkgs for them to be freed, and use
+// the returned copies instead.
+// The packages documented by a doc generator are kept whole, as the
+// documentation is generated from the Gunk source.
+func (g *Generator) endTranslation(pkgs []*loader.GunkPackage, pkgConfigs map[string]*config.Config) []*loader.GunkPackage {
+	for path, pkg := range g.gunkPkgs {
+		if cfg := pkgConfigs[pkg.Dir]; cfg != nil && hasDocGenerator(cfg) {
+			continue
+		}
+		g.gunkPkgs[path] = translatedPkg(pkg)
+	}
+	g.Loader.ForgetPackages()
+	g.curPkg, g.gfile = nil, nil
+	translated := make([]*loader.GunkPackage, len(pkgs))
+	for i, pkg := range pkgs {
+		translated[i] = g.gunkPkgs[pkg.PkgPath]
+	}
+	return translated
+}
+
+func hasDocGenerator(cfg *config.Config) bool {
+	for _, gen := range cfg.Generators {
+		if gen.IsDoc() {
+			return true
+		}
+	}
+	return false
+}
+
+// translatedPkg returns a copy of a package without what is only used to
+// translate it.
+func translatedPkg(pkg *loader.GunkPackage) *loader.GunkPackage {
+	p := *pkg
+	p.GunkSyntax, p.GunkTags, p.Imports = nil, nil, nil
+	p.Syntax, p.Types, p.TypesInfo = nil, nil, nil
+	return &p
+}
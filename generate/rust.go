@@ -0,0 +1,42 @@
+package generate
+
+import (
+	"path"
+
+	"github.com/gunk/gunk/config"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+// withExternPaths returns the generator with an extern_path parameter of
+// prost and tonic for each imported Gunk package mapped to a Rust path with
+// module_mappings, so that the generated code refers to the package's types
+// at that path instead of generating them again.
+func withExternPaths(req *pluginpb.CodeGeneratorRequest, gen config.Generator) config.Generator {
+	paths := make(map[string]string, len(gen.ModuleMappings))
+	for _, m := range gen.ModuleMappings {
+		paths[m.Key] = m.Value
+	}
+	// Copy the parameters, to not modify those of the other packages.
+	params := make([]config.KeyValue, len(gen.Params), len(gen.Params)+len(paths))
+	copy(params, gen.Params)
+	// The package being generated isn't external.
+	seen := make(map[string]bool, len(paths))
+	for _, name := range req.FileToGenerate {
+		seen[path.Dir(name)] = true
+	}
+	for _, pf := range req.ProtoFile {
+		pkgPath := path.Dir(pf.GetName())
+		rustPath, ok := paths[pkgPath]
+		if !ok || seen[pkgPath] {
+			continue
+		}
+		// A package may be split into many files.
+		seen[pkgPath] = true
+		params = append(params, config.KeyValue{
+			Key:   "extern_path",
+			Value: "." + pf.GetPackage() + "=" + rustPath,
+		})
+	}
+	gen.Params = params
+	return gen
+}
@@ -0,0 +1,38 @@
+package generate
+
+import (
+	"testing"
+
+	"github.com/gunk/gunk/config"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+func TestWithExternPaths(t *testing.T) {
+	req := &pluginpb.CodeGeneratorRequest{
+		FileToGenerate: []string{"example.com/api/all.proto"},
+		ProtoFile: []*descriptorpb.FileDescriptorProto{
+			{Name: proto.String("example.com/types/money.proto"), Package: proto.String("example.types")},
+			{Name: proto.String("example.com/types/date.proto"), Package: proto.String("example.types")},
+			{Name: proto.String("example.com/other/all.proto"), Package: proto.String("example.other")},
+			{Name: proto.String("example.com/api/all.proto"), Package: proto.String("example.api")},
+		},
+	}
+	gen := config.Generator{
+		Command: "protoc-gen-prost",
+		Params:  []config.KeyValue{{Key: "compile_well_known_types"}},
+		ModuleMappings: []config.KeyValue{
+			{Key: "example.com/types", Value: "::api_types"},
+			{Key: "example.com/api", Value: "crate::api"},
+		},
+	}
+	got := withExternPaths(req, gen)
+	if len(gen.Params) != 1 {
+		t.Errorf("the parameters of the generator were modified")
+	}
+	want := "compile_well_known_types,extern_path=.example.types=::api_types"
+	if param := got.ParamString(); param != want {
+		t.Errorf("wrong parameters, got %q expected %q", param, want)
+	}
+}
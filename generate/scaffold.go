@@ -0,0 +1,195 @@
+package generate
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/gunk/gunk/config"
+	"github.com/gunk/gunk/log"
+	"golang.org/x/tools/go/ast/astutil"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/pluginpb"
+	gofumpt "mvdan.cc/gofumpt/format"
+)
+
+// generateScaffold writes a skeleton implementation of each service of the
+// package requested in the CodeGeneratorRequest, for the code generated by
+// grpc-go, to a file named after the service, such as "users.go" for Users.
+// The implementations are written to the package named by the "package"
+// parameter, which defaults to the name of the package with a "server" suffix,
+// in a subdirectory of the same name. As the files are then edited by hand,
+// they are never overwritten: only the stubs of the methods which are missing
+// are appended to them.
+func (g *Generator) generateScaffold(req *pluginpb.CodeGeneratorRequest, gen config.Generator) error {
+	ftgs := req.GetFileToGenerate()
+	if len(ftgs) == 0 {
+		return fmt.Errorf("no files to generate")
+	}
+	mainPkgPath := filepath.Clean(filepath.Dir(ftgs[0]))
+	mainPkg, ok := g.gunkPkgs[mainPkgPath]
+	if !ok {
+		return fmt.Errorf("failed to get main package: %s", mainPkgPath)
+	}
+	pkg := mainPkg.Name + "server"
+	for _, kv := range gen.Params {
+		switch kv.Key {
+		case "package":
+			pkg = kv.Value
+		default:
+			return fmt.Errorf("unknown scaffold parameter %q", kv.Key)
+		}
+	}
+	dir, err := outPath(gen, mainPkg.Dir, mainPkg.Name)
+	if err != nil {
+		return fmt.Errorf("unable to build output path for %q: %w", mainPkg.Dir, err)
+	}
+	dir = filepath.Join(dir, pkg)
+	if err := mkdirAll(dir); err != nil {
+		return fmt.Errorf("unable to create directory %q: %w", dir, err)
+	}
+	for _, srv := range newGoNames(req).services {
+		name := filepath.Join(dir, snakeCase(srv.GetName())+".go")
+		old, err := ioutil.ReadFile(name)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		src, err := scaffoldSource(req, srv, pkg, name, old)
+		if err != nil {
+			return err
+		}
+		if src == nil {
+			continue
+		}
+		// The file isn't added to the manifest, as it belongs to the
+		// user once written.
+		if err := writeFile(name, src); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scaffoldSource returns the source of the skeleton implementation of a
+// service, or the existing source old with the stubs of its missing methods
+// appended. It returns nil if no method is missing.
+func scaffoldSource(req *pluginpb.CodeGeneratorRequest, srv *descriptorpb.ServiceDescriptorProto, pkg, filename string, old []byte) ([]byte, error) {
+	names := newGoNames(req)
+	names.inGenPkg = false
+	typeName := srv.GetName() + "Server"
+	var buf bytes.Buffer
+	implemented := make(map[string]bool)
+	if old != nil {
+		fset := token.NewFileSet()
+		f, err := parser.ParseFile(fset, filename, old, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		if f.Scope.Lookup(typeName) == nil {
+			log.Verbosef("%s: %s not declared; not adding the missing methods", filename, typeName)
+			return nil, nil
+		}
+		// Reuse the names of the packages already imported.
+		for _, imp := range f.Imports {
+			p, _ := strconv.Unquote(imp.Path.Value)
+			local := path.Base(p)
+			if imp.Name != nil {
+				local = imp.Name.Name
+			}
+			names.imports[p] = local
+			names.used[local] = true
+		}
+		for _, decl := range f.Decls {
+			if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv != nil && receiverName(fn) == typeName {
+				implemented[fn.Name.Name] = true
+			}
+		}
+		buf.Write(old)
+	} else {
+		fmt.Fprintf(&buf, "package %s\n\n", pkg)
+		fmt.Fprintf(&buf, "// %s implements %s.\n", typeName, names.gen(typeName))
+		fmt.Fprintf(&buf, "type %s struct {\n\t%s\n}\n\n", typeName, names.gen("Unimplemented"+typeName))
+		fmt.Fprintf(&buf, "// New%[1]s returns a new %[1]s.\nfunc New%[1]s() *%[1]s {\n\treturn &%[1]s{}\n}\n", typeName)
+	}
+	missing := 0
+	for _, method := range srv.GetMethod() {
+		if implemented[method.GetName()] {
+			continue
+		}
+		missing++
+		var params, results, ret string
+		stream := names.gen(srv.GetName() + "_" + method.GetName() + "Server")
+		switch {
+		case method.GetClientStreaming():
+			params, results, ret = "stream "+stream, "error", ""
+		case method.GetServerStreaming():
+			params, results, ret = "req "+names.message(method.GetInputType())+", stream "+stream, "error", ""
+		default:
+			params = "ctx " + names.use("context") + ".Context, req " + names.message(method.GetInputType())
+			results, ret = "("+names.message(method.GetOutputType())+", error)", "nil, "
+		}
+		fmt.Fprintf(&buf, "\n// %s implements %s.\n", method.GetName(), names.gen(typeName))
+		fmt.Fprintf(&buf, "func (s *%s) %s(%s) %s {\n", typeName, method.GetName(), params, results)
+		fmt.Fprintf(&buf, "\t// TODO: implement %s.\n", method.GetName())
+		fmt.Fprintf(&buf, "\treturn %s%s.Error(%s.Unimplemented, %q)\n}\n",
+			ret, names.use("google.golang.org/grpc/status"), names.use("google.golang.org/grpc/codes"),
+			"method "+method.GetName()+" not implemented")
+	}
+	if missing == 0 && old != nil {
+		return nil, nil
+	}
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, buf.Bytes(), parser.ParseComments)
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate the scaffold of %s: %w", srv.GetName(), err)
+	}
+	for _, imp := range names.importList() {
+		name := imp.Name
+		if name == path.Base(imp.Path) {
+			name = ""
+		}
+		astutil.AddNamedImport(fset, f, name, imp.Path)
+	}
+	var out bytes.Buffer
+	if err := format.Node(&out, fset, f); err != nil {
+		return nil, err
+	}
+	return gofumpt.Source(out.Bytes(), gofumpt.Options{LangVersion: "1.14"})
+}
+
+// receiverName returns the name of the type of a method's receiver.
+func receiverName(fn *ast.FuncDecl) string {
+	typ := fn.Recv.List[0].Type
+	if star, ok := typ.(*ast.StarExpr); ok {
+		typ = star.X
+	}
+	if id, ok := typ.(*ast.Ident); ok {
+		return id.Name
+	}
+	return ""
+}
+
+// snakeCase returns a Go name in snake case, such as "user_accounts" for
+// "UserAccounts" and "http_proxy" for "HTTPProxy".
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) &&
+			(unicode.IsLower(runes[i-1]) || i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
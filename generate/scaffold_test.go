@@ -0,0 +1,17 @@
+package generate
+
+import "testing"
+
+func TestSnakeCase(t *testing.T) {
+	for name, want := range map[string]string{
+		"Users":        "users",
+		"UserAccounts": "user_accounts",
+		"HTTPProxy":    "http_proxy",
+		"GetURL":       "get_url",
+		"V2Service":    "v2_service",
+	} {
+		if got := snakeCase(name); got != want {
+			t.Errorf("snakeCase(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
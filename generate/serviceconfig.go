@@ -0,0 +1,314 @@
+package generate
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gunk/gunk/assets/serviceconfig"
+	"github.com/gunk/gunk/config"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+// retryableCodes are the names of the gRPC status codes other than OK.
+var retryableCodes = map[string]bool{
+	"CANCELLED":           true,
+	"UNKNOWN":             true,
+	"INVALID_ARGUMENT":    true,
+	"DEADLINE_EXCEEDED":   true,
+	"NOT_FOUND":           true,
+	"ALREADY_EXISTS":      true,
+	"PERMISSION_DENIED":   true,
+	"RESOURCE_EXHAUSTED":  true,
+	"FAILED_PRECONDITION": true,
+	"ABORTED":             true,
+	"OUT_OF_RANGE":        true,
+	"UNIMPLEMENTED":       true,
+	"INTERNAL":            true,
+	"UNAVAILABLE":         true,
+	"DATA_LOSS":           true,
+	"UNAUTHENTICATED":     true,
+}
+
+// splitMethodConfig parses the client configuration annotations of a service
+// or a method from its documentation, such as:
+//
+//	Timeout: 5s
+//	Wait-For-Ready: true
+//	Retry: max-attempts=3, initial-backoff=100ms
+//	Retry-On: UNAVAILABLE, RESOURCE_EXHAUSTED
+//
+// The annotations override those of defaults, the configuration of the
+// method's service. It returns nil if there are no annotations. The
+// annotations are kept in the documentation, like the stability ones.
+func splitMethodConfig(text string, defaults *serviceconfig.MethodConfig) (*serviceconfig.MethodConfig, error) {
+	c := &serviceconfig.MethodConfig{}
+	if defaults != nil {
+		c = proto.Clone(defaults).(*serviceconfig.MethodConfig)
+	}
+	found := false
+	var retry *serviceconfig.RetryPolicy
+	for _, line := range strings.Split(text, "\n") {
+		i := strings.Index(line, ":")
+		if i < 0 {
+			continue
+		}
+		key, value := line[:i], strings.TrimSpace(line[i+1:])
+		switch key {
+		case "Timeout":
+			d, err := parseConfigDuration(key, value)
+			if err != nil {
+				return nil, err
+			}
+			c.Timeout = d
+		case "Wait-For-Ready":
+			v, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("Wait-For-Ready annotation must be true or false")
+			}
+			c.WaitForReady = v
+		case "Retry":
+			if retry != nil {
+				return nil, fmt.Errorf("multiple Retry annotations")
+			}
+			var err error
+			if retry, err = parseRetry(value); err != nil {
+				return nil, err
+			}
+		default:
+			continue
+		}
+		found = true
+	}
+	retryOn, err := docList(text, "Retry-On")
+	if err != nil {
+		return nil, err
+	}
+	if !found && len(retryOn) == 0 {
+		return nil, nil
+	}
+	if retry != nil {
+		retry.RetryableStatusCodes = c.GetRetryPolicy().GetRetryableStatusCodes()
+		c.RetryPolicy = retry
+	}
+	if len(retryOn) > 0 {
+		if c.RetryPolicy == nil {
+			return nil, fmt.Errorf("Retry-On annotation without a Retry annotation")
+		}
+		c.RetryPolicy.RetryableStatusCodes = nil
+		for _, v := range retryOn {
+			v = strings.ToUpper(v)
+			if !retryableCodes[v] {
+				return nil, fmt.Errorf("invalid Retry-On status code %q", v)
+			}
+			c.RetryPolicy.RetryableStatusCodes = append(c.RetryPolicy.RetryableStatusCodes, v)
+		}
+	}
+	if c.RetryPolicy != nil && len(c.RetryPolicy.RetryableStatusCodes) == 0 {
+		return nil, fmt.Errorf("Retry annotation without a Retry-On annotation")
+	}
+	return c, nil
+}
+
+// parseRetry parses the parameters of a Retry annotation. Only max-attempts is
+// required; the backoff is 100ms, doubling up to 1s, by default.
+func parseRetry(value string) (*serviceconfig.RetryPolicy, error) {
+	r := &serviceconfig.RetryPolicy{
+		InitialBackoff:    "0.1s",
+		MaxBackoff:        "1s",
+		BackoffMultiplier: 2,
+	}
+	initial, max := 100*time.Millisecond, time.Second
+	for _, p := range strings.Split(value, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		i := strings.Index(p, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("Retry parameter %q must be written as name=value", p)
+		}
+		name, arg := p[:i], p[i+1:]
+		var err error
+		switch name {
+		case "max-attempts":
+			n, perr := strconv.ParseUint(arg, 10, 32)
+			if perr != nil || n < 2 {
+				return nil, fmt.Errorf("Retry max-attempts must be a number greater than 1")
+			}
+			r.MaxAttempts = uint32(n)
+		case "initial-backoff":
+			if r.InitialBackoff, err = parseConfigDuration("Retry initial-backoff", arg); err != nil {
+				return nil, err
+			}
+			initial, _ = time.ParseDuration(arg)
+		case "max-backoff":
+			if r.MaxBackoff, err = parseConfigDuration("Retry max-backoff", arg); err != nil {
+				return nil, err
+			}
+			max, _ = time.ParseDuration(arg)
+		case "backoff-multiplier":
+			f, perr := strconv.ParseFloat(arg, 64)
+			if perr != nil || f <= 0 {
+				return nil, fmt.Errorf("Retry backoff-multiplier must be a positive number")
+			}
+			r.BackoffMultiplier = f
+		default:
+			return nil, fmt.Errorf("unknown Retry parameter %q", name)
+		}
+	}
+	if r.MaxAttempts == 0 {
+		return nil, fmt.Errorf("Retry annotation requires max-attempts")
+	}
+	if max < initial {
+		return nil, fmt.Errorf("Retry max-backoff must not be less than initial-backoff")
+	}
+	return r, nil
+}
+
+// parseConfigDuration parses a positive Go duration, such as "1m30s", and
+// returns it in the format of the gRPC service config, such as "90s".
+func parseConfigDuration(what, value string) (string, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return "", fmt.Errorf("%s must be a positive duration, such as 5s", what)
+	}
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "s", nil
+}
+
+// setServiceConfig sets the client configuration option of a service from its
+// annotations, if it has any.
+func (g *Generator) setServiceConfig(o *descriptorpb.ServiceOptions, text string) error {
+	c, err := splitMethodConfig(text, nil)
+	if err != nil || c == nil {
+		return err
+	}
+	proto.SetExtension(o, serviceconfig.E_Service, c)
+	g.addProtoDep("gunk/serviceconfig.proto")
+	return nil
+}
+
+// setMethodConfig sets the client configuration option of a method from its
+// annotations, if it has any, on top of the configuration of its service.
+func (g *Generator) setMethodConfig(o *descriptorpb.MethodOptions, text string, srv *descriptorpb.ServiceOptions) error {
+	defaults, _ := proto.GetExtension(srv, serviceconfig.E_Service).(*serviceconfig.MethodConfig)
+	c, err := splitMethodConfig(text, defaults)
+	if err != nil || c == nil {
+		return err
+	}
+	proto.SetExtension(o, serviceconfig.E_Method, c)
+	g.addProtoDep("gunk/serviceconfig.proto")
+	return nil
+}
+
+// grpcServiceConfig is the gRPC service config written by the serviceconfig
+// generator. See
+// https://github.com/grpc/grpc/blob/master/doc/service_config.md.
+type grpcServiceConfig struct {
+	MethodConfig []grpcMethodConfig `json:"methodConfig"`
+}
+
+type grpcMethodConfig struct {
+	Name         []grpcMethodName `json:"name"`
+	Timeout      string           `json:"timeout,omitempty"`
+	WaitForReady bool             `json:"waitForReady,omitempty"`
+	RetryPolicy  *grpcRetryPolicy `json:"retryPolicy,omitempty"`
+}
+
+type grpcMethodName struct {
+	Service string `json:"service"`
+	Method  string `json:"method,omitempty"`
+}
+
+type grpcRetryPolicy struct {
+	MaxAttempts          uint32   `json:"maxAttempts"`
+	InitialBackoff       string   `json:"initialBackoff"`
+	MaxBackoff           string   `json:"maxBackoff"`
+	BackoffMultiplier    float64  `json:"backoffMultiplier"`
+	RetryableStatusCodes []string `json:"retryableStatusCodes"`
+}
+
+// generateServiceConfig writes a gRPC service config of the package requested
+// in the CodeGeneratorRequest, named like "foo.serviceconfig.json", from the
+// client configuration annotations of its services and methods.
+func (g *Generator) generateServiceConfig(req *pluginpb.CodeGeneratorRequest, gen config.Generator) error {
+	if len(gen.Params) > 0 {
+		return fmt.Errorf("unknown serviceconfig parameter %q", gen.Params[0].Key)
+	}
+	ftgs := req.GetFileToGenerate()
+	if len(ftgs) == 0 {
+		return fmt.Errorf("no files to generate")
+	}
+	mainPkgPath := filepath.Clean(filepath.Dir(ftgs[0]))
+	mainPkg, ok := g.gunkPkgs[mainPkgPath]
+	if !ok {
+		return fmt.Errorf("failed to get main package: %s", mainPkgPath)
+	}
+	buf, err := json.MarshalIndent(serviceConfig(req), "", "\t")
+	if err != nil {
+		return err
+	}
+	dir, err := outPath(gen, mainPkg.Dir, mainPkg.Name)
+	if err != nil {
+		return fmt.Errorf("unable to build output path for %q: %w", mainPkg.Dir, err)
+	}
+	if err := mkdirAll(dir); err != nil {
+		return fmt.Errorf("unable to create directory %q: %w", dir, err)
+	}
+	return g.writePkgFile(mainPkgPath, filepath.Join(dir, mainPkg.Name+".serviceconfig.json"), append(buf, '\n'))
+}
+
+// serviceConfig returns the gRPC service config of the files to generate of
+// the request. A method's config replaces its service's, so the methods only
+// have their own entries when their configuration differs.
+func serviceConfig(req *pluginpb.CodeGeneratorRequest) *grpcServiceConfig {
+	isTarget := make(map[string]bool, len(req.FileToGenerate))
+	for _, name := range req.FileToGenerate {
+		isTarget[name] = true
+	}
+	sc := &grpcServiceConfig{MethodConfig: []grpcMethodConfig{}}
+	add := func(c *serviceconfig.MethodConfig, name grpcMethodName) {
+		mc := grpcMethodConfig{
+			Name:         []grpcMethodName{name},
+			Timeout:      c.GetTimeout(),
+			WaitForReady: c.GetWaitForReady(),
+		}
+		if r := c.GetRetryPolicy(); r != nil {
+			mc.RetryPolicy = &grpcRetryPolicy{
+				MaxAttempts:          r.GetMaxAttempts(),
+				InitialBackoff:       r.GetInitialBackoff(),
+				MaxBackoff:           r.GetMaxBackoff(),
+				BackoffMultiplier:    r.GetBackoffMultiplier(),
+				RetryableStatusCodes: r.GetRetryableStatusCodes(),
+			}
+		}
+		sc.MethodConfig = append(sc.MethodConfig, mc)
+	}
+	for _, pfile := range req.ProtoFile {
+		if !isTarget[pfile.GetName()] {
+			continue
+		}
+		for _, srv := range pfile.GetService() {
+			srvName := srv.GetName()
+			if pfile.GetPackage() != "" {
+				srvName = pfile.GetPackage() + "." + srvName
+			}
+			srvConfig, _ := proto.GetExtension(srv.GetOptions(), serviceconfig.E_Service).(*serviceconfig.MethodConfig)
+			if srvConfig != nil {
+				add(srvConfig, grpcMethodName{Service: srvName})
+			}
+			for _, method := range srv.GetMethod() {
+				c, _ := proto.GetExtension(method.GetOptions(), serviceconfig.E_Method).(*serviceconfig.MethodConfig)
+				if c != nil && !proto.Equal(c, srvConfig) {
+					add(c, grpcMethodName{Service: srvName, Method: method.GetName()})
+				}
+			}
+		}
+	}
+	return sc
+}
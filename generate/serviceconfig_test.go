@@ -0,0 +1,95 @@
+package generate
+
+import (
+	"testing"
+
+	"github.com/gunk/gunk/assets/serviceconfig"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestSplitMethodConfig(t *testing.T) {
+	defaults := &serviceconfig.MethodConfig{
+		Timeout:      "5s",
+		WaitForReady: true,
+		RetryPolicy: &serviceconfig.RetryPolicy{
+			MaxAttempts:          3,
+			InitialBackoff:       "0.1s",
+			MaxBackoff:           "1s",
+			BackoffMultiplier:    2,
+			RetryableStatusCodes: []string{"UNAVAILABLE"},
+		},
+	}
+	tests := []struct {
+		name     string
+		text     string
+		defaults *serviceconfig.MethodConfig
+		want     *serviceconfig.MethodConfig
+		wantErr  string
+	}{
+		{name: "none", text: "Get gets a user.\n"},
+		{
+			name: "timeout",
+			text: "Timeout: 1m30s\n",
+			want: &serviceconfig.MethodConfig{Timeout: "90s"},
+		},
+		{
+			name: "retry",
+			text: "Retry: max-attempts=4, initial-backoff=250ms, max-backoff=5s, backoff-multiplier=1.5\nRetry-On: unavailable, ABORTED\n",
+			want: &serviceconfig.MethodConfig{RetryPolicy: &serviceconfig.RetryPolicy{
+				MaxAttempts:          4,
+				InitialBackoff:       "0.25s",
+				MaxBackoff:           "5s",
+				BackoffMultiplier:    1.5,
+				RetryableStatusCodes: []string{"UNAVAILABLE", "ABORTED"},
+			}},
+		},
+		{
+			name:     "override",
+			text:     "Wait-For-Ready: false\nRetry: max-attempts=2\n",
+			defaults: defaults,
+			want: &serviceconfig.MethodConfig{Timeout: "5s", RetryPolicy: &serviceconfig.RetryPolicy{
+				MaxAttempts:          2,
+				InitialBackoff:       "0.1s",
+				MaxBackoff:           "1s",
+				BackoffMultiplier:    2,
+				RetryableStatusCodes: []string{"UNAVAILABLE"},
+			}},
+		},
+		{
+			name:     "override codes",
+			text:     "Retry-On: INTERNAL\n",
+			defaults: defaults,
+			want: &serviceconfig.MethodConfig{Timeout: "5s", WaitForReady: true, RetryPolicy: &serviceconfig.RetryPolicy{
+				MaxAttempts:          3,
+				InitialBackoff:       "0.1s",
+				MaxBackoff:           "1s",
+				BackoffMultiplier:    2,
+				RetryableStatusCodes: []string{"INTERNAL"},
+			}},
+		},
+		{name: "bad timeout", text: "Timeout: -1s\n", wantErr: "Timeout must be a positive duration, such as 5s"},
+		{name: "no codes", text: "Retry: max-attempts=3\n", wantErr: "Retry annotation without a Retry-On annotation"},
+		{name: "no retry", text: "Retry-On: UNAVAILABLE\n", wantErr: "Retry-On annotation without a Retry annotation"},
+		{name: "bad code", text: "Retry: max-attempts=3\nRetry-On: OK\n", wantErr: `invalid Retry-On status code "OK"`},
+		{name: "no attempts", text: "Retry: initial-backoff=1s\nRetry-On: UNAVAILABLE\n", wantErr: "Retry annotation requires max-attempts"},
+		{name: "backoff", text: "Retry: max-attempts=3, initial-backoff=2s\nRetry-On: UNAVAILABLE\n", wantErr: "Retry max-backoff must not be less than initial-backoff"},
+		{name: "unknown", text: "Retry: max-attempts=3, jitter=0.2\nRetry-On: UNAVAILABLE\n", wantErr: `unknown Retry parameter "jitter"`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := splitMethodConfig(test.text, test.defaults)
+			if test.wantErr != "" {
+				if err == nil || err.Error() != test.wantErr {
+					t.Fatalf("got error %v, want %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !proto.Equal(got, test.want) {
+				t.Fatalf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
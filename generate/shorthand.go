@@ -0,0 +1,369 @@
+package generate
+
+import (
+	"fmt"
+	"go/types"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// validateExtension is the field number of the (validate.rules) extension of
+// google.protobuf.FieldOptions declared by protoc-gen-validate.
+const validateExtension = 1071
+
+// ruleKind is the kind of value a validate rule takes.
+type ruleKind int
+
+const (
+	ruleBool   ruleKind = iota // a bool, which is true if no value is given
+	ruleUint                   // an unsigned length or count
+	ruleString                 // a string or bytes value
+	ruleValue                  // a value of the same type as the field
+)
+
+// validateRule is a single rule of a protoc-gen-validate rules message.
+type validateRule struct {
+	num  protowire.Number
+	kind ruleKind
+}
+
+var (
+	numberRules = map[string]validateRule{
+		"const": {1, ruleValue},
+		"lt":    {2, ruleValue},
+		"lte":   {3, ruleValue},
+		"gt":    {4, ruleValue},
+		"gte":   {5, ruleValue},
+	}
+	boolRules = map[string]validateRule{
+		"const": {1, ruleBool},
+	}
+	stringRules = map[string]validateRule{
+		"const":        {1, ruleString},
+		"min_len":      {2, ruleUint},
+		"max_len":      {3, ruleUint},
+		"pattern":      {6, ruleString},
+		"prefix":       {7, ruleString},
+		"suffix":       {8, ruleString},
+		"contains":     {9, ruleString},
+		"email":        {12, ruleBool},
+		"hostname":     {13, ruleBool},
+		"ip":           {14, ruleBool},
+		"ipv4":         {15, ruleBool},
+		"ipv6":         {16, ruleBool},
+		"uri":          {17, ruleBool},
+		"uri_ref":      {18, ruleBool},
+		"len":          {19, ruleUint},
+		"address":      {21, ruleBool},
+		"uuid":         {22, ruleBool},
+		"not_contains": {23, ruleString},
+	}
+	bytesRules = map[string]validateRule{
+		"const":    {1, ruleString},
+		"min_len":  {2, ruleUint},
+		"max_len":  {3, ruleUint},
+		"pattern":  {4, ruleString},
+		"prefix":   {5, ruleString},
+		"suffix":   {6, ruleString},
+		"contains": {7, ruleString},
+		"ip":       {10, ruleBool},
+		"ipv4":     {11, ruleBool},
+		"ipv6":     {12, ruleBool},
+		"len":      {13, ruleUint},
+	}
+	enumRules = map[string]validateRule{
+		"const":        {1, ruleValue},
+		"defined_only": {2, ruleBool},
+	}
+	messageRules = map[string]validateRule{
+		"skip":     {1, ruleBool},
+		"required": {2, ruleBool},
+	}
+	repeatedRules = map[string]validateRule{
+		"min_items": {1, ruleUint},
+		"max_items": {2, ruleUint},
+		"unique":    {3, ruleBool},
+	}
+	mapRules = map[string]validateRule{
+		"min_pairs": {1, ruleUint},
+		"max_pairs": {2, ruleUint},
+		"no_sparse": {3, ruleBool},
+	}
+)
+
+// fieldRules maps the field types to the number of their rules message in
+// validate.FieldRules, and the rules which it accepts.
+var fieldRules = map[descriptorpb.FieldDescriptorProto_Type]struct {
+	num   protowire.Number
+	rules map[string]validateRule
+}{
+	descriptorpb.FieldDescriptorProto_TYPE_FLOAT:    {1, numberRules},
+	descriptorpb.FieldDescriptorProto_TYPE_DOUBLE:   {2, numberRules},
+	descriptorpb.FieldDescriptorProto_TYPE_INT32:    {3, numberRules},
+	descriptorpb.FieldDescriptorProto_TYPE_INT64:    {4, numberRules},
+	descriptorpb.FieldDescriptorProto_TYPE_UINT32:   {5, numberRules},
+	descriptorpb.FieldDescriptorProto_TYPE_UINT64:   {6, numberRules},
+	descriptorpb.FieldDescriptorProto_TYPE_SINT32:   {7, numberRules},
+	descriptorpb.FieldDescriptorProto_TYPE_SINT64:   {8, numberRules},
+	descriptorpb.FieldDescriptorProto_TYPE_FIXED32:  {9, numberRules},
+	descriptorpb.FieldDescriptorProto_TYPE_FIXED64:  {10, numberRules},
+	descriptorpb.FieldDescriptorProto_TYPE_SFIXED32: {11, numberRules},
+	descriptorpb.FieldDescriptorProto_TYPE_SFIXED64: {12, numberRules},
+	descriptorpb.FieldDescriptorProto_TYPE_BOOL:     {13, boolRules},
+	descriptorpb.FieldDescriptorProto_TYPE_STRING:   {14, stringRules},
+	descriptorpb.FieldDescriptorProto_TYPE_BYTES:    {15, bytesRules},
+	descriptorpb.FieldDescriptorProto_TYPE_ENUM:     {16, enumRules},
+	descriptorpb.FieldDescriptorProto_TYPE_MESSAGE:  {17, messageRules},
+}
+
+// tagOptions sets the field options which are written in shorthand form as
+// struct tags on the field fd, such as `behavior:"required"` or
+// `validate:"min_len=1"`.
+func (g *Generator) tagOptions(fd *descriptorpb.FieldDescriptorProto, ftype types.Type, tag reflect.StructTag) error {
+	if v, ok := tag.Lookup("behavior"); ok {
+		var behaviors []annotations.FieldBehavior
+		for _, name := range strings.Split(v, ",") {
+			name = strings.TrimSpace(name)
+			b, ok := annotations.FieldBehavior_value[strings.ToUpper(name)]
+			if !ok || b == 0 {
+				return fmt.Errorf("unknown field behavior %q", name)
+			}
+			behaviors = append(behaviors, annotations.FieldBehavior(b))
+		}
+		proto.SetExtension(fd.Options, annotations.E_FieldBehavior, behaviors)
+		g.addProtoDep("google/api/field_behavior.proto")
+	}
+	v, ok := tag.Lookup("validate")
+	n, fixed := fixedBytesLen(ftype)
+	if fixed {
+		// Fixed-size byte arrays always carry their length rule.
+		rule := fmt.Sprintf("len=%d", n)
+		if ok {
+			rule += "," + v
+		}
+		v = rule
+	}
+	if ok || fixed {
+		b, err := validateRules(fd, ftype, v)
+		if err != nil {
+			return err
+		}
+		m := fd.Options.ProtoReflect()
+		m.SetUnknown(append(m.GetUnknown(), b...))
+		// The length rule alone is set without importing
+		// validate.proto, so that fixed-size byte arrays don't
+		// require protoc-gen-validate.
+		if ok {
+			g.addProtoDep("validate/validate.proto")
+		}
+	}
+	return nil
+}
+
+// validateRules returns the wire encoding of the (validate.rules) extension
+// holding the comma-separated rules in v. Rule values may be quoted with single
+// quotes to contain commas, such as pattern='^.{1,5}$', with '' standing for a
+// single quote.
+func validateRules(fd *descriptorpb.FieldDescriptorProto, ftype types.Type, v string) ([]byte, error) {
+	var num protowire.Number
+	var rules map[string]validateRule
+	var kind string
+	_, isMap := ftype.(*types.Map)
+	switch {
+	case isMap:
+		num, rules, kind = 19, mapRules, "map"
+	case fd.GetLabel() == descriptorpb.FieldDescriptorProto_LABEL_REPEATED:
+		num, rules, kind = 18, repeatedRules, "repeated"
+	default:
+		r, ok := fieldRules[fd.GetType()]
+		if !ok {
+			return nil, fmt.Errorf("validate rules are not supported on %v fields", ftype)
+		}
+		num, rules, kind = r.num, r.rules, strings.ToLower(strings.TrimPrefix(fd.GetType().String(), "TYPE_"))
+	}
+	split, err := splitRules(v)
+	if err != nil {
+		return nil, err
+	}
+	var b []byte
+	for _, rule := range split {
+		name, value := strings.TrimSpace(rule), ""
+		hasValue := false
+		if i := strings.Index(name, "="); i >= 0 {
+			name, value, hasValue = name[:i], name[i+1:], true
+		}
+		r, ok := rules[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown validate rule %q for %s fields", name, kind)
+		}
+		if strings.HasPrefix(value, "'") {
+			if value, err = unquoteRule(value); err != nil {
+				return nil, fmt.Errorf("invalid value for validate rule %q: %v", name, err)
+			}
+		}
+		switch r.kind {
+		case ruleBool:
+			val := true
+			if hasValue {
+				if val, err = strconv.ParseBool(value); err != nil {
+					return nil, fmt.Errorf("invalid value for validate rule %q: %v", name, err)
+				}
+			}
+			b = protowire.AppendTag(b, r.num, protowire.VarintType)
+			b = protowire.AppendVarint(b, protowire.EncodeBool(val))
+			continue
+		}
+		if !hasValue {
+			return nil, fmt.Errorf("validate rule %q requires a value", name)
+		}
+		switch r.kind {
+		case ruleUint:
+			var val uint64
+			if val, err = strconv.ParseUint(value, 10, 64); err == nil {
+				b = protowire.AppendTag(b, r.num, protowire.VarintType)
+				b = protowire.AppendVarint(b, val)
+			}
+		case ruleString:
+			b = protowire.AppendTag(b, r.num, protowire.BytesType)
+			b = protowire.AppendString(b, value)
+		case ruleValue:
+			b, err = appendRuleValue(b, r.num, fd.GetType(), value)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for validate rule %q: %v", name, err)
+		}
+	}
+	msg := protowire.AppendTag(nil, num, protowire.BytesType)
+	msg = protowire.AppendBytes(msg, b)
+	ext := protowire.AppendTag(nil, validateExtension, protowire.BytesType)
+	return protowire.AppendBytes(ext, msg), nil
+}
+
+// splitRules splits validate rules on the commas which aren't within single
+// quotes, keeping the quotes.
+func splitRules(v string) ([]string, error) {
+	var rules []string
+	quoted, start := false, 0
+	for i, c := range v {
+		switch {
+		case c == '\'':
+			quoted = !quoted
+		case c == ',' && !quoted:
+			rules = append(rules, v[start:i])
+			start = i + 1
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("unterminated quote in validate rules %q", v)
+	}
+	return append(rules, v[start:]), nil
+}
+
+// unquoteRule returns the value of a validate rule quoted with single quotes,
+// in which '' stands for a single quote.
+func unquoteRule(s string) (string, error) {
+	if len(s) < 2 || !strings.HasSuffix(s, "'") {
+		return "", fmt.Errorf("invalid quoted value %s", s)
+	}
+	inner := s[1 : len(s)-1]
+	if strings.Contains(strings.ReplaceAll(inner, "''", ""), "'") {
+		return "", fmt.Errorf("invalid quoted value %s", s)
+	}
+	return strings.ReplaceAll(inner, "''", "'"), nil
+}
+
+// appendRuleValue appends the wire encoding of value as a field of the given
+// type to b.
+func appendRuleValue(b []byte, num protowire.Number, typ descriptorpb.FieldDescriptorProto_Type, value string) ([]byte, error) {
+	switch typ {
+	case descriptorpb.FieldDescriptorProto_TYPE_FLOAT:
+		v, err := strconv.ParseFloat(value, 32)
+		if err != nil {
+			return nil, err
+		}
+		b = protowire.AppendTag(b, num, protowire.Fixed32Type)
+		return protowire.AppendFixed32(b, math.Float32bits(float32(v))), nil
+	case descriptorpb.FieldDescriptorProto_TYPE_DOUBLE:
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, err
+		}
+		b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+		return protowire.AppendFixed64(b, math.Float64bits(v)), nil
+	case descriptorpb.FieldDescriptorProto_TYPE_INT32, descriptorpb.FieldDescriptorProto_TYPE_ENUM:
+		v, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		b = protowire.AppendTag(b, num, protowire.VarintType)
+		return protowire.AppendVarint(b, uint64(v)), nil
+	case descriptorpb.FieldDescriptorProto_TYPE_INT64:
+		v, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		b = protowire.AppendTag(b, num, protowire.VarintType)
+		return protowire.AppendVarint(b, uint64(v)), nil
+	case descriptorpb.FieldDescriptorProto_TYPE_UINT32:
+		v, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		b = protowire.AppendTag(b, num, protowire.VarintType)
+		return protowire.AppendVarint(b, v), nil
+	case descriptorpb.FieldDescriptorProto_TYPE_UINT64:
+		v, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		b = protowire.AppendTag(b, num, protowire.VarintType)
+		return protowire.AppendVarint(b, v), nil
+	case descriptorpb.FieldDescriptorProto_TYPE_SINT32, descriptorpb.FieldDescriptorProto_TYPE_SINT64:
+		bitSize := 32
+		if typ == descriptorpb.FieldDescriptorProto_TYPE_SINT64 {
+			bitSize = 64
+		}
+		v, err := strconv.ParseInt(value, 10, bitSize)
+		if err != nil {
+			return nil, err
+		}
+		b = protowire.AppendTag(b, num, protowire.VarintType)
+		return protowire.AppendVarint(b, protowire.EncodeZigZag(v)), nil
+	case descriptorpb.FieldDescriptorProto_TYPE_FIXED32:
+		v, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		b = protowire.AppendTag(b, num, protowire.Fixed32Type)
+		return protowire.AppendFixed32(b, uint32(v)), nil
+	case descriptorpb.FieldDescriptorProto_TYPE_FIXED64:
+		v, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+		return protowire.AppendFixed64(b, v), nil
+	case descriptorpb.FieldDescriptorProto_TYPE_SFIXED32:
+		v, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		b = protowire.AppendTag(b, num, protowire.Fixed32Type)
+		return protowire.AppendFixed32(b, uint32(v)), nil
+	case descriptorpb.FieldDescriptorProto_TYPE_SFIXED64:
+		v, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+		return protowire.AppendFixed64(b, uint64(v)), nil
+	}
+	return nil, fmt.Errorf("unsupported type %v", typ)
+}
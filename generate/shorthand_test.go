@@ -0,0 +1,172 @@
+package generate
+
+import (
+	"bytes"
+	"go/types"
+	"reflect"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func TestTagOptions(t *testing.T) {
+	g := &Generator{pfile: &descriptorpb.FileDescriptorProto{}}
+	fd := &descriptorpb.FieldDescriptorProto{
+		Type:    descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+		Label:   descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		Options: &descriptorpb.FieldOptions{},
+	}
+	tag := reflect.StructTag(`pb:"1" behavior:"required, output_only" validate:"min_len=1"`)
+	if err := g.tagOptions(fd, types.Typ[types.String], tag); err != nil {
+		t.Fatal(err)
+	}
+	got := proto.GetExtension(fd.Options, annotations.E_FieldBehavior).([]annotations.FieldBehavior)
+	want := []annotations.FieldBehavior{annotations.FieldBehavior_REQUIRED, annotations.FieldBehavior_OUTPUT_ONLY}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("field behavior: got %v, want %v", got, want)
+	}
+	if len(fd.Options.ProtoReflect().GetUnknown()) == 0 {
+		t.Errorf("validate rules were not set")
+	}
+	wantDeps := []string{"google/api/field_behavior.proto", "validate/validate.proto"}
+	if !reflect.DeepEqual(g.pfile.Dependency, wantDeps) {
+		t.Errorf("dependencies: got %v, want %v", g.pfile.Dependency, wantDeps)
+	}
+}
+
+func TestTagOptionsFixedBytes(t *testing.T) {
+	g := &Generator{pfile: &descriptorpb.FileDescriptorProto{}}
+	fd := &descriptorpb.FieldDescriptorProto{
+		Type:    descriptorpb.FieldDescriptorProto_TYPE_BYTES.Enum(),
+		Label:   descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		Options: &descriptorpb.FieldOptions{},
+	}
+	typ := types.NewArray(types.Typ[types.Byte], 16)
+	if err := g.tagOptions(fd, typ, reflect.StructTag(`pb:"1"`)); err != nil {
+		t.Fatal(err)
+	}
+	want, err := validateRules(fd, typ, "len=16")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := []byte(fd.Options.ProtoReflect().GetUnknown()); !bytes.Equal(got, want) {
+		t.Errorf("length rule: got %x, want %x", got, want)
+	}
+	if len(g.pfile.Dependency) != 0 {
+		t.Errorf("dependencies: got %v, want none", g.pfile.Dependency)
+	}
+}
+
+func TestValidateRules(t *testing.T) {
+	// rules returns the encoding of the (validate.rules) extension with
+	// the given rules message.
+	rules := func(num protowire.Number, msg []byte) []byte {
+		b := protowire.AppendTag(nil, num, protowire.BytesType)
+		b = protowire.AppendBytes(b, msg)
+		ext := protowire.AppendTag(nil, validateExtension, protowire.BytesType)
+		return protowire.AppendBytes(ext, b)
+	}
+	varint := func(num protowire.Number, v uint64) []byte {
+		return protowire.AppendVarint(protowire.AppendTag(nil, num, protowire.VarintType), v)
+	}
+	concat := func(bs ...[]byte) []byte { return bytes.Join(bs, nil) }
+	str := types.Typ[types.String]
+	tests := []struct {
+		typ   descriptorpb.FieldDescriptorProto_Type
+		label descriptorpb.FieldDescriptorProto_Label
+		gtype types.Type
+		tag   string
+		want  []byte
+		err   string
+	}{
+		{
+			typ: descriptorpb.FieldDescriptorProto_TYPE_STRING, gtype: str,
+			tag:  "min_len=1,max_len=64,email",
+			want: rules(14, concat(varint(2, 1), varint(3, 64), varint(12, 1))),
+		},
+		{
+			// Quoted values may contain commas and quotes.
+			typ: descriptorpb.FieldDescriptorProto_TYPE_STRING, gtype: str,
+			tag: "min_len=1,pattern='^.{1,5}$',prefix='it''s'",
+			want: rules(14, concat(varint(2, 1),
+				protowire.AppendString(protowire.AppendTag(nil, 6, protowire.BytesType), "^.{1,5}$"),
+				protowire.AppendString(protowire.AppendTag(nil, 7, protowire.BytesType), "it's"))),
+		},
+		{
+			typ: descriptorpb.FieldDescriptorProto_TYPE_INT32, gtype: types.Typ[types.Int],
+			tag:  "gte=-1,lt=100",
+			want: rules(3, concat(varint(5, uint64(1<<64-1)), varint(2, 100))),
+		},
+		{
+			typ: descriptorpb.FieldDescriptorProto_TYPE_SINT32, gtype: types.Typ[types.Int32],
+			tag:  "gte=-1",
+			want: rules(7, varint(5, 1)),
+		},
+		{
+			typ: descriptorpb.FieldDescriptorProto_TYPE_FIXED64, gtype: types.Typ[types.Uint64],
+			tag:  "lt=2",
+			want: rules(10, protowire.AppendFixed64(protowire.AppendTag(nil, 2, protowire.Fixed64Type), 2)),
+		},
+		{
+			typ: descriptorpb.FieldDescriptorProto_TYPE_STRING, label: descriptorpb.FieldDescriptorProto_LABEL_REPEATED,
+			gtype: types.NewSlice(str),
+			tag:   "min_items=1,unique=false",
+			want:  rules(18, concat(varint(1, 1), varint(3, 0))),
+		},
+		{
+			typ: descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, label: descriptorpb.FieldDescriptorProto_LABEL_REPEATED,
+			gtype: types.NewMap(str, str),
+			tag:   "max_pairs=10",
+			want:  rules(19, varint(2, 10)),
+		},
+		{
+			typ: descriptorpb.FieldDescriptorProto_TYPE_INT32, gtype: types.Typ[types.Int],
+			tag: "min_len=1",
+			err: `unknown validate rule "min_len" for int32 fields`,
+		},
+		{
+			typ: descriptorpb.FieldDescriptorProto_TYPE_STRING, gtype: str,
+			tag: "pattern='^.{1,5}$",
+			err: `unterminated quote in validate rules "pattern='^.{1,5}$"`,
+		},
+		{
+			typ: descriptorpb.FieldDescriptorProto_TYPE_STRING, gtype: str,
+			tag: "pattern='a'b",
+			err: `invalid value for validate rule "pattern": invalid quoted value 'a'b`,
+		},
+		{
+			typ: descriptorpb.FieldDescriptorProto_TYPE_STRING, gtype: str,
+			tag: "max_len",
+			err: `validate rule "max_len" requires a value`,
+		},
+		{
+			typ: descriptorpb.FieldDescriptorProto_TYPE_UINT32, gtype: types.Typ[types.Uint],
+			tag: "gt=-1",
+			err: `invalid value for validate rule "gt": strconv.ParseUint: parsing "-1": invalid syntax`,
+		},
+	}
+	for _, test := range tests {
+		label := test.label
+		if label == 0 {
+			label = descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+		}
+		fd := &descriptorpb.FieldDescriptorProto{Type: &test.typ, Label: &label}
+		got, err := validateRules(fd, test.gtype, test.tag)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%q: got error %v, want %q", test.tag, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.tag, err)
+			continue
+		}
+		if !bytes.Equal(got, test.want) {
+			t.Errorf("%q: got %x, want %x", test.tag, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package generate
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+// protoOrigins records which Gunk file each top-level declaration and
+// documentation location of a unified proto file was translated from, so that
+// the file can later be split into one proto file per Gunk file.
+type protoOrigins struct {
+	files      []string // the Gunk file names of the package, in order
+	messages   []string
+	enums      []string
+	services   []string
+	extensions []string
+	locations  []string
+	// optionDeps maps a Gunk file to the Gunk files of the same package
+	// declaring the custom options it uses. File options are recorded
+	// under the empty name, as they are shared by all files.
+	optionDeps map[string]map[string]bool
+}
+
+// splitProtoFile returns the name of the proto file translated from a single
+// Gunk file, such as "example.com/foo/bar.proto" for "example.com/foo/bar.gunk".
+func splitProtoFile(gname string) string {
+	return strings.TrimSuffix(gname, ".gunk") + ".proto"
+}
+
+// splitCodeGenRequest replaces the unified proto files of the packages
+// configured with split_proto_files by one proto file per Gunk file, in both
+// the files to generate and the proto files of the request. The dependencies
+// of the other files are updated to point at the split files.
+func (g *Generator) splitCodeGenRequest(req *pluginpb.CodeGeneratorRequest) (*pluginpb.CodeGeneratorRequest, error) {
+	split := make(map[string][]*descriptorpb.FileDescriptorProto)
+	for _, pfile := range req.ProtoFile {
+		if !g.splitProto[pfile.GetName()] {
+			continue
+		}
+		files, err := g.splitFile(pfile)
+		if err != nil {
+			return nil, err
+		}
+		split[pfile.GetName()] = files
+	}
+	if len(split) == 0 {
+		return req, nil
+	}
+	out := &pluginpb.CodeGeneratorRequest{}
+	for _, ftg := range req.FileToGenerate {
+		files, ok := split[ftg]
+		if !ok {
+			out.FileToGenerate = append(out.FileToGenerate, ftg)
+			continue
+		}
+		for _, pfile := range files {
+			out.FileToGenerate = append(out.FileToGenerate, pfile.GetName())
+		}
+	}
+	for _, pfile := range req.ProtoFile {
+		if files, ok := split[pfile.GetName()]; ok {
+			for _, pfile := range files {
+				pfile.Dependency = splitDeps(pfile.Dependency, split)
+			}
+			out.ProtoFile = append(out.ProtoFile, files...)
+			continue
+		}
+		if deps := splitDeps(pfile.Dependency, split); len(deps) != len(pfile.Dependency) {
+			// Don't modify the files shared with other packages.
+			pfile = proto.Clone(pfile).(*descriptorpb.FileDescriptorProto)
+			pfile.Dependency = deps
+		}
+		out.ProtoFile = append(out.ProtoFile, pfile)
+	}
+	out.ProtoFile = topologicalSort(out.ProtoFile)
+	return out, nil
+}
+
+// splitDeps returns the dependencies with each split unified proto file
+// replaced by all the files it was split into.
+func splitDeps(deps []string, split map[string][]*descriptorpb.FileDescriptorProto) []string {
+	var result []string
+	for _, dep := range deps {
+		files, ok := split[dep]
+		if !ok {
+			result = append(result, dep)
+			continue
+		}
+		for _, pfile := range files {
+			result = append(result, pfile.GetName())
+		}
+	}
+	return result
+}
+
+// splitFile splits a unified proto file into one proto file per Gunk file of
+// its package, keeping the declarations and comments of each Gunk file. Each
+// file depends on the files of the package declaring the types and custom
+// options it uses, which must not form a cycle.
+func (g *Generator) splitFile(pfile *descriptorpb.FileDescriptorProto) ([]*descriptorpb.FileDescriptorProto, error) {
+	origins := g.origins[pfile.GetName()]
+	files := make(map[string]*descriptorpb.FileDescriptorProto, len(origins.files))
+	result := make([]*descriptorpb.FileDescriptorProto, 0, len(origins.files))
+	for _, gname := range origins.files {
+		f := &descriptorpb.FileDescriptorProto{
+			Syntax:         pfile.Syntax,
+			Name:           proto.String(splitProtoFile(gname)),
+			Package:        pfile.Package,
+			Options:        pfile.Options,
+			SourceCodeInfo: &descriptorpb.SourceCodeInfo{},
+		}
+		files[gname] = f
+		result = append(result, f)
+	}
+	// Move the declarations, remembering their new indexes for the
+	// documentation paths and which file declares each type.
+	indexes := make(map[int32][]int32)
+	declared := make(map[string]string)
+	prefix := "."
+	if pkg := pfile.GetPackage(); pkg != "" {
+		prefix += pkg + "."
+	}
+	for i, msg := range pfile.MessageType {
+		f := files[origins.messages[i]]
+		indexes[messagePath] = append(indexes[messagePath], int32(len(f.MessageType)))
+		f.MessageType = append(f.MessageType, msg)
+		declared[prefix+msg.GetName()] = origins.messages[i]
+	}
+	for i, enum := range pfile.EnumType {
+		f := files[origins.enums[i]]
+		indexes[enumPath] = append(indexes[enumPath], int32(len(f.EnumType)))
+		f.EnumType = append(f.EnumType, enum)
+		declared[prefix+enum.GetName()] = origins.enums[i]
+	}
+	for i, srv := range pfile.Service {
+		f := files[origins.services[i]]
+		indexes[servicePath] = append(indexes[servicePath], int32(len(f.Service)))
+		f.Service = append(f.Service, srv)
+	}
+	for i, ext := range pfile.Extension {
+		f := files[origins.extensions[i]]
+		indexes[extensionPath] = append(indexes[extensionPath], int32(len(f.Extension)))
+		f.Extension = append(f.Extension, ext)
+	}
+	for i, loc := range pfile.GetSourceCodeInfo().GetLocation() {
+		f := files[origins.locations[i]]
+		if len(loc.Path) >= 2 {
+			if idx, ok := indexes[loc.Path[0]]; ok {
+				if int(loc.Path[1]) >= len(idx) {
+					// The documented declaration was dropped,
+					// such as an enum without values.
+					continue
+				}
+				loc = proto.Clone(loc).(*descriptorpb.SourceCodeInfo_Location)
+				loc.Path[1] = idx[loc.Path[1]]
+			}
+		}
+		f.SourceCodeInfo.Location = append(f.SourceCodeInfo.Location, loc)
+	}
+
+	// Work out the dependencies between the files of the package.
+	deps := make(map[string]map[string]bool)
+	addDep := func(from, to string) {
+		if to == "" || to == from {
+			return
+		}
+		if deps[from] == nil {
+			deps[from] = make(map[string]bool)
+		}
+		deps[from][to] = true
+	}
+	uses := func(from, typeName string) {
+		// Nested types are declared by the file of the top-level type.
+		for name := typeName; name != ""; name = name[:strings.LastIndex(name, ".")] {
+			if to, ok := declared[name]; ok {
+				addDep(from, to)
+				return
+			}
+		}
+	}
+	var usesMessage func(from string, msg *descriptorpb.DescriptorProto)
+	usesMessage = func(from string, msg *descriptorpb.DescriptorProto) {
+		for _, field := range msg.Field {
+			uses(from, field.GetTypeName())
+		}
+		for _, nested := range msg.NestedType {
+			usesMessage(from, nested)
+		}
+	}
+	for i, msg := range pfile.MessageType {
+		usesMessage(origins.messages[i], msg)
+	}
+	for i, srv := range pfile.Service {
+		for _, method := range srv.Method {
+			uses(origins.services[i], method.GetInputType())
+			uses(origins.services[i], method.GetOutputType())
+		}
+	}
+	for i, ext := range pfile.Extension {
+		uses(origins.extensions[i], ext.GetTypeName())
+	}
+	for from, tos := range origins.optionDeps {
+		for to := range tos {
+			if from != "" {
+				addDep(from, to)
+				continue
+			}
+			for _, gname := range origins.files {
+				addDep(gname, to)
+			}
+		}
+	}
+	if from, to := findCycle(origins.files, deps); from != "" {
+		return nil, fmt.Errorf("cannot split %s into one proto file per Gunk file: %s and %s depend on each other",
+			pfile.GetName(), from, to)
+	}
+	for _, gname := range origins.files {
+		var siblings []string
+		for to := range deps[gname] {
+			siblings = append(siblings, splitProtoFile(to))
+		}
+		sort.Strings(siblings)
+		f := files[gname]
+		f.Dependency = append(f.Dependency, siblings...)
+		f.Dependency = append(f.Dependency, pfile.Dependency...)
+	}
+	return result, nil
+}
+
+// findCycle returns two of the Gunk files in a dependency cycle, or empty
+// strings if there is no cycle.
+func findCycle(files []string, deps map[string]map[string]bool) (from, to string) {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int)
+	var visit func(name string) bool
+	visit = func(name string) bool {
+		state[name] = visiting
+		var tos []string
+		for to := range deps[name] {
+			tos = append(tos, to)
+		}
+		sort.Strings(tos)
+		for _, dep := range tos {
+			switch state[dep] {
+			case visiting:
+				from, to = name, dep
+				return true
+			case 0:
+				if visit(dep) {
+					return true
+				}
+			}
+		}
+		state[name] = visited
+		return false
+	}
+	for _, name := range files {
+		if state[name] == 0 && visit(name) {
+			return from, to
+		}
+	}
+	return "", ""
+}
@@ -0,0 +1,56 @@
+package generate
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+
+	"github.com/gunk/gunk/config"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+// withModuleMappings returns the generator with the ProtoPathModuleMappings
+// parameter of swift-protobuf and grpc-swift set to a file mapping the proto
+// files of the imported Gunk packages to their Swift modules, as configured
+// with module_mappings. The returned function removes the file.
+func withModuleMappings(req *pluginpb.CodeGeneratorRequest, gen config.Generator) (config.Generator, func(), error) {
+	modules := make(map[string]string, len(gen.ModuleMappings))
+	for _, m := range gen.ModuleMappings {
+		modules[m.Key] = m.Value
+	}
+	generated := make(map[string]bool, len(req.FileToGenerate))
+	for _, name := range req.FileToGenerate {
+		generated[name] = true
+	}
+	var buf bytes.Buffer
+	for _, pf := range req.ProtoFile {
+		module, ok := modules[path.Dir(pf.GetName())]
+		if !ok || generated[pf.GetName()] {
+			continue
+		}
+		fmt.Fprintf(&buf, "mapping {\n  module_name: %s\n  proto_file_path: %s\n}\n",
+			strconv.Quote(module), strconv.Quote(pf.GetName()))
+	}
+	f, err := ioutil.TempFile("", "gunk-module-mappings-*.asciipb")
+	if err != nil {
+		return gen, nil, err
+	}
+	cleanup := func() { os.Remove(f.Name()) }
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		cleanup()
+		return gen, nil, err
+	}
+	if err := f.Close(); err != nil {
+		cleanup()
+		return gen, nil, err
+	}
+	// Copy the parameters, to not modify those of the other packages.
+	params := make([]config.KeyValue, len(gen.Params), len(gen.Params)+1)
+	copy(params, gen.Params)
+	gen.Params = append(params, config.KeyValue{Key: "ProtoPathModuleMappings", Value: f.Name()})
+	return gen, cleanup, nil
+}
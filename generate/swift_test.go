@@ -0,0 +1,53 @@
+package generate
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/gunk/gunk/config"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+func TestWithModuleMappings(t *testing.T) {
+	req := &pluginpb.CodeGeneratorRequest{
+		FileToGenerate: []string{"example.com/api/all.proto"},
+		ProtoFile: []*descriptorpb.FileDescriptorProto{
+			{Name: proto.String("google/protobuf/timestamp.proto")},
+			{Name: proto.String("example.com/types/all.proto")},
+			{Name: proto.String("example.com/other/all.proto")},
+			{Name: proto.String("example.com/api/all.proto")},
+		},
+	}
+	gen := config.Generator{
+		Command: "protoc-gen-swift",
+		Params:  []config.KeyValue{{Key: "Visibility", Value: "Public"}},
+		ModuleMappings: []config.KeyValue{
+			{Key: "example.com/types", Value: "Types"},
+			{Key: "example.com/api", Value: "API"},
+		},
+	}
+	got, cleanup, err := withModuleMappings(req, gen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	if len(gen.Params) != 1 {
+		t.Errorf("the parameters of the generator were modified")
+	}
+	param := got.ParamString()
+	prefix := "Visibility=Public,ProtoPathModuleMappings="
+	if !strings.HasPrefix(param, prefix) {
+		t.Fatalf("wrong parameters %q", param)
+	}
+	b, err := ioutil.ReadFile(strings.TrimPrefix(param, prefix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "mapping {\n  module_name: \"Types\"\n  proto_file_path: \"example.com/types/all.proto\"\n}\n"
+	if string(b) != want {
+		t.Errorf("wrong module mappings, got %q expected %q", b, want)
+	}
+}
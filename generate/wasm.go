@@ -0,0 +1,56 @@
+package generate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/gunk/gunk/config"
+	"github.com/gunk/gunk/log"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/tetratelabs/wazero/sys"
+)
+
+// runWasmPlugin runs a plugin compiled to WASI within gunk with wazero, with
+// its request on the standard input, and returns its response. The plugin is
+// only given its standard input and output, without any access to the file
+// system nor the environment, and is stopped like the plugin binaries if it
+// runs longer than its timeout or writes more than its maximum output.
+func runWasmPlugin(gen config.Generator, stdin io.Reader) ([]byte, error) {
+	path := wasmPath(gen)
+	wasm, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	log.Verbosef("running %s with wazero", path)
+	timeout, max := pluginLimits(gen)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	rt := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().WithCloseOnContextDone(true))
+	defer rt.Close(context.Background())
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, rt); err != nil {
+		return nil, err
+	}
+	stdout := &limitedBuffer{max: max, exceeded: cancel}
+	cfg := wazero.NewModuleConfig().
+		WithName(gen.Command).
+		WithArgs(gen.Command).
+		WithStdin(stdin).
+		WithStdout(stdout)
+	_, err = rt.InstantiateWithConfig(ctx, wasm, cfg)
+	if err := pluginLimitError(gen, errors.Is(ctx.Err(), context.DeadlineExceeded), stdout.overflow); err != nil {
+		return nil, err
+	}
+	// Plugins exiting successfully with proc_exit return an exit error.
+	var xerr *sys.ExitError
+	if errors.As(err, &xerr) && xerr.ExitCode() == 0 {
+		err = nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error running wasm plugin %s: %w", path, err)
+	}
+	return stdout.buf.Bytes(), nil
+}
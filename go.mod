@@ -1,30 +1,31 @@
 module github.com/gunk/gunk
 
-go 1.17
+go 1.25.0
 
 require (
 	github.com/emicklei/proto v1.9.2
 	github.com/grpc-ecosystem/grpc-gateway/v2 v2.7.3
 	github.com/gunk/opt v0.2.0
-	github.com/karelbilek/dirchanges v0.0.0-20210218071031-880a92f1a313
 	github.com/kenshaw/ini v0.5.1
 	github.com/kenshaw/snaker v0.2.0
+	github.com/pkg/diff v0.0.0-20210226163009-20ebb0f2a09e
 	github.com/rogpeppe/go-internal v1.8.1
 	github.com/spf13/cobra v1.3.0
-	golang.org/x/sys v0.0.0-20220128215802-99c3d69c2c27
+	github.com/tetratelabs/wazero v1.12.0
+	golang.org/x/mod v0.5.1
+	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c
+	golang.org/x/sys v0.44.0
 	golang.org/x/tools v0.1.9
 	google.golang.org/genproto v0.0.0-20220202230416-2a053f022f0d
 	google.golang.org/protobuf v1.27.1
+	gopkg.in/yaml.v2 v2.4.0
 	mvdan.cc/gofumpt v0.2.1
 )
 
 require (
 	github.com/google/go-cmp v0.5.7 // indirect
 	github.com/inconshreveable/mousetrap v1.0.0 // indirect
-	github.com/pkg/diff v0.0.0-20210226163009-20ebb0f2a09e // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
-	golang.org/x/mod v0.5.1 // indirect
-	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c // indirect
 	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1 // indirect
 	gopkg.in/errgo.v2 v2.1.0 // indirect
 )
@@ -27,6 +27,10 @@ var linters = map[string]linter{
 		Usage: "enforces JSON tags to be snake case versions of field name",
 		Run:   lintJSON,
 	},
+	"todo": {
+		Usage: "reports TODO, FIXME and XXX markers in doc comments",
+		Run:   lintTodo,
+	},
 	"unimport": {
 		Usage: "lists all imports that are unused",
 		Run:   lintUnimport,
@@ -0,0 +1,63 @@
+package lint
+
+import (
+	"go/ast"
+	"go/scanner"
+	"go/token"
+	"regexp"
+	"strings"
+
+	"github.com/gunk/gunk/loader"
+)
+
+// todoMarker matches the markers of placeholder text in comments.
+var todoMarker = regexp.MustCompile(`\b(TODO|FIXME|XXX)\b`)
+
+// lintTodo reports the doc comments containing TODO, FIXME or XXX markers,
+// unless their package is allowed to have them in the gunkconfig.
+func lintTodo(l *Linter, pkgs []*loader.GunkPackage) {
+	for _, pkg := range pkgs {
+		if l.cfg[pkg.ID].Lint.TodoAllowed(pkg.PkgPath) {
+			continue
+		}
+		l.Err = append(l.Err, TodoMarkers(l.Fset, pkg)...)
+	}
+}
+
+// TodoMarkers returns an error for each doc comment in the package containing
+// TODO, FIXME or XXX markers, as those comments end up in the generated code
+// and documentation.
+func TodoMarkers(fset *token.FileSet, pkg *loader.GunkPackage) scanner.ErrorList {
+	var errs scanner.ErrorList
+	check := func(doc *ast.CommentGroup) {
+		if doc == nil {
+			return
+		}
+		var found []string
+		seen := make(map[string]bool)
+		for _, marker := range todoMarker.FindAllString(doc.Text(), -1) {
+			if !seen[marker] {
+				seen[marker] = true
+				found = append(found, marker)
+			}
+		}
+		if len(found) > 0 {
+			errs.Add(fset.Position(doc.Pos()), "doc comment contains "+strings.Join(found, ", "))
+		}
+	}
+	for _, f := range pkg.GunkSyntax {
+		check(f.Doc)
+		ast.Inspect(f, func(n ast.Node) bool {
+			switch v := n.(type) {
+			case *ast.TypeSpec:
+				check(v.Doc)
+			case *ast.ValueSpec:
+				check(v.Doc)
+			case *ast.Field:
+				check(v.Doc)
+			}
+			return true
+		})
+	}
+	return errs
+}
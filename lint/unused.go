@@ -19,6 +19,9 @@ func lintUnused(l *Linter, pkgs []*loader.GunkPackage) {
 		addType := func(typ types.Type) {
 			// Mark the type as used.
 			for typ != nil {
+				usedDecl[typ.String()] = true
+				// Using an alias also uses the type it denotes.
+				typ = loader.Unalias(typ)
 				usedDecl[typ.String()] = true
 				parent, ok := typ.(containerType)
 				if !ok {
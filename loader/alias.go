@@ -0,0 +1,12 @@
+//go:build !go1.22
+// +build !go1.22
+
+package loader
+
+import "go/types"
+
+// Unalias returns typ with any type alias resolved to the type it denotes.
+// Before Go 1.22, go/types always resolves aliases by itself.
+func Unalias(typ types.Type) types.Type {
+	return typ
+}
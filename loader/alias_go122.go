@@ -0,0 +1,11 @@
+//go:build go1.22
+// +build go1.22
+
+package loader
+
+import "go/types"
+
+// Unalias returns typ with any type alias resolved to the type it denotes.
+func Unalias(typ types.Type) types.Type {
+	return types.Unalias(typ)
+}
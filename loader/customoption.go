@@ -0,0 +1,288 @@
+package loader
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/emicklei/proto"
+	"github.com/kenshaw/snaker"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// optionStructs maps the descriptor option messages which can be extended with
+// custom options to the names of the Gunk structs declaring them. See
+// extendableOptions in the generate package.
+var optionStructs = map[string]string{
+	"google.protobuf.FileOptions":      "FileOptions",
+	"google.protobuf.MessageOptions":   "MessageOptions",
+	"google.protobuf.FieldOptions":     "FieldOptions",
+	"google.protobuf.ServiceOptions":   "ServiceOptions",
+	"google.protobuf.MethodOptions":    "MethodOptions",
+	"google.protobuf.EnumOptions":      "EnumOptions",
+	"google.protobuf.EnumValueOptions": "EnumValueOptions",
+}
+
+// optionStruct returns the name of the Gunk struct declaring the custom
+// options extending the descriptor option message named by extendee, or "" if
+// it can't be extended in Gunk.
+func optionStruct(extendee string) string {
+	return optionStructs[strings.TrimPrefix(extendee, ".")]
+}
+
+// addImportedFiles records the files loaded for an import, and the files they
+// import, to resolve the custom options they declare.
+func (b *builder) addImportedFiles(files []*descriptorpb.FileDescriptorProto) {
+	if b.importedFiles == nil {
+		b.importedFiles = make(map[string]*descriptorpb.FileDescriptorProto)
+	}
+	for _, f := range files {
+		if _, ok := b.importedFiles[f.GetName()]; !ok {
+			b.importedFiles[f.GetName()] = f
+		}
+	}
+	b.registry = nil
+}
+
+// extensionRegistry returns the registry of the imported files, built with
+// protodesc, or nil if no imports were loaded.
+func (b *builder) extensionRegistry() (*protoregistry.Files, error) {
+	if b.registry != nil || len(b.importedFiles) == 0 {
+		return b.registry, nil
+	}
+	fset := &descriptorpb.FileDescriptorSet{}
+	for _, f := range b.importedFiles {
+		fset.File = append(fset.File, f)
+	}
+	files, err := protodesc.NewFiles(fset)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load imported files: %v", err)
+	}
+	b.registry = files
+	return files, nil
+}
+
+// customOptions splits the custom options declared in the imported files out
+// of options, returning them as "+gunk" tag expressions referencing the Gunk
+// packages of the imported files, such as:
+//
+//	annotations.FieldOptions{Sensitive: true}
+//
+// The options which aren't custom ones, or which can't be resolved, such as
+// when the imported files aren't loaded, are returned in rest.
+func (b *builder) customOptions(options []*proto.Option, extendee string) (tags []string, rest []*proto.Option, err error) {
+	for _, o := range options {
+		tag, err := b.customOption(o, extendee)
+		if err != nil {
+			return nil, nil, b.formatError(o.Position, "option %s: %v", o.Name, err)
+		}
+		if tag == "" {
+			rest = append(rest, o)
+			continue
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rest, nil
+}
+
+// customOption returns the "+gunk" tag expression of a custom option set on a
+// declaration whose options are the extendee message, or "" if it isn't a
+// custom option declared in the imported files.
+func (b *builder) customOption(o *proto.Option, extendee string) (string, error) {
+	// Custom options are named like (pkg.name), optionally followed by
+	// the path of the field being set, like (pkg.name).field.sub.
+	if !strings.HasPrefix(o.Name, "(") {
+		return "", nil
+	}
+	end := strings.Index(o.Name, ")")
+	if end < 0 {
+		return "", nil
+	}
+	name := strings.TrimPrefix(o.Name[1:end], ".")
+	var path []string
+	if sub := strings.TrimPrefix(o.Name[end+1:], "."); sub != "" {
+		path = strings.Split(sub, ".")
+	}
+	files, err := b.extensionRegistry()
+	if files == nil || err != nil {
+		return "", err
+	}
+	xd := b.findExtension(files, name)
+	if xd == nil {
+		return "", nil
+	}
+	if got := string(xd.ContainingMessage().FullName()); got != extendee {
+		return "", fmt.Errorf("%s extends %s, not %s", name, got, extendee)
+	}
+	structName := optionStruct(extendee)
+	if structName == "" {
+		return "", nil
+	}
+	value, err := b.optionValue(xd, path, &o.Constant)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s.%s{%s: %s}", b.gunkPackage(xd.ParentFile()), structName, optionFieldName(xd), value), nil
+}
+
+// findExtension looks up an extension by name, which is either fully
+// qualified or relative to the package being converted, like protoc does.
+func (b *builder) findExtension(files *protoregistry.Files, name string) protoreflect.ExtensionDescriptor {
+	candidates := []string{name}
+	if b.pkg != nil {
+		pkg := b.pkg.Name
+		for pkg != "" {
+			candidates = append([]string{pkg + "." + name}, candidates...)
+			i := strings.LastIndex(pkg, ".")
+			if i < 0 {
+				break
+			}
+			pkg = pkg[:i]
+		}
+	}
+	for _, c := range candidates {
+		d, err := files.FindDescriptorByName(protoreflect.FullName(c))
+		if err != nil {
+			continue
+		}
+		if xd, ok := d.(protoreflect.ExtensionDescriptor); ok {
+			return xd
+		}
+	}
+	return nil
+}
+
+// optionValue returns the Go expression of the literal value of a field. path
+// is the path of the subfield being set, if the literal only sets one.
+func (b *builder) optionValue(fd protoreflect.FieldDescriptor, path []string, lit *proto.Literal) (string, error) {
+	if len(path) > 0 {
+		if fd.Kind() != protoreflect.MessageKind || fd.IsList() {
+			return "", fmt.Errorf("%s is not a message", fd.Name())
+		}
+		sub := fd.Message().Fields().ByName(protoreflect.Name(path[0]))
+		if sub == nil {
+			return "", fmt.Errorf("unknown field %s in %s", path[0], fd.Message().FullName())
+		}
+		value, err := b.optionValue(sub, path[1:], lit)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s{%s: %s}", b.gunkType(fd.Message()), optionFieldName(sub), value), nil
+	}
+	if fd.IsMap() {
+		return "", fmt.Errorf("map field %s is not supported in custom options", fd.Name())
+	}
+	if fd.IsList() {
+		elems := lit.Array
+		if elems == nil {
+			elems = []*proto.Literal{lit}
+		}
+		var values []string
+		for _, elem := range elems {
+			value, err := b.singularOptionValue(fd, elem)
+			if err != nil {
+				return "", err
+			}
+			values = append(values, value)
+		}
+		return fmt.Sprintf("[]%s{%s}", b.gunkFieldType(fd), strings.Join(values, ", ")), nil
+	}
+	return b.singularOptionValue(fd, lit)
+}
+
+// singularOptionValue is like optionValue, for a single value of a field.
+func (b *builder) singularOptionValue(fd protoreflect.FieldDescriptor, lit *proto.Literal) (string, error) {
+	switch fd.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		md := fd.Message()
+		// Repeated fields may be set with repeated keys, as well as
+		// arrays, so their values are gathered first.
+		var order []string
+		values := make(map[string][]*proto.Literal)
+		for _, nl := range lit.OrderedMap {
+			if _, ok := values[nl.Name]; !ok {
+				order = append(order, nl.Name)
+			}
+			values[nl.Name] = append(values[nl.Name], nl.Literal)
+		}
+		var elts []string
+		for _, name := range order {
+			sub := md.Fields().ByName(protoreflect.Name(name))
+			if sub == nil {
+				return "", fmt.Errorf("unknown field %s in %s", name, md.FullName())
+			}
+			l := values[name][0]
+			if len(values[name]) > 1 {
+				l = &proto.Literal{Array: values[name]}
+			}
+			value, err := b.optionValue(sub, nil, l)
+			if err != nil {
+				return "", err
+			}
+			elts = append(elts, fmt.Sprintf("%s: %s", optionFieldName(sub), value))
+		}
+		return fmt.Sprintf("%s{%s}", b.gunkType(md), strings.Join(elts, ", ")), nil
+	case protoreflect.EnumKind:
+		ev := fd.Enum().Values().ByName(protoreflect.Name(lit.Source))
+		if ev == nil {
+			return "", fmt.Errorf("unknown value %s of %s", lit.Source, fd.Enum().FullName())
+		}
+		return b.gunkPackage(fd.Enum().ParentFile()) + "." + lit.Source, nil
+	case protoreflect.StringKind, protoreflect.BytesKind:
+		if !lit.IsString {
+			return "", fmt.Errorf("%s must be a string", fd.Name())
+		}
+		return strconv.Quote(lit.Source), nil
+	case protoreflect.BoolKind:
+		if lit.Source != "true" && lit.Source != "false" {
+			return "", fmt.Errorf("%s must be a bool", fd.Name())
+		}
+		return lit.Source, nil
+	}
+	if lit.IsString || lit.Array != nil || lit.OrderedMap != nil {
+		return "", fmt.Errorf("%s must be a number", fd.Name())
+	}
+	return lit.Source, nil
+}
+
+// gunkFieldType returns the Go type of the elements of a repeated field in a
+// Gunk struct.
+func (b *builder) gunkFieldType(fd protoreflect.FieldDescriptor) string {
+	switch fd.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return b.gunkType(fd.Message())
+	case protoreflect.EnumKind:
+		return b.gunkType(fd.Enum())
+	}
+	return b.goType(fd.Kind().String())
+}
+
+// gunkType returns the qualified Go type of a message or enum converted to
+// Gunk, such as pkg.Parent_Child for a nested message.
+func (b *builder) gunkType(d protoreflect.Descriptor) string {
+	pkg := string(d.ParentFile().Package())
+	name := strings.TrimPrefix(string(d.FullName()), pkg+".")
+	return b.gunkPackage(d.ParentFile()) + "." + strings.ReplaceAll(name, ".", "_")
+}
+
+// gunkPackage returns the name of the Gunk package of an imported file, as
+// imported in the file being converted, adding the import if needed.
+func (b *builder) gunkPackage(fd protoreflect.FileDescriptor) string {
+	path := ""
+	if opts, ok := fd.Options().(*descriptorpb.FileOptions); ok {
+		path = strings.SplitN(opts.GetGoPackage(), ";", 2)[0]
+	}
+	if named := b.importsUsed[path]; named != "" {
+		return named
+	}
+	return b.addImportUsed(path)
+}
+
+// optionFieldName returns the name of the Gunk struct field of a custom option
+// or of one of its fields, which are named like message fields.
+func optionFieldName(fd protoreflect.FieldDescriptor) string {
+	return snaker.ForceCamelIdentifier(string(fd.Name()))
+}
@@ -0,0 +1,110 @@
+package loader
+
+import (
+	"go/format"
+	"strings"
+	"testing"
+)
+
+func TestConvertCustomOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			"options",
+			`syntax = "proto3";
+
+package util;
+
+import "google/api/client.proto";
+import "google/api/field_behavior.proto";
+import "google/api/resource.proto";
+
+option (google.api.resource_definition) = {
+	type: "example.com/Org"
+	pattern: "orgs/{org}"
+};
+
+message User {
+	option (google.api.resource) = {
+		type: "example.com/User"
+		pattern: "users/{user}"
+		pattern: "orgs/{org}/users/{user}"
+	};
+	string name = 1 [(google.api.field_behavior) = REQUIRED];
+}
+
+service Users {
+	option (google.api.default_host) = "users.example.com";
+	rpc Get(User) returns (User) {
+		option (google.api.method_signature) = "name";
+	}
+}
+`,
+			`// +gunk google_api.FileOptions{ResourceDefinition: []google_api.ResourceDescriptor{google_api.ResourceDescriptor{Type: "example.com/Org", Pattern: []string{"orgs/{org}"}}}}
+package util
+
+import (
+	google_api "google.golang.org/genproto/googleapis/api/annotations"
+)
+
+// +gunk google_api.MessageOptions{Resource: google_api.ResourceDescriptor{Type: "example.com/User", Pattern: []string{"users/{user}", "orgs/{org}/users/{user}"}}}
+type User struct {
+	// +gunk google_api.FieldOptions{FieldBehavior: []google_api.FieldBehavior{google_api.REQUIRED}}
+	Name string ` + "`" + `pb:"1" json:"name"` + "`" + `
+}
+
+// +gunk google_api.ServiceOptions{DefaultHost: "users.example.com"}
+type Users interface {
+	// +gunk google_api.MethodOptions{MethodSignature: []string{"name"}}
+	Get(User) User
+}
+`,
+		},
+		{
+			"declarations",
+			`syntax = "proto3";
+
+package annotations;
+
+import "google/protobuf/descriptor.proto";
+
+extend google.protobuf.FieldOptions {
+	// sensitive marks a field as containing sensitive data.
+	bool sensitive = 50001;
+}
+
+extend google.protobuf.FieldOptions {
+	string label = 50002;
+}
+`,
+			`package annotations
+
+type FieldOptions struct {
+	// Sensitive marks a field as containing sensitive data.
+	Sensitive bool   ` + "`" + `pb:"50001" json:"sensitive"` + "`" + `
+	Label     string ` + "`" + `pb:"50002" json:"label"` + "`" + `
+}
+`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var w strings.Builder
+			// The imported files are bundled, so protoc isn't needed.
+			l := &ProtoLoader{ProtocPath: "protoc-not-installed"}
+			if err := ConvertFromProtoWithLoader(&w, strings.NewReader(test.src), "util.proto", l); err != nil {
+				t.Fatal(err)
+			}
+			got, err := format.Source([]byte(w.String()))
+			if err != nil {
+				t.Fatalf("%v:\n%s", err, w.String())
+			}
+			if string(got) != test.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package loader
+
+import (
+	"fmt"
+	"go/scanner"
+	"go/token"
+	"go/types"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// Error is an error found while loading a Gunk package. Unlike the
+// packages.Error values in GunkPackage.Errors, it keeps the position, package
+// and underlying error apart, so that tools embedding the loader can filter
+// and render diagnostics themselves.
+type Error struct {
+	// Kind is the kind of error, such as ParseError, TypeError or
+	// ValidateError.
+	Kind packages.ErrorKind
+	// Pos is the position of the error, which is invalid if unknown.
+	Pos token.Position
+	// Package is the import path of the package the error was found in.
+	Package string
+	// Err is the underlying error, such as a types.Error for type-checking
+	// errors.
+	Err error
+}
+
+// Error formats the error as "file:line:column: message", or with "-" as the
+// position if it is unknown.
+func (e *Error) Error() string {
+	return e.Pos.String() + ": " + e.msg()
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+func (e *Error) msg() string {
+	switch err := e.Err.(type) {
+	case packages.Error:
+		return err.Msg
+	case types.Error:
+		return err.Msg
+	case scanner.ErrorList:
+		if len(err) > 1 {
+			return fmt.Sprintf("%s (and %d more errors)", err[0].Msg, len(err)-1)
+		}
+		if len(err) == 1 {
+			return err[0].Msg
+		}
+	}
+	return e.Err.Error()
+}
+
+// Errors returns the errors of all packages in the import graph rooted at
+// pkgs, dependencies first, in the same order as PrintErrors prints them.
+func Errors(pkgs []*GunkPackage) []*Error {
+	var errs []*Error
+	Visit(pkgs, nil, func(pkg *GunkPackage) {
+		errs = append(errs, pkg.TypedErrors...)
+	})
+	return errs
+}
+
+// fromPackagesError returns the Error for an error reported by go/packages.
+func fromPackagesError(pkgPath string, err packages.Error) *Error {
+	return &Error{
+		Kind:    err.Kind,
+		Pos:     parsePosition(err.Pos),
+		Package: pkgPath,
+		Err:     err,
+	}
+}
+
+// parsePosition parses a position formatted as "file:line:column", where the
+// line and column are optional.
+func parsePosition(s string) token.Position {
+	var pos token.Position
+	if s == "" || s == "-" {
+		return pos
+	}
+	parts := strings.Split(s, ":")
+	var nums []int
+	for len(parts) > 1 && len(nums) < 2 {
+		n, err := strconv.Atoi(parts[len(parts)-1])
+		if err != nil {
+			break
+		}
+		nums = append([]int{n}, nums...)
+		parts = parts[:len(parts)-1]
+	}
+	pos.Filename = strings.Join(parts, ":")
+	if len(nums) > 0 {
+		pos.Line = nums[0]
+	}
+	if len(nums) > 1 {
+		pos.Column = nums[1]
+	}
+	return pos
+}
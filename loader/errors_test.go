@@ -0,0 +1,77 @@
+package loader
+
+import (
+	"errors"
+	"go/scanner"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/tools/go/packages"
+)
+
+func TestErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gunk-loader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"go.mod": "module testdata.tld/util\n",
+		"typed/typed.gunk": `package typed
+
+type Message struct {
+	A Missing ` + "`pb:\"1\"`" + `
+	B string  ` + "`pb:\"1\"`" + `
+}
+`,
+		"parse/parse.gunk": "package parse\n\ntype Message struct {\n",
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	l := &Loader{Dir: dir, Fset: token.NewFileSet(), Types: true}
+	pkgs, err := l.Load("./parse", "./typed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := Errors(pkgs)
+	if len(errs) != 3 {
+		t.Fatalf("got %d errors, want 3: %v", len(errs), errs)
+	}
+	for i, want := range []struct {
+		kind    packages.ErrorKind
+		pkgPath string
+		line    int
+	}{
+		{ParseError, "testdata.tld/util/parse", 3},
+		{TypeError, "testdata.tld/util/typed", 4},
+		{ValidateError, "testdata.tld/util/typed", 3},
+	} {
+		e := errs[i]
+		if e.Kind != want.kind || e.Package != want.pkgPath || e.Pos.Line != want.line {
+			t.Errorf("error %d: got kind %v in %s at line %d, want kind %v in %s at line %d",
+				i, e.Kind, e.Package, e.Pos.Line, want.kind, want.pkgPath, want.line)
+		}
+	}
+	var parseErr scanner.ErrorList
+	if !errors.As(errs[0], &parseErr) {
+		t.Errorf("parse error does not wrap a scanner.ErrorList: %T", errs[0].Err)
+	}
+	var typeErr types.Error
+	if !errors.As(errs[1], &typeErr) {
+		t.Errorf("type error does not wrap a types.Error: %T", errs[1].Err)
+	}
+	if got, want := errs[1].Error(), pkgs[1].Errors[0].Error(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,170 @@
+package loader
+
+import (
+	"strings"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/gunk/gunk/assets"
+)
+
+// GoogleapisPath is the import path prefix of the Go packages generated for
+// the googleapis common protos, such as google.rpc.Status. Their types can be
+// used in Gunk, as the protos are bundled with Gunk.
+const GoogleapisPath = "google.golang.org/genproto/googleapis/"
+
+// googleapisBundle holds the bundled googleapis common protos, along with the
+// files they import, by file name.
+var googleapisBundle struct {
+	once  sync.Once
+	files map[string]*descriptorpb.FileDescriptorProto
+	err   error
+}
+
+func loadGoogleapis() (map[string]*descriptorpb.FileDescriptorProto, error) {
+	b := &googleapisBundle
+	b.once.Do(func() {
+		buf, err := assets.ReadFile("googleapis.fdp")
+		if err != nil {
+			b.err = err
+			return
+		}
+		var fset descriptorpb.FileDescriptorSet
+		if err := proto.Unmarshal(buf, &fset); err != nil {
+			b.err = err
+			return
+		}
+		b.files = make(map[string]*descriptorpb.FileDescriptorProto, len(fset.File))
+		for _, f := range fset.File {
+			b.files[f.GetName()] = f
+		}
+	})
+	return b.files, b.err
+}
+
+// isGoogleapisFile reports whether a proto file is one of the bundled
+// googleapis common protos, such as google/api/resource.proto.
+func isGoogleapisFile(name string) bool {
+	if strings.HasPrefix(name, "google/protobuf/") {
+		// Imported by the googleapis protos, but bundled on their own.
+		return false
+	}
+	files, err := loadGoogleapis()
+	if err != nil {
+		return false
+	}
+	_, ok := files[name]
+	return ok
+}
+
+// isGoogleapisTypesFile reports whether a proto file is one of the bundled
+// googleapis common protos which declares types but no options, such as
+// google/type/money.proto. Like the well-known types, their Go packages are
+// imported when the types are used.
+func isGoogleapisTypesFile(name string) bool {
+	if !isGoogleapisFile(name) {
+		return false
+	}
+	files, _ := loadGoogleapis()
+	return len(files[name].Extension) == 0
+}
+
+// googleapisFiles returns the bundled googleapis common protos with the given
+// names, preceded by the files they import, each file once.
+func googleapisFiles(names []string) ([]*descriptorpb.FileDescriptorProto, error) {
+	files, err := loadGoogleapis()
+	if err != nil {
+		return nil, err
+	}
+	var list []*descriptorpb.FileDescriptorProto
+	seen := make(map[string]bool)
+	var add func(name string)
+	add = func(name string) {
+		f, ok := files[name]
+		if !ok || seen[name] {
+			return
+		}
+		seen[name] = true
+		for _, dep := range f.Dependency {
+			add(dep)
+		}
+		list = append(list, f)
+	}
+	for _, name := range names {
+		add(name)
+	}
+	return list, nil
+}
+
+// GoogleapisType returns the proto file and the fully qualified name, such as
+// ".google.rpc.Status", of the message or enum a type of the Go packages under
+// GoogleapisPath is generated from, and whether it is an enum. ok is false if
+// the type isn't declared in the bundled googleapis common protos.
+func GoogleapisType(pkgPath, name string) (file, fullName string, enum, ok bool) {
+	if !strings.HasPrefix(pkgPath, GoogleapisPath) {
+		return "", "", false, false
+	}
+	files, err := loadGoogleapis()
+	if err != nil {
+		return "", "", false, false
+	}
+	for _, f := range files {
+		goPkg := f.GetOptions().GetGoPackage()
+		if i := strings.Index(goPkg, ";"); i >= 0 {
+			goPkg = goPkg[:i]
+		}
+		if goPkg != pkgPath {
+			continue
+		}
+		// Only top level types are supported, as the Go names of
+		// nested ones are prefixed with their parents' names.
+		for _, m := range f.MessageType {
+			if m.GetName() == name {
+				return f.GetName(), "." + f.GetPackage() + "." + name, false, true
+			}
+		}
+		for _, e := range f.EnumType {
+			if e.GetName() == name {
+				return f.GetName(), "." + f.GetPackage() + "." + name, true, true
+			}
+		}
+	}
+	return "", "", false, false
+}
+
+// GoogleapisGoType returns the Go package and name of the type a message or
+// enum of the bundled googleapis common protos, such as google.rpc.Status, is
+// generated to. It is the reverse of GoogleapisType.
+func GoogleapisGoType(fullName string) (pkgPath, name string, ok bool) {
+	i := strings.LastIndex(fullName, ".")
+	if !strings.HasPrefix(fullName, "google.") || i < 0 {
+		return "", "", false
+	}
+	protoPkg, name := fullName[:i], fullName[i+1:]
+	files, err := loadGoogleapis()
+	if err != nil {
+		return "", "", false
+	}
+	for _, f := range files {
+		if f.GetPackage() != protoPkg || !isGoogleapisFile(f.GetName()) {
+			continue
+		}
+		pkgPath := f.GetOptions().GetGoPackage()
+		if i := strings.Index(pkgPath, ";"); i >= 0 {
+			pkgPath = pkgPath[:i]
+		}
+		for _, m := range f.MessageType {
+			if m.GetName() == name {
+				return pkgPath, name, true
+			}
+		}
+		for _, e := range f.EnumType {
+			if e.GetName() == name {
+				return pkgPath, name, true
+			}
+		}
+	}
+	return "", "", false
+}
@@ -0,0 +1,51 @@
+package loader
+
+import (
+	"testing"
+)
+
+func TestGoogleapisType(t *testing.T) {
+	for _, tc := range []struct {
+		pkg, name      string
+		file, fullName string
+		enum, ok       bool
+	}{
+		{"rpc/status", "Status", "google/rpc/status.proto", ".google.rpc.Status", false, true},
+		{"rpc/code", "Code", "google/rpc/code.proto", ".google.rpc.Code", true, true},
+		{"longrunning", "Operation", "google/longrunning/operations.proto", ".google.longrunning.Operation", false, true},
+		{"type/money", "Money", "google/type/money.proto", ".google.type.Money", false, true},
+		{"rpc/status", "Unknown", "", "", false, false},
+	} {
+		file, fullName, enum, ok := GoogleapisType(GoogleapisPath+tc.pkg, tc.name)
+		if file != tc.file || fullName != tc.fullName || enum != tc.enum || ok != tc.ok {
+			t.Errorf("%s.%s: got %q %q %v %v, want %q %q %v %v", tc.pkg, tc.name,
+				file, fullName, enum, ok, tc.file, tc.fullName, tc.enum, tc.ok)
+		}
+	}
+	if _, _, _, ok := GoogleapisType("example.com/rpc/status", "Status"); ok {
+		t.Errorf("got a googleapis type outside of %s", GoogleapisPath)
+	}
+}
+
+func TestLoadGoogleapis(t *testing.T) {
+	// The googleapis common protos are bundled, so that protoc isn't
+	// needed to load them.
+	l := &ProtoLoader{ProtocPath: "protoc-not-installed"}
+	files, err := l.LoadProto("google/api/resource.proto", "google/rpc/status.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The files imported by them are included too, before them.
+	got := make(map[string]int)
+	for i, f := range files {
+		got[f.GetName()] = i + 1
+	}
+	for _, name := range []string{"google/api/resource.proto", "google/rpc/status.proto", "google/protobuf/any.proto", "google/protobuf/descriptor.proto"} {
+		if got[name] == 0 {
+			t.Errorf("%s wasn't loaded", name)
+		}
+	}
+	if got["google/protobuf/any.proto"] > got["google/rpc/status.proto"] {
+		t.Errorf("google/rpc/status.proto was loaded before its imports")
+	}
+}
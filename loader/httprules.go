@@ -0,0 +1,64 @@
+package loader
+
+import (
+	"sort"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/api/annotations"
+)
+
+// HTTPRules are the HTTP rules of methods which are set apart from their proto
+// files, such as in a grpc-gateway grpc_api_configuration file, instead of
+// with google.api.http options.
+type HTTPRules struct {
+	// byMethod are the rules by the full name of their method, such as
+	// "foo.v1.FooService.GetFoo".
+	byMethod map[string]*annotations.HttpRule
+	used     map[string]bool
+}
+
+// NewHTTPRules returns the HTTP rules of the methods their selectors name.
+// Rules selecting the same method are added to its first rule as additional
+// bindings.
+func NewHTTPRules(rules []*annotations.HttpRule) *HTTPRules {
+	r := &HTTPRules{
+		byMethod: make(map[string]*annotations.HttpRule),
+		used:     make(map[string]bool),
+	}
+	for _, rule := range rules {
+		method := strings.TrimPrefix(rule.GetSelector(), ".")
+		if first := r.byMethod[method]; first != nil {
+			first.AdditionalBindings = append(first.AdditionalBindings, rule)
+			continue
+		}
+		r.byMethod[method] = rule
+	}
+	return r
+}
+
+// bindings returns the rule of a method along with its additional bindings,
+// or nil if it has none.
+func (r *HTTPRules) bindings(method string) []*annotations.HttpRule {
+	if r == nil {
+		return nil
+	}
+	rule := r.byMethod[method]
+	if rule == nil {
+		return nil
+	}
+	r.used[method] = true
+	return append([]*annotations.HttpRule{rule}, rule.GetAdditionalBindings()...)
+}
+
+// Unused returns the sorted selectors of the rules which didn't match any of
+// the methods converted so far.
+func (r *HTTPRules) Unused() []string {
+	var unused []string
+	for method := range r.byMethod {
+		if !r.used[method] {
+			unused = append(unused, method)
+		}
+	}
+	sort.Strings(unused)
+	return unused
+}
@@ -0,0 +1,86 @@
+package loader
+
+import (
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/types"
+	"strings"
+)
+
+// The JSON encodings of 64-bit integers. The protobuf JSON mapping encodes
+// them as strings, since JavaScript numbers can't hold all of their values,
+// but some clients expect numbers.
+const (
+	Int64String = "string"
+	Int64Number = "number"
+)
+
+// Int64Encoding returns the JSON encoding annotated in the documentation
+// text with a line such as:
+//
+//	JSON-Int64: number
+//
+// or "" if there is none.
+func Int64Encoding(text string) (string, error) {
+	var enc string
+	for _, line := range strings.Split(text, "\n") {
+		if !strings.HasPrefix(line, "JSON-Int64:") {
+			continue
+		}
+		enc = strings.TrimSpace(strings.TrimPrefix(line, "JSON-Int64:"))
+		if enc != Int64String && enc != Int64Number {
+			return "", fmt.Errorf("invalid JSON-Int64 annotation %q, must be %s or %s", enc, Int64String, Int64Number)
+		}
+	}
+	return enc, nil
+}
+
+// FieldInt64Encoding returns the JSON encoding of a 64-bit integer field of
+// the package, as set by its js.Type option, its JSON-Int64 annotation or the
+// JSON-Int64 annotation of the package clause, in that order. It returns ""
+// for other fields, and when the encoding isn't set.
+func (pkg *GunkPackage) FieldInt64Encoding(field *ast.Field) (string, error) {
+	enc, err := Int64Encoding(field.Doc.Text())
+	if err != nil {
+		return "", err
+	}
+	if !is64BitInt(pkg.TypesInfo.TypeOf(field.Type)) {
+		if enc != "" {
+			return "", fmt.Errorf("JSON-Int64 annotation on a field which isn't a 64-bit integer")
+		}
+		return "", nil
+	}
+	for _, tag := range pkg.GunkTags[field] {
+		if tag.Type.String() != "github.com/gunk/opt/field/js.Type" {
+			continue
+		}
+		// The values of descriptorpb.FieldOptions_JSType.
+		switch v, _ := constant.Int64Val(tag.Value); v {
+		case 1:
+			return Int64String, nil
+		case 2:
+			return Int64Number, nil
+		}
+	}
+	if enc != "" {
+		return enc, nil
+	}
+	for _, file := range pkg.GunkSyntax {
+		if enc, err := Int64Encoding(file.Doc.Text()); enc != "" || err != nil {
+			return enc, err
+		}
+	}
+	return "", nil
+}
+
+// is64BitInt reports whether typ is a 64-bit integer, or a slice of them.
+// Named types, which are enums, are not.
+func is64BitInt(typ types.Type) bool {
+	typ = Unalias(typ)
+	if s, ok := typ.(*types.Slice); ok {
+		typ = Unalias(s.Elem())
+	}
+	b, ok := typ.(*types.Basic)
+	return ok && (b.Kind() == types.Int64 || b.Kind() == types.Uint64)
+}
@@ -19,7 +19,9 @@ import (
 
 	"github.com/gunk/gunk/assets"
 	"github.com/gunk/gunk/log"
+	"github.com/gunk/gunk/stats"
 	"golang.org/x/tools/go/packages"
+	"google.golang.org/genproto/googleapis/api/annotations"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/descriptorpb"
 )
@@ -31,6 +33,11 @@ type Loader struct {
 	// transitive dependencies, including gunk tags. Otherwise, we only
 	// parse the given packages.
 	Types bool
+	// If Local is true, only the Gunk package in Dir and the packages it
+	// imports, directly or indirectly, can be loaded. This avoids walking
+	// the whole module and its dependencies for Gunk packages, which makes
+	// loading a single package much faster.
+	Local bool
 	cache map[string]*GunkPackage // map from import path to pkg
 
 	stack []string
@@ -40,6 +47,13 @@ type Loader struct {
 	fakeFiles map[string][]byte
 }
 
+// ForgetPackages drops the loader's references to the packages it loaded, so
+// that they can be garbage collected once their users drop them too. Loading
+// them again parses and type-checks them again.
+func (l *Loader) ForgetPackages() {
+	l.cache = nil
+}
+
 // addFakeFiles iterate over all module dependencies of the specified directory
 // and adds a fake Go file for all directories inside the dependencies that
 // only has Gunk files and no Go files.
@@ -68,44 +82,115 @@ func (l *Loader) addFakeFiles() error {
 			if !info.IsDir() {
 				return nil
 			}
-			infos, err := ioutil.ReadDir(path)
+			return l.addFakeFile(path)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addFakeFile adds a fake Go file for the directory at path if it only has
+// Gunk files and no Go files.
+func (l *Loader) addFakeFile(path string) error {
+	infos, err := ioutil.ReadDir(path)
+	if err != nil {
+		return err
+	}
+	pkgName := filepath.Base(path) // default to the directory basename
+	anyGunk := false
+	for _, info := range infos {
+		name := info.Name()
+		if strings.HasSuffix(name, ".go") {
+			// has Go files; nothing to do
+			return nil
+		}
+		if strings.HasSuffix(name, ".gunk") {
+			f, err := parser.ParseFile(token.NewFileSet(),
+				filepath.Join(path, name), nil, parser.PackageClauseOnly)
+			// Ignore errors, since Gunk packages being
+			// walked but not being loaded might have
+			// invalid syntax.
+			if err == nil {
+				pkgName = f.Name.Name
+			}
+			anyGunk = true
+			break
+		}
+	}
+	if !anyGunk {
+		return nil
+	}
+	tmpPath := filepath.Join(path, "gunkpkg.go")
+	l.fakeFiles[tmpPath] = []byte(`package ` + pkgName)
+	return nil
+}
+
+// addLocalFakeFiles adds fake Go files for the Gunk package in the loader's
+// directory and the Gunk packages it imports, directly or indirectly. The
+// directories of the imports are found from the module paths instead of
+// walking all modules.
+func (l *Loader) addLocalFakeFiles() error {
+	l.fakeFiles = make(map[string][]byte)
+	dir, err := filepath.Abs(l.Dir)
+	if err != nil {
+		return err
+	}
+	// Map the module paths to their directories.
+	modDirs := make(map[string]string)
+	cmd := exec.Command("go", "list", "-m", "-f={{.Path}} {{.Dir}}", "all")
+	cmd.Dir = l.Dir
+	if out, err := cmd.Output(); err == nil {
+		for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+			if fields := strings.SplitN(line, " ", 2); len(fields) == 2 && fields[1] != "" {
+				modDirs[fields[0]] = strings.TrimSpace(fields[1])
+			}
+		}
+	}
+	seen := map[string]bool{dir: true}
+	dirs := []string{dir}
+	for len(dirs) > 0 {
+		dir := dirs[len(dirs)-1]
+		dirs = dirs[:len(dirs)-1]
+		if err := l.addFakeFile(dir); err != nil {
+			return err
+		}
+		gunkFiles, err := filepath.Glob(filepath.Join(dir, "*.gunk"))
+		if err != nil {
+			return err
+		}
+		for _, name := range gunkFiles {
+			f, err := parser.ParseFile(token.NewFileSet(), name, nil, parser.ImportsOnly)
 			if err != nil {
-				return err
+				// Reported when the package is loaded.
+				continue
 			}
-			pkgName := info.Name() // default to the directory basename
-			anyGunk := false
-			for _, info := range infos {
-				name := info.Name()
-				if strings.HasSuffix(name, ".go") {
-					// has Go files; nothing to do
-					return nil
-				}
-				if strings.HasSuffix(name, ".gunk") {
-					f, err := parser.ParseFile(token.NewFileSet(),
-						filepath.Join(path, name), nil, parser.PackageClauseOnly)
-					// Ignore errors, since Gunk packages being
-					// walked but not being loaded might have
-					// invalid syntax.
-					if err == nil {
-						pkgName = f.Name.Name
-					}
-					anyGunk = true
-					break
+			for _, imp := range f.Imports {
+				path, _ := strconv.Unquote(imp.Path.Value)
+				if dir := importDir(modDirs, path); dir != "" && !seen[dir] {
+					seen[dir] = true
+					dirs = append(dirs, dir)
 				}
 			}
-			if !anyGunk {
-				return nil
-			}
-			tmpPath := filepath.Join(path, "gunkpkg.go")
-			l.fakeFiles[tmpPath] = []byte(`package ` + pkgName)
-			return nil
-		}); err != nil {
-			return err
 		}
 	}
 	return nil
 }
 
+// importDir returns the directory of the package with the import path, in the
+// module with the longest matching path, or "" if there is none, such as for
+// standard library packages.
+func importDir(modDirs map[string]string, path string) string {
+	for prefix := path; ; prefix = filepath.ToSlash(filepath.Dir(prefix)) {
+		if dir, ok := modDirs[prefix]; ok {
+			return filepath.Join(dir, filepath.FromSlash(strings.TrimPrefix(path, prefix)))
+		}
+		if !strings.Contains(prefix, "/") {
+			return ""
+		}
+	}
+}
+
 // Load loads the Gunk packages on the provided patterns from the given dir and
 // using the given fileset.
 //
@@ -145,8 +230,11 @@ func (l *Loader) Load(patterns ...string) ([]*GunkPackage, error) {
 	} else {
 		// Generate fake files if it has not been initialized yet.
 		if l.fakeFiles == nil {
-			err := l.addFakeFiles()
-			if err != nil {
+			addFakeFiles := l.addFakeFiles
+			if l.Local {
+				addFakeFiles = l.addLocalFakeFiles
+			}
+			if err := addFakeFiles(); err != nil {
 				return nil, err
 			}
 		}
@@ -162,6 +250,9 @@ func (l *Loader) Load(patterns ...string) ([]*GunkPackage, error) {
 		}
 		for _, lpkg := range lpkgs {
 			pkg := &GunkPackage{Package: *lpkg}
+			for _, err := range lpkg.Errors {
+				pkg.TypedErrors = append(pkg.TypedErrors, fromPackagesError(pkg.PkgPath, err))
+			}
 			findGunkFiles(pkg)
 			if len(pkg.GunkFiles) == 0 && len(pkg.Errors) == 0 {
 				// Not a Gunk package. Skip.
@@ -191,6 +282,7 @@ func (l *Loader) Load(patterns ...string) ([]*GunkPackage, error) {
 		}
 		l.cache[pkg.PkgPath] = pkg
 	}
+	stats.AddPackages(len(pkgs))
 	return pkgs, nil
 }
 
@@ -230,6 +322,14 @@ const (
 	ValidateError = packages.TypeError + 10 + iota
 )
 
+// wellKnownTypesPath is the import path prefix of the Go packages which contain
+// the well-known protobuf types, such as google.protobuf.Any.
+const wellKnownTypesPath = "google.golang.org/protobuf/types/known/"
+
+// UUIDPath is the import path of the Go package declaring the UUID type,
+// which is a string field holding a UUID.
+const UUIDPath = "github.com/google/uuid"
+
 // Import satisfies the go/types.Importer interface.
 //
 // Unlike standard Go ones like go/importer and x/tools/go/packages, this one is
@@ -238,8 +338,12 @@ const (
 // Aside from that, it is very similar to standard Go importers that load from
 // source.
 func (l *Loader) Import(path string) (*types.Package, error) {
-	if !strings.Contains(path, ".") {
-		cfg := &packages.Config{Mode: packages.LoadTypes}
+	if !strings.Contains(path, ".") || strings.HasPrefix(path, wellKnownTypesPath) ||
+		strings.HasPrefix(path, GoogleapisPath) || path == UUIDPath {
+		// Standard library packages, and the Go packages of the
+		// well-known protobuf types, of the googleapis common protos
+		// and of UUIDs, are loaded as Go packages.
+		cfg := &packages.Config{Dir: l.Dir, Mode: packages.LoadTypes}
 		pkgs, err := packages.Load(cfg, path)
 		if err != nil {
 			return nil, err
@@ -247,6 +351,9 @@ func (l *Loader) Import(path string) (*types.Package, error) {
 		if len(pkgs) != 1 {
 			panic("expected go/packages.Load to return exactly one package")
 		}
+		if errs := pkgs[0].Errors; len(errs) > 0 {
+			return nil, errs[0]
+		}
 		return pkgs[0].Types, nil
 	}
 	pkgs, err := l.Load(path)
@@ -280,6 +387,9 @@ type GunkPackage struct {
 	GunkTags  map[ast.Node][]GunkTag
 	Imports   map[string]*GunkPackage
 	ProtoName string // protobuf package name
+	// TypedErrors holds the errors in Errors as *Error values, which keep
+	// their underlying errors.
+	TypedErrors []*Error
 }
 
 func (g *GunkPackage) errorf(kind packages.ErrorKind, tokenPos token.Pos, fset *token.FileSet, format string, args ...interface{}) {
@@ -291,18 +401,27 @@ func (g *GunkPackage) addError(kind packages.ErrorKind, tokenPos token.Pos, fset
 	if pkgErr, ok := err.(packages.Error); ok {
 		// Don't unnecessarily wrap the error if it is already the right type.
 		g.Errors = append(g.Errors, pkgErr)
+		g.TypedErrors = append(g.TypedErrors, fromPackagesError(g.PkgPath, pkgErr))
 		return
 	}
 	// Create a packages.Error to add.
+	typed := &Error{Kind: kind, Package: g.PkgPath, Err: err}
 	pos := ""
 	msg := err.Error()
 	if tokenPos > 0 && fset != nil {
-		pos = fset.Position(tokenPos).String()
+		typed.Pos = fset.Position(tokenPos)
+		pos = typed.Pos.String()
+	}
+	if list, ok := err.(scanner.ErrorList); ok && len(list) > 0 {
+		// Keep the position of parse errors apart, although the
+		// message already includes it.
+		typed.Pos = list[0].Pos
 	}
 	if typeErr, ok := err.(types.Error); ok {
 		// Populate info if the error is a type-checking error from go/types.
 		// This prevents an unnecessary -: at the front of error messages.
-		pos = typeErr.Fset.Position(typeErr.Pos).String()
+		typed.Pos = typeErr.Fset.Position(typeErr.Pos)
+		pos = typed.Pos.String()
 		msg = typeErr.Msg
 	}
 	g.Errors = append(g.Errors, packages.Error{
@@ -310,6 +429,7 @@ func (g *GunkPackage) addError(kind packages.ErrorKind, tokenPos token.Pos, fset
 		Msg:  msg,
 		Kind: kind,
 	})
+	g.TypedErrors = append(g.TypedErrors, typed)
 }
 
 type GunkTag struct {
@@ -326,7 +446,9 @@ func (l *Loader) parseGunkPackage(pkg *GunkPackage) {
 	pkg.Name = ""
 	// parse the gunk files
 	for _, fpath := range pkg.GunkFiles {
-		file, err := parser.ParseFile(l.Fset, fpath, nil, parser.ParseComments)
+		// Identifiers are resolved by go/types, so skip the parser's
+		// object resolution, which allocates a lot for large packages.
+		file, err := parser.ParseFile(l.Fset, fpath, nil, parser.ParseComments|parser.SkipObjectResolution)
 		if err != nil {
 			pkg.addError(ParseError, 0, nil, err)
 			continue
@@ -349,7 +471,7 @@ func (l *Loader) parseGunkPackage(pkg *GunkPackage) {
 		}
 		if pkg.ProtoName == "" {
 			pkg.ProtoName = name
-		} else if name != "" && l.Types {
+		} else if name != "" && name != pkg.ProtoName && l.Types {
 			pkg.errorf(ValidateError, 0, nil, "proto package name mismatch: %q %q",
 				pkg.ProtoName, name)
 			continue
@@ -370,13 +492,12 @@ func (l *Loader) parseGunkPackage(pkg *GunkPackage) {
 		DisableUnusedImportCheck: true,
 		Importer:                 l,
 	}
+	// Only record the type information which is used, as it's kept for as
+	// long as the package is.
 	pkg.TypesInfo = &types.Info{
-		Types:      make(map[ast.Expr]types.TypeAndValue),
-		Defs:       make(map[*ast.Ident]types.Object),
-		Uses:       make(map[*ast.Ident]types.Object),
-		Implicits:  make(map[ast.Node]types.Object),
-		Scopes:     make(map[ast.Node]*types.Scope),
-		Selections: make(map[*ast.SelectorExpr]*types.Selection),
+		Types: make(map[ast.Expr]types.TypeAndValue),
+		Defs:  make(map[*ast.Ident]types.Object),
+		Uses:  make(map[*ast.Ident]types.Object),
 	}
 	check := types.NewChecker(tconfig, l.Fset, pkg.Types, pkg.TypesInfo)
 	if err := check.Files(pkg.GunkSyntax); err != nil {
@@ -386,6 +507,7 @@ func (l *Loader) parseGunkPackage(pkg *GunkPackage) {
 	pkg.Imports = make(map[string]*GunkPackage)
 	for _, file := range pkg.GunkSyntax {
 		l.splitGunkTags(pkg, file)
+		l.validateStability(pkg, file)
 		for _, spec := range file.Imports {
 			// we can't error, since the file parsed correctly
 			pkgPath, _ := strconv.Unquote(spec.Path.Value)
@@ -405,6 +527,20 @@ func (l *Loader) parseGunkPackage(pkg *GunkPackage) {
 // shared among all gunk commands.
 func (l *Loader) validatePackage(pkg *GunkPackage) {
 	for _, file := range pkg.GunkSyntax {
+		l.validateConstructs(pkg, file)
+		// Variables can only be used to declare option presets.
+		for _, decl := range file.Decls {
+			gd, ok := decl.(*ast.GenDecl)
+			if !ok || gd.Tok != token.VAR {
+				continue
+			}
+			for _, spec := range gd.Specs {
+				vs := spec.(*ast.ValueSpec)
+				if len(vs.Names) != 1 || len(vs.Values) != 1 || !isPreset(vs.Values[0]) {
+					pkg.errorf(ValidateError, vs.Pos(), l.Fset, "variables must be option presets of type []interface{}")
+				}
+			}
+		}
 		ast.Inspect(file, func(node ast.Node) bool {
 			st, ok := node.(*ast.StructType)
 			if !ok || st.Fields == nil {
@@ -491,12 +627,77 @@ allComments:
 	return "", nil
 }
 
+// bundledFiles are the proto files bundled with Gunk, other than the
+// googleapis common protos, by the asset holding their descriptors.
+var bundledFiles = map[string]string{
+	"google/protobuf/empty.proto":                    "google_protobuf_empty.fdp",
+	"google/protobuf/timestamp.proto":                "google_protobuf_timestamp.fdp",
+	"google/protobuf/duration.proto":                 "google_protobuf_duration.fdp",
+	"google/protobuf/descriptor.proto":               "google_protobuf_descriptor.fdp",
+	"google/protobuf/any.proto":                      "google_protobuf_any.fdp",
+	"google/protobuf/struct.proto":                   "google_protobuf_struct.fdp",
+	"google/protobuf/field_mask.proto":               "google_protobuf_field_mask.fdp",
+	"google/protobuf/wrappers.proto":                 "google_protobuf_wrappers.fdp",
+	"gunk/cache.proto":                               "gunk_cache.fdp",
+	"gunk/access.proto":                              "gunk_access.fdp",
+	"gunk/serviceconfig.proto":                       "gunk_serviceconfig.fdp",
+	"protoc-gen-openapiv2/options/annotations.proto": "protoc-gen-openapiv2_options_annotations.fdp",
+}
+
+// IsBundledProto reports whether the proto file is bundled with Gunk, such as
+// google/protobuf/timestamp.proto, so that it can be imported without being
+// converted or loaded with protoc.
+func IsBundledProto(name string) bool {
+	_, ok := bundledFiles[name]
+	return ok || wellKnownFiles[name] || optionFiles[name] || isGoogleapisFile(name)
+}
+
 type ProtoLoader struct {
 	// Dir is the absolute path from where the LoadProto method
 	// will load proto files.
 	// If empty, it will load from executing directory
 	Dir        string
 	ProtocPath string
+	// IncludePaths are additional directories where protoc will search for
+	// imported proto files, in order.
+	IncludePaths []string
+	// Converted are the Gunk packages of the proto files converted
+	// together, such as by gunk convert -r, by file name as imported.
+	// Imports of these files refer to their Gunk packages instead of
+	// being loaded with protoc.
+	Converted map[string]*ConvertedPackage
+	// HTTPRules are the HTTP rules of the methods converted which aren't
+	// set in their proto files. They are converted to http.Match tags,
+	// after those of any google.api.http options.
+	HTTPRules *HTTPRules
+}
+
+// ConvertedPackage is the Gunk package a proto file is converted to.
+type ConvertedPackage struct {
+	// Path is the import path of the Gunk package.
+	Path string
+	// Name is the Go package name of the Gunk package.
+	Name string
+	// ProtoPackage is the proto package declared by the file.
+	ProtoPackage string
+}
+
+// converted returns the Gunk package the proto file is converted to, or nil
+// if it isn't converted along with the file being converted.
+func (l *ProtoLoader) converted(name string) *ConvertedPackage {
+	if l == nil {
+		return nil
+	}
+	return l.Converted[name]
+}
+
+// httpBindings returns the HTTP rules of a method set apart from its proto
+// file, if any.
+func (l *ProtoLoader) httpBindings(method string) []*annotations.HttpRule {
+	if l == nil {
+		return nil
+	}
+	return l.HTTPRules.bindings(method)
 }
 
 // LoadProto loads the specified protobuf packages as if they were dependencies.
@@ -512,26 +713,23 @@ syntax = "proto3";
 `))
 	// Imports to load from in-memory
 	generatedFilesToLoad := []string{}
+	// Imports to load from the bundled googleapis common protos
+	googleapisNames := []string{}
 	// Imports to load using protoc
 	filteredNames := make([]string, 0, len(names))
 	// Check to see if we are trying to load any libraries that we have
 	// bundled with Gunk. If so, load the generated libraries. If not, use
 	// protoc to load those libraries from disk.
 	for _, n := range names {
-		switch n {
-		case "google/api/annotations.proto":
-			generatedFilesToLoad = append(generatedFilesToLoad, "google_api_annotations.fdp")
-		case "google/protobuf/empty.proto":
-			generatedFilesToLoad = append(generatedFilesToLoad, "google_protobuf_empty.fdp")
-		case "google/protobuf/timestamp.proto":
-			generatedFilesToLoad = append(generatedFilesToLoad, "google_protobuf_timestamp.fdp")
-		case "google/protobuf/duration.proto":
-			generatedFilesToLoad = append(generatedFilesToLoad, "google_protobuf_duration.fdp")
-		case "protoc-gen-openapiv2/options/annotations.proto":
-			generatedFilesToLoad = append(generatedFilesToLoad, "protoc-gen-openapiv2_options_annotations.fdp")
-		default:
-			filteredNames = append(filteredNames, n)
+		if asset, ok := bundledFiles[n]; ok {
+			generatedFilesToLoad = append(generatedFilesToLoad, asset)
+			continue
 		}
+		if isGoogleapisFile(n) {
+			googleapisNames = append(googleapisNames, n)
+			continue
+		}
+		filteredNames = append(filteredNames, n)
 	}
 	var combinedFset descriptorpb.FileDescriptorSet
 	// Use protoc to load any imports that aren't currently bundles with
@@ -561,6 +759,13 @@ syntax = "proto3";
 		}
 		if l.Dir != "" {
 			args = append(args, "-I"+l.Dir)
+		} else if len(l.IncludePaths) > 0 {
+			// protoc only defaults to the current directory when no
+			// -I flags are given, and it needs it to find gunk-proto.
+			args = append(args, "-I.")
+		}
+		for _, p := range l.IncludePaths {
+			args = append(args, "-I"+p)
 		}
 		protocPath := "protoc"
 		if l.ProtocPath != "" {
@@ -597,6 +802,13 @@ syntax = "proto3";
 		}
 		combinedFset.File = append(combinedFset.File, fset.File...)
 	}
+	if len(googleapisNames) > 0 {
+		files, err := googleapisFiles(googleapisNames)
+		if err != nil {
+			return nil, err
+		}
+		combinedFset.File = append(combinedFset.File, files...)
+	}
 	return combinedFset.File, nil
 }
 
@@ -607,7 +819,8 @@ func (l *Loader) splitGunkTags(pkg *GunkPackage, file *ast.File) {
 	hadError := false
 	ast.Inspect(file, func(node ast.Node) bool {
 		if gd, ok := node.(*ast.GenDecl); ok {
-			if len(gd.Specs) != 1 {
+			if len(gd.Specs) != 1 || gd.Lparen.IsValid() {
+				// Specs in a group have their own docs.
 				return true
 			}
 			if doc := nodeDoc(gd.Specs[0]); doc != nil {
@@ -622,6 +835,9 @@ func (l *Loader) splitGunkTags(pkg *GunkPackage, file *ast.File) {
 			return true
 		}
 		docText, exprs, err := SplitGunkTag(pkg, l.Fset, *doc)
+		if err == nil {
+			exprs, err = l.expandPresets(pkg, exprs)
+		}
 		if err != nil {
 			hadError = true
 			pkg.addError(ParseError, (*doc).Pos(), l.Fset, err)
@@ -716,19 +932,25 @@ func SplitGunkTag(pkg *GunkPackage, fset *token.FileSet, comment *ast.CommentGro
 	}
 	var tags []GunkTag
 	for i, gunkTag := range gunkTagLines {
+		tagPos := fset.Position(comment.Pos())
+		tagPos.Line += gunkTagPos[i] // relative to the "+gunk" line
+		tagPos.Column += len("// ")  // .Text() stripped these prefixes
 		expr, err := parser.ParseExprFrom(fset, "", gunkTag, 0)
 		if err != nil {
-			tagPos := fset.Position(comment.Pos())
-			tagPos.Line += gunkTagPos[i] // relative to the "+gunk" line
-			tagPos.Column += len("// ")  // .Text() stripped these prefixes
 			return "", nil, ErrorAbsolutePos(err, tagPos)
 		}
 		tag := GunkTag{Expr: expr}
 		if pkg != nil {
-			tv, err := types.Eval(fset, pkg.Types, comment.Pos(), gunkTag)
-			if err != nil {
-				return "", nil, err
+			// Record the types of the whole expression in the
+			// package's type information, so that the values in
+			// composite literals can be inspected later.
+			if err := types.CheckExpr(fset, pkg.Types, comment.Pos(), expr, pkg.TypesInfo); err != nil {
+				if terr, ok := err.(types.Error); ok {
+					err = scanner.ErrorList{{Pos: fset.Position(terr.Pos), Msg: terr.Msg}}
+				}
+				return "", nil, ErrorAbsolutePos(err, tagPos)
 			}
+			tv := pkg.TypesInfo.Types[expr]
 			tag.Type, tag.Value = tv.Type, tv.Value
 		}
 		tags = append(tags, tag)
@@ -0,0 +1,100 @@
+package loader
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"strings"
+)
+
+// NestedParent returns the name of the message a message or enum is nested
+// in, as annotated in its documentation with a line such as:
+//
+//	Nested: Event
+//
+// or "" if it isn't nested. The type must be named after its parent, such as
+// Event_Source, like in the Go code generated for nested protobuf types; its
+// protobuf name is the rest of its name, such as Source.
+func NestedParent(text string) string {
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(line, "Nested:") {
+			return strings.TrimSpace(strings.TrimPrefix(line, "Nested:"))
+		}
+	}
+	return ""
+}
+
+// NestedNames returns the protobuf names of the nested types declared in the
+// files, relative to their package, by type name. For example, Event_Source
+// nested in Event is named Event.Source, and Event_Source_Content nested in
+// Event_Source is named Event.Source.Content.
+//
+// Nested types must be declared in the same file as their parent, which must
+// be a message.
+func NestedNames(fset *token.FileSet, files []*ast.File) (map[string]string, error) {
+	type typeDecl struct {
+		spec   *ast.TypeSpec
+		file   *ast.File
+		parent string
+	}
+	decls := make(map[string]typeDecl)
+	var nested []typeDecl
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			gd, ok := decl.(*ast.GenDecl)
+			if !ok || gd.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gd.Specs {
+				ts := spec.(*ast.TypeSpec)
+				doc := ts.Doc
+				if doc == nil && !gd.Lparen.IsValid() {
+					doc = gd.Doc
+				}
+				d := typeDecl{ts, file, NestedParent(doc.Text())}
+				decls[ts.Name.Name] = d
+				if d.parent != "" {
+					nested = append(nested, d)
+				}
+			}
+		}
+	}
+	parents := make(map[string]string)
+	for _, d := range nested {
+		name, parent := d.spec.Name.Name, d.parent
+		pos := fset.Position(d.spec.Pos())
+		if !strings.HasPrefix(name, parent+"_") || len(name) == len(parent)+1 {
+			return nil, fmt.Errorf("%s: nested type %s must be named like %s_Name", pos, name, parent)
+		}
+		switch d.spec.Type.(type) {
+		case *ast.StructType, *ast.Ident:
+		default:
+			return nil, fmt.Errorf("%s: only messages and enums can be nested", pos)
+		}
+		p, ok := decls[parent]
+		if !ok {
+			return nil, fmt.Errorf("%s: %s is nested in undeclared message %s", pos, name, parent)
+		}
+		if _, ok := p.spec.Type.(*ast.StructType); !ok {
+			return nil, fmt.Errorf("%s: %s is nested in %s, which isn't a message", pos, name, parent)
+		}
+		if p.file != d.file {
+			return nil, fmt.Errorf("%s: %s must be declared in the same file as %s", pos, name, parent)
+		}
+		parents[name] = parent
+	}
+	names := make(map[string]string, len(parents))
+	var protoName func(name string) string
+	protoName = func(name string) string {
+		parent, ok := parents[name]
+		if !ok {
+			return name
+		}
+		// Parent names are shorter, so this always ends.
+		return protoName(parent) + "." + strings.TrimPrefix(name, parent+"_")
+	}
+	for name := range parents {
+		names[name] = protoName(name)
+	}
+	return names, nil
+}
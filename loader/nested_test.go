@@ -0,0 +1,61 @@
+package loader
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"testing"
+)
+
+func TestNestedNames(t *testing.T) {
+	tests := []struct {
+		src     string
+		want    map[string]string
+		wantErr bool
+	}{
+		{"type Event struct{}", map[string]string{}, false},
+		{
+			`
+type Event struct{}
+
+// Nested: Event
+type Event_Source struct{}
+
+// Nested: Event_Source
+type Event_Source_Content struct{}
+
+// The kind of an event.
+//
+// Nested: Event
+type Event_Kind int
+`,
+			map[string]string{
+				"Event_Source":         "Event.Source",
+				"Event_Source_Content": "Event.Source.Content",
+				"Event_Kind":           "Event.Kind",
+			},
+			false,
+		},
+		{"type Event struct{}\n// Nested: Event\ntype Source struct{}", nil, true},
+		{"type Event struct{}\n// Nested: Event\ntype Event_ struct{}", nil, true},
+		{"// Nested: Event\ntype Event_Source struct{}", nil, true},
+		{"type Event int\n// Nested: Event\ntype Event_Source struct{}", nil, true},
+		{"type Event struct{}\n// Nested: Event\ntype Event_Service interface{}", nil, true},
+	}
+	for _, test := range tests {
+		fset := token.NewFileSet()
+		file, err := parser.ParseFile(fset, "util.gunk", "package util\n"+test.src, parser.ParseComments)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := NestedNames(fset, []*ast.File{file})
+		if (err != nil) != test.wantErr {
+			t.Errorf("NestedNames(%q) error = %v, want error: %v", test.src, err, test.wantErr)
+			continue
+		}
+		if !test.wantErr && !reflect.DeepEqual(got, test.want) {
+			t.Errorf("NestedNames(%q) = %v, want %v", test.src, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package loader
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+)
+
+// isPreset reports whether expr declares an option preset, which is a
+// composite literal of type []interface{} holding the options it is made of.
+func isPreset(expr ast.Expr) bool {
+	lit, ok := expr.(*ast.CompositeLit)
+	if !ok {
+		return false
+	}
+	arr, ok := lit.Type.(*ast.ArrayType)
+	if !ok || arr.Len != nil {
+		return false
+	}
+	iface, ok := arr.Elt.(*ast.InterfaceType)
+	return ok && len(iface.Methods.List) == 0
+}
+
+// expandPresets replaces the tags which refer to option presets with the
+// options of the presets. Presets may refer to other presets, which are
+// expanded too.
+func (l *Loader) expandPresets(pkg *GunkPackage, tags []GunkTag) ([]GunkTag, error) {
+	var expanded []GunkTag
+	for _, tag := range tags {
+		lit, owner, err := l.findPreset(pkg, tag.Expr)
+		if err != nil {
+			return nil, err
+		}
+		if lit == nil {
+			expanded = append(expanded, tag)
+			continue
+		}
+		var presetTags []GunkTag
+		for _, elt := range lit.Elts {
+			if owner != pkg {
+				// The options were type-checked in the package
+				// declaring the preset; make their types
+				// available to this package too.
+				ast.Inspect(elt, func(node ast.Node) bool {
+					if ident, ok := node.(*ast.Ident); ok {
+						if obj, ok := owner.TypesInfo.Uses[ident]; ok {
+							pkg.TypesInfo.Uses[ident] = obj
+						}
+					}
+					if expr, ok := node.(ast.Expr); ok {
+						if tv, ok := owner.TypesInfo.Types[expr]; ok {
+							pkg.TypesInfo.Types[expr] = tv
+						}
+					}
+					return true
+				})
+			}
+			tv := owner.TypesInfo.Types[elt]
+			presetTags = append(presetTags, GunkTag{Expr: elt, Type: tv.Type, Value: tv.Value})
+		}
+		presetTags, err = l.expandPresets(pkg, presetTags)
+		if err != nil {
+			return nil, err
+		}
+		expanded = append(expanded, presetTags...)
+	}
+	return expanded, nil
+}
+
+// findPreset returns the composite literal declaring the preset that expr
+// refers to, and the package declaring it. It returns a nil literal if expr
+// doesn't refer to a package-level variable.
+func (l *Loader) findPreset(pkg *GunkPackage, expr ast.Expr) (*ast.CompositeLit, *GunkPackage, error) {
+	var ident *ast.Ident
+	switch expr := expr.(type) {
+	case *ast.Ident:
+		ident = expr
+	case *ast.SelectorExpr:
+		ident = expr.Sel
+	default:
+		return nil, nil, nil
+	}
+	obj, ok := pkg.TypesInfo.Uses[ident].(*types.Var)
+	if !ok || obj.Pkg() == nil || obj.Parent() != obj.Pkg().Scope() {
+		return nil, nil, nil
+	}
+	owner := pkg
+	if obj.Pkg() != pkg.Types {
+		owner = l.cache[obj.Pkg().Path()]
+		if owner == nil {
+			return nil, nil, fmt.Errorf("%s is not declared in a Gunk package", obj.Name())
+		}
+	}
+	for _, file := range owner.GunkSyntax {
+		for _, decl := range file.Decls {
+			gd, ok := decl.(*ast.GenDecl)
+			if !ok || gd.Tok != token.VAR {
+				continue
+			}
+			for _, spec := range gd.Specs {
+				vs := spec.(*ast.ValueSpec)
+				for i, name := range vs.Names {
+					if owner.TypesInfo.Defs[name] != obj {
+						continue
+					}
+					if i >= len(vs.Values) || !isPreset(vs.Values[i]) {
+						return nil, nil, fmt.Errorf("%s is not an option preset", obj.Name())
+					}
+					return vs.Values[i].(*ast.CompositeLit), owner, nil
+				}
+			}
+		}
+	}
+	return nil, nil, fmt.Errorf("could not find the declaration of preset %s", obj.Name())
+}
@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"reflect"
 	"regexp"
+	"strconv"
 	"strings"
 	"text/scanner"
 	"unicode"
@@ -15,6 +16,9 @@ import (
 	"github.com/gunk/gunk/reflectutil"
 	"github.com/gunk/opt/openapiv2"
 	"github.com/kenshaw/snaker"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
 )
 
 var urlVarRegexp = regexp.MustCompile(`\{(.*?)\}`)
@@ -22,7 +26,24 @@ var urlVarRegexp = regexp.MustCompile(`\{(.*?)\}`)
 // ConvertFromProto converts a single proto file read from r, writing the
 // generated Gunk file to w. The output isn't canonically formatted, so it's up
 // to the caller to use gunk/format.Source on the result if needed.
+//
+// If importPath isn't empty, the imported proto files are loaded from it with
+// the protoc binary at protocPath. See ConvertFromProtoWithLoader to set the
+// include paths they're loaded from.
 func ConvertFromProto(w io.Writer, r io.Reader, filename string, importPath string, protocPath string) error {
+	var protoLoader *ProtoLoader
+	if importPath != "" {
+		protoLoader = &ProtoLoader{
+			Dir:        importPath,
+			ProtocPath: protocPath,
+		}
+	}
+	return ConvertFromProtoWithLoader(w, r, filename, protoLoader)
+}
+
+// ConvertFromProtoWithLoader is like ConvertFromProto, but loads the imported
+// proto files with protoLoader. If it is nil, imported types are not resolved.
+func ConvertFromProtoWithLoader(w io.Writer, r io.Reader, filename string, protoLoader *ProtoLoader) error {
 	// Parse the proto file.
 	parser := proto.NewParser(r)
 	d, err := parser.Parse()
@@ -31,25 +52,27 @@ func ConvertFromProto(w io.Writer, r io.Reader, filename string, importPath stri
 	}
 	// Start converting the proto declarations to gunk.
 	b := builder{
-		filename:      filename,
-		importsUsed:   map[string]string{},
-		existingDecls: map[string]bool{},
+		filename:         filename,
+		importsUsed:      map[string]string{},
+		importedPackages: map[string]string{},
+		existingDecls:    map[string]bool{},
+		protoLoader:      protoLoader,
 	}
-	if importPath != "" {
-		b.protoLoader = &ProtoLoader{
-			Dir:        importPath,
-			ProtocPath: protocPath,
-		}
-	}
-	for _, e := range d.Elements {
+	for _, e := range mergeExtends(d.Elements) {
 		if err := b.handleProtoType(e); err != nil {
 			return err
 		}
 	}
-	// Validate that the package name is a a valid
-	// Go package name.
-	if err := b.validatePackageName(); err != nil {
-		return err
+	if len(b.unsupported) > 0 {
+		return fmt.Errorf("%s", strings.Join(b.unsupported, "\n"))
+	}
+	// Validate that the package name is a a valid Go package name,
+	// unless the file is converted along with others, to a Gunk package
+	// named after its directory.
+	if protoLoader.converted(filename) == nil {
+		if err := b.validatePackageName(); err != nil {
+			return err
+		}
 	}
 	// Convert the proto package and imports to gunk.
 	translatedPkg, err := b.handlePackage()
@@ -57,9 +80,17 @@ func ConvertFromProto(w io.Writer, r io.Reader, filename string, importPath stri
 		return err
 	}
 	translatedImports := b.handleImports()
-	// Add the converted package and imports, and then
-	// add all the rest of the converted types. This will
-	// keep the order that things were declared.
+	// Add the comments before the package, such as license headers, the
+	// converted package and imports, and then add all the rest of the
+	// converted types. This will keep the order that things were
+	// declared.
+	for _, c := range b.header {
+		h := &strings.Builder{}
+		b.format(h, 0, c, "")
+		if _, err := fmt.Fprintf(w, "%s\n", h); err != nil {
+			return err
+		}
+	}
 	if _, err := fmt.Fprintf(w, "%s\n\n", translatedPkg); err != nil {
 		return err
 	}
@@ -90,15 +121,29 @@ type builder struct {
 	pkg     *proto.Package
 	pkgOpts []*proto.Option
 	imports []*proto.Import
+	// The comments which aren't attached to a declaration and come before
+	// the package, which are written before the Gunk package clause.
+	header []*proto.Comment
 	// Imports that are required to ro generate a valid Gunk file.
 	// Mostly these will be Gunk annotations. Import name will be
 	// mapped to its possible named import.
 	importsUsed map[string]string
+	// The names the Gunk packages of the imported proto packages are
+	// imported as, by proto package, to convert the references to their
+	// types.
+	importedPackages map[string]string
 	// imported proto files will be loaded using protoLoader
 	// holds the absolute path passed to -I flag from protoc
 	protoLoader *ProtoLoader
 	// Holds existings declaration to avoid duplicate
 	existingDecls map[string]bool
+	// The errors of the proto2 constructs which can't be represented in
+	// Gunk, which are all reported once the file has been converted.
+	unsupported []string
+	// The files loaded for the imports, by name, and the registry built
+	// from them to resolve custom options.
+	importedFiles map[string]*descriptorpb.FileDescriptorProto
+	registry      *protoregistry.Files
 }
 
 // format will write output to a string builder, adding in indentation
@@ -129,12 +174,151 @@ func (b *builder) format(w *strings.Builder, indent int, comments *proto.Comment
 	fmt.Fprintf(w, s, args...)
 }
 
+// appendAnnotations appends doc annotations, such as "Required: true", to a
+// comment after a blank line, creating the comment if there is none.
+func appendAnnotations(comment *proto.Comment, annotations ...string) *proto.Comment {
+	if len(annotations) == 0 {
+		return comment
+	}
+	if comment == nil {
+		comment = &proto.Comment{}
+	} else {
+		comment.Lines = append(comment.Lines, "")
+	}
+	for _, a := range annotations {
+		comment.Lines = append(comment.Lines, " "+a)
+	}
+	return comment
+}
+
+// reservedAnnotations returns the Reserved annotations of the reserved
+// statements, with the reserved names converted by name.
+func reservedAnnotations(reserved []*proto.Reserved, name func(string) string) []string {
+	var annotations []string
+	for _, r := range reserved {
+		if len(r.Ranges) > 0 {
+			ranges := make([]string, len(r.Ranges))
+			for i, rng := range r.Ranges {
+				ranges[i] = rng.SourceRepresentation()
+			}
+			annotations = append(annotations, "Reserved: "+strings.Join(ranges, ", "))
+		}
+		if len(r.FieldNames) > 0 {
+			names := make([]string, len(r.FieldNames))
+			for i, n := range r.FieldNames {
+				names[i] = strconv.Quote(name(n))
+			}
+			annotations = append(annotations, "Reserved: "+strings.Join(names, ", "))
+		}
+	}
+	return annotations
+}
+
+// appendTags appends "+gunk" tags to a doc comment, creating the comment if
+// there is none.
+func appendTags(comment *proto.Comment, tags []string) *proto.Comment {
+	if len(tags) == 0 {
+		return comment
+	}
+	if comment == nil {
+		comment = &proto.Comment{}
+	}
+	for _, tag := range tags {
+		comment.Lines = append(comment.Lines, " +gunk "+tag)
+	}
+	return comment
+}
+
+// containsOption reports whether o is one of options.
+func containsOption(options []*proto.Option, o *proto.Option) bool {
+	for _, opt := range options {
+		if opt == o {
+			return true
+		}
+	}
+	return false
+}
+
+// docComment returns the doc comment of a proto declaration, made of its
+// leading comment followed by its inline one, as Gunk has doc comments only.
+func docComment(comment, inline *proto.Comment) *proto.Comment {
+	if inline == nil {
+		return comment
+	}
+	if comment == nil {
+		return inline
+	}
+	lines := append(append([]string(nil), comment.Lines...), inline.Lines...)
+	return &proto.Comment{Position: comment.Position, Lines: lines}
+}
+
 // formatError will return an error formatted to include the current position in
 // the file.
 func (b *builder) formatError(pos scanner.Position, s string, args ...interface{}) error {
 	return fmt.Errorf("%s:%d:%d: %v", b.filename, pos.Line, pos.Column, fmt.Errorf(s, args...))
 }
 
+// addUnsupported records an error for a construct which can't be represented
+// in Gunk, such as a proto2 group.
+func (b *builder) addUnsupported(pos scanner.Position, s string, args ...interface{}) {
+	b.unsupported = append(b.unsupported, b.formatError(pos, s, args...).Error())
+}
+
+// wellKnownType is the Go type which a well-known protobuf type is converted
+// to.
+type wellKnownType struct {
+	importPath string
+	name       string
+}
+
+// wellKnownTypes maps the well-known protobuf types which are recognized by
+// Gunk to their Go types.
+var wellKnownTypes = map[string]wellKnownType{
+	"google.protobuf.Any":       {"google.golang.org/protobuf/types/known/anypb", "Any"},
+	"google.protobuf.Struct":    {"google.golang.org/protobuf/types/known/structpb", "Struct"},
+	"google.protobuf.Value":     {"google.golang.org/protobuf/types/known/structpb", "Value"},
+	"google.protobuf.ListValue": {"google.golang.org/protobuf/types/known/structpb", "ListValue"},
+	"google.protobuf.FieldMask": {"google.golang.org/protobuf/types/known/fieldmaskpb", "FieldMask"},
+	"google.protobuf.Timestamp": {"time", "Time"},
+	"google.protobuf.Duration":  {"time", "Duration"},
+}
+
+// knownType returns the Go type of a well-known protobuf type, or of a type
+// of the bundled googleapis common protos, such as google.type.Money.
+func knownType(name string) (wellKnownType, bool) {
+	name = strings.TrimPrefix(name, ".")
+	if wkt, ok := wellKnownTypes[name]; ok {
+		return wkt, true
+	}
+	importPath, goName, ok := GoogleapisGoType(name)
+	return wellKnownType{importPath, goName}, ok
+}
+
+// emptyPath is the import path of the Go package declaring
+// google.protobuf.Empty, which is only used for streams of empty messages, as
+// Gunk methods without parameters or results use it otherwise.
+const emptyPath = "google.golang.org/protobuf/types/known/emptypb"
+
+// wellKnownFiles are the proto files declaring the types in wellKnownTypes.
+// Imports of these files are dropped, as the Go packages are imported when
+// the types are used.
+var wellKnownFiles = map[string]bool{
+	"google/protobuf/any.proto":        true,
+	"google/protobuf/struct.proto":     true,
+	"google/protobuf/field_mask.proto": true,
+	"google/protobuf/timestamp.proto":  true,
+	"google/protobuf/duration.proto":   true,
+}
+
+// optionFiles are the proto files declaring options which are converted to
+// Gunk types and struct tags, such as the ones marking UUID fields. Imports of
+// these files are dropped, as their Go packages aren't used.
+var optionFiles = map[string]bool{
+	"google/protobuf/descriptor.proto":               true,
+	"validate/validate.proto":                        true,
+	"protoc-gen-openapiv2/options/annotations.proto": true,
+}
+
 // goType will turn a proto type to a known Go type. If the
 // Go type isn't recognised, it is assumed to be a custom type.
 func (b *builder) goType(fieldType string) string {
@@ -162,53 +346,162 @@ func (b *builder) goType(fieldType string) string {
 	case "uint64", "fixed64":
 		return "uint64"
 	default:
+		if wkt, ok := knownType(fieldType); ok {
+			return b.addImportUsed(wkt.importPath) + "." + wkt.name
+		}
+		if typ, ok := b.importedType(fieldType); ok {
+			return typ
+		}
 		// TODO: We return the proto package name unaltered. This
-		// causes issues when a package name is imported or contains
-		// "." or other invalid characters for a package name.
+		// causes issues when a package name contains "." or other
+		// invalid characters for a package name.
 		// This is either an unrecognised type, or a custom type.
 		return fieldType
 	}
 }
 
+// importPackage imports the Gunk package with the given import path, which
+// declares the proto package, named after the proto package, such as foo_v1
+// for foo.v1.
+func (b *builder) importPackage(path, protoPkg string) {
+	named := strings.Replace(protoPkg, ".", "_", -1)
+	b.importsUsed[path] = named
+	b.importedPackages[protoPkg] = named
+}
+
+// importedType returns the Go name of the type of an imported proto package
+// that a qualified type name refers to, such as foo_v1.Bar_Baz for
+// foo.v1.Bar.Baz. The name is resolved relative to the package of the file,
+// like protoc does.
+func (b *builder) importedType(name string) (string, bool) {
+	if !strings.Contains(strings.TrimPrefix(name, "."), ".") {
+		// Unqualified names refer to the types of the file's
+		// package.
+		return "", false
+	}
+	var scopes []string
+	if strings.HasPrefix(name, ".") {
+		name = name[1:]
+		scopes = []string{""}
+	} else {
+		if b.pkg != nil {
+			scope := b.pkg.Name
+			for scope != "" {
+				scopes = append(scopes, scope)
+				i := strings.LastIndex(scope, ".")
+				if i < 0 {
+					break
+				}
+				scope = scope[:i]
+			}
+		}
+		scopes = append(scopes, "")
+	}
+	for _, scope := range scopes {
+		full := name
+		if scope != "" {
+			full = scope + "." + name
+		}
+		// The longest package wins. Within a scope, the first element
+		// of the name must be a package nested in it, as the types of
+		// the scope aren't known.
+		best := ""
+		for pkg := range b.importedPackages {
+			if len(pkg) > len(best) && strings.HasPrefix(full, pkg+".") &&
+				(scope == "" || strings.HasPrefix(pkg, scope+".")) {
+				best = pkg
+			}
+		}
+		if best != "" {
+			typ := strings.Replace(full[len(best)+1:], ".", "_", -1)
+			return b.importedPackages[best] + "." + typ, true
+		}
+	}
+	return "", false
+}
+
+// protoEncoding returns the value of the encoding struct tag for a proto
+// scalar type, or an empty string if it uses the default varint encoding.
+func protoEncoding(fieldType string) string {
+	switch fieldType {
+	case "sint32", "sint64":
+		return "sint"
+	case "fixed32", "fixed64", "sfixed32", "sfixed64":
+		return "fixed"
+	}
+	return ""
+}
+
 func (b *builder) handleProtoType(typ proto.Visitee) error {
 	var err error
 	switch typ := typ.(type) {
-	case *proto.Syntax, *proto.Comment:
-		// Do nothing with syntax or comment
+	case *proto.Syntax:
+		if c := docComment(typ.Comment, typ.InlineComment); c != nil {
+			b.header = append(b.header, c)
+		}
+	case *proto.Comment:
+		// Keep the comments which aren't attached to a declaration
+		// where they are, as comments between the declarations.
+		if b.pkg == nil {
+			b.header = append(b.header, typ)
+			break
+		}
+		w := &strings.Builder{}
+		b.format(w, 0, typ, "")
+		b.translatedDeclarations = append(b.translatedDeclarations, strings.TrimSuffix(w.String(), "\n"))
 	case *proto.Package:
 		// This gets translated at the very end because it is used
 		// in conjuction with the option "go_package" when writting
 		// a Gunk package decleration.
 		b.pkg = typ
 	case *proto.Import:
-		if b.protoLoader != nil {
+		if wellKnownFiles[typ.Filename] || optionFiles[typ.Filename] || isGoogleapisTypesFile(typ.Filename) {
+			break
+		}
+		if pkg := b.protoLoader.converted(typ.Filename); pkg != nil {
+			// The file is converted along with this one, so import
+			// its Gunk package, unless it's the same.
+			if own := b.protoLoader.converted(b.filename); own == nil || own.Path != pkg.Path {
+				b.importPackage(pkg.Path, pkg.ProtoPackage)
+			}
+			break
+		}
+		// Without protoc, only the bundled files can be loaded.
+		if b.protoLoader != nil && (b.protoLoader.ProtocPath != "" || IsBundledProto(typ.Filename)) {
 			files, err := b.protoLoader.LoadProto(typ.Filename)
 			if err != nil {
 				return err
 			}
-			named, source := "", ""
+			protoPkg, source := "", ""
 			for _, f := range files {
 				if f != nil && f.GetName() == typ.Filename {
-					named = strings.Replace(f.GetPackage(), ".", "_", -1)
+					protoPkg = f.GetPackage()
 					if f.GetOptions() != nil && f.GetOptions().GoPackage != nil {
-						source = *f.GetOptions().GoPackage
+						// Drop the package name of a go_package
+						// such as "path;name".
+						source = strings.SplitN(*f.GetOptions().GoPackage, ";", 2)[0]
 					}
 				}
 			}
 			if source == "" {
 				return fmt.Errorf("imported file must contain go_package option %s", typ.Filename)
 			}
-			if named == "" {
+			if protoPkg == "" {
 				return fmt.Errorf("imported file must contain package name %s", typ.Filename)
 			}
 			// Import the go package
-			b.importsUsed[source] = named
+			b.importPackage(source, protoPkg)
+			b.addImportedFiles(files)
 		} else {
 			// All imports need to be grouped and written out together. This
 			// happens at the end.
 			b.imports = append(b.imports, typ)
 		}
 	case *proto.Message:
+		if typ.IsExtend {
+			err = b.handleExtend(typ)
+			break
+		}
 		err = b.handleMessage(typ)
 	case *proto.Enum:
 		err = b.handleEnum(typ)
@@ -222,28 +515,42 @@ func (b *builder) handleProtoType(typ proto.Visitee) error {
 	return err
 }
 
-// handleMessageField will convert a messages field to gunk.
-func (b *builder) handleMessageField(w *strings.Builder, field proto.Visitee) error {
+// handleMessageField will convert a messages field to gunk. oneof is the name
+// of the oneof the field is part of, if any.
+func (b *builder) handleMessageField(w *strings.Builder, field proto.Visitee, oneof string) error {
 	var (
 		name     string
 		typ      string
+		encoding string
 		sequence int
 		repeated bool
 		comment  *proto.Comment
 		options  []*proto.Option
+		validate string
+		required bool
+		jsonName string
 	)
 	switch field := field.(type) {
 	case *proto.NormalField:
 		name = field.Name
 		typ = b.goType(field.Type)
+		encoding = protoEncoding(field.Type)
 		sequence = field.Sequence
-		comment = field.Comment
+		comment = docComment(field.Comment, field.InlineComment)
 		repeated = field.Repeated
+		required = field.Required
 		options = field.Options
+		if field.Type == "string" {
+			var isUUID bool
+			options, isUUID, validate = splitUUIDOptions(options, field.Repeated)
+			if isUUID {
+				typ = b.addImportUsed(UUIDPath) + ".UUID"
+			}
+		}
 	case *proto.MapField:
 		name = field.Field.Name
 		sequence = field.Field.Sequence
-		comment = field.Comment
+		comment = docComment(field.Comment, field.InlineComment)
 		keyType := b.goType(field.KeyType)
 		fieldType := b.goType(field.Field.Type)
 		typ = fmt.Sprintf("map[%s]%s", keyType, fieldType)
@@ -257,11 +564,31 @@ func (b *builder) handleMessageField(w *strings.Builder, field proto.Visitee) er
 	if repeated {
 		typ = "[]" + typ
 	}
+	// Gunk fields are always optional and there are no oneofs, so the
+	// oneofs, proto2 labels and default values are kept as lines of the
+	// field's documentation.
+	var annotations []string
+	if oneof != "" {
+		annotations = append(annotations, "Oneof: "+oneof)
+	}
+	if required {
+		annotations = append(annotations, "Required: true")
+	}
+	tags, options, err := b.customOptions(options, "google.protobuf.FieldOptions")
+	if err != nil {
+		return err
+	}
 	for _, o := range options {
 		val := o.Constant.Source
 		var impt string
 		var value string
 		switch n := o.Name; n {
+		case "default":
+			annotations = append(annotations, "Default: "+o.Constant.SourceRepresentation())
+			continue
+		case "json_name":
+			jsonName = val
+			continue
 		case "packed":
 			impt = "github.com/gunk/opt/message"
 			value = b.genAnnotation("Packed", val)
@@ -277,9 +604,21 @@ func (b *builder) handleMessageField(w *strings.Builder, field proto.Visitee) er
 		case "js_type":
 			impt = "github.com/gunk/opt/message/js"
 			value = b.genAnnotationString("Type", val)
+		default:
+			fmt.Fprintln(os.Stderr, b.formatError(o.Position, "unhandled field option %q", n))
+			continue
 		}
 		pkg := b.addImportUsed(impt)
-		b.format(w, 1, nil, fmt.Sprintf("// +gunk %s.%s\n", pkg, value))
+		tags = append(tags, fmt.Sprintf("%s.%s", pkg, value))
+	}
+	comment = appendAnnotations(comment, annotations...)
+	// The gunk tags must follow the field's documentation.
+	if len(tags) > 0 && comment != nil {
+		b.format(w, 1, comment, "//\n")
+		comment = nil
+	}
+	for _, tag := range tags {
+		b.format(w, 1, nil, "// +gunk %s\n", tag)
 	}
 	// TODO(vishen): Is this correct to explicitly camelcase the variable name and
 	// snakecase the json name???
@@ -287,10 +626,45 @@ func (b *builder) handleMessageField(w *strings.Builder, field proto.Visitee) er
 	// in the proto to something else? That way we can use best practises for
 	// each language???
 	b.format(w, 1, comment, "%s %s", snaker.ForceCamelIdentifier(name), typ)
-	b.format(w, 0, nil, " `pb:\"%d\" json:\"%s\"`\n", sequence, snaker.CamelToSnake(name))
+	if jsonName == "" {
+		jsonName = snaker.CamelToSnake(name)
+	}
+	tag := fmt.Sprintf("pb:\"%d\" json:\"%s\"", sequence, jsonName)
+	if encoding != "" {
+		tag += fmt.Sprintf(" encoding:\"%s\"", encoding)
+	}
+	if validate != "" {
+		tag += fmt.Sprintf(" validate:\"%s\"", validate)
+	}
+	b.format(w, 0, nil, " `%s`\n", tag)
 	return nil
 }
 
+// splitUUIDOptions removes the options marking a string field as a UUID,
+// which are a "uuid" OpenAPI format and the uuid validation rule. It reports
+// whether the field is a UUID, and the validate tag to use for it. The
+// validation rule only applies to singular fields.
+func splitUUIDOptions(options []*proto.Option, repeated bool) (rest []*proto.Option, isUUID bool, validate string) {
+	for _, o := range options {
+		switch o.Name {
+		case "(validate.rules).string.uuid":
+			if !repeated && o.Constant.Source == "true" {
+				isUUID, validate = true, "uuid"
+				continue
+			}
+		case "(grpc.gateway.protoc_gen_openapiv2.options.openapiv2_field)":
+			if len(o.Constant.OrderedMap) == 1 {
+				if format, ok := o.Constant.OrderedMap.Get("format"); ok && format.Source == "uuid" {
+					isUUID = true
+					continue
+				}
+			}
+		}
+		rest = append(rest, o)
+	}
+	return rest, isUUID, validate
+}
+
 func (b *builder) containsImport(ref string) bool {
 	for _, v := range b.importsUsed {
 		if v == ref {
@@ -308,51 +682,104 @@ func (b *builder) handleMessage(m *proto.Message) error {
 		return b.formatError(m.Position, "%s redeclared in this block", m.Name)
 	}
 	b.existingDecls[m.Name] = true
-	b.format(w, 0, m.Comment, "type %s struct {\n", m.Name)
+	// Nested messages and enums are declared at the top level, named
+	// Parent_Child like in the generated Go code, and annotated with their
+	// parent to be generated nested in it again. They are renamed first,
+	// as fields may refer to them before their declaration.
 	for _, e := range m.Elements {
+		switch e := e.(type) {
+		case *proto.Message:
+			if !e.IsExtend {
+				e.Name = fmt.Sprintf("%s_%s", m.Name, e.Name)
+				e.Comment = appendAnnotations(e.Comment, "Nested: "+m.Name)
+			}
+		case *proto.Enum:
+			e.Name = fmt.Sprintf("%s_%s", m.Name, e.Name)
+			e.Comment = appendAnnotations(e.Comment, "Nested: "+m.Name)
+		}
+	}
+	// Custom options are converted to tags on the message, rather than
+	// in its body like the other options. Reserved statements are
+	// converted to annotations, naming fields like they are converted.
+	var options []*proto.Option
+	var reserved []*proto.Reserved
+	for _, e := range m.Elements {
+		switch e := e.(type) {
+		case *proto.Option:
+			options = append(options, e)
+		case *proto.Reserved:
+			reserved = append(reserved, e)
+		}
+	}
+	tags, options, err := b.customOptions(options, "google.protobuf.MessageOptions")
+	if err != nil {
+		return err
+	}
+	comment := appendAnnotations(m.Comment, reservedAnnotations(reserved, snaker.ForceCamelIdentifier)...)
+	b.format(w, 0, appendTags(comment, tags), "type %s struct {\n", m.Name)
+	for _, e := range m.Elements {
+		if o, ok := e.(*proto.Option); ok && !containsOption(options, o) {
+			continue
+		}
 		switch e := e.(type) {
 		case *proto.NormalField:
-			// Check if the type must be renamed in case
-			// of declaration of nested message
-			newType := fmt.Sprintf("%s_%s", m.Name, e.Type)
-			if _, ok := b.existingDecls[newType]; ok {
-				e.Type = newType
-			}
-			if strings.Contains(e.Type, ".") {
-				ref := strings.Split(e.Type, ".")[0]
-				if !b.containsImport(ref) {
-					tmp := strings.Replace(e.Type, ".", "_", -1)
-					// the type is neither found in import and existing decls
-					if _, ok := b.existingDecls[tmp]; !ok {
-						return b.formatError(e.Position, "%s is undefined", e.Type)
+			if err := b.handleNormalField(w, m, e, ""); err != nil {
+				return err
+			}
+		case *proto.Oneof:
+			// Gunk has no oneofs, so their fields are converted to
+			// fields of the message, documented with the name of
+			// their oneof, which keeps them compatible on the wire.
+			fmt.Fprintln(os.Stderr, b.formatError(e.Position, "oneof %s converted to separate fields with a Oneof annotation; only one of them should be set", e.Name))
+			if e.Comment != nil {
+				// Keep the oneof's comment apart from the doc
+				// comment of its first field.
+				b.format(w, 1, e.Comment, "")
+				b.format(w, 0, nil, "\n")
+			}
+			for _, oe := range e.Elements {
+				switch oe := oe.(type) {
+				case *proto.OneOfField:
+					if err := b.handleNormalField(w, m, &proto.NormalField{Field: oe.Field}, e.Name); err != nil {
+						return err
 					}
-					// Handle the use of nested field referenced outside
-					// of its parent; Parent.Type is renamed to Parent_Type in a Go-Derived way
-					e.Type = tmp
+				case *proto.Comment:
+					b.format(w, 1, oe, "")
+				case *proto.Group:
+					b.addUnsupported(oe.Position, "group %s can't be represented in Gunk, use a message field instead", oe.Name)
+				case *proto.Option:
+					fmt.Fprintln(os.Stderr, b.formatError(oe.Position, "unhandled oneof option %q", oe.Name))
+				default:
+					return b.formatError(e.Position, "unexpected type %T in oneof", oe)
 				}
 			}
-			if err := b.handleMessageField(w, e); err != nil {
-				return b.formatError(e.Position, "error with message field: %v", err)
-			}
 		case *proto.Enum:
-			// Handle the nested enum. This will create a new
-			// top level enum as Gunk doesn't currently support
-			// nested data structures.
-			b.handleEnum(e)
+			// Handle the nested enum, renamed above.
+			if err := b.handleEnum(e); err != nil {
+				return b.formatError(e.Position, "error with nested enum %v", err)
+			}
 		case *proto.Comment:
 			b.format(w, 1, e, "")
 		case *proto.MapField:
-			if err := b.handleMessageField(w, e); err != nil {
+			if err := b.handleMessageField(w, e, ""); err != nil {
 				return b.formatError(e.Position, "error with message field: %v", err)
 			}
 		case *proto.Option:
 			if err := b.handleOption(w, e); err != nil {
 				return b.formatError(e.Position, "error with option field: %v", err)
 			}
+		case *proto.Reserved:
+			// Converted to annotations above.
+		case *proto.Group:
+			b.addUnsupported(e.Position, "group %s can't be represented in Gunk, use a message field instead", e.Name)
+		case *proto.Extensions:
+			b.addUnsupported(e.Position, "extension ranges can't be represented in Gunk")
 		case *proto.Message:
-			// Handle the nested message. The struct is created at
-			// the top level and renamed in the form Parent_Child
-			e.Name = fmt.Sprintf("%s_%s", m.Name, e.Name)
+			if e.IsExtend {
+				b.addUnsupported(e.Position, "extend %s can't be represented in Gunk", e.Name)
+				continue
+			}
+			// Handle the nested message, renamed above.
 			if err := b.handleMessage(e); err != nil {
 				return b.formatError(e.Position, "error with nested message %v", err)
 			}
@@ -365,6 +792,96 @@ func (b *builder) handleMessage(m *proto.Message) error {
 	return nil
 }
 
+// handleExtend converts an extension of a descriptor options message, which
+// declares custom options, to the Gunk struct declaring them, such as
+// FieldOptions for google.protobuf.FieldOptions. Other extensions can't be
+// represented in Gunk.
+func (b *builder) handleExtend(m *proto.Message) error {
+	name := optionStruct(m.Name)
+	if name == "" {
+		b.addUnsupported(m.Position, "extend %s can't be represented in Gunk", m.Name)
+		return nil
+	}
+	ext := *m
+	ext.Name = name
+	ext.IsExtend = false
+	return b.handleMessage(&ext)
+}
+
+// mergeExtends merges the extensions of each descriptor options message into
+// the first one, as they are all converted to the same Gunk struct.
+func mergeExtends(elems []proto.Visitee) []proto.Visitee {
+	var merged []proto.Visitee
+	first := make(map[string]*proto.Message)
+	for _, e := range elems {
+		m, ok := e.(*proto.Message)
+		if !ok || !m.IsExtend || optionStruct(m.Name) == "" {
+			merged = append(merged, e)
+			continue
+		}
+		name := optionStruct(m.Name)
+		if f, ok := first[name]; ok {
+			f.Elements = append(f.Elements, m.Elements...)
+			continue
+		}
+		// Copy the message, to not modify the parsed elements.
+		m2 := *m
+		m2.Elements = append([]proto.Visitee(nil), m.Elements...)
+		first[name] = &m2
+		merged = append(merged, &m2)
+	}
+	return merged
+}
+
+// handleNormalField will convert a normal field of a message to gunk, resolving
+// the nested messages its type refers to. oneof is the name of the oneof the
+// field is part of, if any.
+func (b *builder) handleNormalField(w *strings.Builder, m *proto.Message, e *proto.NormalField, oneof string) error {
+	// Check if the type must be renamed in case
+	// of declaration of nested message
+	newType := fmt.Sprintf("%s_%s", m.Name, e.Type)
+	if _, ok := b.existingDecls[newType]; ok || hasNestedType(m, newType) {
+		e.Type = newType
+	}
+	_, wellKnown := knownType(e.Type)
+	_, imported := b.importedType(e.Type)
+	if strings.Contains(e.Type, ".") && !wellKnown && !imported {
+		ref := strings.Split(e.Type, ".")[0]
+		if !b.containsImport(ref) {
+			tmp := strings.Replace(e.Type, ".", "_", -1)
+			// the type is neither found in import and existing decls
+			if _, ok := b.existingDecls[tmp]; !ok {
+				return b.formatError(e.Position, "%s is undefined", e.Type)
+			}
+			// Handle the use of nested field referenced outside
+			// of its parent; Parent.Type is renamed to Parent_Type in a Go-Derived way
+			e.Type = tmp
+		}
+	}
+	if err := b.handleMessageField(w, e, oneof); err != nil {
+		return b.formatError(e.Position, "error with message field: %v", err)
+	}
+	return nil
+}
+
+// hasNestedType reports whether a message or enum with the given name, once
+// renamed, is nested in m.
+func hasNestedType(m *proto.Message, name string) bool {
+	for _, e := range m.Elements {
+		switch e := e.(type) {
+		case *proto.Message:
+			if !e.IsExtend && e.Name == name {
+				return true
+			}
+		case *proto.Enum:
+			if e.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func (b *builder) handleOption(w *strings.Builder, opt *proto.Option) error {
 	switch n := opt.Name; n {
 	case "(grpc.gateway.protoc_gen_swagger.options.openapiv2_schema)":
@@ -391,26 +908,52 @@ func (b *builder) handleOption(w *strings.Builder, opt *proto.Option) error {
 // conversion.
 func (b *builder) handleEnum(e *proto.Enum) error {
 	w := &strings.Builder{}
-	b.format(w, 0, e.Comment, "type %s int\n", e.Name)
+	var options []*proto.Option
+	var reserved []*proto.Reserved
+	for _, c := range e.Elements {
+		switch c := c.(type) {
+		case *proto.Option:
+			options = append(options, c)
+		case *proto.Reserved:
+			reserved = append(reserved, c)
+		}
+	}
+	tags, options, err := b.customOptions(options, "google.protobuf.EnumOptions")
+	if err != nil {
+		return err
+	}
+	// Enum values keep their names, and so do the reserved ones.
+	comment := appendAnnotations(e.Comment, reservedAnnotations(reserved, func(name string) string { return name })...)
+	b.format(w, 0, appendTags(comment, tags), "type %s int\n", e.Name)
 	b.format(w, 0, nil, "\nconst (\n")
 	// Check to see if we can output the enum using an iota. This is
 	// currently only possible if every enum value is an increment of 1
 	// from the previous enum value.
 	outputIota := true
-	for i, c := range e.Elements {
+	values := 0
+	for _, c := range e.Elements {
 		switch c := c.(type) {
 		case *proto.EnumField:
-			if i != c.Integer {
+			if values != c.Integer {
 				outputIota = false
 			}
+			values++
+		case *proto.Comment, *proto.Reserved:
 		case *proto.Option:
-			fmt.Fprintln(os.Stderr, b.formatError(c.Position, "unhandled enum option %q", c.Name))
+			if containsOption(options, c) {
+				fmt.Fprintln(os.Stderr, b.formatError(c.Position, "unhandled enum option %q", c.Name))
+			}
 		default:
 			return b.formatError(e.Position, "unexpected type %T in enum, expected enum field", c)
 		}
 	}
 	// Now we can output the enum as a const.
-	for i, c := range e.Elements {
+	first := true
+	for _, c := range e.Elements {
+		if c, ok := c.(*proto.Comment); ok {
+			b.format(w, 1, c, "")
+			continue
+		}
 		ef, ok := c.(*proto.EnumField)
 		if !ok {
 			// We should have caught any errors when checking if we can output as
@@ -424,22 +967,32 @@ func (b *builder) handleEnum(e *proto.Enum) error {
 			ef.Name = e.Name + "_" + ef.Name
 		}
 		b.existingDecls[ef.Name] = true
+		var valueOptions []*proto.Option
 		for _, e := range ef.Elements {
 			if o, ok := e.(*proto.Option); ok && o != nil {
-				fmt.Fprintln(os.Stderr, b.formatError(o.Position, "unhandled enumvalue option %q", o.Name))
+				valueOptions = append(valueOptions, o)
 			}
 		}
+		tags, valueOptions, err := b.customOptions(valueOptions, "google.protobuf.EnumValueOptions")
+		if err != nil {
+			return err
+		}
+		for _, o := range valueOptions {
+			fmt.Fprintln(os.Stderr, b.formatError(o.Position, "unhandled enumvalue option %q", o.Name))
+		}
+		comment := appendTags(docComment(ef.Comment, ef.InlineComment), tags)
 		// If we can't output as an iota.
 		if !outputIota {
-			b.format(w, 1, ef.Comment, "%s %s = %d\n", ef.Name, e.Name, ef.Integer)
+			b.format(w, 1, comment, "%s %s = %d\n", ef.Name, e.Name, ef.Integer)
 			continue
 		}
 		// If we can output as an iota, output the first element as the
 		// iota and output the rest as just the enum field name.
-		if i == 0 {
-			b.format(w, 1, ef.Comment, "%s %s = iota\n", ef.Name, e.Name)
+		if first {
+			b.format(w, 1, comment, "%s %s = iota\n", ef.Name, e.Name)
+			first = false
 		} else {
-			b.format(w, 1, ef.Comment, "%s\n", ef.Name)
+			b.format(w, 1, comment, "%s\n", ef.Name)
 		}
 	}
 	b.format(w, 0, nil, ")")
@@ -449,31 +1002,65 @@ func (b *builder) handleEnum(e *proto.Enum) error {
 
 func (b *builder) handleService(s *proto.Service) error {
 	w := &strings.Builder{}
-	b.format(w, 0, s.Comment, "type %s interface {\n", s.Name)
-	for i, e := range s.Elements {
+	var options []*proto.Option
+	for _, e := range s.Elements {
+		if o, ok := e.(*proto.Option); ok {
+			options = append(options, o)
+		}
+	}
+	tags, options, err := b.customOptions(options, "google.protobuf.ServiceOptions")
+	if err != nil {
+		return err
+	}
+	b.format(w, 0, appendTags(s.Comment, tags), "type %s interface {\n", s.Name)
+	var elems []proto.Visitee
+	for _, e := range s.Elements {
+		if o, ok := e.(*proto.Option); !ok || containsOption(options, o) {
+			elems = append(elems, e)
+		}
+	}
+	for i, e := range elems {
 		var r *proto.RPC
 		switch e := e.(type) {
 		case *proto.RPC:
 			r = e
+		case *proto.Comment:
+			b.format(w, 1, e, "")
+			continue
 		case *proto.Option:
 			fmt.Fprintln(os.Stderr, b.formatError(e.Position, "unhandled service option %q", e.Name))
 			continue
 		default:
 			return b.formatError(s.Position, "unexpected type %T in service, expected rpc", e)
 		}
+		// The comment to translate. It is possible that when we write
+		// the gunk annotations out we also write the comment above the
+		// gunk annotation. If that happens we set the comment to nil
+		// so it doesn't get written out when translating the field.
+		comment := docComment(r.Comment, r.InlineComment)
+		for _, o := range r.Elements {
+			// The comments within the rpc's options are added to
+			// its doc comment.
+			if c, ok := o.(*proto.Comment); ok {
+				comment = docComment(comment, c)
+			}
+		}
 		// Add a newline between each new function declaration on the interface, only
 		// if there is comments or gunk annotations seperating them. We can assume that
 		// anything in `Elements` will be a gunk annotation, otherwise an error is
 		// returned below.
-		if i > 0 && (r.Comment != nil || len(r.Elements) > 0) {
+		fullName := s.Name + "." + r.Name
+		if b.pkg != nil {
+			fullName = b.pkg.Name + "." + fullName
+		}
+		bindings := b.protoLoader.httpBindings(fullName)
+		if i > 0 && (comment != nil || len(r.Elements) > 0 || len(bindings) > 0) {
 			b.format(w, 0, nil, "\n")
 		}
-		// The comment to translate. It is possible that when we write
-		// the gunk annotations out we also write the comment above the
-		// gunk annotation. If that happens we set the comment to nil
-		// so it doesn't get written out when translating the field.
-		comment := r.Comment
 		for _, o := range r.Elements {
+			if _, ok := o.(*proto.Comment); ok {
+				continue
+			}
 			opt, ok := o.(*proto.Option)
 			if !ok {
 				return b.formatError(r.Position, "unexpected type %T in service rpc, expected option", o)
@@ -488,7 +1075,7 @@ func (b *builder) handleService(s *proto.Service) error {
 					comment = nil
 				}
 				b.format(w, 1, nil, "// +gunk %s.Operation{\n", pkg)
-				b.format(w, 1, nil, b.fromStructToAnnotation(*op))
+				b.format(w, 1, nil, "%s", b.fromStructToAnnotation(*op))
 				b.format(w, 1, nil, "// }\n")
 			case "(google.api.http)":
 				method := ""
@@ -502,30 +1089,52 @@ func (b *builder) handleService(s *proto.Service) error {
 					default:
 						method = n
 						url = l.Literal.Source
-						url = urlVarRegexp.ReplaceAllStringFunc(url, func(id string) string {
-							return "{" + snaker.ForceCamelIdentifier(id) + "}"
-						})
 					}
 				}
 				// Check if we received a valid google http annotation. If
 				// so we will convert it to gunk http match.
 				if method != "" && url != "" {
-					pkg := b.addImportUsed("github.com/gunk/opt/http")
-					if comment != nil {
-						b.format(w, 1, comment, "//\n")
-						comment = nil
-					}
-					b.format(w, 1, nil, "// +gunk %s.Match{\n", pkg)
-					b.format(w, 1, nil, "// Method: %q,\n", strings.ToUpper(method))
-					b.format(w, 1, nil, "// Path: %q,\n", url)
-					if body != "" {
-						b.format(w, 1, nil, "// Body: %q,\n", body)
-					}
-					b.format(w, 1, nil, "// }\n")
+					b.formatHTTPMatch(w, &comment, method, url, body)
+				}
+			default:
+				tag, err := b.customOption(opt, "google.protobuf.MethodOptions")
+				if err != nil {
+					return b.formatError(opt.Position, "option %s: %v", n, err)
+				}
+				if tag == "" {
+					fmt.Fprintln(os.Stderr, b.formatError(opt.Position, "unhandled method option %q", n))
+					continue
+				}
+				if comment != nil {
+					b.format(w, 1, comment, "//\n")
+					comment = nil
 				}
+				b.format(w, 1, nil, "// +gunk %s\n", tag)
+			}
+		}
+		// The HTTP rules set apart from the proto file follow those
+		// of its options, as additional bindings.
+		for _, rule := range bindings {
+			if rule.GetResponseBody() != "" {
+				fmt.Fprintln(os.Stderr, b.formatError(r.Position, "unhandled response_body %q of HTTP rule %s", rule.GetResponseBody(), fullName))
+			}
+			var method, url string
+			switch p := rule.GetPattern().(type) {
+			case *annotations.HttpRule_Get:
+				method, url = "get", p.Get
+			case *annotations.HttpRule_Put:
+				method, url = "put", p.Put
+			case *annotations.HttpRule_Post:
+				method, url = "post", p.Post
+			case *annotations.HttpRule_Delete:
+				method, url = "delete", p.Delete
+			case *annotations.HttpRule_Patch:
+				method, url = "patch", p.Patch
 			default:
-				fmt.Fprintln(os.Stderr, b.formatError(opt.Position, "unhandled method option %q", n))
+				fmt.Fprintln(os.Stderr, b.formatError(r.Position, "unhandled custom HTTP rule %q of %s", rule.GetCustom().GetKind(), fullName))
+				continue
 			}
+			b.formatHTTPMatch(w, &comment, method, url, rule.GetBody())
 		}
 		// If the request type is the known empty parameter we can convert
 		// this to gunk as an empty function parameter.
@@ -537,12 +1146,26 @@ func (b *builder) handleService(s *proto.Service) error {
 		if returnsType == "google.protobuf.Empty" {
 			returnsType = ""
 		}
-		// If the request is a stream, add chan
+		if requestType != "" {
+			requestType = b.goType(requestType)
+		}
+		if returnsType != "" {
+			returnsType = b.goType(returnsType)
+		}
+		// If the request is a stream, add chan. Streams of
+		// google.protobuf.Empty can't be written as no parameter, so
+		// they use its Go type.
 		if r.StreamsRequest {
+			if requestType == "" {
+				requestType = b.addImportUsed(emptyPath) + ".Empty"
+			}
 			requestType = "chan " + requestType
 		}
 		// If the response is a stream, add chan
 		if r.StreamsReturns {
+			if returnsType == "" {
+				returnsType = b.addImportUsed(emptyPath) + ".Empty"
+			}
 			returnsType = "chan " + returnsType
 		}
 		b.format(w, 1, comment, "%s(%s) %s\n", r.Name, requestType, returnsType)
@@ -616,11 +1239,19 @@ func (b *builder) handlePackage() (string, error) {
 			reflectutil.UnmarshalProto(swagger, &o.Constant)
 			res := &strings.Builder{}
 			b.format(res, 0, nil, "Swagger {\n")
-			b.format(res, 0, nil, b.fromStructToAnnotation(*swagger))
+			b.format(res, 0, nil, "%s", b.fromStructToAnnotation(*swagger))
 			b.format(res, 0, nil, "// }")
 			value = res.String()
 		default:
-			return "", b.formatError(o.Position, "%q is an unhandled proto file option", n)
+			tag, err := b.customOption(o, "google.protobuf.FileOptions")
+			if err != nil {
+				return "", b.formatError(o.Position, "option %s: %v", n, err)
+			}
+			if tag == "" {
+				return "", b.formatError(o.Position, "%q is an unhandled proto file option", n)
+			}
+			gunkAnnotations = append(gunkAnnotations, tag)
+			continue
 		}
 		pkg := b.addImportUsed(impt)
 		gunkAnnotations = append(gunkAnnotations, fmt.Sprintf("%s.%s", pkg, value))
@@ -628,20 +1259,52 @@ func (b *builder) handlePackage() (string, error) {
 	// Output the gunk annotations above the package comment. This
 	// should be first lines in the file.
 	for _, ga := range gunkAnnotations {
-		b.format(w, 0, nil, fmt.Sprintf("// +gunk %s\n", ga))
+		b.format(w, 0, nil, "// +gunk %s\n", ga)
 	}
 	p := b.pkg
-	b.format(w, 0, p.Comment, "")
+	b.format(w, 0, docComment(p.Comment, p.InlineComment), "")
 	if opt != nil {
 		b.format(w, 0, opt.Comment, "")
 	}
+	if pkg := b.protoLoader.converted(b.filename); pkg != nil {
+		// The Gunk package is named after its directory, which may
+		// differ from the proto package.
+		b.format(w, 0, nil, "package %s", pkg.Name)
+		if pkg.Name != p.Name || opt != nil {
+			b.format(w, 0, nil, " // proto %q", p.Name)
+		}
+		return w.String(), nil
+	}
 	b.format(w, 0, nil, "package %s", p.Name)
 	if opt != nil && opt.Constant.Source != "" {
-		b.format(w, 0, nil, " // proto %s", opt.Constant.Source)
+		// go_package is implied by the Gunk package's import
+		// path; keep the proto package name explicit instead.
+		b.format(w, 0, nil, " // proto %q", p.Name)
 	}
 	return w.String(), nil
 }
 
+// formatHTTPMatch writes the http.Match tag of an HTTP rule of a method,
+// preceded by the method's comment if it wasn't written yet. The variables of
+// the path refer to the Gunk fields.
+func (b *builder) formatHTTPMatch(w *strings.Builder, comment **proto.Comment, method, url, body string) {
+	url = urlVarRegexp.ReplaceAllStringFunc(url, func(id string) string {
+		return "{" + snaker.ForceCamelIdentifier(id) + "}"
+	})
+	pkg := b.addImportUsed("github.com/gunk/opt/http")
+	if *comment != nil {
+		b.format(w, 1, *comment, "//\n")
+		*comment = nil
+	}
+	b.format(w, 1, nil, "// +gunk %s.Match{\n", pkg)
+	b.format(w, 1, nil, "// Method: %q,\n", strings.ToUpper(method))
+	b.format(w, 1, nil, "// Path: %q,\n", url)
+	if body != "" {
+		b.format(w, 1, nil, "// Body: %q,\n", body)
+	}
+	b.format(w, 1, nil, "// }\n")
+}
+
 // indirectType is like reflect.Indirect, but it works on a reflect.Type.
 func indirectType(t reflect.Type) reflect.Type {
 	if t.Kind() != reflect.Ptr {
@@ -685,7 +1348,7 @@ func (b *builder) fromStructToAnnotation(val interface{}) string {
 					if !c.IsNil() {
 						t := reflect.Indirect(c).Interface()
 						b.format(w, 0, nil, "// %#v: %T{\n", key, t)
-						b.format(w, 0, nil, b.fromStructToAnnotation(t))
+						b.format(w, 0, nil, "%s", b.fromStructToAnnotation(t))
 						b.format(w, 0, nil, "// },\n")
 					}
 				default:
@@ -708,7 +1371,7 @@ func (b *builder) fromStructToAnnotation(val interface{}) string {
 				case reflect.Ptr:
 					if !val.IsNil() {
 						b.format(w, 0, nil, "// {\n")
-						b.format(w, 0, nil, b.fromStructToAnnotation(reflect.Indirect(val).Interface()))
+						b.format(w, 0, nil, "%s", b.fromStructToAnnotation(reflect.Indirect(val).Interface()))
 						b.format(w, 0, nil, "// },\n")
 					}
 				default:
@@ -782,15 +1445,31 @@ func (b *builder) handleImports() string {
 	}
 	w := &strings.Builder{}
 	b.format(w, 0, nil, "import (")
-	// Imports that have been used during convert.
+	// Imports that have been used during convert, with the standard
+	// library ones grouped first.
+	var std, other []string
 	for i, named := range b.importsUsed {
-		b.format(w, 0, nil, "\n")
+		spec := fmt.Sprintf("%q", i)
 		if named != "" {
-			b.format(w, 1, nil, fmt.Sprintf("%s %q", named, i))
+			spec = named + " " + spec
+		}
+		if isStdImport(i) {
+			std = append(std, spec)
 		} else {
-			b.format(w, 1, nil, fmt.Sprintf("%q", i))
+			other = append(other, spec)
 		}
 	}
+	for _, spec := range std {
+		b.format(w, 0, nil, "\n")
+		b.format(w, 1, nil, "%s", spec)
+	}
+	if len(std) > 0 && len(other) > 0 {
+		b.format(w, 0, nil, "\n")
+	}
+	for _, spec := range other {
+		b.format(w, 0, nil, "\n")
+		b.format(w, 1, nil, "%s", spec)
+	}
 	// Add any proto imports as comments.
 	for _, i := range b.imports {
 		b.format(w, 0, nil, "\n")
@@ -800,6 +1479,12 @@ func (b *builder) handleImports() string {
 	return w.String()
 }
 
+// isStdImport reports whether the import path is of a standard library
+// package.
+func isStdImport(path string) bool {
+	return !strings.Contains(strings.SplitN(path, "/", 2)[0], ".")
+}
+
 func (b *builder) validatePackageName() error {
 	pkgName := b.pkg.Name
 	for _, c := range pkgName {
@@ -0,0 +1,75 @@
+package loader
+
+import (
+	"go/format"
+	"strings"
+	"testing"
+)
+
+func TestConvertConvertedImports(t *testing.T) {
+	l := &ProtoLoader{
+		ProtocPath: "protoc-not-installed",
+		Converted: map[string]*ConvertedPackage{
+			"foo/v1/foo.proto":  {Path: "example.com/api/foo/v1", Name: "v1", ProtoPackage: "foo.v1"},
+			"foo/v1/item.proto": {Path: "example.com/api/foo/v1", Name: "v1", ProtoPackage: "foo.v1"},
+			"foo/bar.proto":     {Path: "example.com/api/foo", Name: "foo", ProtoPackage: "foo"},
+		},
+	}
+	// Unqualified names refer to the file's package, and qualified ones are
+	// resolved like protoc does.
+	src := `syntax = "proto3";
+
+package foo.v1;
+
+import "foo/v1/item.proto";
+import "foo/bar.proto";
+
+message Foo {
+	Item item = 1;
+	foo.Bar.Kind kind = 2;
+	.foo.Bar bar = 3;
+}
+`
+	want := `package v1 // proto "foo.v1"
+
+import (
+	foo "example.com/api/foo"
+)
+
+type Foo struct {
+	Item Item         ` + "`" + `pb:"1" json:"item"` + "`" + `
+	Kind foo.Bar_Kind ` + "`" + `pb:"2" json:"kind"` + "`" + `
+	Bar  foo.Bar      ` + "`" + `pb:"3" json:"bar"` + "`" + `
+}
+`
+	var w strings.Builder
+	if err := ConvertFromProtoWithLoader(&w, strings.NewReader(src), "foo/v1/foo.proto", l); err != nil {
+		t.Fatal(err)
+	}
+	got, err := format.Source([]byte(w.String()))
+	if err != nil {
+		t.Fatalf("%v:\n%s", err, w.String())
+	}
+	if string(got) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestConvertFromProto(t *testing.T) {
+	// Without an import path, imported files aren't loaded.
+	src := `syntax = "proto3";
+
+package foo;
+
+message Foo {
+	string name = 1;
+}
+`
+	var w strings.Builder
+	if err := ConvertFromProto(&w, strings.NewReader(src), "foo.proto", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(w.String(), "type Foo struct") {
+		t.Errorf("got:\n%s\nwant a Foo struct", w.String())
+	}
+}
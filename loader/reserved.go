@@ -0,0 +1,118 @@
+package loader
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// MaxFieldNumber is the largest field number of a message, which "max" stands
+// for in a Reserved annotation.
+const MaxFieldNumber = 536870911
+
+// Reserved is the field numbers and names a message reserves, so that they
+// aren't reused by new fields, as annotated in its documentation with lines
+// such as:
+//
+//	Reserved: 2, 15, 9 to 11, 100 to max
+//	Reserved: "foo", "bar"
+//
+// like protobuf's reserved statements. Enums reserve the numbers and names of
+// their values in the same way.
+type Reserved struct {
+	// Ranges are the reserved ranges of numbers, including their ends.
+	Ranges [][2]int32
+	Names  []string
+}
+
+// ParseReserved returns the field numbers and names reserved by the Reserved
+// lines of the documentation text, or nil if there are none.
+func ParseReserved(text string) (*Reserved, error) {
+	return parseReserved(text, 1, MaxFieldNumber)
+}
+
+// ParseEnumReserved is like ParseReserved, but returns the enum value numbers
+// and names reserved by the documentation text of an enum. Unlike field
+// numbers, they may be zero or negative, and "max" stands for the largest
+// int32.
+func ParseEnumReserved(text string) (*Reserved, error) {
+	return parseReserved(text, math.MinInt32, math.MaxInt32)
+}
+
+func parseReserved(text string, min, max int32) (*Reserved, error) {
+	var r *Reserved
+	for _, line := range strings.Split(text, "\n") {
+		if !strings.HasPrefix(line, "Reserved:") {
+			continue
+		}
+		if r == nil {
+			r = &Reserved{}
+		}
+		for _, item := range strings.Split(strings.TrimPrefix(line, "Reserved:"), ",") {
+			item = strings.TrimSpace(item)
+			if strings.HasPrefix(item, `"`) {
+				name, err := strconv.Unquote(item)
+				if err != nil || name == "" {
+					return nil, fmt.Errorf("invalid reserved name %s", item)
+				}
+				r.Names = append(r.Names, name)
+				continue
+			}
+			lo, hi := item, item
+			if i := strings.Index(item, " to "); i >= 0 {
+				lo, hi = strings.TrimSpace(item[:i]), strings.TrimSpace(item[i+len(" to "):])
+			}
+			start, err := reservedNumber(lo, min, max)
+			if err != nil {
+				return nil, err
+			}
+			end, err := reservedNumber(hi, min, max)
+			if err != nil {
+				return nil, err
+			}
+			if start > end {
+				return nil, fmt.Errorf("invalid reserved range %q, must not end before it starts", item)
+			}
+			r.Ranges = append(r.Ranges, [2]int32{start, end})
+		}
+	}
+	return r, nil
+}
+
+func reservedNumber(s string, min, max int32) (int32, error) {
+	if s == "max" {
+		return max, nil
+	}
+	n, err := strconv.ParseInt(s, 10, 32)
+	if err != nil || n < int64(min) || n > int64(max) {
+		return 0, fmt.Errorf("invalid reserved number %q, must be between %d and %d", s, min, max)
+	}
+	return int32(n), nil
+}
+
+// HasNumber returns whether the field or enum value number is reserved.
+func (r *Reserved) HasNumber(n int32) bool {
+	if r == nil {
+		return false
+	}
+	for _, rng := range r.Ranges {
+		if rng[0] <= n && n <= rng[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// HasName returns whether the field or enum value name is reserved.
+func (r *Reserved) HasName(name string) bool {
+	if r == nil {
+		return false
+	}
+	for _, n := range r.Names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
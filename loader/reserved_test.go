@@ -0,0 +1,63 @@
+package loader
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestParseReserved(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    *Reserved
+		wantErr bool
+	}{
+		{"A message.\n", nil, false},
+		{
+			"A message.\n\nReserved: 2, 9 to 11, 100 to max\nReserved: \"foo\", \"bar\"\n",
+			&Reserved{
+				Ranges: [][2]int32{{2, 2}, {9, 11}, {100, MaxFieldNumber}},
+				Names:  []string{"foo", "bar"},
+			},
+			false,
+		},
+		{"Reserved: 0\n", nil, true},
+		{"Reserved: 5 to 3\n", nil, true},
+		{"Reserved: foo\n", nil, true},
+		{"Reserved: \"\"\n", nil, true},
+	}
+	for _, test := range tests {
+		got, err := ParseReserved(test.text)
+		if (err != nil) != test.wantErr {
+			t.Errorf("ParseReserved(%q) error = %v, want error: %v", test.text, err, test.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ParseReserved(%q) = %+v, want %+v", test.text, got, test.want)
+		}
+	}
+	r, _ := ParseReserved("Reserved: 9 to 11, \"foo\"")
+	if !r.HasNumber(10) || r.HasNumber(12) || !r.HasName("foo") || r.HasName("bar") {
+		t.Errorf("unexpected reserved numbers or names of %+v", r)
+	}
+	if (*Reserved)(nil).HasNumber(1) {
+		t.Errorf("nil Reserved has number 1")
+	}
+}
+
+func TestParseEnumReserved(t *testing.T) {
+	got, err := ParseEnumReserved("Reserved: -2 to 0, 5 to max\nReserved: \"FOO\"\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Reserved{
+		Ranges: [][2]int32{{-2, 0}, {5, math.MaxInt32}},
+		Names:  []string{"FOO"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseEnumReserved = %+v, want %+v", got, want)
+	}
+	if _, err := ParseEnumReserved("Reserved: 2147483648\n"); err == nil {
+		t.Errorf("ParseEnumReserved accepted a number overflowing int32")
+	}
+}
@@ -0,0 +1,114 @@
+package loader
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+)
+
+// Root is a module root, and the patterns to load from it.
+type Root struct {
+	// Dir is the directory to load the patterns from.
+	Dir      string
+	Patterns []string
+}
+
+// SplitRoots groups the patterns by the module root they are in, so that
+// packages from several modules, such as a schemas module and a service module
+// which uses it via a replace directive, can be loaded in a single invocation,
+// with a separate Loader for each root.
+//
+// Only file system patterns, which begin with "." or "/", can be in another
+// module than dir's; they are made relative to the root of their module.
+// Other patterns, and those which aren't in a module, are loaded from dir. The
+// roots are returned in the order of their first pattern.
+func SplitRoots(dir string, patterns ...string) ([]Root, error) {
+	base := dir
+	if base == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return nil, err
+		}
+		base = wd
+	}
+	baseRoot := moduleRoot(base)
+	roots := []Root{{Dir: dir}}
+	index := make(map[string]int)
+	for _, p := range patterns {
+		if !isFilePattern(p) || strings.HasSuffix(p, ".gunk") {
+			roots[0].Patterns = append(roots[0].Patterns, p)
+			continue
+		}
+		path, suffix := p, ""
+		if strings.HasSuffix(path, "/...") {
+			path, suffix = strings.TrimSuffix(path, "/..."), "/..."
+		}
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(base, path)
+		}
+		root := moduleRoot(path)
+		if root == "" || root == baseRoot {
+			roots[0].Patterns = append(roots[0].Patterns, p)
+			continue
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return nil, err
+		}
+		i, ok := index[root]
+		if !ok {
+			i = len(roots)
+			index[root] = i
+			roots = append(roots, Root{Dir: root})
+		}
+		if rel == "." {
+			roots[i].Patterns = append(roots[i].Patterns, "."+suffix)
+		} else {
+			roots[i].Patterns = append(roots[i].Patterns, "./"+filepath.ToSlash(rel)+suffix)
+		}
+	}
+	if len(roots[0].Patterns) == 0 && len(roots) > 1 {
+		// All of the patterns are in other modules.
+		roots = roots[1:]
+	}
+	return roots, nil
+}
+
+// isFilePattern reports whether the pattern is a file system path, like the
+// go command does.
+func isFilePattern(p string) bool {
+	return p == "." || p == ".." || strings.HasPrefix(p, "./") || strings.HasPrefix(p, "../") ||
+		filepath.IsAbs(p)
+}
+
+// moduleRoot returns the closest directory containing a go.mod file, starting
+// from dir and going up its parents, or "" if there is none.
+func moduleRoot(dir string) string {
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// ModulePath returns the path of the module containing dir, or "" if it isn't
+// in a module.
+func ModulePath(dir string) string {
+	root := moduleRoot(dir)
+	if root == "" {
+		return ""
+	}
+	data, err := ioutil.ReadFile(filepath.Join(root, "go.mod"))
+	if err != nil {
+		return ""
+	}
+	return modfile.ModulePath(data)
+}
@@ -0,0 +1,57 @@
+package loader
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSplitRoots(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gunk-loader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"service/go.mod", "schemas/go.mod"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte("module testdata.tld/"+filepath.Dir(name)+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	service, schemas := filepath.Join(dir, "service"), filepath.Join(dir, "schemas")
+	tests := []struct {
+		patterns []string
+		want     []Root
+	}{
+		{nil, []Root{{Dir: service}}},
+		{
+			[]string{"./...", "testdata.tld/other", "api.gunk"},
+			[]Root{{Dir: service, Patterns: []string{"./...", "testdata.tld/other", "api.gunk"}}},
+		},
+		{
+			[]string{"./api", "../schemas/...", "../schemas/types", "../schemas"},
+			[]Root{
+				{Dir: service, Patterns: []string{"./api"}},
+				{Dir: schemas, Patterns: []string{"./...", "./types", "."}},
+			},
+		},
+		{
+			[]string{filepath.Join(schemas, "types")},
+			[]Root{{Dir: schemas, Patterns: []string{"./types"}}},
+		},
+	}
+	for _, test := range tests {
+		got, err := SplitRoots(service, test.patterns...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("SplitRoots(%q):\ngot  %+v\nwant %+v", test.patterns, got, test.want)
+		}
+	}
+}
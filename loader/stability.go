@@ -0,0 +1,82 @@
+package loader
+
+import (
+	"fmt"
+	"go/ast"
+	"regexp"
+	"strings"
+)
+
+// Stability holds the stability annotations of a Gunk declaration, which are
+// lines of its documentation such as:
+//
+//	Stability: beta
+//	Since: v1.2.0
+//
+// They may be used on the package clause and on any declaration, such as
+// services, methods, messages, fields, enums and enum values.
+type Stability struct {
+	// Level is the stability level; one of StabilityLevels.
+	Level string `json:"stability,omitempty"`
+	// Since is the version in which the declaration was introduced.
+	Since string `json:"since,omitempty"`
+}
+
+// StabilityLevels are the stability levels, from the least to the most
+// stable.
+var StabilityLevels = []string{"alpha", "beta", "stable"}
+
+// StabilityRank returns the position of level in StabilityLevels, or -1 if
+// it's not a stability level.
+func StabilityRank(level string) int {
+	for i, l := range StabilityLevels {
+		if l == level {
+			return i
+		}
+	}
+	return -1
+}
+
+// sinceRegexp matches the versions used in Since annotations, such as v1,
+// v1.2 or v1.2.3-beta.1.
+var sinceRegexp = regexp.MustCompile(`^v[0-9]+(\.[0-9]+){0,2}(-[0-9A-Za-z.-]+)?$`)
+
+// SplitStability splits the stability annotations from the documentation
+// text, returning the remaining documentation.
+func SplitStability(text string) (string, Stability, error) {
+	var s Stability
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		switch {
+		case strings.HasPrefix(line, "Stability:"):
+			s.Level = strings.TrimSpace(strings.TrimPrefix(line, "Stability:"))
+			if StabilityRank(s.Level) < 0 {
+				return "", s, fmt.Errorf("unknown stability level %q, must be one of %s",
+					s.Level, strings.Join(StabilityLevels, ", "))
+			}
+		case strings.HasPrefix(line, "Since:"):
+			s.Since = strings.TrimSpace(strings.TrimPrefix(line, "Since:"))
+			if !sinceRegexp.MatchString(s.Since) {
+				return "", s, fmt.Errorf("invalid version %q in Since annotation, must be like v1.2.3", s.Since)
+			}
+		default:
+			lines = append(lines, line)
+		}
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n")), s, nil
+}
+
+// validateStability checks the stability annotations of all the declarations
+// in file.
+func (l *Loader) validateStability(pkg *GunkPackage, file *ast.File) {
+	ast.Inspect(file, func(node ast.Node) bool {
+		doc := nodeDoc(node)
+		if doc == nil || *doc == nil {
+			return true
+		}
+		if _, _, err := SplitStability((*doc).Text()); err != nil {
+			pkg.errorf(ValidateError, (*doc).Pos(), l.Fset, "%v", err)
+		}
+		return true
+	})
+}
@@ -0,0 +1,68 @@
+package loader
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+
+	"github.com/gunk/gunk/reflectutil"
+)
+
+// Package returns the import path of the package declaring the tag's type,
+// such as "github.com/gunk/opt/http" for an http.Match tag. It is empty if the
+// tag wasn't type-checked.
+func (t GunkTag) Package() string {
+	named, ok := t.Type.(*types.Named)
+	if !ok || named.Obj().Pkg() == nil {
+		return ""
+	}
+	return named.Obj().Pkg().Path()
+}
+
+// Name returns the name of the tag's type, such as "Match" for an http.Match
+// tag. If the tag wasn't type-checked, the name is taken from the type of its
+// composite literal.
+func (t GunkTag) Name() string {
+	if named, ok := t.Type.(*types.Named); ok {
+		return named.Obj().Name()
+	}
+	lit, ok := t.Expr.(*ast.CompositeLit)
+	if !ok {
+		return ""
+	}
+	switch typ := lit.Type.(type) {
+	case *ast.Ident:
+		return typ.Name
+	case *ast.SelectorExpr:
+		return typ.Sel.Name
+	}
+	return ""
+}
+
+// Option returns the qualified name of the tag's type, such as
+// "github.com/gunk/opt/http.Match". This is the name option tags are matched
+// on, and is the same as Type.String() for type-checked tags.
+func (t GunkTag) Option() string {
+	if pkg := t.Package(); pkg != "" {
+		return pkg + "." + t.Name()
+	}
+	return t.Name()
+}
+
+// Decode decodes the tag's composite literal into v, which must be a pointer
+// to a struct such as an option message. Keys are matched to the fields of v
+// case-insensitively and ignoring underscores, in the same way the options
+// are decoded when generating code.
+func (t GunkTag) Decode(v interface{}) (err error) {
+	if _, ok := t.Expr.(*ast.CompositeLit); !ok {
+		return fmt.Errorf("%s tag must be a composite literal", t.Option())
+	}
+	// reflectutil panics on keys and values which don't fit v.
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("invalid %s tag: %v", t.Option(), r)
+		}
+	}()
+	reflectutil.UnmarshalAST(v, t.Expr)
+	return nil
+}
@@ -0,0 +1,96 @@
+package loader
+
+import (
+	"go/ast"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGunkTag(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gunk-loader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"go.mod": "module testdata.tld/util\n",
+		"opt/opt.gunk": `package opt
+
+type Match struct {
+	Method string
+	Path   string
+}
+`,
+		"api/api.gunk": `package api
+
+import "testdata.tld/util/opt"
+
+type Service interface {
+	// +gunk opt.Match{
+	//         Method: "GET",
+	//         Path:   "/v1/echo",
+	// }
+	Echo()
+}
+`,
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	l := &Loader{Dir: dir, Fset: token.NewFileSet(), Types: true}
+	pkgs, err := l.Load("./api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := Errors(pkgs); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	var tags []GunkTag
+	for _, list := range pkgs[0].GunkTags {
+		tags = append(tags, list...)
+	}
+	if len(tags) != 1 {
+		t.Fatalf("got %d tags, want 1", len(tags))
+	}
+	tag := tags[0]
+	if got, want := tag.Package(), "testdata.tld/util/opt"; got != want {
+		t.Errorf("Package() = %q, want %q", got, want)
+	}
+	if got, want := tag.Name(), "Match"; got != want {
+		t.Errorf("Name() = %q, want %q", got, want)
+	}
+	if got, want := tag.Option(), tag.Type.String(); got != want {
+		t.Errorf("Option() = %q, want %q", got, want)
+	}
+	var match struct{ Method, Path string }
+	if err := tag.Decode(&match); err != nil {
+		t.Fatal(err)
+	}
+	if match.Method != "GET" || match.Path != "/v1/echo" {
+		t.Errorf("Decode() = %+v", match)
+	}
+	var wrong struct{ Method string }
+	err = tag.Decode(&wrong)
+	if err == nil || !strings.Contains(err.Error(), "invalid testdata.tld/util/opt.Match tag") {
+		t.Errorf("Decode() into a struct without Path = %v", err)
+	}
+
+	// Tags which aren't type-checked, as when formatting, only have a name.
+	untyped := GunkTag{Expr: &ast.CompositeLit{
+		Type: &ast.SelectorExpr{X: ast.NewIdent("opt"), Sel: ast.NewIdent("Match")},
+	}}
+	if untyped.Package() != "" || untyped.Name() != "Match" || untyped.Option() != "Match" {
+		t.Errorf("untyped tag: Package() = %q, Name() = %q, Option() = %q",
+			untyped.Package(), untyped.Name(), untyped.Option())
+	}
+}
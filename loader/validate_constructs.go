@@ -0,0 +1,81 @@
+package loader
+
+import (
+	"go/ast"
+	"go/types"
+)
+
+// validateConstructs reports the Go constructs which Gunk doesn't support,
+// such as generics, channel fields and function types, with a suggestion of
+// what to use instead. The errors from go/types or the generator would
+// otherwise be cryptic, if there were any at all.
+func (l *Loader) validateConstructs(pkg *GunkPackage, file *ast.File) {
+	unsupported := func(node ast.Node, what, suggestion string) {
+		pkg.errorf(ValidateError, node.Pos(), l.Fset, "%s is not supported in Gunk; %s", what, suggestion)
+	}
+	// checkType reports the unsupported constructs in the type expression.
+	checkType := func(expr ast.Expr) {
+		ast.Inspect(expr, func(node ast.Node) bool {
+			switch node := node.(type) {
+			case *ast.ChanType:
+				unsupported(node, "channel type "+types.ExprString(node),
+					"use a repeated field instead, or a streaming method by using chan as a method parameter or result")
+				return false
+			case *ast.FuncType:
+				unsupported(node, "function type "+types.ExprString(node),
+					"declare a method in a service interface instead")
+				return false
+			case *ast.IndexExpr, *ast.IndexListExpr:
+				unsupported(node, "generic type "+types.ExprString(node.(ast.Expr)),
+					"declare a message for each type argument instead")
+				return false
+			}
+			return true
+		})
+	}
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			unsupported(decl, "function declaration "+decl.Name.Name,
+				"declare a method in a service interface instead")
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				tspec, ok := spec.(*ast.TypeSpec)
+				if !ok {
+					continue
+				}
+				if tspec.TypeParams != nil {
+					unsupported(tspec.TypeParams, "generic type "+tspec.Name.Name,
+						"declare a message for each type argument instead")
+					continue
+				}
+				iface, ok := tspec.Type.(*ast.InterfaceType)
+				if !ok {
+					checkType(tspec.Type)
+					continue
+				}
+				for _, method := range iface.Methods.List {
+					ftype, ok := method.Type.(*ast.FuncType)
+					if !ok {
+						checkType(method.Type)
+						continue
+					}
+					// Streams are declared with chan parameters and
+					// results.
+					for _, list := range []*ast.FieldList{ftype.Params, ftype.Results} {
+						if list == nil {
+							continue
+						}
+						for _, field := range list.List {
+							if ch, ok := field.Type.(*ast.ChanType); ok {
+								checkType(ch.Value)
+								continue
+							}
+							checkType(field.Type)
+						}
+					}
+				}
+			}
+		}
+	}
+}
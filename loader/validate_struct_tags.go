@@ -3,13 +3,14 @@ package loader
 import (
 	"errors"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 )
 
 // copied from go vet source code
 // https://github.com/golang/tools/blob/master/go/analysis/passes/structtag/structtag.go
-// with added check that only json and pb allowed
+// with added check that only the keys in allowedTagKeys are allowed
 
 var (
 	errTagSyntax      = errors.New("bad syntax for struct tag pair")
@@ -19,6 +20,28 @@ var (
 	errTagSpace       = errors.New("key:\"value\" pairs not separated by spaces")
 )
 
+// allowedTagKeys are the struct tag keys which may be used in Gunk files.
+// Besides pb and json, the keys are shorthands for common field options and
+// for the wire encoding of integer fields.
+var allowedTagKeys = map[string]bool{
+	"pb":       true,
+	"json":     true,
+	"behavior": true,
+	"validate": true,
+	"encoding": true,
+}
+
+// StructTagKeys returns the sorted struct tag keys which may be used in Gunk
+// files.
+func StructTagKeys() []string {
+	keys := make([]string, 0, len(allowedTagKeys))
+	for key := range allowedTagKeys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 // validateStructTag parses the struct tag and returns an error if it is not
 // in the canonical format, which is a space-separated list of key:"value"
 // settings. The value may contain spaces.
@@ -61,8 +84,8 @@ func validateStructTag(tag string) error {
 		}
 
 		key := tag[:i]
-		if !(key == "pb" || key == "json") {
-			return fmt.Errorf("tag %q not allowed, only \"pb\" and \"json\"", key)
+		if !allowedTagKeys[key] {
+			return fmt.Errorf("tag %q not allowed, only \"pb\", \"json\", \"behavior\", \"validate\" and \"encoding\"", key)
 		}
 
 		tag = tag[i+1:]
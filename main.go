@@ -3,14 +3,24 @@ package main
 import (
 	"fmt"
 	"os"
+	"time"
 
+	"github.com/gunk/gunk/assets"
+	"github.com/gunk/gunk/changelog"
+	"github.com/gunk/gunk/conformance"
 	"github.com/gunk/gunk/convert"
+	"github.com/gunk/gunk/create"
 	"github.com/gunk/gunk/dump"
+	"github.com/gunk/gunk/editor"
 	"github.com/gunk/gunk/format"
 	"github.com/gunk/gunk/generate"
 	"github.com/gunk/gunk/generate/downloader"
 	"github.com/gunk/gunk/lint"
 	"github.com/gunk/gunk/log"
+	"github.com/gunk/gunk/migrate"
+	"github.com/gunk/gunk/snapshot"
+	"github.com/gunk/gunk/stability"
+	"github.com/gunk/gunk/stats"
 	"github.com/gunk/gunk/vetconfig"
 	"github.com/spf13/cobra"
 )
@@ -39,6 +49,7 @@ func run() error {
 		Short: "Print the version number of gundk",
 		Run: func(cmd *cobra.Command, args []string) {
 			fmt.Fprintln(os.Stdout, "gunk", version)
+			fmt.Fprintln(os.Stdout, "googleapis", assets.GoogleapisVersion)
 		},
 	}
 	app.AddCommand(versionCmd)
@@ -51,27 +62,101 @@ func run() error {
 		},
 	}
 	generateCmd.Flags().BoolVarP(&log.PrintCommands, "print-commands", "x", false, "Print the commands")
-	generateCmd.Flags().BoolVarP(&log.Verbose, "verbose", "v", false, "Print the names of packages are they are generated")
+	generateCmd.Flags().BoolVarP(&log.Verbose, "verbose", "v", false, "Print the names of packages as they are generated, and of the files written")
+	generateCmd.Flags().BoolVarP(&generate.DryRun, "dry-run", "n", false, "Print the files which would be created or modified, without writing them")
+	generateCmd.Flags().BoolVarP(&generate.Diff, "diff", "d", false, "Print diffs of the files which would be created or modified, without writing them, and fail if there are any")
+	generateCmd.Flags().BoolVarP(&generate.Local, "local", "l", false, "Only generate the package in the current directory, with its own .gunkconfig, such as via go:generate")
 	app.AddCommand(generateCmd)
+	// clean command
+	cleanCmd := &cobra.Command{
+		Use:   "clean [patterns]",
+		Short: "Generate Gunk packages and remove stale generated files",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			generate.Cleaning = true
+			return generate.Run("", args...)
+		},
+	}
+	cleanCmd.Flags().BoolVarP(&log.Verbose, "verbose", "v", false, "Print the names of packages as they are generated, and of the files written and removed")
+	cleanCmd.Flags().BoolVarP(&generate.DryRun, "dry-run", "n", false, "Print the files which would be created, modified or removed, without changing them")
+	app.AddCommand(cleanCmd)
 	// convert command
-	var overwrite bool
+	var overwrite, recursive bool
+	var convertOut, convertFrom string
 	convertCmd := &cobra.Command{
-		Use:   "convert [-overwrite] [file | directory]...",
+		Use:   "convert [-overwrite] [-r] [--from proto|openapi] [--http-config api_config.yaml] [--out dir] [file | directory | image.binpb]...",
 		Short: "Convert Proto file to Gunk file.",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return convert.Run(args, overwrite)
+			switch convertFrom {
+			case "proto":
+			case "openapi":
+				if recursive {
+					return fmt.Errorf("-r can't be used with --from=openapi")
+				}
+				if convert.HTTPConfig != "" {
+					return fmt.Errorf("--http-config can't be used with --from=openapi")
+				}
+				return convert.RunOpenAPI(args, convertOut, overwrite)
+			default:
+				return fmt.Errorf("unknown format %q, should be proto or openapi", convertFrom)
+			}
+			if recursive {
+				return convert.RunRecursive(args, convertOut, overwrite)
+			}
+			return convert.Run(args, convertOut, overwrite)
 		},
 	}
 	convertCmd.Flags().BoolVarP(&overwrite, "overwrite", "w", false, "Overwrite the converted Gunk file if it exists.")
+	convertCmd.Flags().BoolVarP(&recursive, "recursive", "r", false, "Convert the trees of proto files in the directories, such as ./proto/..., to Gunk packages.")
+	convertCmd.Flags().StringVar(&convertOut, "out", "", "Directory to write the Gunk packages converted with -r, from a descriptor set or from OpenAPI specs to, instead of the directory of the files converted.")
+	convertCmd.Flags().StringVar(&convert.HTTPConfig, "http-config", "", "gRPC API configuration file, such as grpc-gateway's grpc_api_configuration, whose HTTP rules to convert to http.Match tags.")
+	convertCmd.Flags().StringVar(&convertFrom, "from", "proto", "Format of the files to convert: proto, or openapi for OpenAPI 3 and Swagger 2 specs.")
 	app.AddCommand(convertCmd)
+	// new command
+	newCmd := cobra.Command{
+		Use:   "new",
+		Short: "Scaffold new Gunk code",
+	}
+	var newService, newDir string
+	newPackageCmd := cobra.Command{
+		Use:   "package <import path>",
+		Short: "Scaffold a new Gunk package and its .gunkconfig",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return create.Package(args[0], newService, newDir)
+		},
+	}
+	newPackageCmd.Flags().StringVar(&newService, "service", "", "Name of a service to declare with a sample method")
+	newPackageCmd.Flags().StringVar(&newDir, "dir", "", "Directory of the package (derived from go.mod if empty)")
+	newCmd.AddCommand(&newPackageCmd)
+	app.AddCommand(&newCmd)
+	// migrate command
+	var migrateYes bool
+	migrateCmd := &cobra.Command{
+		Use:   "migrate [-y] [directory]",
+		Short: "Migrate a repository of Proto files to Gunk",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := "."
+			if len(args) > 0 {
+				dir = args[0]
+			}
+			return migrate.Run(dir, migrateYes)
+		},
+	}
+	migrateCmd.Flags().BoolVarP(&migrateYes, "yes", "y", false, "Apply the migration plan without asking")
+	app.AddCommand(migrateCmd)
 	// format command
 	formatCmd := &cobra.Command{
-		Use:   "format [patterns]",
+		Use:   "format [patterns | -]",
 		Short: "Format Gunk code",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return format.Run("", args...)
 		},
 	}
+	formatCmd.Flags().StringVar(&format.StdinFilename, "stdin-filename", "", "Path of the file read from standard input, to use its .gunkconfig and name")
+	formatCmd.Flags().BoolVar(&format.AssignTags, "assign-tags", false, "Assign the numbers after the highest one of each message to fields without a pb tag")
+	formatCmd.Flags().BoolVarP(&format.List, "list", "l", false, "List the files which aren't formatted, without writing them, and fail if there are any")
+	formatCmd.Flags().BoolVarP(&format.Diff, "diff", "d", false, "Print diffs of the changes formatting would make, without writing them, and fail if there are any")
 	app.AddCommand(formatCmd)
 	// dump command
 	var dumpFormat string
@@ -109,16 +194,20 @@ func run() error {
 	}
 	// download proto command
 	var dlProtocPath, dlProtocVer string
+	var dlProtocOpts downloader.ProtocOptions
 	downloadProtocCmd := cobra.Command{
 		Use:   "protoc",
 		Short: "Download protoc",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return downloadProtoc(dlProtocPath, dlProtocVer)
+			_, err := downloader.CheckOrDownloadProtoc(dlProtocPath, dlProtocVer, dlProtocOpts)
+			return err
 		},
 	}
 	downloadProtocCmd.Flags().StringVar(&dlProtocPath, "path", "", "Path to check for protoc binary, or where to download it to")
 	downloadProtocCmd.Flags().BoolVarP(&log.Verbose, "verbose", "v", false, "Print details of download tools")
 	downloadProtocCmd.Flags().StringVar(&dlProtocVer, "version", "", "Version of protoc to use")
+	downloadProtocCmd.Flags().StringSliceVar(&dlProtocOpts.SHA256, "sha256", nil, "Accepted SHA-256 checksums of the protoc binary")
+	downloadProtocCmd.Flags().StringVar(&dlProtocOpts.Mirror, "mirror", "", "Base URL or directory of the protoc releases to download from")
 	downloadCmd.AddCommand(&downloadAllCmd, &downloadProtocCmd)
 	app.AddCommand(&downloadCmd)
 	// vet command
@@ -134,6 +223,29 @@ func run() error {
 		},
 	}
 	app.AddCommand(&vetCmd)
+	// config command
+	configCmd := cobra.Command{
+		Use:   "config [patterns]",
+		Short: "Print the effective configuration of Gunk packages as JSON",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return generate.PrintConfig(os.Stdout, "", args...)
+		},
+	}
+	app.AddCommand(&configCmd)
+	// editor command
+	editorCmd := cobra.Command{
+		Use:   "editor [directory]",
+		Short: "Write syntax highlighting support for editors",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := "gunk-editor"
+			if len(args) > 0 {
+				dir = args[0]
+			}
+			return editor.Run(dir, version)
+		},
+	}
+	app.AddCommand(&editorCmd)
 	// lint command
 	var enableLint, disableLint string
 	var listLinters bool
@@ -152,10 +264,94 @@ func run() error {
 	lintCmd.Flags().StringVar(&disableLint, "disable", "", "Linters to disable separated by comma, overrides enable")
 	lintCmd.Flags().BoolVarP(&listLinters, "list", "l", false, "List all linters and exit")
 	app.AddCommand(&lintCmd)
-	return app.Execute()
+	// stability command
+	var snapshotPath string
+	var updateSnapshot bool
+	stabilityCmd := cobra.Command{
+		Use:   "stability [patterns]",
+		Short: "Check that stability annotations evolve monotonically",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return stability.Run("", snapshotPath, updateSnapshot, args...)
+		},
+	}
+	stabilityCmd.Flags().StringVar(&snapshotPath, "snapshot", "stability.json", "Snapshot of the annotations to check against")
+	stabilityCmd.Flags().BoolVarP(&updateSnapshot, "update", "u", false, "Update the snapshot if the check passes")
+	app.AddCommand(&stabilityCmd)
+	// changelog command
+	var staged bool
+	changelogCmd := cobra.Command{
+		Use:   "changelog [--staged]",
+		Short: "Summarize the changes to Gunk files as a commit message",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return changelog.Run(os.Stdout, "", staged)
+		},
+	}
+	changelogCmd.Flags().BoolVar(&staged, "staged", false, "Only summarize the changes staged for commit")
+	app.AddCommand(&changelogCmd)
+	// snapshot command
+	snapshotCmd := cobra.Command{
+		Use:   "snapshot",
+		Short: "Archive the resolved schema, and diff or document against archives",
+	}
+	var snapshotOut, snapshotVersion string
+	snapshotSaveCmd := cobra.Command{
+		Use:   "save [patterns]",
+		Short: "Archive the resolved schema of Gunk packages",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return snapshot.Save("", snapshotOut, snapshotVersion, args...)
+		},
+	}
+	snapshotSaveCmd.Flags().StringVarP(&snapshotOut, "output", "o", "schema.snapshot", "File to write the snapshot to")
+	snapshotSaveCmd.Flags().StringVar(&snapshotVersion, "version", "", "Version to label the snapshot with, such as v1.2.0")
+	var breakingOnly bool
+	snapshotDiffCmd := cobra.Command{
+		Use:   "diff <old snapshot> [new snapshot]",
+		Short: "List the changes since a snapshot, to the working tree or to a newer snapshot",
+		Args:  cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			newPath := ""
+			if len(args) > 1 {
+				newPath = args[1]
+			}
+			return snapshot.Diff(os.Stdout, "", args[0], newPath, breakingOnly)
+		},
+	}
+	snapshotDiffCmd.Flags().BoolVar(&breakingOnly, "breaking", false, "Only list breaking changes, and fail if there are any")
+	var snapshotDocOut, snapshotDocFormat string
+	snapshotDocCmd := cobra.Command{
+		Use:   "doc <snapshot>",
+		Short: "Write the documentation of an archived schema",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return snapshot.Doc(args[0], snapshotDocOut, snapshotDocFormat)
+		},
+	}
+	snapshotDocCmd.Flags().StringVarP(&snapshotDocOut, "output", "o", "docs", "Directory to write the documentation to")
+	snapshotDocCmd.Flags().StringVarP(&snapshotDocFormat, "format", "f", "json", "output format: [json | asciidoc | rst]")
+	snapshotCmd.AddCommand(&snapshotSaveCmd, &snapshotDiffCmd, &snapshotDocCmd)
+	app.AddCommand(&snapshotCmd)
+	// conformance command
+	var runCases string
+	conformanceCmd := cobra.Command{
+		Use:   "conformance",
+		Short: "Check that Gunk types round-trip through protobuf JSON as documented",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return conformance.Run(os.Stdout, runCases)
+		},
+	}
+	conformanceCmd.Flags().StringVar(&runCases, "run", "", "Only run the cases whose names match the regular expression")
+	app.AddCommand(&conformanceCmd)
+	start := time.Now()
+	cmd, err := app.ExecuteC()
+	if statsErr := stats.Record(cmd.CommandPath(), version, start, err == nil); statsErr != nil {
+		fmt.Fprintf(os.Stderr, "unable to record stats: %v\n", statsErr)
+	}
+	return err
 }
 
 func downloadProtoc(path, version string) error {
-	_, err := downloader.CheckOrDownloadProtoc(path, version)
+	_, err := downloader.CheckOrDownloadProtoc(path, version, downloader.ProtocOptions{})
 	return err
 }
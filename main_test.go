@@ -8,11 +8,15 @@ import (
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"strings"
 	"testing"
 
 	"github.com/gunk/gunk/generate"
+	"github.com/gunk/gunk/plugin"
 	"github.com/rogpeppe/go-internal/gotooltest"
 	"github.com/rogpeppe/go-internal/testscript"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/pluginpb"
 )
 
 var write = flag.Bool("w", false, "overwrite testdata output files")
@@ -37,7 +41,37 @@ func TestMain(m *testing.M) {
 			fmt.Printf("%+v\n", os.Environ())
 			panic(err)
 		}
+		// protoc-gen-strict is also compiled to WASI, to be run as a
+		// wasm plugin.
+		cmd = exec.Command("go", "build", "-ldflags=-w -s",
+			"-o", filepath.Join(binDir, "protoc-gen-strict.wasm"),
+			"./testdata/protoc-gen-strict",
+		)
+		cmd.Env = append(os.Environ(), "GOOS=wasip1", "GOARCH=wasm")
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			panic(err)
+		}
 	}
+	// Register a generator, as a program embedding gunk would.
+	plugin.Register("registered", func(req *pluginpb.CodeGeneratorRequest) (*pluginpb.CodeGeneratorResponse, error) {
+		if req.GetParameter() == "fail" {
+			return nil, fmt.Errorf("failing as requested")
+		}
+		if pos := strings.TrimPrefix(req.GetParameter(), "error_at="); pos != req.GetParameter() {
+			// Report an error at a position of the proto file.
+			return &pluginpb.CodeGeneratorResponse{
+				Error: proto.String(req.FileToGenerate[0] + ":" + pos + ": unsupported declaration"),
+			}, nil
+		}
+		content := req.GetParameter() + "\n" + strings.Join(req.FileToGenerate, "\n") + "\n"
+		return &pluginpb.CodeGeneratorResponse{
+			File: []*pluginpb.CodeGeneratorResponse_File{{
+				Name:    proto.String("registered.txt"),
+				Content: proto.String(content),
+			}},
+		}, nil
+	})
 	os.Exit(testscript.RunMain(m, map[string]func() int{
 		"gunk": func() int {
 			if err := run(); err != nil {
@@ -131,6 +165,10 @@ func TestScripts(t *testing.T) {
 		t.Fatal(err)
 	}
 	goCache := filepath.Join(os.TempDir(), "gunk-test-go-cache")
+	binDir, err := filepath.Abs(".cache")
+	if err != nil {
+		t.Fatal(err)
+	}
 	p := testscript.Params{
 		Dir: filepath.Join("testdata", "scripts"),
 		Setup: func(e *testscript.Env) error {
@@ -148,6 +186,7 @@ func TestScripts(t *testing.T) {
 				"GUNK_CACHE_DIR="+cacheDir,
 				"TESTSCRIPT_ON=on",
 				"HOME="+goCache,
+				"STRICT_WASM="+filepath.Join(binDir, "protoc-gen-strict.wasm"),
 			)
 			return nil
 		},
@@ -0,0 +1,179 @@
+package migrate
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Generator is a generate section of the .gunkconfig.
+type Generator struct {
+	// Name is the generator, as in "[generate <name>]".
+	Name string
+	// Out is the output directory, relative to the repository root.
+	Out string
+	// Params are the plugin parameters, as "name=value" pairs.
+	Params []string
+}
+
+func (g *Generator) write(sb *strings.Builder) {
+	fmt.Fprintf(sb, "[generate %s]\n", g.Name)
+	if g.Out != "" && g.Out != "." {
+		fmt.Fprintf(sb, "out=%s\n", g.Out)
+	}
+	for _, param := range g.Params {
+		fmt.Fprintf(sb, "%s\n", param)
+	}
+}
+
+// pluginNames maps the names of protoc plugins to the names of the Gunk
+// generators producing the same output.
+var pluginNames = map[string]string{
+	"go-grpc": "grpc-go",
+}
+
+// addGenerator adds a generator for the protoc plugin name, unless an
+// equivalent one was already found.
+func (p *Plan) addGenerator(source, name, out string, params []string) {
+	if gunkName, ok := pluginNames[name]; ok {
+		name = gunkName
+	}
+	out = strings.TrimSuffix(path.Clean(out), "/")
+	for _, gen := range p.Generators {
+		if gen.Name == name && gen.Out == out {
+			return
+		}
+	}
+	for _, param := range params {
+		if param == "paths=source_relative" {
+			p.followUp("%s: the %s generator used paths=source_relative; check that the files Gunk generates are placed where expected", source, name)
+		}
+	}
+	p.Generators = append(p.Generators, &Generator{
+		Name:   name,
+		Out:    out,
+		Params: params,
+	})
+}
+
+// bufGen is the subset of a buf.gen.yaml used to find the generators.
+type bufGen struct {
+	Version string `yaml:"version"`
+	Plugins []struct {
+		Name   string      `yaml:"name"`
+		Plugin string      `yaml:"plugin"`
+		Remote string      `yaml:"remote"`
+		Out    string      `yaml:"out"`
+		Opt    interface{} `yaml:"opt"`
+	} `yaml:"plugins"`
+}
+
+// addBufGen adds the generators of the buf.gen.yaml file at filename.
+func (p *Plan) addBufGen(filename string) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	source := p.rel(filename)
+	var cfg bufGen
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		p.followUp("%s could not be parsed: %v", source, err)
+		return nil
+	}
+	for _, plugin := range cfg.Plugins {
+		name := plugin.Name
+		if name == "" {
+			name = plugin.Plugin
+		}
+		if plugin.Remote != "" || strings.Contains(name, "/") {
+			// Remote plugins such as buf.build/protocolbuffers/go,
+			// optionally with a version suffix.
+			remote := plugin.Remote
+			if remote == "" {
+				remote = name
+			}
+			name = path.Base(remote)
+			if i := strings.Index(name, ":"); i >= 0 {
+				name = name[:i]
+			}
+			p.followUp("%s: the remote plugin %s is run as the local generator %q; install protoc-gen-%s", source, remote, name, name)
+		}
+		if name == "" {
+			continue
+		}
+		var params []string
+		switch opt := plugin.Opt.(type) {
+		case string:
+			params = splitParams(opt)
+		case []interface{}:
+			for _, o := range opt {
+				params = append(params, splitParams(fmt.Sprint(o))...)
+			}
+		}
+		p.addGenerator(source, name, plugin.Out, params)
+	}
+	return nil
+}
+
+var (
+	// protocOutRegexp matches the protoc output flags, such as
+	// --go_out=plugins=grpc:gen/go.
+	protocOutRegexp = regexp.MustCompile(`--([\w-]+)_out[= ]([^\s'"]+)`)
+	// protocOptRegexp matches the protoc plugin parameter flags, such as
+	// --go_opt=paths=source_relative.
+	protocOptRegexp = regexp.MustCompile(`--([\w-]+)_opt[= ]([^\s'"]+)`)
+)
+
+// addProtocInvocations adds the generators of the protoc commands run from
+// the file at filename, such as a Makefile, a shell script or the go:generate
+// directives of a Go file.
+func (p *Plan) addProtocInvocations(filename string) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(string(data), "protoc") {
+		return nil
+	}
+	source := p.rel(filename)
+	for _, line := range strings.Split(string(data), "\n") {
+		if !strings.Contains(line, "protoc") {
+			continue
+		}
+		if strings.HasSuffix(filename, ".go") && !strings.Contains(line, "//go:generate") {
+			continue
+		}
+		opts := make(map[string][]string)
+		for _, m := range protocOptRegexp.FindAllStringSubmatch(line, -1) {
+			opts[m[1]] = append(opts[m[1]], splitParams(m[2])...)
+		}
+		for _, m := range protocOutRegexp.FindAllStringSubmatch(line, -1) {
+			name, out := m[1], m[2]
+			var params []string
+			if i := strings.LastIndex(out, ":"); i >= 0 {
+				params = splitParams(out[:i])
+				out = out[i+1:]
+			}
+			if strings.Contains(out, "$") {
+				p.followUp("%s: the output directory %s of the %s generator uses variables; set its out manually", source, out, name)
+			}
+			p.addGenerator(source, name, out, append(params, opts[name]...))
+		}
+	}
+	return nil
+}
+
+// splitParams splits a comma separated list of plugin parameters.
+func splitParams(s string) []string {
+	var params []string
+	for _, param := range strings.Split(s, ",") {
+		if param = strings.TrimSpace(param); param != "" {
+			params = append(params, param)
+		}
+	}
+	return params
+}
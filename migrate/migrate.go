@@ -0,0 +1,299 @@
+package migrate
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/emicklei/proto"
+	"github.com/gunk/gunk/convert"
+)
+
+// ReportFilename is the name of the report left in the migrated directory.
+const ReportFilename = "gunk-migration.md"
+
+// skippedDirs are the directories which are never scanned for proto files.
+var skippedDirs = map[string]bool{
+	".git":         true,
+	"node_modules": true,
+	"vendor":       true,
+}
+
+// Plan is the conversion plan of a repository.
+type Plan struct {
+	// Dir is the root directory of the repository.
+	Dir string
+	// Packages are the directories holding proto files, which are converted
+	// to Gunk packages.
+	Packages []*Package
+	// Generators are the generate sections of the .gunkconfig to write,
+	// matching the outputs of the existing build configuration.
+	Generators []*Generator
+	// FollowUps are the manual follow-ups found while scanning and
+	// converting the repository.
+	FollowUps []string
+}
+
+// Package is a directory of proto files converted to a Gunk package.
+type Package struct {
+	// Dir is the directory relative to the repository root, using
+	// forward slashes.
+	Dir string
+	// ProtoPackage is the proto package declared by the files.
+	ProtoPackage string
+	// Files are the proto files in the directory.
+	Files []string
+	// Skip is set to the reason why the package can't be converted.
+	Skip string
+	// Verified is set once the converted package was checked against the
+	// original proto files, and Differences holds what didn't match.
+	Verified    bool
+	Differences []string
+}
+
+// Run scans the repository in dir for proto files and code generation
+// configuration, proposes a conversion plan and, once confirmed, converts the
+// proto files to Gunk, writes a matching .gunkconfig and verifies the result.
+// The plan is applied without asking if yes is set.
+func Run(dir string, yes bool) error {
+	return run(dir, yes, os.Stdin, os.Stdout)
+}
+
+func run(dir string, yes bool, in io.Reader, out io.Writer) error {
+	plan, err := Scan(dir)
+	if err != nil {
+		return err
+	}
+	if len(plan.Packages) == 0 {
+		return fmt.Errorf("no .proto files found in %s", dir)
+	}
+	plan.print(out)
+	if !yes {
+		fmt.Fprint(out, "\nApply this plan? [y/N] ")
+		answer, _ := bufio.NewReader(in).ReadString('\n')
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "y", "yes":
+		default:
+			fmt.Fprintln(out, "migration aborted")
+			return nil
+		}
+	}
+	if err := plan.Apply(); err != nil {
+		return err
+	}
+	report := filepath.Join(plan.Dir, ReportFilename)
+	if err := ioutil.WriteFile(report, plan.report(), 0o644); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "migration done; see %s for the manual follow-ups\n", report)
+	return nil
+}
+
+// Scan builds the conversion plan of the repository in dir.
+func Scan(dir string) (*Plan, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	plan := &Plan{Dir: dir}
+	pkgs := make(map[string]*Package)
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != dir && skippedDirs[info.Name()] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		switch {
+		case filepath.Ext(path) == ".proto":
+			return plan.addProto(pkgs, path)
+		case info.Name() == "buf.gen.yaml":
+			return plan.addBufGen(path)
+		case info.Name() == "buf.yaml" || info.Name() == "buf.work.yaml":
+			plan.followUp("%s has no Gunk equivalent; port its lint and breaking change settings manually", plan.rel(path))
+		case info.Name() == "Makefile" || filepath.Ext(path) == ".sh" || filepath.Ext(path) == ".go":
+			return plan.addProtocInvocations(path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, pkg := range pkgs {
+		plan.Packages = append(plan.Packages, pkg)
+	}
+	sort.Slice(plan.Packages, func(i, j int) bool {
+		return plan.Packages[i].Dir < plan.Packages[j].Dir
+	})
+	if len(plan.Generators) == 0 {
+		plan.Generators = []*Generator{{Name: "go"}}
+		plan.followUp("no buf.gen.yaml or protoc invocation found; only Go code will be generated")
+	}
+	for _, name := range []string{".gunkconfig", "gunk.yaml"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			plan.followUp("%s already exists and was left untouched; add the proposed generators to it manually", name)
+		}
+	}
+	return plan, nil
+}
+
+// addProto adds the proto file at path to the package of its directory.
+func (p *Plan) addProto(pkgs map[string]*Package, path string) error {
+	rel := p.rel(filepath.Dir(path))
+	pkg := pkgs[rel]
+	if pkg == nil {
+		pkg = &Package{Dir: rel}
+		pkgs[rel] = pkg
+	}
+	pkg.Files = append(pkg.Files, filepath.Base(path))
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	def, err := proto.NewParser(f).Parse()
+	if err != nil {
+		pkg.Skip = fmt.Sprintf("%s could not be parsed: %v", filepath.Base(path), err)
+		return nil
+	}
+	var name string
+	hasGoPackage := false
+	proto.Walk(def,
+		proto.WithPackage(func(p *proto.Package) { name = p.Name }),
+		proto.WithOption(func(o *proto.Option) {
+			if o.Name == "go_package" {
+				hasGoPackage = true
+			}
+		}),
+	)
+	if !hasGoPackage {
+		p.followUp("%s has no go_package option; Gunk files importing it won't be able to refer to it", p.rel(path))
+	}
+	switch {
+	case pkg.Skip != "":
+	case pkg.ProtoPackage == "":
+		pkg.ProtoPackage = name
+	case pkg.ProtoPackage != name:
+		pkg.Skip = fmt.Sprintf("the files declare more than one proto package (%s and %s), which a Gunk package can't hold", pkg.ProtoPackage, name)
+	}
+	return nil
+}
+
+// Apply executes the plan: it converts the packages, writes the .gunkconfig
+// and verifies the converted packages against the original proto files.
+func (p *Plan) Apply() error {
+	for _, pkg := range p.Packages {
+		if pkg.Skip != "" {
+			p.followUp("%s was not converted: %s", pkg.Dir, pkg.Skip)
+			continue
+		}
+		var paths []string
+		for _, name := range pkg.Files {
+			path := filepath.Join(p.Dir, filepath.FromSlash(pkg.Dir), name)
+			if _, err := os.Stat(strings.TrimSuffix(path, ".proto") + ".gunk"); err == nil {
+				p.followUp("%s already exists and was not overwritten", p.rel(strings.TrimSuffix(path, ".proto")+".gunk"))
+				continue
+			}
+			paths = append(paths, path)
+		}
+		if err := convert.Run(paths, "", false); err != nil {
+			pkg.Skip = err.Error()
+			p.followUp("%s could not be converted: %v", pkg.Dir, err)
+		}
+	}
+	cfgPath := filepath.Join(p.Dir, ".gunkconfig")
+	_, yamlErr := os.Stat(filepath.Join(p.Dir, "gunk.yaml"))
+	if _, err := os.Stat(cfgPath); os.IsNotExist(err) && os.IsNotExist(yamlErr) {
+		if err := ioutil.WriteFile(cfgPath, p.gunkconfig(), 0o644); err != nil {
+			return err
+		}
+	}
+	for _, pkg := range p.Packages {
+		if pkg.Skip != "" {
+			continue
+		}
+		if err := p.verify(pkg); err != nil {
+			p.followUp("%s could not be verified: %v", pkg.Dir, err)
+		}
+	}
+	for _, pkg := range p.Packages {
+		if pkg.Skip == "" {
+			p.followUp("remove the .proto files in %s once the generated code is confirmed to match", pkg.Dir)
+		}
+	}
+	return nil
+}
+
+func (p *Plan) gunkconfig() []byte {
+	var sb strings.Builder
+	for i, gen := range p.Generators {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		gen.write(&sb)
+	}
+	return []byte(sb.String())
+}
+
+func (p *Plan) print(w io.Writer) {
+	fmt.Fprintf(w, "Migration plan for %s:\n\nPackages:\n", p.Dir)
+	for _, pkg := range p.Packages {
+		if pkg.Skip != "" {
+			fmt.Fprintf(w, "  %s: skipped, %s\n", pkg.Dir, pkg.Skip)
+			continue
+		}
+		fmt.Fprintf(w, "  %s (%s): %s\n", pkg.Dir, pkg.ProtoPackage, strings.Join(pkg.Files, ", "))
+	}
+	fmt.Fprintf(w, "\n.gunkconfig:\n")
+	for _, line := range strings.Split(strings.TrimSpace(string(p.gunkconfig())), "\n") {
+		fmt.Fprintf(w, "  %s\n", line)
+	}
+}
+
+func (p *Plan) report() []byte {
+	var sb strings.Builder
+	sb.WriteString("# Gunk migration report\n\n## Packages\n\n")
+	for _, pkg := range p.Packages {
+		switch {
+		case pkg.Skip != "":
+			fmt.Fprintf(&sb, "- `%s`: not converted\n", pkg.Dir)
+		case !pkg.Verified:
+			fmt.Fprintf(&sb, "- `%s`: converted, not verified\n", pkg.Dir)
+		case len(pkg.Differences) == 0:
+			fmt.Fprintf(&sb, "- `%s`: converted and verified\n", pkg.Dir)
+		default:
+			fmt.Fprintf(&sb, "- `%s`: converted with %d differences\n", pkg.Dir, len(pkg.Differences))
+			for _, diff := range pkg.Differences {
+				fmt.Fprintf(&sb, "  - %s\n", diff)
+			}
+		}
+	}
+	sb.WriteString("\n## .gunkconfig\n\n```ini\n")
+	sb.Write(p.gunkconfig())
+	sb.WriteString("```\n\n## Manual follow-ups\n\n")
+	for _, f := range p.FollowUps {
+		fmt.Fprintf(&sb, "- %s\n", f)
+	}
+	return []byte(sb.String())
+}
+
+func (p *Plan) followUp(format string, args ...interface{}) {
+	p.FollowUps = append(p.FollowUps, fmt.Sprintf(format, args...))
+}
+
+// rel returns path relative to the repository root, using forward slashes.
+func (p *Plan) rel(path string) string {
+	rel, err := filepath.Rel(p.Dir, path)
+	if err != nil {
+		return path
+	}
+	return filepath.ToSlash(rel)
+}
@@ -0,0 +1,152 @@
+package migrate
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/gunk/gunk/config"
+	"github.com/gunk/gunk/generate"
+	"github.com/gunk/gunk/generate/downloader"
+	"github.com/gunk/gunk/loader"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// verify checks that the converted Gunk package describes the same messages,
+// enums and services as the original proto files, recording the differences.
+func (p *Plan) verify(pkg *Package) error {
+	cfg, err := config.Load(p.Dir)
+	if err != nil {
+		return err
+	}
+	protocPath, err := downloader.CheckOrDownloadProtoc(cfg.ProtocPath, cfg.ProtocVersion, downloader.ProtocOptions{
+		SHA256: cfg.ProtocSHA256,
+		Mirror: cfg.ProtocMirror,
+	})
+	if err != nil {
+		return err
+	}
+	protoLoader := &loader.ProtoLoader{
+		Dir:          p.Dir,
+		ProtocPath:   protocPath,
+		IncludePaths: cfg.IncludePaths,
+	}
+	if dir := downloader.ProtocIncludeDir(protocPath); dir != "" {
+		protoLoader.IncludePaths = append(protoLoader.IncludePaths, dir)
+	}
+	var names []string
+	for _, name := range pkg.Files {
+		names = append(names, path.Join(pkg.Dir, name))
+	}
+	files, err := protoLoader.LoadProto(names...)
+	if err != nil {
+		return err
+	}
+	original := make(map[string]string)
+	for _, f := range files {
+		for _, name := range names {
+			if f.GetName() == name {
+				summarize(original, pkg.ProtoPackage, f)
+			}
+		}
+	}
+	fds, err := generate.FileDescriptorSet(p.Dir, "./"+pkg.Dir)
+	if err != nil {
+		return err
+	}
+	converted := make(map[string]string)
+	for _, f := range fds.File {
+		if f.GetPackage() == pkg.ProtoPackage && strings.HasSuffix(f.GetName(), "/all.proto") {
+			summarize(converted, pkg.ProtoPackage, f)
+		}
+	}
+	pkg.Verified = true
+	for _, key := range sortedKeys(original) {
+		conv, ok := converted[key]
+		switch {
+		case !ok:
+			pkg.Differences = append(pkg.Differences, fmt.Sprintf("%s is missing", key))
+		case conv != original[key]:
+			pkg.Differences = append(pkg.Differences, fmt.Sprintf("%s differs: %s, was %s", key, conv, original[key]))
+		}
+	}
+	for _, key := range sortedKeys(converted) {
+		if _, ok := original[key]; !ok {
+			pkg.Differences = append(pkg.Differences, fmt.Sprintf("%s was added", key))
+		}
+	}
+	return nil
+}
+
+// summarize records the messages, enums and services of f in m, keyed by
+// their kind and name. Nested types are flattened, as Gunk declares them at
+// the top level joined with an underscore.
+func summarize(m map[string]string, pkg string, f *descriptorpb.FileDescriptorProto) {
+	var addMessage func(prefix string, msg *descriptorpb.DescriptorProto)
+	addEnum := func(prefix string, enum *descriptorpb.EnumDescriptorProto) {
+		var values []string
+		for _, v := range enum.Value {
+			values = append(values, fmt.Sprint(v.GetNumber()))
+		}
+		m["enum "+prefix+enum.GetName()] = strings.Join(values, " ")
+	}
+	addMessage = func(prefix string, msg *descriptorpb.DescriptorProto) {
+		name := prefix + msg.GetName()
+		var fields []string
+		for _, f := range msg.Field {
+			field := fmt.Sprintf("%d:%s", f.GetNumber(), strings.ToLower(strings.TrimPrefix(f.GetType().String(), "TYPE_")))
+			if f.GetLabel() == descriptorpb.FieldDescriptorProto_LABEL_REPEATED {
+				field = "repeated " + field
+			}
+			if f.TypeName != nil {
+				field += "(" + typeName(pkg, f.GetTypeName()) + ")"
+			}
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		m["message "+name] = "{" + strings.Join(fields, " ") + "}"
+		for _, nested := range msg.NestedType {
+			addMessage(name+"_", nested)
+		}
+		for _, enum := range msg.EnumType {
+			addEnum(name+"_", enum)
+		}
+	}
+	for _, msg := range f.MessageType {
+		addMessage("", msg)
+	}
+	for _, enum := range f.EnumType {
+		addEnum("", enum)
+	}
+	for _, srv := range f.Service {
+		for _, method := range srv.Method {
+			sig := fmt.Sprintf("(%s) %s", typeName(pkg, method.GetInputType()), typeName(pkg, method.GetOutputType()))
+			if method.GetClientStreaming() {
+				sig = "client streaming " + sig
+			}
+			if method.GetServerStreaming() {
+				sig = "server streaming " + sig
+			}
+			m["method "+srv.GetName()+"."+method.GetName()] = sig
+		}
+	}
+}
+
+// typeName returns the name of a referenced type, flattening the names of
+// the types declared in pkg as Gunk does.
+func typeName(pkg, name string) string {
+	if strings.HasPrefix(name, "."+pkg+".") {
+		return strings.ReplaceAll(strings.TrimPrefix(name, "."+pkg+"."), ".", "_")
+	}
+	return strings.TrimPrefix(name, ".")
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
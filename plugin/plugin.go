@@ -0,0 +1,141 @@
+// Package plugin registers code generators written in Go, which gunk runs
+// within its own process instead of executing protoc-gen-* plugin binaries.
+//
+// A program embedding gunk registers its generators before running it:
+//
+//	func main() {
+//		plugin.Register("internal", generateInternal)
+//		if err := generate.Run("", os.Args[1:]...); err != nil {
+//			os.Exit(1)
+//		}
+//	}
+//
+// The generator is then used by the sections of the .gunkconfig files named
+// after it, such as [generate internal].
+//
+// The same generator may also be built as a standalone protoc-gen-* plugin
+// with RunMain:
+//
+//	func main() {
+//		plugin.RunMain(generateInternal, plugin.FeatureProto3Optional)
+//	}
+package plugin
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+// Feature is a feature of the protobuf language which a generator supports, as
+// declared in the supported_features of its CodeGeneratorResponse. gunk
+// refuses the output of generators which don't support the features used by
+// the generated files, as protoc does.
+type Feature uint64
+
+const (
+	// FeatureProto3Optional is the support of optional fields in proto3
+	// files.
+	FeatureProto3Optional = Feature(pluginpb.CodeGeneratorResponse_FEATURE_PROTO3_OPTIONAL)
+	// FeatureSupportsEditions is the support of files using protobuf
+	// editions instead of proto2 or proto3 syntax.
+	FeatureSupportsEditions Feature = 2
+)
+
+// String returns the name of the feature, such as "proto3 optional fields".
+func (f Feature) String() string {
+	switch f {
+	case FeatureProto3Optional:
+		return "proto3 optional fields"
+	case FeatureSupportsEditions:
+		return "editions"
+	}
+	return fmt.Sprintf("feature %d", uint64(f))
+}
+
+// Func generates code from a request, like a protoc-gen-* plugin. Errors in
+// the request may either be returned, or set in the response.
+type Func func(*pluginpb.CodeGeneratorRequest) (*pluginpb.CodeGeneratorResponse, error)
+
+var (
+	mu      sync.RWMutex
+	plugins = make(map[string]Func)
+)
+
+// Register makes a generator available under a name, such as "internal" for
+// [generate internal] and for the protoc-gen-internal command. It panics if
+// the generator is nil, or if a generator is already registered under the
+// name.
+func Register(name string, fn func(*pluginpb.CodeGeneratorRequest) (*pluginpb.CodeGeneratorResponse, error)) {
+	mu.Lock()
+	defer mu.Unlock()
+	if fn == nil {
+		panic("plugin: Register generator is nil")
+	}
+	if _, dup := plugins[name]; dup {
+		panic("plugin: Register called twice for generator " + name)
+	}
+	plugins[name] = fn
+}
+
+// Lookup returns the generator registered under a name, if any.
+func Lookup(name string) (Func, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	fn, ok := plugins[name]
+	return fn, ok
+}
+
+// WithFeatures returns a generator declaring the features in the responses of
+// fn, for generators which don't set supported_features themselves.
+func WithFeatures(fn Func, features ...Feature) Func {
+	return func(req *pluginpb.CodeGeneratorRequest) (*pluginpb.CodeGeneratorResponse, error) {
+		resp, err := fn(req)
+		if err != nil || resp == nil {
+			return resp, err
+		}
+		for _, f := range features {
+			resp.SupportedFeatures = proto.Uint64(resp.GetSupportedFeatures() | uint64(f))
+		}
+		return resp, nil
+	}
+}
+
+// RunMain runs a generator as a protoc-gen-* plugin, reading the request from
+// the standard input and writing the response to the standard output. The
+// response declares the supported features, and errors returned by the
+// generator are set in it. RunMain exits if the request cannot be read or the
+// response cannot be written.
+func RunMain(fn Func, features ...Feature) {
+	if err := run(os.Stdin, os.Stdout, WithFeatures(fn, features...)); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", os.Args[0], err)
+		os.Exit(1)
+	}
+}
+
+func run(r io.Reader, w io.Writer, fn Func) error {
+	in, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	req := &pluginpb.CodeGeneratorRequest{}
+	if err := proto.Unmarshal(in, req); err != nil {
+		return err
+	}
+	resp, err := fn(req)
+	if err != nil {
+		resp = &pluginpb.CodeGeneratorResponse{Error: proto.String(err.Error())}
+	} else if resp == nil {
+		resp = &pluginpb.CodeGeneratorResponse{}
+	}
+	out, err := proto.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(out)
+	return err
+}
@@ -0,0 +1,59 @@
+package plugin
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+func TestRegister(t *testing.T) {
+	gen := func(*pluginpb.CodeGeneratorRequest) (*pluginpb.CodeGeneratorResponse, error) {
+		return &pluginpb.CodeGeneratorResponse{}, nil
+	}
+	if _, ok := Lookup("test"); ok {
+		t.Fatal("found an unregistered generator")
+	}
+	Register("test", gen)
+	if fn, ok := Lookup("test"); !ok || fn == nil {
+		t.Fatal("registered generator not found")
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatal("registering a generator twice didn't panic")
+		}
+	}()
+	Register("test", gen)
+}
+
+func TestRun(t *testing.T) {
+	gen := WithFeatures(func(req *pluginpb.CodeGeneratorRequest) (*pluginpb.CodeGeneratorResponse, error) {
+		if req.GetParameter() == "fail" {
+			return nil, errors.New("failed")
+		}
+		return &pluginpb.CodeGeneratorResponse{}, nil
+	}, FeatureProto3Optional, FeatureSupportsEditions)
+	tests := []struct {
+		param string
+		want  *pluginpb.CodeGeneratorResponse
+	}{
+		{"", &pluginpb.CodeGeneratorResponse{SupportedFeatures: proto.Uint64(3)}},
+		{"fail", &pluginpb.CodeGeneratorResponse{Error: proto.String("failed")}},
+	}
+	for _, test := range tests {
+		in, _ := proto.Marshal(&pluginpb.CodeGeneratorRequest{Parameter: proto.String(test.param)})
+		var out bytes.Buffer
+		if err := run(bytes.NewReader(in), &out, gen); err != nil {
+			t.Fatal(err)
+		}
+		got := &pluginpb.CodeGeneratorResponse{}
+		if err := proto.Unmarshal(out.Bytes(), got); err != nil {
+			t.Fatal(err)
+		}
+		if !proto.Equal(got, test.want) {
+			t.Errorf("param %q: got %v, want %v", test.param, got, test.want)
+		}
+	}
+}
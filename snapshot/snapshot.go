@@ -0,0 +1,228 @@
+// Package snapshot archives the complete resolved schema of Gunk packages,
+// such as at each release, so that later changes can be diffed and old schemas
+// documented without checking out old revisions.
+package snapshot
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/gunk/gunk/changelog"
+	"github.com/gunk/gunk/config"
+	"github.com/gunk/gunk/generate"
+	"github.com/gunk/gunk/generate/doc"
+	"github.com/gunk/gunk/protoutil"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Snapshot is the resolved schema of a set of Gunk packages.
+type Snapshot struct {
+	// Version labels the snapshot, such as "v1.2.0".
+	Version string
+	// Packages are the snapshotted packages, sorted by path.
+	Packages []*Package
+	// Files holds the descriptors of the packages, including their
+	// source code info, and those of all of their imports.
+	Files *descriptorpb.FileDescriptorSet
+}
+
+// Package is a snapshotted Gunk package.
+type Package struct {
+	// Path is the import path of the package.
+	Path string `json:"path"`
+	// File is the name of the package's file in the snapshot's Files.
+	File string `json:"file"`
+	// Hashes are the SHA-256 hashes of the package's Gunk files, keyed by
+	// their base names, which tell the sources the snapshot was taken
+	// from.
+	Hashes map[string]string `json:"hashes"`
+}
+
+// archive is the encoding of a Snapshot, which is stored as gzipped JSON.
+type archive struct {
+	Version     string     `json:"version,omitempty"`
+	Packages    []*Package `json:"packages"`
+	Descriptors []byte     `json:"descriptors"`
+}
+
+// Take takes a snapshot of the Gunk packages matching the patterns.
+func Take(dir, version string, patterns ...string) (*Snapshot, error) {
+	pkgs, fds, err := generate.LoadDescriptors(dir, patterns...)
+	if err != nil {
+		return nil, err
+	}
+	if len(pkgs) == 0 {
+		return nil, fmt.Errorf("no Gunk packages to snapshot")
+	}
+	s := &Snapshot{Version: version, Files: fds}
+	for _, pkg := range pkgs {
+		p := &Package{
+			Path:   pkg.PkgPath,
+			File:   path.Join(pkg.PkgPath, "all.proto"),
+			Hashes: make(map[string]string, len(pkg.GunkFiles)),
+		}
+		for _, name := range pkg.GunkFiles {
+			data, err := ioutil.ReadFile(name)
+			if err != nil {
+				return nil, err
+			}
+			p.Hashes[filepath.Base(name)] = fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+		}
+		s.Packages = append(s.Packages, p)
+	}
+	sort.Slice(s.Packages, func(i, j int) bool {
+		return s.Packages[i].Path < s.Packages[j].Path
+	})
+	return s, nil
+}
+
+// Read reads the snapshot at path.
+func Read(path string) (*Snapshot, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("invalid snapshot %s: %w", path, err)
+	}
+	var a archive
+	if err := json.NewDecoder(zr).Decode(&a); err != nil {
+		return nil, fmt.Errorf("invalid snapshot %s: %w", path, err)
+	}
+	fds := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(a.Descriptors, fds); err != nil {
+		return nil, fmt.Errorf("invalid snapshot %s: %w", path, err)
+	}
+	return &Snapshot{Version: a.Version, Packages: a.Packages, Files: fds}, nil
+}
+
+// Write writes the snapshot to path.
+func (s *Snapshot) Write(path string) error {
+	descriptors, err := protoutil.MarshalDeterministic(s.Files)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(zw).Encode(archive{s.Version, s.Packages, descriptors}); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, buf.Bytes(), 0o644)
+}
+
+// File returns the descriptor of the package with the import path, or nil if
+// the snapshot has no such package.
+func (s *Snapshot) File(pkgPath string) *descriptorpb.FileDescriptorProto {
+	for _, pkg := range s.Packages {
+		if pkg.Path != pkgPath {
+			continue
+		}
+		for _, f := range s.Files.File {
+			if f.GetName() == pkg.File {
+				return f
+			}
+		}
+	}
+	return nil
+}
+
+// Save takes a snapshot of the Gunk packages matching the patterns, and
+// writes it to path.
+func Save(dir, path, version string, patterns ...string) error {
+	s, err := Take(dir, version, patterns...)
+	if err != nil {
+		return err
+	}
+	return s.Write(path)
+}
+
+// Diff writes to w the changes from the snapshot at oldPath to the one at
+// newPath, one per line. If newPath is empty, the Gunk packages in dir are
+// snapshotted instead. If breaking is set, only the breaking changes are
+// written, and an error is returned if there are any.
+func Diff(w io.Writer, dir, oldPath, newPath string, breaking bool) error {
+	old, err := Read(oldPath)
+	if err != nil {
+		return err
+	}
+	var new *Snapshot
+	if newPath != "" {
+		new, err = Read(newPath)
+	} else {
+		new, err = Take(dir, "", "./...")
+	}
+	if err != nil {
+		return err
+	}
+	pkgPaths := make(map[string]bool)
+	for _, s := range []*Snapshot{old, new} {
+		for _, pkg := range s.Packages {
+			pkgPaths[pkg.Path] = true
+		}
+	}
+	sorted := make([]string, 0, len(pkgPaths))
+	for pkgPath := range pkgPaths {
+		sorted = append(sorted, pkgPath)
+	}
+	sort.Strings(sorted)
+	var numBreaking int
+	for _, pkgPath := range sorted {
+		for _, c := range changelog.Diff(old.File(pkgPath), new.File(pkgPath)) {
+			if c.Kind == changelog.Breaking {
+				numBreaking++
+			} else if breaking {
+				continue
+			}
+			fmt.Fprintf(w, "%s: %s\n", pkgPath, c)
+		}
+	}
+	if breaking && numBreaking > 0 {
+		return fmt.Errorf("%d breaking changes since %s", numBreaking, oldPath)
+	}
+	return nil
+}
+
+// Doc writes the documentation of the packages in the snapshot at path to
+// outDir, as the doc generator would, in one of the formats in doc.Formats.
+// All of the packages are documented in the default tag.
+func Doc(path, outDir, format string) error {
+	s, err := Read(path)
+	if err != nil {
+		return err
+	}
+	ext, ok := doc.Formats[format]
+	if !ok {
+		return fmt.Errorf("unknown doc format %q; must be json, asciidoc or rst", format)
+	}
+	tag := &doc.Tag{Name: config.DefaultTag}
+	for _, pkg := range s.Packages {
+		p, err := doc.FromDescriptor(s.File(pkg.Path), s.Files.File)
+		if err != nil {
+			return fmt.Errorf("unable to document %s: %w", pkg.Path, err)
+		}
+		tag.Packages = append(tag.Packages, p)
+	}
+	var buf bytes.Buffer
+	if err := doc.Render(&buf, tag, format); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(outDir, 0o755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(outDir, config.DefaultTag+ext), buf.Bytes(), 0o644)
+}
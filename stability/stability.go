@@ -0,0 +1,167 @@
+// Package stability checks that the stability annotations of Gunk packages
+// only evolve monotonically, by comparing them against a snapshot.
+package stability
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/gunk/gunk/loader"
+)
+
+// Snapshot holds the stability annotations of the declarations of Gunk
+// packages, keyed by their qualified names such as "example.com/pkg.Service"
+// or "example.com/pkg.Message.Field".
+type Snapshot map[string]loader.Stability
+
+// Run checks the stability annotations of the Gunk packages matching the
+// patterns against the snapshot at snapshotPath. If update is set and the
+// check passes, the snapshot is updated. A missing snapshot is treated as
+// empty.
+func Run(dir, snapshotPath string, update bool, patterns ...string) error {
+	l := &loader.Loader{
+		Dir:   dir,
+		Fset:  token.NewFileSet(),
+		Types: true,
+	}
+	pkgs, err := l.Load(patterns...)
+	if err != nil {
+		return err
+	}
+	if len(pkgs) == 0 {
+		return fmt.Errorf("no Gunk packages to check")
+	}
+	if loader.PrintErrors(pkgs) > 0 {
+		return fmt.Errorf("encountered package loading errors")
+	}
+	old, err := Load(snapshotPath)
+	if err != nil {
+		return err
+	}
+	cur, declared := collect(pkgs)
+	violations := Check(old, cur, declared)
+	for _, v := range violations {
+		fmt.Fprintln(os.Stderr, v)
+	}
+	if len(violations) > 0 {
+		return fmt.Errorf("stability annotations do not evolve monotonically from %s", snapshotPath)
+	}
+	if !update {
+		return nil
+	}
+	data, err := json.MarshalIndent(cur, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(snapshotPath, append(data, '\n'), 0o644)
+}
+
+// Load reads the snapshot at path, returning an empty snapshot if it doesn't
+// exist.
+func Load(path string) (Snapshot, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return Snapshot{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var s Snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("unable to parse snapshot %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Check returns the violations of monotonic evolution from the old to the
+// current annotations, where declared holds the declarations which currently
+// exist. Stability levels may only be raised, Since annotations may not
+// change, and neither may be dropped. Stable declarations may not be removed.
+func Check(old, cur Snapshot, declared map[string]bool) []string {
+	var violations []string
+	for name, o := range old {
+		c := cur[name]
+		if !declared[name] {
+			if o.Level == "stable" {
+				violations = append(violations, fmt.Sprintf("%s: stable declaration was removed", name))
+			}
+			continue
+		}
+		switch {
+		case o.Level == "":
+		case c.Level == "":
+			violations = append(violations, fmt.Sprintf("%s: stability annotation %s was removed", name, o.Level))
+		case loader.StabilityRank(c.Level) < loader.StabilityRank(o.Level):
+			violations = append(violations, fmt.Sprintf("%s: stability lowered from %s to %s", name, o.Level, c.Level))
+		}
+		switch {
+		case o.Since == "":
+		case c.Since == "":
+			violations = append(violations, fmt.Sprintf("%s: since annotation %s was removed", name, o.Since))
+		case c.Since != o.Since:
+			violations = append(violations, fmt.Sprintf("%s: since changed from %s to %s", name, o.Since, c.Since))
+		}
+	}
+	sort.Strings(violations)
+	return violations
+}
+
+// collect returns the stability annotations of the declarations in pkgs,
+// along with the names of all the declarations.
+func collect(pkgs []*loader.GunkPackage) (Snapshot, map[string]bool) {
+	s := make(Snapshot)
+	declared := make(map[string]bool)
+	add := func(name string, doc *ast.CommentGroup) {
+		declared[name] = true
+		// Annotations were already validated by the loader.
+		_, stability, _ := loader.SplitStability(doc.Text())
+		if stability != (loader.Stability{}) {
+			s[name] = stability
+		}
+	}
+	for _, pkg := range pkgs {
+		for _, file := range pkg.GunkSyntax {
+			add(pkg.PkgPath, file.Doc)
+			for _, decl := range file.Decls {
+				gd, ok := decl.(*ast.GenDecl)
+				if !ok {
+					continue
+				}
+				for _, spec := range gd.Specs {
+					switch spec := spec.(type) {
+					case *ast.TypeSpec:
+						name := pkg.PkgPath + "." + spec.Name.Name
+						add(name, spec.Doc)
+						var fields *ast.FieldList
+						switch typ := spec.Type.(type) {
+						case *ast.StructType:
+							fields = typ.Fields
+						case *ast.InterfaceType:
+							fields = typ.Methods
+						}
+						if fields == nil {
+							continue
+						}
+						for _, field := range fields.List {
+							for _, fieldName := range field.Names {
+								add(name+"."+fieldName.Name, field.Doc)
+							}
+						}
+					case *ast.ValueSpec:
+						for _, valueName := range spec.Names {
+							if valueName.Name != "_" {
+								add(pkg.PkgPath+"."+valueName.Name, spec.Doc)
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	return s, declared
+}
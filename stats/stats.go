@@ -0,0 +1,100 @@
+// Package stats records local usage statistics of gunk commands.
+//
+// Recording is opt-in: statistics are only appended, as JSON lines, to the
+// file named by the GUNK_STATS_FILE environment variable. They are never sent
+// anywhere, so that teams can collect and aggregate the files themselves, for
+// example from CI runs.
+package stats
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rogpeppe/go-internal/lockedfile"
+)
+
+// FileEnv is the environment variable naming the file statistics are
+// appended to.
+const FileEnv = "GUNK_STATS_FILE"
+
+// Entry holds the statistics of a single gunk command.
+type Entry struct {
+	// Time is when the command started.
+	Time time.Time `json:"time"`
+	// Command is the command that was run, such as "gunk generate".
+	Command string `json:"command"`
+	// Version is the version of gunk.
+	Version string `json:"version"`
+	// DurationMS is the duration of the command in milliseconds.
+	DurationMS int64 `json:"duration_ms"`
+	// Success reports whether the command succeeded.
+	Success bool `json:"success"`
+	// Packages is the number of Gunk packages loaded.
+	Packages int `json:"packages"`
+	// CacheHits and CacheMisses count the lookups of tools such as protoc
+	// and protoc plugins in the gunk cache, by tool.
+	CacheHits   map[string]int `json:"cache_hits,omitempty"`
+	CacheMisses map[string]int `json:"cache_misses,omitempty"`
+}
+
+var (
+	mu      sync.Mutex
+	current = Entry{
+		CacheHits:   make(map[string]int),
+		CacheMisses: make(map[string]int),
+	}
+)
+
+// AddPackages records that n Gunk packages were loaded.
+func AddPackages(n int) {
+	mu.Lock()
+	defer mu.Unlock()
+	current.Packages += n
+}
+
+// CacheHit records that the tool was found in the gunk cache.
+func CacheHit(tool string) {
+	mu.Lock()
+	defer mu.Unlock()
+	current.CacheHits[tool]++
+}
+
+// CacheMiss records that the tool had to be downloaded or built.
+func CacheMiss(tool string) {
+	mu.Lock()
+	defer mu.Unlock()
+	current.CacheMisses[tool]++
+}
+
+// Record appends the statistics of the command which started at start to the
+// statistics file, if statistics are enabled.
+func Record(command, version string, start time.Time, success bool) error {
+	path := os.Getenv(FileEnv)
+	if path == "" {
+		return nil
+	}
+	mu.Lock()
+	e := current
+	mu.Unlock()
+	e.Time = start
+	e.Command = command
+	e.Version = version
+	e.DurationMS = time.Since(start).Milliseconds()
+	e.Success = success
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	// Lock the file, as several gunk commands may be run concurrently.
+	f, err := lockedfile.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
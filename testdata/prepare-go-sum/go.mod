@@ -2,4 +2,7 @@ module testdata.tld/util
 
 go 1.16
 
-require github.com/gunk/opt v0.1.0
+require (
+	github.com/gunk/opt v0.1.0
+	google.golang.org/protobuf v1.26.0
+)
@@ -4,4 +4,5 @@ package util
 
 import (
 	_ "github.com/gunk/opt/http"
+	_ "google.golang.org/protobuf/types/known/anypb"
 )
@@ -19,13 +19,17 @@ func Run(dir string) error {
 		if info.IsDir() {
 			return nil
 		}
-		if strings.HasSuffix(info.Name(), ".gunkconfig") {
+		load := config.LoadSingle
+		if info.Name() == "gunk.yaml" {
+			load = config.LoadYAML
+		}
+		if strings.HasSuffix(info.Name(), ".gunkconfig") || info.Name() == "gunk.yaml" {
 			reader, err := os.Open(path)
 			if err != nil {
 				return fmt.Errorf("unable to open file: %w", err)
 			}
 			defer reader.Close()
-			cfg, err := config.LoadSingle(reader)
+			cfg, err := load(reader)
 			if err != nil {
 				return fmt.Errorf("unable to load gunkconfig: %w", err)
 			}
@@ -43,7 +47,11 @@ func vetCfg(dir string, cfg *config.Config) {
 
 	for _, g := range cfg.Generators {
 		code := g.Code()
-		if code == "ts" || code == "js" {
+		if g.PluginVersion == "" {
+			// The version may be pinned in the [plugins] section.
+			g.PluginVersion = cfg.PluginVersions[g.Command]
+		}
+		if g.IsTS() || code == "js" {
 			if !g.FixPaths {
 				fmt.Printf(
 					"%s: add fix_paths_postproc=true [generate %s]\n",
@@ -68,6 +76,21 @@ func vetCfg(dir string, cfg *config.Config) {
 				}
 			}
 		}
+		if code == "twirp" {
+			// Twirp versions before v8 don't support the package
+			// name in go_package, which Gunk always sets.
+			version := g.PluginVersion
+			if version != "" {
+				s := strings.Split(version, ".")
+				major, err := strconv.Atoi(strings.TrimPrefix(s[0], "v"))
+				if err == nil && major < 8 {
+					fmt.Printf(
+						"%s: use new version - plugin_version=v8.1.3 [generate %s]\n",
+						dir,
+						code)
+				}
+			}
+		}
 		if code == "swagger" {
 			fmt.Printf(
 				"%s: do not use swagger. [generate %s] Use:\n[generate openapiv2]\njson_names_for_fields=true\nplugin_version=v2.3.0\n\n",